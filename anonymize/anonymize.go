@@ -0,0 +1,480 @@
+// Package anonymize outputs the anonymization of the messages, for turning
+// production payloads into test fixtures.
+//
+// The fields to anonymize are given by a custom field option named
+// anonymize, of an enum type whose values are HASH, FAKE and DROP, e.g.
+//
+//    enum Anonymize {
+//        KEEP = 0;
+//        HASH = 1;
+//        FAKE = 2;
+//        DROP = 3;
+//    }
+//    extend google.protobuf.FieldOptions {
+//        Anonymize anonymize = 50100;
+//    }
+//    string email = 1 [(anonymize) = FAKE];
+//
+// For every message Foo it generates an Anonymize(rng *rand.Rand) *Foo
+// method returning an anonymized copy of a Foo: the values of its HASH
+// fields are replaced by a hash of them, so that the joins between
+// messages are kept, the ones of its FAKE fields by random values of the
+// same shape drawn from rng, and its DROP fields are cleared. Its message
+// fields are anonymized in turn, and its unknown fields and extensions
+// dropped. The options not applying to the type of their field fail the
+// generation rather than being ignored.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package anonymize
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// optionName is the name of the field option giving the anonymization of a
+// field.
+const optionName = "anonymize"
+
+// The anonymizations of the fields, as named by the values of the option,
+// possibly prefixed, e.g. ANONYMIZE_HASH.
+const (
+    hash = "HASH" // replace the value by a hash of it
+    fake = "FAKE" // replace the value by a random one of the same shape
+    drop = "DROP" // clear the field
+)
+
+// importPaths are the packages the anonymizations may use.
+var importPaths = []string{"crypto/sha256", "encoding/binary", "encoding/hex", "math", "math/rand", "unicode"}
+
+func init() {
+    generator.RegisterPlugin(new(anonymize))
+}
+
+// anonymize is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the Anonymize methods of the messages.
+type anonymize struct {
+    gen *generator.Generator
+
+    pkgNames map[string]string // names of the packages of importPaths
+
+    ext  *pb.FieldDescriptorProto // the anonymize option, nil if not declared
+    used map[string]bool          // packages of importPaths used by the file being generated
+}
+
+// Name returns the name of this plugin, "anonymize".
+func (a *anonymize) Name() string {
+    return "anonymize"
+}
+
+// Init initializes the plugin.
+func (a *anonymize) Init(gen *generator.Generator) {
+    a.gen = gen
+    a.pkgNames = make(map[string]string)
+    for _, path := range importPaths {
+        a.pkgNames[path] = generator.RegisterUniquePackageName(path[strings.LastIndex(path, "/")+1:], nil)
+    }
+}
+
+// P forwards to a.gen.P.
+func (a *anonymize) P(args ...interface{}) { a.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (a *anonymize) pkg(importPath string) string {
+    a.used[importPath] = true
+    return a.pkgNames[importPath]
+}
+
+// Generate generates the Anonymize methods of the messages in the given
+// file.
+func (a *anonymize) Generate(file *generator.FileDescriptor) {
+    a.used = make(map[string]bool)
+    if !descutil.IsGenerated(a.gen, file.GetName()) {
+        return
+    }
+    a.ext = descutil.Extension(a.gen, ".google.protobuf.FieldOptions", optionName)
+    if a.ext != nil && a.ext.GetType() != pb.FieldDescriptorProto_TYPE_ENUM && a.ext.GetType() != pb.FieldDescriptorProto_TYPE_STRING {
+        a.gen.Fail("the", optionName, "option must be an enum or a string")
+    }
+    if file.GetName() == a.gen.Request.FileToGenerate[0] {
+        a.generateHelpers()
+    }
+    for _, msg := range descutil.Messages(a.gen, file) {
+        a.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (a *anonymize) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range a.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    a.P("import (")
+    for _, path := range paths {
+        a.P(a.pkgNames[path], " ", strconv.Quote(path))
+    }
+    a.P(")")
+    a.P()
+}
+
+// generateHelpers generates, once per package, the functions hashing and
+// faking the values of the fields.
+func (a *anonymize) generateHelpers() {
+    sha256, binary, hex := a.pkg("crypto/sha256"), a.pkg("encoding/binary"), a.pkg("encoding/hex")
+    rand, math, unicode := a.pkg("math/rand"), a.pkg("math"), a.pkg("unicode")
+    a.P("// _anonymizeHash returns a hash of x, the same for the same x.")
+    a.P("func _anonymizeHash(x uint64) uint64 {")
+    a.P("var b [8]byte")
+    a.P(binary, ".BigEndian.PutUint64(b[:], x)")
+    a.P("sum := ", sha256, ".Sum256(b[:])")
+    a.P("return ", binary, ".BigEndian.Uint64(sum[:8])")
+    a.P("}")
+    a.P()
+    a.P("// _anonymizeHashString returns the first 16 hexadecimal digits of the")
+    a.P("// SHA-256 hash of s.")
+    a.P("func _anonymizeHashString(s string) string {")
+    a.P("sum := ", sha256, ".Sum256([]byte(s))")
+    a.P("return ", hex, ".EncodeToString(sum[:8])")
+    a.P("}")
+    a.P()
+    a.P("// _anonymizeHashBytes returns the SHA-256 hash of b, or nil if b is nil.")
+    a.P("func _anonymizeHashBytes(b []byte) []byte {")
+    a.P("if b == nil {")
+    a.P("return nil")
+    a.P("}")
+    a.P("sum := ", sha256, ".Sum256(b)")
+    a.P("return sum[:]")
+    a.P("}")
+    a.P()
+    a.P("// _anonymizeFakeString returns a random string of the shape of s: its")
+    a.P("// letters and digits are replaced by random ASCII ones, of the same case,")
+    a.P(`// and its other characters kept, e.g. "jane.doe@example.com" becoming`)
+    a.P(`// "qhxu.wkt@zbnoplf.rtw".`)
+    a.P("func _anonymizeFakeString(rng *", rand, ".Rand, s string) string {")
+    a.P("r := []rune(s)")
+    a.P("for i, c := range r {")
+    a.P("switch {")
+    a.P("case ", unicode, ".IsUpper(c):")
+    a.P("r[i] = 'A' + rune(rng.Intn(26))")
+    a.P("case ", unicode, ".IsLetter(c):")
+    a.P("r[i] = 'a' + rune(rng.Intn(26))")
+    a.P("case ", unicode, ".IsDigit(c):")
+    a.P("r[i] = '0' + rune(rng.Intn(10))")
+    a.P("}")
+    a.P("}")
+    a.P("return string(r)")
+    a.P("}")
+    a.P()
+    a.P("// _anonymizeFakeBytes returns random bytes of the length of b, or nil if b")
+    a.P("// is nil.")
+    a.P("func _anonymizeFakeBytes(rng *", rand, ".Rand, b []byte) []byte {")
+    a.P("if b == nil {")
+    a.P("return nil")
+    a.P("}")
+    a.P("fake := make([]byte, len(b))")
+    a.P("rng.Read(fake)")
+    a.P("return fake")
+    a.P("}")
+    a.P()
+    a.P("// _anonymizeFakeUint returns a random number of as many decimal digits as")
+    a.P("// x, at most max.")
+    a.P("func _anonymizeFakeUint(rng *", rand, ".Rand, x, max uint64) uint64 {")
+    a.P("lo, hi := uint64(0), uint64(9)")
+    a.P("for x > hi && hi <= max/10 {")
+    a.P("lo, hi = hi+1, hi*10+9")
+    a.P("}")
+    a.P("if x > hi {")
+    a.P("lo, hi = hi+1, max")
+    a.P("}")
+    a.P("if hi > max {")
+    a.P("hi = max")
+    a.P("}")
+    a.P("return lo + rng.Uint64()%(hi-lo+1)")
+    a.P("}")
+    a.P()
+    a.P("// _anonymizeFakeInt returns a random number of the sign of x and of as many")
+    a.P("// decimal digits, at most max in absolute value.")
+    a.P("func _anonymizeFakeInt(rng *", rand, ".Rand, x, max int64) int64 {")
+    a.P("if x < 0 {")
+    a.P("return -int64(_anonymizeFakeUint(rng, uint64(-(x+1))+1, uint64(max)))")
+    a.P("}")
+    a.P("return int64(_anonymizeFakeUint(rng, uint64(x), uint64(max)))")
+    a.P("}")
+    a.P()
+    a.P("// _anonymizeFakeFloat returns a random number of the sign and binary order")
+    a.P("// of magnitude of x, or x itself if it is zero, infinite or NaN.")
+    a.P("func _anonymizeFakeFloat(rng *", rand, ".Rand, x float64) float64 {")
+    a.P("if x == 0 || ", math, ".IsInf(x, 0) || ", math, ".IsNaN(x) {")
+    a.P("return x")
+    a.P("}")
+    a.P("_, exp := ", math, ".Frexp(x)")
+    a.P("return ", math, ".Copysign(", math, ".Ldexp(0.5+rng.Float64()/2, exp), x)")
+    a.P("}")
+    a.P()
+}
+
+// generateMessage generates the Anonymize method of msg, and its anonymize
+// method anonymizing a message in place.
+func (a *anonymize) generateMessage(msg *generator.Descriptor) {
+    typeName := a.gen.TypeName(msg)
+    rand := a.pkg("math/rand")
+    a.P("// Anonymize returns a copy of m for test fixtures, with the fields of it and")
+    a.P("// of its messages anonymized as their ", optionName, " option says: HASH replaces a")
+    a.P("// value by a hash of it, the same for the same value, FAKE by a random value")
+    a.P("// of rng of the same shape, and DROP clears the field. The unknown fields and")
+    a.P("// extensions are dropped. It returns nil if m is nil.")
+    a.P("func (m *", typeName, ") Anonymize(rng *", rand, ".Rand) *", typeName, " {")
+    a.P("if m == nil {")
+    a.P("return nil")
+    a.P("}")
+    a.P("c := ", a.gen.Pkg["proto"], ".Clone(m).(*", typeName, ")")
+    a.P("c.anonymize(rng)")
+    a.P("return c")
+    a.P("}")
+    a.P()
+    a.P("// anonymize anonymizes m in place.")
+    a.P("func (m *", typeName, ") anonymize(rng *", rand, ".Rand) {")
+    a.P("if m == nil {")
+    a.P("return")
+    a.P("}")
+    for _, field := range msg.Field {
+        if field.OneofIndex != nil {
+            a.generateOneofField(msg, field)
+        } else {
+            a.generateField(msg, field)
+        }
+    }
+    if len(msg.ExtensionRange) > 0 {
+        a.P(a.gen.Pkg["proto"], ".ClearAllExtensions(m)")
+    }
+    if msg.File().GetSyntax() != "proto3" {
+        a.P("m.XXX_unrecognized = nil")
+    }
+    a.P("}")
+    a.P()
+}
+
+// generateField generates the anonymization of field of m, outside of a
+// oneof.
+func (a *anonymize) generateField(msg *generator.Descriptor, field *pb.FieldDescriptorProto) {
+    mode := a.mode(msg, field)
+    v := "m." + generator.CamelCase(field.GetName())
+    goType, _ := a.gen.GoType(msg, field)
+    switch {
+    case mode == drop:
+        a.P(v, " = ", zero(goType))
+    case descutil.MapEntry(a.gen, field) != nil:
+        value := descutil.MapEntry(a.gen, field).Field[1]
+        if mode == "" && !a.isMessage(value) {
+            return
+        }
+        if mode == "" {
+            a.P("for _, v := range ", v, " {")
+            a.P("v.anonymize(rng)")
+        } else {
+            a.P("for k, v := range ", v, " {")
+            a.P(v, "[k] = ", a.value(value, mode, "v"))
+        }
+        a.P("}")
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        if mode == "" && !a.isMessage(field) {
+            return
+        }
+        if mode == "" {
+            a.P("for _, v := range ", v, " {")
+            a.P("v.anonymize(rng)")
+        } else {
+            a.P("for i, v := range ", v, " {")
+            a.P(v, "[i] = ", a.value(field, mode, "v"))
+        }
+        a.P("}")
+    case mode == "":
+        if a.isMessage(field) {
+            a.P(v, ".anonymize(rng)")
+        }
+    case goType[0] == '*':
+        // Optional fields of proto2 point to their value.
+        a.P("if ", v, " != nil {")
+        a.P("v := ", a.value(field, mode, "*"+v))
+        a.P(v, " = &v")
+        a.P("}")
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES:
+        a.P(v, " = ", a.value(field, mode, v))
+    default:
+        // The unset proto3 fields, of zero value, stay unset.
+        a.P("if ", nonZero(goType, v), " {")
+        a.P(v, " = ", a.value(field, mode, v))
+        a.P("}")
+    }
+}
+
+// generateOneofField generates the anonymization of the oneof field of m.
+func (a *anonymize) generateOneofField(msg *generator.Descriptor, field *pb.FieldDescriptorProto) {
+    mode := a.mode(msg, field)
+    if mode == "" && !a.isMessage(field) {
+        return
+    }
+    fieldName := generator.CamelCase(field.GetName())
+    oneofName := generator.CamelCase(msg.OneofDecl[field.GetOneofIndex()].GetName())
+    wrapper := a.gen.TypeName(msg) + "_" + fieldName
+    if mode == drop {
+        a.P("if _, ok := m.", oneofName, ".(*", wrapper, "); ok {")
+        a.P("m.", oneofName, " = nil")
+        a.P("}")
+        return
+    }
+    a.P("if w, ok := m.", oneofName, ".(*", wrapper, "); ok {")
+    switch mode {
+    case "":
+        a.P("w.", fieldName, ".anonymize(rng)")
+    default:
+        a.P("w.", fieldName, " = ", a.value(field, mode, "w."+fieldName))
+    }
+    a.P("}")
+}
+
+// value returns the expression of the anonymization by mode, HASH or FAKE,
+// of the single value v of field.
+func (a *anonymize) value(field *pb.FieldDescriptorProto, mode, v string) string {
+    goType, _ := a.gen.GoType(nil, field)
+    goType = strings.TrimPrefix(strings.TrimPrefix(goType, "[]"), "*")
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_STRING:
+        if mode == hash {
+            return "_anonymizeHashString(" + v + ")"
+        }
+        return "_anonymizeFakeString(rng, " + v + ")"
+    case pb.FieldDescriptorProto_TYPE_BYTES:
+        if mode == hash {
+            return "_anonymizeHashBytes(" + v + ")"
+        }
+        return "_anonymizeFakeBytes(rng, " + v + ")"
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        return "rng.Intn(2) == 0"
+    case pb.FieldDescriptorProto_TYPE_FLOAT:
+        return "float32(_anonymizeFakeFloat(rng, float64(" + v + ")))"
+    case pb.FieldDescriptorProto_TYPE_DOUBLE:
+        return "_anonymizeFakeFloat(rng, " + v + ")"
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        var numbers []string
+        seen := make(map[int32]bool)
+        for _, value := range a.gen.ObjectNamed(field.GetTypeName()).(*generator.EnumDescriptor).Value {
+            if !seen[value.GetNumber()] {
+                seen[value.GetNumber()] = true
+                numbers = append(numbers, strconv.Itoa(int(value.GetNumber())))
+            }
+        }
+        return goType + "([]int32{" + strings.Join(numbers, ", ") + "}[rng.Intn(" + strconv.Itoa(len(numbers)) + ")])"
+    }
+    if mode == hash {
+        return goType + "(_anonymizeHash(uint64(" + v + ")))"
+    }
+    switch goType {
+    case "int32":
+        return "int32(_anonymizeFakeInt(rng, int64(" + v + "), 1<<31-1))"
+    case "int64":
+        return "_anonymizeFakeInt(rng, " + v + ", 1<<63-1)"
+    case "uint32":
+        return "uint32(_anonymizeFakeUint(rng, uint64(" + v + "), 1<<32-1))"
+    }
+    return "_anonymizeFakeUint(rng, " + v + ", 1<<64-1)"
+}
+
+// mode returns the anonymization of field given by its option, HASH, FAKE
+// or DROP, or "" if it has none, failing if it does not apply to the type
+// of field, or of the values of the map field.
+func (a *anonymize) mode(msg *generator.Descriptor, field *pb.FieldDescriptorProto) string {
+    if a.ext == nil {
+        return ""
+    }
+    opts := descutil.Options(field.Options)
+    values := descutil.OptionValues(a.gen, opts, a.ext)
+    if len(values) == 0 {
+        return ""
+    }
+    value := values[0]
+    if a.ext.GetType() == pb.FieldDescriptorProto_TYPE_STRING {
+        value, _ = strconv.Unquote(value)
+    }
+    name := strings.Join(msg.TypeName(), ".") + "." + field.GetName()
+    if pkg := msg.File().GetPackage(); pkg != "" {
+        name = pkg + "." + name
+    }
+    var mode string
+    for _, m := range []string{hash, fake, drop} {
+        if value == m || strings.HasSuffix(value, "_"+m) {
+            mode = m
+        }
+    }
+    if mode == "" {
+        if n, ok := opts.Varint(a.ext.GetNumber()); ok && n == 0 && a.ext.GetType() == pb.FieldDescriptorProto_TYPE_ENUM {
+            // The zero value of the enum keeps the field as is.
+            return ""
+        }
+        a.gen.Fail(fmt.Sprintf("invalid %s option of %s: unknown anonymization %q, want HASH, FAKE or DROP", optionName, name, value))
+    }
+    if mode == drop {
+        return mode
+    }
+    typ := field
+    if entry := descutil.MapEntry(a.gen, field); entry != nil {
+        typ = entry.Field[1]
+    }
+    switch typ.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+        a.gen.Fail(fmt.Sprintf("invalid %s option of %s: the message fields can only be dropped", optionName, name))
+    case pb.FieldDescriptorProto_TYPE_BOOL, pb.FieldDescriptorProto_TYPE_ENUM, pb.FieldDescriptorProto_TYPE_FLOAT, pb.FieldDescriptorProto_TYPE_DOUBLE:
+        if mode == hash {
+            a.gen.Fail(fmt.Sprintf("invalid %s option of %s: only the string, bytes and integer fields can be hashed", optionName, name))
+        }
+    }
+    return mode
+}
+
+// isMessage reports whether the values of field are messages defined in
+// the generated files, and so have an anonymize method.
+func (a *anonymize) isMessage(field *pb.FieldDescriptorProto) bool {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+        return descutil.IsGenerated(a.gen, a.gen.ObjectNamed(field.GetTypeName()).File().GetName())
+    }
+    return false
+}
+
+// zero returns the zero value of the Go type goType of a field.
+func zero(goType string) string {
+    switch {
+    case goType == "string":
+        return `""`
+    case goType == "bool":
+        return "false"
+    case goType[0] == '*' || goType[0] == '[' || strings.HasPrefix(goType, "map["):
+        return "nil"
+    }
+    return "0"
+}
+
+// nonZero returns the expression reporting whether v, of the Go scalar
+// type goType, is not the zero value, as set proto3 fields are.
+func nonZero(goType, v string) string {
+    switch goType {
+    case "string":
+        return v + ` != ""`
+    case "bool":
+        return v
+    }
+    return v + " != 0"
+}
@@ -0,0 +1,160 @@
+// Package anypack outputs typed helpers packing the messages in, and
+// unpacking them from, google.protobuf.Any values.
+//
+// For every message Foo it generates PackFoo(m *Foo) (*any.Any, error) and
+// UnpackFoo(a *any.Any) (*Foo, error), failing if a holds another type.
+// The first file of the package also gets AnyTypes, the registry of the
+// messages of the package keyed by their type URL, and UnpackAny, unpacking
+// an Any holding any of them, for the polymorphic payloads.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package anypack
+
+import (
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// Paths for packages used by code generated in this file.
+const (
+    anyPkgPath    = "github.com/golang/protobuf/ptypes/any"
+    ptypesPkgPath = "github.com/golang/protobuf/ptypes"
+)
+
+// typeURLPrefix is the prefix of the type URLs of the messages packed by
+// ptypes.MarshalAny.
+const typeURLPrefix = "type.googleapis.com/"
+
+// The names for packages imported in the generated code.
+// They may vary from the final path component of the import path
+// if the name is used by other packages.
+var (
+    anyPkg    string
+    ptypesPkg string
+)
+
+func init() {
+    generator.RegisterPlugin(new(anypack))
+}
+
+// anypack is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the Any helpers of the messages.
+type anypack struct {
+    gen *generator.Generator
+
+    used bool // the file being generated uses the any and ptypes packages
+}
+
+// Name returns the name of this plugin, "anypack".
+func (a *anypack) Name() string {
+    return "anypack"
+}
+
+// Init initializes the plugin.
+func (a *anypack) Init(gen *generator.Generator) {
+    a.gen = gen
+    anyPkg = generator.RegisterUniquePackageName("any", nil)
+    ptypesPkg = generator.RegisterUniquePackageName("ptypes", nil)
+}
+
+// P forwards to a.gen.P.
+func (a *anypack) P(args ...interface{}) { a.gen.P(args...) }
+
+// Generate generates the Any helpers of the messages in the given file,
+// and the registry of the package in its first file.
+func (a *anypack) Generate(file *generator.FileDescriptor) {
+    a.used = false
+    if !descutil.IsGenerated(a.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(a.gen, file) {
+        a.used = true
+        typeName := a.gen.TypeName(msg)
+        a.P("// Pack", typeName, " returns m packed in an Any, with the type URL of ", typeName, ".")
+        a.P("func Pack", typeName, "(m *", typeName, ") (*", anyPkg, ".Any, error) {")
+        a.P("return ", ptypesPkg, ".MarshalAny(m)")
+        a.P("}")
+        a.P()
+        a.P("// Unpack", typeName, " returns the ", typeName, " packed in a, or an error if a")
+        a.P("// holds another type.")
+        a.P("func Unpack", typeName, "(a *", anyPkg, ".Any) (*", typeName, ", error) {")
+        a.P("m := new(", typeName, ")")
+        a.P("if err := ", ptypesPkg, ".UnmarshalAny(a, m); err != nil {")
+        a.P("return nil, err")
+        a.P("}")
+        a.P("return m, nil")
+        a.P("}")
+        a.P()
+    }
+    if file.GetName() == a.gen.Request.FileToGenerate[0] {
+        a.generateRegistry()
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (a *anypack) GenerateImports(file *generator.FileDescriptor) {
+    if !a.used {
+        return
+    }
+    a.P("import (")
+    a.P(anyPkg, " ", strconv.Quote(anyPkgPath))
+    a.P(ptypesPkg, " ", strconv.Quote(ptypesPkgPath))
+    a.P(")")
+    a.P()
+}
+
+// generateRegistry generates AnyTypes, the registry of the messages of the
+// files to generate, which share a Go package, and UnpackAny.
+func (a *anypack) generateRegistry() {
+    a.used = true
+    proto := a.gen.Pkg["proto"]
+    a.P("// AnyTypes maps the type URLs of the messages of the package to functions")
+    a.P("// returning a new message of their type, for UnpackAny.")
+    a.P("var AnyTypes = map[string]func() ", proto, ".Message{")
+    for _, name := range a.gen.Request.FileToGenerate {
+        for _, msg := range descutil.FileMessages(a.fileNamed(name)) {
+            fullName := strings.Join(msg.Name, ".")
+            if pkg := msg.File.GetPackage(); pkg != "" {
+                fullName = pkg + "." + fullName
+            }
+            a.P(strconv.Quote(typeURLPrefix+fullName), ": func() ", proto, ".Message { return new(", generator.CamelCaseSlice(msg.Name), ") },")
+        }
+    }
+    a.P("}")
+    a.P()
+    a.P("// UnpackAny returns the message packed in a, whatever its type among")
+    a.P("// AnyTypes, or an error if its type is not one of them. The prefix of the")
+    a.P("// type URL of a, before its last slash, is not checked.")
+    a.P("func UnpackAny(a *", anyPkg, ".Any) (", proto, ".Message, error) {")
+    a.P("name, err := ", ptypesPkg, ".AnyMessageName(a)")
+    a.P("if err != nil {")
+    a.P("return nil, err")
+    a.P("}")
+    a.P("newMessage, ok := AnyTypes[", strconv.Quote(typeURLPrefix), "+name]")
+    a.P("if !ok {")
+    a.P("return nil, ", a.gen.Pkg["fmt"], `.Errorf("unknown type %q of Any", a.TypeUrl)`)
+    a.P("}")
+    a.P("m := newMessage()")
+    a.P("if err := ", proto, ".Unmarshal(a.Value, m); err != nil {")
+    a.P("return nil, err")
+    a.P("}")
+    a.P("return m, nil")
+    a.P("}")
+    a.P()
+}
+
+// fileNamed returns the file of the request named name.
+func (a *anypack) fileNamed(name string) *pb.FileDescriptorProto {
+    for _, f := range a.gen.Request.ProtoFile {
+        if f.GetName() == name {
+            return f
+        }
+    }
+    a.gen.Fail("can't find file", name)
+    return nil
+}
@@ -0,0 +1,408 @@
+// Package arrow outputs the Arrow schemas of the messages, and builders
+// appending them to Arrow records.
+//
+// For every message Foo it generates FooArrowSchema, the Arrow schema of
+// the records of Foos, with a column per field, named after the proto
+// field, FooArrowBuilder, an array.RecordBuilder of such records whose
+// Append(m *Foo) method appends m as a row, without reflection, and
+// NewFooArrowRecord(mem memory.Allocator, ms []*Foo) arrow.Record,
+// returning the record of the rows of a batch of Foos, e.g. to write to
+// Parquet with pqarrow.
+//
+// The message fields are structs, the repeated fields lists and the map
+// fields maps, in the order of the Go maps. The enums are the int32 numbers
+// of their values, the google.protobuf.Timestamp fields timestamps of
+// microseconds in UTC and the wrapper fields, e.g. of
+// google.protobuf.Int64Value, the values they wrap. The message fields,
+// the fields of the oneofs, the optional proto2 fields, the timestamps and
+// the wrapper fields are nullable, null when not set. The messages whose
+// fields refer back to them have no Arrow type, and no schema nor builder.
+// The generated code uses the Arrow Go library,
+// github.com/apache/arrow-go/v18.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package arrow
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// The packages of the Arrow Go library used by the generated code.
+const (
+    arrowPkgPath  = "github.com/apache/arrow-go/v18/arrow"
+    arrayPkgPath  = "github.com/apache/arrow-go/v18/arrow/array"
+    memoryPkgPath = "github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// importPaths are the packages the generated code may use.
+var importPaths = []string{arrowPkgPath, arrayPkgPath, memoryPkgPath}
+
+func init() {
+    generator.RegisterPlugin(new(arrow))
+}
+
+// arrow is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the Arrow schemas and record builders of the
+// messages.
+type arrow struct {
+    gen *generator.Generator
+
+    pkgNames map[string]string // names of the packages of importPaths
+    used     map[string]bool   // packages of importPaths used by the file being generated
+}
+
+// arrowType is the Arrow type of the values of a scalar type: the
+// expression of the Arrow data type and the builder of the arrays of such
+// values.
+type arrowType struct {
+    dataType string // in the arrow package
+    builder  string // in the array package
+}
+
+// scalarTypes maps the scalar types to their Arrow type.
+var scalarTypes = map[pb.FieldDescriptorProto_Type]arrowType{
+    pb.FieldDescriptorProto_TYPE_DOUBLE:   {"PrimitiveTypes.Float64", "Float64Builder"},
+    pb.FieldDescriptorProto_TYPE_FLOAT:    {"PrimitiveTypes.Float32", "Float32Builder"},
+    pb.FieldDescriptorProto_TYPE_INT64:    {"PrimitiveTypes.Int64", "Int64Builder"},
+    pb.FieldDescriptorProto_TYPE_UINT64:   {"PrimitiveTypes.Uint64", "Uint64Builder"},
+    pb.FieldDescriptorProto_TYPE_INT32:    {"PrimitiveTypes.Int32", "Int32Builder"},
+    pb.FieldDescriptorProto_TYPE_FIXED64:  {"PrimitiveTypes.Uint64", "Uint64Builder"},
+    pb.FieldDescriptorProto_TYPE_FIXED32:  {"PrimitiveTypes.Uint32", "Uint32Builder"},
+    pb.FieldDescriptorProto_TYPE_BOOL:     {"FixedWidthTypes.Boolean", "BooleanBuilder"},
+    pb.FieldDescriptorProto_TYPE_STRING:   {"BinaryTypes.String", "StringBuilder"},
+    pb.FieldDescriptorProto_TYPE_BYTES:    {"BinaryTypes.Binary", "BinaryBuilder"},
+    pb.FieldDescriptorProto_TYPE_UINT32:   {"PrimitiveTypes.Uint32", "Uint32Builder"},
+    pb.FieldDescriptorProto_TYPE_ENUM:     {"PrimitiveTypes.Int32", "Int32Builder"},
+    pb.FieldDescriptorProto_TYPE_SFIXED32: {"PrimitiveTypes.Int32", "Int32Builder"},
+    pb.FieldDescriptorProto_TYPE_SFIXED64: {"PrimitiveTypes.Int64", "Int64Builder"},
+    pb.FieldDescriptorProto_TYPE_SINT32:   {"PrimitiveTypes.Int32", "Int32Builder"},
+    pb.FieldDescriptorProto_TYPE_SINT64:   {"PrimitiveTypes.Int64", "Int64Builder"},
+}
+
+// timestampType is the full name of google.protobuf.Timestamp.
+const timestampType = ".google.protobuf.Timestamp"
+
+// wellKnownTypes maps the well-known types having an Arrow type other than
+// a struct to it. The wrappers are the types of their values.
+var wellKnownTypes = map[string]arrowType{
+    timestampType:                  {"FixedWidthTypes.Timestamp_us", "TimestampBuilder"},
+    ".google.protobuf.BoolValue":   scalarTypes[pb.FieldDescriptorProto_TYPE_BOOL],
+    ".google.protobuf.BytesValue":  scalarTypes[pb.FieldDescriptorProto_TYPE_BYTES],
+    ".google.protobuf.DoubleValue": scalarTypes[pb.FieldDescriptorProto_TYPE_DOUBLE],
+    ".google.protobuf.FloatValue":  scalarTypes[pb.FieldDescriptorProto_TYPE_FLOAT],
+    ".google.protobuf.Int32Value":  scalarTypes[pb.FieldDescriptorProto_TYPE_INT32],
+    ".google.protobuf.Int64Value":  scalarTypes[pb.FieldDescriptorProto_TYPE_INT64],
+    ".google.protobuf.StringValue": scalarTypes[pb.FieldDescriptorProto_TYPE_STRING],
+    ".google.protobuf.UInt32Value": scalarTypes[pb.FieldDescriptorProto_TYPE_UINT32],
+    ".google.protobuf.UInt64Value": scalarTypes[pb.FieldDescriptorProto_TYPE_UINT64],
+}
+
+// Name returns the name of this plugin, "arrow".
+func (a *arrow) Name() string {
+    return "arrow"
+}
+
+// Init initializes the plugin.
+func (a *arrow) Init(gen *generator.Generator) {
+    a.gen = gen
+    a.pkgNames = make(map[string]string)
+    for _, path := range importPaths {
+        a.pkgNames[path] = generator.RegisterUniquePackageName(path[strings.LastIndex(path, "/")+1:], nil)
+    }
+}
+
+// P forwards to a.gen.P.
+func (a *arrow) P(args ...interface{}) { a.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (a *arrow) pkg(importPath string) string {
+    a.used[importPath] = true
+    return a.pkgNames[importPath]
+}
+
+// typeName returns the Go name of the type of fully-qualified name str.
+func (a *arrow) typeName(str string) string {
+    a.gen.RecordTypeUse(str)
+    return a.gen.TypeName(a.gen.ObjectNamed(str))
+}
+
+// Generate generates the Arrow schemas and record builders of the messages
+// in the given file.
+func (a *arrow) Generate(file *generator.FileDescriptor) {
+    a.used = make(map[string]bool)
+    if !descutil.IsGenerated(a.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(a.gen, file) {
+        if !a.isRecursive(msg, nil) {
+            a.generateMessage(msg)
+        }
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (a *arrow) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range a.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    a.P("import (")
+    for _, path := range paths {
+        a.P(a.pkgNames[path], " ", strconv.Quote(path))
+    }
+    a.P(")")
+    a.P()
+}
+
+// isRecursive reports whether msg, whose fields are nested in the messages
+// outer, refers back to one of them or to itself, having no Arrow type.
+func (a *arrow) isRecursive(msg *generator.Descriptor, outer []*generator.Descriptor) bool {
+    for _, o := range outer {
+        if o == msg {
+            return true
+        }
+    }
+    outer = append(outer, msg)
+    for _, field := range msg.Field {
+        if field.GetType() != pb.FieldDescriptorProto_TYPE_MESSAGE && field.GetType() != pb.FieldDescriptorProto_TYPE_GROUP {
+            continue
+        }
+        if _, ok := wellKnownTypes[field.GetTypeName()]; ok {
+            continue
+        }
+        if a.isRecursive(a.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor), outer) {
+            return true
+        }
+    }
+    return false
+}
+
+// generateMessage generates the Arrow schema and record builder of msg.
+func (a *arrow) generateMessage(msg *generator.Descriptor) {
+    typeName := a.gen.TypeName(msg)
+    arrowPkg, array, memory := a.pkg(arrowPkgPath), a.pkg(arrayPkgPath), a.pkg(memoryPkgPath)
+    a.P("// ", typeName, "ArrowSchema is the Arrow schema of the records of ", typeName, "s, with a")
+    a.P("// column per field.")
+    a.P("var ", typeName, "ArrowSchema = ", arrowPkg, ".NewSchema([]", arrowPkg, ".Field{")
+    for _, field := range msg.Field {
+        a.P(a.fieldExpr(msg, field, false), ",")
+    }
+    a.P("}, nil)")
+    a.P()
+    a.P("// ", typeName, "ArrowBuilder builds the records of ", typeName, "ArrowSchema, a row")
+    a.P("// per ", typeName, ".")
+    a.P("type ", typeName, "ArrowBuilder struct {")
+    a.P("*", array, ".RecordBuilder")
+    a.P("}")
+    a.P()
+    a.P("// New", typeName, "ArrowBuilder returns a builder of records allocating from mem,")
+    a.P("// to release once done.")
+    a.P("func New", typeName, "ArrowBuilder(mem ", memory, ".Allocator) *", typeName, "ArrowBuilder {")
+    a.P("return &", typeName, "ArrowBuilder{", array, ".NewRecordBuilder(mem, ", typeName, "ArrowSchema)}")
+    a.P("}")
+    a.P()
+    a.P("// Append appends m, which must not be nil, as a row of the record being")
+    a.P("// built.")
+    a.P("func (b *", typeName, "ArrowBuilder) Append(m *", typeName, ") {")
+    a.generateAppendFields(msg, typeName, "b.Field", "m", 0)
+    a.P("}")
+    a.P()
+    a.P("// New", typeName, "ArrowRecord returns the record of the rows ms, allocated")
+    a.P("// from mem, to release once done.")
+    a.P("func New", typeName, "ArrowRecord(mem ", memory, ".Allocator, ms []*", typeName, ") ", arrowPkg, ".Record {")
+    a.P("b := New", typeName, "ArrowBuilder(mem)")
+    a.P("defer b.Release()")
+    a.P("for _, m := range ms {")
+    a.P("b.Append(m)")
+    a.P("}")
+    a.P("return b.NewRecord()")
+    a.P("}")
+    a.P()
+}
+
+// fieldExpr returns the expression of the arrow.Field of the column of
+// field, of msg, a field of a struct if inStruct.
+func (a *arrow) fieldExpr(msg *generator.Descriptor, field *pb.FieldDescriptorProto, inStruct bool) string {
+    expr := fmt.Sprintf("{Name: %s, Type: %s", strconv.Quote(field.GetName()), a.dataType(msg, field))
+    if inStruct {
+        expr = a.pkg(arrowPkgPath) + ".Field" + expr
+    }
+    if a.isNullable(msg, field) {
+        expr += ", Nullable: true"
+    }
+    return expr + "}"
+}
+
+// dataType returns the expression of the Arrow data type of the column of
+// field, of msg.
+func (a *arrow) dataType(msg *generator.Descriptor, field *pb.FieldDescriptorProto) string {
+    arrowPkg := a.pkg(arrowPkgPath)
+    if entry := descutil.MapEntry(a.gen, field); entry != nil {
+        return arrowPkg + ".MapOf(" + a.valueDataType(entry.Field[0]) + ", " + a.valueDataType(entry.Field[1]) + ")"
+    }
+    if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+        return arrowPkg + ".ListOf(" + a.valueDataType(field) + ")"
+    }
+    return a.valueDataType(field)
+}
+
+// valueDataType returns the expression of the Arrow data type of a single
+// value of field: a struct of the columns of the fields of its message
+// type, or its scalar type.
+func (a *arrow) valueDataType(field *pb.FieldDescriptorProto) string {
+    arrowPkg := a.pkg(arrowPkgPath)
+    if typ, ok := a.scalarType(field); ok {
+        return arrowPkg + "." + typ.dataType
+    }
+    msg := a.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor)
+    fields := make([]string, len(msg.Field))
+    for i, f := range msg.Field {
+        fields[i] = a.fieldExpr(msg, f, true) + ",\n"
+    }
+    return arrowPkg + ".StructOf(\n" + strings.Join(fields, "") + ")"
+}
+
+// scalarType returns the Arrow type of the values of field, if not structs.
+func (a *arrow) scalarType(field *pb.FieldDescriptorProto) (arrowType, bool) {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+        typ, ok := wellKnownTypes[field.GetTypeName()]
+        return typ, ok
+    }
+    return scalarTypes[field.GetType()], true
+}
+
+// isNullable reports whether the column of field, of msg, may be null: it
+// is a message field, a field of a oneof or an optional proto2 field.
+func (a *arrow) isNullable(msg *generator.Descriptor, field *pb.FieldDescriptorProto) bool {
+    switch {
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        return false
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE, field.GetType() == pb.FieldDescriptorProto_TYPE_GROUP:
+        return true
+    case field.OneofIndex != nil:
+        return true
+    }
+    return field.GetLabel() == pb.FieldDescriptorProto_LABEL_OPTIONAL && msg.File().GetSyntax() != "proto3"
+}
+
+// builderType returns the builder of the arrays of the column of field.
+func (a *arrow) builderType(field *pb.FieldDescriptorProto) string {
+    array := a.pkg(arrayPkgPath)
+    switch {
+    case descutil.MapEntry(a.gen, field) != nil:
+        return array + ".MapBuilder"
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        return array + ".ListBuilder"
+    }
+    return a.valueBuilderType(field)
+}
+
+// valueBuilderType returns the builder of the arrays of the single values
+// of field.
+func (a *arrow) valueBuilderType(field *pb.FieldDescriptorProto) string {
+    if typ, ok := a.scalarType(field); ok {
+        return a.pkg(arrayPkgPath) + "." + typ.builder
+    }
+    return a.pkg(arrayPkgPath) + ".StructBuilder"
+}
+
+// generateAppendFields generates the appending of the fields of the message
+// m, of type msg whose Go name is typeName, to the builders returned by
+// builders(i) for the field of index i, at the given depth of nesting.
+func (a *arrow) generateAppendFields(msg *generator.Descriptor, typeName, builders, m string, depth int) {
+    for i, field := range msg.Field {
+        b := fmt.Sprintf("b%d", depth)
+        fieldName := generator.CamelCase(field.GetName())
+        a.P("{")
+        a.P(b, " := ", builders, "(", i, ").(*", a.builderType(field), ")")
+        switch goType, _ := a.gen.GoType(msg, field); {
+        case descutil.MapEntry(a.gen, field) != nil:
+            entry := descutil.MapEntry(a.gen, field)
+            k, v := fmt.Sprintf("k%d", depth), fmt.Sprintf("v%d", depth)
+            a.P(b, ".Append(true)")
+            a.P(k, "b := ", b, ".KeyBuilder().(*", a.valueBuilderType(entry.Field[0]), ")")
+            a.P(v, "b := ", b, ".ItemBuilder().(*", a.valueBuilderType(entry.Field[1]), ")")
+            a.P("for ", k, ", ", v, " := range ", m, ".", fieldName, " {")
+            a.generateAppendValue(entry.Field[0], k+"b", k, depth+1)
+            a.generateAppendValue(entry.Field[1], v+"b", v, depth+1)
+            a.P("}")
+        case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+            v := fmt.Sprintf("v%d", depth)
+            a.P(b, ".Append(true)")
+            a.P(v, "b := ", b, ".ValueBuilder().(*", a.valueBuilderType(field), ")")
+            a.P("for _, ", v, " := range ", m, ".", fieldName, " {")
+            a.generateAppendValue(field, v+"b", v, depth+1)
+            a.P("}")
+        case field.OneofIndex != nil:
+            v := fmt.Sprintf("v%d", depth)
+            oneofName := generator.CamelCase(msg.OneofDecl[field.GetOneofIndex()].GetName())
+            a.P("if ", v, ", ok := ", m, ".", oneofName, ".(*", typeName, "_", fieldName, "); ok {")
+            a.generateAppendValue(field, b, v+"."+fieldName, depth+1)
+            a.P("} else {")
+            a.P(b, ".AppendNull()")
+            a.P("}")
+        case a.isNullable(msg, field) && field.GetType() != pb.FieldDescriptorProto_TYPE_MESSAGE && field.GetType() != pb.FieldDescriptorProto_TYPE_GROUP:
+            // Optional fields of proto2 point to their value, but for the
+            // bytes, nil when not set.
+            v := m + "." + fieldName
+            a.P("if ", v, " == nil {")
+            a.P(b, ".AppendNull()")
+            a.P("} else {")
+            if goType[0] == '*' {
+                v = "*" + v
+            }
+            a.generateAppendValue(field, b, v, depth+1)
+            a.P("}")
+        case goType[0] == '*' && field.GetType() != pb.FieldDescriptorProto_TYPE_MESSAGE && field.GetType() != pb.FieldDescriptorProto_TYPE_GROUP:
+            // Required fields of proto2 point to their value too.
+            a.generateAppendValue(field, b, m+".Get"+fieldName+"()", depth)
+        default:
+            a.generateAppendValue(field, b, m+"."+fieldName, depth)
+        }
+        a.P("}")
+    }
+}
+
+// generateAppendValue generates the appending of the single value v of
+// field to the builder b, at the given depth of nesting.
+func (a *arrow) generateAppendValue(field *pb.FieldDescriptorProto, b, v string, depth int) {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        a.P(b, ".Append(int32(", v, "))")
+        return
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+    default:
+        a.P(b, ".Append(", v, ")")
+        return
+    }
+    a.P("if ", v, " == nil {")
+    a.P(b, ".AppendNull()")
+    switch _, ok := wellKnownTypes[field.GetTypeName()]; {
+    case field.GetTypeName() == timestampType:
+        a.P("} else {")
+        a.P(b, ".Append(", a.pkg(arrowPkgPath), ".Timestamp(", v, ".Seconds*1000000 + int64(", v, ".Nanos)/1000))")
+    case ok:
+        a.P("} else {")
+        a.P(b, ".Append(", v, ".Value)")
+    default:
+        msg := a.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor)
+        a.P("} else {")
+        a.P(b, ".Append(true)")
+        a.generateAppendFields(msg, a.typeName(field.GetTypeName()), b+".FieldBuilder", v, depth+1)
+    }
+    a.P("}")
+}
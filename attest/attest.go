@@ -0,0 +1,84 @@
+// Package attest outputs a reproducibility attestation for the generated files.
+//
+// The first generated file of the package records, as constants, the hash
+// of the descriptor set and of the parameters the package was generated
+// from, along with the generator version. Regenerating with the verify
+// parameter then checks that committed outputs are up to date.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package attest
+
+import (
+    "crypto/sha256"
+    "fmt"
+    "path"
+    "sort"
+    "strings"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+    "github.com/lleveque/protoc-gen-go/internal/version"
+)
+
+func init() {
+    generator.RegisterPlugin(new(attest))
+}
+
+// attest is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the reproducibility attestation of
+// the generated package.
+type attest struct {
+    gen      *generator.Generator
+    packages map[string]bool // directories of the Go packages attested so far
+}
+
+// Name returns the name of this plugin, "attest".
+func (a *attest) Name() string {
+    return "attest"
+}
+
+// Init initializes the plugin.
+func (a *attest) Init(gen *generator.Generator) {
+    a.gen = gen
+    a.packages = make(map[string]bool)
+}
+
+// P forwards to a.gen.P.
+func (a *attest) P(args ...interface{}) { a.gen.P(args...) }
+
+// Generate generates the attestation constants in the first file to generate
+// of each Go package, identified by the directory of its files.
+func (a *attest) Generate(file *generator.FileDescriptor) {
+    dir := path.Dir(descutil.OutputName(a.gen, file.FileDescriptorProto, ".pb.go"))
+    if a.packages[dir] {
+        return
+    }
+    a.packages[dir] = true
+    a.P("// Reproducibility attestation of this package: the hashes of the descriptor")
+    a.P("// set and of the parameters it was generated from, and the generator version.")
+    a.P("const (")
+    a.P("AttestationDescriptorSetHash = ", fmt.Sprintf("%q", descutil.DescriptorSetHash(a.gen)))
+    a.P("AttestationParametersHash = ", fmt.Sprintf("%q", a.parametersHash()))
+    a.P("AttestationGeneratorVersion = ", fmt.Sprintf("%q", version.Version))
+    a.P(")")
+    a.P()
+}
+
+// GenerateImports generates the import declaration for this file.
+func (a *attest) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// parametersHash hashes the command-line parameters, in a canonical order.
+// The verify parameter does not change the output and is left out.
+func (a *attest) parametersHash() string {
+    var params []string
+    for k, v := range a.gen.Param {
+        if k == "verify" {
+            continue
+        }
+        params = append(params, k+"="+v)
+    }
+    sort.Strings(params)
+    return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(strings.Join(params, ","))))
+}
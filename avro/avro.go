@@ -0,0 +1,239 @@
+// Package avro outputs the Avro schemas of the messages.
+//
+// For every message of the files to generate it writes an Avro schema,
+// named after the full name of the message, e.g. greeting.Foo.avsc, next to
+// the Go file of its file, for the ingestion of the messages in data lakes.
+// The messages are records, named after their full name, with a field per
+// proto field, in the same order and with the same name. The nested
+// messages and enums are defined where first used, and referenced by name
+// afterwards, so that recursive messages are supported. The repeated fields
+// are arrays and the map fields maps, whose keys Avro only allows as
+// strings. The message fields, the fields of the oneofs and the optional
+// proto2 fields are unions of null and their type, defaulting to null, the
+// other fields defaulting to the zero value of their type. The unsigned
+// 32-bit integers are longs, and the 64-bit ones too, larger values
+// wrapping around. The google.protobuf.Timestamp fields are
+// timestamp-micros longs and the wrapper fields, e.g. of
+// google.protobuf.Int64Value, nullable values of the type they wrap.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package avro
+
+import (
+    "encoding/json"
+    "fmt"
+    "path"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+func init() {
+    generator.RegisterPlugin(new(avro))
+}
+
+// avro is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates Avro schemas.
+type avro struct {
+    gen *generator.Generator
+
+    defined map[string]bool // full names of the types defined in the schema being generated
+}
+
+// object is a JSON object of a schema. Its keys are sorted on output.
+type object map[string]interface{}
+
+// primitiveTypes maps the scalar types to the Avro primitive types of their
+// values.
+var primitiveTypes = map[pb.FieldDescriptorProto_Type]string{
+    pb.FieldDescriptorProto_TYPE_DOUBLE:   "double",
+    pb.FieldDescriptorProto_TYPE_FLOAT:    "float",
+    pb.FieldDescriptorProto_TYPE_INT64:    "long",
+    pb.FieldDescriptorProto_TYPE_UINT64:   "long",
+    pb.FieldDescriptorProto_TYPE_INT32:    "int",
+    pb.FieldDescriptorProto_TYPE_FIXED64:  "long",
+    pb.FieldDescriptorProto_TYPE_FIXED32:  "long",
+    pb.FieldDescriptorProto_TYPE_BOOL:     "boolean",
+    pb.FieldDescriptorProto_TYPE_STRING:   "string",
+    pb.FieldDescriptorProto_TYPE_BYTES:    "bytes",
+    pb.FieldDescriptorProto_TYPE_UINT32:   "long",
+    pb.FieldDescriptorProto_TYPE_SFIXED32: "int",
+    pb.FieldDescriptorProto_TYPE_SFIXED64: "long",
+    pb.FieldDescriptorProto_TYPE_SINT32:   "int",
+    pb.FieldDescriptorProto_TYPE_SINT64:   "long",
+}
+
+// primitiveDefaults are the defaults of the fields of the Avro primitive
+// types: the zero values of the proto fields.
+var primitiveDefaults = map[string]interface{}{
+    "double":  0,
+    "float":   0,
+    "long":    0,
+    "int":     0,
+    "boolean": false,
+    "string":  "",
+    "bytes":   "",
+}
+
+// wellKnownTypes maps the well-known types having a special Avro type to
+// it.
+var wellKnownTypes = map[string]interface{}{
+    ".google.protobuf.Timestamp":   object{"type": "long", "logicalType": "timestamp-micros"},
+    ".google.protobuf.BoolValue":   "boolean",
+    ".google.protobuf.BytesValue":  "bytes",
+    ".google.protobuf.DoubleValue": "double",
+    ".google.protobuf.FloatValue":  "float",
+    ".google.protobuf.Int32Value":  "int",
+    ".google.protobuf.Int64Value":  "long",
+    ".google.protobuf.StringValue": "string",
+    ".google.protobuf.UInt32Value": "long",
+    ".google.protobuf.UInt64Value": "long",
+}
+
+// Name returns the name of this plugin, "avro".
+func (a *avro) Name() string {
+    return "avro"
+}
+
+// Init initializes the plugin.
+func (a *avro) Init(gen *generator.Generator) {
+    a.gen = gen
+}
+
+// Generate writes the Avro schemas of the messages of the given file.
+func (a *avro) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(a.gen, file.GetName()) {
+        return
+    }
+    dir := path.Dir(descutil.OutputName(a.gen, file.FileDescriptorProto, ".avsc"))
+    for _, msg := range descutil.Messages(a.gen, file) {
+        a.defined = make(map[string]bool)
+        data, err := json.MarshalIndent(a.record(msg), "", "  ")
+        if err != nil {
+            a.gen.Error(err, "failed to encode the Avro schema")
+        }
+        descutil.AddFile(a.gen, path.Join(dir, fullName(msg)+".avsc"), string(data)+"\n")
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (a *avro) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// fullName returns the full proto name of the message or enum obj.
+func fullName(obj generator.Object) string {
+    name := strings.Join(obj.TypeName(), ".")
+    if pkg := obj.File().GetPackage(); pkg != "" {
+        name = pkg + "." + name
+    }
+    return name
+}
+
+// record returns the record schema of msg, defining it.
+func (a *avro) record(msg *generator.Descriptor) object {
+    name := fullName(msg)
+    a.defined[name] = true
+    msgPath := descutil.MessagePath(msg)
+    fields := []interface{}{}
+    proto3 := msg.File().GetSyntax() == "proto3"
+    for i, field := range msg.Field {
+        f := a.field(field, proto3)
+        if doc := descutil.LeadingComments(msg.File(), fmt.Sprintf("%s,2,%d", msgPath, i)); doc != "" {
+            f["doc"] = doc
+        }
+        fields = append(fields, f)
+    }
+    schema := object{"type": "record", "name": name, "fields": fields}
+    if doc := descutil.LeadingComments(msg.File(), msgPath); doc != "" {
+        schema["doc"] = doc
+    }
+    return schema
+}
+
+// enum returns the enum schema of enum, defining it. Its default is its
+// first value, the default of the proto3 enums.
+func (a *avro) enum(enum *generator.EnumDescriptor) object {
+    name := fullName(enum)
+    a.defined[name] = true
+    var symbols []string
+    for _, value := range enum.Value {
+        symbols = append(symbols, value.GetName())
+    }
+    schema := object{"type": "enum", "name": name, "symbols": symbols, "default": symbols[0]}
+    if doc := descutil.LeadingComments(enum.File(), descutil.EnumPath(enum)); doc != "" {
+        schema["doc"] = doc
+    }
+    return schema
+}
+
+// field returns the schema of field in its record, of a proto3 message if
+// proto3.
+func (a *avro) field(field *pb.FieldDescriptorProto, proto3 bool) object {
+    f := object{"name": field.GetName()}
+    if field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE {
+        if entry, ok := a.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor); ok && entry.GetOptions().GetMapEntry() {
+            f["type"], f["default"] = object{"type": "map", "values": a.valueType(entry.Field[1])}, object{}
+            return f
+        }
+    }
+    typ := a.valueType(field)
+    switch {
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        f["type"], f["default"] = object{"type": "array", "items": typ}, []interface{}{}
+    case isNullable(field, proto3):
+        f["type"], f["default"] = []interface{}{"null", typ}, nil
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_ENUM:
+        f["type"], f["default"] = typ, a.enumDefault(field.GetTypeName())
+    default:
+        f["type"] = typ
+        if def, ok := primitiveDefaults[primitiveTypes[field.GetType()]]; ok {
+            f["default"] = def
+        }
+    }
+    return f
+}
+
+// isNullable reports whether the values of field, of a proto3 message if
+// proto3, may be absent: it is a message field, a field of a oneof or an
+// optional proto2 field.
+func isNullable(field *pb.FieldDescriptorProto, proto3 bool) bool {
+    switch {
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE, field.GetType() == pb.FieldDescriptorProto_TYPE_GROUP:
+        return field.GetLabel() != pb.FieldDescriptorProto_LABEL_REQUIRED
+    case field.OneofIndex != nil:
+        return true
+    }
+    return field.GetLabel() == pb.FieldDescriptorProto_LABEL_OPTIONAL && !proto3
+}
+
+// valueType returns the Avro type of a single value of field: its
+// primitive type, or the schema of its message or enum type, or its full
+// name once defined.
+func (a *avro) valueType(field *pb.FieldDescriptorProto) interface{} {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+        if typ, ok := wellKnownTypes[field.GetTypeName()]; ok {
+            return typ
+        }
+        msg := a.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor)
+        if a.defined[fullName(msg)] {
+            return fullName(msg)
+        }
+        return a.record(msg)
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        enum := a.gen.ObjectNamed(field.GetTypeName()).(*generator.EnumDescriptor)
+        if a.defined[fullName(enum)] {
+            return fullName(enum)
+        }
+        return a.enum(enum)
+    }
+    return primitiveTypes[field.GetType()]
+}
+
+// enumDefault returns the default of the fields of the enum named typ.
+func (a *avro) enumDefault(typ string) string {
+    return a.gen.ObjectNamed(typ).(*generator.EnumDescriptor).Value[0].GetName()
+}
@@ -0,0 +1,266 @@
+// Package bigquery outputs the BigQuery table schemas of the messages.
+//
+// For every message of the files to generate it writes the schema of a
+// BigQuery table of its messages, named after its full name, e.g.
+// greeting.Foo.bigquery.json, next to the Go file of its file: the JSON
+// array of the fields of the table taken by bq mk --schema and the
+// BigQuery API, for the tables the messages are streamed into, e.g. with
+// the Storage Write API. The columns are named after the proto fields, in
+// the same order. The message fields are RECORD columns, with the columns
+// of their fields, the repeated fields REPEATED columns and the map fields
+// REPEATED RECORD columns of key and value, as BigQuery stores the maps.
+// The other fields are NULLABLE, but for the required proto2 fields,
+// REQUIRED. The integers are INTEGER columns, but for the unsigned 64-bit
+// ones, NUMERIC, the enums INTEGER columns of the numbers of their values,
+// the google.protobuf.Timestamp fields TIMESTAMP columns and the wrapper
+// fields, e.g. of google.protobuf.Int64Value, columns of the type they
+// wrap. The leading comments of the fields are the descriptions of their
+// columns. BigQuery tables do not nest, the recursive messages have no
+// schema: they are skipped with a warning.
+//
+// The type of a column can be overridden by a custom field option named
+// bigquery_type, a string or an enum whose values are the BigQuery types,
+// possibly prefixed, e.g.
+//
+//    extend google.protobuf.FieldOptions {
+//        string bigquery_type = 50200;
+//    }
+//    Kind kind = 1 [(bigquery_type) = "STRING"];
+//    google.protobuf.Struct attributes = 2 [(bigquery_type) = "JSON"];
+//
+// A message field so overridden has no columns of its fields. The zero
+// value of an enum option keeps the type.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package bigquery
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "path"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// optionName is the name of the field option overriding the type of the
+// column of a field.
+const optionName = "bigquery_type"
+
+// maxDescription is the maximum length, in characters, of the description
+// of a column.
+const maxDescription = 1024
+
+func init() {
+    generator.RegisterPlugin(new(bigquery))
+}
+
+// bigquery is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates BigQuery table schemas.
+type bigquery struct {
+    gen *generator.Generator
+    ext *pb.FieldDescriptorProto // the bigquery_type option, nil if not declared
+
+    nesting []string // full names of the messages whose columns are being generated
+}
+
+// column is a column of a BigQuery table schema.
+type column struct {
+    Name        string    `json:"name"`
+    Type        string    `json:"type"`
+    Mode        string    `json:"mode"`
+    Description string    `json:"description,omitempty"`
+    Fields      []*column `json:"fields,omitempty"`
+}
+
+// The modes of the columns.
+const (
+    nullable = "NULLABLE"
+    required = "REQUIRED"
+    repeated = "REPEATED"
+)
+
+// columnTypes maps the scalar types to the BigQuery types of their columns.
+var columnTypes = map[pb.FieldDescriptorProto_Type]string{
+    pb.FieldDescriptorProto_TYPE_DOUBLE:   "FLOAT",
+    pb.FieldDescriptorProto_TYPE_FLOAT:    "FLOAT",
+    pb.FieldDescriptorProto_TYPE_INT64:    "INTEGER",
+    pb.FieldDescriptorProto_TYPE_UINT64:   "NUMERIC",
+    pb.FieldDescriptorProto_TYPE_INT32:    "INTEGER",
+    pb.FieldDescriptorProto_TYPE_FIXED64:  "NUMERIC",
+    pb.FieldDescriptorProto_TYPE_FIXED32:  "INTEGER",
+    pb.FieldDescriptorProto_TYPE_BOOL:     "BOOLEAN",
+    pb.FieldDescriptorProto_TYPE_STRING:   "STRING",
+    pb.FieldDescriptorProto_TYPE_BYTES:    "BYTES",
+    pb.FieldDescriptorProto_TYPE_UINT32:   "INTEGER",
+    pb.FieldDescriptorProto_TYPE_ENUM:     "INTEGER",
+    pb.FieldDescriptorProto_TYPE_SFIXED32: "INTEGER",
+    pb.FieldDescriptorProto_TYPE_SFIXED64: "INTEGER",
+    pb.FieldDescriptorProto_TYPE_SINT32:   "INTEGER",
+    pb.FieldDescriptorProto_TYPE_SINT64:   "INTEGER",
+}
+
+// wellKnownTypes maps the well-known types having a BigQuery type other than
+// RECORD to it.
+var wellKnownTypes = map[string]string{
+    ".google.protobuf.Timestamp":   "TIMESTAMP",
+    ".google.protobuf.BoolValue":   "BOOLEAN",
+    ".google.protobuf.BytesValue":  "BYTES",
+    ".google.protobuf.DoubleValue": "FLOAT",
+    ".google.protobuf.FloatValue":  "FLOAT",
+    ".google.protobuf.Int32Value":  "INTEGER",
+    ".google.protobuf.Int64Value":  "INTEGER",
+    ".google.protobuf.StringValue": "STRING",
+    ".google.protobuf.UInt32Value": "INTEGER",
+    ".google.protobuf.UInt64Value": "NUMERIC",
+}
+
+// overrideTypes are the BigQuery types the bigquery_type option may give,
+// the ones of the columns without fields.
+var overrideTypes = []string{
+    "STRING", "BYTES", "INTEGER", "INT64", "FLOAT", "FLOAT64", "NUMERIC", "BIGNUMERIC",
+    "BOOLEAN", "BOOL", "TIMESTAMP", "DATE", "TIME", "DATETIME", "GEOGRAPHY", "JSON",
+}
+
+// Name returns the name of this plugin, "bigquery".
+func (b *bigquery) Name() string {
+    return "bigquery"
+}
+
+// Init initializes the plugin.
+func (b *bigquery) Init(gen *generator.Generator) {
+    b.gen = gen
+}
+
+// Generate writes the BigQuery table schemas of the messages of the given
+// file.
+func (b *bigquery) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(b.gen, file.GetName()) {
+        return
+    }
+    b.ext = descutil.Extension(b.gen, ".google.protobuf.FieldOptions", optionName)
+    if b.ext != nil && b.ext.GetType() != pb.FieldDescriptorProto_TYPE_ENUM && b.ext.GetType() != pb.FieldDescriptorProto_TYPE_STRING {
+        b.gen.Fail("the", optionName, "option must be an enum or a string")
+    }
+    dir := path.Dir(descutil.OutputName(b.gen, file.FileDescriptorProto, ".bigquery.json"))
+    for _, msg := range descutil.Messages(b.gen, file) {
+        columns, err := b.columns(msg)
+        if err != nil {
+            log.Printf("protoc-gen-go: WARNING: no BigQuery schema for %s: %v", fullName(msg), err)
+            continue
+        }
+        data, err := json.MarshalIndent(columns, "", "  ")
+        if err != nil {
+            b.gen.Error(err, "failed to encode the BigQuery schema")
+        }
+        descutil.AddFile(b.gen, path.Join(dir, fullName(msg)+".bigquery.json"), string(data)+"\n")
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (b *bigquery) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// fullName returns the full proto name of msg.
+func fullName(msg *generator.Descriptor) string {
+    name := strings.Join(msg.TypeName(), ".")
+    if pkg := msg.File().GetPackage(); pkg != "" {
+        name = pkg + "." + name
+    }
+    return name
+}
+
+// columns returns the columns of the fields of msg, or an error if msg is
+// recursive.
+func (b *bigquery) columns(msg *generator.Descriptor) ([]*column, error) {
+    name := fullName(msg)
+    for _, outer := range b.nesting {
+        if outer == name {
+            return nil, fmt.Errorf("%s is recursive", name)
+        }
+    }
+    b.nesting = append(b.nesting, name)
+    defer func() { b.nesting = b.nesting[:len(b.nesting)-1] }()
+
+    msgPath := descutil.MessagePath(msg)
+    columns := []*column{}
+    for i, field := range msg.Field {
+        c, err := b.column(msg, field)
+        if err != nil {
+            return nil, err
+        }
+        if desc := descutil.LeadingComments(msg.File(), fmt.Sprintf("%s,2,%d", msgPath, i)); desc != "" {
+            if runes := []rune(desc); len(runes) > maxDescription {
+                desc = string(runes[:maxDescription])
+            }
+            c.Description = desc
+        }
+        columns = append(columns, c)
+    }
+    return columns, nil
+}
+
+// column returns the column of field, of msg, or an error if its message
+// type is recursive.
+func (b *bigquery) column(msg *generator.Descriptor, field *pb.FieldDescriptorProto) (*column, error) {
+    c := &column{Name: field.GetName(), Mode: nullable}
+    switch field.GetLabel() {
+    case pb.FieldDescriptorProto_LABEL_REPEATED:
+        c.Mode = repeated
+    case pb.FieldDescriptorProto_LABEL_REQUIRED:
+        c.Mode = required
+    }
+    if typ := b.override(msg, field); typ != "" {
+        c.Type = typ
+        return c, nil
+    }
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+        if typ, ok := wellKnownTypes[field.GetTypeName()]; ok {
+            c.Type = typ
+            return c, nil
+        }
+        c.Type = "RECORD"
+        fields, err := b.columns(b.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor))
+        if err != nil {
+            return nil, err
+        }
+        c.Fields = fields
+    default:
+        c.Type = columnTypes[field.GetType()]
+    }
+    return c, nil
+}
+
+// override returns the BigQuery type given by the option of field, of msg,
+// or "" if it has none, failing if it is not one of overrideTypes.
+func (b *bigquery) override(msg *generator.Descriptor, field *pb.FieldDescriptorProto) string {
+    if b.ext == nil {
+        return ""
+    }
+    opts := descutil.Options(field.Options)
+    values := descutil.OptionValues(b.gen, opts, b.ext)
+    if len(values) == 0 {
+        return ""
+    }
+    value := values[0]
+    if b.ext.GetType() == pb.FieldDescriptorProto_TYPE_STRING {
+        value, _ = strconv.Unquote(value)
+    }
+    for _, typ := range overrideTypes {
+        if strings.EqualFold(value, typ) || strings.HasSuffix(value, "_"+typ) {
+            return typ
+        }
+    }
+    if n, ok := opts.Varint(b.ext.GetNumber()); ok && n == 0 && b.ext.GetType() == pb.FieldDescriptorProto_TYPE_ENUM {
+        // The zero value of the enum keeps the type.
+        return ""
+    }
+    b.gen.Fail(fmt.Sprintf("invalid %s option of %s.%s: unknown BigQuery type %q", optionName, fullName(msg), field.GetName(), value))
+    return ""
+}
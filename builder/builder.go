@@ -0,0 +1,270 @@
+// Package builder outputs builders of the messages with many fields.
+//
+// The messages to build are given by a custom bool message option named
+// builder, e.g.
+//
+//    extend google.protobuf.MessageOptions {
+//        bool builder = 50300;
+//    }
+//    message Order {
+//        option (builder) = true;
+//        ...
+//    }
+//
+// For every such message Foo it generates a FooBuilder, returned by
+// NewFooBuilder, whose chained setters set the fields of a Foo by name,
+// e.g. NewOrderBuilder().SetId(id).AddItems(item).Build(), where
+// positional struct literals of many fields are error-prone. Build returns
+// the Foo built once it is validated by its Validate and CustomValidate
+// methods, if it has them.
+//
+// As an alternative, the custom bool file option functional_options,
+//
+//    extend google.protobuf.FileOptions {
+//        bool functional_options = 50301;
+//    }
+//    option (functional_options) = true;
+//
+// generates for every message Foo of a file a NewFoo(opts ...FooOption)
+// constructor, with a WithFooBar option function per field bar, e.g.
+// NewOrder(WithOrderId(id), WithOrderItems(item)).
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package builder
+
+import (
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// optionName is the name of the message option enabling the builder of a
+// message, and fileOptionName the one of the file option enabling the
+// functional options of the messages of a file.
+const (
+    optionName     = "builder"
+    fileOptionName = "functional_options"
+)
+
+func init() {
+    generator.RegisterPlugin(new(builder))
+}
+
+// builder is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the builders of the messages having
+// the builder option, and the functional options of the messages of the
+// files having the functional_options option.
+type builder struct {
+    gen *generator.Generator
+
+    ext *pb.FieldDescriptorProto // the builder option, nil if not declared
+}
+
+// Name returns the name of this plugin, "builder".
+func (b *builder) Name() string {
+    return "builder"
+}
+
+// Init initializes the plugin.
+func (b *builder) Init(gen *generator.Generator) {
+    b.gen = gen
+}
+
+// P forwards to b.gen.P.
+func (b *builder) P(args ...interface{}) { b.gen.P(args...) }
+
+// Generate generates the builders, and the functional options, of the
+// messages in the given file.
+func (b *builder) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(b.gen, file.GetName()) {
+        return
+    }
+    b.ext = b.boolOption(".google.protobuf.MessageOptions", optionName)
+    if b.ext != nil {
+        for _, msg := range descutil.Messages(b.gen, file) {
+            if b.hasBuilder(msg) {
+                b.generateBuilder(msg)
+            }
+        }
+    }
+    if ext := b.boolOption(".google.protobuf.FileOptions", fileOptionName); ext != nil {
+        if v, ok := descutil.Options(file.Options).Varint(ext.GetNumber()); ok && v != 0 {
+            for _, msg := range descutil.Messages(b.gen, file) {
+                b.generateOptions(msg)
+            }
+        }
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+// The generated code only uses the proto package, always imported.
+func (b *builder) GenerateImports(file *generator.FileDescriptor) {}
+
+// boolOption returns the custom option name of extendee, or nil if it is
+// not declared. It must be a bool.
+func (b *builder) boolOption(extendee, name string) *pb.FieldDescriptorProto {
+    ext := descutil.Extension(b.gen, extendee, name)
+    if ext != nil && ext.GetType() != pb.FieldDescriptorProto_TYPE_BOOL {
+        b.gen.Fail("the", name, "option must be a bool")
+    }
+    return ext
+}
+
+// hasBuilder reports whether the builder option of msg is set.
+func (b *builder) hasBuilder(msg *generator.Descriptor) bool {
+    v, ok := descutil.Options(msg.Options).Varint(b.ext.GetNumber())
+    return ok && v != 0
+}
+
+// generateBuilder generates the builder of msg, its constructor, setters
+// and Build method.
+func (b *builder) generateBuilder(msg *generator.Descriptor) {
+    typeName := b.gen.TypeName(msg)
+    builderName := typeName + "Builder"
+
+    b.P("// ", builderName, " builds a ", typeName, " with chained setters, one per field.")
+    b.P("type ", builderName, " struct {")
+    b.P("m *", typeName)
+    b.P("}")
+    b.P()
+    b.P("// New", builderName, " returns a builder of a ", typeName, " whose fields are all unset.")
+    b.P("func New", builderName, "() *", builderName, " { return &", builderName, "{new(", typeName, ")} }")
+    b.P()
+    for _, field := range msg.Field {
+        b.generateSetters(msg, builderName, field)
+    }
+    b.P("// Build returns a copy of the ", typeName, " built, or an error if its Validate or")
+    b.P("// CustomValidate method, if it has one, fails. The builder can still be")
+    b.P("// used afterwards, e.g. to build variants of the ", typeName, ".")
+    b.P("func (b *", builderName, ") Build() (*", typeName, ", error) {")
+    b.P("m := ", b.gen.Pkg["proto"], ".Clone(b.m).(*", typeName, ")")
+    for _, hook := range []string{"Validate", "CustomValidate"} {
+        b.P("if v, ok := interface{}(m).(interface{ ", hook, "() error }); ok {")
+        b.P("if err := v.", hook, "(); err != nil {")
+        b.P("return nil, err")
+        b.P("}")
+        b.P("}")
+    }
+    b.P("return m, nil")
+    b.P("}")
+    b.P()
+}
+
+// generateSetters generates the setters of field in the builder of msg:
+// SetFoo replacing its value, and AddFoo appending to it if it is repeated,
+// or PutFoo setting an entry of it if it is a map.
+func (b *builder) generateSetters(msg *generator.Descriptor, builderName string, field *pb.FieldDescriptorProto) {
+    fieldName := generator.CamelCase(field.GetName())
+    goType, set := b.setter(msg, field, "b.m", "v")
+    b.P("// Set", fieldName, " sets the ", field.GetName(), " field to v.")
+    b.P("func (b *", builderName, ") Set", fieldName, "(v ", goType, ") *", builderName, " {")
+    b.P(set)
+    b.P("return b")
+    b.P("}")
+    b.P()
+
+    if entry := descutil.MapEntry(b.gen, field); entry != nil {
+        keyType, valueType := b.mapTypes(entry)
+        b.P("// Put", fieldName, " sets the entry of key k of the ", field.GetName(), " field to v.")
+        b.P("func (b *", builderName, ") Put", fieldName, "(k ", keyType, ", v ", valueType, ") *", builderName, " {")
+        b.P("if b.m.", fieldName, " == nil {")
+        b.P("b.m.", fieldName, " = make(", goType, ")")
+        b.P("}")
+        b.P("b.m.", fieldName, "[k] = v")
+        b.P("return b")
+        b.P("}")
+        b.P()
+    } else if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+        b.P("// Add", fieldName, " appends v to the ", field.GetName(), " field.")
+        b.P("func (b *", builderName, ") Add", fieldName, "(v ...", goType[2:], ") *", builderName, " {")
+        b.P("b.m.", fieldName, " = append(b.m.", fieldName, ", v...)")
+        b.P("return b")
+        b.P("}")
+        b.P()
+    }
+}
+
+// generateOptions generates the functional options of msg: the FooOption
+// type, the NewFoo constructor applying them, and the WithFooBar option of
+// each field bar.
+func (b *builder) generateOptions(msg *generator.Descriptor) {
+    typeName := b.gen.TypeName(msg)
+    optionType := typeName + "Option"
+
+    b.P("// ", optionType, " sets a field of the ", typeName, " returned by New", typeName, ".")
+    b.P("type ", optionType, " func(*", typeName, ")")
+    b.P()
+    b.P("// New", typeName, " returns a new ", typeName, " with its fields set by opts, in turn.")
+    b.P("func New", typeName, "(opts ...", optionType, ") *", typeName, " {")
+    b.P("m := new(", typeName, ")")
+    b.P("for _, opt := range opts {")
+    b.P("opt(m)")
+    b.P("}")
+    b.P("return m")
+    b.P("}")
+    b.P()
+    for _, field := range msg.Field {
+        fieldName := generator.CamelCase(field.GetName())
+        goType, set := b.setter(msg, field, "m", "v")
+        if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED && descutil.MapEntry(b.gen, field) == nil {
+            goType = "..." + goType[2:]
+        }
+        b.P("// With", typeName, fieldName, " sets the ", field.GetName(), " field of the ", typeName, " to v.")
+        b.P("func With", typeName, fieldName, "(v ", goType, ") ", optionType, " {")
+        b.P("return func(m *", typeName, ") {")
+        b.P(set)
+        b.P("}")
+        b.P("}")
+        b.P()
+    }
+}
+
+// setter returns the Go type of the values of field of msg, and the
+// statement setting it to the value v in the message m.
+func (b *builder) setter(msg *generator.Descriptor, field *pb.FieldDescriptorProto, m, v string) (goType, set string) {
+    fieldName := generator.CamelCase(field.GetName())
+    goType, _ = b.gen.GoType(msg, field)
+    if field.OneofIndex != nil {
+        oneofName := generator.CamelCase(msg.OneofDecl[field.GetOneofIndex()].GetName())
+        if !isMessage(field) {
+            goType = trimStar(goType)
+        }
+        return goType, m + "." + oneofName + " = &" + b.gen.TypeName(msg) + "_" + fieldName + "{" + v + "}"
+    }
+    switch {
+    case descutil.MapEntry(b.gen, field) != nil:
+        keyType, valueType := b.mapTypes(descutil.MapEntry(b.gen, field))
+        goType = "map[" + keyType + "]" + valueType
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+    case goType[0] == '*' && !isMessage(field):
+        // Optional fields of proto2 point to their value.
+        goType, v = goType[1:], "&"+v
+    }
+    return goType, m + "." + fieldName + " = " + v
+}
+
+// mapTypes returns the Go types of the keys and values of the map entry
+// type entry.
+func (b *builder) mapTypes(entry *generator.Descriptor) (keyType, valueType string) {
+    keyType, _ = b.gen.GoType(entry, entry.Field[0])
+    valueType, _ = b.gen.GoType(entry, entry.Field[1])
+    if !isMessage(entry.Field[1]) {
+        valueType = trimStar(valueType)
+    }
+    return trimStar(keyType), valueType
+}
+
+// isMessage reports whether the values of field are messages.
+func isMessage(field *pb.FieldDescriptorProto) bool {
+    t := field.GetType()
+    return t == pb.FieldDescriptorProto_TYPE_MESSAGE || t == pb.FieldDescriptorProto_TYPE_GROUP
+}
+
+// trimStar returns the Go type typ without its leading star, if any.
+func trimStar(typ string) string {
+    if typ != "" && typ[0] == '*' {
+        return typ[1:]
+    }
+    return typ
+}
@@ -0,0 +1,401 @@
+// Package can outputs the mapping of small messages to the frames of a CAN
+// bus.
+//
+// The CAN ID of a message is given by a custom integer message option named
+// can_id, and the layout of its fields in the 8 data bytes of a frame by
+// the custom integer field options can_byte, the offset of the field, and
+// can_size, its size in bytes, e.g.
+//
+//    extend google.protobuf.MessageOptions {
+//        uint32 can_id = 50400;
+//    }
+//    extend google.protobuf.FieldOptions {
+//        uint32 can_byte = 50401;
+//        uint32 can_size = 50402;
+//    }
+//    message EngineStatus {
+//        option (can_id) = 0x123;
+//        uint32 rpm = 1 [(can_byte) = 0, (can_size) = 2];
+//        sint32 temperature = 2 [(can_byte) = 2, (can_size) = 1];
+//        bool running = 3 [(can_byte) = 3];
+//    }
+//
+// For every message Foo with a CAN ID it generates the constant FooCANID.
+// If its fields have a layout, it generates PackFooCAN(m *Foo)
+// canbus.Frame, packing them in a frame, little-endian, and
+// UnpackFooCAN(f canbus.Frame) (*Foo, error), unpacking them, the fields
+// without a layout being left out. The fields laid out are the singular
+// bool, enum, integer and floating-point fields outside of oneofs, their
+// size defaulting to the one of their type: integers and enums can be
+// shortened, as their values are truncated, but bool, float and double
+// fields take 1, 4 and 8 bytes. The layouts which overlap or overflow the
+// frame fail the generation.
+//
+// Otherwise, the message being larger than a frame, it generates
+// SegmentFooCAN(m *Foo) ([]canbus.Frame, error), returning m serialized in
+// ISO-TP frames, and ReassembleFooCAN(r *canbus.Reassembler, f
+// canbus.Frame) (*Foo, error), returning the Foo reassembled from its
+// frames once its last frame is added to r.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package can
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// The names of the options giving the CAN ID of a message, and the offset
+// and size of a field in a frame.
+const (
+    idOptionName   = "can_id"
+    byteOptionName = "can_byte"
+    sizeOptionName = "can_size"
+)
+
+// maxID is the largest CAN ID, of the extended format.
+const maxID = 0x1fffffff
+
+const canbusPkgPath = "github.com/lleveque/protoc-gen-go/canbus"
+
+// importPaths are the packages the generated code may use.
+var importPaths = []string{"encoding/binary", "fmt", "math", canbusPkgPath}
+
+func init() {
+    generator.RegisterPlugin(new(can))
+}
+
+// can is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the CAN mapping of the messages having a CAN
+// ID.
+type can struct {
+    gen *generator.Generator
+
+    pkgNames map[string]string // names of the packages of importPaths
+    ids      map[uint64]string // messages of the package by CAN ID
+
+    used map[string]bool // packages of importPaths used by the file being generated
+}
+
+// layout is the place of a field in the data of a frame.
+type layout struct {
+    field  *pb.FieldDescriptorProto
+    offset int
+    size   int
+}
+
+// Name returns the name of this plugin, "can".
+func (c *can) Name() string {
+    return "can"
+}
+
+// Init initializes the plugin.
+func (c *can) Init(gen *generator.Generator) {
+    c.gen = gen
+    c.pkgNames = make(map[string]string)
+    for _, path := range importPaths {
+        c.pkgNames[path] = generator.RegisterUniquePackageName(path[strings.LastIndex(path, "/")+1:], nil)
+    }
+    c.ids = make(map[uint64]string)
+}
+
+// P forwards to c.gen.P.
+func (c *can) P(args ...interface{}) { c.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (c *can) pkg(importPath string) string {
+    c.used[importPath] = true
+    return c.pkgNames[importPath]
+}
+
+// Generate generates the CAN mapping of the messages in the given file.
+func (c *can) Generate(file *generator.FileDescriptor) {
+    c.used = make(map[string]bool)
+    if !descutil.IsGenerated(c.gen, file.GetName()) {
+        return
+    }
+    ext := descutil.Extension(c.gen, ".google.protobuf.MessageOptions", idOptionName)
+    if ext == nil {
+        return
+    }
+    for _, msg := range descutil.Messages(c.gen, file) {
+        values := descutil.OptionValues(c.gen, descutil.Options(msg.Options), ext)
+        if len(values) == 0 {
+            continue
+        }
+        name := messageName(msg)
+        id, err := strconv.ParseUint(values[0], 10, 32)
+        if err != nil || id > maxID {
+            c.gen.Fail(fmt.Sprintf("invalid %s option %s of %s: want an integer from 0 to %#x", idOptionName, values[0], name, maxID))
+        }
+        if other, ok := c.ids[id]; ok {
+            c.gen.Fail(fmt.Sprintf("invalid %s option %s of %s: %s has the same ID", idOptionName, values[0], name, other))
+        }
+        c.ids[id] = name
+        c.generateMessage(msg, id)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (c *can) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range c.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    c.P("import (")
+    for _, path := range paths {
+        c.P(c.pkgNames[path], " ", strconv.Quote(path))
+    }
+    c.P(")")
+    c.P()
+}
+
+// generateMessage generates the CAN ID constant of msg, and its packing in
+// a frame if its fields have a layout, its segmentation in ISO-TP frames
+// otherwise.
+func (c *can) generateMessage(msg *generator.Descriptor, id uint64) {
+    typeName := c.gen.TypeName(msg)
+    c.P("// ", typeName, "CANID is the CAN ID of the ", typeName, " frames.")
+    c.P("const ", typeName, "CANID = ", fmt.Sprintf("%#x", id))
+    c.P()
+    if layouts := c.layouts(msg); len(layouts) > 0 {
+        c.generatePack(msg, layouts)
+    } else {
+        c.generateSegment(msg)
+    }
+}
+
+// generatePack generates the PackFooCAN and UnpackFooCAN functions of msg,
+// whose fields are laid out as layouts.
+func (c *can) generatePack(msg *generator.Descriptor, layouts []layout) {
+    typeName := c.gen.TypeName(msg)
+    canbus, binary := c.pkg(canbusPkgPath), c.pkgNames["encoding/binary"]
+    length := 0
+    for _, l := range layouts {
+        if l.offset+l.size > length {
+            length = l.offset + l.size
+        }
+    }
+    c.P("// Pack", typeName, "CAN returns the CAN frame of m, holding the fields of m with a")
+    c.P("// layout, little-endian, and the integers truncated to their size.")
+    c.P("func Pack", typeName, "CAN(m *", typeName, ") ", canbus, ".Frame {")
+    c.P("f := ", canbus, ".Frame{ID: ", typeName, "CANID, Len: ", length, "}")
+    for _, l := range layouts {
+        v := "m.Get" + generator.CamelCase(l.field.GetName()) + "()"
+        switch l.field.GetType() {
+        case pb.FieldDescriptorProto_TYPE_BOOL:
+            c.P("if ", v, " {")
+            c.P("f.Data[", l.offset, "] = 1")
+            c.P("}")
+            continue
+        case pb.FieldDescriptorProto_TYPE_FLOAT, pb.FieldDescriptorProto_TYPE_DOUBLE:
+            v = fmt.Sprintf("%s.Float%dbits(%s)", c.pkg("math"), l.size*8, v)
+        default:
+            v = fmt.Sprintf("uint%d(%s)", l.size*8, v)
+        }
+        if l.size == 1 {
+            c.P("f.Data[", l.offset, "] = ", v)
+        } else {
+            c.pkg("encoding/binary")
+            c.P(binary, ".LittleEndian.PutUint", l.size*8, "(f.Data[", l.offset, ":], ", v, ")")
+        }
+    }
+    c.P("return f")
+    c.P("}")
+    c.P()
+    c.P("// Unpack", typeName, "CAN returns the ", typeName, " packed in the CAN frame f, whose")
+    c.P("// fields without a layout are unset. It fails if f is not a frame of ID")
+    c.P("// ", typeName, "CANID of at least ", length, " bytes.")
+    c.P("func Unpack", typeName, "CAN(f ", canbus, ".Frame) (*", typeName, ", error) {")
+    c.P("if f.ID != ", typeName, "CANID || f.Len < ", length, " {")
+    c.P("return nil, ", c.pkg("fmt"), `.Errorf("unpacking `, typeName, `: got a frame of ID %#x and %d bytes, want ID %#x and `, length, ` bytes", f.ID, f.Len, `, typeName, "CANID)")
+    c.P("}")
+    c.P("m := new(", typeName, ")")
+    for _, l := range layouts {
+        goType, _ := c.gen.GoType(msg, l.field)
+        v := "m." + generator.CamelCase(l.field.GetName())
+        raw := "f.Data[" + strconv.Itoa(l.offset) + "]"
+        if l.size > 1 {
+            c.pkg("encoding/binary")
+            raw = fmt.Sprintf("%s.LittleEndian.Uint%d(f.Data[%d:])", binary, l.size*8, l.offset)
+        }
+        var value string
+        switch typ := strings.TrimPrefix(goType, "*"); l.field.GetType() {
+        case pb.FieldDescriptorProto_TYPE_BOOL:
+            value = raw + " != 0"
+        case pb.FieldDescriptorProto_TYPE_FLOAT, pb.FieldDescriptorProto_TYPE_DOUBLE:
+            value = fmt.Sprintf("%s.Float%dfrombits(%s)", c.pkg("math"), l.size*8, raw)
+        default:
+            if isSigned(l.field) && l.size < defaultSize(l.field) {
+                // Sign-extend the truncated integers.
+                raw = fmt.Sprintf("int%d(%s)", l.size*8, raw)
+            }
+            value = typ + "(" + raw + ")"
+        }
+        if goType[0] == '*' {
+            // Optional fields of proto2 point to their value.
+            c.P("{")
+            c.P("v := ", value)
+            c.P(v, " = &v")
+            c.P("}")
+        } else {
+            c.P(v, " = ", value)
+        }
+    }
+    c.P("return m, nil")
+    c.P("}")
+    c.P()
+}
+
+// generateSegment generates the SegmentFooCAN and ReassembleFooCAN
+// functions of msg, carrying it serialized in ISO-TP frames.
+func (c *can) generateSegment(msg *generator.Descriptor) {
+    typeName := c.gen.TypeName(msg)
+    canbus, proto := c.pkg(canbusPkgPath), c.gen.Pkg["proto"]
+    c.P("// Segment", typeName, "CAN returns m serialized in the ISO-TP frames of ID")
+    c.P("// ", typeName, "CANID carrying it, which are sent as the flow control of the")
+    c.P("// receiver allows.")
+    c.P("func Segment", typeName, "CAN(m *", typeName, ") ([]", canbus, ".Frame, error) {")
+    c.P("b, err := ", proto, ".Marshal(m)")
+    c.P("if err != nil {")
+    c.P("return nil, err")
+    c.P("}")
+    c.P("return ", canbus, ".Segment(", typeName, "CANID, b)")
+    c.P("}")
+    c.P()
+    c.P("// Reassemble", typeName, "CAN adds the ISO-TP frame f to the ", typeName, " being")
+    c.P("// reassembled by r, and returns it once its last frame is added, nil")
+    c.P("// otherwise. The frames whose ID is not ", typeName, "CANID are ignored.")
+    c.P("func Reassemble", typeName, "CAN(r *", canbus, ".Reassembler, f ", canbus, ".Frame) (*", typeName, ", error) {")
+    c.P("if f.ID != ", typeName, "CANID {")
+    c.P("return nil, nil")
+    c.P("}")
+    c.P("b, err := r.Add(f)")
+    c.P("if b == nil || err != nil {")
+    c.P("return nil, err")
+    c.P("}")
+    c.P("m := new(", typeName, ")")
+    c.P("if err := ", proto, ".Unmarshal(b, m); err != nil {")
+    c.P("return nil, err")
+    c.P("}")
+    c.P("return m, nil")
+    c.P("}")
+    c.P()
+}
+
+// layouts returns the layouts of the fields of msg given by their options,
+// ordered by offset, failing if they do not fit in a frame, overlap or do
+// not apply to their field.
+func (c *can) layouts(msg *generator.Descriptor) []layout {
+    byteExt := descutil.Extension(c.gen, ".google.protobuf.FieldOptions", byteOptionName)
+    if byteExt == nil {
+        return nil
+    }
+    sizeExt := descutil.Extension(c.gen, ".google.protobuf.FieldOptions", sizeOptionName)
+    var layouts []layout
+    for _, field := range msg.Field {
+        opts := descutil.Options(field.Options)
+        values := descutil.OptionValues(c.gen, opts, byteExt)
+        if len(values) == 0 {
+            continue
+        }
+        name := messageName(msg) + "." + field.GetName()
+        offset, err := strconv.ParseUint(values[0], 10, 8)
+        if err != nil || offset > 7 {
+            c.gen.Fail(fmt.Sprintf("invalid %s option %s of %s: want an integer from 0 to 7", byteOptionName, values[0], name))
+        }
+        size := defaultSize(field)
+        if size == 0 || field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED || field.OneofIndex != nil {
+            c.gen.Fail(fmt.Sprintf("invalid %s option of %s: only the singular bool, enum, integer and floating-point fields outside of oneofs can be laid out", byteOptionName, name))
+        }
+        if sizeExt != nil {
+            if values := descutil.OptionValues(c.gen, opts, sizeExt); len(values) > 0 {
+                n, err := strconv.Atoi(values[0])
+                if err != nil || !validSize(field, n) {
+                    c.gen.Fail(fmt.Sprintf("invalid %s option %s of %s: want %s", sizeOptionName, values[0], name, sizes(field)))
+                }
+                size = n
+            }
+        }
+        if int(offset)+size > 8 {
+            c.gen.Fail(fmt.Sprintf("invalid layout of %s: %d bytes from byte %d overflow the 8 bytes of a frame", name, size, offset))
+        }
+        layouts = append(layouts, layout{field, int(offset), size})
+    }
+    sort.SliceStable(layouts, func(i, j int) bool { return layouts[i].offset < layouts[j].offset })
+    for i := 1; i < len(layouts); i++ {
+        if prev := layouts[i-1]; prev.offset+prev.size > layouts[i].offset {
+            c.gen.Fail(fmt.Sprintf("invalid layout of %s: %s and %s overlap", messageName(msg), prev.field.GetName(), layouts[i].field.GetName()))
+        }
+    }
+    return layouts
+}
+
+// defaultSize returns the size of the values of field in a frame, the one
+// of its type, or 0 if it cannot be laid out.
+func defaultSize(field *pb.FieldDescriptorProto) int {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        return 1
+    case pb.FieldDescriptorProto_TYPE_ENUM, pb.FieldDescriptorProto_TYPE_INT32, pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SFIXED32,
+        pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_FIXED32, pb.FieldDescriptorProto_TYPE_FLOAT:
+        return 4
+    case pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_SINT64, pb.FieldDescriptorProto_TYPE_SFIXED64,
+        pb.FieldDescriptorProto_TYPE_UINT64, pb.FieldDescriptorProto_TYPE_FIXED64, pb.FieldDescriptorProto_TYPE_DOUBLE:
+        return 8
+    }
+    return 0
+}
+
+// isSigned reports whether the values of field are signed integers.
+func isSigned(field *pb.FieldDescriptorProto) bool {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_ENUM, pb.FieldDescriptorProto_TYPE_INT32, pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SFIXED32,
+        pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_SINT64, pb.FieldDescriptorProto_TYPE_SFIXED64:
+        return true
+    }
+    return false
+}
+
+// validSize reports whether the values of field can take size bytes: only
+// the integers and enums can be shortened.
+func validSize(field *pb.FieldDescriptorProto, size int) bool {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL, pb.FieldDescriptorProto_TYPE_FLOAT, pb.FieldDescriptorProto_TYPE_DOUBLE:
+        return size == defaultSize(field)
+    }
+    return (size == 1 || size == 2 || size == 4 || size == 8) && size <= defaultSize(field)
+}
+
+// sizes describes the sizes the values of field can take.
+func sizes(field *pb.FieldDescriptorProto) string {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL, pb.FieldDescriptorProto_TYPE_FLOAT, pb.FieldDescriptorProto_TYPE_DOUBLE:
+        return strconv.Itoa(defaultSize(field))
+    }
+    if defaultSize(field) == 4 {
+        return "1, 2 or 4"
+    }
+    return "1, 2, 4 or 8"
+}
+
+// messageName returns the fully-qualified name of msg, for the errors.
+func messageName(msg *generator.Descriptor) string {
+    name := strings.Join(msg.TypeName(), ".")
+    if pkg := msg.File().GetPackage(); pkg != "" {
+        name = pkg + "." + name
+    }
+    return name
+}
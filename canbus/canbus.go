@@ -0,0 +1,142 @@
+// Package canbus maps messages to the frames of a CAN bus.
+//
+// It backs the CAN helpers generated by the can plugin: Frame is a classic
+// CAN frame, of up to 8 data bytes, and Segment and Reassembler carry the
+// messages longer than a frame, segmented as ISO-TP (ISO 15765-2) does with
+// normal addressing.
+package canbus
+
+import "errors"
+
+// MaxISOTPPayload is the size of the largest payload Segment can carry.
+const MaxISOTPPayload = 4095
+
+// The types of the ISO-TP frames, in the high nibble of their first byte.
+const (
+    singleFrame      = 0x0
+    firstFrame       = 0x1
+    consecutiveFrame = 0x2
+    flowControlFrame = 0x3
+)
+
+// ErrPayloadTooLarge is returned by Segment for payloads longer than
+// MaxISOTPPayload.
+var ErrPayloadTooLarge = errors.New("canbus: ISO-TP payload too large")
+
+// ErrBadFrame is returned for the frames which are no valid ISO-TP frames,
+// or do not follow the frames of the payload being reassembled.
+var ErrBadFrame = errors.New("canbus: bad ISO-TP frame")
+
+// Frame is a classic CAN frame. IDs beyond 0x7ff are sent in the extended
+// format.
+type Frame struct {
+    ID   uint32
+    Len  uint8 // number of data bytes, up to 8
+    Data [8]byte
+}
+
+// Segment returns the ISO-TP frames of ID id carrying payload: a single
+// frame for up to 7 bytes, empty payloads included, as the empty messages
+// serialize to no bytes, and otherwise a first frame followed by
+// consecutive frames. The sender must send the consecutive frames as
+// allowed by the flow control frame the receiver answers the first frame
+// with.
+func Segment(id uint32, payload []byte) ([]Frame, error) {
+    if len(payload) > MaxISOTPPayload {
+        return nil, ErrPayloadTooLarge
+    }
+    if len(payload) <= 7 {
+        f := Frame{ID: id, Len: uint8(1 + len(payload))}
+        f.Data[0] = singleFrame<<4 | byte(len(payload))
+        copy(f.Data[1:], payload)
+        return []Frame{f}, nil
+    }
+    frames := make([]Frame, 0, 1+len(payload)/7)
+    f := Frame{ID: id, Len: 8}
+    f.Data[0] = firstFrame<<4 | byte(len(payload)>>8)
+    f.Data[1] = byte(len(payload))
+    copy(f.Data[2:], payload)
+    frames = append(frames, f)
+    for i, seq := 6, byte(1); i < len(payload); i, seq = i+7, seq+1 {
+        f := Frame{ID: id}
+        f.Data[0] = consecutiveFrame<<4 | seq&0xf
+        f.Len = uint8(1 + copy(f.Data[1:], payload[i:]))
+        frames = append(frames, f)
+    }
+    return frames, nil
+}
+
+// FlowControl returns the flow control frame of ID id which the receiver of
+// a first frame answers it with, letting the sender send all the
+// consecutive frames without delay.
+func FlowControl(id uint32) Frame {
+    f := Frame{ID: id, Len: 3}
+    f.Data[0] = flowControlFrame << 4
+    return f
+}
+
+// Reassembler reassembles the ISO-TP payloads of a CAN ID from their
+// frames. Its zero value is ready to use.
+type Reassembler struct {
+    buf    []byte
+    total  int
+    seq    byte
+    active bool // a first frame was received, and not all its consecutive frames
+}
+
+// Add adds f to the payload being reassembled, and returns the payload once
+// its last frame is added, which is only valid until the next call. It
+// returns nil for the other frames, and the flow control frames, which it
+// ignores. After an error, the payload being reassembled is dropped.
+func (r *Reassembler) Add(f Frame) ([]byte, error) {
+    if f.Len == 0 || f.Len > 8 {
+        return r.fail()
+    }
+    data := f.Data[:f.Len]
+    switch data[0] >> 4 {
+    case singleFrame:
+        n := int(data[0] & 0xf)
+        if n > len(data)-1 {
+            return r.fail()
+        }
+        if r.buf == nil {
+            // The empty payloads are returned as non-nil.
+            r.buf = make([]byte, 0, 8)
+        }
+        r.active = false
+        r.buf = append(r.buf[:0], data[1:1+n]...)
+        return r.buf, nil
+    case firstFrame:
+        total := int(data[0]&0xf)<<8 | int(data[1])
+        if total <= 7 || len(data) < 8 {
+            return r.fail()
+        }
+        r.buf = append(r.buf[:0], data[2:]...)
+        r.total, r.seq, r.active = total, 1, true
+        return nil, nil
+    case consecutiveFrame:
+        if !r.active || data[0]&0xf != r.seq&0xf {
+            return r.fail()
+        }
+        r.seq++
+        rest := r.total - len(r.buf)
+        if rest > len(data)-1 {
+            rest = len(data) - 1
+        }
+        r.buf = append(r.buf, data[1:1+rest]...)
+        if len(r.buf) < r.total {
+            return nil, nil
+        }
+        r.active = false
+        return r.buf, nil
+    case flowControlFrame:
+        return nil, nil
+    }
+    return r.fail()
+}
+
+// fail drops the payload being reassembled and returns ErrBadFrame.
+func (r *Reassembler) fail() ([]byte, error) {
+    r.active = false
+    return nil, ErrBadFrame
+}
@@ -0,0 +1,235 @@
+// Package clone outputs deep copies of the messages.
+//
+// For every message Foo it generates a Clone() *Foo method returning a
+// deep copy of a Foo, sharing no memory with it: its message, repeated,
+// map and bytes fields are copied in turn, without the reflection of
+// proto.Clone. The messages of the files not being generated, and the
+// messages with extensions, are still copied by proto.Clone.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package clone
+
+import (
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+func init() {
+    generator.RegisterPlugin(new(clone))
+}
+
+// clone is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the Clone methods of the messages of
+// each file.
+type clone struct {
+    gen       *generator.Generator
+    runtimeV2 bool // runtime=v2: the message structs hold a protoimpl.MessageState, not to be copied
+}
+
+// Name returns the name of this plugin, "clone".
+func (c *clone) Name() string {
+    return "clone"
+}
+
+// Init initializes the plugin.
+func (c *clone) Init(gen *generator.Generator) {
+    c.gen = gen
+    c.runtimeV2 = descutil.RuntimeV2(gen)
+}
+
+// P forwards to c.gen.P.
+func (c *clone) P(args ...interface{}) { c.gen.P(args...) }
+
+// Generate generates the Clone methods of the messages in the given file.
+func (c *clone) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(c.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(c.gen, file) {
+        c.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+// The generated code only uses the proto package, always imported.
+func (c *clone) GenerateImports(file *generator.FileDescriptor) {}
+
+// generateMessage generates the Clone method of msg.
+func (c *clone) generateMessage(msg *generator.Descriptor) {
+    typeName := c.gen.TypeName(msg)
+    c.P("// Clone returns a deep copy of m, sharing no memory with it, or nil if m is nil.")
+    c.P("func (m *", typeName, ") Clone() *", typeName, " {")
+    c.P("if m == nil {")
+    c.P("return nil")
+    c.P("}")
+    if len(msg.ExtensionRange) > 0 {
+        // The extensions can only be copied by reflection.
+        c.P("return ", c.gen.Pkg["proto"], ".Clone(m).(*", typeName, ")")
+        c.P("}")
+        c.P()
+        return
+    }
+    c.generateShallowCopy(msg)
+    for _, field := range msg.Field {
+        if field.OneofIndex != nil {
+            continue
+        }
+        fieldName := generator.CamelCase(field.GetName())
+        c.generateField(msg, field, "c."+fieldName, "m."+fieldName)
+    }
+    for i, oneof := range msg.OneofDecl {
+        c.generateOneof(msg, int32(i), generator.CamelCase(oneof.GetName()))
+    }
+    if !descutil.IsProto3(msg) {
+        c.P("if m.XXX_unrecognized != nil {")
+        c.P("c.XXX_unrecognized = append([]byte{}, m.XXX_unrecognized...)")
+        c.P("}")
+    }
+    if c.runtimeV2 {
+        c.P("return c")
+    } else {
+        c.P("return &c")
+    }
+    c.P("}")
+    c.P()
+}
+
+// generateShallowCopy generates the shallow copy c of m. With runtime=v2,
+// the fields are copied one by one into a new message, rather than the
+// struct as a whole, which would copy its protoimpl.MessageState.
+func (c *clone) generateShallowCopy(msg *generator.Descriptor) {
+    if !c.runtimeV2 {
+        c.P("c := *m")
+        return
+    }
+    c.P("c := &", c.gen.TypeName(msg), "{")
+    for _, field := range msg.Field {
+        if field.OneofIndex == nil {
+            fieldName := generator.CamelCase(field.GetName())
+            c.P(fieldName, ": m.", fieldName, ",")
+        }
+    }
+    for _, oneof := range msg.OneofDecl {
+        oneofName := generator.CamelCase(oneof.GetName())
+        c.P(oneofName, ": m.", oneofName, ",")
+    }
+    c.P("}")
+}
+
+// generateField generates the copy of field from src to dst, which already
+// holds a shallow copy of it.
+func (c *clone) generateField(msg *generator.Descriptor, field *pb.FieldDescriptorProto, dst, src string) {
+    goType, _ := c.gen.GoType(msg, field)
+    switch {
+    case descutil.MapEntry(c.gen, field) != nil:
+        entry := descutil.MapEntry(c.gen, field)
+        keyType, _ := c.gen.GoType(entry, entry.Field[0])
+        valueType, _ := c.gen.GoType(entry, entry.Field[1])
+        if entry.Field[1].GetType() != pb.FieldDescriptorProto_TYPE_MESSAGE {
+            valueType = trimStar(valueType)
+        }
+        c.P("if ", src, " != nil {")
+        c.P(dst, " = make(map[", trimStar(keyType), "]", valueType, ", len(", src, "))")
+        c.P("for k, v := range ", src, " {")
+        c.generateCopy(entry.Field[1], "v")
+        c.P(dst, "[k] = v")
+        c.P("}")
+        c.P("}")
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        c.P("if ", src, " != nil {")
+        c.P(dst, " = make(", goType, ", len(", src, "))")
+        if isValue(field) {
+            c.P("copy(", dst, ", ", src, ")")
+        } else {
+            c.P("for i, v := range ", src, " {")
+            c.generateCopy(field, "v")
+            c.P(dst, "[i] = v")
+            c.P("}")
+        }
+        c.P("}")
+    case goType[0] == '*' && isValue(field):
+        // Optional fields of proto2 point to their value.
+        c.P("if ", src, " != nil {")
+        c.P("v := *", src)
+        c.P(dst, " = &v")
+        c.P("}")
+    default:
+        c.generateCopy(field, dst)
+    }
+}
+
+// generateOneof generates the copy of the oneof of the given index and
+// name: its wrapper is copied with its value.
+func (c *clone) generateOneof(msg *generator.Descriptor, index int32, name string) {
+    typeName := c.gen.TypeName(msg)
+    c.P("switch v := m.", name, ".(type) {")
+    for _, field := range msg.Field {
+        if field.OneofIndex == nil || field.GetOneofIndex() != index {
+            continue
+        }
+        fieldName := generator.CamelCase(field.GetName())
+        wrapper := typeName + "_" + fieldName
+        c.P("case *", wrapper, ":")
+        if isValue(field) {
+            c.P("c.", name, " = &", wrapper, "{v.", fieldName, "}")
+            continue
+        }
+        c.P("x := v.", fieldName)
+        c.generateCopy(field, "x")
+        c.P("c.", name, " = &", wrapper, "{x}")
+    }
+    c.P("}")
+}
+
+// generateCopy generates the replacement of the non-repeated value of field
+// held by the variable v with a copy of it. Values copied by assignment are
+// left as is, and nil values stay nil.
+func (c *clone) generateCopy(field *pb.FieldDescriptorProto, v string) {
+    switch {
+    case isValue(field):
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES:
+        c.P("if ", v, " != nil {")
+        c.P(v, " = append([]byte{}, ", v, "...)")
+        c.P("}")
+    case c.hasClone(field):
+        c.P(v, " = ", v, ".Clone()")
+    default:
+        goType, _ := c.gen.GoType(nil, field)
+        c.P("if ", v, " != nil {")
+        c.P(v, " = ", c.gen.Pkg["proto"], ".Clone(", v, ").(", trimSlice(goType), ")")
+        c.P("}")
+    }
+}
+
+// hasClone reports whether the message type of field has a Clone method,
+// being defined in the files generated.
+func (c *clone) hasClone(field *pb.FieldDescriptorProto) bool {
+    return descutil.IsGenerated(c.gen, c.gen.ObjectNamed(field.GetTypeName()).File().GetName())
+}
+
+// isValue reports whether the values of field are copied by assignment.
+func isValue(field *pb.FieldDescriptorProto) bool {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP, pb.FieldDescriptorProto_TYPE_BYTES:
+        return false
+    }
+    return true
+}
+
+// trimStar returns the Go type typ without its leading star, if any.
+func trimStar(typ string) string {
+    if typ != "" && typ[0] == '*' {
+        return typ[1:]
+    }
+    return typ
+}
+
+// trimSlice returns the Go type typ without its leading [], if any.
+func trimSlice(typ string) string {
+    if len(typ) > 2 && typ[:2] == "[]" {
+        return typ[2:]
+    }
+    return typ
+}
@@ -0,0 +1,252 @@
+// Package cloudevent carries messages in CloudEvents.
+//
+// It backs the CloudEvents bindings generated by the cloudevents plugin: the
+// Event of the CloudEvents 1.0 specification, carrying a serialized message
+// or its JSON mapping, and its HTTP protocol binding, in the binary content
+// mode, where the attributes of the event are headers and its data the
+// body, and in the structured content mode, where the whole event is a JSON
+// object.
+package cloudevent
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "mime"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/golang/protobuf/jsonpb"
+    "github.com/golang/protobuf/proto"
+)
+
+// SpecVersion is the version of the CloudEvents specification implemented.
+const SpecVersion = "1.0"
+
+// The content types of the events in the structured content mode, and of
+// the data of the events carrying serialized messages.
+const (
+    ContentTypeStructured = "application/cloudevents+json"
+    ContentTypeProtobuf   = "application/protobuf"
+)
+
+// Event is a CloudEvent. ID, Source and Type are required, the other
+// attributes optional.
+type Event struct {
+    ID              string
+    Source          string
+    Type            string
+    DataContentType string
+    DataSchema      string
+    Subject         string
+    Time            time.Time
+    Data            []byte
+}
+
+// New returns an event of the given ID, source and type carrying m
+// serialized.
+func New(id, source, eventType string, m proto.Message) (*Event, error) {
+    data, err := proto.Marshal(m)
+    if err != nil {
+        return nil, err
+    }
+    return &Event{ID: id, Source: source, Type: eventType, DataContentType: ContentTypeProtobuf, Data: data}, nil
+}
+
+// Decode decodes the data of e in m: its JSON mapping if its content type
+// is JSON, the serialized message otherwise.
+func Decode(e *Event, m proto.Message) error {
+    if isJSON(e.DataContentType) {
+        return jsonpb.Unmarshal(bytes.NewReader(e.Data), m)
+    }
+    return proto.Unmarshal(e.Data, m)
+}
+
+// isJSON reports whether contentType is a JSON media type, e.g.
+// application/json or application/cloudevents+json.
+func isJSON(contentType string) bool {
+    mediaType, _, _ := mime.ParseMediaType(contentType)
+    return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// structuredEvent is the JSON format of the events.
+type structuredEvent struct {
+    SpecVersion     string          `json:"specversion"`
+    ID              string          `json:"id"`
+    Source          string          `json:"source"`
+    Type            string          `json:"type"`
+    DataContentType string          `json:"datacontenttype,omitempty"`
+    DataSchema      string          `json:"dataschema,omitempty"`
+    Subject         string          `json:"subject,omitempty"`
+    Time            *time.Time      `json:"time,omitempty"`
+    Data            json.RawMessage `json:"data,omitempty"`
+    DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// MarshalJSON returns e in the JSON format, with its data as JSON if its
+// content type is JSON, base64-encoded otherwise.
+func (e *Event) MarshalJSON() ([]byte, error) {
+    s := structuredEvent{
+        SpecVersion:     SpecVersion,
+        ID:              e.ID,
+        Source:          e.Source,
+        Type:            e.Type,
+        DataContentType: e.DataContentType,
+        DataSchema:      e.DataSchema,
+        Subject:         e.Subject,
+    }
+    if !e.Time.IsZero() {
+        s.Time = &e.Time
+    }
+    if isJSON(e.DataContentType) {
+        s.Data = e.Data
+    } else {
+        s.DataBase64 = e.Data
+    }
+    return json.Marshal(s)
+}
+
+// UnmarshalJSON decodes an event in the JSON format. Its data, if not
+// base64-encoded, is kept as JSON.
+func (e *Event) UnmarshalJSON(b []byte) error {
+    var s structuredEvent
+    if err := json.Unmarshal(b, &s); err != nil {
+        return err
+    }
+    *e = Event{
+        ID:              s.ID,
+        Source:          s.Source,
+        Type:            s.Type,
+        DataContentType: s.DataContentType,
+        DataSchema:      s.DataSchema,
+        Subject:         s.Subject,
+        Data:            s.DataBase64,
+    }
+    if s.Time != nil {
+        e.Time = *s.Time
+    }
+    if s.Data != nil {
+        e.Data = s.Data
+        if e.DataContentType == "" {
+            e.DataContentType = "application/json"
+        }
+    }
+    return check(s.SpecVersion, e)
+}
+
+// check returns an error if the event e, of the given spec version, lacks a
+// required attribute.
+func check(specVersion string, e *Event) error {
+    switch {
+    case specVersion != SpecVersion:
+        return fmt.Errorf("cloudevent: unsupported spec version %q: want %q", specVersion, SpecVersion)
+    case e.ID == "":
+        return fmt.Errorf("cloudevent: missing id attribute")
+    case e.Source == "":
+        return fmt.Errorf("cloudevent: missing source attribute")
+    case e.Type == "":
+        return fmt.Errorf("cloudevent: missing type attribute")
+    }
+    return nil
+}
+
+// NewRequest returns a POST request to url sending e, in the structured
+// content mode if structured, in the binary content mode otherwise.
+func NewRequest(ctx context.Context, url string, e *Event, structured bool) (*http.Request, error) {
+    body, contentType := e.Data, e.DataContentType
+    if structured {
+        var err error
+        if body, err = json.Marshal(e); err != nil {
+            return nil, err
+        }
+        contentType = ContentTypeStructured
+    }
+    r, err := http.NewRequest("POST", url, bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    r = r.WithContext(ctx)
+    if contentType != "" {
+        r.Header.Set("Content-Type", contentType)
+    }
+    if !structured {
+        setBinaryHeaders(r.Header, e)
+    }
+    return r, nil
+}
+
+// setBinaryHeaders sets the headers of the attributes of e, in the binary
+// content mode, other than its content type.
+func setBinaryHeaders(h http.Header, e *Event) {
+    h.Set("ce-specversion", SpecVersion)
+    h.Set("ce-id", e.ID)
+    h.Set("ce-source", e.Source)
+    h.Set("ce-type", e.Type)
+    if e.DataSchema != "" {
+        h.Set("ce-dataschema", e.DataSchema)
+    }
+    if e.Subject != "" {
+        h.Set("ce-subject", e.Subject)
+    }
+    if !e.Time.IsZero() {
+        h.Set("ce-time", e.Time.Format(time.RFC3339Nano))
+    }
+}
+
+// ReadRequest reads the event sent by r, in either content mode.
+func ReadRequest(r *http.Request) (*Event, error) {
+    body, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+        return nil, err
+    }
+    contentType := r.Header.Get("Content-Type")
+    if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == ContentTypeStructured {
+        e := new(Event)
+        if err := json.Unmarshal(body, e); err != nil {
+            return nil, err
+        }
+        return e, nil
+    }
+    e := &Event{
+        ID:              r.Header.Get("ce-id"),
+        Source:          r.Header.Get("ce-source"),
+        Type:            r.Header.Get("ce-type"),
+        DataContentType: contentType,
+        DataSchema:      r.Header.Get("ce-dataschema"),
+        Subject:         r.Header.Get("ce-subject"),
+        Data:            body,
+    }
+    if t := r.Header.Get("ce-time"); t != "" {
+        if e.Time, err = time.Parse(time.RFC3339Nano, t); err != nil {
+            return nil, fmt.Errorf("cloudevent: invalid time attribute: %v", err)
+        }
+    }
+    return e, check(r.Header.Get("ce-specversion"), e)
+}
+
+// Handler returns an http.Handler receiving the events POSTed in either
+// content mode and calling dispatch with them. It responds 400 Bad Request
+// to the invalid events, 500 Internal Server Error to the ones dispatch
+// fails to handle, and 204 No Content to the others.
+func Handler(dispatch func(ctx context.Context, e *Event) error) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != "POST" {
+            w.Header().Set("Allow", "POST")
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        e, err := ReadRequest(r)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if err := dispatch(r.Context(), e); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    })
+}
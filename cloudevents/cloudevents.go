@@ -0,0 +1,209 @@
+// Package cloudevents outputs the CloudEvents bindings of the messages, and
+// dispatchers routing the events to the methods of the services.
+//
+// For every message Foo it generates FooCloudEventType, the CloudEvents
+// type of the events carrying a Foo, its full proto name, e.g.
+// "greeting.Foo", NewFooCloudEvent(id, source string, m *Foo)
+// (*cloudevent.Event, error), returning an event of that type carrying m
+// serialized, and FooFromCloudEvent(e *cloudevent.Event) (*Foo, error),
+// decoding the Foo carried by an event of that type, serialized or as its
+// JSON mapping. The cloudevent package sends and receives the events over
+// HTTP, in the structured and binary content modes.
+//
+// For every service Foo it generates a FooCloudEventHandler interface, with
+// a Bar(ctx context.Context, in *BarRequest) error method per unary method
+// Bar, and DispatchFooCloudEvent(ctx context.Context, e *cloudevent.Event,
+// h FooCloudEventHandler) error, decoding the data of e as the input of the
+// method of its type in FooCloudEventTypes, by default the method of the
+// type of its input, and calling h with it.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package cloudevents
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const cloudeventPkgPath = "github.com/lleveque/protoc-gen-go/cloudevent"
+
+// importPaths are the packages the generated code may use.
+var importPaths = []string{"context", "fmt", cloudeventPkgPath}
+
+func init() {
+    generator.RegisterPlugin(new(cloudevents))
+}
+
+// cloudevents is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the CloudEvents bindings of the
+// messages and the dispatchers of the services.
+type cloudevents struct {
+    gen *generator.Generator
+
+    pkgNames map[string]string // names of the packages of importPaths
+    used     map[string]bool   // packages of importPaths used by the file being generated
+}
+
+// Name returns the name of this plugin, "cloudevents".
+func (c *cloudevents) Name() string {
+    return "cloudevents"
+}
+
+// Init initializes the plugin.
+func (c *cloudevents) Init(gen *generator.Generator) {
+    c.gen = gen
+    c.pkgNames = make(map[string]string)
+    for _, path := range importPaths {
+        c.pkgNames[path] = generator.RegisterUniquePackageName(path[strings.LastIndex(path, "/")+1:], nil)
+    }
+}
+
+// P forwards to c.gen.P.
+func (c *cloudevents) P(args ...interface{}) { c.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (c *cloudevents) pkg(importPath string) string {
+    c.used[importPath] = true
+    return c.pkgNames[importPath]
+}
+
+// typeName returns the Go name of the type of fully-qualified name str.
+func (c *cloudevents) typeName(str string) string {
+    c.gen.RecordTypeUse(str)
+    return c.gen.TypeName(c.gen.ObjectNamed(str))
+}
+
+// Generate generates the CloudEvents bindings of the messages, and the
+// dispatchers of the services, in the given file.
+func (c *cloudevents) Generate(file *generator.FileDescriptor) {
+    c.used = make(map[string]bool)
+    if !descutil.IsGenerated(c.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(c.gen, file) {
+        c.generateMessage(msg)
+    }
+    for _, service := range file.FileDescriptorProto.Service {
+        c.generateService(service)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (c *cloudevents) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range c.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    c.P("import (")
+    for _, path := range paths {
+        c.P(c.pkgNames[path], " ", strconv.Quote(path))
+    }
+    c.P(")")
+    c.P()
+}
+
+// generateMessage generates the CloudEvents binding of msg.
+func (c *cloudevents) generateMessage(msg *generator.Descriptor) {
+    typeName := c.gen.TypeName(msg)
+    fullName := strings.Join(msg.TypeName(), ".")
+    if pkg := msg.File().GetPackage(); pkg != "" {
+        fullName = pkg + "." + fullName
+    }
+    cloudevent, fmtPkg := c.pkg(cloudeventPkgPath), c.pkg("fmt")
+    c.P("// ", typeName, "CloudEventType is the CloudEvents type of the events carrying a")
+    c.P("// ", typeName, ", its full proto name.")
+    c.P("const ", typeName, "CloudEventType = ", strconv.Quote(fullName))
+    c.P()
+    c.P("// New", typeName, "CloudEvent returns a CloudEvent of type ", typeName, "CloudEventType,")
+    c.P("// of the given ID and source, carrying m serialized.")
+    c.P("func New", typeName, "CloudEvent(id, source string, m *", typeName, ") (*", cloudevent, ".Event, error) {")
+    c.P("return ", cloudevent, ".New(id, source, ", typeName, "CloudEventType, m)")
+    c.P("}")
+    c.P()
+    c.P("// ", typeName, "FromCloudEvent decodes the ", typeName, " carried by e, of type")
+    c.P("// ", typeName, "CloudEventType, serialized or as its JSON mapping.")
+    c.P("func ", typeName, "FromCloudEvent(e *", cloudevent, ".Event) (*", typeName, ", error) {")
+    c.P("if e.Type != ", typeName, "CloudEventType {")
+    c.P("return nil, ", fmtPkg, `.Errorf("got a CloudEvent of type %q, want %q", e.Type, `, typeName, "CloudEventType)")
+    c.P("}")
+    c.P("m := new(", typeName, ")")
+    c.P("if err := ", cloudevent, ".Decode(e, m); err != nil {")
+    c.P("return nil, err")
+    c.P("}")
+    c.P("return m, nil")
+    c.P("}")
+    c.P()
+}
+
+// generateService generates the handler interface and the dispatcher of
+// service.
+func (c *cloudevents) generateService(service *pb.ServiceDescriptorProto) {
+    servName := generator.CamelCase(service.GetName())
+    handlerName := servName + "CloudEventHandler"
+    var methods []*pb.MethodDescriptorProto
+    for _, method := range service.Method {
+        if !method.GetClientStreaming() && !method.GetServerStreaming() {
+            methods = append(methods, method)
+        }
+    }
+    if len(methods) == 0 {
+        return
+    }
+    context, cloudevent, fmtPkg := c.pkg("context"), c.pkg(cloudeventPkgPath), c.pkg("fmt")
+
+    c.P("// ", servName, "CloudEventTypes maps the CloudEvents types dispatched by")
+    c.P("// Dispatch", servName, "CloudEvent to the names of the ", servName, " methods handling")
+    c.P("// them, by default the input type of every method, mapped to the first")
+    c.P("// method taking it.")
+    c.P("var ", servName, "CloudEventTypes = map[string]string{")
+    seen := make(map[string]bool)
+    for _, method := range methods {
+        inputType := strings.TrimPrefix(method.GetInputType(), ".")
+        if seen[inputType] {
+            continue
+        }
+        seen[inputType] = true
+        c.P(strconv.Quote(inputType), ": ", strconv.Quote(method.GetName()), ",")
+    }
+    c.P("}")
+    c.P()
+    c.P("// ", handlerName, " handles the CloudEvents of the unary ", servName)
+    c.P("// methods, decoded as their input. Their output, if any, is left to the")
+    c.P("// handlers to produce.")
+    c.P("type ", handlerName, " interface {")
+    for _, method := range methods {
+        c.P(generator.CamelCase(method.GetName()), "(ctx ", context, ".Context, in *", c.typeName(method.GetInputType()), ") error")
+    }
+    c.P("}")
+    c.P()
+    c.P("// Dispatch", servName, "CloudEvent decodes the data of e as the input of the method of")
+    c.P("// its type in ", servName, "CloudEventTypes and calls h with it, returning the error")
+    c.P("// of h, or of the decoding. With ", cloudevent, ".Handler, it receives the events")
+    c.P("// over HTTP.")
+    c.P("func Dispatch", servName, "CloudEvent(ctx ", context, ".Context, e *", cloudevent, ".Event, h ", handlerName, ") error {")
+    c.P("switch method := ", servName, "CloudEventTypes[e.Type]; method {")
+    for _, method := range methods {
+        c.P("case ", strconv.Quote(method.GetName()), ":")
+        c.P("in := new(", c.typeName(method.GetInputType()), ")")
+        c.P("if err := ", cloudevent, ".Decode(e, in); err != nil {")
+        c.P("return ", fmtPkg, `.Errorf("CloudEvent %s of type %s: %v", e.ID, e.Type, err)`)
+        c.P("}")
+        c.P("return h.", generator.CamelCase(method.GetName()), "(ctx, in)")
+    }
+    c.P("default:")
+    c.P("return ", fmtPkg, `.Errorf("no `, servName, ` method handles the CloudEvents of type %s", e.Type)`)
+    c.P("}")
+    c.P("}")
+    c.P()
+}
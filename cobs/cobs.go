@@ -0,0 +1,116 @@
+// Package cobs outputs helpers framing the messages with Consistent
+// Overhead Byte Stuffing, for serial links.
+//
+// For every message Foo it generates EncodeFooFrame(m *Foo) ([]byte, error),
+// returning m serialized as a zero-delimited COBS frame to write to the
+// link, DecodeFooFrame(frame []byte) (*Foo, error), decoding a frame
+// without its delimiter, and ReadFooFrame(r *seriallink.FrameReader) (*Foo,
+// error), reading the next frame of a stream, which resynchronizes on the
+// next delimiter after a corrupt frame, so that messages can be shipped
+// over UART or RS-232 links.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package cobs
+
+import (
+    "strconv"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const seriallinkPkgPath = "github.com/lleveque/protoc-gen-go/seriallink"
+
+// seriallinkPkg is the name of the seriallink package in the generated
+// code, which may vary from "seriallink" if the name is used by other
+// packages.
+var seriallinkPkg string
+
+func init() {
+    generator.RegisterPlugin(new(cobs))
+}
+
+// cobs is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the COBS frame helpers of the messages.
+type cobs struct {
+    gen *generator.Generator
+
+    used bool // the file being generated uses the seriallink package
+}
+
+// Name returns the name of this plugin, "cobs".
+func (c *cobs) Name() string {
+    return "cobs"
+}
+
+// Init initializes the plugin.
+func (c *cobs) Init(gen *generator.Generator) {
+    c.gen = gen
+    seriallinkPkg = generator.RegisterUniquePackageName("seriallink", nil)
+}
+
+// P forwards to c.gen.P.
+func (c *cobs) P(args ...interface{}) { c.gen.P(args...) }
+
+// Generate generates the COBS frame helpers of the messages in the given
+// file.
+func (c *cobs) Generate(file *generator.FileDescriptor) {
+    c.used = false
+    if !descutil.IsGenerated(c.gen, file.GetName()) {
+        return
+    }
+    proto := c.gen.Pkg["proto"]
+    for _, msg := range descutil.Messages(c.gen, file) {
+        c.used = true
+        typeName := c.gen.TypeName(msg)
+        c.P("// Encode", typeName, "Frame returns m serialized and encoded as a COBS frame,")
+        c.P("// terminated by its zero delimiter, to write to a serial link.")
+        c.P("func Encode", typeName, "Frame(m *", typeName, ") ([]byte, error) {")
+        c.P("b, err := ", proto, ".Marshal(m)")
+        c.P("if err != nil {")
+        c.P("return nil, err")
+        c.P("}")
+        c.P("return ", seriallinkPkg, ".AppendCOBS(nil, b), nil")
+        c.P("}")
+        c.P()
+        c.P("// Decode", typeName, "Frame decodes the COBS frame, given without its delimiter, as")
+        c.P("// a ", typeName, ".")
+        c.P("func Decode", typeName, "Frame(frame []byte) (*", typeName, ", error) {")
+        c.P("b, err := ", seriallinkPkg, ".DecodeCOBS(frame)")
+        c.P("if err != nil {")
+        c.P("return nil, err")
+        c.P("}")
+        c.P("m := new(", typeName, ")")
+        c.P("if err := ", proto, ".Unmarshal(b, m); err != nil {")
+        c.P("return nil, err")
+        c.P("}")
+        c.P("return m, nil")
+        c.P("}")
+        c.P()
+        c.P("// Read", typeName, "Frame reads the next COBS frame of r and decodes it as a ", typeName, ".")
+        c.P("// After an error decoding a frame, it can be called again to read the next")
+        c.P("// one.")
+        c.P("func Read", typeName, "Frame(r *", seriallinkPkg, ".FrameReader) (*", typeName, ", error) {")
+        c.P("b, err := r.ReadFrame()")
+        c.P("if err != nil {")
+        c.P("return nil, err")
+        c.P("}")
+        c.P("m := new(", typeName, ")")
+        c.P("if err := ", proto, ".Unmarshal(b, m); err != nil {")
+        c.P("return nil, err")
+        c.P("}")
+        c.P("return m, nil")
+        c.P("}")
+        c.P()
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (c *cobs) GenerateImports(file *generator.FileDescriptor) {
+    if !c.used {
+        return
+    }
+    c.P("import ", seriallinkPkg, " ", strconv.Quote(seriallinkPkgPath))
+    c.P()
+}
@@ -0,0 +1,1123 @@
+// Package connect outputs Connect handlers and clients of the services.
+//
+// For every service Foo it generates a FooConnect interface,
+// NewFooConnectHandler serving an implementation of it to Connect, gRPC and
+// gRPC-Web clients, and the NewFooConnectClient and NewFooConnectJSONClient
+// clients speaking the Connect protocol. Streaming methods take functions
+// sending and receiving the messages of their streams. For tests,
+// StartTestFooServer serves an implementation to a client in memory.
+// NewFooCanaryClient splits the calls between a stable and a canary
+// backend, by percentage, or by the hash of the request field with the
+// custom bool canary_key option set. The clients propagate the latency
+// budget of the calls, set by httprpc.WithBudget, to the servers, and
+// refuse the calls of the methods with a custom integer budget_ms option
+// when the budget left, the time elapsed deducted, is below it. The unary
+// methods with retry options, e.g. (retry.max_attempts) = 3, are retried
+// by the clients as given by httprpc.RetryPolicy. The handlers of the
+// methods with a (ratelimit.rate) option limit their calls with
+// httprpc.CheckRateLimit, failing them with ResourceExhausted, and the
+// handlers of the methods with an (auth.scopes) option refuse the calls
+// whose context, as set by httprpc.WithScopes, lacks the scopes.
+// The first file of the package with services also gets
+// NewServerFromOptions, returning a server of all of them wired with the
+// interceptors of the package, an *http.Server of the Connect handlers
+// rather than a *grpc.Server, serving gRPC clients over HTTP/2 without
+// depending on grpc-go, and optionally with the gRPC server
+// reflection service, which RegisterFooReflection registers Foo with, and
+// the gRPC health checking service, which RegisterFooHealth registers Foo
+// with, and with the debug parameter NewDebugHandler, serving the
+// introspection of the server for operations. With the tracing parameter,
+// the calls of the server run in OpenTelemetry spans, with the logging
+// parameter, they are logged, and with the prometheus parameter, they are
+// recorded as Prometheus metrics. The handlers of the methods with a custom
+// string (grpcserial.timeout) option, e.g. "2s", bound their calls by it,
+// failing them with DeadlineExceeded once it expires.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package connect
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/httprpc"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// Paths for packages used by code generated in this file.
+const (
+    contextPkgPath = "context"
+    httpPkgPath    = "net/http"
+    httprpcPkgPath = "github.com/lleveque/protoc-gen-go/httprpc"
+    timePkgPath    = "time"
+
+    otelPkgPath        = "go.opentelemetry.io/otel"
+    attributePkgPath   = "go.opentelemetry.io/otel/attribute"
+    codesPkgPath       = "go.opentelemetry.io/otel/codes"
+    propagationPkgPath = "go.opentelemetry.io/otel/propagation"
+    tracePkgPath       = "go.opentelemetry.io/otel/trace"
+
+    promrpcPkgPath = "github.com/lleveque/protoc-gen-go/promrpc"
+    logrpcPkgPath  = "github.com/lleveque/protoc-gen-go/logrpc"
+)
+
+// canaryKeyOption is the name of the custom bool field option marking the
+// field of the requests whose hash routes the calls of the canary clients.
+const canaryKeyOption = "canary_key"
+
+// budgetOption is the name of the custom integer method option giving the
+// latency budget, in milliseconds, below which the clients refuse to call
+// the method.
+const budgetOption = "budget_ms"
+
+func init() {
+    generator.RegisterPlugin(new(connect))
+}
+
+// connect is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates Connect handlers and clients.
+type connect struct {
+    gen       *generator.Generator
+    telemetry bool // the telemetry parameter is enabled
+    debug     bool // the debug parameter is enabled
+    tracing   bool // the tracing parameter is enabled
+
+    prometheus          bool   // the prometheus parameter is enabled
+    prometheusNamespace string // the namespace of the Prometheus metrics
+    logging             bool   // the logging parameter is enabled
+}
+
+// The names for packages imported in the generated code.
+// They may vary from the final path component of the import path
+// if the name is used by other packages.
+var (
+    contextPkg string
+    httpPkg    string
+    httprpcPkg string
+    timePkg    string
+
+    // The packages used by the tracing interceptor, with the tracing
+    // parameter.
+    otelPkg        string
+    attributePkg   string
+    codesPkg       string
+    propagationPkg string
+    tracePkg       string
+
+    // The names of the promrpc and logrpc packages, with the prometheus and
+    // logging parameters.
+    promrpcPkg string
+    logrpcPkg  string
+)
+
+// Name returns the name of this plugin, "connect".
+func (c *connect) Name() string {
+    return "connect"
+}
+
+// Init initializes the plugin.
+func (c *connect) Init(gen *generator.Generator) {
+    c.gen = gen
+    c.telemetry = descutil.BoolParam(c.gen, "telemetry")
+    c.debug = descutil.BoolParam(c.gen, "debug")
+    contextPkg = generator.RegisterUniquePackageName("context", nil)
+    httpPkg = generator.RegisterUniquePackageName("http", nil)
+    httprpcPkg = generator.RegisterUniquePackageName("httprpc", nil)
+    timePkg = generator.RegisterUniquePackageName("time", nil)
+    c.tracing = descutil.BoolParam(c.gen, "tracing")
+    if c.tracing {
+        otelPkg = generator.RegisterUniquePackageName("otel", nil)
+        attributePkg = generator.RegisterUniquePackageName("attribute", nil)
+        codesPkg = generator.RegisterUniquePackageName("codes", nil)
+        propagationPkg = generator.RegisterUniquePackageName("propagation", nil)
+        tracePkg = generator.RegisterUniquePackageName("trace", nil)
+    }
+    c.prometheus = descutil.BoolParam(c.gen, "prometheus")
+    c.prometheusNamespace = descutil.PrometheusNamespace(gen)
+    if c.prometheus {
+        promrpcPkg = generator.RegisterUniquePackageName("promrpc", nil)
+    }
+    c.logging = descutil.BoolParam(c.gen, "logging")
+    if c.logging {
+        logrpcPkg = generator.RegisterUniquePackageName("logrpc", nil)
+    }
+}
+
+// typeName returns the name of the type named str in the .proto, as we
+// will print it, and records that we use it.
+func (c *connect) typeName(str string) string {
+    c.gen.RecordTypeUse(str)
+    return c.gen.TypeName(c.gen.ObjectNamed(str))
+}
+
+// P forwards to c.gen.P.
+func (c *connect) P(args ...interface{}) { c.gen.P(args...) }
+
+// Generate generates the Connect handlers and clients of the services in
+// the given file.
+func (c *connect) Generate(file *generator.FileDescriptor) {
+    if len(file.FileDescriptorProto.Service) == 0 {
+        return
+    }
+
+    c.P("// Reference imports to suppress errors if they are not otherwise used.")
+    c.P("var _ ", contextPkg, ".Context")
+    c.P("var _ ", httpPkg, ".Handler")
+    c.P("var _ ", httprpcPkg, ".ConnectHandler")
+    c.P()
+
+    for i, service := range file.FileDescriptorProto.Service {
+        c.generateService(file, service, i)
+    }
+    if services := c.packageServices(); services[0].file == file.FileDescriptorProto {
+        c.generateServer(services)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (c *connect) GenerateImports(file *generator.FileDescriptor) {
+    if len(file.FileDescriptorProto.Service) == 0 {
+        return
+    }
+    c.P("import (")
+    c.P(contextPkg, " ", strconv.Quote(contextPkgPath))
+    c.P(httpPkg, " ", strconv.Quote(httpPkgPath))
+    c.P(httprpcPkg, " ", strconv.Quote(httprpcPkgPath))
+    if c.importsTime(file) {
+        c.P(timePkg, " ", strconv.Quote(timePkgPath))
+    }
+    server := c.packageServices()[0].file == file.FileDescriptorProto
+    if c.tracing && server {
+        c.P(otelPkg, " ", strconv.Quote(otelPkgPath))
+        c.P(attributePkg, " ", strconv.Quote(attributePkgPath))
+        c.P(codesPkg, " ", strconv.Quote(codesPkgPath))
+        c.P(propagationPkg, " ", strconv.Quote(propagationPkgPath))
+        c.P(tracePkg, " ", strconv.Quote(tracePkgPath))
+    }
+    if c.prometheus && server {
+        c.P(promrpcPkg, " ", strconv.Quote(promrpcPkgPath))
+    }
+    if c.logging && server {
+        c.P(logrpcPkg, " ", strconv.Quote(logrpcPkgPath))
+    }
+    c.P(")")
+    c.P()
+}
+
+// importsTime reports whether the code generated for file uses the time
+// package: whether a method of its services has a (grpcserial.timeout) or a
+// retry policy.
+func (c *connect) importsTime(file *generator.FileDescriptor) bool {
+    for _, service := range file.FileDescriptorProto.Service {
+        for _, method := range service.Method {
+            if _, ok := descutil.MethodTimeout(c.gen, method); ok {
+                return true
+            }
+            if _, ok := c.retryPolicy(method); ok {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// streamType returns the name of the httprpc stream type of method.
+func streamType(method *pb.MethodDescriptorProto) string {
+    switch {
+    case method.GetClientStreaming() && method.GetServerStreaming():
+        return "BidiStream"
+    case method.GetClientStreaming():
+        return "ClientStream"
+    case method.GetServerStreaming():
+        return "ServerStream"
+    }
+    return "Unary"
+}
+
+// generateService generates the interface, handler and clients of service.
+func (c *connect) generateService(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto, index int) {
+    path := fmt.Sprintf("6,%d", index) // 6 means service.
+
+    fullServName := service.GetName()
+    if pkg := file.GetPackage(); pkg != "" {
+        fullServName = pkg + "." + fullServName
+    }
+    servName := generator.CamelCase(service.GetName())
+    ifaceName := servName + "Connect"
+    prefixName := servName + "ConnectPathPrefix"
+
+    c.P("// ", prefixName, " is the prefix of the paths of the ", servName, " methods,")
+    c.P("// under which the handler returned by New", servName, "ConnectHandler must be mounted.")
+    c.P("const ", prefixName, " = ", strconv.Quote("/"+fullServName+"/"))
+    c.P()
+
+    c.P("// ", ifaceName, " is the ", servName, " service, implemented by its Connect handlers")
+    c.P("// and clients.")
+    c.gen.PrintComments(path)
+    c.P("type ", ifaceName, " interface {")
+    for i, method := range service.Method {
+        c.gen.PrintComments(fmt.Sprintf("%s,2,%d", path, i)) // 2 means method in a service.
+        c.P(c.methodSignature(method))
+    }
+    c.P("}")
+    c.P()
+
+    c.generateHandler(service, servName, ifaceName, prefixName)
+    c.generateReflection(file, fullServName, servName)
+    c.generateHealth(fullServName, servName)
+    if c.debug {
+        c.generateDescribeService(service, fullServName, unexport(servName)+"ConnectHandler", prefixName)
+    }
+    c.generateClient(service, servName, ifaceName, prefixName)
+    c.generateTestServer(servName, ifaceName)
+    c.generateVCRClient(service, servName, ifaceName, prefixName)
+    c.generateCanaryClient(service, servName, ifaceName, prefixName)
+}
+
+// methodSignature returns the signature of method in the service interface.
+// Streamed requests are received from a recv function returning io.EOF at
+// the end of the stream, and streamed responses sent to a send function.
+func (c *connect) methodSignature(method *pb.MethodDescriptorProto) string {
+    methName := generator.CamelCase(method.GetName())
+    inType := c.typeName(method.GetInputType())
+    outType := c.typeName(method.GetOutputType())
+    ctx := "ctx " + contextPkg + ".Context"
+    recv := "recv func() (*" + inType + ", error)"
+    send := "send func(*" + outType + ") error"
+    switch streamType(method) {
+    case "BidiStream":
+        return fmt.Sprintf("%s(%s, %s, %s) error", methName, ctx, recv, send)
+    case "ClientStream":
+        return fmt.Sprintf("%s(%s, %s) (*%s, error)", methName, ctx, recv, outType)
+    case "ServerStream":
+        return fmt.Sprintf("%s(%s, in *%s, %s) error", methName, ctx, inType, send)
+    }
+    return fmt.Sprintf("%s(%s, in *%s) (*%s, error)", methName, ctx, inType, outType)
+}
+
+// generateHandler generates the Connect handler of service.
+func (c *connect) generateHandler(service *pb.ServiceDescriptorProto, servName, ifaceName, prefixName string) {
+    handlerType := unexport(servName) + "ConnectHandler"
+
+    c.P("type ", handlerType, " struct {")
+    c.P("impl ", ifaceName)
+    c.P("}")
+    c.P()
+    c.P("// New", servName, "ConnectHandler returns a handler of impl serving the Connect,")
+    c.P("// gRPC and gRPC-Web protocols, with protobuf or JSON messages.")
+    c.P("func New", servName, "ConnectHandler(impl ", ifaceName, ") ", httprpcPkg, ".ConnectHandler {")
+    c.P("return &", handlerType, "{impl}")
+    c.P("}")
+    c.P()
+    c.P("// PathPrefix returns ", prefixName, ".")
+    c.P("func (h *", handlerType, ") PathPrefix() string { return ", prefixName, " }")
+    c.P()
+    c.P("func (h *", handlerType, ") ServeHTTP(w ", httpPkg, ".ResponseWriter, r *", httpPkg, ".Request) {")
+    c.P("switch r.URL.Path {")
+    for _, method := range service.Method {
+        c.P("case ", prefixName, " + ", strconv.Quote(method.GetName()), ":")
+        c.P("h.serve", generator.CamelCase(method.GetName()), "(w, r)")
+    }
+    c.P("default:")
+    c.P(httpPkg, ".NotFound(w, r)")
+    c.P("}")
+    c.P("}")
+    c.P()
+    for _, method := range service.Method {
+        methName := generator.CamelCase(method.GetName())
+        inType := c.typeName(method.GetInputType())
+        outType := c.typeName(method.GetOutputType())
+        typ := streamType(method)
+
+        c.P("func (h *", handlerType, ") serve", methName, "(w ", httpPkg, ".ResponseWriter, r *", httpPkg, ".Request) {")
+        c.P(httprpcPkg, ".ServeConnect(w, r, ", httprpcPkg, ".", typ, ", func(ctx ", contextPkg, ".Context, c *", httprpcPkg, ".ServerCall) error {")
+        if limit, ok := descutil.RateLimit(c.gen, method); ok {
+            c.P("if err := ", httprpcPkg, ".CheckRateLimit(ctx, ", prefixName, " + ", strconv.Quote(method.GetName()), ", ", descutil.RateLimitLiteral(limit, httprpcPkg), "); err != nil {")
+            c.P("return err")
+            c.P("}")
+        }
+        if scopes := descutil.Scopes(c.gen, method); len(scopes) > 0 {
+            c.P("if err := ", httprpcPkg, ".CheckScopes(ctx, ", prefixName, " + ", strconv.Quote(method.GetName()), ", ", descutil.QuotedScopes(scopes), "); err != nil {")
+            c.P("return err")
+            c.P("}")
+        }
+        if typ == "Unary" || typ == "ServerStream" {
+            c.P("in := new(", inType, ")")
+            c.P("if err := c.Receive(in); err != nil {")
+            c.P("return err")
+            c.P("}")
+        } else {
+            c.P("recv := func() (*", inType, ", error) {")
+            c.P("in := new(", inType, ")")
+            c.P("if err := c.Receive(in); err != nil {")
+            c.P("return nil, err")
+            c.P("}")
+            c.P("return in, nil")
+            c.P("}")
+        }
+        if cost, ok := descutil.QuotaCost(c.gen, method); ok {
+            c.P("if err := ", httprpcPkg, ".ChargeQuota(ctx, ", strconv.FormatInt(cost, 10), "); err != nil {")
+            c.P("return err")
+            c.P("}")
+        }
+        if d, ok := descutil.MethodTimeout(c.gen, method); ok {
+            c.P("ctx, cancel := ", contextPkg, ".WithTimeout(ctx, ", descutil.DurationLiteral(d, timePkg), ")")
+            c.P("defer cancel()")
+        }
+        switch typ {
+        case "Unary", "ClientStream":
+            arg := "in"
+            if typ == "ClientStream" {
+                arg = "recv"
+            }
+            c.P("out, err := h.impl.", methName, "(ctx, ", arg, ")")
+            c.P("if err != nil {")
+            c.P("return err")
+            c.P("}")
+            c.P("if out == nil {")
+            c.P("return ", httprpcPkg, ".Errorf(", httprpcPkg, `.Internal, "nil *`, outType, " returned by ", methName, `")`)
+            c.P("}")
+            c.P("return c.Send(out)")
+        case "ServerStream":
+            c.P("return h.impl.", methName, "(ctx, in, func(out *", outType, ") error { return c.Send(out) })")
+        case "BidiStream":
+            c.P("return h.impl.", methName, "(ctx, recv, func(out *", outType, ") error { return c.Send(out) })")
+        }
+        c.P("})")
+        c.P("}")
+        c.P()
+    }
+}
+
+// generateReflection generates the registration of service with the gRPC
+// server reflection service.
+func (c *connect) generateReflection(file *generator.FileDescriptor, fullServName, servName string) {
+    c.P("// Register", servName, "Reflection registers the ", servName, " service with the gRPC")
+    c.P("// server reflection service r, which serves the descriptor of ", file.GetName())
+    c.P("// and of the files it imports.")
+    c.P("func Register", servName, "Reflection(r *", httprpcPkg, ".Reflection) {")
+    c.P("r.RegisterService(", strconv.Quote(fullServName), ", ", strconv.Quote(file.GetName()), ")")
+    c.P("}")
+    c.P()
+}
+
+// generateHealth generates the registration of service with the gRPC health
+// checking service.
+func (c *connect) generateHealth(fullServName, servName string) {
+    c.P("// Register", servName, "Health registers the ", servName, " service with the gRPC health")
+    c.P("// checking service h, as serving unless its status is already set.")
+    c.P("func Register", servName, "Health(h *", httprpcPkg, ".Health) {")
+    c.P("h.RegisterService(", strconv.Quote(fullServName), ")")
+    c.P("}")
+    c.P()
+}
+
+// generateDescribeService generates the DescribeService method of the
+// handler of service, making it an httprpc.DescribedHandler.
+func (c *connect) generateDescribeService(service *pb.ServiceDescriptorProto, fullServName, handlerType, prefixName string) {
+    c.P("// DescribeService describes the service of h, for httprpc.DebugHandler.")
+    c.P("func (h *", handlerType, ") DescribeService() ", httprpcPkg, ".DebugService {")
+    c.P("return ", httprpcPkg, ".DebugService{")
+    c.P("Name: ", strconv.Quote(fullServName), ",")
+    c.P("Methods: []", httprpcPkg, ".DebugMethod{")
+    for _, method := range service.Method {
+        c.P("{")
+        c.P("Name: ", strconv.Quote(method.GetName()), ",")
+        c.P("Procedure: ", prefixName, " + ", strconv.Quote(method.GetName()), ",")
+        c.P("StreamType: ", strconv.Quote(debugStreamTypes[streamType(method)]), ",")
+        var decorators []string
+        if cost, ok := descutil.QuotaCost(c.gen, method); ok {
+            decorators = append(decorators, strconv.Quote("quota.cost")+": "+strconv.Quote(strconv.FormatInt(cost, 10)))
+        }
+        if ms, ok := c.budget(method); ok {
+            decorators = append(decorators, strconv.Quote(budgetOption)+": "+strconv.Quote(strconv.FormatInt(ms, 10)))
+        }
+        if d, ok := descutil.MethodTimeout(c.gen, method); ok {
+            decorators = append(decorators, strconv.Quote("grpcserial.timeout")+": "+strconv.Quote(d.String()))
+        }
+        if limit, ok := descutil.RateLimit(c.gen, method); ok {
+            decorators = append(decorators, strconv.Quote("ratelimit.rate")+": "+strconv.Quote(strconv.FormatFloat(limit.Rate, 'g', -1, 64)))
+            decorators = append(decorators, strconv.Quote("ratelimit.burst")+": "+strconv.Quote(strconv.Itoa(limit.Burst)))
+        }
+        if scopes := descutil.Scopes(c.gen, method); len(scopes) > 0 {
+            decorators = append(decorators, strconv.Quote("auth.scopes")+": "+strconv.Quote(strings.Join(scopes, " ")))
+        }
+        if p, ok := c.retryPolicy(method); ok {
+            decorators = append(decorators, strconv.Quote("retry.max_attempts")+": "+strconv.Quote(strconv.Itoa(p.MaxAttempts)))
+        }
+        if len(decorators) > 0 {
+            c.P("Decorators: map[string]string{", strings.Join(decorators, ", "), "},")
+        }
+        c.P("},")
+    }
+    c.P("},")
+    c.P("}")
+    c.P("}")
+    c.P()
+}
+
+// debugStreamTypes maps the httprpc stream types to their name in the
+// DebugMethods.
+var debugStreamTypes = map[string]string{
+    "Unary":        "unary",
+    "ClientStream": "client_stream",
+    "ServerStream": "server_stream",
+    "BidiStream":   "bidi_stream",
+}
+
+// packageService is a service of the files to generate.
+type packageService struct {
+    file    *pb.FileDescriptorProto
+    service *pb.ServiceDescriptorProto
+}
+
+// packageServices returns the services of the files to generate, which
+// share a Go package, in order.
+func (c *connect) packageServices() []packageService {
+    var services []packageService
+    for _, name := range c.gen.Request.FileToGenerate {
+        for _, f := range c.gen.Request.ProtoFile {
+            if f.GetName() != name {
+                continue
+            }
+            for _, service := range f.Service {
+                services = append(services, packageService{f, service})
+            }
+        }
+    }
+    return services
+}
+
+// generateServer generates the Dependencies of the server of services and
+// NewServerFromOptions, which returns it wired with the interceptors of
+// the package: the recording of the errors of the calls for
+// NewDebugHandler if the debug parameter is enabled, their OpenTelemetry
+// spans if the tracing parameter is, their logging if the logging
+// parameter is, their metrics if the telemetry
+// parameter is, and their Prometheus metrics if the prometheus parameter
+// is, the validation of the requests, their
+// authorization, the quota charged for them if some methods have a
+// quota cost, and their rate limiter if some methods have a rate limit.
+func (c *connect) generateServer(services []packageService) {
+    quota, rateLimit := false, false
+    for _, s := range services {
+        for _, method := range s.service.Method {
+            _, ok := descutil.QuotaCost(c.gen, method)
+            quota = quota || ok
+            _, ok = descutil.RateLimit(c.gen, method)
+            rateLimit = rateLimit || ok
+        }
+    }
+    c.P("// Dependencies are the dependencies of the server returned by NewServerFromOptions.")
+    c.P("type Dependencies struct {")
+    for _, s := range services {
+        servName := generator.CamelCase(s.service.GetName())
+        c.P("// ", servName, " implements the ", servName, " service, not served if nil.")
+        c.P(servName, " ", servName, "Connect")
+    }
+    c.P()
+    c.P("// Authorize, if not nil, authorizes the calls, given their procedure, e.g.")
+    c.P("// \"/pkg.Service/Method\", and request headers, before the methods run.")
+    c.P("// The calls it returns an error for fail, with the PermissionDenied code")
+    c.P("// if the error is not an *httprpc.Error.")
+    c.P("Authorize func(ctx ", contextPkg, ".Context, procedure string, header ", httpPkg, ".Header) error")
+    c.P()
+    c.P("// Interceptors run around the calls, within the generated interceptors.")
+    c.P("Interceptors []", httprpcPkg, ".ConnectInterceptor")
+    c.P()
+    c.P("// Reflection enables the gRPC server reflection service, v1 and v1alpha,")
+    c.P("// describing the services served, for grpcurl and friends.")
+    c.P("Reflection bool")
+    c.P()
+    c.P("// Health, if not nil, is served as the gRPC health checking service, with")
+    c.P("// the services of deps registered, so that their serving status can be")
+    c.P("// set, e.g. to not serving with Health.Shutdown when the server drains.")
+    c.P("Health *", httprpcPkg, ".Health")
+    if c.logging {
+        c.P()
+        c.P("// Logger, if not nil, logs the entry and exit of the calls instead of")
+        c.P("// logrpc.Default(), e.g. a logrpc.SlogLogger of the logger of the server.")
+        c.P("Logger ", logrpcPkg, ".Logger")
+    }
+    if quota {
+        c.P()
+        c.P("// Quota, if not nil, is charged the cost of the calls of the methods with a")
+        c.P("// (quota.cost) option, for their principal, as set by httprpc.WithPrincipal,")
+        c.P("// before the methods run. The calls it returns an error for fail, with the")
+        c.P("// ResourceExhausted code if the error is not an *httprpc.Error.")
+        c.P("Quota ", httprpcPkg, ".QuotaManager")
+    }
+    if rateLimit {
+        c.P()
+        c.P("// RateLimiter, if not nil, limits the rate of the calls of the methods with")
+        c.P("// a (ratelimit.rate) option instead of the in-process token buckets, e.g.")
+        c.P("// a limiter shared by the replicas of the server. The calls exceeding it")
+        c.P("// fail, with the ResourceExhausted code if the error is not an")
+        c.P("// *httprpc.Error.")
+        c.P("RateLimiter ", httprpcPkg, ".RateLimiter")
+    }
+    c.P("}")
+    c.P()
+    c.P("// NewServerFromOptions returns a server of the services of deps, each mounted")
+    c.P("// under its path prefix, ready to serve once its address is set. It is an")
+    c.P("// http.Server of their Connect handlers, not a grpc.Server: it serves the gRPC")
+    c.P("// clients over HTTP/2, as well as the Connect and gRPC-Web ones. Their calls")
+    if c.telemetry {
+        c.P("// are counted, published with expvar as \"rpc.<package>.<Service>.<Method>\"")
+        c.P("// maps, their requests validated by their Validate and CustomValidate")
+        c.P("// methods, if any, and authorized by deps.Authorize before the methods run.")
+    } else {
+        c.P("// have their requests validated by their Validate and CustomValidate")
+        c.P("// methods, if any, and are authorized by deps.Authorize before the methods")
+        c.P("// run.")
+    }
+    if quota {
+        c.P("// The methods with a quota cost charge it to deps.Quota before they run.")
+    }
+    if rateLimit {
+        c.P("// The methods with a rate limit are limited by deps.RateLimiter, or else by")
+        c.P("// in-process token buckets.")
+    }
+    if c.debug {
+        c.P("// Their errors are recorded for NewDebugHandler.")
+    }
+    if c.tracing {
+        c.P("// They run in OpenTelemetry server spans, as traced by traceCalls.")
+    }
+    if c.logging {
+        c.P("// Their entry and exit are logged by deps.Logger, or logrpc.Default().")
+    }
+    if c.prometheus {
+        c.P("// They are recorded as Prometheus metrics by promrpc, in the ", strconv.Quote(c.prometheusNamespace), " namespace.")
+    }
+    c.P("func NewServerFromOptions(deps Dependencies) *", httpPkg, ".Server {")
+    c.P("return ", httprpcPkg, ".NewServer(serverHandlers(deps), serverInterceptors(deps)...)")
+    c.P("}")
+    c.P()
+    if c.debug {
+        c.P("// NewDebugHandler returns an http.Handler serving, in JSON, the introspection")
+        c.P("// of the server returned by NewServerFromOptions(deps), as served by")
+        c.P("// httprpc.DebugHandler: its services and methods, with the configuration of")
+        c.P("// their generated decorators, its interceptors, and the recent errors of the")
+        c.P("// methods. Mount it under an internal mux, e.g. at /debug/rpc.")
+        c.P("func NewDebugHandler(deps Dependencies) ", httpPkg, ".Handler {")
+        c.P("return ", httprpcPkg, ".DebugHandler(serverHandlers(deps), serverInterceptors(deps)...)")
+        c.P("}")
+        c.P()
+    }
+    c.P("// serverHandlers returns the handlers of the services of deps.")
+    c.P("func serverHandlers(deps Dependencies) []", httprpcPkg, ".ConnectHandler {")
+    c.P("var handlers []", httprpcPkg, ".ConnectHandler")
+    for _, s := range services {
+        servName := generator.CamelCase(s.service.GetName())
+        c.P("if deps.", servName, " != nil {")
+        c.P("handlers = append(handlers, New", servName, "ConnectHandler(deps.", servName, "))")
+        c.P("}")
+    }
+    c.P("if deps.Reflection {")
+    c.P("r := ", httprpcPkg, ".NewReflection()")
+    for _, s := range services {
+        servName := generator.CamelCase(s.service.GetName())
+        c.P("if deps.", servName, " != nil {")
+        c.P("Register", servName, "Reflection(r)")
+        c.P("}")
+    }
+    c.P("handlers = append(handlers, r.Handlers()...)")
+    c.P("}")
+    c.P("if deps.Health != nil {")
+    for _, s := range services {
+        servName := generator.CamelCase(s.service.GetName())
+        c.P("if deps.", servName, " != nil {")
+        c.P("Register", servName, "Health(deps.Health)")
+        c.P("}")
+    }
+    c.P("handlers = append(handlers, deps.Health.Handler())")
+    c.P("}")
+    c.P("return handlers")
+    c.P("}")
+    c.P()
+    c.P("// serverInterceptors returns the interceptors of the calls of the server of")
+    c.P("// deps, the first one outermost.")
+    c.P("func serverInterceptors(deps Dependencies) []", httprpcPkg, ".ConnectInterceptor {")
+    var interceptors []string
+    if c.tracing {
+        interceptors = append(interceptors, "traceCalls")
+    }
+    if c.logging {
+        interceptors = append(interceptors, logrpcPkg+".Interceptor(deps.Logger)")
+    }
+    if c.debug {
+        interceptors = append(interceptors, httprpcPkg+".RecordErrors")
+    }
+    if c.telemetry {
+        interceptors = append(interceptors, httprpcPkg+`.Metrics("rpc")`)
+    }
+    if c.prometheus {
+        interceptors = append(interceptors, promrpcPkg+".New("+strconv.Quote(c.prometheusNamespace)+").Interceptor()")
+    }
+    interceptors = append(interceptors, httprpcPkg+".ValidateRequests")
+    c.P("interceptors := []", httprpcPkg, ".ConnectInterceptor{", strings.Join(interceptors, ", "), "}")
+    c.P("if deps.Authorize != nil {")
+    c.P("interceptors = append(interceptors, ", httprpcPkg, ".Authorize(deps.Authorize))")
+    c.P("}")
+    if quota {
+        c.P("if deps.Quota != nil {")
+        c.P("interceptors = append(interceptors, ", httprpcPkg, ".Quota(deps.Quota))")
+        c.P("}")
+    }
+    if rateLimit {
+        c.P("if deps.RateLimiter != nil {")
+        c.P("interceptors = append(interceptors, ", httprpcPkg, ".RateLimiting(deps.RateLimiter))")
+        c.P("}")
+    }
+    c.P("return append(interceptors, deps.Interceptors...)")
+    c.P("}")
+    c.P()
+    if c.tracing {
+        c.generateTraceCalls()
+    }
+}
+
+// generateTraceCalls generates traceCalls, the interceptor running the
+// calls of the server in OpenTelemetry spans.
+func (c *connect) generateTraceCalls() {
+    c.P("// traceCalls is an interceptor running the calls in OpenTelemetry server")
+    c.P("// spans, named after their procedure, e.g. \"pkg.Service/Method\", children of")
+    c.P("// the span whose context the request headers carry, as injected by the")
+    c.P("// global propagator, and recording the size of the requests and responses")
+    c.P("// of the calls and their status.")
+    c.P("func traceCalls(ctx ", contextPkg, ".Context, c *", httprpcPkg, ".ServerCall, next func(ctx ", contextPkg, ".Context) error) error {")
+    c.P("ctx = ", otelPkg, ".GetTextMapPropagator().Extract(ctx, ", propagationPkg, ".HeaderCarrier(c.RequestHeader()))")
+    c.P("service, method := ", httprpcPkg, ".SplitProcedure(c.Procedure())")
+    c.P("ctx, span := ", otelPkg, ".Tracer(", strconv.Quote("github.com/lleveque/protoc-gen-go/connect"), ").Start(ctx, service+\"/\"+method,")
+    c.P(tracePkg, ".WithSpanKind(", tracePkg, ".SpanKindServer),")
+    c.P(tracePkg, ".WithAttributes(")
+    c.P(attributePkg, ".String(\"rpc.system\", \"connect_rpc\"),")
+    c.P(attributePkg, ".String(\"rpc.service\", service),")
+    c.P(attributePkg, ".String(\"rpc.method\", method),")
+    c.P("))")
+    c.P("defer span.End()")
+    c.P("err := next(ctx)")
+    c.P("span.SetAttributes(")
+    c.P(attributePkg, ".Int(\"rpc.request.size\", c.ReceivedBytes()),")
+    c.P(attributePkg, ".Int(\"rpc.response.size\", c.SentBytes()),")
+    c.P(")")
+    c.P("if e := ", httprpcPkg, ".ErrorFrom(err); e != nil {")
+    c.P("span.SetAttributes(", attributePkg, ".Int(\"rpc.grpc.status_code\", e.Code.GRPCStatus()))")
+    c.P("span.RecordError(err)")
+    c.P("span.SetStatus(", codesPkg, ".Error, e.Msg)")
+    c.P("} else {")
+    c.P("span.SetAttributes(", attributePkg, ".Int(\"rpc.grpc.status_code\", 0))")
+    c.P("}")
+    c.P("return err")
+    c.P("}")
+    c.P()
+}
+
+// generateClient generates the Connect clients of service.
+func (c *connect) generateClient(service *pb.ServiceDescriptorProto, servName, ifaceName, prefixName string) {
+    clientType := unexport(servName) + "ConnectClient"
+    proto := c.gen.Pkg["proto"]
+
+    c.P("type ", clientType, " struct {")
+    c.P("client ", httprpcPkg, ".HTTPClient")
+    c.P("baseURL string")
+    c.P("isJSON bool")
+    c.P("}")
+    c.P()
+    c.P("var _ ", ifaceName, " = (*", clientType, ")(nil)")
+    c.P()
+    c.P("// New", servName, "ConnectClient returns a client of the Connect server at")
+    c.P("// baseURL, e.g. \"http://localhost:8080\", sending protobuf messages.")
+    c.P("func New", servName, "ConnectClient(baseURL string, client ", httprpcPkg, ".HTTPClient) ", ifaceName, " {")
+    c.P("return &", clientType, "{client, baseURL, false}")
+    c.P("}")
+    c.P()
+    c.P("// New", servName, "ConnectJSONClient returns a client of the Connect server at")
+    c.P("// baseURL, e.g. \"http://localhost:8080\", sending JSON messages.")
+    c.P("func New", servName, "ConnectJSONClient(baseURL string, client ", httprpcPkg, ".HTTPClient) ", ifaceName, " {")
+    c.P("return &", clientType, "{client, baseURL, true}")
+    c.P("}")
+    c.P()
+    for _, method := range service.Method {
+        outType := c.typeName(method.GetOutputType())
+        methPath := prefixName + " + " + strconv.Quote(method.GetName())
+        newResponse := "func() " + proto + ".Message { return new(" + outType + ") }"
+        sendResponse := "func(m " + proto + ".Message) error { return send(m.(*" + outType + ")) }"
+        recvRequest := "func() (" + proto + ".Message, error) { return recv() }"
+
+        policy, retries := c.retryPolicy(method)
+        policyName := unexport(servName) + generator.CamelCase(method.GetName()) + "RetryPolicy"
+        if retries {
+            c.generateRetryPolicy(policyName, method.GetName(), policy)
+        }
+
+        c.P("func (c *", clientType, ") ", c.methodSignature(method), " {")
+        if ms, ok := c.budget(method); ok {
+            c.P("if err := ", httprpcPkg, ".CheckBudget(ctx, ", methPath, ", ", strconv.FormatInt(ms, 10), "); err != nil {")
+            if typ := streamType(method); typ == "Unary" || typ == "ClientStream" {
+                c.P("return nil, err")
+            } else {
+                c.P("return err")
+            }
+            c.P("}")
+        }
+        switch streamType(method) {
+        case "Unary":
+            if retries {
+                c.P("var out *", outType)
+                c.P("err := ", httprpcPkg, ".Retry(ctx, ", policyName, ", func(ctx ", contextPkg, ".Context) error {")
+                c.P("out = new(", outType, ")")
+                c.P("return ", httprpcPkg, ".CallConnect(ctx, c.client, c.baseURL, ", methPath, ", in, out, c.isJSON)")
+                c.P("})")
+            } else {
+                c.P("out := new(", outType, ")")
+                c.P("err := ", httprpcPkg, ".CallConnect(ctx, c.client, c.baseURL, ", methPath, ", in, out, c.isJSON)")
+            }
+            c.P("if err != nil {")
+            c.P("return nil, err")
+            c.P("}")
+            c.P("return out, nil")
+        case "ClientStream":
+            c.P("out := new(", outType, ")")
+            c.P("err := ", httprpcPkg, ".CallConnectStream(ctx, c.client, c.baseURL, ", methPath, ", c.isJSON,")
+            c.P(recvRequest, ",")
+            c.P("func() ", proto, ".Message { return out }, nil)")
+            c.P("if err != nil {")
+            c.P("return nil, err")
+            c.P("}")
+            c.P("return out, nil")
+        case "ServerStream":
+            c.P("return ", httprpcPkg, ".CallConnectStream(ctx, c.client, c.baseURL, ", methPath, ", c.isJSON,")
+            c.P(httprpcPkg, ".Single(in), ", newResponse, ",")
+            c.P(sendResponse, ")")
+        case "BidiStream":
+            c.P("return ", httprpcPkg, ".CallConnectStream(ctx, c.client, c.baseURL, ", methPath, ", c.isJSON,")
+            c.P(recvRequest, ", ", newResponse, ",")
+            c.P(sendResponse, ")")
+        }
+        c.P("}")
+        c.P()
+    }
+}
+
+// generateTestServer generates StartTest<Service>Server, serving an
+// implementation of the service to a client over an in-memory listener.
+func (c *connect) generateTestServer(servName, ifaceName string) {
+    c.P("// StartTest", servName, "Server serves impl on an in-memory listener, for tests,")
+    c.P("// and returns a Connect client of it and a function stopping the server.")
+    c.P("func StartTest", servName, "Server(t ", httprpcPkg, ".TB, impl ", ifaceName, ") (client ", ifaceName, ", cleanup func()) {")
+    c.P("t.Helper()")
+    c.P("l := ", httprpcPkg, ".NewMemoryListener()")
+    c.P("srv := ", httprpcPkg, ".NewServer([]", httprpcPkg, ".ConnectHandler{New", servName, "ConnectHandler(impl)})")
+    c.P("done := make(chan struct{})")
+    c.P("go func() {")
+    c.P("defer close(done)")
+    c.P("if err := srv.Serve(l); err != ", httpPkg, ".ErrServerClosed {")
+    c.P(`t.Errorf("serving `, servName, `: %v", err)`)
+    c.P("}")
+    c.P("}()")
+    c.P("httpClient := l.Client()")
+    c.P("cleanup = func() {")
+    c.P("srv.Close()")
+    c.P("<-done")
+    c.P("httpClient.Transport.(*", httpPkg, ".Transport).CloseIdleConnections()")
+    c.P("}")
+    c.P(`return New`, servName, `ConnectClient("http://`, unexport(servName), `.test", httpClient), cleanup`)
+    c.P("}")
+    c.P()
+}
+
+// generateVCRClient generates New<Service>VCRClient, a client decorator
+// recording the responses of unary calls as fixtures, and replaying them.
+func (c *connect) generateVCRClient(service *pb.ServiceDescriptorProto, servName, ifaceName, prefixName string) {
+    clientType := unexport(servName) + "VCRClient"
+    redactedName := unexport(servName) + "RedactedFields"
+    proto := c.gen.Pkg["proto"]
+
+    c.P("// ", redactedName, " are the fields redacted from the fixtures of the ", servName, " calls.")
+    c.P("var ", redactedName, " = ", httprpcPkg, ".RedactedFields{")
+    redacted := c.redactedFields(service)
+    for _, typ := range redacted.types {
+        c.P(strconv.Quote(strings.TrimPrefix(typ, ".")), ": {")
+        for _, f := range redacted.fields[typ] {
+            c.P(strconv.Quote(f[0]), ": ", strconv.Quote(f[1]), ",")
+        }
+        c.P("},")
+    }
+    c.P("}")
+    c.P()
+    c.P("type ", clientType, " struct {")
+    c.P("next ", ifaceName)
+    c.P("vcr *", httprpcPkg, ".VCR")
+    c.P("}")
+    c.P()
+    c.P("// New", servName, "VCRClient returns a client recording the responses to the calls")
+    c.P("// made with next as fixtures of vcr, or replaying them, as per its mode, for")
+    c.P("// hermetic tests. The sensitive fields are redacted from the fixtures.")
+    c.P("// Streaming calls are not recorded, and fail when replaying.")
+    c.P("func New", servName, "VCRClient(next ", ifaceName, ", vcr *", httprpcPkg, ".VCR) ", ifaceName, " {")
+    c.P("return &", clientType, "{next, vcr}")
+    c.P("}")
+    c.P()
+    for _, method := range service.Method {
+        methName := generator.CamelCase(method.GetName())
+        c.P("func (c *", clientType, ") ", c.methodSignature(method), " {")
+        switch streamType(method) {
+        case "Unary":
+            c.P("out := new(", c.typeName(method.GetOutputType()), ")")
+            c.P("err := c.vcr.Call(ctx, ", prefixName, " + ", strconv.Quote(method.GetName()), ", in, out, ", redactedName, ",")
+            c.P("func(ctx ", contextPkg, ".Context) (", proto, ".Message, error) { return c.next.", methName, "(ctx, in) })")
+            c.P("if err != nil {")
+            c.P("return nil, err")
+            c.P("}")
+            c.P("return out, nil")
+        default:
+            unimplemented := httprpcPkg + ".Errorf(" + httprpcPkg + `.Unimplemented, "the streaming calls are not replayed")`
+            args := "ctx, recv, send"
+            switch streamType(method) {
+            case "ClientStream":
+                args = "ctx, recv"
+                unimplemented = "nil, " + unimplemented
+            case "ServerStream":
+                args = "ctx, in, send"
+            }
+            c.P("if c.vcr.Mode == ", httprpcPkg, ".Replay {")
+            c.P("return ", unimplemented)
+            c.P("}")
+            c.P("return c.next.", methName, "(", args, ")")
+        }
+        c.P("}")
+        c.P()
+    }
+}
+
+// generateCanaryClient generates the canary client of service, splitting
+// the calls between two backends.
+func (c *connect) generateCanaryClient(service *pb.ServiceDescriptorProto, servName, ifaceName, prefixName string) {
+    clientType := unexport(servName) + "CanaryClient"
+
+    c.P("type ", clientType, " struct {")
+    c.P("stable, canary ", ifaceName)
+    c.P("config ", httprpcPkg, ".CanaryConfig")
+    c.P("}")
+    c.P()
+    c.P("// New", servName, "CanaryClient returns a client splitting the calls between the")
+    c.P("// stable and canary backends, routing to canary the percentage of the calls")
+    c.P("// of each method given by config, consulted on every call. The calls of the")
+    c.P("// methods whose request has a (", canaryKeyOption, ") field are routed by its hash, the")
+    c.P("// ones with the same key to the same backend, the others at random.")
+    c.P("func New", servName, "CanaryClient(stable, canary ", ifaceName, ", config ", httprpcPkg, ".CanaryConfig) ", ifaceName, " {")
+    c.P("return &", clientType, "{stable, canary, config}")
+    c.P("}")
+    c.P()
+    c.P("// pick returns the backend of the call of procedure with the routing key key.")
+    c.P("func (c *", clientType, ") pick(procedure, key string) ", ifaceName, " {")
+    c.P("if ", httprpcPkg, ".ToCanary(c.config, procedure, key) {")
+    c.P("return c.canary")
+    c.P("}")
+    c.P("return c.stable")
+    c.P("}")
+    c.P()
+    for _, method := range service.Method {
+        methName := generator.CamelCase(method.GetName())
+        key := `""`
+        typ := streamType(method)
+        if field := c.canaryKey(method); field != nil && (typ == "Unary" || typ == "ServerStream") {
+            key = "in.Get" + generator.CamelCase(field.GetName()) + "()"
+            if field.GetType() != pb.FieldDescriptorProto_TYPE_STRING {
+                key = c.gen.Pkg["fmt"] + ".Sprint(" + key + ")"
+            }
+        }
+        args := "ctx, in"
+        switch typ {
+        case "ClientStream":
+            args = "ctx, recv"
+        case "ServerStream":
+            args = "ctx, in, send"
+        case "BidiStream":
+            args = "ctx, recv, send"
+        }
+        c.P("func (c *", clientType, ") ", c.methodSignature(method), " {")
+        c.P("return c.pick(", prefixName, " + ", strconv.Quote(method.GetName()), ", ", key, ").", methName, "(", args, ")")
+        c.P("}")
+        c.P()
+    }
+}
+
+// canaryKey returns the field of the request of method with the
+// (canary_key) option set, or nil. It fails on repeated and message
+// fields, and on requests with several such fields.
+func (c *connect) canaryKey(method *pb.MethodDescriptorProto) *pb.FieldDescriptorProto {
+    ext := descutil.Extension(c.gen, ".google.protobuf.FieldOptions", canaryKeyOption)
+    if ext == nil || ext.GetType() != pb.FieldDescriptorProto_TYPE_BOOL {
+        return nil
+    }
+    msg, ok := c.gen.ObjectNamed(method.GetInputType()).(*generator.Descriptor)
+    if !ok {
+        return nil
+    }
+    var key *pb.FieldDescriptorProto
+    for _, field := range msg.Field {
+        if v, ok := descutil.Options(field.Options).Varint(ext.GetNumber()); !ok || v == 0 {
+            continue
+        }
+        name := strings.TrimPrefix(method.GetInputType(), ".") + "." + field.GetName()
+        switch {
+        case key != nil:
+            c.gen.Fail("several", canaryKeyOption, "fields in", strings.TrimPrefix(method.GetInputType(), "."))
+        case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED,
+            field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE, field.GetType() == pb.FieldDescriptorProto_TYPE_GROUP:
+            c.gen.Fail("the", canaryKeyOption, "field", name, "must be a singular scalar field")
+        }
+        key = field
+    }
+    return key
+}
+
+// budget returns the minimum latency budget of the calls of method, in
+// milliseconds, given by its (budget_ms) option, and whether it has one. It
+// fails on negative budgets.
+func (c *connect) budget(method *pb.MethodDescriptorProto) (int64, bool) {
+    ext := descutil.Extension(c.gen, ".google.protobuf.MethodOptions", budgetOption)
+    if ext == nil {
+        return 0, false
+    }
+    values := descutil.OptionValues(c.gen, descutil.Options(method.Options), ext)
+    if len(values) == 0 {
+        return 0, false
+    }
+    ms, err := strconv.ParseInt(values[0], 10, 64)
+    if err != nil || ms < 0 {
+        c.gen.Fail("invalid", budgetOption, "option", values[0], "of method", method.GetName()+": want a non-negative integer")
+    }
+    return ms, true
+}
+
+// retryPolicy returns the retry policy of the calls of method, given by its
+// (retry.*) options, and whether it has one. It fails on the streaming
+// methods, which the clients do not retry, and on unknown retryable codes.
+func (c *connect) retryPolicy(method *pb.MethodDescriptorProto) (httprpc.RetryPolicy, bool) {
+    opts, ok := descutil.RetryPolicy(c.gen, method)
+    if ok && streamType(method) != "Unary" {
+        c.gen.Fail("the retry options of method", method.GetName()+": only the unary methods are retried")
+    }
+    p := httprpc.RetryPolicy{MaxAttempts: opts.MaxAttempts, Backoff: opts.Backoff, MaxBackoff: opts.MaxBackoff}
+    for _, name := range opts.RetryableCodes {
+        code, known := httprpc.ParseCode(name)
+        if !known {
+            c.gen.Fail("invalid retry.retryable_codes option " + strconv.Quote(name) + " of method " + method.GetName() + ": want an error code, e.g. \"unavailable\"")
+        }
+        p.Codes = append(p.Codes, code)
+    }
+    return p, ok
+}
+
+// generateRetryPolicy generates the variable named name holding the retry
+// policy p of the calls of method by the clients.
+func (c *connect) generateRetryPolicy(name, method string, p httprpc.RetryPolicy) {
+    c.P("// ", name, " is the retry policy of the calls of ", method, ", given by its")
+    c.P("// retry options.")
+    c.P("var ", name, " = ", httprpcPkg, ".RetryPolicy{")
+    c.P("MaxAttempts: ", strconv.Itoa(p.MaxAttempts), ",")
+    c.P("Backoff: ", descutil.DurationLiteral(p.Backoff, timePkg), ",")
+    if p.MaxBackoff > 0 {
+        c.P("MaxBackoff: ", descutil.DurationLiteral(p.MaxBackoff, timePkg), ",")
+    }
+    if len(p.Codes) > 0 {
+        codes := make([]string, len(p.Codes))
+        for i, code := range p.Codes {
+            codes[i] = strconv.Quote(string(code))
+        }
+        c.P("Codes: []", httprpcPkg, ".Code{", strings.Join(codes, ", "), "},")
+    }
+    c.P("}")
+    c.P()
+}
+
+// redactedFields are the fields to redact from the messages of a service,
+// as described by httprpc.RedactedFields, by message.
+type redactedFields struct {
+    types  []string               // messages having fields to redact, in order
+    fields map[string][][2]string // the fields to redact, and their value
+}
+
+// redactedFields returns the fields to redact from the requests and
+// responses of service: the sensitive ones, and the message fields
+// holding some.
+func (c *connect) redactedFields(service *pb.ServiceDescriptorProto) redactedFields {
+    // Walk the messages reachable from the methods.
+    var types []string
+    msgs := make(map[string]*generator.Descriptor)
+    var walk func(typ string)
+    walk = func(typ string) {
+        msg, ok := c.gen.ObjectNamed(typ).(*generator.Descriptor)
+        if !ok || msgs[typ] != nil {
+            return
+        }
+        msgs[typ] = msg
+        types = append(types, typ)
+        for _, field := range msg.Field {
+            if field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE {
+                walk(field.GetTypeName())
+            }
+        }
+    }
+    for _, method := range service.Method {
+        walk(method.GetInputType())
+        walk(method.GetOutputType())
+    }
+
+    // valueType returns the message type of the values of field, and
+    // whether it is a map.
+    valueType := func(field *pb.FieldDescriptorProto) (string, bool) {
+        if msg := msgs[field.GetTypeName()]; msg != nil && msg.GetOptions().GetMapEntry() {
+            if value := msg.Field[1]; value.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE {
+                return value.GetTypeName(), true
+            }
+            return "", true
+        }
+        return field.GetTypeName(), false
+    }
+    // Find the messages holding sensitive fields, then those holding them,
+    // until no more are found.
+    holding := make(map[string]bool)
+    for changed := true; changed; {
+        changed = false
+        for _, typ := range types {
+            for _, field := range msgs[typ].Field {
+                value, _ := valueType(field)
+                if !holding[typ] && (descutil.IsSensitive(c.gen, field) || holding[value]) {
+                    holding[typ], changed = true, true
+                }
+            }
+        }
+    }
+
+    r := redactedFields{fields: make(map[string][][2]string)}
+    for _, typ := range types {
+        if !holding[typ] || msgs[typ].GetOptions().GetMapEntry() {
+            continue
+        }
+        r.types = append(r.types, typ)
+        for _, field := range msgs[typ].Field {
+            value, isMap := valueType(field)
+            switch {
+            case descutil.IsSensitive(c.gen, field):
+                r.fields[typ] = append(r.fields[typ], [2]string{field.GetName(), ""})
+            case holding[value] && isMap:
+                r.fields[typ] = append(r.fields[typ], [2]string{field.GetName(), "map:" + strings.TrimPrefix(value, ".")})
+            case holding[value]:
+                r.fields[typ] = append(r.fields[typ], [2]string{field.GetName(), strings.TrimPrefix(value, ".")})
+            }
+        }
+    }
+    return r
+}
+
+// unexport returns s with its first letter in lower case.
+func unexport(s string) string { return strings.ToLower(s[:1]) + s[1:] }
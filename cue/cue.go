@@ -0,0 +1,618 @@
+// Package cue outputs the CUE definitions of the JSON mapping of the
+// messages, with the constraints of their fields.
+//
+// For every generated file foo.proto it writes foo.cue next to its Go file,
+// in the CUE package named after the Go package, with a definition per
+// message and enum, named after its Go type, e.g. #Foo and #Foo_Bar, to
+// validate the configurations of the services, in JSON or YAML, against the
+// schemas of the messages they load, e.g. with cue vet. The fields are
+// named after their JSON names and optional, as the JSON mapping omits the
+// default values. The enums are the names of their values, or with
+// enum_json=number their numbers, the integers and floating-point numbers
+// numbers, bounded by their type, the bytes base64 strings and the
+// well-known types have their special encoding, e.g. time.Time for
+// google.protobuf.Timestamp. The messages of other packages are open
+// structs. The exclusion of the fields of a oneof is left to the parsers.
+//
+// The constraints of the fields given by their options in the manner of
+// protoc-gen-validate, (validate.rules), or protovalidate,
+// (buf.validate.field), as checked by the validate plugin, are constraints
+// of the definitions: the required fields are required, and the rules on
+// the numbers, strings, enums, repeated and map fields are the
+// corresponding bounds, patterns, disjunctions and validators of the
+// strings, net, list and struct packages. The rules CUE cannot check, on
+// the lengths in bytes of the strings and on the bytes, are left out.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package cue
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "math"
+    "path"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+    "github.com/lleveque/protoc-gen-go/wire"
+)
+
+// Field numbers of the field options holding the rules, as registered for
+// protoc-gen-validate and protovalidate, and of the rules in their FieldRules.
+const (
+    pgvRulesOption = 1071 // (validate.rules)
+    bufFieldOption = 1159 // (buf.validate.field)
+
+    messageRules  = 17
+    repeatedRules = 18
+    mapRules      = 19
+    requiredRule  = 25 // protovalidate only
+)
+
+// typeRules maps the field types to the number of their rules in FieldRules.
+var typeRules = map[pb.FieldDescriptorProto_Type]int32{
+    pb.FieldDescriptorProto_TYPE_FLOAT:    1,
+    pb.FieldDescriptorProto_TYPE_DOUBLE:   2,
+    pb.FieldDescriptorProto_TYPE_INT32:    3,
+    pb.FieldDescriptorProto_TYPE_INT64:    4,
+    pb.FieldDescriptorProto_TYPE_UINT32:   5,
+    pb.FieldDescriptorProto_TYPE_UINT64:   6,
+    pb.FieldDescriptorProto_TYPE_SINT32:   7,
+    pb.FieldDescriptorProto_TYPE_SINT64:   8,
+    pb.FieldDescriptorProto_TYPE_FIXED32:  9,
+    pb.FieldDescriptorProto_TYPE_FIXED64:  10,
+    pb.FieldDescriptorProto_TYPE_SFIXED32: 11,
+    pb.FieldDescriptorProto_TYPE_SFIXED64: 12,
+    pb.FieldDescriptorProto_TYPE_BOOL:     13,
+    pb.FieldDescriptorProto_TYPE_STRING:   14,
+    pb.FieldDescriptorProto_TYPE_BYTES:    15,
+    pb.FieldDescriptorProto_TYPE_ENUM:     16,
+    pb.FieldDescriptorProto_TYPE_MESSAGE:  messageRules,
+}
+
+// scalarTypes maps the scalar types to the CUE types of their JSON values.
+var scalarTypes = map[pb.FieldDescriptorProto_Type]string{
+    pb.FieldDescriptorProto_TYPE_DOUBLE:   "number",
+    pb.FieldDescriptorProto_TYPE_FLOAT:    "number",
+    pb.FieldDescriptorProto_TYPE_INT64:    "int64",
+    pb.FieldDescriptorProto_TYPE_UINT64:   "uint64",
+    pb.FieldDescriptorProto_TYPE_INT32:    "int32",
+    pb.FieldDescriptorProto_TYPE_FIXED64:  "uint64",
+    pb.FieldDescriptorProto_TYPE_FIXED32:  "uint32",
+    pb.FieldDescriptorProto_TYPE_BOOL:     "bool",
+    pb.FieldDescriptorProto_TYPE_STRING:   "string",
+    pb.FieldDescriptorProto_TYPE_BYTES:    "string",
+    pb.FieldDescriptorProto_TYPE_UINT32:   "uint32",
+    pb.FieldDescriptorProto_TYPE_SFIXED32: "int32",
+    pb.FieldDescriptorProto_TYPE_SFIXED64: "int64",
+    pb.FieldDescriptorProto_TYPE_SINT32:   "int32",
+    pb.FieldDescriptorProto_TYPE_SINT64:   "int64",
+}
+
+// wellKnownTypes maps the well-known types having a special JSON mapping to
+// their CUE type, and the CUE package it uses, if any.
+var wellKnownTypes = map[string][2]string{
+    ".google.protobuf.Any":         {`{"@type": string, ...}`},
+    ".google.protobuf.Duration":    {"time.Duration", "time"},
+    ".google.protobuf.Empty":       {"close({})"},
+    ".google.protobuf.FieldMask":   {"string"},
+    ".google.protobuf.ListValue":   {"[...]"},
+    ".google.protobuf.Struct":      {"{...}"},
+    ".google.protobuf.Timestamp":   {"time.Time", "time"},
+    ".google.protobuf.Value":       {"_"},
+    ".google.protobuf.BoolValue":   {"bool | null"},
+    ".google.protobuf.BytesValue":  {"string | null"},
+    ".google.protobuf.DoubleValue": {"number | null"},
+    ".google.protobuf.FloatValue":  {"number | null"},
+    ".google.protobuf.Int32Value":  {"int32 | null"},
+    ".google.protobuf.Int64Value":  {"int64 | null"},
+    ".google.protobuf.StringValue": {"string | null"},
+    ".google.protobuf.UInt32Value": {"uint32 | null"},
+    ".google.protobuf.UInt64Value": {"uint64 | null"},
+}
+
+// uuidPattern and emailPattern are the patterns of the values of the string
+// fields with the uuid and email rules.
+const (
+    uuidPattern  = "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"
+    emailPattern = `^[^@\s]+@[^@\s]+$`
+)
+
+// identifier matches the field names usable as CUE labels without quotes.
+var identifier = regexp.MustCompile(`^[A-Za-z$][A-Za-z0-9_$]*$`)
+
+// keywords are the CUE keywords, quoted as labels.
+var keywords = map[string]bool{
+    "package": true, "import": true, "for": true, "in": true, "if": true, "let": true,
+    "true": true, "false": true, "null": true, "div": true, "mod": true, "quo": true, "rem": true,
+}
+
+func init() {
+    generator.RegisterPlugin(new(cue))
+}
+
+// cue is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates CUE definitions.
+type cue struct {
+    gen         *generator.Generator
+    enumNumbers bool // enum_json=number: enums are JSON numbers, not names
+}
+
+// cueFile accumulates the CUE definitions of a file, along with the CUE
+// packages they use.
+type cueFile struct {
+    bytes.Buffer
+    file    *generator.FileDescriptor
+    dir     string          // output directory of the definitions
+    imports map[string]bool // CUE packages used
+}
+
+// Name returns the name of this plugin, "cue".
+func (c *cue) Name() string {
+    return "cue"
+}
+
+// Init initializes the plugin.
+func (c *cue) Init(gen *generator.Generator) {
+    c.gen = gen
+    c.enumNumbers, _ = descutil.EnumJSON(gen)
+}
+
+// Generate writes the CUE definitions of the messages and enums of the
+// given file.
+func (c *cue) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(c.gen, file.GetName()) {
+        return
+    }
+    name := descutil.OutputName(c.gen, file.FileDescriptorProto, ".cue")
+    f := &cueFile{file: file, dir: path.Dir(name), imports: make(map[string]bool)}
+    for _, enum := range descutil.Enums(c.gen, file) {
+        c.generateEnum(f, enum)
+    }
+    for _, msg := range descutil.Messages(c.gen, file) {
+        c.generateDefinition(f, msg)
+    }
+
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "// Code generated by protoc-gen-go. DO NOT EDIT.\n")
+    fmt.Fprintf(&b, "// source: %s\n\n", file.GetName())
+    fmt.Fprintf(&b, "package %s\n", file.PackageName())
+    var imports []string
+    for pkg := range f.imports {
+        imports = append(imports, pkg)
+    }
+    sort.Strings(imports)
+    if len(imports) > 0 {
+        b.WriteString("\nimport (\n")
+        for _, pkg := range imports {
+            fmt.Fprintf(&b, "\t%q\n", pkg)
+        }
+        b.WriteString(")\n")
+    }
+    b.Write(f.Bytes())
+    descutil.AddFile(c.gen, name, b.String())
+}
+
+// GenerateImports generates the import declaration for this file.
+func (c *cue) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// generateEnum generates the definition of enum: the disjunction of the
+// names of its values, or of their numbers with enum_json=number.
+func (c *cue) generateEnum(f *cueFile, enum *generator.EnumDescriptor) {
+    f.WriteString("\n")
+    writeComment(f, "", descutil.LeadingComments(f.file.FileDescriptorProto, descutil.EnumPath(enum)))
+    var values []string
+    seen := make(map[int32]bool)
+    for _, value := range enum.Value {
+        if !c.enumNumbers {
+            values = append(values, quote(value.GetName()))
+        } else if !seen[value.GetNumber()] {
+            seen[value.GetNumber()] = true
+            values = append(values, fmt.Sprint(value.GetNumber()))
+        }
+    }
+    fmt.Fprintf(f, "#%s: %s\n", generator.CamelCaseSlice(enum.TypeName()), strings.Join(values, " | "))
+}
+
+// generateDefinition generates the definition of msg, with a field per
+// field, constrained by its rules.
+func (c *cue) generateDefinition(f *cueFile, msg *generator.Descriptor) {
+    msgPath := descutil.MessagePath(msg)
+    f.WriteString("\n")
+    writeComment(f, "", descutil.LeadingComments(f.file.FileDescriptorProto, msgPath))
+    if len(msg.Field) == 0 {
+        fmt.Fprintf(f, "#%s: {}\n", generator.CamelCaseSlice(msg.TypeName()))
+        return
+    }
+    fmt.Fprintf(f, "#%s: {\n", generator.CamelCaseSlice(msg.TypeName()))
+    for i, field := range msg.Field {
+        writeComment(f, "\t", descutil.LeadingComments(f.file.FileDescriptorProto, fmt.Sprintf("%s,2,%d", msgPath, i)))
+        rules := fieldRules(field)
+        marker := "?"
+        if isRequired(field, rules) {
+            marker = "!"
+        }
+        fmt.Fprintf(f, "\t%s%s: %s\n", label(descutil.JSONName(field)), marker, c.fieldType(f, field, rules))
+    }
+    f.WriteString("}\n")
+}
+
+// isRequired reports whether field, with the FieldRules rules, is required:
+// a required proto2 field, or a field with the required rule.
+func isRequired(field *pb.FieldDescriptorProto, rules *wire.Message) bool {
+    if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REQUIRED {
+        return true
+    }
+    if b, ok := rules.Varint(requiredRule); ok && b != 0 {
+        return true
+    }
+    if b, ok := rules.Message(messageRules); ok {
+        if req, ok := wire.NewMessage(b).Varint(2); ok && req != 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// fieldType returns the CUE type of the JSON value of field, constrained
+// by the FieldRules rules: a list for repeated fields, a struct for maps.
+func (c *cue) fieldType(f *cueFile, field *pb.FieldDescriptorProto, rules *wire.Message) string {
+    if entry := descutil.MapEntry(c.gen, field); entry != nil {
+        b, _ := rules.Message(mapRules)
+        sub := wire.NewMessage(b)
+        keys, _ := sub.Message(4)
+        values, _ := sub.Message(5)
+        key := "string"
+        switch entry.Field[0].GetType() {
+        case pb.FieldDescriptorProto_TYPE_STRING:
+            key = constrain("string", c.constraints(f, entry.Field[0], wire.NewMessage(keys)))
+        case pb.FieldDescriptorProto_TYPE_BOOL:
+            key = `"true" | "false"`
+        default:
+            key = `=~"^-?[0-9]+$"`
+        }
+        typ := fmt.Sprintf("{[%s]: %s}", key, constrain(c.valueType(f, entry.Field[1]), c.constraints(f, entry.Field[1], wire.NewMessage(values))))
+        var cons []string
+        if n, ok := sub.Varint(1); ok {
+            cons = append(cons, f.use("struct")+".MinFields("+fmt.Sprint(n)+")")
+        }
+        if n, ok := sub.Varint(2); ok {
+            cons = append(cons, f.use("struct")+".MaxFields("+fmt.Sprint(n)+")")
+        }
+        return constrain(typ, cons)
+    }
+    if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+        b, _ := rules.Message(repeatedRules)
+        sub := wire.NewMessage(b)
+        items, _ := sub.Message(4)
+        elem := constrain(c.valueType(f, field), c.constraints(f, field, wire.NewMessage(items)))
+        if strings.Contains(elem, " ") {
+            elem = "(" + elem + ")"
+        }
+        typ := "[..." + elem + "]"
+        var cons []string
+        if n, ok := sub.Varint(1); ok {
+            cons = append(cons, f.use("list")+".MinItems("+fmt.Sprint(n)+")")
+        }
+        if n, ok := sub.Varint(2); ok {
+            cons = append(cons, f.use("list")+".MaxItems("+fmt.Sprint(n)+")")
+        }
+        if unique, _ := sub.Varint(3); unique != 0 {
+            cons = append(cons, f.use("list")+".UniqueItems()")
+        }
+        return constrain(typ, cons)
+    }
+    return constrain(c.valueType(f, field), c.constraints(f, field, rules))
+}
+
+// valueType returns the CUE type of a single JSON value of field.
+func (c *cue) valueType(f *cueFile, field *pb.FieldDescriptorProto) string {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP, pb.FieldDescriptorProto_TYPE_ENUM:
+        if typ, ok := wellKnownTypes[field.GetTypeName()]; ok {
+            if typ[1] != "" {
+                f.use(typ[1])
+            }
+            return typ[0]
+        }
+        obj := c.gen.ObjectNamed(field.GetTypeName())
+        if descutil.IsGenerated(c.gen, obj.File().GetName()) && path.Dir(descutil.OutputName(c.gen, obj.File(), ".cue")) == f.dir {
+            return "#" + generator.CamelCaseSlice(obj.TypeName())
+        }
+        // The definitions of other packages are not imported.
+        if field.GetType() != pb.FieldDescriptorProto_TYPE_ENUM {
+            return "{...}"
+        }
+        if c.enumNumbers {
+            return "int32"
+        }
+        return "string"
+    }
+    return scalarTypes[field.GetType()]
+}
+
+// constraints returns the CUE constraints of a single value of field given
+// by the FieldRules rules.
+func (c *cue) constraints(f *cueFile, field *pb.FieldDescriptorProto, rules *wire.Message) []string {
+    typ := field.GetType()
+    b, ok := rules.Message(typeRules[typ])
+    if !ok {
+        return nil
+    }
+    sub := wire.NewMessage(b)
+    switch typ {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_BYTES:
+        return nil
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        if v, ok := sub.Varint(1); ok {
+            return []string{strconv.FormatBool(v != 0)}
+        }
+        return nil
+    case pb.FieldDescriptorProto_TYPE_STRING:
+        return c.stringConstraints(f, sub)
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        name := func(lits []string) []string {
+            if c.enumNumbers || lits == nil {
+                return lits
+            }
+            names := make([]string, len(lits))
+            for i, lit := range lits {
+                names[i] = lit
+                n, _ := strconv.Atoi(lit)
+                if enum, ok := c.gen.ObjectNamed(field.GetTypeName()).(*generator.EnumDescriptor); ok {
+                    for _, v := range enum.Value {
+                        if v.GetNumber() == int32(n) {
+                            names[i] = quote(v.GetName())
+                            break
+                        }
+                    }
+                }
+            }
+            return names
+        }
+        var cons []string
+        if lits := name(literals(typ, sub, 1)); lits != nil {
+            cons = append(cons, lits[len(lits)-1])
+        }
+        return append(cons, in(name(literals(typ, sub, 3)), name(literals(typ, sub, 4)))...)
+    }
+    return numberConstraints(typ, sub)
+}
+
+// numberConstraints returns the CUE constraints of a number of the field
+// type typ given by its rules.
+func numberConstraints(typ pb.FieldDescriptorProto_Type, rules *wire.Message) []string {
+    last := func(num int32) (string, bool) {
+        if xs := literals(typ, rules, num); xs != nil {
+            return xs[len(xs)-1], true
+        }
+        return "", false
+    }
+    var cons []string
+    if x, ok := last(1); ok {
+        cons = append(cons, x)
+    }
+    var lower, upper string
+    if x, ok := last(4); ok {
+        lower = ">" + x
+    } else if x, ok := last(5); ok {
+        lower = ">=" + x
+    }
+    if x, ok := last(2); ok {
+        upper = "<" + x
+    } else if x, ok := last(3); ok {
+        upper = "<=" + x
+    }
+    if lower != "" && upper != "" {
+        // As in protoc-gen-validate, an upper bound lower than the lower
+        // bound requires the value to be outside of the range.
+        lo, _ := strconv.ParseFloat(strings.TrimLeft(lower, "<>="), 64)
+        up, _ := strconv.ParseFloat(strings.TrimLeft(upper, "<>="), 64)
+        if up < lo {
+            cons = append(cons, "("+upper+" | "+lower+")")
+            lower, upper = "", ""
+        }
+    }
+    for _, bound := range []string{lower, upper} {
+        if bound != "" {
+            cons = append(cons, bound)
+        }
+    }
+    return append(cons, in(literals(typ, rules, 6), literals(typ, rules, 7))...)
+}
+
+// stringConstraints returns the CUE constraints of a string given by its
+// rules.
+func (c *cue) stringConstraints(f *cueFile, rules *wire.Message) []string {
+    var cons []string
+    if s, ok := rules.LengthDelimited(1); ok {
+        cons = append(cons, quote(string(s)))
+    }
+    lengths := []struct {
+        num int32
+        fns []string
+    }{
+        {19, []string{"MinRunes", "MaxRunes"}},
+        {2, []string{"MinRunes"}},
+        {3, []string{"MaxRunes"}},
+    }
+    for _, l := range lengths {
+        if n, ok := rules.Varint(l.num); ok {
+            for _, fn := range l.fns {
+                cons = append(cons, fmt.Sprintf("%s.%s(%d)", f.use("strings"), fn, n))
+            }
+        }
+    }
+    if p, ok := rules.LengthDelimited(6); ok {
+        cons = append(cons, "=~"+quote(string(p)))
+    }
+    affixes := []struct {
+        num int32
+        fn  string
+    }{
+        {7, "HasPrefix"},
+        {8, "HasSuffix"},
+        {9, "Contains"},
+    }
+    for _, a := range affixes {
+        if s, ok := rules.LengthDelimited(a.num); ok {
+            cons = append(cons, fmt.Sprintf("%s.%s(%s)", f.use("strings"), a.fn, quote(string(s))))
+        }
+    }
+    if s, ok := rules.LengthDelimited(23); ok {
+        cons = append(cons, "!~"+quote(regexp.QuoteMeta(string(s))))
+    }
+    cons = append(cons, in(quoted(rules.RepeatedLengthDelimited(10)), quoted(rules.RepeatedLengthDelimited(11)))...)
+
+    formats := []struct {
+        num        int32
+        constraint func() string
+    }{
+        {12, func() string { return "=~" + quote(emailPattern) }},
+        {14, func() string { return f.use("net") + ".IP" }},
+        {15, func() string { return f.use("net") + ".IPv4" }},
+        {16, func() string { return f.use("net") + ".IPv6" }},
+        {17, func() string { return f.use("net") + ".AbsURL" }},
+        {18, func() string { return f.use("net") + ".URL" }},
+        {22, func() string { return "=~" + quote(uuidPattern) }},
+    }
+    for _, format := range formats {
+        if b, _ := rules.Varint(format.num); b != 0 {
+            cons = append(cons, format.constraint())
+        }
+    }
+    return cons
+}
+
+// in returns the constraints that a value is one of the CUE literals of
+// values, if any, and none of notIn.
+func in(values, notIn []string) []string {
+    var cons []string
+    if len(values) > 0 {
+        cons = append(cons, "("+strings.Join(values, " | ")+")")
+    }
+    for _, v := range notIn {
+        cons = append(cons, "!="+v)
+    }
+    return cons
+}
+
+// constrain returns the CUE type typ constrained by cons.
+func constrain(typ string, cons []string) string {
+    if len(cons) == 0 {
+        return typ
+    }
+    if strings.Contains(typ, " | ") {
+        typ = "(" + typ + ")"
+    }
+    return strings.Join(append([]string{typ}, cons...), " & ")
+}
+
+// use records the use of the CUE package pkg by the definitions of f, and
+// returns its name.
+func (f *cueFile) use(pkg string) string {
+    f.imports[pkg] = true
+    return pkg
+}
+
+// fieldRules returns the serialized FieldRules of field, given by either
+// option, or an empty message.
+func fieldRules(field *pb.FieldDescriptorProto) *wire.Message {
+    opts := descutil.Options(field.Options)
+    for _, num := range []int32{pgvRulesOption, bufFieldOption} {
+        if b, ok := opts.Message(num); ok {
+            return wire.NewMessage(b)
+        }
+    }
+    return wire.NewMessage(nil)
+}
+
+// literals returns the values of the field num of rules, of the field type
+// typ, as CUE literals.
+func literals(typ pb.FieldDescriptorProto_Type, rules *wire.Message, num int32) []string {
+    var lits []string
+    switch typ {
+    case pb.FieldDescriptorProto_TYPE_FLOAT:
+        for _, x := range rules.RepeatedFixed32(num) {
+            lits = append(lits, strconv.FormatFloat(float64(math.Float32frombits(x)), 'g', -1, 32))
+        }
+    case pb.FieldDescriptorProto_TYPE_DOUBLE:
+        for _, x := range rules.RepeatedFixed64(num) {
+            lits = append(lits, strconv.FormatFloat(math.Float64frombits(x), 'g', -1, 64))
+        }
+    case pb.FieldDescriptorProto_TYPE_INT32, pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_ENUM:
+        for _, x := range rules.RepeatedVarint(num) {
+            lits = append(lits, strconv.FormatInt(int64(x), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_UINT64:
+        for _, x := range rules.RepeatedVarint(num) {
+            lits = append(lits, strconv.FormatUint(x, 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SINT64:
+        for _, x := range rules.RepeatedVarint(num) {
+            lits = append(lits, strconv.FormatInt(wire.DecodeZigzag64(x), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_FIXED32:
+        for _, x := range rules.RepeatedFixed32(num) {
+            lits = append(lits, strconv.FormatUint(uint64(x), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_SFIXED32:
+        for _, x := range rules.RepeatedFixed32(num) {
+            lits = append(lits, strconv.FormatInt(int64(int32(x)), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_FIXED64:
+        for _, x := range rules.RepeatedFixed64(num) {
+            lits = append(lits, strconv.FormatUint(x, 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_SFIXED64:
+        for _, x := range rules.RepeatedFixed64(num) {
+            lits = append(lits, strconv.FormatInt(int64(x), 10))
+        }
+    }
+    return lits
+}
+
+// quoted returns the values as CUE string literals.
+func quoted(values [][]byte) []string {
+    var lits []string
+    for _, b := range values {
+        lits = append(lits, quote(string(b)))
+    }
+    return lits
+}
+
+// quote returns s as a CUE string literal, escaped as in JSON, which also
+// escapes the backslashes of what would be interpolations.
+func quote(s string) string {
+    var b bytes.Buffer
+    enc := json.NewEncoder(&b)
+    enc.SetEscapeHTML(false)
+    enc.Encode(s)
+    return strings.TrimSuffix(b.String(), "\n")
+}
+
+// label returns name as a CUE label, quoted unless an identifier.
+func label(name string) string {
+    if identifier.MatchString(name) && !keywords[name] {
+        return name
+    }
+    return quote(name)
+}
+
+// writeComment writes comment as CUE comments, indented by indent.
+func writeComment(f *cueFile, indent, comment string) {
+    if comment == "" {
+        return
+    }
+    for _, line := range strings.Split(comment, "\n") {
+        fmt.Fprintf(f, "%s//%s\n", indent, strings.TrimRight(" "+line, " "))
+    }
+}
@@ -0,0 +1,170 @@
+// Package delimited outputs helpers streaming the messages with a varint
+// size prefix.
+//
+// For every message Foo it generates WriteDelimitedFoo(w io.Writer, m *Foo)
+// error, writing m prefixed by its size as a varint, and
+// ReadDelimitedFoo(r io.Reader) (*Foo, error), reading a message so written,
+// the framing of Java's writeDelimitedTo and parseDelimitedFrom, so that
+// files and sockets of messages need no hand-rolled framing. The first file
+// of the package also gets MaxDelimitedSize, the size beyond which the
+// messages read are rejected.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package delimited
+
+import (
+    "strconv"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// Paths for packages used by code generated in this file.
+const (
+    binaryPkgPath = "encoding/binary"
+    ioPkgPath     = "io"
+)
+
+// The names for packages imported in the generated code.
+// They may vary from the final path component of the import path
+// if the name is used by other packages.
+var (
+    binaryPkg string
+    ioPkg     string
+)
+
+func init() {
+    generator.RegisterPlugin(new(delimited))
+}
+
+// delimited is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the delimited stream helpers of the messages.
+type delimited struct {
+    gen *generator.Generator
+
+    usesIO     bool // the file being generated uses the io package
+    usesBinary bool // the file being generated uses the encoding/binary package
+}
+
+// Name returns the name of this plugin, "delimited".
+func (d *delimited) Name() string {
+    return "delimited"
+}
+
+// Init initializes the plugin.
+func (d *delimited) Init(gen *generator.Generator) {
+    d.gen = gen
+    binaryPkg = generator.RegisterUniquePackageName("binary", nil)
+    ioPkg = generator.RegisterUniquePackageName("io", nil)
+}
+
+// P forwards to d.gen.P.
+func (d *delimited) P(args ...interface{}) { d.gen.P(args...) }
+
+// Generate generates the delimited stream helpers of the messages in the
+// given file, and the shared helpers of the package in its first file.
+func (d *delimited) Generate(file *generator.FileDescriptor) {
+    d.usesIO, d.usesBinary = false, false
+    if !descutil.IsGenerated(d.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(d.gen, file) {
+        d.usesIO = true
+        typeName := d.gen.TypeName(msg)
+        d.P("// WriteDelimited", typeName, " writes m to w prefixed by its size as a varint, as")
+        d.P("// Java's writeDelimitedTo does.")
+        d.P("func WriteDelimited", typeName, "(w ", ioPkg, ".Writer, m *", typeName, ") error {")
+        d.P("return writeDelimited(w, m)")
+        d.P("}")
+        d.P()
+        d.P("// ReadDelimited", typeName, " reads from r a ", typeName, " prefixed by its size as a varint, as")
+        d.P("// written by WriteDelimited", typeName, " or Java's writeDelimitedTo. It returns io.EOF")
+        d.P("// if r is at its end, and io.ErrUnexpectedEOF if it ends within the message.")
+        d.P("func ReadDelimited", typeName, "(r ", ioPkg, ".Reader) (*", typeName, ", error) {")
+        d.P("m := new(", typeName, ")")
+        d.P("if err := readDelimited(r, m); err != nil {")
+        d.P("return nil, err")
+        d.P("}")
+        d.P("return m, nil")
+        d.P("}")
+        d.P()
+    }
+    if file.GetName() == d.gen.Request.FileToGenerate[0] {
+        d.generateHelpers()
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (d *delimited) GenerateImports(file *generator.FileDescriptor) {
+    if !d.usesIO {
+        return
+    }
+    d.P("import (")
+    if d.usesBinary {
+        d.P(binaryPkg, " ", strconv.Quote(binaryPkgPath))
+    }
+    d.P(ioPkg, " ", strconv.Quote(ioPkgPath))
+    d.P(")")
+    d.P()
+}
+
+// generateHelpers generates MaxDelimitedSize and the writeDelimited and
+// readDelimited helpers shared by the messages of the files to generate,
+// which share a Go package.
+func (d *delimited) generateHelpers() {
+    d.usesIO, d.usesBinary = true, true
+    proto := d.gen.Pkg["proto"]
+    d.P("// MaxDelimitedSize is the size, in bytes, beyond which the ReadDelimited")
+    d.P("// functions reject the messages rather than allocating their buffer.")
+    d.P("var MaxDelimitedSize = 64 << 20")
+    d.P()
+    d.P("// writeDelimited writes m to w prefixed by its size as a varint.")
+    d.P("func writeDelimited(w ", ioPkg, ".Writer, m ", proto, ".Message) error {")
+    d.P("b, err := ", proto, ".Marshal(m)")
+    d.P("if err != nil {")
+    d.P("return err")
+    d.P("}")
+    d.P("buf := make([]byte, ", binaryPkg, ".MaxVarintLen64, ", binaryPkg, ".MaxVarintLen64+len(b))")
+    d.P("buf = append(buf[:", binaryPkg, ".PutUvarint(buf, uint64(len(b)))], b...)")
+    d.P("_, err = w.Write(buf)")
+    d.P("return err")
+    d.P("}")
+    d.P()
+    d.P("// readDelimited reads from r into m a message prefixed by its size as a")
+    d.P("// varint, reading no byte beyond it.")
+    d.P("func readDelimited(r ", ioPkg, ".Reader, m ", proto, ".Message) error {")
+    d.P("br, ok := r.(", ioPkg, ".ByteReader)")
+    d.P("if !ok {")
+    d.P("br = &delimitedByteReader{r: r}")
+    d.P("}")
+    d.P("size, err := ", binaryPkg, ".ReadUvarint(br)")
+    d.P("if err != nil {")
+    d.P("return err")
+    d.P("}")
+    d.P("if size > uint64(MaxDelimitedSize) {")
+    d.P("return ", d.gen.Pkg["fmt"], `.Errorf("delimited message of %d bytes exceeds MaxDelimitedSize", size)`)
+    d.P("}")
+    d.P("b := make([]byte, size)")
+    d.P("if _, err := ", ioPkg, ".ReadFull(r, b); err != nil {")
+    d.P("if err == ", ioPkg, ".EOF {")
+    d.P("err = ", ioPkg, ".ErrUnexpectedEOF")
+    d.P("}")
+    d.P("return err")
+    d.P("}")
+    d.P("return ", proto, ".Unmarshal(b, m)")
+    d.P("}")
+    d.P()
+    d.P("// delimitedByteReader reads the bytes of r one at a time, so that no byte")
+    d.P("// beyond the size prefix is consumed.")
+    d.P("type delimitedByteReader struct {")
+    d.P("r ", ioPkg, ".Reader")
+    d.P("b [1]byte")
+    d.P("}")
+    d.P()
+    d.P("func (d *delimitedByteReader) ReadByte() (byte, error) {")
+    d.P("_, err := ", ioPkg, ".ReadFull(d.r, d.b[:])")
+    d.P("return d.b[0], err")
+    d.P("}")
+    d.P()
+}
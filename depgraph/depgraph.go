@@ -0,0 +1,167 @@
+// Package depgraph outputs the dependency graph of the services.
+//
+// The methods declare the services they call with a custom method option
+// named depends_on, e.g. option (depends_on) = "pkg.OtherService", which
+// may be repeated. The graph of the services of all the files to generate
+// is written, next to the first generated Go file, as dependencies.dot for
+// Graphviz and dependencies.json for other tools.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package depgraph
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// optionName is the name of the method option declaring dependencies.
+const optionName = "depends_on"
+
+func init() {
+    generator.RegisterPlugin(new(depgraph))
+}
+
+// depgraph is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the dependency graph of the services.
+type depgraph struct {
+    gen *generator.Generator
+}
+
+// service is a node of the graph, as written in dependencies.json.
+type service struct {
+    Name    string   `json:"name"` // fully-qualified, without leading dot
+    File    string   `json:"file,omitempty"`
+    Methods []method `json:"methods,omitempty"`
+}
+
+// method is a method of a service and its dependencies.
+type method struct {
+    Name      string   `json:"name"`
+    DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// edge is an edge of the graph, from a service to one it depends on.
+type edge struct {
+    From   string `json:"from"`
+    To     string `json:"to"`
+    Method string `json:"method"`
+}
+
+// Name returns the name of this plugin, "depgraph".
+func (d *depgraph) Name() string {
+    return "depgraph"
+}
+
+// Init initializes the plugin.
+func (d *depgraph) Init(gen *generator.Generator) {
+    d.gen = gen
+}
+
+// Generate writes the dependency graph when generating the first file to
+// generate.
+func (d *depgraph) Generate(file *generator.FileDescriptor) {
+    if file.GetName() != d.gen.Request.FileToGenerate[0] {
+        return
+    }
+    services, edges := d.graph()
+    dir := path.Dir(descutil.OutputName(d.gen, file.FileDescriptorProto, ".pb.go"))
+    descutil.AddFile(d.gen, path.Join(dir, "dependencies.dot"), dot(services, edges))
+
+    b, err := json.MarshalIndent(struct {
+        Services []service `json:"services"`
+        Edges    []edge    `json:"edges"`
+    }{services, edges}, "", "  ")
+    if err != nil {
+        d.gen.Error(err, "failed to encode the dependency graph")
+    }
+    descutil.AddFile(d.gen, path.Join(dir, "dependencies.json"), string(b)+"\n")
+}
+
+// GenerateImports generates the import declaration for this file.
+func (d *depgraph) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// graph returns the services of the files to generate and the services
+// they depend on, and the edges between them.
+func (d *depgraph) graph() ([]service, []edge) {
+    ext := descutil.Extension(d.gen, ".google.protobuf.MethodOptions", optionName)
+    var services []service
+    var edges []edge
+    known := make(map[string]bool)
+    for _, name := range d.gen.Request.FileToGenerate {
+        file := d.fileNamed(name)
+        for _, s := range file.Service {
+            node := service{Name: s.GetName(), File: name}
+            if pkg := file.GetPackage(); pkg != "" {
+                node.Name = pkg + "." + node.Name
+            }
+            for _, m := range s.Method {
+                meth := method{Name: m.GetName()}
+                if ext != nil {
+                    for _, v := range descutil.Options(m.Options).RepeatedLengthDelimited(ext.GetNumber()) {
+                        dep := strings.TrimPrefix(string(v), ".")
+                        meth.DependsOn = append(meth.DependsOn, dep)
+                        edges = append(edges, edge{node.Name, dep, m.GetName()})
+                    }
+                }
+                node.Methods = append(node.Methods, meth)
+            }
+            known[node.Name] = true
+            services = append(services, node)
+        }
+    }
+    // The services depended on outside of the files to generate are nodes
+    // too, without details.
+    var external []string
+    for _, e := range edges {
+        if !known[e.To] {
+            known[e.To] = true
+            external = append(external, e.To)
+        }
+    }
+    sort.Strings(external)
+    for _, name := range external {
+        services = append(services, service{Name: name})
+    }
+    return services, edges
+}
+
+// fileNamed returns the descriptor of the file of the request named name.
+func (d *depgraph) fileNamed(name string) *pb.FileDescriptorProto {
+    for _, f := range d.gen.Request.ProtoFile {
+        if f.GetName() == name {
+            return f
+        }
+    }
+    d.gen.Fail("no descriptor for generated file", name)
+    return nil
+}
+
+// dot returns the graph in the Graphviz DOT language.
+func dot(services []service, edges []edge) string {
+    var b bytes.Buffer
+    b.WriteString("// Code generated by protoc-gen-go. DO NOT EDIT.\n\n")
+    b.WriteString("digraph dependencies {\n")
+    for _, s := range services {
+        if s.File == "" {
+            fmt.Fprintf(&b, "    %s [style=dashed];\n", strconv.Quote(s.Name))
+        } else {
+            fmt.Fprintf(&b, "    %s;\n", strconv.Quote(s.Name))
+        }
+    }
+    for _, e := range edges {
+        fmt.Fprintf(&b, "    %s -> %s [label=%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.Method))
+    }
+    b.WriteString("}\n")
+    return b.String()
+}
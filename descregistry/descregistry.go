@@ -0,0 +1,139 @@
+// Package descregistry is the registry of the generated files, for the
+// runtime tooling introspecting their schemas, such as dynamic dispatch,
+// reflection services or schema exports.
+//
+// The code generated by the descset plugin registers the name of each file
+// when its package is initialized. The descriptors are the gzipped
+// FileDescriptorProtos the generated code registers with proto.RegisterFile,
+// which the files imported register too, so that a file comes with the
+// files it imports, transitively.
+package descregistry
+
+import (
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io/ioutil"
+    "sort"
+    "sync"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+var (
+    filesMu sync.Mutex
+    files   = make(map[string]bool)
+)
+
+// Register registers the generated file named name, e.g. "foo/bar.proto".
+func Register(name string) {
+    filesMu.Lock()
+    defer filesMu.Unlock()
+    files[name] = true
+}
+
+// Files returns the names of the files registered, sorted.
+func Files() []string {
+    filesMu.Lock()
+    defer filesMu.Unlock()
+    names := make([]string, 0, len(files))
+    for name := range files {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// FileDescriptor returns the FileDescriptorProto of the file named name, as
+// registered with proto.RegisterFile, whether it was registered with
+// Register or imported by a file registered.
+func FileDescriptor(name string) (*pb.FileDescriptorProto, error) {
+    gz := proto.FileDescriptor(name)
+    if gz == nil {
+        return nil, fmt.Errorf("descregistry: no descriptor of %s", name)
+    }
+    r, err := gzip.NewReader(bytes.NewReader(gz))
+    if err != nil {
+        return nil, fmt.Errorf("descregistry: bad descriptor of %s: %v", name, err)
+    }
+    data, err := ioutil.ReadAll(r)
+    if err != nil {
+        return nil, fmt.Errorf("descregistry: bad descriptor of %s: %v", name, err)
+    }
+    fd := new(pb.FileDescriptorProto)
+    if err := proto.Unmarshal(data, fd); err != nil {
+        return nil, fmt.Errorf("descregistry: bad descriptor of %s: %v", name, err)
+    }
+    return fd, nil
+}
+
+// FileDescriptorSet returns the FileDescriptorSet of the files named and of
+// the files they import, transitively, each file once and after the files
+// it imports, as protoc --include_imports writes it.
+func FileDescriptorSet(names ...string) (*pb.FileDescriptorSet, error) {
+    set := new(pb.FileDescriptorSet)
+    seen := make(map[string]bool)
+    var add func(name string) error
+    add = func(name string) error {
+        if seen[name] {
+            return nil
+        }
+        seen[name] = true
+        fd, err := FileDescriptor(name)
+        if err != nil {
+            return err
+        }
+        for _, dep := range fd.Dependency {
+            if err := add(dep); err != nil {
+                return err
+            }
+        }
+        set.File = append(set.File, fd)
+        return nil
+    }
+    for _, name := range names {
+        if err := add(name); err != nil {
+            return nil, err
+        }
+    }
+    return set, nil
+}
+
+// PackageFileDescriptorSet returns the FileDescriptorSet of the files
+// registered of the protobuf package pkg, e.g. "foo.bar", and of the files
+// they import, as FileDescriptorSet does.
+func PackageFileDescriptorSet(pkg string) (*pb.FileDescriptorSet, error) {
+    var names []string
+    for _, name := range Files() {
+        fd, err := FileDescriptor(name)
+        if err != nil {
+            return nil, err
+        }
+        if fd.GetPackage() == pkg {
+            names = append(names, name)
+        }
+    }
+    return FileDescriptorSet(names...)
+}
+
+// MarshalFileDescriptorSet returns the FileDescriptorSet of the files named,
+// as FileDescriptorSet does, serialized and, if gzipped is true, compressed
+// with gzip.
+func MarshalFileDescriptorSet(gzipped bool, names ...string) ([]byte, error) {
+    set, err := FileDescriptorSet(names...)
+    if err != nil {
+        return nil, err
+    }
+    data, err := proto.Marshal(set)
+    if err != nil || !gzipped {
+        return data, err
+    }
+    var buf bytes.Buffer
+    w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+    w.Write(data)
+    if err := w.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+// Package descset outputs accessors of the descriptors of the generated
+// files, and their registration with the descregistry package.
+//
+// For every file foo.proto it generates FooFileDescriptor()
+// (*descriptor.FileDescriptorProto, error), returning the descriptor of the
+// file, and FooFileDescriptorSet(gzipped bool) ([]byte, error), returning the
+// serialized FileDescriptorSet of the file and of the files it imports,
+// gzipped if asked, and registers the file with descregistry when its
+// package is initialized, so that runtime tooling can introspect the
+// schemas of all the files linked in to the binary.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package descset
+
+import (
+    "path"
+    "strconv"
+    "strings"
+    "unicode"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const (
+    descregistryPkgPath = "github.com/lleveque/protoc-gen-go/descregistry"
+    descriptorPkgPath   = "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+var (
+    // descregistryPkg is the name of the descregistry package in the
+    // generated code, which may vary from "descregistry" if the name is
+    // used by other packages.
+    descregistryPkg string
+    // descriptorPkg is the name of the descriptor package in the generated
+    // code.
+    descriptorPkg string
+)
+
+func init() {
+    generator.RegisterPlugin(new(descset))
+}
+
+// descset is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the descriptor accessors of the files.
+type descset struct {
+    gen *generator.Generator
+
+    used bool // the file being generated uses the descregistry package
+}
+
+// Name returns the name of this plugin, "descset".
+func (d *descset) Name() string {
+    return "descset"
+}
+
+// Init initializes the plugin.
+func (d *descset) Init(gen *generator.Generator) {
+    d.gen = gen
+    descregistryPkg = generator.RegisterUniquePackageName("descregistry", nil)
+    descriptorPkg = generator.RegisterUniquePackageName("descriptor", nil)
+}
+
+// P forwards to d.gen.P.
+func (d *descset) P(args ...interface{}) { d.gen.P(args...) }
+
+// Generate generates the descriptor accessors of the given file.
+func (d *descset) Generate(file *generator.FileDescriptor) {
+    d.used = false
+    if !descutil.IsGenerated(d.gen, file.GetName()) {
+        return
+    }
+    d.used = true
+    name := strconv.Quote(file.GetName())
+    prefix := filePrefix(file.GetName())
+    d.P("func init() { ", descregistryPkg, ".Register(", name, ") }")
+    d.P()
+    d.P("// ", prefix, "FileDescriptor returns the FileDescriptorProto of ", file.GetName(), ".")
+    d.P("func ", prefix, "FileDescriptor() (*", descriptorPkg, ".FileDescriptorProto, error) {")
+    d.P("return ", descregistryPkg, ".FileDescriptor(", name, ")")
+    d.P("}")
+    d.P()
+    d.P("// ", prefix, "FileDescriptorSet returns the FileDescriptorSet of ", file.GetName(), " and of")
+    d.P("// the files it imports, transitively, serialized and, if gzipped is true,")
+    d.P("// compressed with gzip.")
+    d.P("func ", prefix, "FileDescriptorSet(gzipped bool) ([]byte, error) {")
+    d.P("return ", descregistryPkg, ".MarshalFileDescriptorSet(gzipped, ", name, ")")
+    d.P("}")
+    d.P()
+}
+
+// GenerateImports generates the import declaration for this file.
+func (d *descset) GenerateImports(file *generator.FileDescriptor) {
+    if !d.used {
+        return
+    }
+    d.P("import ", descregistryPkg, " ", strconv.Quote(descregistryPkgPath))
+    d.P("import ", descriptorPkg, " ", strconv.Quote(descriptorPkgPath))
+    d.P()
+}
+
+// filePrefix returns the prefix of the accessors of the file named name,
+// its base name without extension in CamelCase, e.g. FooBar for
+// x/foo_bar.proto.
+func filePrefix(name string) string {
+    base := path.Base(name)
+    base = strings.TrimSuffix(base, path.Ext(base))
+    base = strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return r
+        }
+        return '_'
+    }, base)
+    return generator.CamelCase(base)
+}
@@ -0,0 +1,337 @@
+// Package diff outputs structural comparisons of the messages.
+//
+// For every message Foo it generates a Diff(other *Foo) []FieldChange
+// method returning the changes of the fields of a Foo in other, with their
+// paths and old and new values, for audit-logging the updates. Message
+// fields are diffed in turn, repeated fields by index and maps by key. The
+// FieldChange type is generated in the first file of the package.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package diff
+
+import (
+    "sort"
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// importPaths are the packages the generated code may import, besides
+// the proto and fmt packages imported by the generator.
+var importPaths = []string{"bytes", "sort"}
+
+func init() {
+    generator.RegisterPlugin(new(diff))
+}
+
+// diff is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the Diff methods of the messages of
+// each file.
+type diff struct {
+    gen *generator.Generator
+
+    pkgNames map[string]string // package names by import path
+    used     map[string]bool   // import paths used by the file being generated
+}
+
+// Name returns the name of this plugin, "diff".
+func (d *diff) Name() string {
+    return "diff"
+}
+
+// Init initializes the plugin.
+func (d *diff) Init(gen *generator.Generator) {
+    d.gen = gen
+    d.pkgNames = make(map[string]string)
+    for _, path := range importPaths {
+        d.pkgNames[path] = generator.RegisterUniquePackageName(path, nil)
+    }
+}
+
+// P forwards to d.gen.P.
+func (d *diff) P(args ...interface{}) { d.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (d *diff) pkg(importPath string) string {
+    d.used[importPath] = true
+    return d.pkgNames[importPath]
+}
+
+// Generate generates the Diff methods of the messages in the given file.
+func (d *diff) Generate(file *generator.FileDescriptor) {
+    d.used = make(map[string]bool)
+    if !descutil.IsGenerated(d.gen, file.GetName()) {
+        return
+    }
+    if file.GetName() == d.gen.Request.FileToGenerate[0] {
+        d.generateFieldChange()
+    }
+    for _, msg := range descutil.Messages(d.gen, file) {
+        d.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (d *diff) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range d.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    d.P("import (")
+    for _, path := range paths {
+        d.P(d.pkgNames[path], " ", strconv.Quote(path))
+    }
+    d.P(")")
+    d.P()
+}
+
+// generateFieldChange generates, once per package, the type of the changes
+// returned by the Diff methods and the joining of their paths.
+func (d *diff) generateFieldChange() {
+    d.P("// FieldChange is a change of a field of a message, as returned by its Diff")
+    d.P("// method.")
+    d.P("type FieldChange struct {")
+    d.P("// Path is the path of the field in the message, the names of the fields")
+    d.P("// of the nested messages separated by dots, with the indexes and keys of")
+    d.P(`// the elements of repeated and map fields in brackets, e.g. items[2].labels["env"].`)
+    d.P("// It is empty for the whole message.")
+    d.P("Path string")
+    d.P("// Old and New are the values of the field in the old and new messages, nil")
+    d.P("// if it is unset, missing from the list or map, or another field of its")
+    d.P("// oneof is set.")
+    d.P("Old, New interface{}")
+    d.P("}")
+    d.P()
+    d.P("// _diffPath returns the path of the field name of the message at path.")
+    d.P("func _diffPath(path, name string) string {")
+    d.P(`if path == "" {`)
+    d.P("return name")
+    d.P("}")
+    d.P(`return path + "." + name`)
+    d.P("}")
+    d.P()
+}
+
+// generateMessage generates the Diff method of msg.
+func (d *diff) generateMessage(msg *generator.Descriptor) {
+    typeName := d.gen.TypeName(msg)
+    d.P("// Diff returns the changes of the fields of m in other, in the order of the")
+    d.P("// fields, the oneofs last, or nil if m and other are equal, as proto.Equal")
+    d.P("// compares them. The method expression (*", typeName, ").Diff is a")
+    d.P("// func(a, b *", typeName, ") []FieldChange.")
+    d.P("func (m *", typeName, ") Diff(other *", typeName, ") []FieldChange {")
+    d.P(`return m.diff("", other, nil)`)
+    d.P("}")
+    d.P()
+    d.P("// diff appends the changes of the fields of m in other to changes, their")
+    d.P("// paths prefixed by the one of m. The changes of the unknown fields and")
+    d.P("// extensions, not diffed, are a change of the whole message.")
+    d.P("func (m *", typeName, ") diff(path string, other *", typeName, ", changes []FieldChange) []FieldChange {")
+    d.P("if m == nil || other == nil {")
+    d.P("if m != other {")
+    d.generateChange("path", "m", "other")
+    d.P("}")
+    d.P("return changes")
+    d.P("}")
+    proto2 := !descutil.IsProto3(msg)
+    if proto2 {
+        d.P("n := len(changes)")
+    }
+    for _, field := range msg.Field {
+        if field.OneofIndex != nil {
+            continue
+        }
+        d.generateField(msg, field)
+    }
+    for i, oneof := range msg.OneofDecl {
+        d.generateOneof(msg, int32(i), generator.CamelCase(oneof.GetName()))
+    }
+    if proto2 {
+        cond := "!" + d.pkg("bytes") + ".Equal(m.XXX_unrecognized, other.XXX_unrecognized)"
+        if len(msg.ExtensionRange) > 0 {
+            // The extensions can only be compared by reflection.
+            cond = "!" + d.gen.Pkg["proto"] + ".Equal(m, other)"
+        }
+        d.P("if len(changes) == n && ", cond, " {")
+        d.P("changes = append(changes, FieldChange{path, m, other})")
+        d.P("}")
+    }
+    d.P("return changes")
+    d.P("}")
+    d.P()
+}
+
+// generateField generates the diff of field of m and other.
+func (d *diff) generateField(msg *generator.Descriptor, field *pb.FieldDescriptorProto) {
+    fieldName := generator.CamelCase(field.GetName())
+    a, b := "m."+fieldName, "other."+fieldName
+    path := "_diffPath(path, " + strconv.Quote(field.GetName()) + ")"
+    goType, _ := d.gen.GoType(msg, field)
+    switch {
+    case descutil.MapEntry(d.gen, field) != nil:
+        entry := descutil.MapEntry(d.gen, field)
+        keyType, _ := d.gen.GoType(entry, entry.Field[0])
+        keyType = trimStar(keyType)
+        less := "keys[i] < keys[j]"
+        if keyType == "bool" {
+            less = "!keys[i] && keys[j]"
+        }
+        verb := "%v"
+        if keyType == "string" {
+            verb = "%q"
+        }
+        d.P("if len(", a, ") > 0 || len(", b, ") > 0 {")
+        d.P("keys := make([]", keyType, ", 0, len(", a, ")+len(", b, "))")
+        d.P("for k := range ", a, " {")
+        d.P("keys = append(keys, k)")
+        d.P("}")
+        d.P("for k := range ", b, " {")
+        d.P("if _, ok := ", a, "[k]; !ok {")
+        d.P("keys = append(keys, k)")
+        d.P("}")
+        d.P("}")
+        d.P(d.pkg("sort"), ".Slice(keys, func(i, j int) bool { return ", less, " })")
+        d.P("for _, k := range keys {")
+        d.P("p := ", d.gen.Pkg["fmt"], `.Sprintf("%s[`, verb, `]", `, path, ", k)")
+        d.P("v, inOld := ", a, "[k]")
+        d.P("w, inNew := ", b, "[k]")
+        d.P("switch {")
+        d.P("case !inNew:")
+        d.P("changes = append(changes, FieldChange{p, v, nil})")
+        d.P("case !inOld:")
+        d.P("changes = append(changes, FieldChange{p, nil, w})")
+        d.P("default:")
+        d.generateValue(entry.Field[1], "p", "v", "w", false)
+        d.P("}")
+        d.P("}")
+        d.P("}")
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        d.P("for i := 0; i < len(", a, ") || i < len(", b, "); i++ {")
+        d.P("p := ", d.gen.Pkg["fmt"], `.Sprintf("%s[%d]", `, path, ", i)")
+        d.P("switch {")
+        d.P("case i >= len(", b, "):")
+        d.P("changes = append(changes, FieldChange{p, ", a, "[i], nil})")
+        d.P("case i >= len(", a, "):")
+        d.P("changes = append(changes, FieldChange{p, nil, ", b, "[i]})")
+        d.P("default:")
+        d.generateValue(field, "p", a+"[i]", b+"[i]", descutil.IsProto3(msg))
+        d.P("}")
+        d.P("}")
+    case goType[0] == '*' && isValue(field):
+        // Optional fields of proto2 point to their value, and only differ
+        // if either is set and the values differ.
+        d.P("if (", a, " == nil) != (", b, " == nil) || ", a, " != nil && *", a, " != *", b, " {")
+        d.P("c := FieldChange{Path: ", path, "}")
+        d.P("if ", a, " != nil {")
+        d.P("c.Old = *", a)
+        d.P("}")
+        d.P("if ", b, " != nil {")
+        d.P("c.New = *", b)
+        d.P("}")
+        d.P("changes = append(changes, c)")
+        d.P("}")
+    default:
+        d.generateValue(field, path, a, b, descutil.IsProto3(msg))
+    }
+}
+
+// generateOneof generates the diff of the oneof of the given index and name
+// of m and other: the values of the same field are diffed, and otherwise the
+// field of m is removed and the field of other added.
+func (d *diff) generateOneof(msg *generator.Descriptor, index int32, name string) {
+    typeName := d.gen.TypeName(msg)
+    var fields []*pb.FieldDescriptorProto
+    for _, field := range msg.Field {
+        if field.OneofIndex != nil && field.GetOneofIndex() == index {
+            fields = append(fields, field)
+        }
+    }
+    d.P("switch v := m.", name, ".(type) {")
+    for _, field := range fields {
+        fieldName := generator.CamelCase(field.GetName())
+        wrapper := typeName + "_" + fieldName
+        path := "_diffPath(path, " + strconv.Quote(field.GetName()) + ")"
+        d.P("case *", wrapper, ":")
+        d.P("if w, ok := other.", name, ".(*", wrapper, "); ok {")
+        d.generateValue(field, path, "v."+fieldName, "w."+fieldName, descutil.IsProto3(msg))
+        d.P("} else {")
+        d.P("changes = append(changes, FieldChange{", path, ", v.", fieldName, ", nil})")
+        d.P("}")
+    }
+    d.P("}")
+    d.P("switch w := other.", name, ".(type) {")
+    for _, field := range fields {
+        fieldName := generator.CamelCase(field.GetName())
+        wrapper := typeName + "_" + fieldName
+        d.P("case *", wrapper, ":")
+        d.P("if _, ok := m.", name, ".(*", wrapper, "); !ok {")
+        d.P("changes = append(changes, FieldChange{_diffPath(path, ", strconv.Quote(field.GetName()), "), nil, w.", fieldName, "})")
+        d.P("}")
+    }
+    d.P("}")
+}
+
+// generateValue generates the diff of the single values a and b of field
+// at path. The empty bytes of proto3 fields are equal to nil ones.
+func (d *diff) generateValue(field *pb.FieldDescriptorProto, path, a, b string, proto3 bool) {
+    switch {
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES:
+        if proto3 {
+            d.P("if !", d.pkg("bytes"), ".Equal(", a, ", ", b, ") {")
+            d.P("changes = append(changes, FieldChange{", path, ", ", a, ", ", b, "})")
+            d.P("}")
+            return
+        }
+        d.P("if (", a, " == nil) != (", b, " == nil) || !", d.pkg("bytes"), ".Equal(", a, ", ", b, ") {")
+        d.generateChange(path, a, b)
+        d.P("}")
+    case isValue(field):
+        d.P("if ", a, " != ", b, " {")
+        d.P("changes = append(changes, FieldChange{", path, ", ", a, ", ", b, "})")
+        d.P("}")
+    case descutil.IsGenerated(d.gen, d.gen.ObjectNamed(field.GetTypeName()).File().GetName()):
+        d.P("changes = ", a, ".diff(", path, ", ", b, ", changes)")
+    default:
+        d.P("if !", d.gen.Pkg["proto"], ".Equal(", a, ", ", b, ") {")
+        d.generateChange(path, a, b)
+        d.P("}")
+    }
+}
+
+// generateChange generates the append of the change of the nilable values
+// a and b at path to changes, the nil values being left untyped.
+func (d *diff) generateChange(path, a, b string) {
+    d.P("c := FieldChange{Path: ", path, "}")
+    d.P("if ", a, " != nil {")
+    d.P("c.Old = ", a)
+    d.P("}")
+    d.P("if ", b, " != nil {")
+    d.P("c.New = ", b)
+    d.P("}")
+    d.P("changes = append(changes, c)")
+}
+
+// isValue reports whether the values of field are compared with ==.
+func isValue(field *pb.FieldDescriptorProto) bool {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP, pb.FieldDescriptorProto_TYPE_BYTES:
+        return false
+    }
+    return true
+}
+
+// trimStar returns the Go type typ without its leading star, if any.
+func trimStar(typ string) string {
+    if typ != "" && typ[0] == '*' {
+        return typ[1:]
+    }
+    return typ
+}
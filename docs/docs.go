@@ -0,0 +1,279 @@
+// Package docs outputs Markdown documentation of the .proto packages.
+//
+// For every package of the files to generate it writes a Markdown file,
+// named after the package, next to the Go file of its first file. It
+// documents the services and their methods, the messages and their fields,
+// and the enums and their values, with the comments attached to them in
+// the .proto files. Types of the package link to their documentation.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package docs
+
+import (
+    "bytes"
+    "fmt"
+    "path"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+func init() {
+    generator.RegisterPlugin(new(docs))
+}
+
+// docs is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates Markdown documentation.
+type docs struct {
+    gen *generator.Generator
+
+    types      descutil.TypeSet // types of the request, which the sibling files need not import
+    documented map[string]bool  // fully-qualified names of the types of the page being generated
+}
+
+// scalarTypes are the names of the scalar types in the .proto language.
+var scalarTypes = map[pb.FieldDescriptorProto_Type]string{
+    pb.FieldDescriptorProto_TYPE_DOUBLE:   "double",
+    pb.FieldDescriptorProto_TYPE_FLOAT:    "float",
+    pb.FieldDescriptorProto_TYPE_INT64:    "int64",
+    pb.FieldDescriptorProto_TYPE_UINT64:   "uint64",
+    pb.FieldDescriptorProto_TYPE_INT32:    "int32",
+    pb.FieldDescriptorProto_TYPE_FIXED64:  "fixed64",
+    pb.FieldDescriptorProto_TYPE_FIXED32:  "fixed32",
+    pb.FieldDescriptorProto_TYPE_BOOL:     "bool",
+    pb.FieldDescriptorProto_TYPE_STRING:   "string",
+    pb.FieldDescriptorProto_TYPE_BYTES:    "bytes",
+    pb.FieldDescriptorProto_TYPE_UINT32:   "uint32",
+    pb.FieldDescriptorProto_TYPE_SFIXED32: "sfixed32",
+    pb.FieldDescriptorProto_TYPE_SFIXED64: "sfixed64",
+    pb.FieldDescriptorProto_TYPE_SINT32:   "sint32",
+    pb.FieldDescriptorProto_TYPE_SINT64:   "sint64",
+}
+
+// Name returns the name of this plugin, "docs".
+func (d *docs) Name() string {
+    return "docs"
+}
+
+// Init initializes the plugin.
+func (d *docs) Init(gen *generator.Generator) {
+    d.gen = gen
+}
+
+// Generate writes the documentation of the packages of the files to
+// generate when generating the first one.
+func (d *docs) Generate(file *generator.FileDescriptor) {
+    if file.GetName() != d.gen.Request.FileToGenerate[0] {
+        return
+    }
+    d.types = descutil.NewTypeSet(d.gen)
+    var pkgs []string
+    files := make(map[string][]*generator.FileDescriptor)
+    for _, name := range d.gen.Request.FileToGenerate {
+        f := d.fileNamed(name)
+        if _, ok := files[f.GetPackage()]; !ok {
+            pkgs = append(pkgs, f.GetPackage())
+        }
+        files[f.GetPackage()] = append(files[f.GetPackage()], f)
+    }
+    for _, pkg := range pkgs {
+        d.generatePackage(pkg, files[pkg])
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (d *docs) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// fileNamed returns the file named name.
+func (d *docs) fileNamed(name string) *generator.FileDescriptor {
+    for _, f := range d.gen.Request.ProtoFile {
+        if f.GetName() == name {
+            return d.gen.FileOf(f)
+        }
+    }
+    d.gen.Fail("no file named", name)
+    return nil
+}
+
+// generatePackage writes the documentation of the package pkg, defined in
+// files, named after it, or after its first file if it has no name.
+func (d *docs) generatePackage(pkg string, files []*generator.FileDescriptor) {
+    prefix := "."
+    if pkg != "" {
+        prefix += pkg + "."
+    }
+    d.documented = make(map[string]bool)
+    for _, f := range files {
+        for _, msg := range descutil.FileMessages(f.FileDescriptorProto) {
+            d.documented[prefix+strings.Join(msg.Name, ".")] = true
+        }
+        for _, enum := range descutil.FileEnums(f.FileDescriptorProto) {
+            d.documented[prefix+strings.Join(enum.Name, ".")] = true
+        }
+    }
+
+    var b bytes.Buffer
+    b.WriteString("<!-- Code generated by protoc-gen-go. DO NOT EDIT. -->\n\n")
+    title := pkg
+    if title == "" {
+        title = strings.TrimSuffix(path.Base(files[0].GetName()), path.Ext(files[0].GetName()))
+    }
+    fmt.Fprintf(&b, "# %s\n\n", title)
+    for _, f := range files {
+        writeComments(&b, descutil.LeadingComments(f.FileDescriptorProto, "2")) // 2 means package.
+    }
+    var names []string
+    for _, f := range files {
+        names = append(names, "`"+f.GetName()+"`")
+    }
+    fmt.Fprintf(&b, "Defined in %s.\n\n", strings.Join(names, ", "))
+
+    for _, f := range files {
+        for i, service := range f.Service {
+            d.writeService(&b, f, service, i)
+        }
+    }
+    for _, f := range files {
+        for _, msg := range descutil.FileMessages(f.FileDescriptorProto) {
+            d.writeMessage(&b, msg)
+        }
+    }
+    for _, f := range files {
+        for _, enum := range descutil.FileEnums(f.FileDescriptorProto) {
+            writeEnum(&b, enum)
+        }
+    }
+
+    name := path.Join(path.Dir(descutil.OutputName(d.gen, files[0].FileDescriptorProto, ".pb.go")), title+".md")
+    descutil.AddFile(d.gen, name, strings.TrimSuffix(b.String(), "\n"))
+}
+
+// writeService writes the documentation of service, the index-th of file.
+func (d *docs) writeService(b *bytes.Buffer, file *generator.FileDescriptor, service *pb.ServiceDescriptorProto, index int) {
+    path := fmt.Sprintf("6,%d", index) // 6 means service.
+    fmt.Fprintf(b, "## Service %s\n\n", service.GetName())
+    writeComments(b, descutil.LeadingComments(file.FileDescriptorProto, path))
+    if len(service.Method) == 0 {
+        return
+    }
+    b.WriteString("| Method | Request | Response | Description |\n")
+    b.WriteString("| --- | --- | --- | --- |\n")
+    for i, method := range service.Method {
+        in, out := d.typeLink(method.GetInputType()), d.typeLink(method.GetOutputType())
+        if method.GetClientStreaming() {
+            in = "stream " + in
+        }
+        if method.GetServerStreaming() {
+            out = "stream " + out
+        }
+        description := descutil.LeadingComments(file.FileDescriptorProto, fmt.Sprintf("%s,2,%d", path, i)) // 2 means method in a service.
+        if method.GetOptions().GetDeprecated() {
+            description = strings.TrimSpace("Deprecated. " + description)
+        }
+        fmt.Fprintf(b, "| `%s` | %s | %s | %s |\n", method.GetName(), in, out, cell(description))
+    }
+    b.WriteString("\n")
+}
+
+// writeMessage writes the documentation of msg.
+func (d *docs) writeMessage(b *bytes.Buffer, msg *descutil.Type) {
+    name := strings.Join(msg.Name, ".")
+    fmt.Fprintf(b, "<a name=\"%s\"></a>\n\n", anchor(msg.File.GetPackage(), name))
+    fmt.Fprintf(b, "## %s\n\n", name)
+    path := msg.Path
+    writeComments(b, descutil.LeadingComments(msg.File, path))
+    if len(msg.Message.Field) == 0 {
+        return
+    }
+    b.WriteString("| Field | Number | Type | Description |\n")
+    b.WriteString("| --- | --- | --- | --- |\n")
+    for i, field := range msg.Message.Field {
+        description := descutil.LeadingComments(msg.File, fmt.Sprintf("%s,2,%d", path, i)) // 2 means field in a message.
+        if field.OneofIndex != nil {
+            oneof := msg.Message.OneofDecl[field.GetOneofIndex()].GetName()
+            description = strings.TrimSpace(fmt.Sprintf("One of `%s`. %s", oneof, description))
+        }
+        if field.GetOptions().GetDeprecated() {
+            description = strings.TrimSpace("Deprecated. " + description)
+        }
+        fmt.Fprintf(b, "| `%s` | %d | %s | %s |\n", field.GetName(), field.GetNumber(), d.fieldType(field), cell(description))
+    }
+    b.WriteString("\n")
+}
+
+// writeEnum writes the documentation of enum.
+func writeEnum(b *bytes.Buffer, enum *descutil.Type) {
+    name := strings.Join(enum.Name, ".")
+    fmt.Fprintf(b, "<a name=\"%s\"></a>\n\n", anchor(enum.File.GetPackage(), name))
+    fmt.Fprintf(b, "## %s\n\n", name)
+    path := enum.Path
+    writeComments(b, descutil.LeadingComments(enum.File, path))
+    b.WriteString("| Name | Number | Description |\n")
+    b.WriteString("| --- | --- | --- |\n")
+    for i, v := range enum.Enum.Value {
+        description := descutil.LeadingComments(enum.File, fmt.Sprintf("%s,2,%d", path, i)) // 2 means value in an enum.
+        if v.GetOptions().GetDeprecated() {
+            description = strings.TrimSpace("Deprecated. " + description)
+        }
+        fmt.Fprintf(b, "| `%s` | %d | %s |\n", v.GetName(), v.GetNumber(), cell(description))
+    }
+    b.WriteString("\n")
+}
+
+// fieldType returns the type of field as written in the .proto language,
+// with links to the documented types.
+func (d *docs) fieldType(field *pb.FieldDescriptorProto) string {
+    if field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE {
+        if msg := d.types.Message(field.GetTypeName()); msg != nil && msg.Message.GetOptions().GetMapEntry() {
+            return fmt.Sprintf("map<%s, %s>", d.fieldType(msg.Message.Field[0]), d.fieldType(msg.Message.Field[1]))
+        }
+    }
+    typ, ok := scalarTypes[field.GetType()]
+    if !ok {
+        typ = d.typeLink(field.GetTypeName())
+    }
+    switch field.GetLabel() {
+    case pb.FieldDescriptorProto_LABEL_REPEATED:
+        return "repeated " + typ
+    case pb.FieldDescriptorProto_LABEL_REQUIRED:
+        return "required " + typ
+    }
+    return typ
+}
+
+// typeLink returns the fully-qualified name of the message or enum typ,
+// without leading dot, linked to its documentation if it is on the page.
+func (d *docs) typeLink(typ string) string {
+    name := strings.TrimPrefix(typ, ".")
+    if !d.documented[typ] {
+        return "`" + name + "`"
+    }
+    return fmt.Sprintf("[`%s`](#%s)", name, name)
+}
+
+// anchor returns the anchor of the documentation of the type named name in
+// the package pkg: its fully-qualified name.
+func anchor(pkg, name string) string {
+    if pkg == "" {
+        return name
+    }
+    return pkg + "." + name
+}
+
+// writeComments writes comments as a paragraph, if not empty.
+func writeComments(b *bytes.Buffer, comments string) {
+    if comments = strings.TrimSpace(comments); comments != "" {
+        b.WriteString(comments + "\n\n")
+    }
+}
+
+// cell returns s written in a table cell: on a single line, with its pipes
+// escaped.
+func cell(s string) string {
+    s = strings.Replace(strings.TrimSpace(s), "|", `\|`, -1)
+    return strings.Replace(s, "\n", "<br>", -1)
+}
@@ -0,0 +1,163 @@
+// Package enums outputs the parsing helpers of the enums.
+//
+// For every enum Foo it generates ParseFoo(s string) (Foo, error),
+// returning the value named s, in any case and aliases included, or
+// numbered s, the FooValues slice of its values and the FooNames slice of
+// their names, in declaration order, and a Set method making *Foo a
+// flag.Value, so that command-line flags and configuration files can be
+// mapped onto the enums.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package enums
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// importPaths are the packages the parsing helpers may use.
+var importPaths = []string{"strconv", "strings"}
+
+func init() {
+    generator.RegisterPlugin(new(enums))
+}
+
+// enums is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the parsing helpers of the enums.
+type enums struct {
+    gen *generator.Generator
+
+    pkgNames map[string]string // names of the packages of importPaths
+    used     map[string]bool   // packages of importPaths used by the file being generated
+}
+
+// Name returns the name of this plugin, "enums".
+func (e *enums) Name() string {
+    return "enums"
+}
+
+// Init initializes the plugin.
+func (e *enums) Init(gen *generator.Generator) {
+    e.gen = gen
+    e.pkgNames = make(map[string]string)
+    for _, path := range importPaths {
+        e.pkgNames[path] = generator.RegisterUniquePackageName(path, nil)
+    }
+}
+
+// P forwards to e.gen.P.
+func (e *enums) P(args ...interface{}) { e.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (e *enums) pkg(importPath string) string {
+    e.used[importPath] = true
+    return e.pkgNames[importPath]
+}
+
+// Generate generates the parsing helpers of the enums in the given file.
+func (e *enums) Generate(file *generator.FileDescriptor) {
+    e.used = make(map[string]bool)
+    if !descutil.IsGenerated(e.gen, file.GetName()) {
+        return
+    }
+    for _, enum := range descutil.Enums(e.gen, file) {
+        e.generateEnum(enum)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (e *enums) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range e.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    e.P("import (")
+    for _, path := range paths {
+        e.P(e.pkgNames[path], " ", strconv.Quote(path))
+    }
+    e.P(")")
+    e.P()
+}
+
+// generateEnum generates the parsing helpers of enum.
+func (e *enums) generateEnum(enum *generator.EnumDescriptor) {
+    typeName := generator.CamelCaseSlice(enum.TypeName())
+    strconvPkg, stringsPkg := e.pkg("strconv"), e.pkg("strings")
+
+    // The constants of the values are prefixed as by the generator: with
+    // the name of the enum, or of its message if it is nested in one.
+    prefix := typeName + "_"
+    if names := enum.TypeName(); len(names) > 1 {
+        prefix = generator.CamelCaseSlice(names[:len(names)-1]) + "_"
+    }
+    var values, names []string
+    seen := make(map[int32]bool)
+    lower := make(map[string]string)
+    var lowerNames []string
+    for _, value := range enum.Value {
+        if !seen[value.GetNumber()] {
+            seen[value.GetNumber()] = true
+            values = append(values, prefix+value.GetName())
+            names = append(names, strconv.Quote(value.GetName()))
+        }
+        name := strings.ToLower(value.GetName())
+        if _, ok := lower[name]; !ok {
+            lower[name] = prefix + value.GetName()
+            lowerNames = append(lowerNames, name)
+        }
+    }
+
+    e.P("// ", typeName, "Values are the values of ", typeName, ", in declaration order, aliases")
+    e.P("// excluded.")
+    e.P("var ", typeName, "Values = []", typeName, "{", strings.Join(values, ", "), "}")
+    e.P()
+    e.P("// ", typeName, "Names are the names of the ", typeName, "Values.")
+    e.P("var ", typeName, "Names = []string{", strings.Join(names, ", "), "}")
+    e.P()
+    e.P("// _", typeName, "_lowerValue maps the names of the values of ", typeName, ", aliases")
+    e.P("// included, in lower case to the values.")
+    e.P("var _", typeName, "_lowerValue = map[string]", typeName, "{")
+    for _, name := range lowerNames {
+        e.P(strconv.Quote(name), ": ", lower[name], ",")
+    }
+    e.P("}")
+    e.P()
+    e.P("// Parse", typeName, " returns the value of ", typeName, " named s, in any case and")
+    e.P("// aliases included, or whose number s is.")
+    e.P("func Parse", typeName, "(s string) (", typeName, ", error) {")
+    e.P("if v, ok := ", typeName, "_value[s]; ok {")
+    e.P("return ", typeName, "(v), nil")
+    e.P("}")
+    e.P("if v, ok := _", typeName, "_lowerValue[", stringsPkg, ".ToLower(s)]; ok {")
+    e.P("return v, nil")
+    e.P("}")
+    e.P("if n, err := ", strconvPkg, ".ParseInt(s, 10, 32); err == nil {")
+    e.P("if _, ok := ", typeName, "_name[int32(n)]; ok {")
+    e.P("return ", typeName, "(n), nil")
+    e.P("}")
+    e.P("}")
+    e.P("return 0, ", e.gen.Pkg["fmt"], ".Errorf(\"unknown ", typeName, " %q, want one of %s\", s, ", stringsPkg, ".Join(", typeName, "Names, \", \"))")
+    e.P("}")
+    e.P()
+    e.P("// Set sets x to the value parsed from s by Parse", typeName, ", making *", typeName, " a")
+    e.P("// flag.Value.")
+    e.P("func (x *", typeName, ") Set(s string) error {")
+    e.P("v, err := Parse", typeName, "(s)")
+    e.P("if err != nil {")
+    e.P("return err")
+    e.P("}")
+    e.P("*x = v")
+    e.P("return nil")
+    e.P("}")
+    e.P()
+}
@@ -0,0 +1,197 @@
+// Package equal outputs typed comparisons of the messages.
+//
+// For every message Foo it generates an Equal(other *Foo) bool method
+// reporting whether two Foo are equal as proto.Equal defines it, without
+// its reflection: NaN is not equal to itself, the fields of proto2 must
+// be set alike, the empty bytes of proto3 are equal to nil ones, and the
+// unknown fields must be the same. The messages of the files not being
+// generated, and the messages with extensions, are still compared by
+// proto.Equal.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package equal
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const bytesPkgPath = "bytes"
+
+// bytesPkg is the name of the bytes package in the generated code, which
+// may vary from "bytes" if the name is used by other packages.
+var bytesPkg string
+
+func init() {
+    generator.RegisterPlugin(new(equal))
+}
+
+// equal is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the Equal methods of the messages of
+// each file.
+type equal struct {
+    gen *generator.Generator
+
+    usesBytes bool // the file being generated compares bytes
+}
+
+// Name returns the name of this plugin, "equal".
+func (e *equal) Name() string {
+    return "equal"
+}
+
+// Init initializes the plugin.
+func (e *equal) Init(gen *generator.Generator) {
+    e.gen = gen
+    bytesPkg = generator.RegisterUniquePackageName("bytes", nil)
+}
+
+// P forwards to e.gen.P.
+func (e *equal) P(args ...interface{}) { e.gen.P(args...) }
+
+// Generate generates the Equal methods of the messages in the given file.
+func (e *equal) Generate(file *generator.FileDescriptor) {
+    e.usesBytes = false
+    if !descutil.IsGenerated(e.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(e.gen, file) {
+        e.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (e *equal) GenerateImports(file *generator.FileDescriptor) {
+    if e.usesBytes {
+        e.P("import ", bytesPkg, " ", fmt.Sprintf("%q", bytesPkgPath))
+    }
+}
+
+// generateMessage generates the Equal method of msg.
+func (e *equal) generateMessage(msg *generator.Descriptor) {
+    typeName := e.gen.TypeName(msg)
+    e.P("// Equal reports whether m and other are equal, as proto.Equal does.")
+    e.P("func (m *", typeName, ") Equal(other *", typeName, ") bool {")
+    if len(msg.ExtensionRange) > 0 {
+        // The extensions can only be compared by reflection.
+        e.P("return ", e.gen.Pkg["proto"], ".Equal(m, other)")
+        e.P("}")
+        e.P()
+        return
+    }
+    e.P("if m == nil || other == nil {")
+    e.P("return m == other")
+    e.P("}")
+    for _, field := range msg.Field {
+        if field.OneofIndex != nil {
+            continue
+        }
+        e.generateField(msg, field, generator.CamelCase(field.GetName()))
+    }
+    for i, oneof := range msg.OneofDecl {
+        e.generateOneof(msg, int32(i), generator.CamelCase(oneof.GetName()))
+    }
+    if !descutil.IsProto3(msg) {
+        e.usesBytes = true
+        e.P("if !", bytesPkg, ".Equal(m.XXX_unrecognized, other.XXX_unrecognized) {")
+        e.P("return false")
+        e.P("}")
+    }
+    e.P("return true")
+    e.P("}")
+    e.P()
+}
+
+// generateField generates the comparison of the field named fieldName of
+// m and other.
+func (e *equal) generateField(msg *generator.Descriptor, field *pb.FieldDescriptorProto, fieldName string) {
+    a, b := "m."+fieldName, "other."+fieldName
+    goType, _ := e.gen.GoType(msg, field)
+    switch {
+    case descutil.MapEntry(e.gen, field) != nil:
+        value := descutil.MapEntry(e.gen, field).Field[1]
+        e.P("if len(", a, ") != len(", b, ") {")
+        e.P("return false")
+        e.P("}")
+        e.P("for k, v := range ", a, " {")
+        e.P("if w, ok := ", b, "[k]; !ok || ", e.notEqual(value, "v", "w", false), " {")
+        e.P("return false")
+        e.P("}")
+        e.P("}")
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        e.P("if len(", a, ") != len(", b, ") {")
+        e.P("return false")
+        e.P("}")
+        e.P("for i, v := range ", a, " {")
+        e.P("if ", e.notEqual(field, "v", b+"[i]", descutil.IsProto3(msg)), " {")
+        e.P("return false")
+        e.P("}")
+        e.P("}")
+    case goType[0] == '*' && isValue(field):
+        // Optional fields of proto2 point to their value, and are only
+        // equal if both are set or unset.
+        e.P("if (", a, " == nil) != (", b, " == nil) || ", a, " != nil && *", a, " != *", b, " {")
+        e.P("return false")
+        e.P("}")
+    default:
+        e.P("if ", e.notEqual(field, a, b, descutil.IsProto3(msg)), " {")
+        e.P("return false")
+        e.P("}")
+    }
+}
+
+// generateOneof generates the comparison of the oneof of the given index
+// and name of m and other: they must hold the same field, with equal
+// values.
+func (e *equal) generateOneof(msg *generator.Descriptor, index int32, name string) {
+    typeName := e.gen.TypeName(msg)
+    e.P("switch v := m.", name, ".(type) {")
+    e.P("case nil:")
+    e.P("if other.", name, " != nil {")
+    e.P("return false")
+    e.P("}")
+    for _, field := range msg.Field {
+        if field.OneofIndex == nil || field.GetOneofIndex() != index {
+            continue
+        }
+        fieldName := generator.CamelCase(field.GetName())
+        wrapper := typeName + "_" + fieldName
+        e.P("case *", wrapper, ":")
+        e.P("if w, ok := other.", name, ".(*", wrapper, "); !ok || ", e.notEqual(field, "v."+fieldName, "w."+fieldName, descutil.IsProto3(msg)), " {")
+        e.P("return false")
+        e.P("}")
+    }
+    e.P("}")
+}
+
+// notEqual returns the expression reporting whether the single values a
+// and b of field differ. The empty bytes of proto3 fields are equal to
+// nil ones.
+func (e *equal) notEqual(field *pb.FieldDescriptorProto, a, b string, proto3 bool) string {
+    switch {
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES:
+        e.usesBytes = true
+        if proto3 {
+            return "!" + bytesPkg + ".Equal(" + a + ", " + b + ")"
+        }
+        return "(" + a + " == nil) != (" + b + " == nil) || !" + bytesPkg + ".Equal(" + a + ", " + b + ")"
+    case isValue(field):
+        return a + " != " + b
+    case descutil.IsGenerated(e.gen, e.gen.ObjectNamed(field.GetTypeName()).File().GetName()):
+        return "!" + a + ".Equal(" + b + ")"
+    }
+    return "!" + e.gen.Pkg["proto"] + ".Equal(" + a + ", " + b + ")"
+}
+
+// isValue reports whether the values of field are compared with ==.
+func isValue(field *pb.FieldDescriptorProto) bool {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP, pb.FieldDescriptorProto_TYPE_BYTES:
+        return false
+    }
+    return true
+}
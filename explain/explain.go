@@ -0,0 +1,133 @@
+// Package explain outputs wire inspectors of the messages.
+//
+// For every message Foo it generates an ExplainWire method returning an
+// annotated dump of a serialized Foo, with the offsets, bytes, tag, wire
+// type, name and decoded value of each field, as wire.Explain writes it,
+// for debugging corrupt payloads such as the ones crossing the serialized
+// API boundary.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package explain
+
+import (
+    "fmt"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const wirePkgPath = "github.com/lleveque/protoc-gen-go/wire"
+
+// wirePkg is the name of the wire package in the generated code, which
+// may vary from "wire" if the name is used by other packages.
+var wirePkg string
+
+func init() {
+    generator.RegisterPlugin(new(explain))
+}
+
+// explain is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the ExplainWire methods of the
+// messages of each file.
+type explain struct {
+    gen *generator.Generator
+}
+
+// Name returns the name of this plugin, "explain".
+func (e *explain) Name() string {
+    return "explain"
+}
+
+// Init initializes the plugin.
+func (e *explain) Init(gen *generator.Generator) {
+    e.gen = gen
+    wirePkg = generator.RegisterUniquePackageName("wire", nil)
+}
+
+// P forwards to e.gen.P.
+func (e *explain) P(args ...interface{}) { e.gen.P(args...) }
+
+// Generate generates the ExplainWire methods of the messages in the given file.
+func (e *explain) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(e.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(e.gen, file) {
+        e.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (e *explain) GenerateImports(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(e.gen, file.GetName()) || len(descutil.Messages(e.gen, file)) == 0 {
+        return
+    }
+    e.P("import ", wirePkg, " ", fmt.Sprintf("%q", wirePkgPath))
+}
+
+// generateMessage generates the ExplainWire method of msg, and the function
+// describing its fields.
+func (e *explain) generateMessage(msg *generator.Descriptor) {
+    typeName := e.gen.TypeName(msg)
+    e.P("// ExplainWire returns an annotated dump of the serialized ", typeName, " in data,")
+    e.P("// one line per field with its offsets, bytes, tag, name and decoded value,")
+    e.P("// for debugging corrupt payloads. It does not read m, which may be nil.")
+    e.P("func (m *", typeName, ") ExplainWire(data []byte) string {")
+    e.P("return ", wirePkg, ".Explain(data, ", fieldsFunc(typeName), "())")
+    e.P("}")
+    e.P()
+    e.P("// ", fieldsFunc(typeName), " describes the fields of ", typeName, " to ", wirePkg, ".Explain.")
+    e.P("func ", fieldsFunc(typeName), "() ", wirePkg, ".Fields {")
+    e.P("return ", wirePkg, ".Fields{")
+    for _, field := range msg.Field {
+        e.generateField(field)
+    }
+    e.P("}")
+    e.P("}")
+    e.P()
+}
+
+// generateField generates the entry of field in the description of the
+// fields of its message.
+func (e *explain) generateField(field *pb.FieldDescriptorProto) {
+    typ := strings.ToLower(strings.TrimPrefix(field.GetType().String(), "TYPE_"))
+    entry := fmt.Sprintf("%d: {Name: %q, Type: %q", field.GetNumber(), field.GetName(), typ)
+    if typ != "message" {
+        e.P(entry, "},")
+        return
+    }
+    obj := e.gen.ObjectNamed(field.GetTypeName())
+    desc, ok := obj.(*generator.Descriptor)
+    switch {
+    case ok && desc.GetOptions().GetMapEntry():
+        // Map entries have no Go type: their fields are described inline.
+        e.P(entry, ", Fields: func() ", wirePkg, ".Fields {")
+        e.P("return ", wirePkg, ".Fields{")
+        for _, f := range desc.Field {
+            e.generateField(f)
+        }
+        e.P("}")
+        e.P("}},")
+    case e.generated(obj):
+        e.P(entry, ", Fields: ", fieldsFunc(e.gen.TypeName(obj)), "},")
+    default:
+        // The fields of messages defined outside of the generated files
+        // are not described, and dumped as unknown fields.
+        e.P(entry, "},")
+    }
+}
+
+// generated reports whether obj is defined in one of the files being
+// generated, and therefore has its fields described.
+func (e *explain) generated(obj generator.Object) bool {
+    return descutil.IsGenerated(e.gen, obj.File().GetName())
+}
+
+// fieldsFunc returns the name of the function describing the fields of the
+// message typeName.
+func fieldsFunc(typeName string) string {
+    return "_" + typeName + "_wireFields"
+}
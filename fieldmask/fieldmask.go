@@ -0,0 +1,724 @@
+// Package fieldmask outputs the partial updates of the messages.
+//
+// For every message Foo it generates a MergeFrom(src *Foo) method merging
+// a Foo into another as proto.Merge does, and an ApplyFieldMask(src *Foo,
+// mask *field_mask.FieldMask) error method setting the fields named by a
+// google.protobuf.FieldMask to their values in a Foo, for implementing the
+// partial-update methods without reflection. It also generates the
+// ValidateFooFieldMask and NormalizeFooFieldMask functions checking the
+// paths of the field masks of the requests against the fields of Foo, and
+// of its message and map fields, and returning them in canonical form.
+// The Go package of FieldMask is given by the M parameter of
+// google/protobuf/field_mask.proto, and is
+// google.golang.org/genproto/protobuf/field_mask by default.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package fieldmask
+
+import (
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// defaultFieldMaskPkgPath is the Go package of google.protobuf.FieldMask
+// without an M parameter mapping google/protobuf/field_mask.proto.
+const defaultFieldMaskPkgPath = "google.golang.org/genproto/protobuf/field_mask"
+
+func init() {
+    generator.RegisterPlugin(new(fieldMask))
+}
+
+// importPaths are the standard packages the generated code may use.
+var importPaths = []string{"sort", "strconv", "strings"}
+
+// fieldMask is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the MergeFrom and ApplyFieldMask
+// methods of the messages of each file, and the functions validating their
+// field masks.
+type fieldMask struct {
+    gen *generator.Generator
+
+    fieldMaskPkgPath string            // Go package of google.protobuf.FieldMask
+    pkgNames         map[string]string // names of the packages of fieldMaskPkgPath and importPaths
+
+    used map[string]bool // packages used by the file being generated, by import path
+}
+
+// Name returns the name of this plugin, "fieldmask".
+func (f *fieldMask) Name() string {
+    return "fieldmask"
+}
+
+// Init initializes the plugin.
+func (f *fieldMask) Init(gen *generator.Generator) {
+    f.gen = gen
+    f.fieldMaskPkgPath = defaultFieldMaskPkgPath
+    if p, ok := gen.ImportMap["google/protobuf/field_mask.proto"]; ok {
+        f.fieldMaskPkgPath = p
+    }
+    f.pkgNames = map[string]string{
+        f.fieldMaskPkgPath: generator.RegisterUniquePackageName(path.Base(f.fieldMaskPkgPath), nil),
+    }
+    for _, importPath := range importPaths {
+        f.pkgNames[importPath] = generator.RegisterUniquePackageName(importPath, nil)
+    }
+}
+
+// P forwards to f.gen.P.
+func (f *fieldMask) P(args ...interface{}) { f.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (f *fieldMask) pkg(importPath string) string {
+    f.used[importPath] = true
+    return f.pkgNames[importPath]
+}
+
+// Generate generates the MergeFrom and ApplyFieldMask methods of the
+// messages in the given file, and the functions validating their field
+// masks.
+func (f *fieldMask) Generate(file *generator.FileDescriptor) {
+    f.used = make(map[string]bool)
+    if !descutil.IsGenerated(f.gen, file.GetName()) {
+        return
+    }
+    if file.GetName() == f.gen.Request.FileToGenerate[0] {
+        f.generateHelpers()
+    }
+    for _, msg := range descutil.Messages(f.gen, file) {
+        f.generateMergeFrom(msg)
+        f.generateApplyFieldMask(msg)
+        f.generateValidateFieldMask(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (f *fieldMask) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range f.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    f.P("import (")
+    for _, path := range paths {
+        f.P(f.pkgNames[path], " ", strconv.Quote(path))
+    }
+    f.P(")")
+    f.P()
+}
+
+// generateMergeFrom generates the MergeFrom method of msg, and its
+// mergeClone method returning a deep copy of a message by merging it into
+// a new one.
+func (f *fieldMask) generateMergeFrom(msg *generator.Descriptor) {
+    typeName := f.gen.TypeName(msg)
+    f.P("// MergeFrom merges src into m, as proto.Merge does: the scalar fields set in")
+    f.P("// src, non-zero in proto3, are copied, its message fields merged in turn,")
+    f.P("// its repeated fields appended and its map entries added, replacing the")
+    f.P("// ones of the same key. The unknown fields of src are appended to the ones")
+    f.P("// of m.")
+    f.P("func (m *", typeName, ") MergeFrom(src *", typeName, ") {")
+    f.P("if src == nil {")
+    f.P("return")
+    f.P("}")
+    if len(msg.ExtensionRange) > 0 {
+        // The extensions can only be merged by reflection.
+        f.P(f.gen.Pkg["proto"], ".Merge(m, src)")
+        f.P("}")
+        f.P()
+        f.generateMergeClone(msg)
+        return
+    }
+    for _, field := range msg.Field {
+        if field.OneofIndex != nil {
+            continue
+        }
+        f.generateMergeField(msg, field)
+    }
+    for i, oneof := range msg.OneofDecl {
+        f.generateMergeOneof(msg, int32(i), generator.CamelCase(oneof.GetName()))
+    }
+    if !descutil.IsProto3(msg) {
+        f.P("m.XXX_unrecognized = append(m.XXX_unrecognized, src.XXX_unrecognized...)")
+    }
+    f.P("}")
+    f.P()
+    f.generateMergeClone(msg)
+}
+
+// generateMergeClone generates the mergeClone method of msg.
+func (f *fieldMask) generateMergeClone(msg *generator.Descriptor) {
+    typeName := f.gen.TypeName(msg)
+    f.P("// mergeClone returns a deep copy of m, or nil if m is nil.")
+    f.P("func (m *", typeName, ") mergeClone() *", typeName, " {")
+    f.P("if m == nil {")
+    f.P("return nil")
+    f.P("}")
+    f.P("c := new(", typeName, ")")
+    f.P("c.MergeFrom(m)")
+    f.P("return c")
+    f.P("}")
+    f.P()
+}
+
+// generateMergeField generates the merge of field of src into m.
+func (f *fieldMask) generateMergeField(msg *generator.Descriptor, field *pb.FieldDescriptorProto) {
+    fieldName := generator.CamelCase(field.GetName())
+    dst, src := "m."+fieldName, "src."+fieldName
+    goType, _ := f.gen.GoType(msg, field)
+    switch {
+    case descutil.MapEntry(f.gen, field) != nil:
+        f.P("if len(", src, ") > 0 && ", dst, " == nil {")
+        f.P(dst, " = make(", f.mapType(field), ", len(", src, "))")
+        f.P("}")
+        f.P("for k, v := range ", src, " {")
+        f.P(dst, "[k] = ", f.copyOf(descutil.MapEntry(f.gen, field).Field[1], "v"))
+        f.P("}")
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        if isValue(field) {
+            f.P(dst, " = append(", dst, ", ", src, "...)")
+            return
+        }
+        f.P("for _, v := range ", src, " {")
+        f.P(dst, " = append(", dst, ", ", f.copyOf(field, "v"), ")")
+        f.P("}")
+    case goType[0] == '*' && isValue(field):
+        // Optional fields of proto2 point to their value.
+        f.P("if ", src, " != nil {")
+        f.P("v := *", src)
+        f.P(dst, " = &v")
+        f.P("}")
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES:
+        if descutil.IsProto3(msg) {
+            f.P("if len(", src, ") > 0 {")
+        } else {
+            f.P("if ", src, " != nil {")
+        }
+        f.P(dst, " = append([]byte{}, ", src, "...)")
+        f.P("}")
+    case isValue(field):
+        f.P("if ", nonZero(goType, src), " {")
+        f.P(dst, " = ", src)
+        f.P("}")
+    default:
+        f.P("if ", src, " != nil {")
+        f.P("if ", dst, " == nil {")
+        f.P(dst, " = new(", goType[1:], ")")
+        f.P("}")
+        f.generateMergeMessage(field, dst, src)
+        f.P("}")
+    }
+}
+
+// generateMergeOneof generates the merge of the oneof of the given index
+// and name of src into m: the field set in src replaces the one of m,
+// unless it is the same message field, which is merged.
+func (f *fieldMask) generateMergeOneof(msg *generator.Descriptor, index int32, name string) {
+    typeName := f.gen.TypeName(msg)
+    f.P("switch v := src.", name, ".(type) {")
+    for _, field := range msg.Field {
+        if field.OneofIndex == nil || field.GetOneofIndex() != index {
+            continue
+        }
+        fieldName := generator.CamelCase(field.GetName())
+        wrapper := typeName + "_" + fieldName
+        f.P("case *", wrapper, ":")
+        if isValue(field) || field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES {
+            f.P("m.", name, " = &", wrapper, "{", f.copyOf(field, "v."+fieldName), "}")
+            continue
+        }
+        f.P("if w, ok := m.", name, ".(*", wrapper, "); ok && w.", fieldName, " != nil && v.", fieldName, " != nil {")
+        f.generateMergeMessage(field, "w."+fieldName, "v."+fieldName)
+        f.P("} else {")
+        f.P("m.", name, " = &", wrapper, "{", f.copyOf(field, "v."+fieldName), "}")
+        f.P("}")
+    }
+    f.P("}")
+}
+
+// generateMergeMessage generates the merge of the non-nil message src of
+// field into dst.
+func (f *fieldMask) generateMergeMessage(field *pb.FieldDescriptorProto, dst, src string) {
+    if f.isGenerated(field) {
+        f.P(dst, ".MergeFrom(", src, ")")
+    } else {
+        f.P(f.gen.Pkg["proto"], ".Merge(", dst, ", ", src, ")")
+    }
+}
+
+// generateApplyFieldMask generates the ApplyFieldMask method of msg, and its
+// applyFieldMaskPath method applying a single path.
+func (f *fieldMask) generateApplyFieldMask(msg *generator.Descriptor) {
+    typeName := f.gen.TypeName(msg)
+    fullName := messageName(msg)
+    f.P("// ApplyFieldMask sets the fields of m named by the paths of mask, e.g.")
+    f.P(`// "address.city", to their value in src, or clears them if they are unset`)
+    f.P("// in src, for implementing partial updates. The messages on the way of a")
+    f.P("// path are created as needed. Without paths, src is merged into m, as by")
+    f.P("// MergeFrom. It fails, changing no field, on the paths not naming a field,")
+    f.P("// or going through a field other than a singular message defined in the")
+    f.P("// generated files. The method expression (*", typeName, ").ApplyFieldMask is a")
+    f.P("// func(dst, src *", typeName, ", mask *", f.pkg(f.fieldMaskPkgPath), ".FieldMask) error.")
+    f.P("func (m *", typeName, ") ApplyFieldMask(src *", typeName, ", mask *", f.pkg(f.fieldMaskPkgPath), ".FieldMask) error {")
+    f.P("if len(mask.GetPaths()) == 0 {")
+    f.P("m.MergeFrom(src)")
+    f.P("return nil")
+    f.P("}")
+    f.P("for _, path := range mask.GetPaths() {")
+    f.P("if !new(", typeName, ").applyFieldMaskPath(nil, ", f.pkg("strings"), `.Split(path, ".")) {`)
+    f.P("return ", f.gen.Pkg["fmt"], `.Errorf("invalid field mask path %q for `, fullName, `", path)`)
+    f.P("}")
+    f.P("}")
+    f.P("for _, path := range mask.GetPaths() {")
+    f.P("m.applyFieldMaskPath(src, ", f.pkg("strings"), `.Split(path, "."))`)
+    f.P("}")
+    f.P("return nil")
+    f.P("}")
+    f.P()
+    f.P("// applyFieldMaskPath sets the field of m named by path to its value in src,")
+    f.P("// if not nil, reporting whether path names a field.")
+    f.P("func (m *", typeName, ") applyFieldMaskPath(src *", typeName, ", path []string) bool {")
+    f.P("if src == nil {")
+    f.P("src = new(", typeName, ")")
+    f.P("}")
+    f.P("switch path[0] {")
+    for _, field := range msg.Field {
+        fieldName := generator.CamelCase(field.GetName())
+        f.P("case ", strconv.Quote(field.GetName()), ":")
+        f.P("if len(path) == 1 {")
+        if field.OneofIndex != nil {
+            f.generateSetOneofField(msg, field)
+        } else {
+            f.generateSetField(msg, field)
+        }
+        f.P("return true")
+        f.P("}")
+        if !f.isSingularMessage(field) {
+            f.P("return false")
+            continue
+        }
+        goType, _ := f.gen.GoType(msg, field)
+        if field.OneofIndex == nil {
+            f.P("if m.", fieldName, " == nil {")
+            f.P("if src.", fieldName, " == nil {")
+            f.P("// Nothing to set, but the rest of the path is checked.")
+            f.P("return new(", goType[1:], ").applyFieldMaskPath(nil, path[1:])")
+            f.P("}")
+            f.P("m.", fieldName, " = new(", goType[1:], ")")
+            f.P("}")
+            f.P("return m.", fieldName, ".applyFieldMaskPath(src.", fieldName, ", path[1:])")
+            continue
+        }
+        oneofName := generator.CamelCase(msg.OneofDecl[field.GetOneofIndex()].GetName())
+        wrapper := typeName + "_" + fieldName
+        f.P("var dst ", goType)
+        f.P("if w, ok := m.", oneofName, ".(*", wrapper, "); ok {")
+        f.P("dst = w.", fieldName)
+        f.P("}")
+        f.P("if dst == nil {")
+        f.P("if src.Get", fieldName, "() == nil {")
+        f.P("// Nothing to set, but the rest of the path is checked.")
+        f.P("return new(", goType[1:], ").applyFieldMaskPath(nil, path[1:])")
+        f.P("}")
+        f.P("dst = new(", goType[1:], ")")
+        f.P("m.", oneofName, " = &", wrapper, "{dst}")
+        f.P("}")
+        f.P("return dst.applyFieldMaskPath(src.Get", fieldName, "(), path[1:])")
+    }
+    f.P("}")
+    f.P("return false")
+    f.P("}")
+    f.P()
+}
+
+// generateHelpers generates, once per package, the errors of the invalid
+// paths of field masks and the functions splitting and normalizing them.
+func (f *fieldMask) generateHelpers() {
+    fmtPkg, stringsPkg := f.gen.Pkg["fmt"], f.pkg("strings")
+    f.P("// FieldMaskPathError is an invalid path of a field mask, as reported by the")
+    f.P("// functions validating and normalizing the field masks of the messages.")
+    f.P("type FieldMaskPathError struct {")
+    f.P("Message string // full name of the message the field mask applies to")
+    f.P("Path    string")
+    f.P("Reason  string // what is wrong with the path")
+    f.P("}")
+    f.P()
+    f.P("// Error returns the description of the invalid path.")
+    f.P("func (e *FieldMaskPathError) Error() string {")
+    f.P("return ", fmtPkg, `.Sprintf("invalid field mask path %q for %s: %s", e.Path, e.Message, e.Reason)`)
+    f.P("}")
+    f.P()
+    f.P("// FieldMaskErrors are the invalid paths of a field mask, in the order of the")
+    f.P("// paths.")
+    f.P("type FieldMaskErrors []*FieldMaskPathError")
+    f.P()
+    f.P("// Error returns the descriptions of the invalid paths, separated by")
+    f.P("// semicolons.")
+    f.P("func (e FieldMaskErrors) Error() string {")
+    f.P("msgs := make([]string, len(e))")
+    f.P("for i, err := range e {")
+    f.P("msgs[i] = err.Error()")
+    f.P("}")
+    f.P("return ", stringsPkg, `.Join(msgs, "; ")`)
+    f.P("}")
+    f.P()
+    f.P("// _normalizeFieldMask returns paths, the ones of a field mask of the message")
+    f.P("// of the given full name, in canonical form, normalized by normalize, sorted")
+    f.P("// and without the paths within others, or the FieldMaskErrors of the paths")
+    f.P("// for which normalize, or their splitting, gives the reason they are invalid.")
+    f.P("func _normalizeFieldMask(message string, paths []string, normalize func(path []string) string) ([]string, error) {")
+    f.P("var errs FieldMaskErrors")
+    f.P("var normalized []string")
+    f.P("for _, path := range paths {")
+    f.P("components, reason := _splitFieldMaskPath(path)")
+    f.P(`if reason == "" {`)
+    f.P("reason = normalize(components)")
+    f.P("}")
+    f.P(`if reason != "" {`)
+    f.P("errs = append(errs, &FieldMaskPathError{Message: message, Path: path, Reason: reason})")
+    f.P("continue")
+    f.P("}")
+    f.P("normalized = append(normalized, _joinFieldMaskPath(components))")
+    f.P("}")
+    f.P("if len(errs) > 0 {")
+    f.P("return nil, errs")
+    f.P("}")
+    f.P(f.pkg("sort"), ".Strings(normalized)")
+    f.P("var canonical []string")
+    f.P("for _, path := range normalized {")
+    f.P(`if n := len(canonical); n > 0 && (path == canonical[n-1] || `, stringsPkg, `.HasPrefix(path, canonical[n-1]+".")) {`)
+    f.P("continue")
+    f.P("}")
+    f.P("canonical = append(canonical, path)")
+    f.P("}")
+    f.P("return canonical, nil")
+    f.P("}")
+    f.P()
+    f.P("// _splitFieldMaskPath returns the components of path, separated by dots, the")
+    f.P("// map keys being possibly quoted by backquotes, doubled within them, or the")
+    f.P("// reason it cannot be split.")
+    f.P("func _splitFieldMaskPath(path string) ([]string, string) {")
+    f.P("var components []string")
+    f.P("for {")
+    f.P("var c string")
+    f.P(`if `, stringsPkg, ".HasPrefix(path, \"`\") {")
+    f.P("end := 1")
+    f.P("for {")
+    f.P("i := ", stringsPkg, ".IndexByte(path[end:], '`')")
+    f.P("if i < 0 {")
+    f.P(`return nil, "unterminated quoted key"`)
+    f.P("}")
+    f.P("end += i + 1")
+    f.P("if !", stringsPkg, ".HasPrefix(path[end:], \"`\") {")
+    f.P("break")
+    f.P("}")
+    f.P("end++")
+    f.P("}")
+    f.P("c, path = ", stringsPkg, ".Replace(path[1:end-1], \"``\", \"`\", -1), path[end:]")
+    f.P(`if path != "" && path[0] != '.' {`)
+    f.P(`return nil, "no dot after a quoted key"`)
+    f.P("}")
+    f.P("} else {")
+    f.P("i := ", stringsPkg, ".IndexByte(path, '.')")
+    f.P("if i < 0 {")
+    f.P("i = len(path)")
+    f.P("}")
+    f.P("c, path = path[:i], path[i:]")
+    f.P(`if c == "" {`)
+    f.P(`return nil, "empty component"`)
+    f.P("}")
+    f.P("}")
+    f.P("components = append(components, c)")
+    f.P(`if path == "" {`)
+    f.P(`return components, ""`)
+    f.P("}")
+    f.P("path = path[1:]")
+    f.P("}")
+    f.P("}")
+    f.P()
+    f.P("// _joinFieldMaskPath returns the path of the given components, quoting the")
+    f.P("// ones other than letters, digits and underscores by backquotes.")
+    f.P("func _joinFieldMaskPath(components []string) string {")
+    f.P("for i, c := range components {")
+    f.P(`if c == "" || `, stringsPkg, ".IndexFunc(c, func(r rune) bool {")
+    f.P("return r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9')")
+    f.P("}) >= 0 {")
+    f.P("components[i] = \"`\" + ", stringsPkg, ".Replace(c, \"`\", \"``\", -1) + \"`\"")
+    f.P("}")
+    f.P("}")
+    f.P("return ", stringsPkg, `.Join(components, ".")`)
+    f.P("}")
+    f.P()
+}
+
+// generateValidateFieldMask generates the ValidateFooFieldMask and
+// NormalizeFooFieldMask functions of msg, Foo, and its
+// normalizeFieldMaskPath method normalizing a single path.
+func (f *fieldMask) generateValidateFieldMask(msg *generator.Descriptor) {
+    typeName := f.gen.TypeName(msg)
+    fullName := messageName(msg)
+    fieldMask := f.pkg(f.fieldMaskPkgPath) + ".FieldMask"
+    f.P("// Validate", typeName, "FieldMask checks that the paths of mask name fields of a")
+    f.P("// ", typeName, ", by their names or JSON names, e.g. \"address.city\", going through")
+    f.P("// singular message fields whose types are defined in the generated files,")
+    f.P(`// and through map fields by key, e.g. "labels.env" or "labels.` + "`a.b`" + `". It`)
+    f.P("// returns the FieldMaskErrors of the invalid paths.")
+    f.P("func Validate", typeName, "FieldMask(mask *", fieldMask, ") error {")
+    f.P("_, err := _normalizeFieldMask(", strconv.Quote(fullName), ", mask.GetPaths(), (*", typeName, ")(nil).normalizeFieldMaskPath)")
+    f.P("return err")
+    f.P("}")
+    f.P()
+    f.P("// Normalize", typeName, "FieldMask returns mask in canonical form, its paths being")
+    f.P("// checked as by Validate", typeName, "FieldMask: the JSON names of the fields are")
+    f.P("// replaced by their names, the integer map keys written in decimal and the")
+    f.P("// paths sorted, without the duplicates and the paths within another. It")
+    f.P("// returns the FieldMaskErrors of the invalid paths.")
+    f.P("func Normalize", typeName, "FieldMask(mask *", fieldMask, ") (*", fieldMask, ", error) {")
+    f.P("paths, err := _normalizeFieldMask(", strconv.Quote(fullName), ", mask.GetPaths(), (*", typeName, ")(nil).normalizeFieldMaskPath)")
+    f.P("if err != nil {")
+    f.P("return nil, err")
+    f.P("}")
+    f.P("return &", fieldMask, "{Paths: paths}, nil")
+    f.P("}")
+    f.P()
+    f.P("// normalizeFieldMaskPath normalizes the components of path, naming a field")
+    f.P("// of ", typeName, ", in place, or returns the reason it names no field.")
+    f.P("func (*", typeName, ") normalizeFieldMaskPath(path []string) string {")
+    names := make(map[string]bool)
+    for _, field := range msg.Field {
+        names[field.GetName()] = true
+    }
+    f.P("switch path[0] {")
+    for _, field := range msg.Field {
+        name := field.GetName()
+        desc := "field " + strconv.Quote(name) + " of " + fullName
+        if json := jsonName(field); !names[json] {
+            names[json] = true
+            f.P("case ", strconv.Quote(name), ", ", strconv.Quote(json), ":")
+            f.P("path[0] = ", strconv.Quote(name))
+        } else {
+            f.P("case ", strconv.Quote(name), ":")
+        }
+        if entry := descutil.MapEntry(f.gen, field); entry != nil {
+            if entry.Field[0].GetType() != pb.FieldDescriptorProto_TYPE_STRING {
+                f.P("if len(path) == 1 {")
+                f.P(`return ""`)
+                f.P("}")
+                f.generateNormalizeMapKey(entry.Field[0], desc)
+            }
+            f.P("if len(path) <= 2 {")
+            f.P(`return ""`)
+            f.P("}")
+            if value := entry.Field[1]; f.isSingularMessage(value) {
+                goType, _ := f.gen.GoType(entry, value)
+                f.P("return (", goType, ")(nil).normalizeFieldMaskPath(path[2:])")
+            } else {
+                f.P("return ", strconv.Quote(desc+" has no values with fields"))
+            }
+            continue
+        }
+        if f.isSingularMessage(field) {
+            goType, _ := f.gen.GoType(msg, field)
+            f.P("if len(path) == 1 {")
+            f.P(`return ""`)
+            f.P("}")
+            f.P("return (", goType, ")(nil).normalizeFieldMaskPath(path[1:])")
+            continue
+        }
+        f.P("if len(path) > 1 {")
+        if field.GetLabel() != pb.FieldDescriptorProto_LABEL_REPEATED && !isValue(field) && field.GetType() != pb.FieldDescriptorProto_TYPE_BYTES {
+            typ := strings.TrimPrefix(field.GetTypeName(), ".")
+            f.P("return ", strconv.Quote(desc+" is a "+typ+", not defined in the generated files"))
+        } else {
+            f.P("return ", strconv.Quote(desc+" has no fields"))
+        }
+        f.P("}")
+        f.P(`return ""`)
+    }
+    f.P("}")
+    f.P("return ", f.gen.Pkg["fmt"], `.Sprintf("no field %q in `, fullName, `", path[0])`)
+    f.P("}")
+    f.P()
+}
+
+// generateNormalizeMapKey generates the check and normalization of the map
+// key path[1] of the field described by desc, of the given non-string key
+// field.
+func (f *fieldMask) generateNormalizeMapKey(key *pb.FieldDescriptorProto, desc string) {
+    var parse, format string
+    switch key.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        parse, format = "ParseBool(path[1])", "FormatBool(k)"
+    case pb.FieldDescriptorProto_TYPE_INT32, pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SFIXED32:
+        parse, format = "ParseInt(path[1], 10, 32)", "FormatInt(k, 10)"
+    case pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_SINT64, pb.FieldDescriptorProto_TYPE_SFIXED64:
+        parse, format = "ParseInt(path[1], 10, 64)", "FormatInt(k, 10)"
+    case pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_FIXED32:
+        parse, format = "ParseUint(path[1], 10, 32)", "FormatUint(k, 10)"
+    default:
+        parse, format = "ParseUint(path[1], 10, 64)", "FormatUint(k, 10)"
+    }
+    strconvPkg := f.pkg("strconv")
+    f.P("k, err := ", strconvPkg, ".", parse)
+    f.P("if err != nil {")
+    f.P("return ", f.gen.Pkg["fmt"], ".Sprintf(", strconv.Quote("invalid key %q of "+desc), ", path[1])")
+    f.P("}")
+    f.P("path[1] = ", strconvPkg, ".", format)
+}
+
+// generateSetField generates the replacement of field of m by a copy of its
+// value in src.
+func (f *fieldMask) generateSetField(msg *generator.Descriptor, field *pb.FieldDescriptorProto) {
+    fieldName := generator.CamelCase(field.GetName())
+    dst, src := "m."+fieldName, "src."+fieldName
+    goType, _ := f.gen.GoType(msg, field)
+    switch {
+    case descutil.MapEntry(f.gen, field) != nil:
+        f.P(dst, " = nil")
+        f.P("if len(", src, ") > 0 {")
+        f.P(dst, " = make(", f.mapType(field), ", len(", src, "))")
+        f.P("for k, v := range ", src, " {")
+        f.P(dst, "[k] = ", f.copyOf(descutil.MapEntry(f.gen, field).Field[1], "v"))
+        f.P("}")
+        f.P("}")
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        if isValue(field) {
+            f.P(dst, " = append(", goType, "(nil), ", src, "...)")
+            return
+        }
+        f.P(dst, " = nil")
+        f.P("for _, v := range ", src, " {")
+        f.P(dst, " = append(", dst, ", ", f.copyOf(field, "v"), ")")
+        f.P("}")
+    case goType[0] == '*' && isValue(field):
+        f.P(dst, " = nil")
+        f.P("if ", src, " != nil {")
+        f.P("v := *", src)
+        f.P(dst, " = &v")
+        f.P("}")
+    default:
+        f.P(dst, " = ", f.copyOf(field, src))
+    }
+}
+
+// generateSetOneofField generates the replacement of the oneof field of m by
+// a copy of its value in src: it is set if set in src, and else cleared if
+// set in m.
+func (f *fieldMask) generateSetOneofField(msg *generator.Descriptor, field *pb.FieldDescriptorProto) {
+    typeName := f.gen.TypeName(msg)
+    fieldName := generator.CamelCase(field.GetName())
+    oneofName := generator.CamelCase(msg.OneofDecl[field.GetOneofIndex()].GetName())
+    wrapper := typeName + "_" + fieldName
+    f.P("if v, ok := src.", oneofName, ".(*", wrapper, "); ok {")
+    f.P("m.", oneofName, " = &", wrapper, "{", f.copyOf(field, "v."+fieldName), "}")
+    f.P("} else if _, ok := m.", oneofName, ".(*", wrapper, "); ok {")
+    f.P("m.", oneofName, " = nil")
+    f.P("}")
+}
+
+// copyOf returns the expression of a deep copy of the single value v of
+// field.
+func (f *fieldMask) copyOf(field *pb.FieldDescriptorProto, v string) string {
+    switch {
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES:
+        // The copy of empty bytes is empty, and the one of nil bytes nil.
+        return "append(" + v + "[:0:0], " + v + "...)"
+    case isValue(field):
+        return v
+    case f.isGenerated(field):
+        return v + ".mergeClone()"
+    }
+    goType, _ := f.gen.GoType(nil, field)
+    return f.gen.Pkg["proto"] + ".Clone(" + v + ").(" + strings.TrimPrefix(goType, "[]") + ")"
+}
+
+// isGenerated reports whether the message type of field is defined in the
+// files generated, and so has MergeFrom and mergeClone methods.
+func (f *fieldMask) isGenerated(field *pb.FieldDescriptorProto) bool {
+    return descutil.IsGenerated(f.gen, f.gen.ObjectNamed(field.GetTypeName()).File().GetName())
+}
+
+// isSingularMessage reports whether field is a singular message field
+// whose type is defined in the generated files, through which the paths
+// of field masks can go.
+func (f *fieldMask) isSingularMessage(field *pb.FieldDescriptorProto) bool {
+    if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED || isValue(field) || field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES {
+        return false
+    }
+    return f.isGenerated(field)
+}
+
+// mapType returns the Go type of the map field.
+func (f *fieldMask) mapType(field *pb.FieldDescriptorProto) string {
+    entry := descutil.MapEntry(f.gen, field)
+    keyType, _ := f.gen.GoType(entry, entry.Field[0])
+    valueType, _ := f.gen.GoType(entry, entry.Field[1])
+    if entry.Field[1].GetType() != pb.FieldDescriptorProto_TYPE_MESSAGE {
+        valueType = strings.TrimPrefix(valueType, "*")
+    }
+    return "map[" + strings.TrimPrefix(keyType, "*") + "]" + valueType
+}
+
+// nonZero returns the expression reporting whether v, of the Go scalar
+// type goType, is not the zero value, as set proto3 fields are.
+func nonZero(goType, v string) string {
+    switch goType {
+    case "string":
+        return v + ` != ""`
+    case "bool":
+        return v
+    }
+    return v + " != 0"
+}
+
+// isValue reports whether the values of field are copied by assignment.
+func isValue(field *pb.FieldDescriptorProto) bool {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP, pb.FieldDescriptorProto_TYPE_BYTES:
+        return false
+    }
+    return true
+}
+
+// messageName returns the fully-qualified name of msg, without a leading
+// dot.
+func messageName(msg *generator.Descriptor) string {
+    name := strings.Join(msg.TypeName(), ".")
+    if pkg := msg.File().GetPackage(); pkg != "" {
+        name = pkg + "." + name
+    }
+    return name
+}
+
+// jsonName returns the JSON name of field, the lowerCamelCase of its name
+// unless given by its json_name option.
+func jsonName(field *pb.FieldDescriptorProto) string {
+    if field.JsonName != nil {
+        return field.GetJsonName()
+    }
+    var b []byte
+    upper := false
+    for _, c := range []byte(field.GetName()) {
+        switch {
+        case c == '_':
+            upper = true
+        case upper && 'a' <= c && c <= 'z':
+            b = append(b, c-'a'+'A')
+            upper = false
+        default:
+            b = append(b, c)
+            upper = false
+        }
+    }
+    return string(b)
+}
@@ -0,0 +1,152 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// amqpErrorHeader is the header of the AMQP replies carrying the error
+// message of a call.
+const amqpErrorHeader = "rpc-error"
+
+// generateAMQP generates the AMQP RPC transport of service:
+// Serve<Service>AMQP, serving a <Service>Impl to the requests of the queue
+// of the service, and <Service>AMQPClient, calling them with a reply queue.
+func (g *grpcserial) generateAMQP(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    methods := unaryMethods(service)
+    clientName := servName + "AMQPClient"
+
+    g.P(fmt.Sprintf("// Serve%sAMQP serves impl over AMQP, e.g. RabbitMQ, until ctx is done or", servName))
+    g.P(fmt.Sprintf("// ch is closed: it declares the queue %s, consumes its requests, whose", fullServName))
+    g.P("// type property names the method called, and publishes the reply to every")
+    g.P("// request on its reply-to queue, with its correlation ID: the output of the")
+    g.P(fmt.Sprintf("// call or, in the %s header, its error message. The requests are", amqpErrorHeader))
+    g.P("// acknowledged once replied to, so that the ones of a server stopping")
+    g.P("// halfway are delivered again.")
+    g.P(fmt.Sprintf("func Serve%sAMQP(ctx context.Context, ch *amqp091.Channel, impl %sImpl) error {", servName, servName))
+    g.P(fmt.Sprintf("    q, err := ch.QueueDeclare(\"%s\", false, false, false, false, nil)", fullServName))
+    g.P("    if err != nil {")
+    g.P("        return err")
+    g.P("    }")
+    g.P("    deliveries, err := ch.Consume(q.Name, \"\", false, false, false, false, nil)")
+    g.P("    if err != nil {")
+    g.P("        return err")
+    g.P("    }")
+    g.P("    for {")
+    g.P("        var d amqp091.Delivery")
+    g.P("        var ok bool")
+    g.P("        select {")
+    g.P("        case <-ctx.Done():")
+    g.P("            return nil")
+    g.P("        case d, ok = <-deliveries:")
+    g.P("        }")
+    g.P("        if !ok {")
+    g.P("            return amqp091.ErrClosed")
+    g.P("        }")
+    g.P("        var output []byte")
+    g.P("        switch d.Type {")
+    for _, method := range methods {
+        g.P(fmt.Sprintf("        case \"%s\":", method.GetName()))
+        g.P(fmt.Sprintf("            output, err = impl.%s(d.Body)", generator.CamelCase(method.GetName())))
+    }
+    g.P("        default:")
+    g.P(fmt.Sprintf("            err = fmt.Errorf(\"unknown %s method %%q\", d.Type)", fullServName))
+    g.P("        }")
+    g.P("        reply := amqp091.Publishing{CorrelationId: d.CorrelationId, Body: output}")
+    g.P("        if err != nil {")
+    g.P(fmt.Sprintf("            reply.Headers = amqp091.Table{\"%s\": err.Error()}", amqpErrorHeader))
+    g.P("        }")
+    g.P("        if err := ch.PublishWithContext(ctx, \"\", d.ReplyTo, false, false, reply); err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.P("        if err := d.Ack(false); err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.P("    }")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s calls the %s methods served over AMQP, e.g. by", clientName, servName))
+    g.P(fmt.Sprintf("// Serve%sAMQP, publishing the requests to the queue %s and", servName, fullServName))
+    g.P("// matching the replies, on an exclusive reply queue, by correlation ID. It")
+    g.P(fmt.Sprintf("// is a %sImpl, safe for concurrent use.", servName))
+    g.P(fmt.Sprintf("type %s struct {", clientName))
+    g.P("    ch      *amqp091.Channel")
+    g.P("    replyTo string")
+    g.P("    timeout time.Duration")
+    g.P()
+    g.P("    mu      sync.Mutex")
+    g.P("    lastID  uint64                           // correlation ID of the last call")
+    g.P("    pending map[string]chan amqp091.Delivery // calls waiting for their reply, by correlation ID")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// New%s returns a client calling the methods over ch, failing the", clientName))
+    g.P("// calls not replied to within timeout. It declares the reply queue of the")
+    g.P("// client, deleted with ch.")
+    g.P(fmt.Sprintf("func New%s(ch *amqp091.Channel, timeout time.Duration) (*%s, error) {", clientName, clientName))
+    g.P("    q, err := ch.QueueDeclare(\"\", false, true, true, false, nil)")
+    g.P("    if err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P("    replies, err := ch.Consume(q.Name, \"\", true, true, false, false, nil)")
+    g.P("    if err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P(fmt.Sprintf("    c := &%s{ch: ch, replyTo: q.Name, timeout: timeout, pending: make(map[string]chan amqp091.Delivery)}", clientName))
+    g.P("    go func() {")
+    g.P("        for d := range replies {")
+    g.P("            c.mu.Lock()")
+    g.P("            reply := c.pending[d.CorrelationId]")
+    g.P("            c.mu.Unlock()")
+    g.P("            select {")
+    g.P("            case reply <- d:")
+    g.P("            default:")
+    g.P("                // The call timed out, or was already replied to.")
+    g.P("            }")
+    g.P("        }")
+    g.P("    }()")
+    g.P("    return c, nil")
+    g.P("}")
+    g.P()
+    for _, method := range methods {
+        methName := generator.CamelCase(method.GetName())
+        g.P(fmt.Sprintf("// %s calls %s with the serialized input, of type %s, and returns", methName, methName, g.typeName(method.GetInputType())))
+        g.P(fmt.Sprintf("// its serialized output, of type %s.", g.typeName(method.GetOutputType())))
+        g.P(fmt.Sprintf("func (c *%s) %s(input []byte) ([]byte, error) {", clientName, methName))
+        g.P(fmt.Sprintf("    return c.call(\"%s\", input)", method.GetName()))
+        g.P("}")
+        g.P()
+    }
+    g.P("// call publishes the request of the named method and waits for its reply,")
+    g.P("// returning its output, or the error message it carries.")
+    g.P(fmt.Sprintf("func (c *%s) call(method string, input []byte) ([]byte, error) {", clientName))
+    g.P("    ctx, cancel := context.WithTimeout(context.Background(), c.timeout)")
+    g.P("    defer cancel()")
+    g.P("    reply := make(chan amqp091.Delivery, 1)")
+    g.P("    c.mu.Lock()")
+    g.P("    c.lastID++")
+    g.P("    id := strconv.FormatUint(c.lastID, 10)")
+    g.P("    c.pending[id] = reply")
+    g.P("    c.mu.Unlock()")
+    g.P("    defer func() {")
+    g.P("        c.mu.Lock()")
+    g.P("        delete(c.pending, id)")
+    g.P("        c.mu.Unlock()")
+    g.P("    }()")
+    g.P("    req := amqp091.Publishing{Type: method, CorrelationId: id, ReplyTo: c.replyTo, Body: input}")
+    g.P(fmt.Sprintf("    if err := c.ch.PublishWithContext(ctx, \"\", \"%s\", false, false, req); err != nil {", fullServName))
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P("    select {")
+    g.P("    case d := <-reply:")
+    g.P(fmt.Sprintf("        if msg, ok := d.Headers[\"%s\"].(string); ok {", amqpErrorHeader))
+    g.P("            return nil, errors.New(msg)")
+    g.P("        }")
+    g.P("        return d.Body, nil")
+    g.P("    case <-ctx.Done():")
+    g.P("        return nil, ctx.Err()")
+    g.P("    }")
+    g.P("}")
+    g.P()
+}
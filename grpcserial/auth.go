@@ -0,0 +1,131 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// scopes returns the scopes required of the callers of method, given by
+// its (auth.scopes) option, or nil.
+func (g *grpcserial) scopes(method *pb.MethodDescriptorProto) []string {
+    return descutil.Scopes(g.gen, method)
+}
+
+// unwrapsCaller reports whether the serialized function of method unwraps
+// the caller from the serialmeta envelope of its input, to check its
+// scopes. The inputs of the bidirectional streaming methods carry no
+// envelope.
+func (g *grpcserial) unwrapsCaller(method *pb.MethodDescriptorProto) bool {
+    return len(g.scopes(method)) > 0 && !isBidi(method)
+}
+
+// hasScopes reports whether a method of service has an (auth.scopes)
+// option.
+func (g *grpcserial) hasScopes(service *pb.ServiceDescriptorProto) bool {
+    for _, method := range service.Method {
+        if len(g.scopes(method)) > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// wrapsCaller reports whether the handlers of service wrap the caller of
+// their requests in the serialmeta envelope of the inputs of the methods
+// with an (auth.scopes) option.
+func (g *grpcserial) wrapsCaller(service *pb.ServiceDescriptorProto) bool {
+    return g.hasScopes(service) && (g.http || g.jsonrpc || g.gateway && hasHTTPRules(service))
+}
+
+// generateAuth generates callerContext and unwrapCaller, unwrapping the
+// caller of a method with an (auth.scopes) option from the serialmeta
+// envelope of its input, unless extractContext or unwrapMetadata do, and
+// wrapCaller, its counterpart for the handlers of the service.
+func (g *grpcserial) generateAuth(service *pb.ServiceDescriptorProto) {
+    g.P("// callerContext returns ctx with the principal and scopes of the caller")
+    g.P("// carried by the metadata md of an input, as set by the host of the")
+    g.P("// serialized API under the serialmeta.PrincipalKey and serialmeta.ScopesKey")
+    g.P("// keys, the scopes separated by spaces.")
+    g.P("func callerContext(ctx context.Context, md serialmeta.MD) context.Context {")
+    g.P("    if principal, ok := md[serialmeta.PrincipalKey]; ok {")
+    g.P("        ctx = httprpc.WithPrincipal(ctx, principal)")
+    g.P("    }")
+    g.P("    if scopes, ok := md[serialmeta.ScopesKey]; ok {")
+    g.P("        ctx = httprpc.WithScopes(ctx, strings.Fields(scopes))")
+    g.P("    }")
+    g.P("    return ctx")
+    g.P("}")
+    g.P()
+    if !g.tracing && !g.metadata {
+        g.P("// unwrapCaller returns the input without its serialmeta envelope, if it")
+        g.P("// has one, and ctx with the caller the envelope carries.")
+        g.P("func unwrapCaller(ctx context.Context, input []byte) (context.Context, []byte, error) {")
+        g.P("    md, input, err := serialmeta.Unwrap(input)")
+        g.P("    if err != nil {")
+        g.P("        return ctx, nil, err")
+        g.P("    }")
+        g.P("    return callerContext(ctx, md), input, nil")
+        g.P("}")
+        g.P()
+    }
+    if g.wrapsCaller(service) {
+        g.P("// wrapCaller returns input in a serialmeta envelope carrying the principal")
+        g.P("// and scopes of ctx, if any, as set by the authentication of the requests")
+        g.P("// with httprpc.WithPrincipal and httprpc.WithScopes.")
+        g.P("func wrapCaller(ctx context.Context, input []byte) []byte {")
+        g.P("    md := make(serialmeta.MD)")
+        g.P("    if principal := httprpc.Principal(ctx); principal != \"\" {")
+        g.P("        md.Set(serialmeta.PrincipalKey, principal)")
+        g.P("    }")
+        g.P("    if scopes, ok := httprpc.Scopes(ctx); ok {")
+        g.P("        md.Set(serialmeta.ScopesKey, strings.Join(scopes, \" \"))")
+        g.P("    }")
+        g.P("    return serialmeta.Wrap(md, input)")
+        g.P("}")
+        g.P()
+    }
+}
+
+// generateCheckScopes generates the check of the scopes of the caller of
+// method of the service named fullServName, in the context ctx, assigning
+// its error with assign, e.g. "err =", and failing the serialized function
+// with the statement ret.
+func (g *grpcserial) generateCheckScopes(fullServName string, method *pb.MethodDescriptorProto, ctx, assign, ret string) {
+    g.P(fmt.Sprintf("    if %s httprpc.CheckScopes(%s, \"/%s/%s\", %s); err != nil {", assign, ctx, fullServName, method.GetName(), descutil.QuotedScopes(g.scopes(method))))
+    g.P("        " + ret)
+    g.P("    }")
+}
+
+// generateRefuseScopes generates the refusal of the calls of the
+// bidirectional streaming method of the service named fullServName if it
+// has an (auth.scopes) option: its inputs carry no envelope, hence no
+// caller whose scopes to check.
+func (g *grpcserial) generateRefuseScopes(fullServName string, method *pb.MethodDescriptorProto) {
+    if len(g.scopes(method)) == 0 {
+        return
+    }
+    g.P("    // in carries no caller whose scopes to check: the calls are refused.")
+    g.generateCheckScopes(fullServName, method, "context.Background()", "err :=", "return err")
+}
+
+// generateScopedCase generates the flagging of the calls of method as
+// scoped in the handlers of service, if it has an (auth.scopes) option.
+func (g *grpcserial) generateScopedCase(service *pb.ServiceDescriptorProto, method *pb.MethodDescriptorProto) {
+    if g.wrapsCaller(service) && len(g.scopes(method)) > 0 {
+        g.P("        scoped = true")
+    }
+}
+
+// generateWrapCaller generates the wrapping of the caller of ctx in the
+// input of the methods with an (auth.scopes) option, flagged by scoped, in
+// the handlers of service.
+func (g *grpcserial) generateWrapCaller(service *pb.ServiceDescriptorProto, ctx string) {
+    if !g.wrapsCaller(service) {
+        return
+    }
+    g.P("    if scoped {")
+    g.P(fmt.Sprintf("        input = wrapCaller(%s, input)", ctx))
+    g.P("    }")
+}
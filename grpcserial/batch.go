@@ -0,0 +1,242 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// generateBatch generates the batch envelope of service, <Service>BatchRequest
+// and <Service>BatchResponse, serialized as protobuf messages, and
+// DispatchBatch, serving the calls of a serialized <Service>BatchRequest,
+// one by one or in parallel, with a single call of the serialized API.
+func (g *grpcserial) generateBatch(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    requestName := servName + "BatchRequest"
+    responseName := servName + "BatchResponse"
+    callName := servName + "BatchCall"
+    resultName := servName + "BatchResult"
+
+    g.P(fmt.Sprintf("// %s is a call of a %s method in a %s.", callName, servName, requestName))
+    g.P(fmt.Sprintf("type %s struct {", callName))
+    g.P(fmt.Sprintf("    Method string // full name of the method, %s.<Method>", fullServName))
+    g.P("    Input  []byte // serialized input of the method")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s is a batch of calls of %s methods, made with a single call of", requestName, servName))
+    g.P("// DispatchBatch. It is serialized as the protobuf message:")
+    g.P("//")
+    g.P(fmt.Sprintf("//     message %s {", requestName))
+    g.P("//         message Call {")
+    g.P("//             string method = 1;")
+    g.P("//             bytes input = 2;")
+    g.P("//         }")
+    g.P("//         repeated Call calls = 1;")
+    g.P("//         bool parallel = 2;")
+    g.P("//     }")
+    g.P(fmt.Sprintf("type %s struct {", requestName))
+    g.P(fmt.Sprintf("    Calls    []%s", callName))
+    g.P("    Parallel bool // the calls run in parallel rather than in order")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s is the result of a call of a %s, its serialized output or its", resultName, requestName))
+    g.P("// error message.")
+    g.P(fmt.Sprintf("type %s struct {", resultName))
+    g.P("    Output []byte")
+    g.P("    Error  string")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s holds the results of the calls of a %s, in the", responseName, requestName))
+    g.P("// order of the calls. It is serialized as the protobuf message:")
+    g.P("//")
+    g.P(fmt.Sprintf("//     message %s {", responseName))
+    g.P("//         message Result {")
+    g.P("//             bytes output = 1;")
+    g.P("//             string error = 2;")
+    g.P("//         }")
+    g.P("//         repeated Result results = 1;")
+    g.P("//     }")
+    g.P(fmt.Sprintf("type %s struct {", responseName))
+    g.P(fmt.Sprintf("    Results []%s", resultName))
+    g.P("}")
+    g.P()
+    g.P("// Marshal returns r serialized.")
+    g.P(fmt.Sprintf("func (r *%s) Marshal() []byte {", requestName))
+    g.P("    var b []byte")
+    g.P("    for _, call := range r.Calls {")
+    g.P("        var c []byte")
+    g.P("        c = appendBatchField(c, 1, []byte(call.Method))")
+    g.P("        c = appendBatchField(c, 2, call.Input)")
+    g.P("        b = appendBatchField(b, 1, c)")
+    g.P("    }")
+    g.P("    if r.Parallel {")
+    g.P("        b = append(b, 2<<3, 1)")
+    g.P("    }")
+    g.P("    return b")
+    g.P("}")
+    g.P()
+    g.P("// Unmarshal decodes the serialized b into r.")
+    g.P(fmt.Sprintf("func (r *%s) Unmarshal(b []byte) error {", requestName))
+    g.P(fmt.Sprintf("    *r = %s{}", requestName))
+    g.P("    return readBatchFields(b, func(num int, value []byte, x uint64) error {")
+    g.P("        switch num {")
+    g.P("        case 1:")
+    g.P(fmt.Sprintf("            var call %s", callName))
+    g.P("            err := readBatchFields(value, func(num int, value []byte, x uint64) error {")
+    g.P("                switch num {")
+    g.P("                case 1:")
+    g.P("                    call.Method = string(value)")
+    g.P("                case 2:")
+    g.P("                    call.Input = value")
+    g.P("                }")
+    g.P("                return nil")
+    g.P("            })")
+    g.P("            r.Calls = append(r.Calls, call)")
+    g.P("            return err")
+    g.P("        case 2:")
+    g.P("            r.Parallel = x != 0")
+    g.P("        }")
+    g.P("        return nil")
+    g.P("    })")
+    g.P("}")
+    g.P()
+    g.P("// Marshal returns r serialized.")
+    g.P(fmt.Sprintf("func (r *%s) Marshal() []byte {", responseName))
+    g.P("    var b []byte")
+    g.P("    for _, result := range r.Results {")
+    g.P("        var c []byte")
+    g.P("        c = appendBatchField(c, 1, result.Output)")
+    g.P("        c = appendBatchField(c, 2, []byte(result.Error))")
+    g.P("        b = appendBatchField(b, 1, c)")
+    g.P("    }")
+    g.P("    return b")
+    g.P("}")
+    g.P()
+    g.P("// Unmarshal decodes the serialized b into r.")
+    g.P(fmt.Sprintf("func (r *%s) Unmarshal(b []byte) error {", responseName))
+    g.P(fmt.Sprintf("    *r = %s{}", responseName))
+    g.P("    return readBatchFields(b, func(num int, value []byte, x uint64) error {")
+    g.P("        if num != 1 {")
+    g.P("            return nil")
+    g.P("        }")
+    g.P(fmt.Sprintf("        var result %s", resultName))
+    g.P("        err := readBatchFields(value, func(num int, value []byte, x uint64) error {")
+    g.P("            switch num {")
+    g.P("            case 1:")
+    g.P("                result.Output = value")
+    g.P("            case 2:")
+    g.P("                result.Error = string(value)")
+    g.P("            }")
+    g.P("            return nil")
+    g.P("        })")
+    g.P("        r.Results = append(r.Results, result)")
+    g.P("        return err")
+    g.P("    })")
+    g.P("}")
+    g.P()
+    g.P("// appendBatchField appends the length-delimited field num of value to b.")
+    g.P("func appendBatchField(b []byte, num int, value []byte) []byte {")
+    g.P("    var buf [binary.MaxVarintLen64]byte")
+    g.P("    b = append(b, buf[:binary.PutUvarint(buf[:], uint64(num)<<3|2)]...)")
+    g.P("    b = append(b, buf[:binary.PutUvarint(buf[:], uint64(len(value)))]...)")
+    g.P("    return append(b, value...)")
+    g.P("}")
+    g.P()
+    g.P("// readBatchFields calls f with the number of each field of the serialized")
+    g.P("// message b and its value: its payload if it is length-delimited, and its")
+    g.P("// value as x if it is a varint.")
+    g.P("func readBatchFields(b []byte, f func(num int, value []byte, x uint64) error) error {")
+    g.P("    for len(b) > 0 {")
+    g.P("        tag, n := binary.Uvarint(b)")
+    g.P("        if n <= 0 {")
+    g.P("            return errors.New(\"batch: bad field tag\")")
+    g.P("        }")
+    g.P("        b = b[n:]")
+    g.P("        var value []byte")
+    g.P("        var x uint64")
+    g.P("        switch tag & 7 {")
+    g.P("        case 0:")
+    g.P("            if x, n = binary.Uvarint(b); n <= 0 {")
+    g.P("                return errors.New(\"batch: bad varint\")")
+    g.P("            }")
+    g.P("            b = b[n:]")
+    g.P("        case 1:")
+    g.P("            if len(b) < 8 {")
+    g.P("                return io.ErrUnexpectedEOF")
+    g.P("            }")
+    g.P("            b = b[8:]")
+    g.P("        case 2:")
+    g.P("            size, n := binary.Uvarint(b)")
+    g.P("            if n <= 0 || size > uint64(len(b)-n) {")
+    g.P("                return io.ErrUnexpectedEOF")
+    g.P("            }")
+    g.P("            value, b = b[n:n+int(size)], b[n+int(size):]")
+    g.P("        case 5:")
+    g.P("            if len(b) < 4 {")
+    g.P("                return io.ErrUnexpectedEOF")
+    g.P("            }")
+    g.P("            b = b[4:]")
+    g.P("        default:")
+    g.P("            return fmt.Errorf(\"batch: unsupported wire type %d\", tag&7)")
+    g.P("        }")
+    g.P("        if err := f(int(tag>>3), value, x); err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.P("    }")
+    g.P("    return nil")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// input is a serialized %s", requestName))
+    g.P(fmt.Sprintf("// output is a serialized %s", responseName))
+    g.P("// DispatchBatch makes the calls of the batch, in order or, if it is parallel,")
+    g.P("// on up to GOMAXPROCS goroutines, and returns their results, which are")
+    g.P("// the error of a call failing rather than the error of DispatchBatch.")
+    g.P("// @protopy")
+    g.P("func DispatchBatch(input []byte) (output []byte, err error) {")
+    g.P(fmt.Sprintf("    var req %s", requestName))
+    g.P("    if err = req.Unmarshal(input); err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P(fmt.Sprintf("    resp := %s{Results: make([]%s, len(req.Calls))}", responseName, resultName))
+    g.P("    run := func(i int) {")
+    g.P("        var call func(input []byte) ([]byte, error)")
+    g.P("        switch req.Calls[i].Method {")
+    for _, method := range unaryMethods(service) {
+        g.P(fmt.Sprintf("        case %q:", fullServName+"."+method.GetName()))
+        g.P(fmt.Sprintf("            call = %s", generator.CamelCase(method.GetName())))
+    }
+    g.P("        default:")
+    g.P(fmt.Sprintf("            resp.Results[i].Error = fmt.Sprintf(\"%s: unknown method %%q\", req.Calls[i].Method)", fullServName))
+    g.P("            return")
+    g.P("        }")
+    g.P("        output, err := call(req.Calls[i].Input)")
+    g.P("        if err != nil {")
+    g.P("            resp.Results[i].Error = err.Error()")
+    g.P("            return")
+    g.P("        }")
+    g.P("        resp.Results[i].Output = output")
+    g.P("    }")
+    g.P("    if !req.Parallel {")
+    g.P("        for i := range req.Calls {")
+    g.P("            run(i)")
+    g.P("        }")
+    g.P("        return resp.Marshal(), nil")
+    g.P("    }")
+    g.P("    var wg sync.WaitGroup")
+    g.P("    slots := make(chan struct{}, runtime.GOMAXPROCS(0))")
+    g.P("    for i := range req.Calls {")
+    g.P("        wg.Add(1)")
+    g.P("        slots <- struct{}{}")
+    g.P("        go func(i int) {")
+    g.P("            defer func() {")
+    g.P("                <-slots")
+    g.P("                wg.Done()")
+    g.P("            }()")
+    g.P("            run(i)")
+    g.P("        }(i)")
+    g.P("    }")
+    g.P("    wg.Wait()")
+    g.P("    return resp.Marshal(), nil")
+    g.P("}")
+    g.P()
+}
@@ -0,0 +1,213 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// isBidi reports whether method is a bidirectional streaming method, whose
+// serialized function exchanges its inputs and outputs over channels.
+func isBidi(method *pb.MethodDescriptorProto) bool {
+    return method.GetClientStreaming() && method.GetServerStreaming()
+}
+
+// generateBidi generates the serialized function of the bidirectional
+// streaming method: it receives the serialized inputs from in until it is
+// closed, sends the serialized outputs to out, and closes out when it
+// returns, so that the caller reads out until it is closed and then gets
+// its error. With tracing=true, the whole exchange is a span of the service
+// named fullServName, without parent: in carries no envelope, with
+// prometheus=true, a call recorded in the metrics, and with logging=true, a
+// call logged. With recover=true, its panics are recovered into its error.
+// With a (grpcserial.timeout) option, the exchange is bounded by its timeout,
+// and with an (auth.scopes) option, it is refused: in carries no caller.
+// With interceptors=true, it is called through the interceptors, which
+// get no input.
+func (g *grpcserial) generateBidi(fullServName string, method *pb.MethodDescriptorProto) {
+    methodName := generator.CamelCase(method.GetName())
+    inputTypeName := g.typeName(method.GetInputType())
+    inputVarName := unexport(inputTypeName)
+    outputTypeName := g.typeName(method.GetOutputType())
+    outputVarName := unexport(outputTypeName)
+
+    g.P(fmt.Sprintf("// every input received from in is a serialized protobuf object of type %s", inputTypeName))
+    g.P(fmt.Sprintf("// every output sent to out is a serialized protobuf object of type %s", outputTypeName))
+    g.P(fmt.Sprintf("// %s reads in until it is closed, and closes out when it returns: the", methodName))
+    g.P("// caller closes in after its last input and reads out until it is closed,")
+    g.P("// then stops sending to in.")
+    g.generateIntercept(fullServName, method)
+    if g.countsSizes() || g.recover {
+        g.P(fmt.Sprintf("func %s(%sin <-chan []byte, out chan<- []byte) (err error) {", g.serialFuncName(method), g.interceptedParam()))
+    } else {
+        g.P(fmt.Sprintf("func %s(%sin <-chan []byte, out chan<- []byte) error {", g.serialFuncName(method), g.interceptedParam()))
+    }
+    if g.generics {
+        if g.recover {
+            g.generateRecoverPanic(fullServName, method.GetName())
+        }
+        g.generateRefuseScopes(fullServName, method)
+        g.P(fmt.Sprintf("    return HandleBidi(in, out, func(ctx context.Context, recv func() (*pb.%s, error), send func(*pb.%s) error) error {", inputTypeName, outputTypeName))
+        g.generateTimeout("        ", "ctx", method)
+        g.P(fmt.Sprintf("        // TODO : implement %s(ctx context.Context, recv func() (*pb.%s, error), send func(*pb.%s) error) error", methodName, inputTypeName, outputTypeName))
+        g.P(fmt.Sprintf("        // return your%sImplementation(ctx, recv, send)", methodName))
+        g.P()
+        g.generateEcho("        ", outputTypeName)
+        g.P("    })")
+        g.P("}")
+        g.P()
+        return
+    }
+    if !g.interceptors {
+        g.P("    defer close(out)")
+    }
+    if g.countsSizes() {
+        g.P("    requestSize, responseSize := 0, 0")
+    }
+    if g.prometheus {
+        g.generateObserve(fullServName, method.GetName(), "requestSize", "responseSize")
+    }
+    if g.tracing {
+        g.P(fmt.Sprintf("    ctx, span := startSpan(%s, %q, %q)", g.parentCtx(), fullServName, method.GetName()))
+        g.P("    defer func() { endSpan(span, requestSize, responseSize, err) }()")
+    }
+    if g.logging {
+        g.generateLogExit(fullServName, method.GetName(), "requestSize", "responseSize")
+    }
+    if g.recover {
+        g.generateRecoverPanic(fullServName, method.GetName())
+    }
+    g.generateRefuseScopes(fullServName, method)
+    g.generateTimeout("    ", g.serialCtx(method), method)
+    g.P(fmt.Sprintf("    recv := func() (*pb.%s, error) {", inputTypeName))
+    g.P("        input, ok := <-in")
+    g.P("        if !ok {")
+    g.P("            return nil, io.EOF")
+    g.P("        }")
+    if g.countsSizes() {
+        g.P("        requestSize += len(input)")
+    }
+    if g.schemaRegistry {
+        g.P(fmt.Sprintf("        if stripped, err := stripSchemaHeader(input, %s); err != nil {", g.schemaArgs(method.GetInputType())))
+        g.P("            return nil, err")
+        g.P("        } else {")
+        g.P("            input = stripped")
+        g.P("        }")
+    }
+    g.P(fmt.Sprintf("        %s := new(pb.%s)", inputVarName, inputTypeName))
+    if g.telemetry {
+        g.P("        decodeStart := time.Now()")
+    }
+    if len(g.parallelFields(method.GetInputType())) > 0 {
+        g.P(fmt.Sprintf("        err := unmarshal%s(input, %s)", inputTypeName, inputVarName))
+    } else {
+        g.P(fmt.Sprintf("        err := proto.Unmarshal(input, %s)", inputVarName))
+    }
+    if g.telemetry {
+        g.P(fmt.Sprintf("        %sStats.decoded(len(input), decodeStart, err)", inputVarName))
+    }
+    g.P("        if err != nil {")
+    g.P("            return nil, err")
+    g.P("        }")
+    if g.validate {
+        for _, hook := range []string{"Validate", "CustomValidate"} {
+            g.P(fmt.Sprintf("        if v, ok := interface{}(%s).(interface{ %s() error }); ok {", inputVarName, hook))
+            g.P(fmt.Sprintf("            if err := v.%s(); err != nil {", hook))
+            g.P("                return nil, err")
+            g.P("            }")
+            g.P("        }")
+        }
+    }
+    g.P(fmt.Sprintf("        return %s, nil", inputVarName))
+    g.P("    }")
+    g.P(fmt.Sprintf("    send := func(%s *pb.%s) error {", outputVarName, outputTypeName))
+    if g.telemetry {
+        g.P("        encodeStart := time.Now()")
+    }
+    if g.pool {
+        g.P(fmt.Sprintf("        output, err := marshalPooled(%s)", outputVarName))
+    } else {
+        g.P(fmt.Sprintf("        output, err := proto.Marshal(%s)", outputVarName))
+    }
+    if g.telemetry {
+        g.P(fmt.Sprintf("        %sStats.encoded(len(output), encodeStart, err)", outputVarName))
+    }
+    g.P("        if err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.generatePrependSchemaHeader(method.GetOutputType())
+    if g.countsSizes() {
+        g.P("        responseSize += len(output)")
+    }
+    g.P("        out <- output")
+    g.P("        return nil")
+    g.P("    }")
+    g.P()
+    g.P(fmt.Sprintf("    // TODO : implement %s(%srecv func() (*pb.%s, error), send func(*pb.%s) error) error", methodName, g.ctxParam(method), inputTypeName, outputTypeName))
+    g.P(fmt.Sprintf("    // return your%sImplementation(%srecv, send)", methodName, g.ctxArg(method)))
+    g.P()
+    g.generateUnusedCtx(method)
+    g.generateEcho("    ", outputTypeName)
+    g.P("}")
+    g.P()
+}
+
+// generateEcho generates the placeholder implementation of a bidirectional
+// streaming method, sending an empty output per input, indented by indent.
+func (g *grpcserial) generateEcho(indent, outputTypeName string) {
+    g.P(indent + "for {")
+    g.P(indent + "    if _, err := recv(); err == io.EOF {")
+    g.P(indent + "        return nil")
+    g.P(indent + "    } else if err != nil {")
+    g.P(indent + "        return err")
+    g.P(indent + "    }")
+    g.P(indent + fmt.Sprintf("    if err := send(new(pb.%s)); err != nil {", outputTypeName))
+    g.P(indent + "        return err")
+    g.P(indent + "    }")
+    g.P(indent + "}")
+}
+
+// generateHandleBidi generates HandleBidi, the counterpart of Handle for the
+// bidirectional streaming methods.
+func (g *grpcserial) generateHandleBidi() {
+    g.P("// HandleBidi calls fn with a recv function decoding the serialized inputs")
+    g.P("// received from in into new Reqs, returning io.EOF once in is closed, and a")
+    g.P("// send function sending the serialized Resps it is given to out, which is")
+    g.P("// closed when fn returns. The serialized functions of the bidirectional")
+    g.P("// streaming methods below call it.")
+    g.P("func HandleBidi[Req, Resp proto.Message](in <-chan []byte, out chan<- []byte, fn func(context.Context, func() (Req, error), func(Resp) error) error) error {")
+    g.P("    defer close(out)")
+    g.P("    recv := func() (Req, error) {")
+    g.P("        var req Req")
+    g.P("        input, ok := <-in")
+    g.P("        if !ok {")
+    g.P("            return req, io.EOF")
+    g.P("        }")
+    g.P("        req = reflect.New(reflect.TypeOf(req).Elem()).Interface().(Req)")
+    g.P("        if err := proto.Unmarshal(input, req); err != nil {")
+    g.P("            return req, err")
+    g.P("        }")
+    if g.validate {
+        for _, hook := range []string{"Validate", "CustomValidate"} {
+            g.P(fmt.Sprintf("        if v, ok := interface{}(req).(interface{ %s() error }); ok {", hook))
+            g.P(fmt.Sprintf("            if err := v.%s(); err != nil {", hook))
+            g.P("                return req, err")
+            g.P("            }")
+            g.P("        }")
+        }
+    }
+    g.P("        return req, nil")
+    g.P("    }")
+    g.P("    send := func(resp Resp) error {")
+    g.P("        output, err := proto.Marshal(resp)")
+    g.P("        if err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.P("        out <- output")
+    g.P("        return nil")
+    g.P("    }")
+    g.P("    return fn(context.Background(), recv, send)")
+    g.P("}")
+    g.P()
+}
@@ -0,0 +1,83 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// generateChannels generates the channel-based API of service: a
+// <Method>Async function per method, queuing its serialized calls to a
+// worker pool started on the first call and returning a channel receiving
+// their result, the submission blocking while the queue of the pool is
+// full.
+func (g *grpcserial) generateChannels(service *pb.ServiceDescriptorProto) {
+    g.P("// Result is the serialized output of a call made through an Async function,")
+    g.P("// or its error.")
+    g.P("type Result struct {")
+    g.P("    Output []byte")
+    g.P("    Err    error")
+    g.P("}")
+    g.P()
+    g.P("// asyncCall is a serialized call queued to the worker pool.")
+    g.P("type asyncCall struct {")
+    g.P("    ctx    context.Context")
+    g.P("    fn     func(input []byte) ([]byte, error)")
+    g.P("    input  []byte")
+    g.P("    result chan<- Result")
+    g.P("}")
+    g.P()
+    g.P("// AsyncWorkers is the number of workers serving the calls of the Async")
+    g.P("// functions, and AsyncQueueSize the number of calls queued ahead of them,")
+    g.P("// beyond which the Async functions block. They are read on the first call.")
+    g.P("var (")
+    g.P("    AsyncWorkers   = runtime.NumCPU()")
+    g.P("    AsyncQueueSize = 64")
+    g.P(")")
+    g.P()
+    g.P("var (")
+    g.P("    asyncOnce  sync.Once")
+    g.P("    asyncCalls chan asyncCall")
+    g.P(")")
+    g.P()
+    g.P("// submitAsync queues the call of fn with input to the worker pool, started")
+    g.P("// on the first call, blocking while the queue is full or until ctx is done,")
+    g.P("// and returns the channel receiving its result. The calls whose ctx is done")
+    g.P("// before a worker takes them are not made.")
+    g.P("func submitAsync(ctx context.Context, fn func(input []byte) ([]byte, error), input []byte) <-chan Result {")
+    g.P("    asyncOnce.Do(func() {")
+    g.P("        asyncCalls = make(chan asyncCall, AsyncQueueSize)")
+    g.P("        for i := 0; i < AsyncWorkers; i++ {")
+    g.P("            go func() {")
+    g.P("                for c := range asyncCalls {")
+    g.P("                    if err := c.ctx.Err(); err != nil {")
+    g.P("                        c.result <- Result{Err: err}")
+    g.P("                        continue")
+    g.P("                    }")
+    g.P("                    output, err := c.fn(c.input)")
+    g.P("                    c.result <- Result{Output: output, Err: err}")
+    g.P("                }")
+    g.P("            }()")
+    g.P("        }")
+    g.P("    })")
+    g.P("    result := make(chan Result, 1)")
+    g.P("    select {")
+    g.P("    case asyncCalls <- asyncCall{ctx, fn, input, result}:")
+    g.P("    case <-ctx.Done():")
+    g.P("        result <- Result{Err: ctx.Err()}")
+    g.P("    }")
+    g.P("    return result")
+    g.P("}")
+    g.P()
+    for _, method := range unaryMethods(service) {
+        methName := generator.CamelCase(method.GetName())
+        g.P(fmt.Sprintf("// %sAsync queues the call of %s with the serialized input, of type", methName, methName))
+        g.P(fmt.Sprintf("// %s, to the worker pool, blocking while its queue is full, and", g.typeName(method.GetInputType())))
+        g.P("// returns the channel receiving its result, which need not be read.")
+        g.P(fmt.Sprintf("func %sAsync(ctx context.Context, input []byte) <-chan Result {", methName))
+        g.P(fmt.Sprintf("    return submitAsync(ctx, %s, input)", methName))
+        g.P("}")
+        g.P()
+    }
+}
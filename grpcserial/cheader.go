@@ -0,0 +1,84 @@
+package grpcserial
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// generateCHeader returns a C header declaring the functions exported with
+// cgo by the example implementations of the services of file, when built
+// with -buildmode=c-shared or c-archive. name is the output name of the
+// header, from which its include guard is derived.
+func (g *grpcserial) generateCHeader(file *generator.FileDescriptor, name string) string {
+    guard := strings.Map(func(r rune) rune {
+        switch {
+        case 'a' <= r && r <= 'z':
+            return r - 'a' + 'A'
+        case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+            return r
+        }
+        return '_'
+    }, name) + "_"
+
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "// Code generated by protoc-gen-go. DO NOT EDIT.\n")
+    fmt.Fprintf(&b, "// source: %s\n", file.GetName())
+    fmt.Fprintf(&b, "\n#ifndef %s\n#define %s\n", guard, guard)
+    fmt.Fprintf(&b, "\n#include <stddef.h>\n#include <stdint.h>\n")
+    fmt.Fprintf(&b, "\n#ifdef __cplusplus\nextern \"C\" {\n#endif\n")
+    for _, service := range file.FileDescriptorProto.Service {
+        servName := generator.CamelCase(service.GetName())
+        fmt.Fprintf(&b, "\n// %s serialized API.\n", servName)
+        fmt.Fprintf(&b, "//\n")
+        fmt.Fprintf(&b, "// Each function takes a serialized protobuf input and, on success, returns 0\n")
+        fmt.Fprintf(&b, "// and stores the serialized protobuf output in *output. On failure, it returns\n")
+        fmt.Fprintf(&b, "// -1 and stores the error message in *output instead. In both cases, *output\n")
+        fmt.Fprintf(&b, "// must be released with %s_Free.\n", servName)
+        for _, method := range unaryMethods(service) {
+            fmt.Fprintf(&b, "\n// input is a serialized protobuf object of type %s\n", g.typeName(method.GetInputType()))
+            fmt.Fprintf(&b, "// output is a serialized protobuf object of type %s\n", g.typeName(method.GetOutputType()))
+            fmt.Fprintf(&b, "extern int %s_%s(uint8_t* input, size_t input_len, uint8_t** output, size_t* output_len);\n",
+                servName, generator.CamelCase(method.GetName()))
+        }
+        fmt.Fprintf(&b, "\n// %s_Free releases an output of the %s functions.\n", servName, servName)
+        fmt.Fprintf(&b, "extern void %s_Free(void* p);\n", servName)
+    }
+    fmt.Fprintf(&b, "\n#ifdef __cplusplus\n}\n#endif\n")
+    fmt.Fprintf(&b, "\n#endif // %s\n", guard)
+    return b.String()
+}
+
+// generateExports generates the cgo exports of the serialized API of
+// service, declared by the C header companion.
+func (g *grpcserial) generateExports(service *pb.ServiceDescriptorProto, servName string) {
+    for _, method := range unaryMethods(service) {
+        methodName := generator.CamelCase(method.GetName())
+        g.P(fmt.Sprintf("//export %s_%s", servName, methodName))
+        g.P(fmt.Sprintf("func %s_%s(input *C.uint8_t, inputLen C.size_t, output **C.uint8_t, outputLen *C.size_t) C.int {", servName, methodName))
+        g.P(fmt.Sprintf("    return exportCall(%s, input, inputLen, output, outputLen)", methodName))
+        g.P("}")
+        g.P()
+    }
+    g.P(fmt.Sprintf("//export %s_Free", servName))
+    g.P(fmt.Sprintf("func %s_Free(p unsafe.Pointer) {", servName))
+    g.P("    C.free(p)")
+    g.P("}")
+    g.P()
+    g.P("// exportCall calls a method of the serialized API on its C arguments.")
+    g.P("// The output, or the error message on failure, is allocated with malloc.")
+    g.P("func exportCall(call func(input []byte) (output []byte, err error), input *C.uint8_t, inputLen C.size_t, output **C.uint8_t, outputLen *C.size_t) C.int {")
+    g.P("    out, err := call(C.GoBytes(unsafe.Pointer(input), C.int(inputLen)))")
+    g.P("    status := C.int(0)")
+    g.P("    if err != nil {")
+    g.P("        out, status = []byte(err.Error()), -1")
+    g.P("    }")
+    g.P("    *output = (*C.uint8_t)(C.CBytes(out))")
+    g.P("    *outputLen = C.size_t(len(out))")
+    g.P("    return status")
+    g.P("}")
+    g.P()
+}
@@ -0,0 +1,82 @@
+package grpcserial
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// companionKinds lists the companion artifacts the companions parameter
+// may select, by name.
+var companionKinds = map[string]string{
+    "py": "Python wrappers over the serialized API",
+    "ts": "TypeScript definitions of the JSON mapping of the messages",
+    "h":  "C header of the serialized API exported with cgo",
+    "rs": "Rust bindings of the serialized API exported with cgo",
+
+    "java": "Java classes of the serialized API exported with JNI",
+
+    "postman": "Postman collection of the requests to the http.Handler",
+    "grpcurl": "grpcurl scripts calling the methods of the services",
+}
+
+// companionsParam parses the companions parameter, a "+"-separated list of
+// companion artifact kinds.
+func (g *grpcserial) companionsParam() map[string]bool {
+    companions := make(map[string]bool)
+    v := g.gen.Param["companions"]
+    if v == "" {
+        return companions
+    }
+    for _, kind := range strings.Split(v, "+") {
+        if _, ok := companionKinds[kind]; !ok {
+            g.gen.Fail(fmt.Sprintf(`unknown companion %q: want "py", "ts", "h", "rs", "java", "postman" or "grpcurl"`, kind))
+        }
+        companions[kind] = true
+    }
+    if companions["postman"] && !g.http {
+        g.gen.Fail("the postman companion needs the http parameter")
+    }
+    return companions
+}
+
+// cgoExports reports whether the example implementations export the
+// serialized API with cgo, for the C header or the Rust bindings.
+func (g *grpcserial) cgoExports() bool {
+    return g.companions["h"] || g.companions["rs"]
+}
+
+// generateCompanions writes the companion artifacts of file next to its
+// generated Go file, so that the consumers of the serialized API in other
+// languages are generated in the same pass as the Go side.
+func (g *grpcserial) generateCompanions(file *generator.FileDescriptor) {
+    f := file.FileDescriptorProto
+    if g.companions["py"] && len(f.Service) > 0 {
+        descutil.AddFile(g.gen, descutil.OutputName(g.gen, f, "_serial.py"), g.generatePython(file))
+    }
+    if g.companions["ts"] && (len(f.MessageType) > 0 || len(f.EnumType) > 0) {
+        descutil.AddFile(g.gen, descutil.OutputName(g.gen, f, ".d.ts"), g.generateTypeScript(file))
+    }
+    if g.companions["h"] && len(f.Service) > 0 {
+        name := descutil.OutputName(g.gen, f, "_serial.h")
+        descutil.AddFile(g.gen, name, g.generateCHeader(file, name))
+    }
+    if g.companions["rs"] && len(f.Service) > 0 {
+        descutil.AddFile(g.gen, descutil.OutputName(g.gen, f, "_serial.rs"), g.generateRust(file))
+    }
+    if g.companions["java"] {
+        for _, service := range f.Service {
+            descutil.AddFile(g.gen, g.javaFileName(file, service), g.generateJava(file, service))
+        }
+    }
+    if g.companions["postman"] && len(f.Service) > 0 {
+        descutil.AddFile(g.gen, descutil.OutputName(g.gen, f, ".postman_collection.json"), g.generatePostman(file))
+    }
+    if g.companions["grpcurl"] {
+        for i, service := range f.Service {
+            descutil.AddFile(g.gen, g.grpcurlScriptName(file, service), g.generateGrpcurl(file, i))
+        }
+    }
+}
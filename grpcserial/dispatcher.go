@@ -0,0 +1,125 @@
+package grpcserial
+
+import (
+    "fmt"
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// maxConcurrency returns the limit of the concurrent calls of method given
+// by its custom integer method option max_concurrency, or 0 if it has none.
+func (g *grpcserial) maxConcurrency(method *pb.MethodDescriptorProto) int64 {
+    ext := descutil.Extension(g.gen, ".google.protobuf.MethodOptions", "max_concurrency")
+    if ext == nil {
+        return 0
+    }
+    values := descutil.OptionValues(g.gen, descutil.Options(method.Options), ext)
+    if len(values) == 0 {
+        return 0
+    }
+    n, err := strconv.ParseInt(values[0], 10, 64)
+    if err != nil || n <= 0 {
+        g.gen.Fail(fmt.Sprintf("invalid max_concurrency option %s of %s: want a positive integer", values[0], method.GetName()))
+    }
+    return n
+}
+
+// generateDispatcher generates <Service>Dispatcher, routing the serialized
+// calls of the methods of service, by their full name, to a bounded pool of
+// workers, the methods with a max_concurrency option having no more calls
+// running at once.
+func (g *grpcserial) generateDispatcher(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    dispatcherName := servName + "Dispatcher"
+    limitsName := unexport(servName) + "MaxConcurrency"
+
+    g.P(fmt.Sprintf("// %s maps the full names of the %s methods with a (max_concurrency)", limitsName, servName))
+    g.P("// option to the number of their calls a dispatcher runs at once.")
+    g.P(fmt.Sprintf("var %s = map[string]int{", limitsName))
+    for _, method := range unaryMethods(service) {
+        if n := g.maxConcurrency(method); n > 0 {
+            g.P(fmt.Sprintf("    %q: %d,", fullServName+"."+method.GetName(), n))
+        }
+    }
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s runs the serialized calls of the %s methods on a bounded pool", dispatcherName, servName))
+    g.P("// of workers, the methods with a (max_concurrency) option having no more")
+    g.P("// calls running at once, the others waiting for their turn without taking a")
+    g.P("// worker. It is safe for concurrent use.")
+    g.P(fmt.Sprintf("type %s struct {", dispatcherName))
+    g.P("    calls  chan func()")
+    g.P("    limits map[string]chan struct{}")
+    g.P("    wg     sync.WaitGroup")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// New%s returns a dispatcher running the calls on workers workers,", dispatcherName))
+    g.P("// which it starts. Close stops them.")
+    g.P(fmt.Sprintf("func New%s(workers int) *%s {", dispatcherName, dispatcherName))
+    g.P(fmt.Sprintf("    d := &%s{calls: make(chan func()), limits: make(map[string]chan struct{})}", dispatcherName))
+    g.P(fmt.Sprintf("    for method, n := range %s {", limitsName))
+    g.P("        d.limits[method] = make(chan struct{}, n)")
+    g.P("    }")
+    g.P("    d.wg.Add(workers)")
+    g.P("    for i := 0; i < workers; i++ {")
+    g.P("        go func() {")
+    g.P("            defer d.wg.Done()")
+    g.P("            for call := range d.calls {")
+    g.P("                call()")
+    g.P("            }")
+    g.P("        }()")
+    g.P("    }")
+    g.P("    return d")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// Dispatch calls the method of the given full name, %s.<Method>,", fullServName))
+    g.P("// with the serialized input on a worker and returns its serialized output,")
+    g.P("// blocking until it returns. It fails with the error of ctx if ctx is done")
+    g.P("// before a worker takes the call, which then is not made.")
+    g.P(fmt.Sprintf("func (d *%s) Dispatch(ctx context.Context, method string, input []byte) ([]byte, error) {", dispatcherName))
+    g.P("    var fn func(input []byte) ([]byte, error)")
+    g.P("    switch method {")
+    for _, method := range unaryMethods(service) {
+        g.P(fmt.Sprintf("    case %q:", fullServName+"."+method.GetName()))
+        g.P(fmt.Sprintf("        fn = %s", generator.CamelCase(method.GetName())))
+    }
+    g.P("    default:")
+    g.P(fmt.Sprintf("        return nil, fmt.Errorf(\"%s: unknown method %%q\", method)", fullServName))
+    g.P("    }")
+    g.P("    if err := ctx.Err(); err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P("    if limit := d.limits[method]; limit != nil {")
+    g.P("        select {")
+    g.P("        case limit <- struct{}{}:")
+    g.P("            defer func() { <-limit }()")
+    g.P("        case <-ctx.Done():")
+    g.P("            return nil, ctx.Err()")
+    g.P("        }")
+    g.P("    }")
+    g.P("    var output []byte")
+    g.P("    var err error")
+    g.P("    done := make(chan struct{})")
+    g.P("    call := func() {")
+    g.P("        defer close(done)")
+    g.P("        output, err = fn(input)")
+    g.P("    }")
+    g.P("    select {")
+    g.P("    case d.calls <- call:")
+    g.P("    case <-ctx.Done():")
+    g.P("        return nil, ctx.Err()")
+    g.P("    }")
+    g.P("    <-done")
+    g.P("    return output, err")
+    g.P("}")
+    g.P()
+    g.P("// Close stops the workers once the calls they run have returned.")
+    g.P("// Dispatch must not be called after Close.")
+    g.P(fmt.Sprintf("func (d *%s) Close() {", dispatcherName))
+    g.P("    close(d.calls)")
+    g.P("    d.wg.Wait()")
+    g.P("}")
+    g.P()
+}
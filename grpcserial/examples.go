@@ -0,0 +1,162 @@
+package grpcserial
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/httprpc"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// wellKnownExamples maps the well-known types having a special JSON mapping
+// to an example of their JSON value.
+var wellKnownExamples = map[string]string{
+    ".google.protobuf.Any":         `{"@type":"type.googleapis.com/google.protobuf.Empty","value":{}}`,
+    ".google.protobuf.Duration":    `"1s"`,
+    ".google.protobuf.Empty":       `{}`,
+    ".google.protobuf.FieldMask":   `""`,
+    ".google.protobuf.ListValue":   `[]`,
+    ".google.protobuf.Struct":      `{}`,
+    ".google.protobuf.Timestamp":   `"1970-01-01T00:00:00Z"`,
+    ".google.protobuf.Value":       `null`,
+    ".google.protobuf.NullValue":   `null`,
+    ".google.protobuf.BoolValue":   `false`,
+    ".google.protobuf.BytesValue":  `""`,
+    ".google.protobuf.DoubleValue": `0`,
+    ".google.protobuf.FloatValue":  `0`,
+    ".google.protobuf.Int32Value":  `0`,
+    ".google.protobuf.Int64Value":  `"0"`,
+    ".google.protobuf.StringValue": `""`,
+    ".google.protobuf.UInt32Value": `0`,
+    ".google.protobuf.UInt64Value": `"0"`,
+}
+
+// isInt64Wrapper reports whether typ is the wrapper of a 64-bit integer,
+// whose JSON value is the one of the integer.
+func isInt64Wrapper(typ string) bool {
+    return typ == ".google.protobuf.Int64Value" || typ == ".google.protobuf.UInt64Value"
+}
+
+// unixMillis reports whether typ is google.protobuf.Timestamp, encoded in
+// JSON as a number of milliseconds with timestamp_json=unix_millis.
+func (g *grpcserial) unixMillis(typ string) bool {
+    return typ == ".google.protobuf.Timestamp" && g.timestampFormat == httprpc.TimestampUnixMillis
+}
+
+// exampleJSON returns an example of the JSON mapping of the message named
+// typ, indented, in which every field is set to a placeholder value: the
+// zero value of scalars, the first value of enums, a single element for
+// repeated fields and maps, and only the first field of each oneof.
+// Recursive messages are cut short with an empty object.
+func (g *grpcserial) exampleJSON(typ string) string {
+    var b bytes.Buffer
+    g.writeExample(&b, typ, make(map[string]bool))
+    var indented bytes.Buffer
+    json.Indent(&indented, b.Bytes(), "", "  ")
+    return indented.String()
+}
+
+// writeExample writes the example JSON value of the message typ to b,
+// visiting holding the messages being written.
+func (g *grpcserial) writeExample(b *bytes.Buffer, typ string, visiting map[string]bool) {
+    if g.int64Numbers && isInt64Wrapper(typ) || g.unixMillis(typ) {
+        b.WriteString("0")
+        return
+    }
+    if ex, ok := wellKnownExamples[typ]; ok {
+        b.WriteString(ex)
+        return
+    }
+    msg, ok := g.gen.ObjectNamed(typ).(*generator.Descriptor)
+    if !ok || visiting[typ] {
+        b.WriteString("{}")
+        return
+    }
+    visiting[typ] = true
+    defer delete(visiting, typ)
+
+    b.WriteString("{")
+    oneofs := make(map[int32]bool)
+    first := true
+    for _, field := range msg.Field {
+        if field.OneofIndex != nil {
+            if oneofs[field.GetOneofIndex()] {
+                continue
+            }
+            oneofs[field.GetOneofIndex()] = true
+        }
+        if !first {
+            b.WriteString(",")
+        }
+        first = false
+        fmt.Fprintf(b, "%q:", descutil.JSONName(field))
+        g.writeFieldExample(b, field, visiting)
+    }
+    b.WriteString("}")
+}
+
+// writeFieldExample writes the example JSON value of field to b.
+func (g *grpcserial) writeFieldExample(b *bytes.Buffer, field *pb.FieldDescriptorProto, visiting map[string]bool) {
+    if field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE {
+        if entry, ok := g.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor); ok && entry.GetOptions().GetMapEntry() {
+            b.WriteString("{")
+            key := "0"
+            switch entry.Field[0].GetType() {
+            case pb.FieldDescriptorProto_TYPE_STRING:
+                key = "key"
+            case pb.FieldDescriptorProto_TYPE_BOOL:
+                key = "true"
+            }
+            fmt.Fprintf(b, "%q:", key)
+            g.writeValueExample(b, entry.Field[1], visiting)
+            b.WriteString("}")
+            return
+        }
+    }
+    if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+        b.WriteString("[")
+        g.writeValueExample(b, field, visiting)
+        b.WriteString("]")
+        return
+    }
+    g.writeValueExample(b, field, visiting)
+}
+
+// writeValueExample writes the example JSON value of a single value of
+// field to b.
+func (g *grpcserial) writeValueExample(b *bytes.Buffer, field *pb.FieldDescriptorProto, visiting map[string]bool) {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        b.WriteString("false")
+    case pb.FieldDescriptorProto_TYPE_STRING:
+        b.WriteString(strconv.Quote(field.GetName()))
+    case pb.FieldDescriptorProto_TYPE_BYTES:
+        b.WriteString(`""`)
+    case pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_UINT64,
+        pb.FieldDescriptorProto_TYPE_SINT64, pb.FieldDescriptorProto_TYPE_FIXED64,
+        pb.FieldDescriptorProto_TYPE_SFIXED64:
+        if g.int64Numbers {
+            b.WriteString("0")
+        } else {
+            b.WriteString(`"0"`)
+        }
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        if ex, ok := wellKnownExamples[field.GetTypeName()]; ok {
+            b.WriteString(ex)
+        } else if enum, ok := g.gen.ObjectNamed(field.GetTypeName()).(*generator.EnumDescriptor); ok && len(enum.Value) > 0 && !g.enumNumbers {
+            b.WriteString(strconv.Quote(enum.Value[0].GetName()))
+        } else if ok && len(enum.Value) > 0 {
+            b.WriteString(strconv.Itoa(int(enum.Value[0].GetNumber())))
+        } else {
+            b.WriteString("0")
+        }
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+        g.writeExample(b, field.GetTypeName(), visiting)
+    default:
+        b.WriteString("0")
+    }
+}
@@ -0,0 +1,274 @@
+package grpcserial
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/httprpc"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// hasHTTPRules reports whether a method of service has google.api.http routes.
+func hasHTTPRules(service *pb.ServiceDescriptorProto) bool {
+    for _, method := range unaryMethods(service) {
+        if len(descutil.HTTPRules(method)) > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// gatewayField is a field of a request message which path variables and
+// query parameters can set, by its field path.
+type gatewayField struct {
+    path     string
+    kind     string // name of the httprpc.FieldKind
+    repeated bool
+}
+
+// wellKnownFieldKinds maps the well-known types whose JSON mapping is a
+// scalar to the kind of their value.
+var wellKnownFieldKinds = map[string]string{
+    ".google.protobuf.Duration":    "StringField",
+    ".google.protobuf.FieldMask":   "StringField",
+    ".google.protobuf.Timestamp":   "StringField",
+    ".google.protobuf.BoolValue":   "BoolField",
+    ".google.protobuf.BytesValue":  "StringField",
+    ".google.protobuf.DoubleValue": "NumberField",
+    ".google.protobuf.FloatValue":  "NumberField",
+    ".google.protobuf.Int32Value":  "NumberField",
+    ".google.protobuf.Int64Value":  "NumberField",
+    ".google.protobuf.StringValue": "StringField",
+    ".google.protobuf.UInt32Value": "NumberField",
+    ".google.protobuf.UInt64Value": "NumberField",
+}
+
+// gatewayFields appends to fields the scalar fields of the message typ and
+// of its singular message fields, recursively, prefix being the field path
+// of typ and visiting holding the messages being walked.
+func (g *grpcserial) gatewayFields(fields []gatewayField, typ, prefix string, visiting map[string]bool) []gatewayField {
+    msg, ok := g.gen.ObjectNamed(typ).(*generator.Descriptor)
+    if !ok || visiting[typ] {
+        return fields
+    }
+    visiting[typ] = true
+    defer delete(visiting, typ)
+
+    for _, field := range msg.Field {
+        f := gatewayField{
+            path:     prefix + field.GetName(),
+            kind:     "StringField",
+            repeated: field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED,
+        }
+        switch field.GetType() {
+        case pb.FieldDescriptorProto_TYPE_STRING, pb.FieldDescriptorProto_TYPE_BYTES:
+        case pb.FieldDescriptorProto_TYPE_BOOL:
+            f.kind = "BoolField"
+        case pb.FieldDescriptorProto_TYPE_MESSAGE:
+            kind, ok := wellKnownFieldKinds[field.GetTypeName()]
+            if !ok {
+                if !f.repeated {
+                    fields = g.gatewayFields(fields, field.GetTypeName(), f.path+".", visiting)
+                }
+                continue
+            }
+            f.kind = kind
+        case pb.FieldDescriptorProto_TYPE_GROUP:
+            continue
+        default:
+            f.kind = "NumberField"
+        }
+        fields = append(fields, f)
+    }
+    return fields
+}
+
+// fieldNamed returns the field of the message typ named name, or nil.
+func (g *grpcserial) fieldNamed(typ, name string) *pb.FieldDescriptorProto {
+    if msg, ok := g.gen.ObjectNamed(typ).(*generator.Descriptor); ok {
+        for _, field := range msg.Field {
+            if field.GetName() == name {
+                return field
+            }
+        }
+    }
+    return nil
+}
+
+// generateGateway generates a REST gateway to the serialized API of service:
+// an http.Handler routing the requests mapped by the google.api.http options
+// of its methods, binding their path variables, query parameters and body
+// into the input of the method called, and writing the JSON mapping of its
+// output back. Methods without such options are not served, and the ones
+// with a quota cost charge it before they run. The inputs of the methods
+// with scopes carry the caller of the request.
+func (g *grpcserial) generateGateway(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    quota := g.hasQuotaCosts(service)
+    g.P(fmt.Sprintf("// New%sGateway returns an http.Handler serving the REST API mapped to the", servName))
+    g.P(fmt.Sprintf("// %s serialized API by the google.api.http options of its methods.", servName))
+    if quota {
+        g.P("// The methods with a (quota.cost) option charge their cost to the")
+        g.P("// httprpc.QuotaManager of the requests, as set by httprpc.QuotaHandler,")
+        g.P("// before they run.")
+    }
+    g.P(fmt.Sprintf("func New%sGateway() http.Handler {", servName))
+    g.P("    gw := new(httprpc.Gateway)")
+    for _, method := range unaryMethods(service) {
+        methName := generator.CamelCase(method.GetName())
+        for _, rule := range descutil.HTTPRules(method) {
+            g.checkHTTPRule(method, fullServName, rule)
+            responseBody := ""
+            if rule.ResponseBody != "" {
+                responseBody = descutil.JSONName(g.fieldNamed(method.GetOutputType(), rule.ResponseBody))
+            }
+            g.P(fmt.Sprintf("    gw.Handle(%q, %s, func(w http.ResponseWriter, r *http.Request, vars map[string]string) {", rule.Method, quoteInComment(rule.Pattern)))
+            call := fmt.Sprintf("gatewayCall(w, r, vars, %q, %s, %s, new(pb.%s), new(pb.%s), %q",
+                rule.Body, unexported(methName)+"GatewayFields", methName, g.typeName(method.GetInputType()), g.typeName(method.GetOutputType()), responseBody)
+            if quota {
+                call += ", " + g.quotaCost(method)
+            }
+            if g.wrapsCaller(service) {
+                call += ", " + strconv.FormatBool(len(g.scopes(method)) > 0)
+            }
+            g.P("        " + call + ")")
+            g.P("    })")
+        }
+    }
+    g.P("    return gw")
+    g.P("}")
+    g.P()
+    for _, method := range unaryMethods(service) {
+        if len(descutil.HTTPRules(method)) == 0 {
+            continue
+        }
+        methName := generator.CamelCase(method.GetName())
+        g.P(fmt.Sprintf("// %sGatewayFields are the fields of %s which the path variables and", unexported(methName), g.typeName(method.GetInputType())))
+        g.P(fmt.Sprintf("// query parameters of the %s routes can set.", methName))
+        g.P(fmt.Sprintf("var %sGatewayFields = map[string]httprpc.Field{", unexported(methName)))
+        for _, f := range g.gatewayFields(nil, method.GetInputType(), "", make(map[string]bool)) {
+            if f.repeated {
+                g.P(fmt.Sprintf("    %q: {Kind: httprpc.%s, Repeated: true},", f.path, f.kind))
+            } else {
+                g.P(fmt.Sprintf("    %q: {Kind: httprpc.%s},", f.path, f.kind))
+            }
+        }
+        g.P("}")
+        g.P()
+    }
+    g.P("// gatewayCall serves a request routed by the gateway: it binds the request")
+    g.P("// into in, as mapped by body, vars and fields, calls call with it, and")
+    g.P("// writes the JSON mapping of its output out, or of its field responseBody.")
+    if quota {
+        g.P("// cost is charged to the quota of the caller before the call.")
+    }
+    if g.wrapsCaller(service) {
+        g.P("// The input of the methods with scopes, flagged by scoped, carries the caller.")
+    }
+    params := "responseBody string"
+    if quota {
+        params += ", cost int64"
+    }
+    if g.wrapsCaller(service) {
+        params += ", scoped bool"
+    }
+    g.P("func gatewayCall(w http.ResponseWriter, r *http.Request, vars map[string]string, body string, fields map[string]httprpc.Field,")
+    g.P("    call func(input []byte) (output []byte, err error), in, out proto.Message, " + params + ") {")
+    g.P("    request, err := httprpc.BindRequest(r, body, vars, fields)")
+    g.P("    if err != nil {")
+    g.P("        http.Error(w, err.Error(), http.StatusBadRequest)")
+    g.P("        return")
+    g.P("    }")
+    g.generateJSONInput("request", "http.Error(w, err.Error(), http.StatusBadRequest)", "return")
+    if g.runtimeV2 {
+        g.P("    if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(request, in); err != nil {")
+    } else {
+        g.P("    if err := (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(bytes.NewReader(request), in); err != nil {")
+    }
+    g.P("        http.Error(w, err.Error(), http.StatusBadRequest)")
+    g.P("        return")
+    g.P("    }")
+    g.generateCheckEnums("    ", "http.Error(w, err.Error(), http.StatusBadRequest)", "return")
+    g.P("    input, err := proto.Marshal(in)")
+    g.P("    if err != nil {")
+    g.P("        http.Error(w, err.Error(), http.StatusInternalServerError)")
+    g.P("        return")
+    g.P("    }")
+    if quota {
+        g.generateChargeQuota("r.Context()", "cost", "http.Error(w, err.Error(), httprpc.ErrorFrom(err).Code.HTTPStatus())", "return")
+    }
+    g.generateWrapCaller(service, "r.Context()")
+    g.P("    output, err := call(input)")
+    g.P("    if err != nil {")
+    g.P("        http.Error(w, err.Error(), " + g.callErrorStatus(service) + ")")
+    g.P("        return")
+    g.P("    }")
+    g.generateUnwrapOutput(service, "w.Header()", "http.Error(w, err.Error(), http.StatusInternalServerError)", "return")
+    g.P("    if err := proto.Unmarshal(output, out); err != nil {")
+    g.P("        http.Error(w, err.Error(), http.StatusInternalServerError)")
+    g.P("        return")
+    g.P("    }")
+    if g.runtimeV2 {
+        g.P("    response, err := protojson.Marshal(out)")
+        g.P("    if err != nil {")
+        g.P("        http.Error(w, err.Error(), http.StatusInternalServerError)")
+        g.P("        return")
+        g.P("    }")
+        g.generateJSONOutput("response", "http.Error(w, err.Error(), http.StatusInternalServerError)", "return")
+        g.P("    httprpc.WriteGatewayResponse(w, response, responseBody)")
+    } else {
+        g.P("    var response bytes.Buffer")
+        g.P("    if err := new(jsonpb.Marshaler).Marshal(&response, out); err != nil {")
+        g.P("        http.Error(w, err.Error(), http.StatusInternalServerError)")
+        g.P("        return")
+        g.P("    }")
+        if g.rewritesJSON() {
+            g.P("    data := response.Bytes()")
+            g.generateJSONOutput("data", "http.Error(w, err.Error(), http.StatusInternalServerError)", "return")
+            g.P("    httprpc.WriteGatewayResponse(w, data, responseBody)")
+        } else {
+            g.P("    httprpc.WriteGatewayResponse(w, response.Bytes(), responseBody)")
+        }
+    }
+    g.P("}")
+    g.P()
+}
+
+// checkHTTPRule fails the generation if rule does not map to the input and
+// output of method: its path template must be valid, its variables scalar
+// fields of the input, and its body fields existing ones.
+func (g *grpcserial) checkHTTPRule(method *pb.MethodDescriptorProto, fullServName string, rule descutil.HTTPRule) {
+    name := fullServName + "." + method.GetName()
+    t, err := httprpc.ParsePathTemplate(rule.Pattern)
+    if err != nil {
+        g.gen.Fail("invalid google.api.http option of", name+":", err.Error())
+    }
+    fields := make(map[string]bool)
+    for _, f := range g.gatewayFields(nil, method.GetInputType(), "", make(map[string]bool)) {
+        fields[f.path] = !f.repeated
+    }
+    for _, v := range t.Variables {
+        if !fields[v] {
+            g.gen.Fail(fmt.Sprintf("invalid google.api.http option of %s: %s is not a singular scalar field of %s", name, v, method.GetInputType()))
+        }
+    }
+    if rule.Body != "" && rule.Body != "*" && g.fieldNamed(method.GetInputType(), rule.Body) == nil {
+        g.gen.Fail(fmt.Sprintf("invalid google.api.http option of %s: body %s is not a field of %s", name, rule.Body, method.GetInputType()))
+    }
+    if rule.ResponseBody != "" && g.fieldNamed(method.GetOutputType(), rule.ResponseBody) == nil {
+        g.gen.Fail(fmt.Sprintf("invalid google.api.http option of %s: response_body %s is not a field of %s", name, rule.ResponseBody, method.GetOutputType()))
+    }
+}
+
+// quoteInComment returns s as a Go string literal which can appear in the
+// comment holding the example implementation: "*/" would end it.
+func quoteInComment(s string) string {
+    return strings.Replace(strconv.Quote(s), "*/", `*\x2f`, -1)
+}
+
+// unexported returns name with its first letter lowercased.
+func unexported(name string) string {
+    return strings.ToLower(name[:1]) + name[1:]
+}
@@ -13,10 +13,13 @@ package grpcserial
 
 import (
     "fmt"
+    "sort"
+    "strconv"
     "strings"
 
     pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
     "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
 )
 
 func init() {
@@ -29,6 +32,69 @@ func init() {
 // gomobile and has annotations for Python bindings generation with goprotopy.
 type grpcserial struct {
     gen *generator.Generator
+
+    pool bool // pool=true: reuse messages and marshal buffers through sync.Pool
+
+    parallelDecode    bool // parallel_decode=true: decode large repeated message fields concurrently
+    parallelThreshold int  // parallel_decode_threshold: element count above which decoding goes parallel
+
+    runtimeV2 bool // runtime=v2: target the google.golang.org/protobuf runtime
+
+    telemetry bool // telemetry=true: publish per message type codec counters with expvar
+
+    tracing bool // tracing=true: wrap the serialized functions in OpenTelemetry spans
+
+    prometheus          bool   // prometheus=true: record the calls as Prometheus metrics with promrpc
+    prometheusNamespace string // prometheus_namespace: namespace of the Prometheus metrics
+    logging             bool   // logging=true: log the calls at their entry and exit with logrpc
+
+    recover       bool // recover=true: recover the panics of the serialized functions into errors
+    recoverStatus bool // recover=status: the errors of the panics are also google.rpc.Status messages
+
+    interceptors bool // interceptors=true: call the serialized functions through a chain of SerialInterceptors
+
+    metadata bool // metadata=true: carry serialmeta metadata in the envelopes of the inputs and outputs
+
+    xContext bool // context=golang.org/x/net/context: use x/net/context for Go < 1.7
+
+    http bool // http=true: generate an http.Handler serving the serialized API
+
+    jsonrpc bool // jsonrpc=true: generate a JSON-RPC 2.0 dispatcher of the serialized API
+
+    gateway bool // gateway=true: generate a REST gateway from the google.api.http options
+
+    companions map[string]bool // companions=py+ts+h: artifacts written next to the Go file
+
+    int64Numbers bool // int64_json=number: 64-bit integers are JSON numbers, not strings
+
+    enumNumbers        bool // enum_json=number: enums are JSON numbers, not names
+    rejectUnknownEnums bool // enum_json_unknown=reject: unknown enum values are rejected on JSON input
+
+    timestampFormat, timestampZone string // timestamp_json and timestamp_zone: format and zone of the JSON timestamps
+
+    validate bool // the validate plugin is enabled: inputs are validated, and custom validated, before the call
+
+    generics bool // generics=true: the serialized functions call the generic Handle helper
+
+    channels bool // channels=true: generate <Method>Async functions served by a worker pool
+
+    dispatcher bool // dispatcher=true: generate a <Service>Dispatcher with per-method concurrency limits
+
+    batch bool // batch=true: generate DispatchBatch serving batches of serialized calls
+
+    serialLink bool // seriallink=true: serve the methods with an ID over serial links
+
+    mqtt bool // mqtt=true: serve the methods to the requests published on MQTT topics
+
+    nats bool // nats=true: serve the methods over NATS request/reply, and call them
+
+    amqp bool // amqp=true: serve the methods over AMQP RPC, and call them
+
+    lambda bool // lambda=true: generate the AWS Lambda handlers of the methods
+
+    pubsub bool // pubsub=true: serve the methods to the Pub/Sub push and pull subscriptions
+
+    schemaRegistry bool // schema_registry=true: the serialized messages are in the Confluent wire format
 }
 
 // Name returns the name of this plugin, "grpcserial".
@@ -39,6 +105,71 @@ func (g *grpcserial) Name() string {
 // Init initializes the plugin.
 func (g *grpcserial) Init(gen *generator.Generator) {
     g.gen = gen
+    g.pool = descutil.BoolParam(g.gen, "pool")
+    g.parallelDecode = descutil.BoolParam(g.gen, "parallel_decode")
+    g.parallelThreshold = g.intParam("parallel_decode_threshold", 1024)
+    g.telemetry = descutil.BoolParam(g.gen, "telemetry")
+    g.tracing = descutil.BoolParam(g.gen, "tracing")
+    g.prometheus = descutil.BoolParam(g.gen, "prometheus")
+    g.prometheusNamespace = descutil.PrometheusNamespace(gen)
+    g.logging = descutil.BoolParam(g.gen, "logging")
+    g.recover, g.recoverStatus = g.recoverParam()
+    g.interceptors = descutil.BoolParam(g.gen, "interceptors")
+    g.metadata = descutil.BoolParam(g.gen, "metadata")
+    g.http = descutil.BoolParam(g.gen, "http")
+    g.jsonrpc = descutil.BoolParam(g.gen, "jsonrpc")
+    g.gateway = descutil.BoolParam(g.gen, "gateway")
+    g.companions = g.companionsParam()
+    g.generics = descutil.BoolParam(g.gen, "generics")
+    g.channels = descutil.BoolParam(g.gen, "channels")
+    g.dispatcher = descutil.BoolParam(g.gen, "dispatcher")
+    g.batch = descutil.BoolParam(g.gen, "batch")
+    g.serialLink = descutil.BoolParam(g.gen, "seriallink")
+    g.mqtt = descutil.BoolParam(g.gen, "mqtt")
+    g.nats = descutil.BoolParam(g.gen, "nats")
+    g.amqp = descutil.BoolParam(g.gen, "amqp")
+    g.lambda = descutil.BoolParam(g.gen, "lambda")
+    g.pubsub = descutil.BoolParam(g.gen, "pubsub")
+    g.schemaRegistry = descutil.BoolParam(g.gen, "schema_registry")
+    g.int64Numbers = descutil.Int64JSONNumbers(gen)
+    g.enumNumbers, g.rejectUnknownEnums = descutil.EnumJSON(gen)
+    g.timestampFormat, g.timestampZone = descutil.TimestampJSON(gen)
+    g.validate = descutil.PluginEnabled(g.gen, "validate")
+    switch ctx := g.gen.Param["context"]; ctx {
+    case "", "context":
+    case "golang.org/x/net/context":
+        g.xContext = true
+    default:
+        g.gen.Fail(fmt.Sprintf(`unknown context package %q: want "context" or "golang.org/x/net/context"`, ctx))
+    }
+    g.runtimeV2 = descutil.RuntimeV2(g.gen)
+    if g.generics {
+        // Handle works on any message type, not on the pools, codec
+        // counters and decoders generated per type, and calls its
+        // implementation with the background context.
+        for _, name := range []string{"pool", "parallel_decode", "telemetry", "tracing", "prometheus", "logging", "schema_registry", "interceptors", "metadata"} {
+            if descutil.BoolParam(g.gen, name) {
+                g.gen.Fail(fmt.Sprintf("parameter generics=true cannot be combined with %s=true", name))
+            }
+        }
+        if g.xContext {
+            g.gen.Fail("parameter generics=true needs Go 1.18, it cannot be combined with context=golang.org/x/net/context")
+        }
+    }
+}
+
+// intParam returns the value of the named command-line parameter,
+// or def if it is not set.
+func (g *grpcserial) intParam(name string, def int) int {
+    v, ok := g.gen.Param[name]
+    if !ok {
+        return def
+    }
+    i, err := strconv.Atoi(v)
+    if err != nil {
+        g.gen.Fail(fmt.Sprintf("invalid value %q for parameter %s", v, name))
+    }
+    return i
 }
 
 // Given a type name defined in a .proto, return its object.
@@ -61,6 +192,9 @@ func (g *grpcserial) Generate(file *generator.FileDescriptor) {
     for i, service := range file.FileDescriptorProto.Service {
         g.generateService(file, service, i)
     }
+    if len(g.companions) > 0 && descutil.IsGenerated(g.gen, file.GetName()) {
+        g.generateCompanions(file)
+    }
 }
 
 // GenerateImports generates the import declaration for this file.
@@ -143,22 +277,330 @@ func (g *grpcserial) generateService(file *generator.FileDescriptor, service *pb
     g.P()
     g.P("package your_package // TODO change to your project package name")
     g.P()
-    g.P("import \"github.com/golang/protobuf/proto\"")
+    for _, imp := range g.serviceImports(service) {
+        g.P(fmt.Sprintf("import \"%s\"", imp))
+    }
     g.P(fmt.Sprintf("import pb \"%s\" // TODO change to the Go package in which your .pb.go has been generated", goPackage))
+    if g.cgoExports() || g.companions["java"] {
+        g.P()
+        g.P("// #include <stdint.h>")
+        g.P("// #include <stdlib.h>")
+        if g.companions["java"] {
+            g.generateJNIPreamble()
+        }
+        g.P("import \"C\"")
+    }
     g.P()
     g.P("// TODO change packagePath value to match your package full import path")
     g.P("//go:generate goprotopy --packagePath=your_org/your_name/your_package $GOFILE")
     g.P()
 
+    if g.schemaRegistry {
+        g.generateSchemaRegistry()
+    }
+    if g.pool {
+        g.generatePools(service)
+    }
+    if g.parallelDecode {
+        g.generateParallelDecode(service)
+    }
+    if g.telemetry {
+        g.generateTelemetry(service)
+    }
+    if g.hasScopes(service) {
+        g.generateAuth(service)
+    }
+    if g.tracing {
+        g.generateTracing(g.hasScopes(service))
+    }
+    if g.metadata && !g.tracing {
+        g.generateUnwrapMetadata(g.hasScopes(service))
+    }
+    if g.prometheus {
+        g.generateMetrics()
+    }
+    if g.logging {
+        g.generateLogging()
+    }
+    if g.recover {
+        g.generateRecover()
+    }
+    if g.interceptors {
+        g.generateInterceptors()
+    }
+    if g.generics {
+        g.generateHandle(service)
+    }
+
     for i, method := range service.Method {
         g.gen.PrintComments(fmt.Sprintf("%s,2,%d", path, i)) // 2 means method in a service.
-        g.generateSerializedAPI(servName, method)
+        g.generateSerializedAPI(fullServName, method)
+    }
+    if g.http {
+        g.generateHTTPHandler(service, servName, fullServName)
+    }
+    if g.jsonrpc {
+        g.generateJSONRPC(service, servName, fullServName)
+    }
+    if g.gateway && hasHTTPRules(service) {
+        g.generateGateway(service, servName, fullServName)
+    }
+    if len(g.asyncMethods(service)) > 0 {
+        g.generateQueue(service, servName, fullServName)
+    }
+    if g.channels {
+        g.generateChannels(service)
+    }
+    if g.dispatcher {
+        g.generateDispatcher(service, servName, fullServName)
+    }
+    if g.batch {
+        g.generateBatch(service, servName, fullServName)
+    }
+    if g.serialLink {
+        g.generateSerialLink(service, servName)
+    }
+    if g.mqtt {
+        g.generateMQTT(service, servName, fullServName)
+    }
+    if g.nats || g.amqp {
+        g.generateImpl(service, servName)
+    }
+    if g.nats {
+        g.generateNATS(service, servName, fullServName)
+    }
+    if g.amqp {
+        g.generateAMQP(service, servName, fullServName)
+    }
+    if g.lambda && len(unaryMethods(service)) > 0 {
+        g.generateLambda(service)
+    }
+    if g.pubsub {
+        g.generatePubSub(service, servName, fullServName)
+    }
+    if g.cgoExports() {
+        g.generateExports(service, servName)
+    }
+    if g.companions["java"] {
+        g.generateJNIExports(file, service)
     }
     g.P("*/")
     g.P()
 }
 
-func (g *grpcserial) generateSerializedAPI(servName string, method *pb.MethodDescriptorProto) {
+// protoPkgPath returns the import path of the proto package of the
+// runtime targeted by the example implementations.
+func (g *grpcserial) protoPkgPath() string {
+    if g.runtimeV2 {
+        return "google.golang.org/protobuf/proto"
+    }
+    return "github.com/golang/protobuf/proto"
+}
+
+// contextPkgPath returns the import path of the context package used by
+// the example implementations: the standard library one, unless
+// golang.org/x/net/context is requested for Go versions older than 1.7.
+func (g *grpcserial) contextPkgPath() string {
+    if g.xContext {
+        return "golang.org/x/net/context"
+    }
+    return "context"
+}
+
+// serviceImports returns the sorted import paths needed by the example
+// implementation of service, other than the generated package itself.
+func (g *grpcserial) serviceImports(service *pb.ServiceDescriptorProto) []string {
+    imports := map[string]bool{g.protoPkgPath(): true}
+    if g.pool {
+        imports["sync"] = true
+    }
+    if g.telemetry {
+        imports["expvar"] = true
+        imports["time"] = true
+    }
+    if g.tracing {
+        imports[g.contextPkgPath()] = true
+        imports["go.opentelemetry.io/otel"] = true
+        imports["go.opentelemetry.io/otel/attribute"] = true
+        imports["go.opentelemetry.io/otel/codes"] = true
+        imports["go.opentelemetry.io/otel/trace"] = true
+        imports["github.com/lleveque/protoc-gen-go/serialmeta"] = true
+    }
+    if g.prometheus {
+        imports["time"] = true
+        imports["github.com/lleveque/protoc-gen-go/promrpc"] = true
+    }
+    if g.logging {
+        imports[g.contextPkgPath()] = true
+        imports["github.com/lleveque/protoc-gen-go/logrpc"] = true
+    }
+    if g.recover {
+        imports["fmt"] = true
+        imports["runtime/debug"] = true
+    }
+    if g.recoverStatus {
+        imports["google.golang.org/genproto/googleapis/rpc/status"] = true
+    }
+    if g.http {
+        imports["io/ioutil"] = true
+        imports["net/http"] = true
+        imports["strings"] = true
+        if g.runtimeV2 {
+            imports["google.golang.org/protobuf/encoding/protojson"] = true
+        } else {
+            imports["bytes"] = true
+            imports["github.com/golang/protobuf/jsonpb"] = true
+        }
+    }
+    if (g.rewritesJSON() || g.rejectUnknownEnums) && (g.http || g.jsonrpc || g.lambda && len(unaryMethods(service)) > 0) {
+        imports["github.com/lleveque/protoc-gen-go/httprpc"] = true
+    }
+    if g.jsonrpc {
+        imports["encoding/json"] = true
+        imports["io/ioutil"] = true
+        imports["net/http"] = true
+        imports["bytes"] = true
+        if g.runtimeV2 {
+            imports["google.golang.org/protobuf/encoding/protojson"] = true
+        } else {
+            imports["github.com/golang/protobuf/jsonpb"] = true
+        }
+    }
+    if g.gateway && hasHTTPRules(service) {
+        imports["net/http"] = true
+        imports["github.com/lleveque/protoc-gen-go/httprpc"] = true
+        if g.runtimeV2 {
+            imports["google.golang.org/protobuf/encoding/protojson"] = true
+        } else {
+            imports["bytes"] = true
+            imports["github.com/golang/protobuf/jsonpb"] = true
+        }
+    }
+    if (g.http || g.jsonrpc || g.gateway && hasHTTPRules(service)) && g.hasQuotaCosts(service) {
+        imports["github.com/lleveque/protoc-gen-go/httprpc"] = true
+        if g.jsonrpc {
+            imports[g.contextPkgPath()] = true
+        }
+    }
+    if len(g.asyncMethods(service)) > 0 {
+        imports[g.contextPkgPath()] = true
+        imports["fmt"] = true
+    }
+    if g.cgoExports() || g.companions["java"] {
+        imports["unsafe"] = true
+    }
+    if g.generics {
+        imports[g.contextPkgPath()] = true
+        imports["reflect"] = true
+    }
+    if g.channels {
+        imports[g.contextPkgPath()] = true
+        imports["runtime"] = true
+        imports["sync"] = true
+    }
+    if g.dispatcher {
+        imports[g.contextPkgPath()] = true
+        imports["fmt"] = true
+        imports["sync"] = true
+    }
+    if g.batch {
+        imports["encoding/binary"] = true
+        imports["errors"] = true
+        imports["fmt"] = true
+        imports["io"] = true
+        imports["runtime"] = true
+        imports["sync"] = true
+    }
+    if g.serialLink {
+        imports["errors"] = true
+        imports["fmt"] = true
+        imports["io"] = true
+        imports["sync"] = true
+        imports["github.com/lleveque/protoc-gen-go/seriallink"] = true
+    }
+    if g.mqtt {
+        imports["github.com/lleveque/protoc-gen-go/mqttrpc"] = true
+    }
+    if g.nats {
+        imports["errors"] = true
+        imports["time"] = true
+        imports["github.com/nats-io/nats.go"] = true
+    }
+    if g.amqp {
+        imports[g.contextPkgPath()] = true
+        imports["errors"] = true
+        imports["fmt"] = true
+        imports["strconv"] = true
+        imports["sync"] = true
+        imports["time"] = true
+        imports["github.com/rabbitmq/amqp091-go"] = true
+    }
+    if g.lambda && len(unaryMethods(service)) > 0 {
+        imports[g.contextPkgPath()] = true
+        imports["encoding/base64"] = true
+        imports["encoding/json"] = true
+        imports["net/http"] = true
+        imports["strings"] = true
+        if g.runtimeV2 {
+            imports["google.golang.org/protobuf/encoding/protojson"] = true
+        } else {
+            imports["bytes"] = true
+            imports["github.com/golang/protobuf/jsonpb"] = true
+        }
+    }
+    if g.schemaRegistry {
+        imports["errors"] = true
+        imports["fmt"] = true
+        imports["github.com/lleveque/protoc-gen-go/kafkacodec"] = true
+    }
+    if g.pubsub {
+        imports[g.contextPkgPath()] = true
+        imports["fmt"] = true
+        imports["net/http"] = true
+        imports["strings"] = true
+        imports["github.com/lleveque/protoc-gen-go/pubsubrpc"] = true
+    }
+    if g.hasTimeouts(service) {
+        imports[g.contextPkgPath()] = true
+        imports["time"] = true
+    }
+    if g.interceptors {
+        imports[g.contextPkgPath()] = true
+    }
+    if g.metadata {
+        imports[g.contextPkgPath()] = true
+        imports["github.com/lleveque/protoc-gen-go/serialmeta"] = true
+    }
+    if g.hasScopes(service) {
+        imports[g.contextPkgPath()] = true
+        imports["strings"] = true
+        imports["github.com/lleveque/protoc-gen-go/httprpc"] = true
+        imports["github.com/lleveque/protoc-gen-go/serialmeta"] = true
+    }
+    for _, method := range service.Method {
+        if isBidi(method) {
+            imports["io"] = true
+        }
+        if len(g.parallelFields(method.GetInputType())) > 0 {
+            if g.runtimeV2 {
+                imports["google.golang.org/protobuf/encoding/protowire"] = true
+            } else {
+                imports["errors"] = true
+                imports["io"] = true
+            }
+            imports["runtime"] = true
+            imports["sync"] = true
+        }
+    }
+    var paths []string
+    for imp := range imports {
+        paths = append(paths, imp)
+    }
+    sort.Strings(paths)
+    return paths
+}
+
+func (g *grpcserial) generateSerializedAPI(fullServName string, method *pb.MethodDescriptorProto) {
     origMethodName := method.GetName()
     methodName := generator.CamelCase(origMethodName)
 
@@ -166,23 +608,344 @@ func (g *grpcserial) generateSerializedAPI(servName string, method *pb.MethodDes
     inputVarName := unexport(inputTypeName)
     outputTypeName := g.typeName(method.GetOutputType())
     outputVarName := unexport(outputTypeName)
+    stream := emitsStream(method)
+    if isBidi(method) {
+        g.generateBidi(fullServName, method)
+        return
+    }
     
     g.P(fmt.Sprintf("// input is a serialized protobuf object of type %s", inputTypeName))
-    g.P(fmt.Sprintf("// output is a serialized protobuf object of type %s", outputTypeName))
-    g.P("// @protopy")
-    g.P(fmt.Sprintf("func %s(input []byte) (output []byte, err error) {", methodName))
-    g.P(fmt.Sprintf("    %s := new(pb.%s)", inputVarName, inputTypeName))
-    g.P(fmt.Sprintf("    err = proto.Unmarshal(input, %s)", inputVarName))
+    if stream {
+        g.P(fmt.Sprintf("// every output emitted is a serialized protobuf object of type %s", outputTypeName))
+        g.P("// @protopy")
+        g.generateIntercept(fullServName, method)
+        g.P(fmt.Sprintf("func %s(%sinput []byte, emit func(output []byte) error) (err error) {", g.serialFuncName(method), g.interceptedParam()))
+    } else {
+        g.P(fmt.Sprintf("// output is a serialized protobuf object of type %s", outputTypeName))
+        g.P("// @protopy")
+        g.generateIntercept(fullServName, method)
+        g.P(fmt.Sprintf("func %s(%sinput []byte) (output []byte, err error) {", g.serialFuncName(method), g.interceptedParam()))
+    }
+    responseSize := "len(output)"
+    if stream && g.countsSizes() {
+        responseSize = "responseSize"
+        g.P("    responseSize := 0")
+    }
+    if g.prometheus {
+        g.generateObserve(fullServName, origMethodName, "len(input)", responseSize)
+    }
+    if g.tracing {
+        g.P(fmt.Sprintf("    ctx, input, err %s extractContext(%s, input)", g.assignCtx(), g.parentCtx()))
+        g.P(fmt.Sprintf("    ctx, span := startSpan(ctx, %q, %q)", fullServName, origMethodName))
+        g.P(fmt.Sprintf("    defer func() { endSpan(span, len(input), %s, err) }()", responseSize))
+    }
+    if g.logging {
+        g.generateLogExit(fullServName, origMethodName, "len(input)", responseSize)
+    }
+    if g.recover {
+        g.generateRecoverPanic(fullServName, origMethodName)
+    }
+    scoped := g.unwrapsCaller(method)
+    unwraps := g.unwrapsInput(method)
+    if unwraps && !g.tracing {
+        g.P(fmt.Sprintf("    ctx, input, err %s %s(%s, input)", g.assignCtx(), g.unwrapFunc(), g.parentCtx()))
+    }
+    if g.tracing || unwraps {
+        g.P("    if err != nil {")
+        g.P("        return")
+        g.P("    }")
+    }
+    if scoped {
+        g.generateCheckScopes(fullServName, method, "ctx", "err =", "return")
+    }
+    _, timeout := g.timeout(method)
+    if timeout && !g.generics {
+        g.generateTimeout("    ", g.serialCtx(method), method)
+    }
+    if g.prometheus || g.tracing || g.logging || g.recover || unwraps || timeout && !g.generics {
+        g.P()
+    }
+    if g.schemaRegistry {
+        g.generateStripSchemaHeader(method.GetInputType())
+    }
+    if g.generics {
+        if stream {
+            g.P(fmt.Sprintf("    return HandleStream(input, emit, func(ctx context.Context, %s *pb.%s, send func(*pb.%s) error) error {", inputVarName, inputTypeName, outputTypeName))
+            if _, ok := g.timeout(method); ok {
+                g.generateTimeout("        ", "ctx", method)
+                g.P()
+            }
+            g.P(fmt.Sprintf("        // TODO : implement %s(ctx context.Context, %s *pb.%s, send func(*pb.%s) error) error", methodName, inputVarName, inputTypeName, outputTypeName))
+            g.P(fmt.Sprintf("        // return your%sImplementation(ctx, %s, send)", methodName, inputVarName))
+            g.P()
+            g.P(fmt.Sprintf("        return send(new(pb.%s))", outputTypeName))
+        } else {
+            g.P(fmt.Sprintf("    return Handle(input, func(ctx context.Context, %s *pb.%s) (*pb.%s, error) {", inputVarName, inputTypeName, outputTypeName))
+            if _, ok := g.timeout(method); ok {
+                g.generateTimeout("        ", "ctx", method)
+                g.P()
+            }
+            g.P(fmt.Sprintf("        // TODO : implement %s(ctx context.Context, %s *pb.%s) (*pb.%s, error)", methodName, inputVarName, inputTypeName, outputTypeName))
+            g.P(fmt.Sprintf("        // return your%sImplementation(ctx, %s)", methodName, inputVarName))
+            g.P()
+            g.P(fmt.Sprintf("        return new(pb.%s), nil", outputTypeName))
+        }
+        g.P("    })")
+        g.P("}")
+        g.P()
+        return
+    }
+    if g.pool {
+        g.P(fmt.Sprintf("    %s := %sPool.Get().(*pb.%s)", inputVarName, inputVarName, inputTypeName))
+        g.generatePoolRelease(inputVarName)
+    } else {
+        g.P(fmt.Sprintf("    %s := new(pb.%s)", inputVarName, inputTypeName))
+    }
+    if g.telemetry {
+        g.P("    decodeStart := time.Now()")
+    }
+    if len(g.parallelFields(method.GetInputType())) > 0 {
+        g.P(fmt.Sprintf("    err = unmarshal%s(input, %s)", inputTypeName, inputVarName))
+    } else {
+        g.P(fmt.Sprintf("    err = proto.Unmarshal(input, %s)", inputVarName))
+    }
+    if g.telemetry {
+        g.P(fmt.Sprintf("    %sStats.decoded(len(input), decodeStart, err)", inputVarName))
+    }
     g.P("    if err != nil {")
     g.P("        return")
     g.P("    }")
+    if g.validate {
+        for _, hook := range []string{"Validate", "CustomValidate"} {
+            g.P(fmt.Sprintf("    if v, ok := interface{}(%s).(interface{ %s() error }); ok {", inputVarName, hook))
+            g.P(fmt.Sprintf("        if err = v.%s(); err != nil {", hook))
+            g.P("            return")
+            g.P("        }")
+            g.P("    }")
+        }
+    }
     g.P()
-    g.P(fmt.Sprintf("    // TODO : implement %s(%s *pb.%s) (*pb.%s, error)", methodName, inputVarName, inputTypeName, outputTypeName))
-    g.P(fmt.Sprintf("    // %s, err := your%sImplementation(%s)", outputVarName, methodName, inputVarName))
-    g.P()
-    g.P(fmt.Sprintf("    %s := new(pb.%s)", outputVarName, outputTypeName))
-    g.P(fmt.Sprintf("    output, err = proto.Marshal(%s)", outputVarName))
+    if stream {
+        g.generateSend(method.GetOutputType(), outputTypeName, outputVarName)
+        g.P()
+        g.P(fmt.Sprintf("    // TODO : implement %s(%s%s *pb.%s, send func(*pb.%s) error) error", methodName, g.ctxParam(method), inputVarName, inputTypeName, outputTypeName))
+        g.P(fmt.Sprintf("    // return your%sImplementation(%s%s, send)", methodName, g.ctxArg(method), inputVarName))
+        g.P()
+        g.generateUnusedCtx(method)
+        g.P(fmt.Sprintf("    return send(new(pb.%s))", outputTypeName))
+        g.P("}")
+        g.P()
+        return
+    }
+    if g.pool {
+        g.P(fmt.Sprintf("    %s := %sPool.Get().(*pb.%s)", outputVarName, outputVarName, outputTypeName))
+        g.generatePoolRelease(outputVarName)
+        g.P()
+        g.P(fmt.Sprintf("    // TODO : implement %s(%s%s *pb.%s, %s *pb.%s) error", methodName, g.ctxParam(method), inputVarName, inputTypeName, outputVarName, outputTypeName))
+        g.P(fmt.Sprintf("    // err = your%sImplementation(%s%s, %s)", methodName, g.ctxArg(method), inputVarName, outputVarName))
+        g.P()
+        g.generateUnusedCtx(method)
+        if g.telemetry {
+            g.P("    encodeStart := time.Now()")
+        }
+        g.P(fmt.Sprintf("    output, err = marshalPooled(%s)", outputVarName))
+    } else {
+        g.P(fmt.Sprintf("    // TODO : implement %s(%s%s *pb.%s) (*pb.%s, error)", methodName, g.ctxParam(method), inputVarName, inputTypeName, outputTypeName))
+        g.P(fmt.Sprintf("    // %s, err := your%sImplementation(%s%s)", outputVarName, methodName, g.ctxArg(method), inputVarName))
+        g.P()
+        g.generateUnusedCtx(method)
+        g.P(fmt.Sprintf("    %s := new(pb.%s)", outputVarName, outputTypeName))
+        if g.telemetry {
+            g.P("    encodeStart := time.Now()")
+        }
+        g.P(fmt.Sprintf("    output, err = proto.Marshal(%s)", outputVarName))
+    }
+    if g.telemetry {
+        g.P(fmt.Sprintf("    %sStats.encoded(len(output), encodeStart, err)", outputVarName))
+    }
+    if g.schemaRegistry {
+        g.P("    if err == nil {")
+        g.P(fmt.Sprintf("        output, err = prependSchemaHeader(output, %s)", g.schemaArgs(method.GetOutputType())))
+        g.P("    }")
+    }
+    if g.metadata {
+        g.P("    if err == nil {")
+        g.P("        output = serialmeta.WrapOutput(ctx, output)")
+        g.P("    }")
+    }
     g.P("    return")
     g.P("}")
     g.P()
 }
+
+// generateSend generates send, the function serializing the responses of a
+// server-streaming method, of fully-qualified type outputType and Go type
+// outputTypeName, and passing them to emit, with metadata=true in an
+// envelope with the metadata set for them.
+func (g *grpcserial) generateSend(outputType, outputTypeName, outputVarName string) {
+    g.P(fmt.Sprintf("    send := func(%s *pb.%s) error {", outputVarName, outputTypeName))
+    if g.telemetry {
+        g.P("        encodeStart := time.Now()")
+    }
+    if g.pool {
+        g.P(fmt.Sprintf("        output, err := marshalPooled(%s)", outputVarName))
+    } else {
+        g.P(fmt.Sprintf("        output, err := proto.Marshal(%s)", outputVarName))
+    }
+    if g.telemetry {
+        g.P(fmt.Sprintf("        %sStats.encoded(len(output), encodeStart, err)", outputVarName))
+    }
+    g.P("        if err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.generatePrependSchemaHeader(outputType)
+    if g.countsSizes() {
+        g.P("        responseSize += len(output)")
+    }
+    if g.metadata {
+        g.P("        return emit(serialmeta.WrapOutput(ctx, output))")
+    } else {
+        g.P("        return emit(output)")
+    }
+    g.P("    }")
+}
+
+// emitsStream reports whether the serialized function of method emits its
+// outputs through a callback, as a server-streaming method, rather than
+// returning its output.
+func emitsStream(method *pb.MethodDescriptorProto) bool {
+    return method.GetServerStreaming() && !method.GetClientStreaming()
+}
+
+// unaryMethods returns the methods of service whose serialized function
+// returns its output, which the handlers and dispatchers of the serialized
+// API call, i.e. all but the server-streaming and bidirectional streaming
+// ones.
+func unaryMethods(service *pb.ServiceDescriptorProto) []*pb.MethodDescriptorProto {
+    var methods []*pb.MethodDescriptorProto
+    for _, method := range service.Method {
+        if !method.GetServerStreaming() {
+            methods = append(methods, method)
+        }
+    }
+    return methods
+}
+
+// generateHandle generates Handle, the generic helper implementing the
+// serialized functions, which the users can call to implement others, and
+// its variants for the server-streaming and bidirectional streaming methods
+// of service, if it has some.
+func (g *grpcserial) generateHandle(service *pb.ServiceDescriptorProto) {
+    g.P("// Handle decodes input into a new Req, calls fn with it and returns the")
+    g.P("// serialized Resp it returns, or its error. The serialized functions below")
+    g.P("// call it, as can the extra functions implemented the same way.")
+    g.P("func Handle[Req, Resp proto.Message](input []byte, fn func(context.Context, Req) (Resp, error)) ([]byte, error) {")
+    g.generateHandleInput("nil, err")
+    g.P("    out, err := fn(context.Background(), in)")
+    g.P("    if err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P("    return proto.Marshal(out)")
+    g.P("}")
+    g.P()
+    var stream, bidi bool
+    for _, method := range service.Method {
+        stream = stream || emitsStream(method)
+        bidi = bidi || isBidi(method)
+    }
+    if bidi {
+        g.generateHandleBidi()
+    }
+    if !stream {
+        return
+    }
+    g.P("// HandleStream decodes input into a new Req and calls fn with it and a send")
+    g.P("// function passing the serialized Resps it is given to emit. The serialized")
+    g.P("// functions of the server-streaming methods below call it.")
+    g.P("func HandleStream[Req, Resp proto.Message](input []byte, emit func(output []byte) error, fn func(context.Context, Req, func(Resp) error) error) error {")
+    g.generateHandleInput("err")
+    g.P("    return fn(context.Background(), in, func(out Resp) error {")
+    g.P("        output, err := proto.Marshal(out)")
+    g.P("        if err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.P("        return emit(output)")
+    g.P("    })")
+    g.P("}")
+    g.P()
+}
+
+// generateHandleInput generates the decoding, and validation, of the input
+// of Handle and HandleStream into in, returning ret on failure.
+func (g *grpcserial) generateHandleInput(ret string) {
+    g.P("    var in Req")
+    g.P("    in = reflect.New(reflect.TypeOf(in).Elem()).Interface().(Req)")
+    g.P("    if err := proto.Unmarshal(input, in); err != nil {")
+    g.P("        return " + ret)
+    g.P("    }")
+    if g.validate {
+        for _, hook := range []string{"Validate", "CustomValidate"} {
+            g.P(fmt.Sprintf("    if v, ok := interface{}(in).(interface{ %s() error }); ok {", hook))
+            g.P(fmt.Sprintf("        if err := v.%s(); err != nil {", hook))
+            g.P("            return " + ret)
+            g.P("        }")
+            g.P("    }")
+        }
+    }
+}
+
+// generatePools generates one sync.Pool per message type used by the service,
+// a pool of marshal buffers, and the marshalPooled helper using them.
+func (g *grpcserial) generatePools(service *pb.ServiceDescriptorProto) {
+    seen := make(map[string]bool)
+    for _, method := range service.Method {
+        for _, typ := range []string{method.GetInputType(), method.GetOutputType()} {
+            typeName := g.typeName(typ)
+            if seen[typeName] {
+                continue
+            }
+            seen[typeName] = true
+            g.P(fmt.Sprintf("var %sPool = sync.Pool{New: func() interface{} { return new(pb.%s) }}", unexport(typeName), typeName))
+        }
+    }
+    if g.runtimeV2 {
+        g.P("var bufferPool = sync.Pool{New: func() interface{} { return new([]byte) }}")
+    } else {
+        g.P("var bufferPool = sync.Pool{New: func() interface{} { return proto.NewBuffer(nil) }}")
+    }
+    g.P()
+    g.P("// marshalPooled serializes m using a pooled buffer.")
+    g.P("// The returned slice is a copy and does not alias the buffer.")
+    g.P("func marshalPooled(m proto.Message) ([]byte, error) {")
+    if g.runtimeV2 {
+        g.P("    buf := bufferPool.Get().(*[]byte)")
+        g.P("    defer bufferPool.Put(buf)")
+        g.P("    b, err := proto.MarshalOptions{}.MarshalAppend((*buf)[:0], m)")
+        g.P("    if err != nil {")
+        g.P("        return nil, err")
+        g.P("    }")
+        g.P("    *buf = b")
+        g.P("    return append([]byte(nil), b...), nil")
+    } else {
+        g.P("    buf := bufferPool.Get().(*proto.Buffer)")
+        g.P("    defer func() {")
+        g.P("        buf.Reset()")
+        g.P("        bufferPool.Put(buf)")
+        g.P("    }()")
+        g.P("    if err := buf.Marshal(m); err != nil {")
+        g.P("        return nil, err")
+        g.P("    }")
+        g.P("    return append([]byte(nil), buf.Bytes()...), nil")
+    }
+    g.P("}")
+    g.P()
+}
+
+// generatePoolRelease generates the deferred Reset and return to its pool
+// of the message held in varName.
+func (g *grpcserial) generatePoolRelease(varName string) {
+    g.P("    defer func() {")
+    g.P(fmt.Sprintf("        %s.Reset()", varName))
+    g.P(fmt.Sprintf("        %sPool.Put(%s)", varName, varName))
+    g.P("    }()")
+}
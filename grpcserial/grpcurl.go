@@ -0,0 +1,70 @@
+package grpcserial
+
+import (
+    "bytes"
+    "fmt"
+    "path"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// grpcurlScriptName returns the name of the grpcurl script of service, in
+// the testdata directory next to the Go file of file.
+func (g *grpcserial) grpcurlScriptName(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto) string {
+    dir := path.Dir(descutil.OutputName(g.gen, file.FileDescriptorProto, ".pb.go"))
+    return path.Join(dir, "testdata", strings.ToLower(service.GetName())+"_calls.sh")
+}
+
+// generateGrpcurl returns a shell script calling the methods of the
+// service of file at index with grpcurl, with an example JSON request each.
+// The script runs the calls of the methods given as arguments, or all of them.
+func (g *grpcserial) generateGrpcurl(file *generator.FileDescriptor, index int) string {
+    service := file.FileDescriptorProto.Service[index]
+    fullServName := service.GetName()
+    if pkg := file.GetPackage(); pkg != "" {
+        fullServName = pkg + "." + fullServName
+    }
+
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "#!/bin/sh\n")
+    fmt.Fprintf(&b, "# Code generated by protoc-gen-go. DO NOT EDIT.\n")
+    fmt.Fprintf(&b, "# source: %s\n", file.GetName())
+    fmt.Fprintf(&b, "#\n")
+    fmt.Fprintf(&b, "# Calls the %s methods with grpcurl.\n", fullServName)
+    fmt.Fprintf(&b, "#\n")
+    fmt.Fprintf(&b, "# Usage: %s [method...]\n", path.Base(g.grpcurlScriptName(file, service)))
+    fmt.Fprintf(&b, "#\n")
+    fmt.Fprintf(&b, "# Without arguments, every method is called. The environment variables are:\n")
+    fmt.Fprintf(&b, "#   ADDR           the address of the server, localhost:8080 by default\n")
+    fmt.Fprintf(&b, "#   PROTO_PATH     the import path of %s, . by default\n", file.GetName())
+    fmt.Fprintf(&b, "#   PROTO_FLAGS    the grpcurl flags giving the schema; set it empty to use\n")
+    fmt.Fprintf(&b, "#                  the reflection service of the server instead\n")
+    fmt.Fprintf(&b, "#   GRPCURL_FLAGS  additional grpcurl flags, e.g. -plaintext or -H\n")
+    fmt.Fprintf(&b, "set -e\n\n")
+    fmt.Fprintf(&b, "ADDR=${ADDR:-localhost:8080}\n")
+    fmt.Fprintf(&b, "PROTO_FLAGS=${PROTO_FLAGS-\"-import-path ${PROTO_PATH:-.} -proto %s\"}\n", file.GetName())
+
+    var methods []string
+    for i, method := range service.Method {
+        methods = append(methods, method.GetName())
+        b.WriteString("\n")
+        for _, line := range strings.Split(descutil.LeadingComments(file.FileDescriptorProto, fmt.Sprintf("6,%d,2,%d", index, i)), "\n") {
+            if line != "" {
+                fmt.Fprintf(&b, "# %s\n", line)
+            }
+        }
+        fmt.Fprintf(&b, "call_%s() {\n", method.GetName())
+        fmt.Fprintf(&b, "    grpcurl $GRPCURL_FLAGS $PROTO_FLAGS -d @ \"$ADDR\" %s/%s <<'EOF'\n", fullServName, method.GetName())
+        fmt.Fprintf(&b, "%s\nEOF\n", g.exampleJSON(method.GetInputType()))
+        fmt.Fprintf(&b, "}\n")
+    }
+    fmt.Fprintf(&b, "\n[ $# -gt 0 ] || set -- %s\n", strings.Join(methods, " "))
+    fmt.Fprintf(&b, "for method; do\n")
+    fmt.Fprintf(&b, "    echo \"# %s/$method\" >&2\n", fullServName)
+    fmt.Fprintf(&b, "    \"call_$method\"\n")
+    fmt.Fprintf(&b, "done\n")
+    return b.String()
+}
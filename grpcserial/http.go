@@ -0,0 +1,237 @@
+package grpcserial
+
+import (
+    "fmt"
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/httprpc"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// generateHTTPHandler generates an http.Handler serving the serialized API
+// of service: a POST to /<full service name>/<method> calls the method with
+// the request body as input, which is either a serialized protobuf object or,
+// with a JSON content type, its JSON mapping. The methods with a quota cost
+// charge it before they run, and the inputs of the methods with scopes carry
+// the caller of the request.
+func (g *grpcserial) generateHTTPHandler(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    handlerName := servName + "Handler"
+    quota := g.hasQuotaCosts(service)
+
+    g.P(fmt.Sprintf("// %s serves the %s serialized API over HTTP.", handlerName, servName))
+    g.P(fmt.Sprintf("// It accepts POST requests to /%s/<method>, whose body is the serialized", fullServName))
+    g.P("// input as application/x-protobuf, or its JSON mapping as application/json.")
+    g.P("// The output is written back in the same format.")
+    if quota {
+        g.P("// The methods with a (quota.cost) option charge their cost to the")
+        g.P("// httprpc.QuotaManager of the requests, as set by httprpc.QuotaHandler,")
+        g.P("// before they run.")
+    }
+    g.P(fmt.Sprintf("type %s struct{}", handlerName))
+    g.P()
+    g.P(fmt.Sprintf("func (%s) ServeHTTP(w http.ResponseWriter, r *http.Request) {", handlerName))
+    g.P("    if r.Method != \"POST\" {")
+    g.P("        w.Header().Set(\"Allow\", \"POST\")")
+    g.P("        http.Error(w, \"method not allowed\", http.StatusMethodNotAllowed)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    var call func(input []byte) (output []byte, err error)")
+    g.P("    var in, out proto.Message")
+    if quota {
+        g.P("    var cost int64")
+    }
+    if g.wrapsCaller(service) {
+        g.P("    var scoped bool")
+    }
+    g.P("    switch r.URL.Path {")
+    for _, method := range unaryMethods(service) {
+        g.P(fmt.Sprintf("    case \"/%s/%s\":", fullServName, method.GetName()))
+        g.generateScopedCase(service, method)
+        if quota {
+            g.P(fmt.Sprintf("        call, in, out, cost = %s, new(pb.%s), new(pb.%s), %s", generator.CamelCase(method.GetName()), g.typeName(method.GetInputType()), g.typeName(method.GetOutputType()), g.quotaCost(method)))
+            continue
+        }
+        g.P(fmt.Sprintf("        call, in, out = %s, new(pb.%s), new(pb.%s)", generator.CamelCase(method.GetName()), g.typeName(method.GetInputType()), g.typeName(method.GetOutputType())))
+    }
+    g.P("    default:")
+    g.P("        http.NotFound(w, r)")
+    g.P("        return")
+    g.P("    }")
+    g.P()
+    g.P("    input, err := ioutil.ReadAll(r.Body)")
+    g.P("    if err != nil {")
+    g.P("        http.Error(w, err.Error(), http.StatusBadRequest)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    isJSON := strings.HasPrefix(r.Header.Get(\"Content-Type\"), \"application/json\")")
+    g.P("    if isJSON {")
+    g.generateJSONInput("input", "http.Error(w, err.Error(), http.StatusBadRequest)", "return")
+    if g.runtimeV2 {
+        g.P("        if err := protojson.Unmarshal(input, in); err != nil {")
+    } else {
+        g.P("        if err := jsonpb.Unmarshal(bytes.NewReader(input), in); err != nil {")
+    }
+    g.P("            http.Error(w, err.Error(), http.StatusBadRequest)")
+    g.P("            return")
+    g.P("        }")
+    g.generateCheckEnums("        ", "http.Error(w, err.Error(), http.StatusBadRequest)", "return")
+    g.P("        if input, err = proto.Marshal(in); err != nil {")
+    g.P("            http.Error(w, err.Error(), http.StatusInternalServerError)")
+    g.P("            return")
+    g.P("        }")
+    g.P("    }")
+    g.P()
+    if quota {
+        g.generateChargeQuota("r.Context()", "cost", "http.Error(w, err.Error(), httprpc.ErrorFrom(err).Code.HTTPStatus())", "return")
+    }
+    g.generateWrapCaller(service, "r.Context()")
+    g.P("    output, err := call(input)")
+    g.P("    if err != nil {")
+    g.P("        http.Error(w, err.Error(), " + g.callErrorStatus(service) + ")")
+    g.P("        return")
+    g.P("    }")
+    g.generateUnwrapOutput(service, "w.Header()", "http.Error(w, err.Error(), http.StatusInternalServerError)", "return")
+    g.P("    if !isJSON {")
+    g.P("        w.Header().Set(\"Content-Type\", \"application/x-protobuf\")")
+    g.P("        w.Write(output)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    if err := proto.Unmarshal(output, out); err != nil {")
+    g.P("        http.Error(w, err.Error(), http.StatusInternalServerError)")
+    g.P("        return")
+    g.P("    }")
+    if g.runtimeV2 {
+        g.P("    if output, err = protojson.Marshal(out); err != nil {")
+        g.P("        http.Error(w, err.Error(), http.StatusInternalServerError)")
+        g.P("        return")
+        g.P("    }")
+        g.generateJSONOutput("output", "http.Error(w, err.Error(), http.StatusInternalServerError)", "return")
+        g.P("    w.Header().Set(\"Content-Type\", \"application/json\")")
+        g.P("    w.Write(output)")
+    } else if g.rewritesJSON() {
+        g.P("    var b bytes.Buffer")
+        g.P("    if err := new(jsonpb.Marshaler).Marshal(&b, out); err != nil {")
+        g.P("        http.Error(w, err.Error(), http.StatusInternalServerError)")
+        g.P("        return")
+        g.P("    }")
+        g.P("    output = b.Bytes()")
+        g.generateJSONOutput("output", "http.Error(w, err.Error(), http.StatusInternalServerError)", "return")
+        g.P("    w.Header().Set(\"Content-Type\", \"application/json\")")
+        g.P("    w.Write(output)")
+    } else {
+        g.P("    w.Header().Set(\"Content-Type\", \"application/json\")")
+        g.P("    new(jsonpb.Marshaler).Marshal(w, out)")
+    }
+    g.P("}")
+    g.P()
+}
+
+// callErrorStatus returns the expression of the HTTP status of the errors
+// of the serialized functions called by the handlers of service: the
+// status of their code, for the failed scope checks, if a method has
+// scopes, or else 500.
+func (g *grpcserial) callErrorStatus(service *pb.ServiceDescriptorProto) string {
+    if g.wrapsCaller(service) {
+        return "httprpc.ErrorFrom(err).Code.HTTPStatus()"
+    }
+    return "http.StatusInternalServerError"
+}
+
+// hasQuotaCosts reports whether a method of service has a quota cost.
+func (g *grpcserial) hasQuotaCosts(service *pb.ServiceDescriptorProto) bool {
+    for _, method := range service.Method {
+        if _, ok := descutil.QuotaCost(g.gen, method); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// quotaCost returns the quota cost of method as a Go literal, 0 if it has
+// none.
+func (g *grpcserial) quotaCost(method *pb.MethodDescriptorProto) string {
+    cost, _ := descutil.QuotaCost(g.gen, method)
+    return strconv.FormatInt(cost, 10)
+}
+
+// generateChargeQuota generates the charge of cost to the quota of the
+// caller of ctx, running onErr, if any, and ret on failure.
+func (g *grpcserial) generateChargeQuota(ctx, cost, onErr, ret string) {
+    g.P(fmt.Sprintf("    if err := httprpc.ChargeQuota(%s, %s); err != nil {", ctx, cost))
+    if onErr != "" {
+        g.P("        " + onErr)
+    }
+    g.P("        " + ret)
+    g.P("    }")
+}
+
+// rewritesJSON reports whether the JSON encodings of the messages differ
+// from the proto3 JSON mapping, and are rewritten by generateJSONOutput.
+func (g *grpcserial) rewritesJSON() bool {
+    return g.int64Numbers || g.enumNumbers || g.timestampFormat != ""
+}
+
+// generateJSONOutput generates the rewriting of the JSON encoding of out in
+// the variable v: its 64-bit integers, encoded as strings, are replaced by
+// numbers, as requested by int64_json=number, its enums too, as requested
+// by enum_json=number, and its timestamps encoded in the format and zone of
+// timestamp_json and timestamp_zone. On failure, the statement onErr, if
+// any, runs before ret.
+func (g *grpcserial) generateJSONOutput(v, onErr, ret string) {
+    if g.int64Numbers {
+        g.generateRewrite(v, fmt.Sprintf("httprpc.Int64Numbers(%s, out)", v), onErr, ret)
+    }
+    if g.enumNumbers {
+        g.generateRewrite(v, fmt.Sprintf("httprpc.EnumNumbers(%s, out)", v), onErr, ret)
+    }
+    if g.timestampFormat != "" {
+        g.generateRewrite(v, fmt.Sprintf("httprpc.FormatTimestamps(%s, out, %q, %q)", v, g.timestampFormat, g.timestampZone), onErr, ret)
+    }
+}
+
+// generateRewrite generates the assignment of the result of call to the
+// variable v, running onErr, if any, and ret on failure.
+func (g *grpcserial) generateRewrite(v, call, onErr, ret string) {
+    g.P(fmt.Sprintf("    if %s, err = %s; err != nil {", v, call))
+    if onErr != "" {
+        g.P("        " + onErr)
+    }
+    g.P("        " + ret)
+    g.P("    }")
+}
+
+// generateJSONInput generates the replacement of the timestamps of the JSON
+// encoding of in in the variable v, encoded as numbers of milliseconds with
+// timestamp_json=unix_millis, by the RFC 3339 strings the JSON decoders
+// accept. On failure, the statement onErr, if any, runs before ret.
+func (g *grpcserial) generateJSONInput(v, onErr, ret string) {
+    if g.timestampFormat != httprpc.TimestampUnixMillis {
+        return
+    }
+    g.P(fmt.Sprintf("    if parsed, err := httprpc.ParseTimestamps(%s, in); err != nil {", v))
+    if onErr != "" {
+        g.P("        " + onErr)
+    }
+    g.P("        " + ret)
+    g.P("    } else {")
+    g.P(fmt.Sprintf("        %s = parsed", v))
+    g.P("    }")
+}
+
+// generateCheckEnums generates the rejection of the enum values of in
+// unknown to their enum, once decoded from JSON, as requested by
+// enum_json_unknown=reject. On failure, the statement onErr, if any, runs
+// before ret.
+func (g *grpcserial) generateCheckEnums(indent, onErr, ret string) {
+    if !g.rejectUnknownEnums {
+        return
+    }
+    g.P(indent + "if err := httprpc.CheckEnums(in); err != nil {")
+    if onErr != "" {
+        g.P(indent + "    " + onErr)
+    }
+    g.P(indent + "    " + ret)
+    g.P(indent + "}")
+}
@@ -0,0 +1,128 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// generateInterceptors generates SerialHandler and SerialInterceptor, the
+// types of the calls of the serialized functions and of their interceptors,
+// UseSerialInterceptors, adding interceptors to the chain the serialized
+// functions are called through, and intercept, calling them through it.
+func (g *grpcserial) generateInterceptors() {
+    g.P("// SerialHandler handles a call of method, the full method, e.g.")
+    g.P("// \"/pkg.Service/Method\", with its serialized input and returns its serialized")
+    g.P("// output. The input of the bidirectional streaming methods, exchanged over")
+    g.P("// channels, is nil, as is the output of the streaming methods.")
+    g.P("type SerialHandler func(ctx context.Context, method string, input []byte) ([]byte, error)")
+    g.P()
+    g.P("// SerialInterceptor intercepts the calls of the serialized functions: it may")
+    g.P("// inspect or replace the context, input, output and error of a call, or fail")
+    g.P("// it, and calls next to continue it. The context it passes on is the parent")
+    g.P("// of the context passed to the implementation of the method.")
+    g.P("type SerialInterceptor func(ctx context.Context, method string, input []byte, next SerialHandler) ([]byte, error)")
+    g.P()
+    g.P("// serialInterceptors is the chain of interceptors of the calls, the first")
+    g.P("// outermost.")
+    g.P("var serialInterceptors []SerialInterceptor")
+    g.P()
+    g.P("// UseSerialInterceptors appends interceptors to the chain of interceptors of")
+    g.P("// the calls of the serialized functions, the first added outermost. It is not")
+    g.P("// safe to call concurrently with the calls: set them up at initialization.")
+    g.P("func UseSerialInterceptors(interceptors ...SerialInterceptor) {")
+    g.P("    serialInterceptors = append(serialInterceptors, interceptors...)")
+    g.P("}")
+    g.P()
+    g.P("// intercept calls call with ctx and input through the chain of interceptors")
+    g.P("// of the calls of method.")
+    g.P("func intercept(ctx context.Context, method string, input []byte, call func(context.Context, []byte) ([]byte, error)) ([]byte, error) {")
+    g.P("    next := SerialHandler(func(ctx context.Context, _ string, input []byte) ([]byte, error) {")
+    g.P("        return call(ctx, input)")
+    g.P("    })")
+    g.P("    for i := len(serialInterceptors) - 1; i >= 0; i-- {")
+    g.P("        interceptor, inner := serialInterceptors[i], next")
+    g.P("        next = func(ctx context.Context, method string, input []byte) ([]byte, error) {")
+    g.P("            return interceptor(ctx, method, input, inner)")
+    g.P("        }")
+    g.P("    }")
+    g.P("    return next(ctx, method, input)")
+    g.P("}")
+    g.P()
+}
+
+// serialFuncName returns the name of the function implementing the
+// serialized function of method: call<Method> with interceptors=true, the
+// serialized function calling it through the interceptors, or else the
+// serialized function itself.
+func (g *grpcserial) serialFuncName(method *pb.MethodDescriptorProto) string {
+    if g.interceptors {
+        return "call" + generator.CamelCase(method.GetName())
+    }
+    return generator.CamelCase(method.GetName())
+}
+
+// interceptedParam returns the context parameter of the function named by
+// serialFuncName, given by the interceptors, or "".
+func (g *grpcserial) interceptedParam() string {
+    if g.interceptors {
+        return "ctx context.Context, "
+    }
+    return ""
+}
+
+// parentCtx returns the parent of the contexts of the calls of the
+// serialized functions: the context given by the interceptors with
+// interceptors=true, or else the background context.
+func (g *grpcserial) parentCtx() string {
+    if g.interceptors {
+        return "ctx"
+    }
+    return "context.Background()"
+}
+
+// assignCtx returns the operator of the first assignment of ctx in the
+// serialized functions: "=" with interceptors=true, ctx being a parameter,
+// or else ":=".
+func (g *grpcserial) assignCtx() string {
+    if g.interceptors {
+        return "="
+    }
+    return ":="
+}
+
+// generateIntercept generates, with interceptors=true, the serialized
+// function of method of the service named fullServName, calling the
+// function named by serialFuncName through the interceptors, and the
+// beginning of the doc comment of the latter.
+func (g *grpcserial) generateIntercept(fullServName string, method *pb.MethodDescriptorProto) {
+    if !g.interceptors {
+        return
+    }
+    methodName := generator.CamelCase(method.GetName())
+    fullMethod := fmt.Sprintf("/%s/%s", fullServName, method.GetName())
+    callName := g.serialFuncName(method)
+    switch {
+    case isBidi(method):
+        g.P(fmt.Sprintf("func %s(in <-chan []byte, out chan<- []byte) error {", methodName))
+        g.P("    defer close(out)")
+        g.P(fmt.Sprintf("    _, err := intercept(context.Background(), %q, nil, func(ctx context.Context, _ []byte) ([]byte, error) {", fullMethod))
+        g.P(fmt.Sprintf("        return nil, %s(ctx, in, out)", callName))
+        g.P("    })")
+        g.P("    return err")
+    case emitsStream(method):
+        g.P(fmt.Sprintf("func %s(input []byte, emit func(output []byte) error) error {", methodName))
+        g.P(fmt.Sprintf("    _, err := intercept(context.Background(), %q, input, func(ctx context.Context, input []byte) ([]byte, error) {", fullMethod))
+        g.P(fmt.Sprintf("        return nil, %s(ctx, input, emit)", callName))
+        g.P("    })")
+        g.P("    return err")
+    default:
+        g.P(fmt.Sprintf("func %s(input []byte) (output []byte, err error) {", methodName))
+        g.P(fmt.Sprintf("    return intercept(context.Background(), %q, input, %s)", fullMethod, callName))
+    }
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s implements %s, called through the interceptors with their", callName, methodName))
+    g.P("// context.")
+}
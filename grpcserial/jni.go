@@ -0,0 +1,174 @@
+package grpcserial
+
+import (
+    "bytes"
+    "fmt"
+    "path"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// javaPackage returns the Java package of the classes of file: its
+// java_package option, or else its protobuf package, as protoc does.
+func javaPackage(file *generator.FileDescriptor) string {
+    if pkg := file.GetOptions().GetJavaPackage(); pkg != "" {
+        return pkg
+    }
+    return file.GetPackage()
+}
+
+// javaFileName returns the name of the Java class skeleton of service.
+func (g *grpcserial) javaFileName(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto) string {
+    dir := path.Dir(descutil.OutputName(g.gen, file.FileDescriptorProto, ".pb.go"))
+    return path.Join(dir, generator.CamelCase(service.GetName())+".java")
+}
+
+// javaKeywords are the Java keywords and literals, suffixed with an
+// underscore when they name a native method.
+var javaKeywords = map[string]bool{
+    "abstract": true, "assert": true, "boolean": true, "break": true, "byte": true, "case": true,
+    "catch": true, "char": true, "class": true, "const": true, "continue": true, "default": true,
+    "do": true, "double": true, "else": true, "enum": true, "extends": true, "false": true,
+    "final": true, "finally": true, "float": true, "for": true, "goto": true, "if": true,
+    "implements": true, "import": true, "instanceof": true, "int": true, "interface": true,
+    "long": true, "native": true, "new": true, "null": true, "package": true, "private": true,
+    "protected": true, "public": true, "return": true, "short": true, "static": true,
+    "strictfp": true, "super": true, "switch": true, "synchronized": true, "this": true,
+    "throw": true, "throws": true, "transient": true, "true": true, "try": true, "void": true,
+    "volatile": true, "while": true,
+}
+
+// javaMethodName returns the name of the native method calling method.
+func javaMethodName(method *pb.MethodDescriptorProto) string {
+    name := unexport(generator.CamelCase(method.GetName()))
+    if javaKeywords[name] {
+        name += "_"
+    }
+    return name
+}
+
+// jniMangle escapes name as a part of a JNI function name.
+func jniMangle(name string) string {
+    var b strings.Builder
+    for _, r := range name {
+        switch {
+        case r == '_':
+            b.WriteString("_1")
+        case r == ';':
+            b.WriteString("_2")
+        case r == '[':
+            b.WriteString("_3")
+        case r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'):
+            b.WriteRune(r)
+        default:
+            fmt.Fprintf(&b, "_0%04x", r)
+        }
+    }
+    return b.String()
+}
+
+// jniName returns the name of the JNI function implementing the native
+// method of the Java class of service calling method.
+func jniName(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto, method *pb.MethodDescriptorProto) string {
+    name := "Java_"
+    if pkg := javaPackage(file); pkg != "" {
+        for _, part := range strings.Split(pkg, ".") {
+            name += jniMangle(part) + "_"
+        }
+    }
+    return name + jniMangle(generator.CamelCase(service.GetName())) + "_" + jniMangle(javaMethodName(method))
+}
+
+// generateJNIPreamble generates the cgo preamble of the JNI exports: the
+// calls through the JNIEnv function table cannot be made from Go.
+func (g *grpcserial) generateJNIPreamble() {
+    g.P("// #include <jni.h>")
+    g.P("//")
+    g.P("// static inline jsize jniLength(JNIEnv* env, jbyteArray a) { return (*env)->GetArrayLength(env, a); }")
+    g.P("// static inline void jniRead(JNIEnv* env, jbyteArray a, jsize n, void* p) { (*env)->GetByteArrayRegion(env, a, 0, n, p); }")
+    g.P("// static inline jbyteArray jniBytes(JNIEnv* env, void* p, jsize n) {")
+    g.P("//     jbyteArray a = (*env)->NewByteArray(env, n);")
+    g.P("//     if (a != NULL) (*env)->SetByteArrayRegion(env, a, 0, n, p);")
+    g.P("//     return a;")
+    g.P("// }")
+    g.P("// static inline void jniThrow(JNIEnv* env, const char* msg) {")
+    g.P("//     jclass c = (*env)->FindClass(env, \"java/lang/RuntimeException\");")
+    g.P("//     if (c != NULL) (*env)->ThrowNew(env, c, msg);")
+    g.P("// }")
+}
+
+// generateJNIExports generates the JNI exports of the serialized API of
+// service, implementing the native methods of the Java class skeleton.
+func (g *grpcserial) generateJNIExports(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto) {
+    for _, method := range unaryMethods(service) {
+        name := jniName(file, service, method)
+        g.P(fmt.Sprintf("//export %s", name))
+        g.P(fmt.Sprintf("func %s(env *C.JNIEnv, class C.jclass, input C.jbyteArray) C.jbyteArray {", name))
+        g.P(fmt.Sprintf("    return jniCall(%s, env, input)", generator.CamelCase(method.GetName())))
+        g.P("}")
+        g.P()
+    }
+    g.P("// jniCall calls a method of the serialized API on its JNI arguments.")
+    g.P("// On failure, it throws a RuntimeException with the error message.")
+    g.P("func jniCall(call func(input []byte) (output []byte, err error), env *C.JNIEnv, input C.jbyteArray) C.jbyteArray {")
+    g.P("    var in []byte")
+    g.P("    if input != 0 {")
+    g.P("        in = make([]byte, int(C.jniLength(env, input)))")
+    g.P("        if len(in) > 0 {")
+    g.P("            C.jniRead(env, input, C.jsize(len(in)), unsafe.Pointer(&in[0]))")
+    g.P("        }")
+    g.P("    }")
+    g.P("    out, err := call(in)")
+    g.P("    if err != nil {")
+    g.P("        msg := C.CString(err.Error())")
+    g.P("        defer C.free(unsafe.Pointer(msg))")
+    g.P("        C.jniThrow(env, msg)")
+    g.P("        return 0")
+    g.P("    }")
+    g.P("    var p unsafe.Pointer")
+    g.P("    if len(out) > 0 {")
+    g.P("        p = unsafe.Pointer(&out[0])")
+    g.P("    }")
+    g.P("    return C.jniBytes(env, p, C.jsize(len(out)))")
+    g.P("}")
+    g.P()
+}
+
+// generateJava returns the Java class skeleton declaring the native methods
+// of service exported with JNI by the example implementation, loading the
+// library of a -buildmode=c-shared build of it, named as its Go package.
+func (g *grpcserial) generateJava(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto) string {
+    servName := generator.CamelCase(service.GetName())
+    library, _ := goPackageName(file)
+
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "// Code generated by protoc-gen-go. DO NOT EDIT.\n")
+    fmt.Fprintf(&b, "// source: %s\n", file.GetName())
+    if pkg := javaPackage(file); pkg != "" {
+        fmt.Fprintf(&b, "\npackage %s;\n", pkg)
+    }
+    fmt.Fprintf(&b, "\n/**\n")
+    fmt.Fprintf(&b, " * %s is the serialized API of the %s service, implemented in Go and\n", servName, service.GetName())
+    fmt.Fprintf(&b, " * exported with JNI by the lib%s shared library.\n", library)
+    fmt.Fprintf(&b, " */\n")
+    fmt.Fprintf(&b, "public final class %s {\n", servName)
+    fmt.Fprintf(&b, "    static {\n")
+    fmt.Fprintf(&b, "        System.loadLibrary(%q);\n", library)
+    fmt.Fprintf(&b, "    }\n\n")
+    fmt.Fprintf(&b, "    private %s() {}\n", servName)
+    for _, method := range unaryMethods(service) {
+        fmt.Fprintf(&b, "\n    /**\n")
+        fmt.Fprintf(&b, "     * Calls %s.\n", method.GetName())
+        fmt.Fprintf(&b, "     *\n")
+        fmt.Fprintf(&b, "     * @param input a serialized protobuf object of type %s\n", g.typeName(method.GetInputType()))
+        fmt.Fprintf(&b, "     * @return a serialized protobuf object of type %s\n", g.typeName(method.GetOutputType()))
+        fmt.Fprintf(&b, "     * @throws RuntimeException with the error message if the call fails\n")
+        fmt.Fprintf(&b, "     */\n")
+        fmt.Fprintf(&b, "    public static native byte[] %s(byte[] input);\n", javaMethodName(method))
+    }
+    fmt.Fprintf(&b, "}\n")
+    return b.String()
+}
@@ -0,0 +1,224 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// generateJSONRPC generates a JSON-RPC 2.0 dispatcher of the serialized API
+// of service: the method <full service name>.<method> calls the method with
+// the JSON mapping of its input as params, and returns the JSON mapping of
+// its output as result. Batches and notifications are supported. If some
+// methods have a quota cost, or scopes, the requests are handled with a
+// context, to which the cost is charged before the methods run, or whose
+// caller calls them.
+func (g *grpcserial) generateJSONRPC(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    dispatcherName := servName + "JSONRPC"
+    quota := g.hasQuotaCosts(service)
+    // ctx and ctxParam are the context argument and parameter of handle
+    // and call, if any.
+    ctx, ctxParam := "", ""
+    if quota || g.wrapsCaller(service) {
+        ctx, ctxParam = "ctx, ", "ctx context.Context, "
+    }
+
+    g.P(fmt.Sprintf("// %s dispatches JSON-RPC 2.0 requests to the %s serialized API.", dispatcherName, servName))
+    g.P(fmt.Sprintf("// Its methods are named %s.<method>, their params are the JSON", fullServName))
+    g.P("// mapping of their input and their result the JSON mapping of their output.")
+    g.P("// It serves JSON-RPC over HTTP POST requests as an http.Handler.")
+    if quota {
+        g.P("// The methods with a (quota.cost) option charge their cost to the")
+        g.P("// httprpc.QuotaManager of the requests, as set by httprpc.QuotaHandler,")
+        g.P("// or of the context given to HandleContext, before they run.")
+    }
+    if g.wrapsCaller(service) {
+        g.P("// The methods with an (auth.scopes) option are called by the principal and")
+        g.P("// with the scopes of the requests, as set by httprpc.WithPrincipal and")
+        g.P("// httprpc.WithScopes, or of the context given to HandleContext.")
+    }
+    g.P(fmt.Sprintf("type %s struct{}", dispatcherName))
+    g.P()
+    g.P("// jsonrpcRequest is a JSON-RPC 2.0 request. An absent id makes it a notification.")
+    g.P("type jsonrpcRequest struct {")
+    g.P("    Version string          `json:\"jsonrpc\"`")
+    g.P("    Method  string          `json:\"method\"`")
+    g.P("    Params  json.RawMessage `json:\"params\"`")
+    g.P("    ID      json.RawMessage `json:\"id\"`")
+    g.P("}")
+    g.P()
+    g.P("// jsonrpcResponse is a JSON-RPC 2.0 response.")
+    g.P("type jsonrpcResponse struct {")
+    g.P("    Version string          `json:\"jsonrpc\"`")
+    g.P("    Result  json.RawMessage `json:\"result,omitempty\"`")
+    g.P("    Error   *jsonrpcError   `json:\"error,omitempty\"`")
+    g.P("    ID      json.RawMessage `json:\"id\"`")
+    g.P("}")
+    g.P()
+    g.P("// jsonrpcError is a JSON-RPC 2.0 error.")
+    g.P("type jsonrpcError struct {")
+    g.P("    Code    int    `json:\"code\"`")
+    g.P("    Message string `json:\"message\"`")
+    g.P("}")
+    g.P()
+    g.P("// jsonrpcReply returns the response to the request with the given id.")
+    g.P("func jsonrpcReply(id, result json.RawMessage, code int, message string) []byte {")
+    g.P("    resp := jsonrpcResponse{Version: \"2.0\", Result: result, ID: id}")
+    g.P("    if code != 0 {")
+    g.P("        resp.Error = &jsonrpcError{code, message}")
+    g.P("    }")
+    g.P("    b, _ := json.Marshal(resp)")
+    g.P("    return b")
+    g.P("}")
+    g.P()
+    g.P("// Handle handles a JSON-RPC 2.0 request, or batch of requests, and returns")
+    g.P("// the response, or nil if there is none, as for notifications.")
+    if ctx != "" {
+        g.P(fmt.Sprintf("func (d %s) Handle(request []byte) []byte {", dispatcherName))
+        g.P("    return d.HandleContext(context.Background(), request)")
+        g.P("}")
+        g.P()
+        if quota {
+            g.P("// HandleContext is Handle with the context ctx, whose quota manager and")
+            g.P("// principal are charged the cost of the methods called.")
+        } else {
+            g.P("// HandleContext is Handle with the context ctx, whose principal and")
+            g.P("// scopes call the methods with scopes.")
+        }
+        g.P(fmt.Sprintf("func (d %s) HandleContext(ctx context.Context, request []byte) []byte {", dispatcherName))
+    } else {
+        g.P(fmt.Sprintf("func (d %s) Handle(request []byte) []byte {", dispatcherName))
+    }
+    g.P("    request = bytes.TrimSpace(request)")
+    g.P("    if !json.Valid(request) {")
+    g.P("        return jsonrpcReply(nil, nil, -32700, \"parse error\")")
+    g.P("    }")
+    g.P("    if len(request) == 0 || request[0] != '[' {")
+    g.P("        return d.handle(" + ctx + "request)")
+    g.P("    }")
+    g.P("    var batch []json.RawMessage")
+    g.P("    json.Unmarshal(request, &batch)")
+    g.P("    if len(batch) == 0 {")
+    g.P("        return jsonrpcReply(nil, nil, -32600, \"invalid request: empty batch\")")
+    g.P("    }")
+    g.P("    var responses []json.RawMessage")
+    g.P("    for _, req := range batch {")
+    g.P("        if resp := d.handle(" + ctx + "req); resp != nil {")
+    g.P("            responses = append(responses, resp)")
+    g.P("        }")
+    g.P("    }")
+    g.P("    if len(responses) == 0 {")
+    g.P("        return nil")
+    g.P("    }")
+    g.P("    b, _ := json.Marshal(responses)")
+    g.P("    return b")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("func (d %s) handle(%srequest []byte) []byte {", dispatcherName, ctxParam))
+    g.P("    var req jsonrpcRequest")
+    g.P("    if err := json.Unmarshal(request, &req); err != nil || req.Version != \"2.0\" || req.Method == \"\" {")
+    g.P("        return jsonrpcReply(req.ID, nil, -32600, \"invalid request\")")
+    g.P("    }")
+    g.P("    result, code, message := d.call(" + ctx + "req.Method, req.Params)")
+    g.P("    if len(req.ID) == 0 {")
+    g.P("        return nil")
+    g.P("    }")
+    g.P("    return jsonrpcReply(req.ID, result, code, message)")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("func (d %s) call(%smethod string, params json.RawMessage) (result json.RawMessage, code int, message string) {", dispatcherName, ctxParam))
+    g.P("    var call func(input []byte) (output []byte, err error)")
+    g.P("    var in, out proto.Message")
+    if quota {
+        g.P("    var cost int64")
+    }
+    if g.wrapsCaller(service) {
+        g.P("    var scoped bool")
+    }
+    g.P("    switch method {")
+    for _, method := range unaryMethods(service) {
+        g.P(fmt.Sprintf("    case \"%s.%s\":", fullServName, method.GetName()))
+        g.generateScopedCase(service, method)
+        if quota {
+            g.P(fmt.Sprintf("        call, in, out, cost = %s, new(pb.%s), new(pb.%s), %s", generator.CamelCase(method.GetName()), g.typeName(method.GetInputType()), g.typeName(method.GetOutputType()), g.quotaCost(method)))
+            continue
+        }
+        g.P(fmt.Sprintf("        call, in, out = %s, new(pb.%s), new(pb.%s)", generator.CamelCase(method.GetName()), g.typeName(method.GetInputType()), g.typeName(method.GetOutputType())))
+    }
+    g.P("    default:")
+    g.P("        return nil, -32601, \"method not found\"")
+    g.P("    }")
+    g.P("    if len(params) > 0 && string(params) != \"null\" {")
+    g.generateJSONInput("params", "", "return nil, -32602, \"invalid params: \" + err.Error()")
+    if g.runtimeV2 {
+        g.P("        if err := protojson.Unmarshal(params, in); err != nil {")
+    } else {
+        g.P("        if err := jsonpb.Unmarshal(bytes.NewReader(params), in); err != nil {")
+    }
+    g.P("            return nil, -32602, \"invalid params: \" + err.Error()")
+    g.P("        }")
+    g.generateCheckEnums("        ", "", "return nil, -32602, \"invalid params: \" + err.Error()")
+    g.P("    }")
+    g.P("    input, err := proto.Marshal(in)")
+    g.P("    if err != nil {")
+    g.P("        return nil, -32603, err.Error()")
+    g.P("    }")
+    if quota {
+        g.generateChargeQuota("ctx", "cost", "", "return nil, -32000, err.Error()")
+    }
+    g.generateWrapCaller(service, "ctx")
+    g.P("    output, err := call(input)")
+    g.P("    if err != nil {")
+    g.P("        return nil, -32000, err.Error()")
+    g.P("    }")
+    g.generateUnwrapOutput(service, "", "", "return nil, -32603, err.Error()")
+    g.P("    if err := proto.Unmarshal(output, out); err != nil {")
+    g.P("        return nil, -32603, err.Error()")
+    g.P("    }")
+    if g.runtimeV2 {
+        g.P("    if result, err = protojson.Marshal(out); err != nil {")
+        g.P("        return nil, -32603, err.Error()")
+        g.P("    }")
+        g.generateJSONOutput("result", "", "return nil, -32603, err.Error()")
+        g.P("    return result, 0, \"\"")
+    } else {
+        g.P("    var b bytes.Buffer")
+        g.P("    if err := new(jsonpb.Marshaler).Marshal(&b, out); err != nil {")
+        g.P("        return nil, -32603, err.Error()")
+        g.P("    }")
+        if g.rewritesJSON() {
+            g.P("    result = b.Bytes()")
+            g.generateJSONOutput("result", "", "return nil, -32603, err.Error()")
+            g.P("    return result, 0, \"\"")
+        } else {
+            g.P("    return b.Bytes(), 0, \"\"")
+        }
+    }
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("func (d %s) ServeHTTP(w http.ResponseWriter, r *http.Request) {", dispatcherName))
+    g.P("    if r.Method != \"POST\" {")
+    g.P("        w.Header().Set(\"Allow\", \"POST\")")
+    g.P("        http.Error(w, \"method not allowed\", http.StatusMethodNotAllowed)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    request, err := ioutil.ReadAll(r.Body)")
+    g.P("    if err != nil {")
+    g.P("        http.Error(w, err.Error(), http.StatusBadRequest)")
+    g.P("        return")
+    g.P("    }")
+    if ctx != "" {
+        g.P("    response := d.HandleContext(r.Context(), request)")
+    } else {
+        g.P("    response := d.Handle(request)")
+    }
+    g.P("    if response == nil {")
+    g.P("        w.WriteHeader(http.StatusNoContent)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    w.Header().Set(\"Content-Type\", \"application/json\")")
+    g.P("    w.Write(response)")
+    g.P("}")
+    g.P()
+}
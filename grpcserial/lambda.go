@@ -0,0 +1,158 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// generateLambda generates the AWS Lambda handlers of service: a
+// <Method>Lambda per unary method, implementing the lambda.Handler of
+// github.com/aws/aws-lambda-go, and the helpers decoding their invocations,
+// either API Gateway proxy events or direct invocations, and encoding their
+// responses.
+func (g *grpcserial) generateLambda(service *pb.ServiceDescriptorProto) {
+    for _, method := range unaryMethods(service) {
+        methName := generator.CamelCase(method.GetName())
+        g.P(fmt.Sprintf("// %sLambda is the lambda.Handler of %s, serving it as a Lambda function,", methName, methName))
+        g.P(fmt.Sprintf("// e.g. with lambda.StartHandler(%sLambda{}).", methName))
+        g.P(fmt.Sprintf("type %sLambda struct{}", methName))
+        g.P()
+        g.P(fmt.Sprintf("// Invoke calls %s with the input of the invocation payload, an API", methName))
+        g.P("// Gateway proxy event or a direct invocation, and returns its output in the")
+        g.P("// same format, as described for invokeLambda.")
+        g.P(fmt.Sprintf("func (%sLambda) Invoke(ctx context.Context, payload []byte) ([]byte, error) {", methName))
+        g.P(fmt.Sprintf("    return invokeLambda(payload, %s, new(pb.%s), new(pb.%s))", methName, g.typeName(method.GetInputType()), g.typeName(method.GetOutputType())))
+        g.P("}")
+        g.P()
+    }
+    g.P("// lambdaProxyRequest is the part of the API Gateway proxy events, of the")
+    g.P("// REST and HTTP APIs, read by the Lambda handlers.")
+    g.P("type lambdaProxyRequest struct {")
+    g.P("    RequestContext  json.RawMessage   `json:\"requestContext\"`")
+    g.P("    Headers         map[string]string `json:\"headers\"`")
+    g.P("    Body            string            `json:\"body\"`")
+    g.P("    IsBase64Encoded bool              `json:\"isBase64Encoded\"`")
+    g.P("}")
+    g.P()
+    g.P("// lambdaProxyResponse is the response of the Lambda handlers to the API")
+    g.P("// Gateway proxy events.")
+    g.P("type lambdaProxyResponse struct {")
+    g.P("    StatusCode      int               `json:\"statusCode\"`")
+    g.P("    Headers         map[string]string `json:\"headers\"`")
+    g.P("    Body            string            `json:\"body\"`")
+    g.P("    IsBase64Encoded bool              `json:\"isBase64Encoded\"`")
+    g.P("}")
+    g.P()
+    g.P("// invokeLambda calls call, of input in and output out, with the input of an")
+    g.P("// invocation payload and returns its output:")
+    g.P("//  - an API Gateway proxy event, with a request context, holds the serialized")
+    g.P("//    input in its body or, with a JSON content type, its JSON mapping, and is")
+    g.P("//    responded to with a proxy response holding the output in the same")
+    g.P("//    format, or the error message of a failed call with its HTTP status;")
+    g.P("//  - a JSON string is the serialized input, base64-encoded, and is responded")
+    g.P("//    to with the serialized output so encoded;")
+    g.P("//  - any other payload is the JSON mapping of the input, and is responded to")
+    g.P("//    with the JSON mapping of the output.")
+    g.P("// The direct invocations fail with the error of the call.")
+    g.P("func invokeLambda(payload []byte, call func(input []byte) ([]byte, error), in, out proto.Message) ([]byte, error) {")
+    g.P("    var event lambdaProxyRequest")
+    g.P("    if json.Unmarshal(payload, &event) == nil && event.RequestContext != nil {")
+    g.P("        return serveLambdaProxy(event, call, in, out)")
+    g.P("    }")
+    g.P("    var input []byte")
+    g.P("    if json.Unmarshal(payload, &input) == nil {")
+    g.P("        output, _, err := callLambda(input, false, call, in, out)")
+    g.P("        if err != nil {")
+    g.P("            return nil, err")
+    g.P("        }")
+    g.P("        return json.Marshal(output)")
+    g.P("    }")
+    g.P("    output, _, err := callLambda(payload, true, call, in, out)")
+    g.P("    if err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P("    return output, nil")
+    g.P("}")
+    g.P()
+    g.P("// serveLambdaProxy calls call with the input of the body of an API Gateway")
+    g.P("// proxy event and returns the proxy response, encoded.")
+    g.P("func serveLambdaProxy(event lambdaProxyRequest, call func(input []byte) ([]byte, error), in, out proto.Message) ([]byte, error) {")
+    g.P("    input := []byte(event.Body)")
+    g.P("    if event.IsBase64Encoded {")
+    g.P("        var err error")
+    g.P("        if input, err = base64.StdEncoding.DecodeString(event.Body); err != nil {")
+    g.P("            return lambdaProxyReply(http.StatusBadRequest, \"text/plain; charset=utf-8\", []byte(err.Error()))")
+    g.P("        }")
+    g.P("    }")
+    g.P("    contentType := \"application/x-protobuf\"")
+    g.P("    for name, value := range event.Headers {")
+    g.P("        if strings.EqualFold(name, \"Content-Type\") && strings.HasPrefix(value, \"application/json\") {")
+    g.P("            contentType = \"application/json\"")
+    g.P("        }")
+    g.P("    }")
+    g.P("    output, status, err := callLambda(input, contentType == \"application/json\", call, in, out)")
+    g.P("    if err != nil {")
+    g.P("        return lambdaProxyReply(status, \"text/plain; charset=utf-8\", []byte(err.Error()))")
+    g.P("    }")
+    g.P("    return lambdaProxyReply(status, contentType, output)")
+    g.P("}")
+    g.P()
+    g.P("// lambdaProxyReply returns the encoded API Gateway proxy response of the")
+    g.P("// given status and body, base64-encoded unless it is text.")
+    g.P("func lambdaProxyReply(status int, contentType string, body []byte) ([]byte, error) {")
+    g.P("    resp := lambdaProxyResponse{StatusCode: status, Headers: map[string]string{\"Content-Type\": contentType}, Body: string(body)}")
+    g.P("    if contentType == \"application/x-protobuf\" {")
+    g.P("        resp.Body, resp.IsBase64Encoded = base64.StdEncoding.EncodeToString(body), true")
+    g.P("    }")
+    g.P("    return json.Marshal(resp)")
+    g.P("}")
+    g.P()
+    g.P("// callLambda calls call with input, the serialized input or, if isJSON, its")
+    g.P("// JSON mapping decoded in in, and returns its output in the same format,")
+    g.P("// encoded from out, with the HTTP status of the call.")
+    g.P("func callLambda(input []byte, isJSON bool, call func(input []byte) ([]byte, error), in, out proto.Message) ([]byte, int, error) {")
+    g.P("    if !isJSON {")
+    g.P("        output, err := call(input)")
+    g.P("        if err != nil {")
+    g.P("            return nil, http.StatusInternalServerError, err")
+    g.P("        }")
+    g.P("        return output, http.StatusOK, nil")
+    g.P("    }")
+    g.generateJSONInput("input", "", "return nil, http.StatusBadRequest, err")
+    if g.runtimeV2 {
+        g.P("    if err := protojson.Unmarshal(input, in); err != nil {")
+    } else {
+        g.P("    if err := jsonpb.Unmarshal(bytes.NewReader(input), in); err != nil {")
+    }
+    g.P("        return nil, http.StatusBadRequest, err")
+    g.P("    }")
+    g.generateCheckEnums("    ", "", "return nil, http.StatusBadRequest, err")
+    g.P("    input, err := proto.Marshal(in)")
+    g.P("    if err != nil {")
+    g.P("        return nil, http.StatusInternalServerError, err")
+    g.P("    }")
+    g.P("    output, err := call(input)")
+    g.P("    if err != nil {")
+    g.P("        return nil, http.StatusInternalServerError, err")
+    g.P("    }")
+    g.P("    if err := proto.Unmarshal(output, out); err != nil {")
+    g.P("        return nil, http.StatusInternalServerError, err")
+    g.P("    }")
+    if g.runtimeV2 {
+        g.P("    if output, err = protojson.Marshal(out); err != nil {")
+        g.P("        return nil, http.StatusInternalServerError, err")
+        g.P("    }")
+    } else {
+        g.P("    var b bytes.Buffer")
+        g.P("    if err := new(jsonpb.Marshaler).Marshal(&b, out); err != nil {")
+        g.P("        return nil, http.StatusInternalServerError, err")
+        g.P("    }")
+        g.P("    output = b.Bytes()")
+    }
+    g.generateJSONOutput("output", "", "return nil, http.StatusInternalServerError, err")
+    g.P("    return output, http.StatusOK, nil")
+    g.P("}")
+    g.P()
+}
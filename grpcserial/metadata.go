@@ -0,0 +1,84 @@
+package grpcserial
+
+import pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+
+// unwrapsMetadata reports whether the serialized function of method
+// unwraps the metadata from the serialmeta envelope of its input, with
+// metadata=true. The inputs of the bidirectional streaming methods carry
+// no envelope.
+func (g *grpcserial) unwrapsMetadata(method *pb.MethodDescriptorProto) bool {
+    return g.metadata && !isBidi(method)
+}
+
+// unwrapsInput reports whether the serialized function of method unwraps
+// the serialmeta envelope of its input, for its caller or its metadata.
+func (g *grpcserial) unwrapsInput(method *pb.MethodDescriptorProto) bool {
+    return g.unwrapsCaller(method) || g.unwrapsMetadata(method)
+}
+
+// unwrapFunc returns the name of the generated function unwrapping the
+// serialmeta envelope of the inputs: extractContext with tracing=true,
+// unwrapMetadata with metadata=true, or else unwrapCaller.
+func (g *grpcserial) unwrapFunc() string {
+    switch {
+    case g.tracing:
+        return "extractContext"
+    case g.metadata:
+        return "unwrapMetadata"
+    }
+    return "unwrapCaller"
+}
+
+// generateUnwrapMetadata generates unwrapMetadata, unwrapping the
+// serialmeta envelope of the inputs into the metadata of the context of the
+// calls, and the caller it carries too if callers is set.
+func (g *grpcserial) generateUnwrapMetadata(callers bool) {
+    g.P("// unwrapMetadata returns the input without its serialmeta envelope, if it")
+    if callers {
+        g.P("// has one, and ctx with the metadata the envelope carries, read with")
+        g.P("// serialmeta.FromContext, and the caller it carries.")
+    } else {
+        g.P("// has one, and ctx with the metadata the envelope carries, read with")
+        g.P("// serialmeta.FromContext.")
+    }
+    g.P("func unwrapMetadata(ctx context.Context, input []byte) (context.Context, []byte, error) {")
+    g.P("    md, input, err := serialmeta.Unwrap(input)")
+    g.P("    if err != nil {")
+    g.P("        return ctx, nil, err")
+    g.P("    }")
+    if callers {
+        g.P("    return serialmeta.NewContext(callerContext(ctx, md), md), input, nil")
+    } else {
+        g.P("    return serialmeta.NewContext(ctx, md), input, nil")
+    }
+    g.P("}")
+    g.P()
+}
+
+// generateUnwrapOutput generates, in the handlers of service wrapping the
+// caller of their requests in the inputs, the unwrapping of the serialmeta
+// envelope of the outputs of the calls, with metadata=true, the outputs of
+// the enveloped inputs being enveloped too. header, if any, is the
+// http.Header to which the metadata of the output is copied, and the
+// statement onErr, if any, runs before ret on failure.
+func (g *grpcserial) generateUnwrapOutput(service *pb.ServiceDescriptorProto, header, onErr, ret string) {
+    if !g.metadata || !g.wrapsCaller(service) {
+        return
+    }
+    if header != "" {
+        g.P("    md, output, err := serialmeta.Unwrap(output)")
+    } else {
+        g.P("    _, output, err = serialmeta.Unwrap(output)")
+    }
+    g.P("    if err != nil {")
+    if onErr != "" {
+        g.P("        " + onErr)
+    }
+    g.P("        " + ret)
+    g.P("    }")
+    if header != "" {
+        g.P("    for key, value := range md {")
+        g.P("        " + header + ".Set(key, value)")
+        g.P("    }")
+    }
+}
@@ -0,0 +1,52 @@
+package grpcserial
+
+import (
+    "fmt"
+    "strconv"
+)
+
+// generateMetrics generates callMetrics, the promrpc metrics of the calls of
+// the serialized functions, under the namespace of the
+// prometheus_namespace parameter.
+func (g *grpcserial) generateMetrics() {
+    g.P("// callMetrics records the calls of the serialized functions as Prometheus")
+    g.P("// metrics, registered with the default registerer.")
+    g.P(fmt.Sprintf("var callMetrics = promrpc.New(%s)", strconv.Quote(g.prometheusNamespace)))
+    g.P()
+}
+
+// generateObserve generates the deferred recording in callMetrics of the
+// call of method of the service named fullServName, given the expressions
+// of the size of its requests and responses.
+func (g *grpcserial) generateObserve(fullServName, method, requestSize, responseSize string) {
+    g.P(fmt.Sprintf("    defer func(start time.Time) { callMetrics.Observe(%q, %q, start, %s, %s, err) }(time.Now())", fullServName, method, requestSize, responseSize))
+}
+
+// generateLogging generates callLogger, the hook of the logger of the calls
+// of the serialized functions.
+func (g *grpcserial) generateLogging() {
+    g.P("// callLogger logs the entry and exit of the calls of the serialized functions.")
+    g.P("// Set it to substitute your logger for logrpc.Default(), used if nil.")
+    g.P("var callLogger logrpc.Logger")
+    g.P()
+}
+
+// generateLogExit generates the logging of the entry of the call of method
+// of the service named fullServName, and the deferred logging of its exit,
+// given the expressions of the size of its requests and responses. The
+// context of its span is logged with it, with tracing=true, or else the
+// context given by the interceptors, with interceptors=true.
+func (g *grpcserial) generateLogExit(fullServName, method, requestSize, responseSize string) {
+    ctx := g.parentCtx()
+    if g.tracing {
+        ctx = "ctx"
+    }
+    g.P(fmt.Sprintf("    logExit := logrpc.Start(%s, callLogger, %q, %q)", ctx, fullServName, method))
+    g.P(fmt.Sprintf("    defer func() { logExit(%s, %s, err) }()", requestSize, responseSize))
+}
+
+// countsSizes reports whether the serialized functions count the size of
+// their requests and responses, for their spans, metrics or logs.
+func (g *grpcserial) countsSizes() bool {
+    return g.tracing || g.prometheus || g.logging
+}
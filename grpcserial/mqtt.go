@@ -0,0 +1,51 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// generateMQTT generates the MQTT bindings of service: Subscribe<Service>MQTT,
+// serving its unary methods to the requests published on their topics, and
+// Publish<Service>MQTTResponse, publishing the responses of the calls.
+func (g *grpcserial) generateMQTT(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    methods := unaryMethods(service)
+    publish := "Publish" + servName + "MQTTResponse"
+    example := fullServName + "/Method"
+    if len(methods) > 0 {
+        example = fullServName + "/" + methods[0].GetName()
+    }
+
+    g.P(fmt.Sprintf("// Subscribe%sMQTT serves the %s methods over MQTT: it subscribes c to", servName, servName))
+    g.P(fmt.Sprintf("// the request topic of every method under root, e.g. root/%s, and", example))
+    g.P("// calls the method with the payload of every request, publishing its output")
+    g.P(fmt.Sprintf("// on the response topic of the method, root/%s/response, or its", example))
+    g.P(fmt.Sprintf("// error message on its error topic, root/%s/error, with", example))
+    g.P(fmt.Sprintf("// %s.", publish))
+    g.P(fmt.Sprintf("func Subscribe%sMQTT(c mqttrpc.Client, root string) error {", servName))
+    for _, method := range methods {
+        g.P(fmt.Sprintf("    if err := c.Subscribe(mqttrpc.Topic(root, \"%s/%s\"), func(input []byte) error {", fullServName, method.GetName()))
+        g.P(fmt.Sprintf("        output, err := %s(input)", generator.CamelCase(method.GetName())))
+        g.P(fmt.Sprintf("        return %s(c, root, \"%s\", output, err)", publish, method.GetName()))
+        g.P("    }); err != nil {")
+        g.P("        return err")
+        g.P("    }")
+    }
+    g.P("    return nil")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s publishes the response of a call of the %s method", publish, servName))
+    g.P("// named method, e.g. by the implementations serving the requests")
+    g.P("// themselves: output on its response topic under root, or the message of")
+    g.P("// err on its error topic if err is not nil.")
+    g.P(fmt.Sprintf("func %s(c mqttrpc.Client, root, method string, output []byte, err error) error {", publish))
+    g.P(fmt.Sprintf("    topic := mqttrpc.Topic(root, \"%s/\"+method)", fullServName))
+    g.P("    if err != nil {")
+    g.P("        return c.Publish(topic+mqttrpc.ErrorSuffix, []byte(err.Error()))")
+    g.P("    }")
+    g.P("    return c.Publish(topic+mqttrpc.ResponseSuffix, output)")
+    g.P("}")
+    g.P()
+}
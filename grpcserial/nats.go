@@ -0,0 +1,124 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// natsErrorHeader is the header of the NATS replies carrying the error
+// message of a call, as the NATS services do.
+const natsErrorHeader = "Nats-Service-Error"
+
+// generateImpl generates <Service>Impl, the interface of the unary methods
+// of service on serialized messages, which the transports serve, and
+// <Service>Funcs implementing it with the functions of the serialized API.
+func (g *grpcserial) generateImpl(service *pb.ServiceDescriptorProto, servName string) {
+    methods := unaryMethods(service)
+    g.P(fmt.Sprintf("// %sImpl implements the unary %s methods on serialized messages, as", servName, servName))
+    g.P(fmt.Sprintf("// the functions of the serialized API do. %sFuncs{} calls them, and the", servName))
+    g.P("// clients of the transports implement it too, e.g. to proxy the calls.")
+    g.P(fmt.Sprintf("type %sImpl interface {", servName))
+    for _, method := range methods {
+        g.P(fmt.Sprintf("    %s(input []byte) (output []byte, err error)", generator.CamelCase(method.GetName())))
+    }
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %sFuncs is the %sImpl calling the functions of the serialized API.", servName, servName))
+    g.P(fmt.Sprintf("type %sFuncs struct{}", servName))
+    g.P()
+    for _, method := range methods {
+        methName := generator.CamelCase(method.GetName())
+        g.P(fmt.Sprintf("// %s calls %s.", methName, methName))
+        g.P(fmt.Sprintf("func (%sFuncs) %s(input []byte) ([]byte, error) { return %s(input) }", servName, methName, methName))
+        g.P()
+    }
+}
+
+// generateNATS generates the NATS request/reply transport of service:
+// Serve<Service>NATS, serving a <Service>Impl to the requests of the
+// subjects of its methods, and <Service>NATSClient, calling them.
+func (g *grpcserial) generateNATS(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    methods := unaryMethods(service)
+    clientName := servName + "NATSClient"
+    example := fullServName + ".Method"
+    if len(methods) > 0 {
+        example = fullServName + "." + methods[0].GetName()
+    }
+
+    g.P(fmt.Sprintf("// Serve%sNATS serves impl over NATS: it subscribes nc to the subject of", servName))
+    g.P(fmt.Sprintf("// every unary %s method, its full name, e.g. %s, in the queue group", servName, example))
+    g.P(fmt.Sprintf("// %s, so that the requests are balanced between the servers, and", fullServName))
+    g.P("// replies to every request with the output of the call or, in the")
+    g.P(fmt.Sprintf("// %s header, its error message. It returns the subscriptions, to", natsErrorHeader))
+    g.P("// unsubscribe from when the server stops.")
+    g.P(fmt.Sprintf("func Serve%sNATS(nc *nats.Conn, impl %sImpl) ([]*nats.Subscription, error) {", servName, servName))
+    g.P("    methods := []struct {")
+    g.P("        subject string")
+    g.P("        call    func(input []byte) ([]byte, error)")
+    g.P("    }{")
+    for _, method := range methods {
+        g.P(fmt.Sprintf("        {\"%s.%s\", impl.%s},", fullServName, method.GetName(), generator.CamelCase(method.GetName())))
+    }
+    g.P("    }")
+    g.P("    var subs []*nats.Subscription")
+    g.P("    for _, m := range methods {")
+    g.P("        call := m.call")
+    g.P(fmt.Sprintf("        sub, err := nc.QueueSubscribe(m.subject, \"%s\", func(req *nats.Msg) {", fullServName))
+    g.P("            resp := nats.NewMsg(req.Reply)")
+    g.P("            output, err := call(req.Data)")
+    g.P("            if err != nil {")
+    g.P(fmt.Sprintf("                resp.Header.Set(\"%s\", err.Error())", natsErrorHeader))
+    g.P("            } else {")
+    g.P("                resp.Data = output")
+    g.P("            }")
+    g.P("            req.RespondMsg(resp)")
+    g.P("        })")
+    g.P("        if err != nil {")
+    g.P("            for _, sub := range subs {")
+    g.P("                sub.Unsubscribe()")
+    g.P("            }")
+    g.P("            return nil, err")
+    g.P("        }")
+    g.P("        subs = append(subs, sub)")
+    g.P("    }")
+    g.P("    return subs, nil")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s calls the %s methods served over NATS, e.g. by", clientName, servName))
+    g.P(fmt.Sprintf("// Serve%sNATS, with requests to their subjects. It is a %sImpl.", servName, servName))
+    g.P(fmt.Sprintf("type %s struct {", clientName))
+    g.P("    nc      *nats.Conn")
+    g.P("    timeout time.Duration")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// New%s returns a client calling the methods over nc, failing the", clientName))
+    g.P("// calls not replied to within timeout.")
+    g.P(fmt.Sprintf("func New%s(nc *nats.Conn, timeout time.Duration) *%s {", clientName, clientName))
+    g.P(fmt.Sprintf("    return &%s{nc: nc, timeout: timeout}", clientName))
+    g.P("}")
+    g.P()
+    for _, method := range methods {
+        methName := generator.CamelCase(method.GetName())
+        g.P(fmt.Sprintf("// %s calls %s with the serialized input, of type %s, and returns", methName, methName, g.typeName(method.GetInputType())))
+        g.P(fmt.Sprintf("// its serialized output, of type %s.", g.typeName(method.GetOutputType())))
+        g.P(fmt.Sprintf("func (c *%s) %s(input []byte) ([]byte, error) {", clientName, methName))
+        g.P(fmt.Sprintf("    return c.call(\"%s.%s\", input)", fullServName, method.GetName()))
+        g.P("}")
+        g.P()
+    }
+    g.P("// call sends the request of the method of the given subject and returns")
+    g.P("// the output of its reply, or the error message it carries.")
+    g.P(fmt.Sprintf("func (c *%s) call(subject string, input []byte) ([]byte, error) {", clientName))
+    g.P("    resp, err := c.nc.Request(subject, input, c.timeout)")
+    g.P("    if err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P(fmt.Sprintf("    if msg := resp.Header.Get(\"%s\"); msg != \"\" {", natsErrorHeader))
+    g.P("        return nil, errors.New(msg)")
+    g.P("    }")
+    g.P("    return resp.Data, nil")
+    g.P("}")
+    g.P()
+}
@@ -0,0 +1,211 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// parallelFields returns the repeated message fields of the message named typ
+// whose elements are decoded concurrently when parallel_decode is enabled.
+// Map fields are left to proto.Unmarshal.
+func (g *grpcserial) parallelFields(typ string) []*pb.FieldDescriptorProto {
+    if !g.parallelDecode {
+        return nil
+    }
+    desc, ok := g.gen.ObjectNamed(typ).(*generator.Descriptor)
+    if !ok {
+        return nil
+    }
+    var fields []*pb.FieldDescriptorProto
+    for _, field := range desc.Field {
+        if field.GetLabel() != pb.FieldDescriptorProto_LABEL_REPEATED || field.GetType() != pb.FieldDescriptorProto_TYPE_MESSAGE {
+            continue
+        }
+        if elem, ok := g.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor); ok && elem.GetOptions().GetMapEntry() {
+            continue
+        }
+        fields = append(fields, field)
+    }
+    return fields
+}
+
+// generateParallelDecode generates the parallel decoding helpers, and an
+// unmarshal function for every input message of service having repeated
+// message fields.
+func (g *grpcserial) generateParallelDecode(service *pb.ServiceDescriptorProto) {
+    seen := make(map[string]bool)
+    for _, method := range service.Method {
+        typ := method.GetInputType()
+        fields := g.parallelFields(typ)
+        if len(fields) == 0 || seen[typ] {
+            continue
+        }
+        if len(seen) == 0 {
+            g.generateParallelHelpers()
+        }
+        seen[typ] = true
+
+        typeName := g.typeName(typ)
+        nums := ""
+        for i, field := range fields {
+            if i > 0 {
+                nums += ", "
+            }
+            nums += fmt.Sprint(field.GetNumber())
+        }
+        g.P(fmt.Sprintf("// unmarshal%s decodes input into m, decoding the elements of its", typeName))
+        g.P("// repeated message fields in parallel above parallelDecodeThreshold.")
+        g.P(fmt.Sprintf("func unmarshal%s(input []byte, m *pb.%s) error {", typeName, typeName))
+        g.P(fmt.Sprintf("    rest, elems, err := splitRepeated(input, %s)", nums))
+        g.P("    if err != nil {")
+        g.P("        return err")
+        g.P("    }")
+        g.P("    if err := proto.Unmarshal(rest, m); err != nil {")
+        g.P("        return err")
+        g.P("    }")
+        for _, field := range fields {
+            fieldName := generator.CamelCase(field.GetName())
+            elemTypeName := g.typeName(field.GetTypeName())
+            g.P(fmt.Sprintf("    m.%s = make([]*pb.%s, len(elems[%d]))", fieldName, elemTypeName, field.GetNumber()))
+            g.P(fmt.Sprintf("    err = decodeParallel(elems[%d], func(i int, b []byte) error {", field.GetNumber()))
+            g.P(fmt.Sprintf("        m.%s[i] = new(pb.%s)", fieldName, elemTypeName))
+            g.P(fmt.Sprintf("        return proto.Unmarshal(b, m.%s[i])", fieldName))
+            g.P("    })")
+            g.P("    if err != nil {")
+            g.P("        return err")
+            g.P("    }")
+        }
+        g.P("    return nil")
+        g.P("}")
+        g.P()
+    }
+}
+
+// generateParallelHelpers generates splitRepeated and decodeParallel, shared
+// by the unmarshal functions of the example implementation.
+func (g *grpcserial) generateParallelHelpers() {
+    g.P("// parallelDecodeThreshold is the number of elements of a repeated field")
+    g.P("// above which they are decoded by a pool of workers.")
+    g.P(fmt.Sprintf("const parallelDecodeThreshold = %d", g.parallelThreshold))
+    g.P()
+    g.P("// splitRepeated scans the top-level fields of a serialized message and")
+    g.P("// extracts the encoded elements of the length-delimited fields numbered nums.")
+    g.P("// rest holds the remaining fields, still serialized.")
+    g.P("func splitRepeated(input []byte, nums ...int32) (rest []byte, elems map[int32][][]byte, err error) {")
+    g.P("    elems = make(map[int32][][]byte, len(nums))")
+    g.P("    for _, num := range nums {")
+    g.P("        elems[num] = nil")
+    g.P("    }")
+    if g.runtimeV2 {
+        g.generateSplitRepeatedV2()
+    } else {
+        g.generateSplitRepeatedV1()
+    }
+    g.P("    return rest, elems, nil")
+    g.P("}")
+    g.P()
+    g.P("// decodeParallel calls decode for every element, spreading them in")
+    g.P("// contiguous chunks over one worker per CPU when there are more than")
+    g.P("// parallelDecodeThreshold of them. It returns the first error met.")
+    g.P("func decodeParallel(elems [][]byte, decode func(i int, b []byte) error) error {")
+    g.P("    if len(elems) <= parallelDecodeThreshold {")
+    g.P("        for i, b := range elems {")
+    g.P("            if err := decode(i, b); err != nil {")
+    g.P("                return err")
+    g.P("            }")
+    g.P("        }")
+    g.P("        return nil")
+    g.P("    }")
+    g.P("    workers := runtime.NumCPU()")
+    g.P("    chunk := (len(elems) + workers - 1) / workers")
+    g.P("    errs := make([]error, workers)")
+    g.P("    var wg sync.WaitGroup")
+    g.P("    for w := 0; w*chunk < len(elems); w++ {")
+    g.P("        lo, hi := w*chunk, (w+1)*chunk")
+    g.P("        if hi > len(elems) {")
+    g.P("            hi = len(elems)")
+    g.P("        }")
+    g.P("        wg.Add(1)")
+    g.P("        go func(w, lo, hi int) {")
+    g.P("            defer wg.Done()")
+    g.P("            for i := lo; i < hi; i++ {")
+    g.P("                if errs[w] = decode(i, elems[i]); errs[w] != nil {")
+    g.P("                    return")
+    g.P("                }")
+    g.P("            }")
+    g.P("        }(w, lo, hi)")
+    g.P("    }")
+    g.P("    wg.Wait()")
+    g.P("    for _, err := range errs {")
+    g.P("        if err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.P("    }")
+    g.P("    return nil")
+    g.P("}")
+    g.P()
+}
+
+// generateSplitRepeatedV1 generates the scanning loop of splitRepeated,
+// decoding the wire format with the github.com/golang/protobuf/proto helpers.
+func (g *grpcserial) generateSplitRepeatedV1() {
+    g.P("    for off := 0; off < len(input); {")
+    g.P("        start := off")
+    g.P("        key, n := proto.DecodeVarint(input[off:])")
+    g.P("        if n == 0 {")
+    g.P("            return nil, nil, io.ErrUnexpectedEOF")
+    g.P("        }")
+    g.P("        off += n")
+    g.P("        switch key & 7 {")
+    g.P("        case proto.WireVarint:")
+    g.P("            if _, n = proto.DecodeVarint(input[off:]); n == 0 {")
+    g.P("                return nil, nil, io.ErrUnexpectedEOF")
+    g.P("            }")
+    g.P("            off += n")
+    g.P("        case proto.WireFixed64:")
+    g.P("            off += 8")
+    g.P("        case proto.WireFixed32:")
+    g.P("            off += 4")
+    g.P("        case proto.WireBytes:")
+    g.P("            l, n := proto.DecodeVarint(input[off:])")
+    g.P("            if n == 0 || l > uint64(len(input)-off-n) {")
+    g.P("                return nil, nil, io.ErrUnexpectedEOF")
+    g.P("            }")
+    g.P("            off += n + int(l)")
+    g.P("            if _, ok := elems[int32(key>>3)]; ok {")
+    g.P("                elems[int32(key>>3)] = append(elems[int32(key>>3)], input[off-int(l):off])")
+    g.P("                continue")
+    g.P("            }")
+    g.P("        default:")
+    g.P("            return nil, nil, errors.New(\"splitRepeated: unsupported wire type\")")
+    g.P("        }")
+    g.P("        if off > len(input) {")
+    g.P("            return nil, nil, io.ErrUnexpectedEOF")
+    g.P("        }")
+    g.P("        rest = append(rest, input[start:off]...)")
+    g.P("    }")
+}
+
+// generateSplitRepeatedV2 generates the scanning loop of splitRepeated
+// with the google.golang.org/protobuf/encoding/protowire package.
+func (g *grpcserial) generateSplitRepeatedV2() {
+    g.P("    for len(input) > 0 {")
+    g.P("        num, typ, n := protowire.ConsumeTag(input)")
+    g.P("        if n < 0 {")
+    g.P("            return nil, nil, protowire.ParseError(n)")
+    g.P("        }")
+    g.P("        m := protowire.ConsumeFieldValue(num, typ, input[n:])")
+    g.P("        if m < 0 {")
+    g.P("            return nil, nil, protowire.ParseError(m)")
+    g.P("        }")
+    g.P("        if _, ok := elems[int32(num)]; ok && typ == protowire.BytesType {")
+    g.P("            b, _ := protowire.ConsumeBytes(input[n:])")
+    g.P("            elems[int32(num)] = append(elems[int32(num)], b)")
+    g.P("        } else {")
+    g.P("            rest = append(rest, input[:n+m]...)")
+    g.P("        }")
+    g.P("        input = input[n+m:]")
+    g.P("    }")
+}
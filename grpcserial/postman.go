@@ -0,0 +1,129 @@
+package grpcserial
+
+import (
+    "encoding/json"
+    "fmt"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// The types below are the subset of the Postman collection v2.1 format
+// used by the generated collections, which Insomnia imports as well.
+type postmanCollection struct {
+    Info     postmanInfo       `json:"info"`
+    Item     []postmanFolder   `json:"item"`
+    Auth     postmanAuth       `json:"auth"`
+    Variable []postmanVariable `json:"variable"`
+}
+
+type postmanInfo struct {
+    Name        string `json:"name"`
+    Description string `json:"description,omitempty"`
+    Schema      string `json:"schema"`
+}
+
+type postmanFolder struct {
+    Name        string        `json:"name"`
+    Description string        `json:"description,omitempty"`
+    Item        []postmanItem `json:"item"`
+}
+
+type postmanItem struct {
+    Name    string         `json:"name"`
+    Request postmanRequest `json:"request"`
+}
+
+type postmanRequest struct {
+    Method      string            `json:"method"`
+    Description string            `json:"description,omitempty"`
+    Header      []postmanVariable `json:"header"`
+    Body        postmanBody       `json:"body"`
+    URL         postmanURL        `json:"url"`
+}
+
+type postmanBody struct {
+    Mode    string `json:"mode"`
+    Raw     string `json:"raw"`
+    Options struct {
+        Raw struct {
+            Language string `json:"language"`
+        } `json:"raw"`
+    } `json:"options"`
+}
+
+type postmanURL struct {
+    Raw  string   `json:"raw"`
+    Host []string `json:"host"`
+    Path []string `json:"path"`
+}
+
+type postmanAuth struct {
+    Type   string            `json:"type"`
+    Bearer []postmanVariable `json:"bearer"`
+}
+
+type postmanVariable struct {
+    Key   string `json:"key"`
+    Value string `json:"value"`
+    Type  string `json:"type,omitempty"`
+}
+
+// generatePostman returns a Postman collection with a request per method of
+// the services of file, as served by the http.Handler of the example
+// implementations, with an example JSON body. The server URL and the bearer
+// token sent are the host and token variables of the collection.
+func (g *grpcserial) generatePostman(file *generator.FileDescriptor) string {
+    c := postmanCollection{
+        Info: postmanInfo{
+            Name:        file.GetName(),
+            Description: "Serialized API of " + file.GetName() + ", generated by protoc-gen-go.",
+            Schema:      postmanSchema,
+        },
+        Auth: postmanAuth{
+            Type:   "bearer",
+            Bearer: []postmanVariable{{Key: "token", Value: "{{token}}", Type: "string"}},
+        },
+        Variable: []postmanVariable{
+            {Key: "host", Value: "http://localhost:8080"},
+            {Key: "token", Value: ""},
+        },
+    }
+    for i, service := range file.FileDescriptorProto.Service {
+        fullServName := service.GetName()
+        if pkg := file.GetPackage(); pkg != "" {
+            fullServName = pkg + "." + fullServName
+        }
+        folder := postmanFolder{
+            Name:        fullServName,
+            Description: descutil.LeadingComments(file.FileDescriptorProto, fmt.Sprintf("6,%d", i)),
+        }
+        for j, method := range service.Method {
+            if method.GetServerStreaming() {
+                continue
+            }
+            item := postmanItem{Name: method.GetName()}
+            req := &item.Request
+            req.Method = "POST"
+            req.Description = descutil.LeadingComments(file.FileDescriptorProto, fmt.Sprintf("6,%d,2,%d", i, j))
+            req.Header = []postmanVariable{{Key: "Content-Type", Value: "application/json"}}
+            req.Body.Mode = "raw"
+            req.Body.Raw = g.exampleJSON(method.GetInputType())
+            req.Body.Options.Raw.Language = "json"
+            req.URL = postmanURL{
+                Raw:  "{{host}}/" + fullServName + "/" + method.GetName(),
+                Host: []string{"{{host}}"},
+                Path: []string{fullServName, method.GetName()},
+            }
+            folder.Item = append(folder.Item, item)
+        }
+        c.Item = append(c.Item, folder)
+    }
+    b, err := json.MarshalIndent(c, "", "  ")
+    if err != nil {
+        g.gen.Error(err, "failed to encode the Postman collection")
+    }
+    return string(b) + "\n"
+}
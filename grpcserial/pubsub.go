@@ -0,0 +1,78 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// generatePubSub generates the Google Cloud Pub/Sub bindings of service:
+// <Service>PubSubPush, the http.Handler of the push subscriptions of its
+// unary methods, and Receive<Service>PubSub, the loop of their pull
+// subscriptions.
+func (g *grpcserial) generatePubSub(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    methods := unaryMethods(service)
+    pushName := servName + "PubSubPush"
+    example := "Method"
+    if len(methods) > 0 {
+        example = methods[0].GetName()
+    }
+
+    g.P("// pubSubMethods are the unary methods called with the data of the Pub/Sub")
+    g.P("// messages, by name.")
+    g.P("var pubSubMethods = map[string]func(input []byte) (output []byte, err error){")
+    for _, method := range methods {
+        g.P(fmt.Sprintf("    \"%s\": %s,", method.GetName(), generator.CamelCase(method.GetName())))
+    }
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s is the push endpoint of the Pub/Sub subscriptions of the", pushName))
+    g.P(fmt.Sprintf("// %s methods. It accepts the POST requests of the push subscriptions to", servName))
+    g.P(fmt.Sprintf("// /%s/<method>, e.g. /%s/%s, and calls the method with the", fullServName, fullServName, example))
+    g.P("// data of the message of their envelope, its serialized input, discarding")
+    g.P("// its output. The messages are acknowledged once handled, and the others,")
+    g.P("// whose call failed, delivered again.")
+    g.P(fmt.Sprintf("type %s struct{}", pushName))
+    g.P()
+    g.P(fmt.Sprintf("func (%s) ServeHTTP(w http.ResponseWriter, r *http.Request) {", pushName))
+    g.P("    if r.Method != \"POST\" {")
+    g.P("        w.Header().Set(\"Allow\", \"POST\")")
+    g.P("        http.Error(w, \"method not allowed\", http.StatusMethodNotAllowed)")
+    g.P("        return")
+    g.P("    }")
+    g.P(fmt.Sprintf("    call, ok := pubSubMethods[strings.TrimPrefix(r.URL.Path, \"/%s/\")]", fullServName))
+    g.P(fmt.Sprintf("    if !ok || !strings.HasPrefix(r.URL.Path, \"/%s/\") {", fullServName))
+    g.P("        http.NotFound(w, r)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    m, _, err := pubsubrpc.DecodePush(r.Body)")
+    g.P("    if err != nil {")
+    g.P("        http.Error(w, err.Error(), http.StatusBadRequest)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    if _, err := call(m.Data); err != nil {")
+    g.P("        // Not acknowledged: the message is delivered again.")
+    g.P("        http.Error(w, err.Error(), http.StatusInternalServerError)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    w.WriteHeader(http.StatusNoContent)")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// Receive%sPubSub calls the named %s method, e.g. \"%s\", with the", servName, servName, example))
+    g.P("// data of every message of the pull subscription sub, its serialized input,")
+    g.P("// discarding its output, until ctx is done or sub fails. The messages are")
+    g.P("// acknowledged once handled, and the others, whose call failed, delivered")
+    g.P("// again.")
+    g.P(fmt.Sprintf("func Receive%sPubSub(ctx context.Context, sub pubsubrpc.Subscriber, method string) error {", servName))
+    g.P("    call, ok := pubSubMethods[method]")
+    g.P("    if !ok {")
+    g.P(fmt.Sprintf("        return fmt.Errorf(\"unknown %s method %%q\", method)", fullServName))
+    g.P("    }")
+    g.P("    return sub.Receive(ctx, func(_ context.Context, m *pubsubrpc.Message) error {")
+    g.P("        _, err := call(m.Data)")
+    g.P("        return err")
+    g.P("    })")
+    g.P("}")
+    g.P()
+}
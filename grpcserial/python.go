@@ -0,0 +1,110 @@
+package grpcserial
+
+import (
+    "bytes"
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// generatePython returns a Python module wrapping the serialized API of the
+// services of file: one class per service, whose methods take and return
+// the message classes generated by protoc --python_out, the methods of the
+// server-streaming RPCs passing each response to a callback instead. The
+// bidirectional streaming RPCs, exchanging Go channels, are not wrapped.
+func (g *grpcserial) generatePython(file *generator.FileDescriptor) string {
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "# Code generated by protoc-gen-go. DO NOT EDIT.\n")
+    fmt.Fprintf(&b, "# source: %s\n\n", file.GetName())
+    fmt.Fprintf(&b, "\"\"\"Python wrappers over the serialized API of %s.\"\"\"\n\n", file.GetName())
+
+    modules := make(map[string]bool)
+    for _, service := range file.Service {
+        for _, method := range service.Method {
+            modules[pythonModule(g.gen.ObjectNamed(method.GetInputType()).File().GetName())] = true
+            modules[pythonModule(g.gen.ObjectNamed(method.GetOutputType()).File().GetName())] = true
+        }
+    }
+    var sorted []string
+    for module := range modules {
+        sorted = append(sorted, module)
+    }
+    sort.Strings(sorted)
+    for _, module := range sorted {
+        fmt.Fprintf(&b, "import %s as %s\n", module, pythonAlias(module))
+    }
+
+    for i, service := range file.Service {
+        servName := generator.CamelCase(service.GetName())
+        fmt.Fprintf(&b, "\n\nclass %s(object):\n", servName)
+        fmt.Fprintf(&b, "    \"\"\"%s wraps the serialized API of the %s service.\n\n", servName, service.GetName())
+        fmt.Fprintf(&b, "    backend is the module exposing the serialized functions,\n")
+        fmt.Fprintf(&b, "    e.g. the bindings generated by goprotopy.\n")
+        fmt.Fprintf(&b, "    \"\"\"\n\n")
+        fmt.Fprintf(&b, "    def __init__(self, backend):\n")
+        fmt.Fprintf(&b, "        self._backend = backend\n")
+        for j, method := range service.Method {
+            if isBidi(method) {
+                continue
+            }
+            methodName := generator.CamelCase(method.GetName())
+            input, output := g.pythonClass(method.GetInputType()), g.pythonClass(method.GetOutputType())
+            stream := emitsStream(method)
+            if stream {
+                fmt.Fprintf(&b, "\n    def %s(self, request, emit):\n", methodName)
+            } else {
+                fmt.Fprintf(&b, "\n    def %s(self, request):\n", methodName)
+            }
+            fmt.Fprintf(&b, "        \"\"\"")
+            if c := descutil.LeadingComments(file.FileDescriptorProto, fmt.Sprintf("6,%d,2,%d", i, j)); c != "" {
+                for k, line := range strings.Split(strings.Replace(c, `"""`, `\"\"\"`, -1), "\n") {
+                    if k > 0 && line != "" {
+                        b.WriteString("        ")
+                    }
+                    b.WriteString(line + "\n")
+                }
+                b.WriteString("\n        ")
+            }
+            if stream {
+                fmt.Fprintf(&b, "request is a %s, emit is called with every %s\n", input, output)
+                fmt.Fprintf(&b, "        response.\n")
+                fmt.Fprintf(&b, "        \"\"\"\n")
+                fmt.Fprintf(&b, "        def _emit(output):\n")
+                fmt.Fprintf(&b, "            response = %s()\n", output)
+                fmt.Fprintf(&b, "            response.ParseFromString(output)\n")
+                fmt.Fprintf(&b, "            emit(response)\n")
+                fmt.Fprintf(&b, "        self._backend.%s(request.SerializeToString(), _emit)\n", methodName)
+                continue
+            }
+            fmt.Fprintf(&b, "request is a %s, the result a %s.\n", input, output)
+            fmt.Fprintf(&b, "        \"\"\"\n")
+            fmt.Fprintf(&b, "        response = %s()\n", output)
+            fmt.Fprintf(&b, "        response.ParseFromString(self._backend.%s(request.SerializeToString()))\n", methodName)
+            fmt.Fprintf(&b, "        return response\n")
+        }
+    }
+    return b.String()
+}
+
+// pythonClass returns the Python class of the message named typ, qualified
+// by the alias of its module.
+func (g *grpcserial) pythonClass(typ string) string {
+    obj := g.gen.ObjectNamed(typ)
+    return pythonAlias(pythonModule(obj.File().GetName())) + "." + strings.Join(obj.TypeName(), ".")
+}
+
+// pythonModule returns the Python module generated by protoc for the .proto
+// file named name, e.g. "foo.bar_pb2" for "foo/bar.proto".
+func pythonModule(name string) string {
+    name = strings.TrimSuffix(name, ".proto")
+    return strings.Replace(strings.Replace(name, "-", "_", -1), "/", ".", -1) + "_pb2"
+}
+
+// pythonAlias returns the name under which module is imported, following
+// protoc's own scheme, e.g. "foo_dot_bar__pb2" for "foo.bar_pb2".
+func pythonAlias(module string) string {
+    return strings.Replace(strings.Replace(module, "_", "__", -1), ".", "_dot_", -1)
+}
@@ -0,0 +1,147 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// asyncMethods returns the methods of service with the custom bool method
+// option async set, whose calls can be queued. Streaming methods can't be.
+func (g *grpcserial) asyncMethods(service *pb.ServiceDescriptorProto) []*pb.MethodDescriptorProto {
+    ext := descutil.Extension(g.gen, ".google.protobuf.MethodOptions", "async")
+    if ext == nil {
+        return nil
+    }
+    if ext.GetType() != pb.FieldDescriptorProto_TYPE_BOOL {
+        g.gen.Fail("the async option must be a bool")
+    }
+    var methods []*pb.MethodDescriptorProto
+    for _, method := range service.Method {
+        if v, ok := descutil.Options(method.Options).Varint(ext.GetNumber()); ok && v != 0 {
+            if method.GetServerStreaming() {
+                g.gen.Fail(fmt.Sprintf("invalid async option of %s: streaming methods can't be queued", method.GetName()))
+            }
+            methods = append(methods, method)
+        }
+    }
+    return methods
+}
+
+// priorityField returns the field of the input of method with the custom
+// bool field option priority set, giving the priority of its queued calls,
+// or nil if it has none. It must be a singular integer or enum field.
+func (g *grpcserial) priorityField(method *pb.MethodDescriptorProto) *pb.FieldDescriptorProto {
+    ext := descutil.Extension(g.gen, ".google.protobuf.FieldOptions", "priority")
+    msg, ok := g.gen.ObjectNamed(method.GetInputType()).(*generator.Descriptor)
+    if ext == nil || !ok {
+        return nil
+    }
+    var found *pb.FieldDescriptorProto
+    for _, field := range msg.Field {
+        if v, ok := descutil.Options(field.Options).Varint(ext.GetNumber()); !ok || v == 0 {
+            continue
+        }
+        name := method.GetInputType()[1:] + "." + field.GetName()
+        if found != nil {
+            g.gen.Fail(fmt.Sprintf("invalid priority option of %s: %s already gives the priority", name, found.GetName()))
+        }
+        switch field.GetType() {
+        case pb.FieldDescriptorProto_TYPE_STRING, pb.FieldDescriptorProto_TYPE_BYTES, pb.FieldDescriptorProto_TYPE_BOOL,
+            pb.FieldDescriptorProto_TYPE_FLOAT, pb.FieldDescriptorProto_TYPE_DOUBLE,
+            pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+            g.gen.Fail(fmt.Sprintf("invalid priority option of %s: want an integer or enum field", name))
+        }
+        if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+            g.gen.Fail(fmt.Sprintf("invalid priority option of %s: want a singular field", name))
+        }
+        found = field
+    }
+    return found
+}
+
+// generateQueue generates the queue bindings of the async methods of
+// service: the Queue interface of the priority queues of serialized calls,
+// an Enqueue<Method> function per async method, queuing a call with the
+// priority given by the priority field of its input, if any, and
+// Dequeue<Service> and Run<Service>Worker dispatching the dequeued calls
+// to the serialized functions.
+func (g *grpcserial) generateQueue(service *pb.ServiceDescriptorProto, servName, fullServName string) {
+    methods := g.asyncMethods(service)
+
+    g.P("// Queue is a priority queue of the serialized calls of async methods, backed")
+    g.P("// e.g. by a broker or a database. Its implementations must be safe for")
+    g.P("// concurrent use.")
+    g.P("type Queue interface {")
+    g.P("    // Enqueue adds the call of the method of the given full name with the")
+    g.P("    // serialized input payload, at priority: the higher, the sooner dequeued.")
+    g.P("    Enqueue(ctx context.Context, method string, payload []byte, priority int64) error")
+    g.P("    // Dequeue removes the call of highest priority from the queue, blocking")
+    g.P("    // until there is one or ctx is done.")
+    g.P("    Dequeue(ctx context.Context) (method string, payload []byte, err error)")
+    g.P("}")
+    g.P()
+    for _, method := range methods {
+        methName := generator.CamelCase(method.GetName())
+        inputTypeName := g.typeName(method.GetInputType())
+        field := g.priorityField(method)
+        if field == nil {
+            g.P(fmt.Sprintf("// Enqueue%s queues a call of %s with the serialized input, of type", methName, methName))
+            g.P(fmt.Sprintf("// %s, at priority 0.", inputTypeName))
+            g.P(fmt.Sprintf("func Enqueue%s(ctx context.Context, q Queue, input []byte) error {", methName))
+            g.P(fmt.Sprintf("    return q.Enqueue(ctx, %q, input, 0)", fullServName+"."+method.GetName()))
+            g.P("}")
+            g.P()
+            continue
+        }
+        g.P(fmt.Sprintf("// Enqueue%s queues a call of %s with the serialized input, of type", methName, methName))
+        g.P(fmt.Sprintf("// %s, at the priority given by its %s field.", inputTypeName, field.GetName()))
+        g.P(fmt.Sprintf("func Enqueue%s(ctx context.Context, q Queue, input []byte) error {", methName))
+        g.P(fmt.Sprintf("    in := new(pb.%s)", inputTypeName))
+        g.P("    if err := proto.Unmarshal(input, in); err != nil {")
+        g.P("        return err")
+        g.P("    }")
+        g.P(fmt.Sprintf("    return q.Enqueue(ctx, %q, input, int64(in.Get%s()))", fullServName+"."+method.GetName(), generator.CamelCase(field.GetName())))
+        g.P("}")
+        g.P()
+    }
+    g.P(fmt.Sprintf("// Dequeue%s dequeues the call of highest priority from q and dispatches", servName))
+    g.P(fmt.Sprintf("// it to the serialized function of its method, an async method of %s,", servName))
+    g.P("// returning the name of the method and its serialized output.")
+    g.P(fmt.Sprintf("func Dequeue%s(ctx context.Context, q Queue) (method string, output []byte, err error) {", servName))
+    g.P("    method, input, err := q.Dequeue(ctx)")
+    g.P("    if err != nil {")
+    g.P("        return \"\", nil, err")
+    g.P("    }")
+    g.P("    switch method {")
+    for _, method := range methods {
+        g.P(fmt.Sprintf("    case %q:", fullServName+"."+method.GetName()))
+        g.P(fmt.Sprintf("        output, err = %s(input)", generator.CamelCase(method.GetName())))
+    }
+    g.P("    default:")
+    g.P(fmt.Sprintf("        err = fmt.Errorf(\"%s: unknown async method %%q\", method)", fullServName))
+    g.P("    }")
+    g.P("    return method, output, err")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// Run%sWorker dispatches the calls dequeued from q, one at a time, until", servName))
+    g.P("// ctx is done or q fails, reporting the output of each to done, if not nil.")
+    g.P("// Run several workers for the calls to be served concurrently.")
+    g.P(fmt.Sprintf("func Run%sWorker(ctx context.Context, q Queue, done func(method string, output []byte, err error)) error {", servName))
+    g.P("    for {")
+    g.P(fmt.Sprintf("        method, output, err := Dequeue%s(ctx, q)", servName))
+    g.P("        if method == \"\" {")
+    g.P("            if ctx.Err() != nil {")
+    g.P("                return ctx.Err()")
+    g.P("            }")
+    g.P("            return err")
+    g.P("        }")
+    g.P("        if done != nil {")
+    g.P("            done(method, output, err)")
+    g.P("        }")
+    g.P("    }")
+    g.P("}")
+    g.P()
+}
@@ -0,0 +1,60 @@
+package grpcserial
+
+import (
+    "fmt"
+
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// recoverParam interprets the recover parameter: recover=true recovers the
+// panics of the serialized functions into errors, and recover=status also
+// describes them as google.rpc.Status messages.
+func (g *grpcserial) recoverParam() (recover, status bool) {
+    if g.gen.Param["recover"] == "status" {
+        return true, true
+    }
+    return descutil.BoolParam(g.gen, "recover"), false
+}
+
+// generateRecover generates PanicError, the error of the calls of the
+// serialized functions which panicked, and recoverPanic, recovering their
+// panics into it, so that a panic of an implementation fails its call
+// rather than the host process, e.g. the Python interpreter loading the
+// gomobile bindings.
+func (g *grpcserial) generateRecover() {
+    g.P("// PanicError is the error of the calls of the serialized functions which")
+    g.P("// panicked: their panic is recovered, rather than crashing the process.")
+    g.P("type PanicError struct {")
+    g.P("    Method string      // the full method, e.g. \"pkg.Service/Method\"")
+    g.P("    Value  interface{} // the value passed to panic")
+    g.P("    Stack  []byte      // the stack of the goroutine which panicked")
+    g.P("}")
+    g.P()
+    g.P("func (e *PanicError) Error() string {")
+    g.P("    return fmt.Sprintf(\"panic in %s: %v\", e.Method, e.Value)")
+    g.P("}")
+    g.P()
+    if g.recoverStatus {
+        g.P("// Status returns e as a google.rpc.Status with the INTERNAL code, e.g. for")
+        g.P("// the gRPC servers calling the serialized functions to return it with")
+        g.P("// status.ErrorProto.")
+        g.P("func (e *PanicError) Status() *status.Status {")
+        g.P("    return &status.Status{Code: 13, Message: e.Error()}")
+        g.P("}")
+        g.P()
+    }
+    g.P("// recoverPanic, deferred by the serialized function of method, recovers its")
+    g.P("// panic, if any, and sets *err to a *PanicError describing it.")
+    g.P("func recoverPanic(method string, err *error) {")
+    g.P("    if r := recover(); r != nil {")
+    g.P("        *err = &PanicError{Method: method, Value: r, Stack: debug.Stack()}")
+    g.P("    }")
+    g.P("}")
+    g.P()
+}
+
+// generateRecoverPanic generates the deferred recovery of the panics of the
+// serialized function of method of the service named fullServName.
+func (g *grpcserial) generateRecoverPanic(fullServName, method string) {
+    g.P(fmt.Sprintf("    defer recoverPanic(%q, &err)", fullServName+"/"+method))
+}
@@ -0,0 +1,95 @@
+package grpcserial
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// generateSchemaRegistry generates the hooks and helpers of the Confluent
+// wire format of the serialized messages, as requested by
+// schema_registry=true: SchemaIDOf, looking up the schema IDs written in
+// the outputs, CheckSchemaID, checking the ones read from the inputs, and
+// the helpers stripping and prepending the headers.
+func (g *grpcserial) generateSchemaRegistry() {
+    g.P("// SchemaIDOf returns the ID, in the schema registry, of the schema of the")
+    g.P("// message of the given full name, written in the Confluent wire format")
+    g.P("// header of the outputs. It must be set before the calls, e.g. to a lookup")
+    g.P("// of a registry client caching the IDs.")
+    g.P("var SchemaIDOf func(fullName string) (int32, error)")
+    g.P()
+    g.P("// CheckSchemaID, if set, checks the schema ID of the header of an input,")
+    g.P("// of the message of the given full name, e.g. that its schema is")
+    g.P("// compatible, and the inputs it returns an error for are rejected.")
+    g.P("var CheckSchemaID func(schemaID int32, fullName string) error")
+    g.P()
+    g.P("// stripSchemaHeader returns the serialized message following the Confluent")
+    g.P("// wire format header of input, checking that the header is the one of the")
+    g.P("// message of the given full name, of the given indexes in its file.")
+    g.P("func stripSchemaHeader(input []byte, fullName string, indexes ...int) ([]byte, error) {")
+    g.P("    schemaID, got, payload, err := kafkacodec.ParseConfluent(input)")
+    g.P("    if err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P("    if fmt.Sprint(got) != fmt.Sprint(indexes) {")
+    g.P("        return nil, fmt.Errorf(\"input of schema %d has the message indexes %v, want %v for %s\", schemaID, got, indexes, fullName)")
+    g.P("    }")
+    g.P("    if CheckSchemaID != nil {")
+    g.P("        if err := CheckSchemaID(schemaID, fullName); err != nil {")
+    g.P("            return nil, err")
+    g.P("        }")
+    g.P("    }")
+    g.P("    return payload, nil")
+    g.P("}")
+    g.P()
+    g.P("// prependSchemaHeader returns output prefixed by the Confluent wire format")
+    g.P("// header of the message of the given full name, of the given indexes in")
+    g.P("// its file, with the ID of its schema returned by SchemaIDOf.")
+    g.P("func prependSchemaHeader(output []byte, fullName string, indexes ...int) ([]byte, error) {")
+    g.P("    if SchemaIDOf == nil {")
+    g.P("        return nil, errors.New(\"SchemaIDOf is not set\")")
+    g.P("    }")
+    g.P("    schemaID, err := SchemaIDOf(fullName)")
+    g.P("    if err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P("    return append(kafkacodec.AppendConfluentHeader(nil, schemaID, indexes), output...), nil")
+    g.P("}")
+    g.P()
+}
+
+// schemaArgs returns the arguments of stripSchemaHeader and
+// prependSchemaHeader for the message of fully-qualified name typ: its full
+// name and its indexes in its file.
+func (g *grpcserial) schemaArgs(typ string) string {
+    msg := g.gen.ObjectNamed(typ).(*generator.Descriptor)
+    args := []string{strconv.Quote(strings.TrimPrefix(typ, "."))}
+    path := strings.Split(descutil.MessagePath(msg), ",")
+    for i := 1; i < len(path); i += 2 {
+        args = append(args, path[i])
+    }
+    return strings.Join(args, ", ")
+}
+
+// generateStripSchemaHeader generates the stripping of the Confluent wire
+// format header of the input of a serialized function, of type inputType.
+func (g *grpcserial) generateStripSchemaHeader(inputType string) {
+    g.P(fmt.Sprintf("    if input, err = stripSchemaHeader(input, %s); err != nil {", g.schemaArgs(inputType)))
+    g.P("        return")
+    g.P("    }")
+}
+
+// generatePrependSchemaHeader generates the prefixing of the serialized
+// output of a send function, of type outputType, by its Confluent wire
+// format header, as requested by schema_registry=true.
+func (g *grpcserial) generatePrependSchemaHeader(outputType string) {
+    if !g.schemaRegistry {
+        return
+    }
+    g.P(fmt.Sprintf("        if output, err = prependSchemaHeader(output, %s); err != nil {", g.schemaArgs(outputType)))
+    g.P("            return err")
+    g.P("        }")
+}
@@ -0,0 +1,140 @@
+package grpcserial
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+    "unicode"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+)
+
+// rustKeywords are the Rust keywords, written as raw identifiers when they
+// name a wrapper function.
+var rustKeywords = map[string]bool{
+    "as": true, "async": true, "await": true, "break": true, "const": true, "continue": true,
+    "dyn": true, "else": true, "enum": true, "extern": true, "false": true, "fn": true,
+    "for": true, "if": true, "impl": true, "in": true, "let": true, "loop": true, "match": true,
+    "mod": true, "move": true, "mut": true, "pub": true, "ref": true, "return": true,
+    "static": true, "struct": true, "trait": true, "true": true, "type": true, "unsafe": true,
+    "use": true, "where": true, "while": true, "abstract": true, "become": true, "box": true,
+    "do": true, "final": true, "macro": true, "override": true, "priv": true, "try": true,
+    "typeof": true, "unsized": true, "virtual": true, "yield": true,
+}
+
+// generateRust returns a Rust module binding the functions exported with
+// cgo by the example implementations of the services of file, as declared
+// by the C header: their extern "C" declarations, and one struct per
+// service whose associated functions call them safely, taking the
+// serialized input as a slice and returning the serialized output, or the
+// error message, copied into a Vec before the C buffer is freed.
+func (g *grpcserial) generateRust(file *generator.FileDescriptor) string {
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "// Code generated by protoc-gen-go. DO NOT EDIT.\n")
+    fmt.Fprintf(&b, "// source: %s\n\n", file.GetName())
+    fmt.Fprintf(&b, "//! Rust bindings of the serialized API of %s, exported with cgo by a\n", file.GetName())
+    fmt.Fprintf(&b, "//! -buildmode=c-shared or c-archive build of the example implementations.\n")
+    fmt.Fprintf(&b, "//! The library is linked as usual, e.g. by a build script printing\n")
+    fmt.Fprintf(&b, "//! cargo:rustc-link-lib.\n\n")
+    fmt.Fprintf(&b, "use std::os::raw::{c_int, c_void};\n\n")
+
+    fmt.Fprintf(&b, "extern \"C\" {\n")
+    for _, service := range file.Service {
+        servName := generator.CamelCase(service.GetName())
+        for _, method := range unaryMethods(service) {
+            fmt.Fprintf(&b, "    fn %s_%s(input: *const u8, input_len: usize, output: *mut *mut u8, output_len: *mut usize) -> c_int;\n",
+                servName, generator.CamelCase(method.GetName()))
+        }
+        fmt.Fprintf(&b, "    fn %s_Free(p: *mut c_void);\n", servName)
+    }
+    fmt.Fprintf(&b, "}\n\n")
+
+    fmt.Fprintf(&b, "/// Error is the error of a call of the serialized API, carrying the\n")
+    fmt.Fprintf(&b, "/// message of the Go error.\n")
+    fmt.Fprintf(&b, "#[derive(Debug, Clone, PartialEq, Eq)]\n")
+    fmt.Fprintf(&b, "pub struct Error(pub String);\n\n")
+    fmt.Fprintf(&b, "impl std::fmt::Display for Error {\n")
+    fmt.Fprintf(&b, "    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {\n")
+    fmt.Fprintf(&b, "        f.write_str(&self.0)\n")
+    fmt.Fprintf(&b, "    }\n")
+    fmt.Fprintf(&b, "}\n\n")
+    fmt.Fprintf(&b, "impl std::error::Error for Error {}\n\n")
+    fmt.Fprintf(&b, "/// call calls the exported function f on input, returning its output, or\n")
+    fmt.Fprintf(&b, "/// its error, copied into memory owned by Rust, and releasing the C buffer\n")
+    fmt.Fprintf(&b, "/// with free.\n")
+    fmt.Fprintf(&b, "fn call(\n")
+    fmt.Fprintf(&b, "    f: unsafe extern \"C\" fn(*const u8, usize, *mut *mut u8, *mut usize) -> c_int,\n")
+    fmt.Fprintf(&b, "    free: unsafe extern \"C\" fn(*mut c_void),\n")
+    fmt.Fprintf(&b, "    input: &[u8],\n")
+    fmt.Fprintf(&b, ") -> Result<Vec<u8>, Error> {\n")
+    fmt.Fprintf(&b, "    let mut output: *mut u8 = std::ptr::null_mut();\n")
+    fmt.Fprintf(&b, "    let mut output_len: usize = 0;\n")
+    fmt.Fprintf(&b, "    // SAFETY: the function only reads input_len bytes of input, and stores in\n")
+    fmt.Fprintf(&b, "    // output a buffer of output_len bytes, allocated with malloc, which is\n")
+    fmt.Fprintf(&b, "    // copied and released with free exactly once.\n")
+    fmt.Fprintf(&b, "    let status = unsafe { f(input.as_ptr(), input.len(), &mut output, &mut output_len) };\n")
+    fmt.Fprintf(&b, "    let mut data = Vec::new();\n")
+    fmt.Fprintf(&b, "    if !output.is_null() {\n")
+    fmt.Fprintf(&b, "        unsafe {\n")
+    fmt.Fprintf(&b, "            data.extend_from_slice(std::slice::from_raw_parts(output, output_len));\n")
+    fmt.Fprintf(&b, "            free(output as *mut c_void);\n")
+    fmt.Fprintf(&b, "        }\n")
+    fmt.Fprintf(&b, "    }\n")
+    fmt.Fprintf(&b, "    if status != 0 {\n")
+    fmt.Fprintf(&b, "        return Err(Error(String::from_utf8_lossy(&data).into_owned()));\n")
+    fmt.Fprintf(&b, "    }\n")
+    fmt.Fprintf(&b, "    Ok(data)\n")
+    fmt.Fprintf(&b, "}\n")
+
+    for _, service := range file.Service {
+        methods := unaryMethods(service)
+        if len(methods) == 0 {
+            continue
+        }
+        servName := generator.CamelCase(service.GetName())
+        fmt.Fprintf(&b, "\n/// %s wraps the serialized API of the %s service.\n", servName, service.GetName())
+        fmt.Fprintf(&b, "pub struct %s;\n\n", servName)
+        fmt.Fprintf(&b, "impl %s {\n", servName)
+        for i, method := range methods {
+            if i > 0 {
+                b.WriteString("\n")
+            }
+            methodName := generator.CamelCase(method.GetName())
+            fmt.Fprintf(&b, "    /// %s calls %s_%s: input is a serialized protobuf object of type\n", methodName, servName, methodName)
+            fmt.Fprintf(&b, "    /// %s, and the output a serialized protobuf object of type %s.\n",
+                g.typeName(method.GetInputType()), g.typeName(method.GetOutputType()))
+            fmt.Fprintf(&b, "    pub fn %s(input: &[u8]) -> Result<Vec<u8>, Error> {\n", rustIdent(snakeCase(methodName)))
+            fmt.Fprintf(&b, "        call(%s_%s, %s_Free, input)\n", servName, methodName, servName)
+            fmt.Fprintf(&b, "    }\n")
+        }
+        fmt.Fprintf(&b, "}\n")
+    }
+    return b.String()
+}
+
+// snakeCase returns the CamelCase name s in snake_case, e.g. say_hello for
+// SayHello, keeping acronyms together, e.g. get_url for GetURL.
+func snakeCase(s string) string {
+    runes := []rune(s)
+    var b strings.Builder
+    for i, r := range runes {
+        if unicode.IsUpper(r) {
+            // A word starts at an upper case letter following a lower case
+            // one or preceding one, as in the acronyms.
+            if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+                b.WriteByte('_')
+            }
+            r = unicode.ToLower(r)
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+// rustIdent returns name as a Rust identifier, raw if it is a keyword.
+func rustIdent(name string) string {
+    if rustKeywords[name] {
+        return "r#" + name
+    }
+    return name
+}
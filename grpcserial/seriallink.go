@@ -0,0 +1,142 @@
+package grpcserial
+
+import (
+    "fmt"
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// linkMethod is a method served over a serial link, by its ID.
+type linkMethod struct {
+    id     uint16
+    method *pb.MethodDescriptorProto
+}
+
+// linkMethods returns the methods of service with a custom integer method
+// option method_id, their ID on a serial link, which must be unique within
+// the service and fit in 16 bits.
+func (g *grpcserial) linkMethods(service *pb.ServiceDescriptorProto) []linkMethod {
+    ext := descutil.Extension(g.gen, ".google.protobuf.MethodOptions", "method_id")
+    if ext == nil {
+        return nil
+    }
+    var methods []linkMethod
+    seen := make(map[uint16]string)
+    for _, method := range unaryMethods(service) {
+        values := descutil.OptionValues(g.gen, descutil.Options(method.Options), ext)
+        if len(values) == 0 {
+            continue
+        }
+        id, err := strconv.ParseUint(values[0], 10, 16)
+        if err != nil {
+            g.gen.Fail(fmt.Sprintf("invalid method_id option %s of %s: want an integer from 0 to 65535", values[0], method.GetName()))
+        }
+        if other, ok := seen[uint16(id)]; ok {
+            g.gen.Fail(fmt.Sprintf("invalid method_id option %s of %s: %s has the same ID", values[0], method.GetName(), other))
+        }
+        seen[uint16(id)] = method.GetName()
+        methods = append(methods, linkMethod{uint16(id), method})
+    }
+    return methods
+}
+
+// generateSerialLink generates the serial link transport of service:
+// Serve<Service>Link, serving the methods with an ID over a serial link, and
+// <Service>LinkClient, calling them, their requests and responses being
+// seriallink packets.
+func (g *grpcserial) generateSerialLink(service *pb.ServiceDescriptorProto, servName string) {
+    methods := g.linkMethods(service)
+    clientName := servName + "LinkClient"
+
+    g.P(fmt.Sprintf("// %sLinkMaxPayload is the size of the largest serialized input and output", servName))
+    g.P("// exchanged over the serial links, up to seriallink.MaxPacketPayload.")
+    g.P(fmt.Sprintf("var %sLinkMaxPayload = 4096", servName))
+    g.P()
+    g.P(fmt.Sprintf("// Serve%sLink serves the %s methods with a (method_id) option over the", servName, servName))
+    g.P("// serial link rw, e.g. a serial port: it reads the request packets, calls the")
+    g.P("// method of their ID with their payload and writes back a response packet of")
+    g.P("// the same ID, holding the output of the call or, with the error status, its")
+    g.P("// error message, until reading fails. It returns nil at the end of rw.")
+    g.P(fmt.Sprintf("func Serve%sLink(rw io.ReadWriter) error {", servName))
+    g.P(fmt.Sprintf("    r := seriallink.NewPacketReader(rw, %sLinkMaxPayload)", servName))
+    g.P("    for {")
+    g.P("        req, err := r.ReadPacket()")
+    g.P("        if err == io.EOF {")
+    g.P("            return nil")
+    g.P("        }")
+    g.P("        if err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.P("        var call func(input []byte) (output []byte, err error)")
+    g.P("        switch req.Method {")
+    for _, m := range methods {
+        g.P(fmt.Sprintf("        case %d:", m.id))
+        g.P(fmt.Sprintf("            call = %s", generator.CamelCase(m.method.GetName())))
+    }
+    g.P("        }")
+    g.P("        resp := seriallink.Packet{Method: req.Method}")
+    g.P("        if call == nil {")
+    g.P("            err = fmt.Errorf(\"unknown method ID %d\", req.Method)")
+    g.P("        } else {")
+    g.P("            resp.Payload, err = call(req.Payload)")
+    g.P("        }")
+    g.P("        if err != nil {")
+    g.P("            resp.Status, resp.Payload = seriallink.StatusError, []byte(err.Error())")
+    g.P("        }")
+    g.P("        if err := seriallink.WritePacket(rw, resp); err != nil {")
+    g.P("            return err")
+    g.P("        }")
+    g.P("    }")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// %s calls the %s methods with a (method_id) option of a peer", clientName, servName))
+    g.P(fmt.Sprintf("// serving them over a serial link, e.g. with Serve%sLink, one call at a", servName))
+    g.P("// time. It is safe for concurrent use.")
+    g.P(fmt.Sprintf("type %s struct {", clientName))
+    g.P("    mu sync.Mutex")
+    g.P("    rw io.ReadWriter")
+    g.P("    r  *seriallink.PacketReader")
+    g.P("}")
+    g.P()
+    g.P(fmt.Sprintf("// New%s returns a client calling the methods over the serial link rw.", clientName))
+    g.P(fmt.Sprintf("func New%s(rw io.ReadWriter) *%s {", clientName, clientName))
+    g.P(fmt.Sprintf("    return &%s{rw: rw, r: seriallink.NewPacketReader(rw, %sLinkMaxPayload)}", clientName, servName))
+    g.P("}")
+    g.P()
+    for _, m := range methods {
+        methName := generator.CamelCase(m.method.GetName())
+        g.P(fmt.Sprintf("// %s calls %s, of method ID %d, with the serialized input, of type %s,", methName, methName, m.id, g.typeName(m.method.GetInputType())))
+        g.P(fmt.Sprintf("// and returns its serialized output, of type %s.", g.typeName(m.method.GetOutputType())))
+        g.P(fmt.Sprintf("func (c *%s) %s(input []byte) ([]byte, error) {", clientName, methName))
+        g.P(fmt.Sprintf("    return c.call(%d, input)", m.id))
+        g.P("}")
+        g.P()
+    }
+    g.P("// call writes the request packet of the method of the given ID and reads")
+    g.P("// its response, skipping the responses of other methods, left by calls")
+    g.P("// whose response was lost.")
+    g.P(fmt.Sprintf("func (c *%s) call(method uint16, input []byte) ([]byte, error) {", clientName))
+    g.P("    c.mu.Lock()")
+    g.P("    defer c.mu.Unlock()")
+    g.P("    if err := seriallink.WritePacket(c.rw, seriallink.Packet{Method: method, Payload: input}); err != nil {")
+    g.P("        return nil, err")
+    g.P("    }")
+    g.P("    for {")
+    g.P("        resp, err := c.r.ReadPacket()")
+    g.P("        if err != nil {")
+    g.P("            return nil, err")
+    g.P("        }")
+    g.P("        if resp.Method != method {")
+    g.P("            continue")
+    g.P("        }")
+    g.P("        if resp.Status == seriallink.StatusError {")
+    g.P("            return nil, errors.New(string(resp.Payload))")
+    g.P("        }")
+    g.P("        return append([]byte(nil), resp.Payload...), nil")
+    g.P("    }")
+    g.P("}")
+    g.P()
+}
@@ -0,0 +1,86 @@
+package grpcserial
+
+import (
+    "fmt"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// generateTelemetry generates the codecStats type and one instance of it per
+// message type used by the service, published with expvar under
+// "codec.<full message name>".
+func (g *grpcserial) generateTelemetry(service *pb.ServiceDescriptorProto) {
+    g.P("// codecStats counts the messages of a type decoded and encoded by the")
+    g.P("// serialized API, their size in bytes, the errors and the time spent.")
+    g.P("type codecStats struct {")
+    g.P("    decodes, decodeBytes, decodeErrors, decodeNanos *expvar.Int")
+    g.P("    encodes, encodeBytes, encodeErrors, encodeNanos *expvar.Int")
+    g.P("}")
+    g.P()
+    g.P("// newCodecStats returns codec counters published as the expvar map name.")
+    g.P("// The stubs of the services sharing a message type, linked into one binary,")
+    g.P("// share its map, which the first of them publishes.")
+    g.P("func newCodecStats(name string) *codecStats {")
+    g.P("    m, ok := expvar.Get(name).(*expvar.Map)")
+    g.P("    if !ok {")
+    g.P("        m = expvar.NewMap(name)")
+    g.P("    }")
+    g.P("    return &codecStats{")
+    g.P("        decodes:      codecCounter(m, \"decodes\"),")
+    g.P("        decodeBytes:  codecCounter(m, \"decode_bytes\"),")
+    g.P("        decodeErrors: codecCounter(m, \"decode_errors\"),")
+    g.P("        decodeNanos:  codecCounter(m, \"decode_ns\"),")
+    g.P("        encodes:      codecCounter(m, \"encodes\"),")
+    g.P("        encodeBytes:  codecCounter(m, \"encode_bytes\"),")
+    g.P("        encodeErrors: codecCounter(m, \"encode_errors\"),")
+    g.P("        encodeNanos:  codecCounter(m, \"encode_ns\"),")
+    g.P("    }")
+    g.P("}")
+    g.P()
+    g.P("// codecCounter returns the counter key of m, adding it if m lacks it.")
+    g.P("func codecCounter(m *expvar.Map, key string) *expvar.Int {")
+    g.P("    if v, ok := m.Get(key).(*expvar.Int); ok {")
+    g.P("        return v")
+    g.P("    }")
+    g.P("    v := new(expvar.Int)")
+    g.P("    m.Set(key, v)")
+    g.P("    return v")
+    g.P("}")
+    g.P()
+    g.P("// decoded records the decoding of n bytes started at start.")
+    g.P("func (s *codecStats) decoded(n int, start time.Time, err error) {")
+    g.P("    s.decodeNanos.Add(int64(time.Since(start)))")
+    g.P("    if err != nil {")
+    g.P("        s.decodeErrors.Add(1)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    s.decodes.Add(1)")
+    g.P("    s.decodeBytes.Add(int64(n))")
+    g.P("}")
+    g.P()
+    g.P("// encoded records the encoding of n bytes started at start.")
+    g.P("func (s *codecStats) encoded(n int, start time.Time, err error) {")
+    g.P("    s.encodeNanos.Add(int64(time.Since(start)))")
+    g.P("    if err != nil {")
+    g.P("        s.encodeErrors.Add(1)")
+    g.P("        return")
+    g.P("    }")
+    g.P("    s.encodes.Add(1)")
+    g.P("    s.encodeBytes.Add(int64(n))")
+    g.P("}")
+    g.P()
+
+    seen := make(map[string]bool)
+    for _, method := range service.Method {
+        for _, typ := range []string{method.GetInputType(), method.GetOutputType()} {
+            typeName := g.typeName(typ)
+            if seen[typeName] {
+                continue
+            }
+            seen[typeName] = true
+            g.P(fmt.Sprintf("var %sStats = newCodecStats(\"codec.%s\")", unexport(typeName), strings.TrimPrefix(typ, ".")))
+        }
+    }
+    g.P()
+}
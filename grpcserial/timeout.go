@@ -0,0 +1,48 @@
+package grpcserial
+
+import (
+    "fmt"
+    "time"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// timeout returns the timeout of the calls of method, given by its
+// (grpcserial.timeout) option, and whether it has one.
+func (g *grpcserial) timeout(method *pb.MethodDescriptorProto) (time.Duration, bool) {
+    return descutil.MethodTimeout(g.gen, method)
+}
+
+// hasTimeouts reports whether a method of service has a timeout.
+func (g *grpcserial) hasTimeouts(service *pb.ServiceDescriptorProto) bool {
+    for _, method := range service.Method {
+        if _, ok := g.timeout(method); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// generateTimeout generates, indented by indent, the derivation from parent
+// of the context of a call of method bounded by its timeout, if it has one,
+// and the deferred release of its resources.
+func (g *grpcserial) generateTimeout(indent, parent string, method *pb.MethodDescriptorProto) {
+    d, ok := g.timeout(method)
+    if !ok {
+        return
+    }
+    g.P(fmt.Sprintf("%sctx, cancel := context.WithTimeout(%s, %s)", indent, parent, descutil.DurationLiteral(d, "time")))
+    g.P(indent + "defer cancel()")
+}
+
+// serialCtx returns the parent of the context of the calls of the
+// serialized function of method: the context of its span with
+// tracing=true, or of its caller or metadata if it unwraps them from its
+// input, or else parentCtx.
+func (g *grpcserial) serialCtx(method *pb.MethodDescriptorProto) string {
+    if g.tracing || g.unwrapsInput(method) {
+        return "ctx"
+    }
+    return g.parentCtx()
+}
@@ -0,0 +1,96 @@
+package grpcserial
+
+import pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+
+// generateTracing generates tracer, the OpenTelemetry tracer of the
+// serialized API, and the helpers wrapping the serialized functions in
+// server spans: extractContext, unwrapping the serialmeta envelope of the
+// input and extracting the trace context it carries, and the caller it
+// carries too if callers is set, and its metadata with metadata=true,
+// startSpan and endSpan.
+func (g *grpcserial) generateTracing(callers bool) {
+    g.P("var tracer = otel.Tracer(\"github.com/lleveque/protoc-gen-go/grpcserial\")")
+    g.P()
+    g.P("// extractContext returns the input without its serialmeta envelope, if it")
+    g.P("// has one, and ctx with the trace context the envelope carries, as")
+    g.P("// injected by the caller with the global propagator.")
+    g.P("func extractContext(ctx context.Context, input []byte) (context.Context, []byte, error) {")
+    g.P("    md, input, err := serialmeta.Unwrap(input)")
+    g.P("    if err != nil {")
+    g.P("        return ctx, nil, err")
+    g.P("    }")
+    ctx := "otel.GetTextMapPropagator().Extract(ctx, md)"
+    if callers {
+        ctx = "callerContext(" + ctx + ", md)"
+    }
+    if g.metadata {
+        ctx = "serialmeta.NewContext(" + ctx + ", md)"
+    }
+    g.P("    return " + ctx + ", input, nil")
+    g.P("}")
+    g.P()
+    g.P("// startSpan starts the server span of a call of method of service, named")
+    g.P("// after the full method, e.g. \"pkg.Service/Method\".")
+    g.P("func startSpan(ctx context.Context, service, method string) (context.Context, trace.Span) {")
+    g.P("    return tracer.Start(ctx, service+\"/\"+method,")
+    g.P("        trace.WithSpanKind(trace.SpanKindServer),")
+    g.P("        trace.WithAttributes(")
+    g.P("            attribute.String(\"rpc.system\", \"grpcserial\"),")
+    g.P("            attribute.String(\"rpc.service\", service),")
+    g.P("            attribute.String(\"rpc.method\", method),")
+    g.P("        ))")
+    g.P("}")
+    g.P()
+    g.P("// endSpan records the size in bytes of the requests and responses of the")
+    g.P("// call of span, and its error if any, and ends span.")
+    g.P("func endSpan(span trace.Span, requestSize, responseSize int, err error) {")
+    g.P("    span.SetAttributes(")
+    g.P("        attribute.Int(\"rpc.request.size\", requestSize),")
+    g.P("        attribute.Int(\"rpc.response.size\", responseSize),")
+    g.P("    )")
+    g.P("    if err != nil {")
+    g.P("        span.RecordError(err)")
+    g.P("        span.SetStatus(codes.Error, err.Error())")
+    g.P("    }")
+    g.P("    span.End()")
+    g.P("}")
+    g.P()
+}
+
+// passesCtx reports whether the serialized function of method passes a
+// context to the implementation of method: the context of its span, with
+// tracing=true, the context bounded by its timeout, if it has one, the
+// context carrying its caller, if it has scopes, or its metadata, with
+// metadata=true, or the context given by the interceptors, with
+// interceptors=true.
+func (g *grpcserial) passesCtx(method *pb.MethodDescriptorProto) bool {
+    _, ok := g.timeout(method)
+    return g.tracing || ok || g.unwrapsInput(method) || g.interceptors
+}
+
+// ctxParam returns the context parameter of the implementation of method
+// called by its serialized function, if it is passed one, or "".
+func (g *grpcserial) ctxParam(method *pb.MethodDescriptorProto) string {
+    if g.passesCtx(method) {
+        return "ctx context.Context, "
+    }
+    return ""
+}
+
+// ctxArg returns the context argument matching ctxParam.
+func (g *grpcserial) ctxArg(method *pb.MethodDescriptorProto) string {
+    if g.passesCtx(method) {
+        return "ctx, "
+    }
+    return ""
+}
+
+// generateUnusedCtx generates the use of the context passed to the
+// implementation of method by its serialized function, until the
+// implementation is called with it.
+func (g *grpcserial) generateUnusedCtx(method *pb.MethodDescriptorProto) {
+    if g.passesCtx(method) {
+        g.P("    _ = ctx // TODO : pass ctx to your implementation")
+        g.P()
+    }
+}
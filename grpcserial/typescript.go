@@ -0,0 +1,238 @@
+package grpcserial
+
+import (
+    "bytes"
+    "fmt"
+    "path"
+    "sort"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// wellKnownTSTypes maps the well-known types having a special JSON mapping
+// to their TypeScript type.
+var wellKnownTSTypes = map[string]string{
+    ".google.protobuf.Any":         "{ \"@type\": string; [key: string]: unknown }",
+    ".google.protobuf.Duration":    "string",
+    ".google.protobuf.Empty":       "{}",
+    ".google.protobuf.FieldMask":   "string",
+    ".google.protobuf.ListValue":   "unknown[]",
+    ".google.protobuf.Struct":      "{ [key: string]: unknown }",
+    ".google.protobuf.Timestamp":   "string",
+    ".google.protobuf.Value":       "unknown",
+    ".google.protobuf.NullValue":   "null",
+    ".google.protobuf.BoolValue":   "boolean",
+    ".google.protobuf.BytesValue":  "string",
+    ".google.protobuf.DoubleValue": "number",
+    ".google.protobuf.FloatValue":  "number",
+    ".google.protobuf.Int32Value":  "number",
+    ".google.protobuf.Int64Value":  "string",
+    ".google.protobuf.StringValue": "string",
+    ".google.protobuf.UInt32Value": "number",
+    ".google.protobuf.UInt64Value": "string",
+}
+
+// tsFile accumulates the TypeScript definitions of a file, along with the
+// types it imports from the definitions of other files.
+type tsFile struct {
+    bytes.Buffer
+    file    *generator.FileDescriptor
+    name    string                     // output name of the definitions
+    imports map[string]map[string]bool // imported names, by module
+}
+
+// generateTypeScript returns TypeScript definitions of the JSON mapping of
+// the messages and enums of file, for the consumers of the JSON variants of
+// the serialized API.
+func (g *grpcserial) generateTypeScript(file *generator.FileDescriptor) string {
+    ts := &tsFile{
+        file:    file,
+        name:    descutil.OutputName(g.gen, file.FileDescriptorProto, ".d.ts"),
+        imports: make(map[string]map[string]bool),
+    }
+    for _, enum := range descutil.Enums(g.gen, file) {
+        g.generateTSEnum(ts, enum)
+    }
+    for _, msg := range descutil.Messages(g.gen, file) {
+        g.generateTSInterface(ts, msg)
+    }
+
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "// Code generated by protoc-gen-go. DO NOT EDIT.\n")
+    fmt.Fprintf(&b, "// source: %s\n", file.GetName())
+    var modules []string
+    for module := range ts.imports {
+        modules = append(modules, module)
+    }
+    sort.Strings(modules)
+    if len(modules) > 0 {
+        b.WriteString("\n")
+    }
+    for _, module := range modules {
+        var names []string
+        for name := range ts.imports[module] {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        fmt.Fprintf(&b, "import { %s } from %q;\n", strings.Join(names, ", "), module)
+    }
+    b.Write(ts.Bytes())
+    return b.String()
+}
+
+// generateTSEnum generates the union of the names of the values of enum,
+// which is how the JSON mapping represents them, or of their numbers with
+// enum_json=number.
+func (g *grpcserial) generateTSEnum(ts *tsFile, enum *generator.EnumDescriptor) {
+    ts.WriteString("\n")
+    writeTSDoc(ts, "", descutil.LeadingComments(ts.file.FileDescriptorProto, descutil.EnumPath(enum)))
+    var values []string
+    seen := make(map[int32]bool)
+    for _, value := range enum.Value {
+        if !g.enumNumbers {
+            values = append(values, fmt.Sprintf("%q", value.GetName()))
+        } else if !seen[value.GetNumber()] {
+            seen[value.GetNumber()] = true
+            values = append(values, fmt.Sprint(value.GetNumber()))
+        }
+    }
+    fmt.Fprintf(ts, "export type %s = %s;\n", generator.CamelCaseSlice(enum.TypeName()), strings.Join(values, " | "))
+}
+
+// generateTSInterface generates the type of the JSON mapping of msg. Every
+// field is optional, as default values are omitted from the JSON. Messages
+// with oneofs are an object type intersected, for each oneof, with the union
+// of the objects setting at most one of its fields, instead of an interface.
+func (g *grpcserial) generateTSInterface(ts *tsFile, msg *generator.Descriptor) {
+    msgPath := descutil.MessagePath(msg)
+    name := generator.CamelCaseSlice(msg.TypeName())
+    ts.WriteString("\n")
+    writeTSDoc(ts, "", descutil.LeadingComments(ts.file.FileDescriptorProto, msgPath))
+    if len(msg.OneofDecl) == 0 {
+        fmt.Fprintf(ts, "export interface %s {\n", name)
+    } else {
+        fmt.Fprintf(ts, "export type %s = {\n", name)
+    }
+    oneofs := make([][]*pb.FieldDescriptorProto, len(msg.OneofDecl))
+    for i, field := range msg.Field {
+        if field.OneofIndex != nil {
+            oneofs[field.GetOneofIndex()] = append(oneofs[field.GetOneofIndex()], field)
+            continue
+        }
+        writeTSDoc(ts, "  ", descutil.LeadingComments(ts.file.FileDescriptorProto, fmt.Sprintf("%s,2,%d", msgPath, i)))
+        fmt.Fprintf(ts, "  %s?: %s;\n", descutil.JSONName(field), g.tsFieldType(ts, field))
+    }
+    ts.WriteString("}")
+    for k, fields := range oneofs {
+        ts.WriteString(" & (\n")
+        writeTSDoc(ts, "  ", descutil.LeadingComments(ts.file.FileDescriptorProto, fmt.Sprintf("%s,8,%d", msgPath, k)))
+        for _, set := range fields {
+            var members []string
+            for _, field := range fields {
+                typ := "never"
+                if field == set {
+                    typ = g.tsFieldType(ts, field)
+                }
+                members = append(members, fmt.Sprintf("%s?: %s", descutil.JSONName(field), typ))
+            }
+            fmt.Fprintf(ts, "  | { %s }\n", strings.Join(members, "; "))
+        }
+        ts.WriteString(")")
+    }
+    if len(msg.OneofDecl) > 0 {
+        ts.WriteString(";")
+    }
+    ts.WriteString("\n")
+}
+
+// tsFieldType returns the TypeScript type of the JSON value of field.
+func (g *grpcserial) tsFieldType(ts *tsFile, field *pb.FieldDescriptorProto) string {
+    if field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE {
+        if entry, ok := g.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor); ok && entry.GetOptions().GetMapEntry() {
+            return fmt.Sprintf("{ [key: string]: %s }", g.tsType(ts, entry.Field[1]))
+        }
+    }
+    typ := g.tsType(ts, field)
+    if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+        if strings.ContainsAny(typ, " |") {
+            typ = "(" + typ + ")"
+        }
+        return typ + "[]"
+    }
+    return typ
+}
+
+// tsType returns the TypeScript type of a single JSON value of field.
+func (g *grpcserial) tsType(ts *tsFile, field *pb.FieldDescriptorProto) string {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        return "boolean"
+    case pb.FieldDescriptorProto_TYPE_STRING, pb.FieldDescriptorProto_TYPE_BYTES:
+        return "string"
+    case pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_UINT64,
+        pb.FieldDescriptorProto_TYPE_SINT64, pb.FieldDescriptorProto_TYPE_FIXED64,
+        pb.FieldDescriptorProto_TYPE_SFIXED64:
+        if g.int64Numbers {
+            return "number"
+        }
+        return "string"
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP, pb.FieldDescriptorProto_TYPE_ENUM:
+        if g.int64Numbers && isInt64Wrapper(field.GetTypeName()) || g.unixMillis(field.GetTypeName()) {
+            return "number"
+        }
+        if typ, ok := wellKnownTSTypes[field.GetTypeName()]; ok {
+            return typ
+        }
+        return g.tsTypeRef(ts, field.GetTypeName())
+    }
+    return "number"
+}
+
+// tsTypeRef returns the name of the message or enum named typ in the
+// definitions of ts, importing it when it is defined in another file.
+func (g *grpcserial) tsTypeRef(ts *tsFile, typ string) string {
+    obj := g.gen.ObjectNamed(typ)
+    name := generator.CamelCaseSlice(obj.TypeName())
+    if obj.File() == ts.file.FileDescriptorProto {
+        return name
+    }
+    other := descutil.OutputName(g.gen, obj.File(), ".d.ts")
+    module := strings.TrimSuffix(relPath(path.Dir(ts.name), other), ".d.ts")
+    if !strings.HasPrefix(module, ".") {
+        module = "./" + module
+    }
+    if ts.imports[module] == nil {
+        ts.imports[module] = make(map[string]bool)
+    }
+    ts.imports[module][name] = true
+    return name
+}
+
+// writeTSDoc writes comment as a JSDoc comment, indented by indent.
+func writeTSDoc(ts *tsFile, indent, comment string) {
+    if comment == "" {
+        return
+    }
+    fmt.Fprintf(ts, "%s/**\n", indent)
+    for _, line := range strings.Split(strings.Replace(comment, "*/", "* /", -1), "\n") {
+        fmt.Fprintf(ts, "%s * %s\n", indent, line)
+    }
+    fmt.Fprintf(ts, "%s */\n", indent)
+}
+
+// relPath returns the slash-separated path of target relative to the
+// directory dir.
+func relPath(dir, target string) string {
+    if dir == "." {
+        return target
+    }
+    d := strings.Split(dir, "/")
+    t := strings.Split(target, "/")
+    for len(d) > 0 && len(t) > 1 && d[0] == t[0] {
+        d, t = d[1:], t[1:]
+    }
+    return strings.Repeat("../", len(d)) + strings.Join(t, "/")
+}
@@ -0,0 +1,85 @@
+package httprpc
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// BudgetHeader is the header of the Connect requests carrying the latency
+// budget left to the call, in milliseconds.
+const BudgetHeader = "Latency-Budget-Ms"
+
+// budgetKey is the context key of the end of the latency budget of the
+// calls.
+type budgetKey struct{}
+
+// WithBudget returns a copy of ctx carrying a latency budget of d: the
+// time within which the calls made with it, and the calls they make in
+// turn, are expected to complete end to end. Unlike a deadline, the budget
+// does not cancel the calls; the Connect clients of the methods with a
+// (budget_ms) option refuse to start them when the budget left is below
+// their minimum, rather than let them time out deep in the call graph.
+func WithBudget(ctx context.Context, d time.Duration) context.Context {
+    return context.WithValue(ctx, budgetKey{}, time.Now().Add(d))
+}
+
+// Budget returns the latency budget left to the calls made with ctx, the
+// time elapsed since it was set deducted, and whether ctx has one. The
+// budget never exceeds the time left before the deadline of ctx.
+func Budget(ctx context.Context) (time.Duration, bool) {
+    end, ok := ctx.Value(budgetKey{}).(time.Time)
+    if deadline, has := ctx.Deadline(); has && (!ok || deadline.Before(end)) {
+        end, ok = deadline, true
+    }
+    if !ok {
+        return 0, false
+    }
+    return end.Sub(time.Now()), true
+}
+
+// CheckBudget returns a DeadlineExceeded error if the latency budget left
+// to the call of procedure made with ctx is below minMs milliseconds, the
+// time the method needs to complete, as given by its (budget_ms) option.
+// Calls without a budget are allowed.
+func CheckBudget(ctx context.Context, procedure string, minMs int64) error {
+    min := time.Duration(minMs) * time.Millisecond
+    left, ok := Budget(ctx)
+    if ok && left < min {
+        if left < 0 {
+            left = 0
+        }
+        return Errorf(DeadlineExceeded, "latency budget left to %s is %v, below its minimum of %v",
+            procedure, left/time.Millisecond*time.Millisecond, min)
+    }
+    return nil
+}
+
+// setBudgetHeader sets the BudgetHeader of req to the budget left to ctx,
+// if any.
+func setBudgetHeader(ctx context.Context, req *http.Request) {
+    left, ok := Budget(ctx)
+    if !ok {
+        return
+    }
+    ms := int64(left / time.Millisecond)
+    if ms < 0 {
+        ms = 0
+    }
+    req.Header.Set(BudgetHeader, strconv.FormatInt(ms, 10))
+}
+
+// budgetFromHeader returns a copy of ctx carrying the budget of the
+// BudgetHeader of r, if any, counted from now.
+func budgetFromHeader(ctx context.Context, r *http.Request) (context.Context, error) {
+    ms := r.Header.Get(BudgetHeader)
+    if ms == "" {
+        return ctx, nil
+    }
+    n, err := strconv.ParseInt(ms, 10, 64)
+    if err != nil || n < 0 {
+        return ctx, Errorf(InvalidArgument, "invalid %s %q", BudgetHeader, ms)
+    }
+    return WithBudget(ctx, time.Duration(n)*time.Millisecond), nil
+}
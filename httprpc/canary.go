@@ -0,0 +1,62 @@
+package httprpc
+
+import (
+    "hash/fnv"
+    "math"
+    "math/rand"
+    "sync/atomic"
+)
+
+// CanaryConfig gives the share of the calls routed to the canary backend
+// by the canary clients. It is consulted on every call, so that the share
+// can be updated at runtime, e.g. from a configuration service.
+type CanaryConfig interface {
+    // CanaryPercent returns the percentage, from 0 to 100, of the calls of
+    // procedure, e.g. "/pkg.Service/Method", routed to the canary.
+    CanaryPercent(procedure string) float64
+}
+
+// CanaryPercent is a CanaryConfig routing the same percentage of the calls
+// of every procedure to the canary, safe to update while in use.
+type CanaryPercent struct {
+    bits uint64 // the percentage, as float64 bits
+}
+
+// NewCanaryPercent returns a CanaryPercent routing percent of the calls to
+// the canary.
+func NewCanaryPercent(percent float64) *CanaryPercent {
+    p := new(CanaryPercent)
+    p.Set(percent)
+    return p
+}
+
+// Set sets the percentage of the calls routed to the canary.
+func (p *CanaryPercent) Set(percent float64) {
+    atomic.StoreUint64(&p.bits, math.Float64bits(percent))
+}
+
+// CanaryPercent returns the percentage of the calls routed to the canary,
+// whatever the procedure.
+func (p *CanaryPercent) CanaryPercent(procedure string) float64 {
+    return math.Float64frombits(atomic.LoadUint64(&p.bits))
+}
+
+// ToCanary reports whether the call of procedure, with the routing key
+// key, is routed to the canary as per config. The calls with the same key
+// are routed to the same backend, as long as the percentage does not
+// change, e.g. to keep a user on one version; the calls without a key are
+// routed at random.
+func ToCanary(config CanaryConfig, procedure, key string) bool {
+    percent := config.CanaryPercent(procedure)
+    switch {
+    case percent <= 0:
+        return false
+    case percent >= 100:
+        return true
+    case key == "":
+        return rand.Float64()*100 < percent
+    }
+    h := fnv.New64a()
+    h.Write([]byte(key))
+    return float64(h.Sum64()%10000) < percent*100
+}
@@ -0,0 +1,666 @@
+package httprpc
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/golang/protobuf/jsonpb"
+    "github.com/golang/protobuf/proto"
+)
+
+// StreamType is the kind of stream of a method.
+type StreamType int
+
+// The stream types, from the streaming qualifiers of the request and
+// response of the method.
+const (
+    Unary StreamType = iota
+    ClientStream
+    ServerStream
+    BidiStream
+)
+
+// ConnectHandler is a handler of a service serving the Connect, gRPC and
+// gRPC-Web protocols.
+type ConnectHandler interface {
+    http.Handler
+
+    // PathPrefix returns the prefix of the paths of the methods of the
+    // service, under which the handler must be mounted.
+    PathPrefix() string
+}
+
+// maxMessageSize bounds the size of the messages of the streams, as gRPC
+// does by default.
+const maxMessageSize = 4 << 20
+
+// The flags of the envelopes of the streamed messages.
+const (
+    flagCompressed  = 0x01
+    flagEndStream   = 0x02 // Connect end of stream message
+    flagGRPCTrailer = 0x80 // gRPC-Web trailers
+)
+
+var (
+    connectMarshaler   = jsonpb.Marshaler{}
+    connectUnmarshaler = jsonpb.Unmarshaler{AllowUnknownFields: true}
+)
+
+// protocol identifies the protocol of a request served by ServeConnect.
+type protocol int
+
+const (
+    connectUnary protocol = iota
+    connectStream
+    grpcProtocol
+    grpcWebProtocol
+)
+
+// connectCodes maps the codes to their name in the Connect protocol, when
+// it differs, the codes specific to Twirp being mapped to the closest ones.
+var connectCodes = map[Code]string{
+    DataLoss:  "data_loss",
+    Malformed: "invalid_argument",
+    BadRoute:  "unimplemented",
+}
+
+// grpcCodes maps the codes to their gRPC status code.
+var grpcCodes = map[Code]int{
+    Canceled:           1,
+    Unknown:            2,
+    InvalidArgument:    3,
+    Malformed:          3,
+    DeadlineExceeded:   4,
+    NotFound:           5,
+    BadRoute:           12,
+    AlreadyExists:      6,
+    PermissionDenied:   7,
+    ResourceExhausted:  8,
+    FailedPrecondition: 9,
+    Aborted:            10,
+    OutOfRange:         11,
+    Unimplemented:      12,
+    Internal:           13,
+    Unavailable:        14,
+    DataLoss:           15,
+    Unauthenticated:    16,
+}
+
+// connectStatus maps the codes to the HTTP status of the Connect unary
+// responses reporting them, when it differs from their Twirp one.
+var connectStatus = map[Code]int{
+    Canceled:           499,
+    DeadlineExceeded:   http.StatusGatewayTimeout,
+    FailedPrecondition: http.StatusBadRequest,
+    BadRoute:           http.StatusNotImplemented,
+}
+
+// ConnectStatus returns the HTTP status of the Connect unary responses
+// reporting an error with code c.
+func (c Code) ConnectStatus() int {
+    if status, ok := connectStatus[c]; ok {
+        return status
+    }
+    return c.HTTPStatus()
+}
+
+// GRPCStatus returns the gRPC status code of the errors with code c, that
+// of Unknown for unknown codes.
+func (c Code) GRPCStatus() int {
+    if code, ok := grpcCodes[c]; ok {
+        return code
+    }
+    return grpcCodes[Unknown]
+}
+
+// connectCode returns the name of c in the Connect protocol.
+func connectCode(c Code) string {
+    if name, ok := connectCodes[c]; ok {
+        return name
+    }
+    return string(c)
+}
+
+// fromConnectCode returns the code named name in the Connect protocol.
+func fromConnectCode(name string) Code {
+    if name == "data_loss" {
+        return DataLoss
+    }
+    return Code(name)
+}
+
+// connectError is the JSON representation of an *Error in the Connect
+// protocol.
+type connectError struct {
+    Code    string `json:"code"`
+    Message string `json:"message,omitempty"`
+}
+
+// connectEndStream is the end of stream message of the Connect protocol.
+type connectEndStream struct {
+    Error *connectError `json:"error,omitempty"`
+}
+
+// ServerCall is the server side of a call served by ServeConnect.
+type ServerCall struct {
+    w        http.ResponseWriter
+    r        *http.Request
+    typ      StreamType
+    protocol protocol
+    isJSON   bool
+    received bool // the unary request has been read
+    started  bool // the response headers are written
+    sent     bool // a response has been written
+
+    receivedBytes, sentBytes int // size of the messages received and sent
+
+    checks []func(m proto.Message) error // run on the requests received
+}
+
+// ServeConnect serves the request r for a method of the given stream
+// type, speaking the protocol of the client, Connect, gRPC or gRPC-Web.
+// call runs the method, receiving its requests from and sending its
+// responses to the ServerCall.
+func ServeConnect(w http.ResponseWriter, r *http.Request, typ StreamType, call func(ctx context.Context, c *ServerCall) error) {
+    if r.Method != "POST" {
+        w.Header().Set("Allow", "POST")
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    c := &ServerCall{w: w, r: r, typ: typ}
+    contentType := r.Header.Get("Content-Type")
+    if i := strings.Index(contentType, ";"); i >= 0 {
+        contentType = contentType[:i]
+    }
+    switch strings.TrimSpace(strings.ToLower(contentType)) {
+    case "application/proto":
+        c.protocol = connectUnary
+    case "application/json":
+        c.protocol, c.isJSON = connectUnary, true
+    case "application/connect+proto":
+        c.protocol = connectStream
+    case "application/connect+json":
+        c.protocol, c.isJSON = connectStream, true
+    case "application/grpc", "application/grpc+proto":
+        c.protocol = grpcProtocol
+    case "application/grpc+json":
+        c.protocol, c.isJSON = grpcProtocol, true
+    case "application/grpc-web", "application/grpc-web+proto":
+        c.protocol = grpcWebProtocol
+    case "application/grpc-web+json":
+        c.protocol, c.isJSON = grpcWebProtocol, true
+    default:
+        http.Error(w, "unsupported content type "+strconv.Quote(r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+        return
+    }
+    if c.protocol == connectUnary && typ != Unary || c.protocol == connectStream && typ == Unary {
+        http.Error(w, "unsupported content type "+strconv.Quote(r.Header.Get("Content-Type"))+" for the method", http.StatusUnsupportedMediaType)
+        return
+    }
+
+    ctx := r.Context()
+    timeout, err := c.timeout()
+    if err == nil && timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+    if err == nil {
+        ctx, err = budgetFromHeader(ctx, r)
+    }
+    if err == nil {
+        err = c.checkEncoding()
+    }
+    if err == nil {
+        err = intercept(ctx, c, call)
+    }
+    if err == nil && !c.serverStreaming() && !c.sent {
+        err = Errorf(Internal, "no response sent")
+    }
+    // The handlers of the methods with a timeout of their own report it
+    // expired with the error of their context.
+    if err != nil && (ctx.Err() == context.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded)) {
+        err = Errorf(DeadlineExceeded, "%v", err)
+    }
+    c.finish(ErrorFrom(err))
+}
+
+// timeout returns the timeout of the call requested by the client, or 0.
+func (c *ServerCall) timeout() (time.Duration, error) {
+    if c.protocol == connectUnary || c.protocol == connectStream {
+        ms := c.r.Header.Get("Connect-Timeout-Ms")
+        if ms == "" {
+            return 0, nil
+        }
+        n, err := strconv.ParseInt(ms, 10, 64)
+        if err != nil || n < 0 {
+            return 0, Errorf(InvalidArgument, "invalid Connect-Timeout-Ms %q", ms)
+        }
+        return time.Duration(n) * time.Millisecond, nil
+    }
+    timeout := c.r.Header.Get("Grpc-Timeout")
+    if timeout == "" {
+        return 0, nil
+    }
+    units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+    unit, ok := units[timeout[len(timeout)-1]]
+    n, err := strconv.ParseInt(timeout[:len(timeout)-1], 10, 64)
+    if !ok || err != nil || n < 0 {
+        return 0, Errorf(InvalidArgument, "invalid grpc-timeout %q", timeout)
+    }
+    return time.Duration(n) * unit, nil
+}
+
+// checkEncoding checks that the requests are not compressed, as compression
+// is not supported.
+func (c *ServerCall) checkEncoding() error {
+    for _, h := range []string{"Content-Encoding", "Connect-Content-Encoding", "Grpc-Encoding"} {
+        if enc := c.r.Header.Get(h); enc != "" && enc != "identity" {
+            return Errorf(Unimplemented, "unsupported %s %q", h, enc)
+        }
+    }
+    return nil
+}
+
+// Receive decodes the next request of the call into m. It returns io.EOF
+// when the client has no more requests.
+func (c *ServerCall) Receive(m proto.Message) error {
+    if err := c.receive(m); err != nil {
+        return err
+    }
+    for _, check := range c.checks {
+        if err := check(m); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// receive decodes the next request of the call into m.
+func (c *ServerCall) receive(m proto.Message) error {
+    if c.protocol == connectUnary {
+        if c.received {
+            return io.EOF
+        }
+        c.received = true
+        body, err := ioutil.ReadAll(io.LimitReader(c.r.Body, maxMessageSize+1))
+        if err != nil {
+            return Errorf(Canceled, "failed to read the request: %v", err)
+        }
+        if len(body) > maxMessageSize {
+            return Errorf(ResourceExhausted, "request larger than %d bytes", maxMessageSize)
+        }
+        c.receivedBytes += len(body)
+        return unmarshal(body, m, c.isJSON, InvalidArgument)
+    }
+    flags, body, err := readEnvelope(c.r.Body)
+    if err != nil {
+        return err
+    }
+    if flags&flagCompressed != 0 {
+        return Errorf(Unimplemented, "compressed messages are not supported")
+    }
+    c.receivedBytes += len(body)
+    return unmarshal(body, m, c.isJSON, InvalidArgument)
+}
+
+// Send sends m as the next response of the call.
+func (c *ServerCall) Send(m proto.Message) error {
+    if c.sent && !c.serverStreaming() {
+        return Errorf(Internal, "the method has a single response")
+    }
+    body, err := marshal(m, c.isJSON)
+    if err != nil {
+        return err
+    }
+    c.start()
+    c.sent = true
+    c.sentBytes += len(body)
+    if c.protocol == connectUnary {
+        _, err = c.w.Write(body)
+        return err
+    }
+    if err = writeEnvelope(c.w, 0, body); err != nil {
+        return Errorf(Canceled, "failed to send the response: %v", err)
+    }
+    if f, ok := c.w.(http.Flusher); ok {
+        f.Flush()
+    }
+    return nil
+}
+
+// serverStreaming reports whether the method has a stream of responses.
+func (c *ServerCall) serverStreaming() bool {
+    return c.typ == ServerStream || c.typ == BidiStream
+}
+
+// start writes the response headers, if not already done.
+func (c *ServerCall) start() {
+    if c.started {
+        return
+    }
+    c.started = true
+    h := c.w.Header()
+    h.Set("Content-Type", c.r.Header.Get("Content-Type"))
+    if c.protocol == grpcProtocol {
+        h.Set("Trailer", "Grpc-Status, Grpc-Message")
+    }
+    c.w.WriteHeader(http.StatusOK)
+}
+
+// finish ends the response of the call with the status err.
+func (c *ServerCall) finish(err *Error) {
+    switch c.protocol {
+    case connectUnary:
+        if err == nil || c.started {
+            return
+        }
+        body, _ := json.Marshal(connectError{connectCode(err.Code), err.Msg})
+        c.w.Header().Set("Content-Type", "application/json")
+        c.w.WriteHeader(err.Code.ConnectStatus())
+        c.w.Write(body)
+    case connectStream:
+        c.start()
+        var end connectEndStream
+        if err != nil {
+            end.Error = &connectError{connectCode(err.Code), err.Msg}
+        }
+        body, _ := json.Marshal(end)
+        writeEnvelope(c.w, flagEndStream, body)
+    case grpcProtocol:
+        c.start()
+        status, msg := grpcStatus(err)
+        c.w.Header().Set("Grpc-Status", status)
+        c.w.Header().Set("Grpc-Message", msg)
+    case grpcWebProtocol:
+        c.start()
+        status, msg := grpcStatus(err)
+        trailer := fmt.Sprintf("grpc-status: %s\r\ngrpc-message: %s\r\n", status, msg)
+        writeEnvelope(c.w, flagGRPCTrailer, []byte(trailer))
+    }
+}
+
+// grpcStatus returns the gRPC status and percent-encoded message of err.
+func grpcStatus(err *Error) (status, msg string) {
+    if err == nil {
+        return "0", ""
+    }
+    var b bytes.Buffer
+    for i := 0; i < len(err.Msg); i++ {
+        if c := err.Msg[i]; c < ' ' || c > '~' || c == '%' {
+            fmt.Fprintf(&b, "%%%02X", c)
+        } else {
+            b.WriteByte(c)
+        }
+    }
+    return strconv.Itoa(err.Code.GRPCStatus()), b.String()
+}
+
+// readEnvelope reads an enveloped message of a stream from r. It returns
+// io.EOF if the stream ends before the message.
+func readEnvelope(r io.Reader) (flags byte, body []byte, err error) {
+    var header [5]byte
+    if _, err := io.ReadFull(r, header[:]); err != nil {
+        if err == io.EOF {
+            return 0, nil, io.EOF
+        }
+        return 0, nil, Errorf(InvalidArgument, "truncated message: %v", err)
+    }
+    n := binary.BigEndian.Uint32(header[1:])
+    if n > maxMessageSize {
+        return 0, nil, Errorf(ResourceExhausted, "message larger than %d bytes", maxMessageSize)
+    }
+    body = make([]byte, n)
+    if _, err := io.ReadFull(r, body); err != nil {
+        return 0, nil, Errorf(InvalidArgument, "truncated message: %v", err)
+    }
+    return header[0], body, nil
+}
+
+// writeEnvelope writes body as an enveloped message of a stream to w.
+func writeEnvelope(w io.Writer, flags byte, body []byte) error {
+    var header [5]byte
+    header[0] = flags
+    binary.BigEndian.PutUint32(header[1:], uint32(len(body)))
+    if _, err := w.Write(header[:]); err != nil {
+        return err
+    }
+    _, err := w.Write(body)
+    return err
+}
+
+// marshal encodes m, as JSON if isJSON is set.
+func marshal(m proto.Message, isJSON bool) ([]byte, error) {
+    if !isJSON {
+        b, err := proto.Marshal(m)
+        if err != nil {
+            return nil, Errorf(Internal, "failed to encode the message: %v", err)
+        }
+        return b, nil
+    }
+    b, err := marshalJSON(&connectMarshaler, m)
+    if err != nil {
+        return nil, Errorf(Internal, "failed to encode the message: %v", err)
+    }
+    return b, nil
+}
+
+// unmarshal decodes data into m, as JSON if isJSON is set, reporting
+// errors with the given code.
+func unmarshal(data []byte, m proto.Message, isJSON bool, code Code) error {
+    var err error
+    if isJSON {
+        err = unmarshalJSON(&connectUnmarshaler, data, m)
+    } else {
+        err = proto.Unmarshal(data, m)
+    }
+    if err != nil {
+        return Errorf(code, "failed to decode the message: %v", err)
+    }
+    return nil
+}
+
+// connectRequest returns the request of a Connect call of the method at
+// path of the server at baseURL, whose body is body.
+func connectRequest(ctx context.Context, baseURL, path, contentType string, body io.Reader) (*http.Request, error) {
+    req, err := http.NewRequest("POST", strings.TrimSuffix(baseURL, "/")+path, body)
+    if err != nil {
+        return nil, Errorf(Internal, "could not build the request: %v", err)
+    }
+    req = req.WithContext(ctx)
+    req.Header.Set("Content-Type", contentType)
+    req.Header.Set("Connect-Protocol-Version", "1")
+    if deadline, ok := ctx.Deadline(); ok {
+        ms := int64(deadline.Sub(time.Now()) / time.Millisecond)
+        if ms < 1 {
+            ms = 1
+        }
+        req.Header.Set("Connect-Timeout-Ms", strconv.FormatInt(ms, 10))
+    }
+    setBudgetHeader(ctx, req)
+    return req, nil
+}
+
+// clientError returns the error of a failed HTTP request made with ctx.
+func clientError(ctx context.Context, err error) *Error {
+    switch ctx.Err() {
+    case context.Canceled:
+        return Errorf(Canceled, "%v", err)
+    case context.DeadlineExceeded:
+        return Errorf(DeadlineExceeded, "%v", err)
+    }
+    return Errorf(Unavailable, "failed to do the request: %v", err)
+}
+
+// connectResponseError returns the error reported by the Connect error
+// response resp, whose body is body.
+func connectResponseError(resp *http.Response, body []byte) *Error {
+    var e connectError
+    if err := json.Unmarshal(body, &e); err != nil || e.Code == "" {
+        code := statusCode(resp.StatusCode)
+        if code == BadRoute {
+            code = Unimplemented
+        }
+        return &Error{Code: code, Msg: "unexpected error response: " + resp.Status}
+    }
+    return &Error{Code: fromConnectCode(e.Code), Msg: e.Message}
+}
+
+// CallConnect calls the unary method at path of the Connect server at
+// baseURL, e.g. "http://localhost:8080", with in as the request, encoded
+// as JSON if isJSON is set, and decodes the response into out. The errors
+// reported by the server are returned as *Error.
+func CallConnect(ctx context.Context, client HTTPClient, baseURL, path string, in, out proto.Message, isJSON bool) error {
+    body, err := marshal(in, isJSON)
+    if err != nil {
+        return err
+    }
+    contentType := "application/proto"
+    if isJSON {
+        contentType = "application/json"
+    }
+    req, err := connectRequest(ctx, baseURL, path, contentType, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return clientError(ctx, err)
+    }
+    defer resp.Body.Close()
+    body, err = ioutil.ReadAll(resp.Body)
+    if err != nil {
+        return clientError(ctx, err)
+    }
+    if resp.StatusCode != http.StatusOK {
+        return connectResponseError(resp, body)
+    }
+    return unmarshal(body, out, isJSON, Internal)
+}
+
+// CallConnectStream calls the streaming method at path of the Connect
+// server at baseURL, sending the requests returned by requests until it
+// returns io.EOF, and passing each response, allocated with newResponse,
+// to responses. If responses is nil, the method must have a single
+// response. The errors reported by the server are returned as *Error, and
+// those of requests and responses as is.
+//
+// Bidirectional streams need HTTP/2, as HTTP/1.1 servers do not read the
+// requests after they have started responding.
+func CallConnectStream(ctx context.Context, client HTTPClient, baseURL, path string, isJSON bool,
+    requests func() (proto.Message, error), newResponse func() proto.Message, responses func(proto.Message) error) error {
+    contentType := "application/connect+proto"
+    if isJSON {
+        contentType = "application/connect+json"
+    }
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    pr, pw := io.Pipe()
+    defer pr.Close()
+    var mu sync.Mutex
+    var reqErr error
+    go func() {
+        for {
+            m, err := requests()
+            if err == nil {
+                var body []byte
+                if body, err = marshal(m, isJSON); err == nil {
+                    err = writeEnvelope(pw, 0, body)
+                }
+            }
+            if err == io.EOF {
+                pw.Close()
+                return
+            }
+            if err != nil {
+                mu.Lock()
+                reqErr = err
+                mu.Unlock()
+                pw.CloseWithError(err)
+                cancel()
+                return
+            }
+        }
+    }()
+    requestError := func(err error) error {
+        mu.Lock()
+        defer mu.Unlock()
+        if reqErr != nil {
+            return reqErr
+        }
+        return err
+    }
+
+    req, err := connectRequest(ctx, baseURL, path, contentType, pr)
+    if err != nil {
+        return err
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return requestError(clientError(ctx, err))
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        body, _ := ioutil.ReadAll(resp.Body)
+        return connectResponseError(resp, body)
+    }
+    n := 0
+    for {
+        flags, body, err := readEnvelope(resp.Body)
+        if err == io.EOF {
+            return requestError(Errorf(Internal, "missing end of stream message"))
+        }
+        if err != nil {
+            return requestError(err)
+        }
+        if flags&flagCompressed != 0 {
+            return Errorf(Internal, "compressed messages are not supported")
+        }
+        if flags&flagEndStream != 0 {
+            var end connectEndStream
+            if err := json.Unmarshal(body, &end); err != nil {
+                return Errorf(Internal, "invalid end of stream message: %v", err)
+            }
+            if end.Error != nil {
+                return &Error{Code: fromConnectCode(end.Error.Code), Msg: end.Error.Message}
+            }
+            if responses == nil && n != 1 {
+                return Errorf(Internal, "expected a single response, got %d", n)
+            }
+            return requestError(nil)
+        }
+        m := newResponse()
+        if err := unmarshal(body, m, isJSON, Internal); err != nil {
+            return err
+        }
+        n++
+        if responses != nil {
+            if err := responses(m); err != nil {
+                return err
+            }
+        }
+    }
+}
+
+// Single returns the requests of a stream sending only m.
+func Single(m proto.Message) func() (proto.Message, error) {
+    sent := false
+    return func() (proto.Message, error) {
+        if sent {
+            return nil, io.EOF
+        }
+        sent = true
+        return m, nil
+    }
+}
@@ -0,0 +1,171 @@
+package httprpc
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+)
+
+// Contract is a consumer-driven contract between a consumer and a service,
+// in the Pact specification version 2 format.
+type Contract struct {
+    Consumer     Pacticipant   `json:"consumer"`
+    Provider     Pacticipant   `json:"provider"`
+    Interactions []Interaction `json:"interactions"`
+    Metadata     struct {
+        PactSpecification struct {
+            Version string `json:"version"`
+        } `json:"pactSpecification"`
+    } `json:"metadata"`
+}
+
+// Pacticipant is the consumer or the provider of a Contract.
+type Pacticipant struct {
+    Name string `json:"name"`
+}
+
+// Interaction is a request of a Contract and its expected response.
+type Interaction struct {
+    Description string              `json:"description"`
+    Request     InteractionRequest  `json:"request"`
+    Response    InteractionResponse `json:"response"`
+}
+
+// InteractionRequest is the request of an Interaction.
+type InteractionRequest struct {
+    Method  string            `json:"method"`
+    Path    string            `json:"path"`
+    Headers map[string]string `json:"headers,omitempty"`
+    Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// InteractionResponse is the response expected for an Interaction: the
+// fields of its body must be in the actual response, which may have more.
+type InteractionResponse struct {
+    Status  int               `json:"status"`
+    Headers map[string]string `json:"headers,omitempty"`
+    Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// VerifyContract sends the requests of the contract, given in JSON, to h
+// and reports to t the responses not matching the expected ones. Errors
+// are expected by status, and by code when both responses have one, as
+// the Connect unary errors do.
+func VerifyContract(t TB, h http.Handler, contract string) {
+    t.Helper()
+    var c Contract
+    if err := json.Unmarshal([]byte(contract), &c); err != nil {
+        t.Errorf("invalid contract: %v", err)
+        return
+    }
+    for _, it := range c.Interactions {
+        r := httptest.NewRequest(it.Request.Method, it.Request.Path, bytes.NewReader(it.Request.Body))
+        for k, v := range it.Request.Headers {
+            r.Header.Set(k, v)
+        }
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, r)
+        if err := matchResponse(it.Response, w.Code, w.Body.Bytes()); err != nil {
+            t.Errorf("%s %s: %s: %v", it.Request.Method, it.Request.Path, it.Description, err)
+        }
+    }
+}
+
+// matchResponse returns an error if the response of the given status and
+// body does not match the expected one.
+func matchResponse(expected InteractionResponse, status int, body []byte) error {
+    isError := func(status int) bool { return status < 200 || status >= 300 }
+    if isError(expected.Status) {
+        if !isError(status) {
+            return fmt.Errorf("got status %d, want an error", status)
+        }
+        var want, got struct {
+            Code string `json:"code"`
+        }
+        json.Unmarshal(expected.Body, &want)
+        json.Unmarshal(body, &got)
+        if want.Code != "" && got.Code != "" && want.Code != got.Code {
+            return fmt.Errorf("got error code %s, want %s", got.Code, want.Code)
+        }
+        return nil
+    }
+    if status != expected.Status {
+        return fmt.Errorf("got status %d, want %d: %s", status, expected.Status, strings.TrimSpace(string(body)))
+    }
+    if len(expected.Body) == 0 {
+        return nil
+    }
+    var want, got interface{}
+    if err := json.Unmarshal(expected.Body, &want); err != nil {
+        return fmt.Errorf("invalid expected body: %v", err)
+    }
+    if err := json.Unmarshal(body, &got); err != nil {
+        return fmt.Errorf("invalid response body: %v", err)
+    }
+    return matchValue("body", want, got)
+}
+
+// matchValue returns an error if the JSON value got does not hold want, at
+// path: objects must have the fields of want, whose names are compared in
+// lowerCamelCase, and numbers may be written as strings, as 64-bit
+// integers are. Fields missing from got hold their zero value, as the JSON
+// mapping omits them.
+func matchValue(path string, want, got interface{}) error {
+    if got == nil && isZero(want) {
+        return nil
+    }
+    switch want := want.(type) {
+    case map[string]interface{}:
+        g, ok := got.(map[string]interface{})
+        if !ok {
+            return fmt.Errorf("%s: got %v, want an object", path, got)
+        }
+        fields := make(map[string]interface{})
+        for k, v := range g {
+            fields[lowerCamelCase(k)] = v
+        }
+        for k, v := range want {
+            if err := matchValue(path+"."+k, v, fields[lowerCamelCase(k)]); err != nil {
+                return err
+            }
+        }
+        return nil
+    case []interface{}:
+        g, ok := got.([]interface{})
+        if !ok || len(g) != len(want) {
+            return fmt.Errorf("%s: got %v, want %d elements", path, got, len(want))
+        }
+        for i := range want {
+            if err := matchValue(fmt.Sprintf("%s[%d]", path, i), want[i], g[i]); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+    if fmt.Sprint(want) != fmt.Sprint(got) {
+        return fmt.Errorf("%s: got %v, want %v", path, got, want)
+    }
+    return nil
+}
+
+// isZero reports whether the JSON value v is the zero value of a field.
+func isZero(v interface{}) bool {
+    switch v := v.(type) {
+    case nil:
+        return true
+    case bool:
+        return !v
+    case float64:
+        return v == 0
+    case string:
+        return v == "" || v == "0"
+    case []interface{}:
+        return len(v) == 0
+    case map[string]interface{}:
+        return len(v) == 0
+    }
+    return false
+}
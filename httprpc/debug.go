@@ -0,0 +1,176 @@
+package httprpc
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "regexp"
+    "runtime"
+    "strings"
+    "sync"
+    "time"
+)
+
+// DebugService describes a service served by a ConnectHandler, for its
+// introspection by DebugHandler.
+type DebugService struct {
+    Name    string        `json:"name"` // the full name, e.g. "pkg.Service"
+    Methods []DebugMethod `json:"methods"`
+}
+
+// DebugMethod describes a method of a DebugService.
+type DebugMethod struct {
+    Name       string `json:"name"`
+    Procedure  string `json:"procedure"`  // e.g. "/pkg.Service/Method"
+    StreamType string `json:"streamType"` // "unary", "client_stream", "server_stream" or "bidi_stream"
+
+    // Decorators is the configuration of the decorators generated around
+    // the method, from its options, e.g. {"quota.cost": "5"}.
+    Decorators map[string]string `json:"decorators,omitempty"`
+}
+
+// DescribedHandler is implemented by the ConnectHandlers generated with
+// the debug=true parameter, describing their service.
+type DescribedHandler interface {
+    ConnectHandler
+    DescribeService() DebugService
+}
+
+// recentErrorsWindow is the duration over which the errors of the calls
+// are counted as recent, in one-minute buckets.
+const recentErrorsWindow = 5
+
+// errorStats counts the calls of a procedure and their errors.
+type errorStats struct {
+    calls, errors int64
+    minutes       [recentErrorsWindow]int64 // the minute of each bucket of errors, since the Unix epoch
+    recent        [recentErrorsWindow]int64 // the errors of each minute
+    lastError     string
+    lastErrorTime time.Time
+}
+
+var (
+    errorStatsMu sync.Mutex
+    errorStatsOf = make(map[string]*errorStats)
+)
+
+// RecordErrors is an interceptor counting the calls of every procedure and
+// their errors, over the last minutes and in total, and keeping their last
+// error, as served by DebugHandler. It is best installed first, to see the
+// errors of the other interceptors.
+func RecordErrors(ctx context.Context, c *ServerCall, next func(ctx context.Context) error) error {
+    err := next(ctx)
+    now := time.Now()
+    errorStatsMu.Lock()
+    defer errorStatsMu.Unlock()
+    s, ok := errorStatsOf[c.Procedure()]
+    if !ok {
+        s = new(errorStats)
+        errorStatsOf[c.Procedure()] = s
+    }
+    s.calls++
+    if err != nil {
+        s.errors++
+        minute := now.Unix() / 60
+        i := minute % recentErrorsWindow
+        if s.minutes[i] != minute {
+            s.minutes[i], s.recent[i] = minute, 0
+        }
+        s.recent[i]++
+        s.lastError, s.lastErrorTime = err.Error(), now
+    }
+    return err
+}
+
+// debugMethodStats are the error counts of a method served by
+// DebugHandler.
+type debugMethodStats struct {
+    DebugMethod
+    Calls         int64      `json:"calls"`
+    Errors        int64      `json:"errors"`
+    RecentErrors  int64      `json:"recentErrors"` // in the last recentErrorsWindow minutes
+    LastError     string     `json:"lastError,omitempty"`
+    LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// debugService is a service served by DebugHandler.
+type debugService struct {
+    Name       string             `json:"name"`
+    PathPrefix string             `json:"pathPrefix"`
+    Methods    []debugMethodStats `json:"methods"`
+}
+
+// debugServer is the introspection of a server served by DebugHandler.
+type debugServer struct {
+    Services     []debugService `json:"services"`
+    Interceptors []string       `json:"interceptors"`
+}
+
+// DebugHandler returns an http.Handler serving, in JSON, the introspection
+// of the server of handlers whose calls run through interceptors, as
+// returned by NewServer, for operations: its services and their methods,
+// with the configuration of their generated decorators, the names of its
+// interceptors, the first one outermost, and the calls and errors of the
+// methods, in total and over the last minutes, with their last error, as
+// counted by the RecordErrors interceptor. The services of the handlers
+// which are not DescribedHandlers have no methods. It is meant to be
+// mounted under an internal mux, e.g. at /debug/rpc, rather than served
+// to the clients.
+func DebugHandler(handlers []ConnectHandler, interceptors ...ConnectInterceptor) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        server := debugServer{Services: []debugService{}, Interceptors: []string{}}
+        for _, i := range interceptors {
+            server.Interceptors = append(server.Interceptors, funcName(i))
+        }
+        minute := time.Now().Unix() / 60
+        errorStatsMu.Lock()
+        for _, h := range handlers {
+            s := debugService{Name: strings.Trim(h.PathPrefix(), "/"), PathPrefix: h.PathPrefix(), Methods: []debugMethodStats{}}
+            if d, ok := h.(DescribedHandler); ok {
+                service := d.DescribeService()
+                s.Name = service.Name
+                for _, m := range service.Methods {
+                    stats := debugMethodStats{DebugMethod: m}
+                    if e, ok := errorStatsOf[m.Procedure]; ok {
+                        stats.Calls, stats.Errors, stats.LastError = e.calls, e.errors, e.lastError
+                        for i, n := range e.recent {
+                            if minute-e.minutes[i] < recentErrorsWindow {
+                                stats.RecentErrors += n
+                            }
+                        }
+                        if e.lastError != "" {
+                            t := e.lastErrorTime
+                            stats.LastErrorTime = &t
+                        }
+                    }
+                    s.Methods = append(s.Methods, stats)
+                }
+            }
+            server.Services = append(server.Services, s)
+        }
+        errorStatsMu.Unlock()
+        data, err := json.MarshalIndent(server, "", "  ")
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.Write(append(data, '\n'))
+    })
+}
+
+// closureSuffix matches the suffix of the names of the function literals.
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// funcName returns the name of the function f, qualified by the name of
+// its package, and of the function returning it for a function literal,
+// e.g. "httprpc.Authorize".
+func funcName(f interface{}) string {
+    fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+    if fn == nil {
+        return "?"
+    }
+    name := closureSuffix.ReplaceAllString(fn.Name(), "")
+    return name[strings.LastIndex(name, "/")+1:]
+}
@@ -0,0 +1,129 @@
+package httprpc
+
+import (
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+
+    "github.com/golang/protobuf/proto"
+)
+
+// JSONEnumNumbers is implemented by the messages generated with the
+// enum_json=number parameter, whose enums are encoded in JSON as numbers,
+// for the consumers requiring them, rather than as the names of their
+// values as the proto3 JSON mapping specifies. The JSON encoders of the
+// package honor it.
+type JSONEnumNumbers interface {
+    proto.Message
+    JSONEnumNumbers()
+}
+
+// JSONRejectUnknownEnums is implemented by the messages generated with the
+// enum_json_unknown=reject parameter, whose enum values unknown to their
+// enum are rejected by the JSON decoders of the package rather than kept,
+// round-tripping as numbers.
+type JSONRejectUnknownEnums interface {
+    proto.Message
+    JSONRejectUnknownEnums()
+}
+
+// EnumNumbers returns the JSON encoding of the message m in data, of either
+// protobuf runtime, with its enums, encoded as the names of their values,
+// replaced by their numbers. Both encodings are accepted by the JSON
+// decoders.
+func EnumNumbers(data []byte, m interface{}) ([]byte, error) {
+    out, err := rewriteScalars(data, reflect.ValueOf(m), func(data json.RawMessage, v reflect.Value) (json.RawMessage, error) {
+        if !isEnum(v) || len(data) == 0 || data[0] != '"' {
+            return data, nil
+        }
+        return json.RawMessage(strconv.FormatInt(v.Int(), 10)), nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("invalid JSON encoding of %T: %v", m, err)
+    }
+    return out, nil
+}
+
+// CheckEnums returns an error if the message m, of either protobuf runtime,
+// has an enum value unknown to its enum, such as a number decoded from
+// JSON, or from the binary encoding of a newer schema.
+func CheckEnums(m interface{}) error {
+    if err := checkEnums(reflect.ValueOf(m), ""); err != nil {
+        return fmt.Errorf("invalid %T: %v", m, err)
+    }
+    return nil
+}
+
+// checkEnums returns an error if v, the value of the field at path, has an
+// enum value unknown to its enum.
+func checkEnums(v reflect.Value, path string) error {
+    switch v.Kind() {
+    case reflect.Ptr, reflect.Interface:
+        if v.IsNil() {
+            return nil
+        }
+        return checkEnums(v.Elem(), path)
+    case reflect.Struct:
+        for i := 0; i < v.NumField(); i++ {
+            f, sf := v.Field(i), v.Type().Field(i)
+            if sf.PkgPath != "" {
+                continue
+            }
+            if sf.Tag.Get("protobuf_oneof") != "" {
+                if f.IsNil() || f.Elem().Kind() != reflect.Ptr || f.Elem().IsNil() {
+                    continue
+                }
+                // The value of a oneof is the single field of its wrapper.
+                f, sf = f.Elem().Elem().Field(0), f.Elem().Elem().Type().Field(0)
+            }
+            tag := sf.Tag.Get("protobuf")
+            if tag == "" {
+                continue
+            }
+            name := sf.Name
+            for _, opt := range strings.Split(tag, ",") {
+                if strings.HasPrefix(opt, "name=") {
+                    name = opt[len("name="):]
+                }
+            }
+            if path != "" {
+                name = path + "." + name
+            }
+            if err := checkEnums(f, name); err != nil {
+                return err
+            }
+        }
+    case reflect.Map:
+        for _, k := range v.MapKeys() {
+            if err := checkEnums(v.MapIndex(k), fmt.Sprintf("%s[%v]", path, k.Interface())); err != nil {
+                return err
+            }
+        }
+    case reflect.Slice:
+        if v.Type().Elem().Kind() == reflect.Uint8 {
+            return nil
+        }
+        for i := 0; i < v.Len(); i++ {
+            if err := checkEnums(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+                return err
+            }
+        }
+    default:
+        if isEnum(v) && fmt.Sprint(v.Interface()) == strconv.FormatInt(v.Int(), 10) {
+            return fmt.Errorf("unknown value %d of %s for field %s", v.Int(), v.Type().Name(), path)
+        }
+    }
+    return nil
+}
+
+// isEnum reports whether v is an enum value, the String method of which
+// returns the name of the value, or its number if unknown to the enum.
+func isEnum(v reflect.Value) bool {
+    if v.Kind() != reflect.Int32 || !v.CanInterface() {
+        return false
+    }
+    _, ok := v.Interface().(fmt.Stringer)
+    return ok
+}
@@ -0,0 +1,362 @@
+package httprpc
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+)
+
+// A PathTemplate is a parsed google.api.http path template, such as
+// "/v1/{name=shelves/*}/books:get".
+type PathTemplate struct {
+    segments  []segment
+    verb      string
+    Variables []string // field paths of the variables, in order
+}
+
+// segment is a segment of a path template: a literal, "*" or "**", part
+// of the variable named varName, if any.
+type segment struct {
+    literal string
+    varName string
+}
+
+// ParsePathTemplate parses a google.api.http path template:
+//
+//    Template = "/" Segments [ Verb ] ;
+//    Segments = Segment { "/" Segment } ;
+//    Segment  = "*" | "**" | LITERAL | Variable ;
+//    Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//    FieldPath = IDENT { "." IDENT } ;
+//    Verb     = ":" LITERAL ;
+func ParsePathTemplate(tmpl string) (*PathTemplate, error) {
+    if !strings.HasPrefix(tmpl, "/") {
+        return nil, fmt.Errorf("path template %q does not start with /", tmpl)
+    }
+    t := new(PathTemplate)
+    rest := tmpl[1:]
+    // The verb follows the last segment, outside of any variable.
+    if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.Contains(rest[i:], "}") && !strings.Contains(rest[i:], "/") {
+        rest, t.verb = rest[:i], rest[i+1:]
+    }
+    for rest != "" {
+        var seg string
+        if rest[0] == '{' {
+            end := strings.Index(rest, "}")
+            if end < 0 {
+                return nil, fmt.Errorf("path template %q: unterminated variable", tmpl)
+            }
+            seg, rest = rest[1:end], rest[end+1:]
+            name, sub := seg, "*"
+            if i := strings.Index(seg, "="); i >= 0 {
+                name, sub = seg[:i], seg[i+1:]
+            }
+            if name == "" || strings.ContainsAny(name, "{/*") {
+                return nil, fmt.Errorf("path template %q: invalid variable %q", tmpl, seg)
+            }
+            for _, s := range strings.Split(sub, "/") {
+                if s == "" || strings.ContainsAny(s, "{}=") {
+                    return nil, fmt.Errorf("path template %q: invalid variable %q", tmpl, seg)
+                }
+                t.segments = append(t.segments, segment{literal: s, varName: name})
+            }
+            t.Variables = append(t.Variables, name)
+        } else {
+            end := strings.Index(rest, "/")
+            if end < 0 {
+                end = len(rest)
+            }
+            seg, rest = rest[:end], rest[end:]
+            if seg == "" || strings.ContainsAny(seg, "{}=") {
+                return nil, fmt.Errorf("path template %q: invalid segment %q", tmpl, seg)
+            }
+            t.segments = append(t.segments, segment{literal: seg})
+        }
+        if rest == "" {
+            break
+        }
+        if rest[0] != '/' || len(rest) == 1 {
+            return nil, fmt.Errorf("path template %q: invalid segment separator", tmpl)
+        }
+        rest = rest[1:]
+    }
+    for i, s := range t.segments {
+        if s.literal == "**" && i != len(t.segments)-1 {
+            return nil, fmt.Errorf("path template %q: ** must be the last segment", tmpl)
+        }
+    }
+    return t, nil
+}
+
+// Match matches the escaped path p against the template, and returns the
+// unescaped values of the variables.
+func (t *PathTemplate) Match(p string) (map[string]string, bool) {
+    if !strings.HasPrefix(p, "/") {
+        return nil, false
+    }
+    p = p[1:]
+    if t.verb != "" {
+        if !strings.HasSuffix(p, ":"+t.verb) {
+            return nil, false
+        }
+        p = strings.TrimSuffix(p, ":"+t.verb)
+    }
+    parts := strings.Split(p, "/")
+    captured := make(map[string][]string)
+    for i, s := range t.segments {
+        switch {
+        case s.literal == "**":
+            // The last segment matches the remaining ones, if any.
+            if i < len(parts) {
+                captured[s.varName] = append(captured[s.varName], parts[i:]...)
+            }
+            parts = append(parts[:i:i], "")
+        case i >= len(parts):
+            return nil, false
+        case s.literal == "*":
+            if parts[i] == "" {
+                return nil, false
+            }
+            captured[s.varName] = append(captured[s.varName], parts[i])
+        default:
+            if parts[i] != s.literal {
+                return nil, false
+            }
+            captured[s.varName] = append(captured[s.varName], parts[i])
+        }
+    }
+    if len(parts) != len(t.segments) {
+        return nil, false
+    }
+    vars := make(map[string]string)
+    for _, name := range t.Variables {
+        values := captured[name]
+        for i, v := range values {
+            if len(values) == 1 {
+                // Single segment variables are fully unescaped, slashes included.
+                v, _ = url.PathUnescape(v)
+            } else if u, err := url.PathUnescape(strings.Replace(v, "%2F", "%252F", -1)); err == nil {
+                v = u
+            }
+            values[i] = v
+        }
+        vars[name] = strings.Join(values, "/")
+    }
+    return vars, true
+}
+
+// GatewayHandler handles the requests matching a route of a Gateway,
+// given the values of the variables of its path template.
+type GatewayHandler func(w http.ResponseWriter, r *http.Request, vars map[string]string)
+
+// route is a route of a Gateway.
+type route struct {
+    method   string
+    template *PathTemplate
+    handler  GatewayHandler
+}
+
+// Gateway is an http.Handler routing requests by method and path template,
+// as mapped by google.api.http options. Routes are matched in the order
+// they were added.
+type Gateway struct {
+    routes []route
+}
+
+// Handle adds a route for requests with the given HTTP method matching the
+// path template pattern. It panics if pattern is invalid.
+func (g *Gateway) Handle(method, pattern string, h GatewayHandler) {
+    t, err := ParsePathTemplate(pattern)
+    if err != nil {
+        panic("httprpc: " + err.Error())
+    }
+    g.routes = append(g.routes, route{method, t, h})
+}
+
+// ServeHTTP calls the handler of the first route matching r.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    var allowed []string
+    for _, rt := range g.routes {
+        vars, ok := rt.template.Match(r.URL.EscapedPath())
+        if !ok {
+            continue
+        }
+        if rt.method != r.Method {
+            allowed = append(allowed, rt.method)
+            continue
+        }
+        rt.handler(w, r, vars)
+        return
+    }
+    if len(allowed) > 0 {
+        w.Header().Set("Allow", strings.Join(allowed, ", "))
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    http.NotFound(w, r)
+}
+
+// FieldKind is the kind of the JSON value of a field bound from a path
+// variable or a query parameter.
+type FieldKind int
+
+// The field kinds. Numbers include enums, which may be given by name.
+const (
+    StringField FieldKind = iota
+    NumberField
+    BoolField
+)
+
+// Field describes a field of a request message, by its field path, which
+// path variables and query parameters can set.
+type Field struct {
+    Kind     FieldKind
+    Repeated bool
+}
+
+// BindRequest returns the JSON mapping of the request message of r, as
+// mapped by a google.api.http option: body is the field set from the JSON
+// request body, "*" for the whole message, or "" for no body; vars are the
+// values of the variables of the path template; and the query parameters
+// set the fields of fields not set otherwise. Errors are *Error with the
+// InvalidArgument code.
+func BindRequest(r *http.Request, body string, vars map[string]string, fields map[string]Field) ([]byte, error) {
+    obj := make(map[string]interface{})
+    if body != "" {
+        var v interface{}
+        dec := json.NewDecoder(r.Body)
+        dec.UseNumber()
+        if err := dec.Decode(&v); err != nil {
+            return nil, Errorf(InvalidArgument, "invalid request body: %v", err)
+        }
+        if body == "*" {
+            m, ok := v.(map[string]interface{})
+            if !ok {
+                return nil, Errorf(InvalidArgument, "the request body is not a JSON object")
+            }
+            obj = m
+        } else if err := setPath(obj, body, v); err != nil {
+            return nil, err
+        }
+    }
+    if body != "*" {
+        for key, values := range r.URL.Query() {
+            f, ok := fields[key]
+            if _, isVar := vars[key]; !ok || isVar || body != "" && (key == body || strings.HasPrefix(key, body+".")) {
+                continue
+            }
+            if err := bindField(obj, key, f, values); err != nil {
+                return nil, err
+            }
+        }
+    }
+    for key, value := range vars {
+        f, ok := fields[key]
+        if !ok {
+            return nil, Errorf(InvalidArgument, "no field %s", key)
+        }
+        if err := bindField(obj, key, f, []string{value}); err != nil {
+            return nil, err
+        }
+    }
+    data, err := json.Marshal(obj)
+    if err != nil {
+        return nil, Errorf(InvalidArgument, "invalid request: %v", err)
+    }
+    return data, nil
+}
+
+// bindField sets the field at path in obj to values, converted to JSON
+// values of kind f.
+func bindField(obj map[string]interface{}, path string, f Field, values []string) error {
+    var vs []interface{}
+    for _, s := range values {
+        var v interface{} = s
+        switch f.Kind {
+        case BoolField:
+            b, err := strconv.ParseBool(s)
+            if err != nil {
+                return Errorf(InvalidArgument, "invalid value %q for %s", s, path)
+            }
+            v = b
+        case NumberField:
+            if _, err := strconv.ParseFloat(s, 64); err == nil {
+                v = json.Number(s)
+            }
+        }
+        vs = append(vs, v)
+    }
+    if f.Repeated {
+        return setPath(obj, path, vs)
+    }
+    return setPath(obj, path, vs[len(vs)-1])
+}
+
+// setPath sets the value at the dotted field path of proto names in obj,
+// creating the intermediate objects. Fields found under their JSON name,
+// as a request body may have them, are renamed so that v is not shadowed.
+func setPath(obj map[string]interface{}, path string, v interface{}) error {
+    names := strings.Split(path, ".")
+    for i, name := range names {
+        if camel := lowerCamelCase(name); camel != name {
+            if cv, ok := obj[camel]; ok {
+                obj[name] = cv
+                delete(obj, camel)
+            }
+        }
+        if i == len(names)-1 {
+            break
+        }
+        next, ok := obj[name].(map[string]interface{})
+        if !ok {
+            if obj[name] != nil {
+                return Errorf(InvalidArgument, "%s is not a message", path)
+            }
+            next = make(map[string]interface{})
+            obj[name] = next
+        }
+        obj = next
+    }
+    obj[names[len(names)-1]] = v
+    return nil
+}
+
+// lowerCamelCase returns the default JSON name of the field named name.
+func lowerCamelCase(name string) string {
+    var b []byte
+    upper := false
+    for _, c := range []byte(name) {
+        switch {
+        case c == '_':
+            upper = true
+        case upper && 'a' <= c && c <= 'z':
+            b = append(b, c-'a'+'A')
+            upper = false
+        default:
+            b = append(b, c)
+            upper = false
+        }
+    }
+    return string(b)
+}
+
+// WriteGatewayResponse writes data, the JSON mapping of a response message,
+// or its field whose JSON name is responseBody if not empty, as the response
+// to a request mapped by a google.api.http option.
+func WriteGatewayResponse(w http.ResponseWriter, data []byte, responseBody string) {
+    if responseBody != "" {
+        var fields map[string]json.RawMessage
+        if err := json.Unmarshal(data, &fields); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if data = fields[responseBody]; data == nil {
+            data = []byte("null")
+        }
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Write(data)
+}
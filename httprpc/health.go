@@ -0,0 +1,181 @@
+package httprpc
+
+import (
+    "context"
+    "net/http"
+    "sync"
+
+    "github.com/golang/protobuf/proto"
+)
+
+// HealthPathPrefix is the path prefix of the gRPC health checking service.
+const HealthPathPrefix = "/grpc.health.v1.Health/"
+
+// HealthStatus is the serving status of a service, as reported by the
+// health checking service.
+type HealthStatus int32
+
+// The serving statuses, numbered as in grpc.health.v1.
+const (
+    HealthUnknown        HealthStatus = 0
+    HealthServing        HealthStatus = 1
+    HealthNotServing     HealthStatus = 2
+    HealthServiceUnknown HealthStatus = 3 // only reported by Watch
+)
+
+var healthStatusNames = map[HealthStatus]string{
+    HealthUnknown:        "UNKNOWN",
+    HealthServing:        "SERVING",
+    HealthNotServing:     "NOT_SERVING",
+    HealthServiceUnknown: "SERVICE_UNKNOWN",
+}
+
+// String returns the name of s in grpc.health.v1, e.g. "SERVING".
+func (s HealthStatus) String() string {
+    if name, ok := healthStatusNames[s]; ok {
+        return name
+    }
+    return "UNKNOWN"
+}
+
+// Health is the gRPC health checking service, grpc.health.v1.Health,
+// reporting the serving status of the services registered with it, and
+// that of the server as a whole under the empty service name, serving by
+// default.
+type Health struct {
+    mu       sync.Mutex
+    statuses map[string]HealthStatus
+    changed  chan struct{} // closed and replaced when a status changes
+}
+
+// NewHealth returns a health checking service with the server serving.
+func NewHealth() *Health {
+    return &Health{
+        statuses: map[string]HealthStatus{"": HealthServing},
+        changed:  make(chan struct{}),
+    }
+}
+
+// RegisterService registers the service named name, e.g. "pkg.Service",
+// as serving, unless its status is already set.
+func (h *Health) RegisterService(name string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if _, ok := h.statuses[name]; !ok {
+        h.setLocked(name, HealthServing)
+    }
+}
+
+// SetServingStatus sets the status of the service named name, or of the
+// server as a whole if name is empty.
+func (h *Health) SetServingStatus(name string, status HealthStatus) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.setLocked(name, status)
+}
+
+// Shutdown sets the status of the server and of all the services to not
+// serving, e.g. when the server starts draining its connections.
+func (h *Health) Shutdown() {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    for name := range h.statuses {
+        h.setLocked(name, HealthNotServing)
+    }
+}
+
+// setLocked sets the status of the service named name, notifying the
+// watchers if it changes. h.mu is held.
+func (h *Health) setLocked(name string, status HealthStatus) {
+    if old, ok := h.statuses[name]; ok && old == status {
+        return
+    }
+    h.statuses[name] = status
+    close(h.changed)
+    h.changed = make(chan struct{})
+}
+
+// status returns the status of the service named name, whether it is
+// registered, and a channel closed when a status changes.
+func (h *Health) status(name string) (HealthStatus, bool, <-chan struct{}) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    status, ok := h.statuses[name]
+    return status, ok, h.changed
+}
+
+// Handler returns the handler of the health checking service, to serve
+// along with the services, e.g. by NewServer.
+func (h *Health) Handler() ConnectHandler {
+    return healthHandler{h}
+}
+
+// healthHandler is the handler of a Health.
+type healthHandler struct {
+    h *Health
+}
+
+// PathPrefix returns HealthPathPrefix.
+func (healthHandler) PathPrefix() string { return HealthPathPrefix }
+
+func (h healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+    case HealthPathPrefix + "Check":
+        ServeConnect(w, r, Unary, func(ctx context.Context, c *ServerCall) error {
+            in := new(healthCheckRequest)
+            if err := c.Receive(in); err != nil {
+                return err
+            }
+            status, ok, _ := h.h.status(in.Service)
+            if !ok {
+                return Errorf(NotFound, "unknown service %s", in.Service)
+            }
+            return c.Send(&healthCheckResponse{status})
+        })
+    case HealthPathPrefix + "Watch":
+        ServeConnect(w, r, ServerStream, func(ctx context.Context, c *ServerCall) error {
+            in := new(healthCheckRequest)
+            if err := c.Receive(in); err != nil {
+                return err
+            }
+            last := HealthStatus(-1)
+            for {
+                status, ok, changed := h.h.status(in.Service)
+                if !ok {
+                    status = HealthServiceUnknown
+                }
+                if status != last {
+                    if err := c.Send(&healthCheckResponse{status}); err != nil {
+                        return err
+                    }
+                    last = status
+                }
+                select {
+                case <-changed:
+                case <-ctx.Done():
+                    return Errorf(Canceled, "%v", ctx.Err())
+                }
+            }
+        })
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+// healthCheckRequest is a HealthCheckRequest.
+type healthCheckRequest struct {
+    Service string `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+}
+
+func (m *healthCheckRequest) Reset()         { *m = healthCheckRequest{} }
+func (m *healthCheckRequest) String() string { return proto.CompactTextString(m) }
+func (*healthCheckRequest) ProtoMessage()    {}
+
+// healthCheckResponse is a HealthCheckResponse.
+type healthCheckResponse struct {
+    Status HealthStatus `protobuf:"varint,1,opt,name=status,proto3,enum=grpc.health.v1.HealthCheckResponse_ServingStatus" json:"status,omitempty"`
+}
+
+func (m *healthCheckResponse) Reset()         { *m = healthCheckResponse{} }
+func (m *healthCheckResponse) String() string { return proto.CompactTextString(m) }
+func (*healthCheckResponse) ProtoMessage()    {}
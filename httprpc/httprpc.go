@@ -0,0 +1,113 @@
+// Package httprpc implements the HTTP protocols of the servers and clients
+// generated by the twirp and connect plugins.
+//
+// Errors crossing the wire are *Error values, whose Code is one of the
+// error codes of the protocol; other errors returned by implementations
+// are reported to clients as Internal errors.
+package httprpc
+
+import (
+    "fmt"
+    "net/http"
+)
+
+// Code is an error code, as written on the wire.
+type Code string
+
+// The error codes, shared with gRPC, with their HTTP status.
+const (
+    Canceled           Code = "canceled"            // 408
+    Unknown            Code = "unknown"             // 500
+    InvalidArgument    Code = "invalid_argument"    // 400
+    Malformed          Code = "malformed"           // 400, the request could not be decoded
+    DeadlineExceeded   Code = "deadline_exceeded"   // 408
+    NotFound           Code = "not_found"           // 404
+    BadRoute           Code = "bad_route"           // 404, no method serves the request
+    AlreadyExists      Code = "already_exists"      // 409
+    PermissionDenied   Code = "permission_denied"   // 403
+    Unauthenticated    Code = "unauthenticated"     // 401
+    ResourceExhausted  Code = "resource_exhausted"  // 429
+    FailedPrecondition Code = "failed_precondition" // 412
+    Aborted            Code = "aborted"             // 409
+    OutOfRange         Code = "out_of_range"        // 400
+    Unimplemented      Code = "unimplemented"       // 501
+    Internal           Code = "internal"            // 500
+    Unavailable        Code = "unavailable"         // 503
+    DataLoss           Code = "dataloss"            // 500
+)
+
+var httpStatus = map[Code]int{
+    Canceled:           408,
+    Unknown:            500,
+    InvalidArgument:    400,
+    Malformed:          400,
+    DeadlineExceeded:   408,
+    NotFound:           404,
+    BadRoute:           404,
+    AlreadyExists:      409,
+    PermissionDenied:   403,
+    Unauthenticated:    401,
+    ResourceExhausted:  429,
+    FailedPrecondition: 412,
+    Aborted:            409,
+    OutOfRange:         400,
+    Unimplemented:      501,
+    Internal:           500,
+    Unavailable:        503,
+    DataLoss:           500,
+}
+
+// HTTPStatus returns the HTTP status of the responses reporting an error
+// with code c, 500 for unknown codes.
+func (c Code) HTTPStatus() int {
+    if status, ok := httpStatus[c]; ok {
+        return status
+    }
+    return http.StatusInternalServerError
+}
+
+// statusCode returns the code of an error response with the given HTTP
+// status which does not carry an error, e.g. when it comes from a proxy.
+func statusCode(status int) Code {
+    switch status {
+    case http.StatusBadRequest:
+        return Internal
+    case http.StatusUnauthorized:
+        return Unauthenticated
+    case http.StatusForbidden:
+        return PermissionDenied
+    case http.StatusNotFound:
+        return BadRoute
+    case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+        return Unavailable
+    }
+    return Unknown
+}
+
+// Error is an error sent by a server to its clients.
+type Error struct {
+    Code Code
+    Msg  string
+    Meta map[string]string // optional details
+}
+
+// Errorf returns an error with the given code and formatted message.
+func Errorf(code Code, format string, args ...interface{}) *Error {
+    return &Error{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("httprpc: %s: %s", e.Code, e.Msg)
+}
+
+// ErrorFrom returns err as an *Error: err itself if it is one, an Internal
+// error with the same message otherwise. It returns nil if err is nil.
+func ErrorFrom(err error) *Error {
+    if err == nil {
+        return nil
+    }
+    if e, ok := err.(*Error); ok {
+        return e
+    }
+    return &Error{Code: Internal, Msg: err.Error()}
+}
@@ -0,0 +1,195 @@
+package httprpc
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+
+    "github.com/golang/protobuf/jsonpb"
+    "github.com/golang/protobuf/proto"
+)
+
+// JSONInt64Numbers is implemented by the messages generated with the
+// int64_json=number parameter, whose 64-bit integers are encoded in JSON
+// as numbers, for legacy partners, rather than as strings as the proto3
+// JSON mapping specifies. The JSON encoders of the package honor it.
+type JSONInt64Numbers interface {
+    proto.Message
+    JSONInt64Numbers()
+}
+
+// marshalJSON encodes m as JSON with marshaler, its 64-bit integers as
+// numbers if m implements JSONInt64Numbers, its enums as numbers if it
+// implements JSONEnumNumbers, and its timestamps in the format of m if it
+// implements JSONTimestamps.
+func marshalJSON(marshaler *jsonpb.Marshaler, m proto.Message) ([]byte, error) {
+    if _, ok := m.(JSONEnumNumbers); ok {
+        withNumbers := *marshaler
+        withNumbers.EnumsAsInts = true
+        marshaler = &withNumbers
+    }
+    var b bytes.Buffer
+    if err := marshaler.Marshal(&b, m); err != nil {
+        return nil, err
+    }
+    data := b.Bytes()
+    if _, ok := m.(JSONInt64Numbers); ok {
+        var err error
+        if data, err = Int64Numbers(data, m); err != nil {
+            return nil, err
+        }
+    }
+    if ts, ok := m.(JSONTimestamps); ok {
+        format, zone := ts.JSONTimestampFormat()
+        return FormatTimestamps(data, m, format, zone)
+    }
+    return data, nil
+}
+
+// Int64Numbers returns the JSON encoding of the message m in data, of
+// either protobuf runtime, with its 64-bit integers, encoded as strings,
+// replaced by numbers. Both encodings are accepted by the JSON decoders.
+func Int64Numbers(data []byte, m interface{}) ([]byte, error) {
+    out, err := int64Numbers(data, reflect.ValueOf(m))
+    if err != nil {
+        return nil, fmt.Errorf("invalid JSON encoding of %T: %v", m, err)
+    }
+    return out, nil
+}
+
+// int64Numbers returns the JSON value data, encoding v, with its 64-bit
+// integers as numbers.
+func int64Numbers(data json.RawMessage, v reflect.Value) (json.RawMessage, error) {
+    return rewriteScalars(data, v, func(data json.RawMessage, v reflect.Value) (json.RawMessage, error) {
+        if v.Kind() != reflect.Int64 && v.Kind() != reflect.Uint64 || len(data) == 0 || data[0] != '"' {
+            return data, nil
+        }
+        s, err := strconv.Unquote(string(data))
+        if err == nil && v.Kind() == reflect.Int64 {
+            _, err = strconv.ParseInt(s, 10, 64)
+        } else if err == nil {
+            _, err = strconv.ParseUint(s, 10, 64)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("invalid 64-bit integer %s", data)
+        }
+        return json.RawMessage(s), nil
+    })
+}
+
+// rewriteScalars returns the JSON value data, encoding v, with the value of
+// every scalar of v replaced by the result of rewrite, given the scalar.
+func rewriteScalars(data json.RawMessage, v reflect.Value, rewrite func(data json.RawMessage, v reflect.Value) (json.RawMessage, error)) (json.RawMessage, error) {
+    switch v.Kind() {
+    case reflect.Ptr:
+        if v.IsNil() {
+            return data, nil
+        }
+        if name := v.Elem().Type().Name(); name == "Int64Value" || name == "UInt64Value" {
+            // The wrappers are encoded as their value.
+            if f := v.Elem().FieldByName("Value"); f.IsValid() {
+                return rewriteScalars(data, f, rewrite)
+            }
+        }
+        return rewriteScalars(data, v.Elem(), rewrite)
+    case reflect.Struct:
+        fields := messageFields(v)
+        return rewriteObject(data, func(key string, value json.RawMessage) (json.RawMessage, error) {
+            if f, ok := fields[key]; ok {
+                return rewriteScalars(value, f, rewrite)
+            }
+            return value, nil
+        })
+    case reflect.Map:
+        values := make(map[string]reflect.Value, v.Len())
+        for _, k := range v.MapKeys() {
+            values[fmt.Sprint(k.Interface())] = v.MapIndex(k)
+        }
+        return rewriteObject(data, func(key string, value json.RawMessage) (json.RawMessage, error) {
+            if f, ok := values[key]; ok {
+                return rewriteScalars(value, f, rewrite)
+            }
+            return value, nil
+        })
+    case reflect.Slice:
+        if v.Type().Elem().Kind() == reflect.Uint8 {
+            return data, nil
+        }
+        var elems []json.RawMessage
+        if err := json.Unmarshal(data, &elems); err != nil || len(elems) != v.Len() {
+            // Not a list of the elements of v, such as a well-known type.
+            return data, nil
+        }
+        for i := range elems {
+            elem, err := rewriteScalars(elems[i], v.Index(i), rewrite)
+            if err != nil {
+                return nil, err
+            }
+            elems[i] = elem
+        }
+        return json.Marshal(elems)
+    }
+    return rewrite(data, v)
+}
+
+// messageFields returns the fields of the message struct v by JSON name,
+// original and lowerCamelCase, the fields of its oneofs included.
+func messageFields(v reflect.Value) map[string]reflect.Value {
+    fields := make(map[string]reflect.Value)
+    for i := 0; i < v.NumField(); i++ {
+        f, sf := v.Field(i), v.Type().Field(i)
+        if sf.Tag.Get("protobuf_oneof") != "" {
+            if f.IsNil() || f.Elem().Kind() != reflect.Ptr || f.Elem().IsNil() {
+                continue
+            }
+            // The value of a oneof is the single field of its wrapper.
+            f, sf = f.Elem().Elem().Field(0), f.Elem().Elem().Type().Field(0)
+        }
+        for _, opt := range strings.Split(sf.Tag.Get("protobuf"), ",") {
+            if strings.HasPrefix(opt, "name=") || strings.HasPrefix(opt, "json=") {
+                name := opt[len("name="):]
+                fields[name] = f
+                fields[lowerCamelCase(name)] = f
+            }
+        }
+    }
+    return fields
+}
+
+// rewriteObject returns the JSON object data with the value of every field
+// replaced by the result of rewrite, in the same order. Values other than
+// objects, such as the ones of the well-known types, are returned as is.
+func rewriteObject(data json.RawMessage, rewrite func(key string, value json.RawMessage) (json.RawMessage, error)) (json.RawMessage, error) {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+        return data, nil
+    }
+    var b bytes.Buffer
+    b.WriteByte('{')
+    for dec.More() {
+        tok, err := dec.Token()
+        if err != nil {
+            return nil, err
+        }
+        key, _ := tok.(string)
+        var value json.RawMessage
+        if err := dec.Decode(&value); err != nil {
+            return nil, err
+        }
+        if value, err = rewrite(key, value); err != nil {
+            return nil, err
+        }
+        if b.Len() > 1 {
+            b.WriteByte(',')
+        }
+        k, _ := json.Marshal(key)
+        b.Write(k)
+        b.WriteByte(':')
+        b.Write(value)
+    }
+    b.WriteByte('}')
+    return b.Bytes(), nil
+}
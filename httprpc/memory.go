@@ -0,0 +1,82 @@
+package httprpc
+
+import (
+    "context"
+    "errors"
+    "net"
+    "net/http"
+    "sync"
+)
+
+// TB is the part of testing.TB used by the generated test servers, so
+// that they do not import the testing package into the programs.
+type TB interface {
+    Helper()
+    Errorf(format string, args ...interface{})
+}
+
+// errListenerClosed is returned by the operations on a closed MemoryListener.
+var errListenerClosed = errors.New("httprpc: memory listener closed")
+
+// MemoryListener is a net.Listener of in-memory connections, dialed by its
+// Dial method, for tests exercising servers without networking.
+type MemoryListener struct {
+    conns     chan net.Conn
+    closed    chan struct{}
+    closeOnce sync.Once
+}
+
+// NewMemoryListener returns a new MemoryListener.
+func NewMemoryListener() *MemoryListener {
+    return &MemoryListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+// Accept waits for and returns the next connection dialed.
+func (l *MemoryListener) Accept() (net.Conn, error) {
+    select {
+    case c := <-l.conns:
+        return c, nil
+    case <-l.closed:
+        return nil, errListenerClosed
+    }
+}
+
+// Close closes the listener. The connections accepted are not closed.
+func (l *MemoryListener) Close() error {
+    l.closeOnce.Do(func() { close(l.closed) })
+    return nil
+}
+
+// Addr returns the address of the listener, "memory".
+func (l *MemoryListener) Addr() net.Addr {
+    return memoryAddr{}
+}
+
+// Dial returns a new connection to the listener, once accepted.
+func (l *MemoryListener) Dial(ctx context.Context) (net.Conn, error) {
+    client, server := net.Pipe()
+    select {
+    case l.conns <- server:
+        return client, nil
+    case <-l.closed:
+        return nil, errListenerClosed
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+// Client returns an HTTP client whose connections are dialed to the
+// listener, whatever the address of the requests.
+func (l *MemoryListener) Client() *http.Client {
+    return &http.Client{Transport: &http.Transport{
+        DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+            return l.Dial(ctx)
+        },
+    }}
+}
+
+// memoryAddr is the address of a MemoryListener.
+type memoryAddr struct{}
+
+func (memoryAddr) Network() string { return "memory" }
+func (memoryAddr) String() string  { return "memory" }
@@ -0,0 +1,75 @@
+package httprpc
+
+import (
+    "context"
+    "net/http"
+)
+
+// QuotaManager enforces the quotas of the callers of the methods having a
+// (quota.cost) option, charged by the generated handlers before the methods
+// run.
+type QuotaManager interface {
+    // Charge charges cost to the quota of principal. The call fails if it
+    // returns an error, with the ResourceExhausted code if it is not an
+    // *Error.
+    Charge(ctx context.Context, principal string, cost int64) error
+}
+
+// quotaManagerKey and principalKey are the context keys of the
+// QuotaManager of the calls and of their principal.
+type (
+    quotaManagerKey struct{}
+    principalKey    struct{}
+)
+
+// WithQuotaManager returns a copy of ctx carrying manager, charged for the
+// calls served with it.
+func WithQuotaManager(ctx context.Context, manager QuotaManager) context.Context {
+    return context.WithValue(ctx, quotaManagerKey{}, manager)
+}
+
+// WithPrincipal returns a copy of ctx carrying principal, the caller whose
+// quota is charged for the calls served with it, as set by the
+// authentication of the calls.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+    return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Principal returns the principal carried by ctx, or "" if it has none.
+func Principal(ctx context.Context) string {
+    principal, _ := ctx.Value(principalKey{}).(string)
+    return principal
+}
+
+// ChargeQuota charges cost to the quota of the principal of ctx with the
+// QuotaManager of ctx, if any, before a method of that cost runs.
+func ChargeQuota(ctx context.Context, cost int64) error {
+    manager, ok := ctx.Value(quotaManagerKey{}).(QuotaManager)
+    if !ok || manager == nil {
+        return nil
+    }
+    if err := manager.Charge(ctx, Principal(ctx), cost); err != nil {
+        if _, ok := err.(*Error); !ok {
+            err = Errorf(ResourceExhausted, "%v", err)
+        }
+        return err
+    }
+    return nil
+}
+
+// Quota returns an interceptor serving the calls with manager, charged
+// by the Connect handlers for the methods having a quota cost.
+func Quota(manager QuotaManager) ConnectInterceptor {
+    return func(ctx context.Context, c *ServerCall, next func(ctx context.Context) error) error {
+        return next(WithQuotaManager(ctx, manager))
+    }
+}
+
+// QuotaHandler returns a handler serving the requests with h and manager,
+// charged by the Twirp servers, and the handlers of the grpcserial stubs,
+// for the methods having a quota cost.
+func QuotaHandler(manager QuotaManager, h http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        h.ServeHTTP(w, r.WithContext(WithQuotaManager(r.Context(), manager)))
+    })
+}
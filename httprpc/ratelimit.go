@@ -0,0 +1,115 @@
+package httprpc
+
+import (
+    "context"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// RateLimit is the rate limit of the calls of a method, as given by its
+// (ratelimit.rate) and (ratelimit.burst) options.
+type RateLimit struct {
+    Rate  float64 // calls per second, on average
+    Burst int     // calls allowed at once, above the rate
+}
+
+// RateLimiter limits the rate of the calls of the methods having a
+// (ratelimit.rate) option, checked by the generated handlers before the
+// requests are read. Distributed limiters implement it to share the limits
+// between the replicas of a server.
+type RateLimiter interface {
+    // Allow returns nil if a call of procedure, e.g. "/pkg.Service/Method",
+    // may run within limit, and an error otherwise. The call fails with
+    // the error, with the ResourceExhausted code if it is not an *Error.
+    Allow(ctx context.Context, procedure string, limit RateLimit) error
+}
+
+// TokenBuckets is the in-process RateLimiter, limiting the calls of every
+// procedure with a token bucket holding up to limit.Burst tokens, refilled
+// at limit.Rate tokens per second, of which every call takes one. The
+// limits are shared by all the callers.
+type TokenBuckets struct {
+    mu      sync.Mutex
+    buckets map[string]*tokenBucket
+}
+
+// tokenBucket is the token bucket of a procedure.
+type tokenBucket struct {
+    tokens float64
+    last   time.Time // time of the last refill
+}
+
+// NewTokenBuckets returns a TokenBuckets whose buckets start full.
+func NewTokenBuckets() *TokenBuckets {
+    return &TokenBuckets{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow takes a token from the bucket of procedure, and returns a
+// ResourceExhausted error if it is empty.
+func (b *TokenBuckets) Allow(ctx context.Context, procedure string, limit RateLimit) error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    now := time.Now()
+    bucket, ok := b.buckets[procedure]
+    if !ok {
+        bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+        b.buckets[procedure] = bucket
+    }
+    bucket.tokens += now.Sub(bucket.last).Seconds() * limit.Rate
+    if bucket.tokens > float64(limit.Burst) {
+        bucket.tokens = float64(limit.Burst)
+    }
+    bucket.last = now
+    if bucket.tokens < 1 {
+        return Errorf(ResourceExhausted, "rate limit of %s exceeded: %g calls per second", procedure, limit.Rate)
+    }
+    bucket.tokens--
+    return nil
+}
+
+// localLimiter is the RateLimiter of the calls served without one.
+var localLimiter = NewTokenBuckets()
+
+// rateLimiterKey is the context key of the RateLimiter of the calls.
+type rateLimiterKey struct{}
+
+// WithRateLimiter returns a copy of ctx carrying limiter, checked for the
+// calls served with it instead of the in-process token buckets.
+func WithRateLimiter(ctx context.Context, limiter RateLimiter) context.Context {
+    return context.WithValue(ctx, rateLimiterKey{}, limiter)
+}
+
+// CheckRateLimit checks the call of procedure made with ctx against limit
+// with the RateLimiter of ctx, or the in-process TokenBuckets if it has
+// none, before a method with that limit runs.
+func CheckRateLimit(ctx context.Context, procedure string, limit RateLimit) error {
+    limiter, ok := ctx.Value(rateLimiterKey{}).(RateLimiter)
+    if !ok || limiter == nil {
+        limiter = localLimiter
+    }
+    if err := limiter.Allow(ctx, procedure, limit); err != nil {
+        if _, ok := err.(*Error); !ok {
+            err = Errorf(ResourceExhausted, "%v", err)
+        }
+        return err
+    }
+    return nil
+}
+
+// RateLimiting returns an interceptor serving the calls with limiter,
+// checked by the Connect handlers for the methods having a rate limit.
+func RateLimiting(limiter RateLimiter) ConnectInterceptor {
+    return func(ctx context.Context, c *ServerCall, next func(ctx context.Context) error) error {
+        return next(WithRateLimiter(ctx, limiter))
+    }
+}
+
+// RateLimiterHandler returns a handler serving the requests with h and
+// limiter, checked by the Twirp servers for the methods having a rate
+// limit.
+func RateLimiterHandler(limiter RateLimiter, h http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        h.ServeHTTP(w, r.WithContext(WithRateLimiter(r.Context(), limiter)))
+    })
+}
@@ -0,0 +1,348 @@
+package httprpc
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/lleveque/protoc-gen-go/descregistry"
+)
+
+// The path prefixes of the versions of the gRPC server reflection service.
+const (
+    ReflectionV1PathPrefix      = "/grpc.reflection.v1.ServerReflection/"
+    ReflectionV1AlphaPathPrefix = "/grpc.reflection.v1alpha.ServerReflection/"
+)
+
+// Reflection is the gRPC server reflection service of the services
+// registered with it, serving the descriptors of their files and of the
+// files these import, so that grpcurl and friends can call the server
+// without its .proto files. The descriptors are those the generated code
+// registers with proto.RegisterFile.
+type Reflection struct {
+    mu       sync.Mutex
+    services map[string]string // the files of the services, by full name
+}
+
+// NewReflection returns a reflection service without services.
+func NewReflection() *Reflection {
+    return &Reflection{services: make(map[string]string)}
+}
+
+// RegisterService registers the service named name, e.g. "pkg.Service",
+// declared in the file named file, e.g. "pkg/service.proto".
+func (r *Reflection) RegisterService(name, file string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.services[name] = file
+}
+
+// Handlers returns the handlers of the v1 and v1alpha versions of the
+// reflection service, to serve along with the services, e.g. by NewServer.
+func (r *Reflection) Handlers() []ConnectHandler {
+    return []ConnectHandler{
+        &reflectionHandler{r, ReflectionV1PathPrefix},
+        &reflectionHandler{r, ReflectionV1AlphaPathPrefix},
+    }
+}
+
+// reflectionHandler is the handler of a version of the reflection service.
+type reflectionHandler struct {
+    r          *Reflection
+    pathPrefix string
+}
+
+// PathPrefix returns the path prefix of the version of the service.
+func (h *reflectionHandler) PathPrefix() string { return h.pathPrefix }
+
+func (h *reflectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path != h.pathPrefix+"ServerReflectionInfo" {
+        http.NotFound(w, r)
+        return
+    }
+    ServeConnect(w, r, BidiStream, func(ctx context.Context, c *ServerCall) error {
+        index, err := h.r.index()
+        if err != nil {
+            return err
+        }
+        for {
+            in := new(reflectionRequest)
+            if err := c.Receive(in); err == io.EOF {
+                return nil
+            } else if err != nil {
+                return err
+            }
+            if err := c.Send(index.respond(in)); err != nil {
+                return err
+            }
+        }
+    })
+}
+
+// reflectionIndex indexes the files of the services of a Reflection, and
+// the files they import.
+type reflectionIndex struct {
+    services   []string // sorted
+    files      map[string]*pb.FileDescriptorProto
+    symbols    map[string]string           // the files of the symbols, by full name
+    extensions map[string]map[int32]string // the files of the extensions, by extendee and number
+}
+
+// index returns the index of the files of the services of r.
+func (r *Reflection) index() (*reflectionIndex, error) {
+    r.mu.Lock()
+    services := make(map[string]string, len(r.services))
+    for name, file := range r.services {
+        services[name] = file
+    }
+    r.mu.Unlock()
+
+    index := &reflectionIndex{
+        files:      make(map[string]*pb.FileDescriptorProto),
+        symbols:    make(map[string]string),
+        extensions: make(map[string]map[int32]string),
+    }
+    for name, file := range services {
+        index.services = append(index.services, name)
+        if err := index.addFile(file); err != nil {
+            return nil, err
+        }
+    }
+    sort.Strings(index.services)
+    return index, nil
+}
+
+// addFile indexes the file named name and the files it imports.
+func (x *reflectionIndex) addFile(name string) error {
+    if x.files[name] != nil {
+        return nil
+    }
+    fd, err := descregistry.FileDescriptor(name)
+    if err != nil {
+        return Errorf(Internal, "%v", err)
+    }
+    x.files[name] = fd
+    prefix := ""
+    if fd.GetPackage() != "" {
+        prefix = fd.GetPackage() + "."
+    }
+    for _, msg := range fd.MessageType {
+        x.addMessage(name, prefix, msg)
+    }
+    for _, enum := range fd.EnumType {
+        x.addEnum(name, prefix, enum)
+    }
+    for _, ext := range fd.Extension {
+        x.addExtension(name, prefix, ext)
+    }
+    for _, service := range fd.Service {
+        x.symbols[prefix+service.GetName()] = name
+        for _, method := range service.Method {
+            x.symbols[prefix+service.GetName()+"."+method.GetName()] = name
+        }
+    }
+    for _, dep := range fd.Dependency {
+        if err := x.addFile(dep); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// addMessage indexes msg, declared with the name prefix in the file name,
+// with its fields and nested types.
+func (x *reflectionIndex) addMessage(name, prefix string, msg *pb.DescriptorProto) {
+    fullName := prefix + msg.GetName()
+    x.symbols[fullName] = name
+    for _, field := range msg.Field {
+        x.symbols[fullName+"."+field.GetName()] = name
+    }
+    for _, oneof := range msg.OneofDecl {
+        x.symbols[fullName+"."+oneof.GetName()] = name
+    }
+    for _, nested := range msg.NestedType {
+        x.addMessage(name, fullName+".", nested)
+    }
+    for _, enum := range msg.EnumType {
+        x.addEnum(name, fullName+".", enum)
+    }
+    for _, ext := range msg.Extension {
+        x.addExtension(name, fullName+".", ext)
+    }
+}
+
+// addEnum indexes enum, declared with the name prefix in the file name, with
+// its values, which are siblings of the enum.
+func (x *reflectionIndex) addEnum(name, prefix string, enum *pb.EnumDescriptorProto) {
+    x.symbols[prefix+enum.GetName()] = name
+    for _, value := range enum.Value {
+        x.symbols[prefix+value.GetName()] = name
+    }
+}
+
+// addExtension indexes ext, declared with the name prefix in the file name.
+func (x *reflectionIndex) addExtension(name, prefix string, ext *pb.FieldDescriptorProto) {
+    x.symbols[prefix+ext.GetName()] = name
+    extendee := strings.TrimPrefix(ext.GetExtendee(), ".")
+    if x.extensions[extendee] == nil {
+        x.extensions[extendee] = make(map[int32]string)
+    }
+    x.extensions[extendee][ext.GetNumber()] = name
+}
+
+// respond returns the response to the request in.
+func (x *reflectionIndex) respond(in *reflectionRequest) *reflectionResponse {
+    out := &reflectionResponse{ValidHost: in.Host, OriginalRequest: in}
+    switch {
+    case in.FileByFilename != nil:
+        x.respondFile(out, *in.FileByFilename, "file "+*in.FileByFilename)
+    case in.FileContainingSymbol != nil:
+        x.respondFile(out, x.symbols[*in.FileContainingSymbol], "symbol "+*in.FileContainingSymbol)
+    case in.FileContainingExtension != nil:
+        ext := in.FileContainingExtension
+        x.respondFile(out, x.extensions[ext.ContainingType][ext.ExtensionNumber], fmt.Sprintf("extension %d of %s", ext.ExtensionNumber, ext.ContainingType))
+    case in.AllExtensionNumbersOfType != nil:
+        typ := *in.AllExtensionNumbersOfType
+        if _, ok := x.symbols[typ]; !ok {
+            out.ErrorResponse = &reflectionError{int32(grpcCodes[NotFound]), "type " + typ + " not found"}
+            break
+        }
+        numbers := &reflectionExtensionNumbers{BaseTypeName: typ}
+        for n := range x.extensions[typ] {
+            numbers.ExtensionNumber = append(numbers.ExtensionNumber, n)
+        }
+        sort.Slice(numbers.ExtensionNumber, func(i, j int) bool { return numbers.ExtensionNumber[i] < numbers.ExtensionNumber[j] })
+        out.AllExtensionNumbersResponse = numbers
+    case in.ListServices != nil:
+        services := new(reflectionServices)
+        for _, name := range x.services {
+            services.Service = append(services.Service, &reflectionService{name})
+        }
+        out.ListServicesResponse = services
+    default:
+        out.ErrorResponse = &reflectionError{int32(grpcCodes[Unimplemented]), "unsupported request"}
+    }
+    return out
+}
+
+// respondFile sets the response out to the serialized descriptor of the
+// file named name, followed by those of the files it imports, transitively,
+// or to a not found error about what if the file is not indexed.
+func (x *reflectionIndex) respondFile(out *reflectionResponse, name, what string) {
+    if x.files[name] == nil {
+        out.ErrorResponse = &reflectionError{int32(grpcCodes[NotFound]), what + " not found"}
+        return
+    }
+    files := new(reflectionFileDescriptors)
+    seen := make(map[string]bool)
+    var add func(name string)
+    add = func(name string) {
+        if seen[name] {
+            return
+        }
+        seen[name] = true
+        fd := x.files[name]
+        if data, err := proto.Marshal(fd); err == nil {
+            files.FileDescriptorProto = append(files.FileDescriptorProto, data)
+        }
+        for _, dep := range fd.Dependency {
+            add(dep)
+        }
+    }
+    add(name)
+    out.FileDescriptorResponse = files
+}
+
+// reflectionRequest is a ServerReflectionRequest of both versions of the
+// reflection service, its fields after Host being the cases of its
+// message_request oneof.
+type reflectionRequest struct {
+    Host                      string                      `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+    FileByFilename            *string                     `protobuf:"bytes,3,opt,name=file_by_filename,json=fileByFilename" json:"file_by_filename,omitempty"`
+    FileContainingSymbol      *string                     `protobuf:"bytes,4,opt,name=file_containing_symbol,json=fileContainingSymbol" json:"file_containing_symbol,omitempty"`
+    FileContainingExtension   *reflectionExtensionRequest `protobuf:"bytes,5,opt,name=file_containing_extension,json=fileContainingExtension" json:"file_containing_extension,omitempty"`
+    AllExtensionNumbersOfType *string                     `protobuf:"bytes,6,opt,name=all_extension_numbers_of_type,json=allExtensionNumbersOfType" json:"all_extension_numbers_of_type,omitempty"`
+    ListServices              *string                     `protobuf:"bytes,7,opt,name=list_services,json=listServices" json:"list_services,omitempty"`
+}
+
+func (m *reflectionRequest) Reset()         { *m = reflectionRequest{} }
+func (m *reflectionRequest) String() string { return proto.CompactTextString(m) }
+func (*reflectionRequest) ProtoMessage()    {}
+
+// reflectionExtensionRequest is an ExtensionRequest.
+type reflectionExtensionRequest struct {
+    ContainingType  string `protobuf:"bytes,1,opt,name=containing_type,json=containingType,proto3" json:"containing_type,omitempty"`
+    ExtensionNumber int32  `protobuf:"varint,2,opt,name=extension_number,json=extensionNumber,proto3" json:"extension_number,omitempty"`
+}
+
+func (m *reflectionExtensionRequest) Reset()         { *m = reflectionExtensionRequest{} }
+func (m *reflectionExtensionRequest) String() string { return proto.CompactTextString(m) }
+func (*reflectionExtensionRequest) ProtoMessage()    {}
+
+// reflectionResponse is a ServerReflectionResponse, its fields after
+// OriginalRequest being the cases of its message_response oneof.
+type reflectionResponse struct {
+    ValidHost                   string                      `protobuf:"bytes,1,opt,name=valid_host,json=validHost,proto3" json:"valid_host,omitempty"`
+    OriginalRequest             *reflectionRequest          `protobuf:"bytes,2,opt,name=original_request,json=originalRequest" json:"original_request,omitempty"`
+    FileDescriptorResponse      *reflectionFileDescriptors  `protobuf:"bytes,4,opt,name=file_descriptor_response,json=fileDescriptorResponse" json:"file_descriptor_response,omitempty"`
+    AllExtensionNumbersResponse *reflectionExtensionNumbers `protobuf:"bytes,5,opt,name=all_extension_numbers_response,json=allExtensionNumbersResponse" json:"all_extension_numbers_response,omitempty"`
+    ListServicesResponse        *reflectionServices         `protobuf:"bytes,6,opt,name=list_services_response,json=listServicesResponse" json:"list_services_response,omitempty"`
+    ErrorResponse               *reflectionError            `protobuf:"bytes,7,opt,name=error_response,json=errorResponse" json:"error_response,omitempty"`
+}
+
+func (m *reflectionResponse) Reset()         { *m = reflectionResponse{} }
+func (m *reflectionResponse) String() string { return proto.CompactTextString(m) }
+func (*reflectionResponse) ProtoMessage()    {}
+
+// reflectionFileDescriptors is a FileDescriptorResponse.
+type reflectionFileDescriptors struct {
+    FileDescriptorProto [][]byte `protobuf:"bytes,1,rep,name=file_descriptor_proto,json=fileDescriptorProto" json:"file_descriptor_proto,omitempty"`
+}
+
+func (m *reflectionFileDescriptors) Reset()         { *m = reflectionFileDescriptors{} }
+func (m *reflectionFileDescriptors) String() string { return proto.CompactTextString(m) }
+func (*reflectionFileDescriptors) ProtoMessage()    {}
+
+// reflectionExtensionNumbers is an ExtensionNumberResponse.
+type reflectionExtensionNumbers struct {
+    BaseTypeName    string  `protobuf:"bytes,1,opt,name=base_type_name,json=baseTypeName,proto3" json:"base_type_name,omitempty"`
+    ExtensionNumber []int32 `protobuf:"varint,2,rep,packed,name=extension_number,json=extensionNumber" json:"extension_number,omitempty"`
+}
+
+func (m *reflectionExtensionNumbers) Reset()         { *m = reflectionExtensionNumbers{} }
+func (m *reflectionExtensionNumbers) String() string { return proto.CompactTextString(m) }
+func (*reflectionExtensionNumbers) ProtoMessage()    {}
+
+// reflectionServices is a ListServiceResponse.
+type reflectionServices struct {
+    Service []*reflectionService `protobuf:"bytes,1,rep,name=service" json:"service,omitempty"`
+}
+
+func (m *reflectionServices) Reset()         { *m = reflectionServices{} }
+func (m *reflectionServices) String() string { return proto.CompactTextString(m) }
+func (*reflectionServices) ProtoMessage()    {}
+
+// reflectionService is a ServiceResponse.
+type reflectionService struct {
+    Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (m *reflectionService) Reset()         { *m = reflectionService{} }
+func (m *reflectionService) String() string { return proto.CompactTextString(m) }
+func (*reflectionService) ProtoMessage()    {}
+
+// reflectionError is an ErrorResponse.
+type reflectionError struct {
+    ErrorCode    int32  `protobuf:"varint,1,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+    ErrorMessage string `protobuf:"bytes,2,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+}
+
+func (m *reflectionError) Reset()         { *m = reflectionError{} }
+func (m *reflectionError) String() string { return proto.CompactTextString(m) }
+func (*reflectionError) ProtoMessage()    {}
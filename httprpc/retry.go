@@ -0,0 +1,76 @@
+package httprpc
+
+import (
+    "context"
+    "math/rand"
+    "strings"
+    "time"
+)
+
+// RetryPolicy is the retry policy of the calls of a method, as given by
+// its (retry.max_attempts), (retry.backoff), (retry.max_backoff) and
+// (retry.retryable_codes) options.
+type RetryPolicy struct {
+    MaxAttempts int           // attempts in total, the first one included
+    Backoff     time.Duration // delay before the first retry, doubled after every retry
+    MaxBackoff  time.Duration // maximum delay between two attempts, or 0 for no maximum
+    Codes       []Code        // codes of the errors retried, Unavailable if empty
+}
+
+// retryable reports whether p retries the calls failed with err.
+func (p RetryPolicy) retryable(err error) bool {
+    code := ErrorFrom(err).Code
+    if len(p.Codes) == 0 {
+        return code == Unavailable
+    }
+    for _, c := range p.Codes {
+        if c == code {
+            return true
+        }
+    }
+    return false
+}
+
+// Retry calls call with ctx until it succeeds, fails with an error whose
+// code p does not retry, or p.MaxAttempts attempts failed, and returns the
+// error of the last attempt. Between the attempts, it waits for the backoff
+// of p, randomized between its half and its whole so that the clients
+// failing together do not retry together, and gives up with the error of
+// ctx if it is done first.
+func Retry(ctx context.Context, p RetryPolicy, call func(ctx context.Context) error) error {
+    backoff := p.Backoff
+    for attempt := 1; ; attempt++ {
+        err := call(ctx)
+        if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+            return err
+        }
+        if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+            backoff = p.MaxBackoff
+        }
+        delay := backoff / 2
+        if backoff > 0 {
+            delay += time.Duration(rand.Int63n(int64(backoff-delay) + 1))
+        }
+        t := time.NewTimer(delay)
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return clientError(ctx, ctx.Err())
+        case <-t.C:
+        }
+        backoff *= 2
+    }
+}
+
+// ParseCode returns the code named name, as written on the wire, e.g.
+// "resource_exhausted", or as the gRPC status code, e.g.
+// "RESOURCE_EXHAUSTED", and whether there is one.
+func ParseCode(name string) (Code, bool) {
+    key := strings.Replace(strings.ToLower(name), "_", "", -1)
+    for code := range httpStatus {
+        if strings.Replace(string(code), "_", "", -1) == key {
+            return code, true
+        }
+    }
+    return "", false
+}
@@ -0,0 +1,183 @@
+package httprpc
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// SchemaPath is the path of the API index served by SchemaHandler, the
+// descriptor set and the OpenAPI documents being served under it.
+const SchemaPath = "/__schema"
+
+// APISchema is the schema of a generated package, registered by the code
+// generated with the liveschema plugin when the package is initialized.
+type APISchema struct {
+    Package string // the protobuf package
+
+    // DescriptorSet is the gzipped FileDescriptorSet of the files of the
+    // package and of the files they import.
+    DescriptorSet []byte
+
+    // OpenAPI maps the files of the package to their OpenAPI document, in
+    // JSON.
+    OpenAPI map[string]string
+
+    Services []APIService
+}
+
+// APIService is a service of an APISchema.
+type APIService struct {
+    Name    string      `json:"name"` // the full name, e.g. "pkg.Service"
+    Methods []APIMethod `json:"methods"`
+}
+
+// APIMethod is a method of an APIService.
+type APIMethod struct {
+    Name            string `json:"name"`
+    Path            string `json:"path"`       // e.g. "/pkg.Service/Method"
+    InputType       string `json:"inputType"`  // the full name of the input message
+    OutputType      string `json:"outputType"` // the full name of the output message
+    ClientStreaming bool   `json:"clientStreaming,omitempty"`
+    ServerStreaming bool   `json:"serverStreaming,omitempty"`
+}
+
+var (
+    apiSchemasMu sync.Mutex
+    apiSchemas   []*APISchema
+)
+
+// RegisterAPISchema registers schema, served by SchemaHandler.
+func RegisterAPISchema(schema *APISchema) {
+    apiSchemasMu.Lock()
+    defer apiSchemasMu.Unlock()
+    apiSchemas = append(apiSchemas, schema)
+}
+
+// APISchemas returns the schemas registered, in the order of registration,
+// which is the order of initialization of their packages: the packages
+// imported first.
+func APISchemas() []*APISchema {
+    apiSchemasMu.Lock()
+    defer apiSchemasMu.Unlock()
+    return append([]*APISchema(nil), apiSchemas...)
+}
+
+// apiIndex is the API index served at SchemaPath.
+type apiIndex struct {
+    DescriptorSet string            `json:"descriptorSet"` // the path of the descriptor set
+    Packages      []apiIndexPackage `json:"packages"`
+}
+
+// apiIndexPackage is a package of an apiIndex.
+type apiIndexPackage struct {
+    Package  string            `json:"package"`
+    OpenAPI  map[string]string `json:"openapi,omitempty"` // the paths of the OpenAPI documents, by file
+    Services []APIService      `json:"services"`
+}
+
+// SchemaHandler returns an http.Handler serving, for the runtime discovery
+// of the APIs by gateways and developer tooling, the schemas registered:
+//
+//    GET /__schema                      the API index of the services and methods, in JSON
+//    GET /__schema/descriptors          the FileDescriptorSet of all the files, serialized
+//    GET /__schema/openapi/<file.proto> the OpenAPI document of a file, in JSON
+//
+// It is mounted with both the SchemaPath and SchemaPath+"/" patterns.
+func SchemaHandler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet && r.Method != http.MethodHead {
+            w.Header().Set("Allow", "GET, HEAD")
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        schemas := APISchemas()
+        switch {
+        case r.URL.Path == SchemaPath:
+            writeAPIIndex(w, schemas)
+        case r.URL.Path == SchemaPath+"/descriptors":
+            set, err := mergeDescriptorSets(schemas)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusInternalServerError)
+                return
+            }
+            w.Header().Set("Content-Type", "application/x-protobuf")
+            w.Write(set)
+        case strings.HasPrefix(r.URL.Path, SchemaPath+"/openapi/"):
+            name := strings.TrimPrefix(r.URL.Path, SchemaPath+"/openapi/")
+            for _, s := range schemas {
+                if doc, ok := s.OpenAPI[name]; ok {
+                    w.Header().Set("Content-Type", "application/json")
+                    w.Write([]byte(doc))
+                    return
+                }
+            }
+            http.NotFound(w, r)
+        default:
+            http.NotFound(w, r)
+        }
+    })
+}
+
+// writeAPIIndex writes the API index of schemas to w.
+func writeAPIIndex(w http.ResponseWriter, schemas []*APISchema) {
+    index := apiIndex{DescriptorSet: SchemaPath + "/descriptors", Packages: []apiIndexPackage{}}
+    for _, s := range schemas {
+        p := apiIndexPackage{Package: s.Package, Services: s.Services}
+        if p.Services == nil {
+            p.Services = []APIService{}
+        }
+        if len(s.OpenAPI) > 0 {
+            p.OpenAPI = make(map[string]string)
+            for name := range s.OpenAPI {
+                p.OpenAPI[name] = SchemaPath + "/openapi/" + name
+            }
+        }
+        index.Packages = append(index.Packages, p)
+    }
+    sort.SliceStable(index.Packages, func(i, j int) bool { return index.Packages[i].Package < index.Packages[j].Package })
+    data, err := json.MarshalIndent(index, "", "  ")
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Write(append(data, '\n'))
+}
+
+// mergeDescriptorSets returns the serialized FileDescriptorSet of the files
+// of the descriptor sets of schemas, each file once. The files are in the
+// order of registration, the files imported coming first.
+func mergeDescriptorSets(schemas []*APISchema) ([]byte, error) {
+    var merged pb.FileDescriptorSet
+    seen := make(map[string]bool)
+    for _, s := range schemas {
+        r, err := gzip.NewReader(bytes.NewReader(s.DescriptorSet))
+        if err != nil {
+            return nil, Errorf(Internal, "bad descriptor set of %s: %v", s.Package, err)
+        }
+        data, err := ioutil.ReadAll(r)
+        if err != nil {
+            return nil, Errorf(Internal, "bad descriptor set of %s: %v", s.Package, err)
+        }
+        var set pb.FileDescriptorSet
+        if err := proto.Unmarshal(data, &set); err != nil {
+            return nil, Errorf(Internal, "bad descriptor set of %s: %v", s.Package, err)
+        }
+        for _, f := range set.File {
+            if !seen[f.GetName()] {
+                seen[f.GetName()] = true
+                merged.File = append(merged.File, f)
+            }
+        }
+    }
+    return proto.Marshal(&merged)
+}
@@ -0,0 +1,46 @@
+package httprpc
+
+import "context"
+
+// scopesKey is the context key of the scopes granted to the principal of
+// the calls.
+type scopesKey struct{}
+
+// WithScopes returns a copy of ctx carrying scopes, the scopes granted to
+// the principal of the calls served with it, as set by the authentication
+// of the calls, e.g. from the scope claim of an OAuth 2.0 access token.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+    return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// Scopes returns the scopes carried by ctx, and whether it carries any,
+// even if none are granted.
+func Scopes(ctx context.Context) ([]string, bool) {
+    scopes, ok := ctx.Value(scopesKey{}).([]string)
+    return scopes, ok
+}
+
+// CheckScopes returns an error unless the scopes of ctx include all of
+// required, the scopes given by the (auth.scopes) options of the method of
+// procedure, e.g. "/pkg.Service/Method", before it runs: an Unauthenticated
+// error if ctx carries no scopes, a PermissionDenied error naming the first
+// scope missing otherwise.
+func CheckScopes(ctx context.Context, procedure string, required ...string) error {
+    granted, ok := Scopes(ctx)
+    if !ok {
+        return Errorf(Unauthenticated, "%s needs an authenticated caller", procedure)
+    }
+    for _, scope := range required {
+        found := false
+        for _, g := range granted {
+            if g == scope {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return Errorf(PermissionDenied, "%s needs the %q scope, not granted to %q", procedure, scope, Principal(ctx))
+        }
+    }
+    return nil
+}
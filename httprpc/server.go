@@ -0,0 +1,170 @@
+package httprpc
+
+import (
+    "context"
+    "expvar"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/golang/protobuf/proto"
+)
+
+// ConnectInterceptor intercepts the calls served by ServeConnect: next
+// runs the method of the call c, and the interceptor may fail the call
+// instead, or change its context or error.
+type ConnectInterceptor func(ctx context.Context, c *ServerCall, next func(ctx context.Context) error) error
+
+// interceptorsKey is the context key of the interceptors of the calls of
+// the requests served by a server returned by NewServer.
+type interceptorsKey struct{}
+
+// NewServer returns a server of handlers, each mounted under its path
+// prefix, whose calls run through interceptors, the first one outermost.
+// Its address and timeouts are left to set.
+func NewServer(handlers []ConnectHandler, interceptors ...ConnectInterceptor) *http.Server {
+    mux := http.NewServeMux()
+    for _, h := range handlers {
+        mux.Handle(h.PathPrefix(), h)
+    }
+    return &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if len(interceptors) > 0 {
+            r = r.WithContext(context.WithValue(r.Context(), interceptorsKey{}, interceptors))
+        }
+        mux.ServeHTTP(w, r)
+    })}
+}
+
+// intercept runs call through the interceptors of the context, if any.
+func intercept(ctx context.Context, c *ServerCall, call func(ctx context.Context, c *ServerCall) error) error {
+    interceptors, _ := ctx.Value(interceptorsKey{}).([]ConnectInterceptor)
+    var next func(i int) func(ctx context.Context) error
+    next = func(i int) func(ctx context.Context) error {
+        if i == len(interceptors) {
+            return func(ctx context.Context) error { return call(ctx, c) }
+        }
+        return func(ctx context.Context) error { return interceptors[i](ctx, c, next(i+1)) }
+    }
+    return next(0)(ctx)
+}
+
+// Procedure returns the procedure of the call, e.g. "/pkg.Service/Method".
+func (c *ServerCall) Procedure() string {
+    return c.r.URL.Path
+}
+
+// SplitProcedure returns the service and method of procedure, e.g.
+// "pkg.Service" and "Method" for "/pkg.Service/Method".
+func SplitProcedure(procedure string) (service, method string) {
+    procedure = strings.TrimPrefix(procedure, "/")
+    if i := strings.LastIndex(procedure, "/"); i >= 0 {
+        return procedure[:i], procedure[i+1:]
+    }
+    return procedure, ""
+}
+
+// RequestHeader returns the headers of the request of the call.
+func (c *ServerCall) RequestHeader() http.Header {
+    return c.r.Header
+}
+
+// ReceivedBytes returns the size in bytes of the requests received so far,
+// serialized, without their envelopes.
+func (c *ServerCall) ReceivedBytes() int {
+    return c.receivedBytes
+}
+
+// SentBytes returns the size in bytes of the responses sent so far,
+// serialized, without their envelopes.
+func (c *ServerCall) SentBytes() int {
+    return c.sentBytes
+}
+
+// CheckRequests adds check, run on every request received after it is
+// decoded: Receive returns the error of check, if any.
+func (c *ServerCall) CheckRequests(check func(m proto.Message) error) {
+    c.checks = append(c.checks, check)
+}
+
+// ValidateRequests is an interceptor rejecting the requests whose message
+// has a Validate method, checking its constraints, or a CustomValidate
+// method, the hook of domain-specific checks, returning an error, with the
+// InvalidArgument code.
+func ValidateRequests(ctx context.Context, c *ServerCall, next func(ctx context.Context) error) error {
+    c.CheckRequests(func(m proto.Message) error {
+        if v, ok := m.(interface{ Validate() error }); ok {
+            if err := v.Validate(); err != nil {
+                return Errorf(InvalidArgument, "invalid request: %v", err)
+            }
+        }
+        if v, ok := m.(interface{ CustomValidate() error }); ok {
+            if err := v.CustomValidate(); err != nil {
+                return Errorf(InvalidArgument, "invalid request: %v", err)
+            }
+        }
+        return nil
+    })
+    return next(ctx)
+}
+
+// Authorize returns an interceptor failing the calls which authorize does
+// not allow, given their procedure and request headers, before the method
+// runs. Errors which are not *Error fail the calls with the
+// PermissionDenied code.
+func Authorize(authorize func(ctx context.Context, procedure string, header http.Header) error) ConnectInterceptor {
+    return func(ctx context.Context, c *ServerCall, next func(ctx context.Context) error) error {
+        if err := authorize(ctx, c.Procedure(), c.RequestHeader()); err != nil {
+            if _, ok := err.(*Error); !ok {
+                err = Errorf(PermissionDenied, "%v", err)
+            }
+            return err
+        }
+        return next(ctx)
+    }
+}
+
+// callStats counts the calls of a procedure, their errors and the time
+// spent.
+type callStats struct {
+    calls, errors, nanos expvar.Int
+}
+
+var (
+    callStatsMu sync.Mutex
+    callStatsOf = make(map[string]*callStats)
+)
+
+// Metrics returns an interceptor counting the calls of every procedure,
+// their errors and the time spent, published with expvar as
+// "<prefix>.<package>.<Service>.<Method>" maps.
+func Metrics(prefix string) ConnectInterceptor {
+    return func(ctx context.Context, c *ServerCall, next func(ctx context.Context) error) error {
+        s := procedureStats(prefix + strings.Replace(c.Procedure(), "/", ".", -1))
+        start := time.Now()
+        err := next(ctx)
+        s.nanos.Add(int64(time.Since(start)))
+        s.calls.Add(1)
+        if err != nil {
+            s.errors.Add(1)
+        }
+        return err
+    }
+}
+
+// procedureStats returns the call counters published as the expvar map
+// name, creating them on first use.
+func procedureStats(name string) *callStats {
+    callStatsMu.Lock()
+    defer callStatsMu.Unlock()
+    s, ok := callStatsOf[name]
+    if !ok {
+        s = new(callStats)
+        m := expvar.NewMap(name)
+        m.Set("calls", &s.calls)
+        m.Set("errors", &s.errors)
+        m.Set("ns", &s.nanos)
+        callStatsOf[name] = s
+    }
+    return s
+}
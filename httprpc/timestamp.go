@@ -0,0 +1,305 @@
+package httprpc
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/golang/protobuf/jsonpb"
+    "github.com/golang/protobuf/proto"
+)
+
+// The formats of the google.protobuf.Timestamp values in JSON.
+const (
+    TimestampRFC3339    = "rfc3339"     // an RFC 3339 string, e.g. "2006-01-02T15:04:05.999Z"
+    TimestampUnixMillis = "unix_millis" // the number of milliseconds since the Unix epoch
+)
+
+// JSONTimestamps is implemented by the messages generated with the
+// timestamp_json or timestamp_zone parameters, whose timestamps are encoded
+// in JSON in another format, or zone, than the RFC 3339 strings in UTC the
+// proto3 JSON mapping specifies. The JSON encoders and decoders of the
+// package honor it.
+type JSONTimestamps interface {
+    proto.Message
+    JSONTimestampFormat() (format, zone string)
+}
+
+// unmarshalJSON decodes the JSON encoding data into m with unmarshaler, its
+// timestamps being accepted as numbers of milliseconds if m implements
+// JSONTimestamps, and its enum values unknown to their enum rejected if it
+// implements JSONRejectUnknownEnums.
+func unmarshalJSON(unmarshaler *jsonpb.Unmarshaler, data []byte, m proto.Message) error {
+    if _, ok := m.(JSONTimestamps); ok {
+        var err error
+        if data, err = ParseTimestamps(data, m); err != nil {
+            return err
+        }
+    }
+    if err := unmarshaler.Unmarshal(bytes.NewReader(data), m); err != nil {
+        return err
+    }
+    if _, ok := m.(JSONRejectUnknownEnums); ok {
+        return CheckEnums(m)
+    }
+    return nil
+}
+
+// FormatTimestamps returns the JSON encoding of the message m in data, of
+// either protobuf runtime, with its timestamps, encoded as RFC 3339 strings
+// in UTC, encoded in format, TimestampRFC3339 or TimestampUnixMillis,
+// the former in the time zone zone: UTC if empty, a fixed offset such as
+// "+02:00", or a location name such as "Europe/Paris". The timestamps of
+// the oneofs of API v2 messages are left as is.
+func FormatTimestamps(data []byte, m interface{}, format, zone string) ([]byte, error) {
+    if format != TimestampRFC3339 && format != TimestampUnixMillis {
+        return nil, fmt.Errorf("unknown timestamp format %q", format)
+    }
+    loc, err := TimestampZone(zone)
+    if err != nil {
+        return nil, err
+    }
+    out, err := rewriteTimestamps(data, reflect.TypeOf(m), func(value json.RawMessage) (json.RawMessage, error) {
+        var s string
+        if err := json.Unmarshal(value, &s); err != nil {
+            return value, nil
+        }
+        t, err := time.Parse(time.RFC3339Nano, s)
+        if err != nil {
+            return nil, fmt.Errorf("invalid timestamp %s", value)
+        }
+        if format == TimestampUnixMillis {
+            return json.RawMessage(strconv.FormatInt(t.Unix()*1000+int64(t.Nanosecond()/1e6), 10)), nil
+        }
+        return json.Marshal(formatRFC3339(t.In(loc)))
+    })
+    if err != nil {
+        return nil, fmt.Errorf("invalid JSON encoding of %T: %v", m, err)
+    }
+    return out, nil
+}
+
+// ParseTimestamps returns the JSON encoding data of a message of the type
+// of m, of either protobuf runtime, with its timestamps encoded as numbers
+// of milliseconds since the Unix epoch replaced by RFC 3339 strings in UTC,
+// which the JSON decoders accept, as they do the RFC 3339 strings in other
+// zones. The value of m is not read.
+func ParseTimestamps(data []byte, m interface{}) ([]byte, error) {
+    out, err := rewriteTimestamps(data, reflect.TypeOf(m), func(value json.RawMessage) (json.RawMessage, error) {
+        if len(value) == 0 || value[0] != '-' && (value[0] < '0' || value[0] > '9') {
+            return value, nil
+        }
+        ms, err := strconv.ParseInt(string(value), 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid timestamp %s", value)
+        }
+        sec, nsec := ms/1000, ms%1000*1e6
+        if nsec < 0 {
+            sec, nsec = sec-1, nsec+1e9
+        }
+        return json.Marshal(formatRFC3339(time.Unix(sec, nsec).UTC()))
+    })
+    if err != nil {
+        return nil, fmt.Errorf("invalid JSON encoding of %T: %v", m, err)
+    }
+    return out, nil
+}
+
+// formatRFC3339 returns t as the proto3 JSON mapping formats timestamps,
+// with 0, 3, 6 or 9 fractional digits.
+func formatRFC3339(t time.Time) string {
+    layout := "2006-01-02T15:04:05"
+    switch nsec := t.Nanosecond(); {
+    case nsec == 0:
+    case nsec%1e6 == 0:
+        layout += ".000"
+    case nsec%1e3 == 0:
+        layout += ".000000"
+    default:
+        layout += ".000000000"
+    }
+    return t.Format(layout + "Z07:00")
+}
+
+var (
+    fixedZone = regexp.MustCompile(`^[+-]([01][0-9]|2[0-3]):[0-5][0-9]$`)
+    zones     sync.Map // *time.Location by zone
+)
+
+// TimestampZone returns the time zone named zone: UTC if empty, a fixed
+// offset such as "+02:00", or a location of the IANA Time Zone database
+// such as "Europe/Paris".
+func TimestampZone(zone string) (*time.Location, error) {
+    if loc, ok := zones.Load(zone); ok {
+        return loc.(*time.Location), nil
+    }
+    var loc *time.Location
+    switch {
+    case zone == "":
+        loc = time.UTC
+    case fixedZone.MatchString(zone):
+        hours, _ := strconv.Atoi(zone[1:3])
+        minutes, _ := strconv.Atoi(zone[4:])
+        offset := hours*3600 + minutes*60
+        if zone[0] == '-' {
+            offset = -offset
+        }
+        loc = time.FixedZone(zone, offset)
+    default:
+        var err error
+        if loc, err = time.LoadLocation(zone); err != nil {
+            return nil, fmt.Errorf("unknown time zone %q: %v", zone, err)
+        }
+    }
+    zones.Store(zone, loc)
+    return loc, nil
+}
+
+// rewriteTimestamps returns the JSON value data, encoding a value of type
+// t, with the JSON values of its timestamps replaced by the result of
+// rewrite, null ones excepted.
+func rewriteTimestamps(data json.RawMessage, t reflect.Type, rewrite func(json.RawMessage) (json.RawMessage, error)) (json.RawMessage, error) {
+    if !hasTimestamps(t) || string(data) == "null" {
+        return data, nil
+    }
+    for t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    switch t.Kind() {
+    case reflect.Struct:
+        if isTimestamp(t) {
+            return rewrite(data)
+        }
+        fields := jsonFields(t)
+        return rewriteObject(data, func(key string, value json.RawMessage) (json.RawMessage, error) {
+            if ft, ok := fields[key]; ok {
+                return rewriteTimestamps(value, ft, rewrite)
+            }
+            return value, nil
+        })
+    case reflect.Map:
+        return rewriteObject(data, func(key string, value json.RawMessage) (json.RawMessage, error) {
+            return rewriteTimestamps(value, t.Elem(), rewrite)
+        })
+    case reflect.Slice:
+        var elems []json.RawMessage
+        if err := json.Unmarshal(data, &elems); err != nil {
+            return data, nil
+        }
+        for i := range elems {
+            elem, err := rewriteTimestamps(elems[i], t.Elem(), rewrite)
+            if err != nil {
+                return nil, err
+            }
+            elems[i] = elem
+        }
+        return json.Marshal(elems)
+    }
+    return data, nil
+}
+
+// isTimestamp reports whether the struct type t is the one of the
+// google.protobuf.Timestamp messages, of either runtime.
+func isTimestamp(t reflect.Type) bool {
+    if t.Name() != "Timestamp" {
+        return false
+    }
+    seconds, ok := t.FieldByName("Seconds")
+    if !ok || seconds.Type.Kind() != reflect.Int64 {
+        return false
+    }
+    nanos, ok := t.FieldByName("Nanos")
+    return ok && nanos.Type.Kind() == reflect.Int32
+}
+
+var timestampTypes sync.Map // bool by reflect.Type
+
+// hasTimestamps reports whether the values of type t may hold timestamps.
+func hasTimestamps(t reflect.Type) bool {
+    if has, ok := timestampTypes.Load(t); ok {
+        return has.(bool)
+    }
+    has := findTimestamps(t, make(map[reflect.Type]bool))
+    timestampTypes.Store(t, has)
+    return has
+}
+
+// findTimestamps reports whether the values of type t may hold timestamps,
+// the struct types in seen being already searched.
+func findTimestamps(t reflect.Type, seen map[reflect.Type]bool) bool {
+    switch t.Kind() {
+    case reflect.Ptr, reflect.Slice, reflect.Map:
+        return findTimestamps(t.Elem(), seen)
+    case reflect.Struct:
+        if isTimestamp(t) {
+            return true
+        }
+        if seen[t] {
+            return false
+        }
+        seen[t] = true
+        for _, ft := range jsonFields(t) {
+            if findTimestamps(ft, seen) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+var messageFieldTypes sync.Map // map[string]reflect.Type by reflect.Type
+
+// jsonFields returns the types of the fields of the message struct type t
+// by JSON name, original and lowerCamelCase, the fields of its oneofs
+// included if t is an API v1 message.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+    if fields, ok := messageFieldTypes.Load(t); ok {
+        return fields.(map[string]reflect.Type)
+    }
+    fields := make(map[string]reflect.Type)
+    add := func(sf reflect.StructField) {
+        for _, opt := range strings.Split(sf.Tag.Get("protobuf"), ",") {
+            if strings.HasPrefix(opt, "name=") || strings.HasPrefix(opt, "json=") {
+                name := opt[len("name="):]
+                fields[name] = sf.Type
+                fields[lowerCamelCase(name)] = sf.Type
+            }
+        }
+    }
+    for i := 0; i < t.NumField(); i++ {
+        sf := t.Field(i)
+        if sf.Tag.Get("protobuf_oneof") == "" {
+            add(sf)
+            continue
+        }
+        for _, wrapper := range oneofWrappers(t) {
+            wt := reflect.TypeOf(wrapper)
+            if wt.Implements(sf.Type) && wt.Kind() == reflect.Ptr && wt.Elem().NumField() == 1 {
+                add(wt.Elem().Field(0))
+            }
+        }
+    }
+    messageFieldTypes.Store(t, fields)
+    return fields
+}
+
+// oneofWrappers returns the wrappers of the fields of the oneofs of the
+// message struct type t, as listed by its XXX_OneofFuncs or
+// XXX_OneofWrappers method.
+func oneofWrappers(t reflect.Type) []interface{} {
+    m := reflect.New(t)
+    for _, name := range []string{"XXX_OneofWrappers", "XXX_OneofFuncs"} {
+        if method := m.MethodByName(name); method.IsValid() {
+            out := method.Call(nil)
+            wrappers, _ := out[len(out)-1].Interface().([]interface{})
+            return wrappers
+        }
+    }
+    return nil
+}
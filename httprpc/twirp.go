@@ -0,0 +1,177 @@
+package httprpc
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "strings"
+
+    "github.com/golang/protobuf/jsonpb"
+    "github.com/golang/protobuf/proto"
+)
+
+// The content types of the Twirp protocol.
+const (
+    ContentTypeProtobuf = "application/protobuf"
+    ContentTypeJSON     = "application/json"
+)
+
+// TwirpServer is a server of a service implementing the Twirp protocol.
+type TwirpServer interface {
+    http.Handler
+
+    // PathPrefix returns the prefix of the paths of the methods of the
+    // service, under which the server must be mounted.
+    PathPrefix() string
+}
+
+// HTTPClient is the interface of the HTTP clients used by the Twirp
+// clients, satisfied by *http.Client.
+type HTTPClient interface {
+    Do(req *http.Request) (*http.Response, error)
+}
+
+// twirpError is the JSON representation of an *Error in the Twirp protocol.
+type twirpError struct {
+    Code Code              `json:"code"`
+    Msg  string            `json:"msg"`
+    Meta map[string]string `json:"meta,omitempty"`
+}
+
+var (
+    jsonMarshaler   = jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+    jsonUnmarshaler = jsonpb.Unmarshaler{AllowUnknownFields: true}
+)
+
+// ReadTwirpRequest decodes the body of the Twirp request r into in, and
+// reports whether it is JSON encoded, in which case the response must be
+// too.
+func ReadTwirpRequest(r *http.Request, in proto.Message) (isJSON bool, err error) {
+    if r.Method != "POST" {
+        return false, Errorf(BadRoute, "unsupported method %q (only POST is allowed)", r.Method)
+    }
+    contentType := r.Header.Get("Content-Type")
+    if i := strings.Index(contentType, ";"); i >= 0 {
+        contentType = contentType[:i]
+    }
+    switch strings.TrimSpace(strings.ToLower(contentType)) {
+    case ContentTypeProtobuf:
+    case ContentTypeJSON:
+        isJSON = true
+    default:
+        return false, Errorf(BadRoute, "unexpected Content-Type: %q", r.Header.Get("Content-Type"))
+    }
+    body, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+        return isJSON, Errorf(Malformed, "failed to read request body: %v", err)
+    }
+    if isJSON {
+        err = unmarshalJSON(&jsonUnmarshaler, body, in)
+    } else {
+        err = proto.Unmarshal(body, in)
+    }
+    if err != nil {
+        return isJSON, Errorf(Malformed, "the request could not be decoded: %v", err)
+    }
+    return isJSON, nil
+}
+
+// WriteTwirpResponse writes out as the response to a Twirp request,
+// encoded as JSON if isJSON is set.
+func WriteTwirpResponse(w http.ResponseWriter, out proto.Message, isJSON bool) {
+    var body []byte
+    var err error
+    if isJSON {
+        body, err = marshalJSON(&jsonMarshaler, out)
+        w.Header().Set("Content-Type", ContentTypeJSON)
+    } else {
+        body, err = proto.Marshal(out)
+        w.Header().Set("Content-Type", ContentTypeProtobuf)
+    }
+    if err != nil {
+        WriteTwirpError(w, Errorf(Internal, "failed to encode the response: %v", err))
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    w.Write(body)
+}
+
+// WriteTwirpError writes err as the response to a Twirp request. Errors
+// other than *Error are reported as Internal errors.
+func WriteTwirpError(w http.ResponseWriter, err error) {
+    e := ErrorFrom(err)
+    body, _ := json.Marshal(twirpError{e.Code, e.Msg, e.Meta})
+    w.Header().Set("Content-Type", ContentTypeJSON)
+    w.WriteHeader(e.Code.HTTPStatus())
+    w.Write(body)
+}
+
+// CallTwirp calls the Twirp method at path of the server at baseURL, e.g.
+// "http://localhost:8080", with in as the request, encoded as JSON if
+// isJSON is set, and decodes the response into out. The errors reported
+// by the server are returned as *Error.
+func CallTwirp(ctx context.Context, client HTTPClient, baseURL, path string, in, out proto.Message, isJSON bool) error {
+    var body []byte
+    var err error
+    contentType := ContentTypeProtobuf
+    if isJSON {
+        body, err = marshalJSON(&jsonMarshaler, in)
+        contentType = ContentTypeJSON
+    } else {
+        body, err = proto.Marshal(in)
+    }
+    if err != nil {
+        return Errorf(Internal, "failed to encode the request: %v", err)
+    }
+    req, err := http.NewRequest("POST", strings.TrimSuffix(baseURL, "/")+path, bytes.NewReader(body))
+    if err != nil {
+        return Errorf(Internal, "could not build the request: %v", err)
+    }
+    req = req.WithContext(ctx)
+    req.Header.Set("Content-Type", contentType)
+    req.Header.Set("Accept", contentType)
+    resp, err := client.Do(req)
+    if err != nil {
+        if ctx.Err() == context.Canceled {
+            return Errorf(Canceled, "%v", err)
+        }
+        if ctx.Err() == context.DeadlineExceeded {
+            return Errorf(DeadlineExceeded, "%v", err)
+        }
+        return Errorf(Unavailable, "failed to do the request: %v", err)
+    }
+    defer resp.Body.Close()
+    body, err = ioutil.ReadAll(resp.Body)
+    if err != nil {
+        return Errorf(Internal, "failed to read the response body: %v", err)
+    }
+    if resp.StatusCode != http.StatusOK {
+        return responseError(resp, body)
+    }
+    if isJSON {
+        err = unmarshalJSON(&jsonUnmarshaler, body, out)
+    } else {
+        err = proto.Unmarshal(body, out)
+    }
+    if err != nil {
+        return Errorf(Internal, "failed to decode the response: %v", err)
+    }
+    return nil
+}
+
+// responseError returns the error reported by the error response resp,
+// whose body is body.
+func responseError(resp *http.Response, body []byte) *Error {
+    var e twirpError
+    if err := json.Unmarshal(body, &e); err != nil || e.Code == "" {
+        // The response does not come from a Twirp server, but from a proxy.
+        return &Error{
+            Code: statusCode(resp.StatusCode),
+            Msg:  "unexpected error response: " + resp.Status,
+            Meta: map[string]string{"http_error_from_intermediary": "true"},
+        }
+    }
+    return &Error{Code: e.Code, Msg: e.Msg, Meta: e.Meta}
+}
@@ -0,0 +1,160 @@
+package httprpc
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/golang/protobuf/jsonpb"
+    "github.com/golang/protobuf/proto"
+)
+
+// VCRMode is the mode of a VCR.
+type VCRMode int
+
+// The VCR modes.
+const (
+    Replay VCRMode = iota // the calls are answered from the fixtures
+    Record                // the calls are made, and recorded as fixtures
+)
+
+// RedactedFields describes the fields redacted from the fixtures, by full
+// name of their message: their proto names are mapped to "", and those of
+// the message fields holding redacted fields to their message full name,
+// prefixed with "map:" for the values of maps.
+type RedactedFields map[string]map[string]string
+
+// VCR records the responses to the calls of clients as fixtures in a
+// directory, one JSON file per call named after its procedure and request,
+// and replays them in hermetic tests.
+type VCR struct {
+    Dir  string
+    Mode VCRMode
+}
+
+// vcrFixture is the fixture of a call, with its request and response in
+// their JSON mapping, the redacted fields removed.
+type vcrFixture struct {
+    Procedure string          `json:"procedure"`
+    Request   json.RawMessage `json:"request"`
+    Response  json.RawMessage `json:"response,omitempty"`
+    Error     *vcrError       `json:"error,omitempty"`
+}
+
+// vcrError is an *Error as recorded in a fixture.
+type vcrError struct {
+    Code Code   `json:"code"`
+    Msg  string `json:"msg"`
+}
+
+// vcrMarshaler writes the messages of the fixtures with their proto field
+// names, and map keys sorted.
+var vcrMarshaler = jsonpb.Marshaler{OrigName: true}
+
+// Call records or replays the call of the unary procedure, e.g.
+// "/pkg.Service/Method", with request in, filling out with its response.
+// When recording, call makes the call.
+func (v *VCR) Call(ctx context.Context, procedure string, in, out proto.Message, redacted RedactedFields,
+    call func(ctx context.Context) (proto.Message, error)) error {
+    request, err := vcrMarshaler.MarshalToString(in)
+    if err != nil {
+        return Errorf(Internal, "failed to encode the request: %v", err)
+    }
+    sum := sha256.Sum256([]byte(procedure + "\n" + request))
+    name := filepath.Join(v.Dir, filepath.FromSlash(strings.TrimPrefix(procedure, "/")), hex.EncodeToString(sum[:16])+".json")
+    f := vcrFixture{Procedure: procedure}
+    if f.Request, err = redact(request, proto.MessageName(in), redacted); err != nil {
+        return err
+    }
+
+    if v.Mode == Replay {
+        data, err := ioutil.ReadFile(name)
+        if err != nil {
+            return Errorf(NotFound, "no fixture %s of the %s call with %s", name, procedure, f.Request)
+        }
+        var recorded vcrFixture
+        if err := json.Unmarshal(data, &recorded); err != nil {
+            return Errorf(DataLoss, "invalid fixture %s: %v", name, err)
+        }
+        if recorded.Error != nil {
+            return &Error{Code: recorded.Error.Code, Msg: recorded.Error.Msg}
+        }
+        return (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(bytes.NewReader(recorded.Response), out)
+    }
+
+    resp, callErr := call(ctx)
+    if callErr != nil {
+        e := ErrorFrom(callErr)
+        f.Error = &vcrError{e.Code, e.Msg}
+    } else {
+        response, err := vcrMarshaler.MarshalToString(resp)
+        if err != nil {
+            return Errorf(Internal, "failed to encode the response: %v", err)
+        }
+        if f.Response, err = redact(response, proto.MessageName(resp), redacted); err != nil {
+            return err
+        }
+        proto.Merge(out, resp)
+    }
+    data, err := json.MarshalIndent(f, "", "  ")
+    if err == nil {
+        err = os.MkdirAll(filepath.Dir(name), 0777)
+    }
+    if err == nil {
+        err = ioutil.WriteFile(name, append(data, '\n'), 0666)
+    }
+    if err != nil {
+        return Errorf(Internal, "failed to record the %s call: %v", procedure, err)
+    }
+    return callErr
+}
+
+// redact returns the JSON mapping data of a message of type typ without the
+// fields redacted.
+func redact(data, typ string, redacted RedactedFields) (json.RawMessage, error) {
+    if len(redacted) == 0 {
+        return json.RawMessage(data), nil
+    }
+    var v interface{}
+    if err := json.Unmarshal([]byte(data), &v); err != nil {
+        return nil, Errorf(Internal, "failed to redact a %s: %v", typ, err)
+    }
+    redactValue(v, typ, redacted)
+    b, err := json.Marshal(v)
+    if err != nil {
+        return nil, Errorf(Internal, "failed to redact a %s: %v", typ, err)
+    }
+    return b, nil
+}
+
+// redactValue removes the fields redacted from v, the JSON value of a
+// message of type typ or a list of them.
+func redactValue(v interface{}, typ string, redacted RedactedFields) {
+    switch v := v.(type) {
+    case []interface{}:
+        for _, e := range v {
+            redactValue(e, typ, redacted)
+        }
+    case map[string]interface{}:
+        for name, fieldType := range redacted[typ] {
+            switch {
+            case fieldType == "":
+                delete(v, name)
+            case strings.HasPrefix(fieldType, "map:"):
+                if m, ok := v[name].(map[string]interface{}); ok {
+                    for _, e := range m {
+                        redactValue(e, strings.TrimPrefix(fieldType, "map:"), redacted)
+                    }
+                }
+            default:
+                redactValue(v[name], fieldType, redacted)
+            }
+        }
+    }
+}
@@ -0,0 +1,902 @@
+// Package descutil holds the descriptor walking helpers shared by the
+// plugins linked in to protoc-gen-go.
+package descutil
+
+import (
+    "crypto/sha256"
+    "fmt"
+    "math"
+    "path"
+    "reflect"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+    "github.com/lleveque/protoc-gen-go/wire"
+)
+
+// Messages returns all the messages defined in file, nested ones included,
+// in declaration order. The virtual messages generated for map entries
+// are skipped.
+func Messages(gen *generator.Generator, file *generator.FileDescriptor) []*generator.Descriptor {
+    var msgs []*generator.Descriptor
+    var walk func(prefix string, descs []*pb.DescriptorProto)
+    walk = func(prefix string, descs []*pb.DescriptorProto) {
+        for _, desc := range descs {
+            name := prefix + "." + desc.GetName()
+            if desc.GetOptions().GetMapEntry() {
+                continue
+            }
+            if msg, ok := gen.ObjectNamed(name).(*generator.Descriptor); ok {
+                msgs = append(msgs, msg)
+            }
+            walk(name, desc.NestedType)
+        }
+    }
+    walk(packagePrefix(file), file.MessageType)
+    return msgs
+}
+
+// Enums returns all the enums defined in file, nested ones included,
+// in declaration order.
+func Enums(gen *generator.Generator, file *generator.FileDescriptor) []*generator.EnumDescriptor {
+    var enums []*generator.EnumDescriptor
+    add := func(prefix string, descs []*pb.EnumDescriptorProto) {
+        for _, desc := range descs {
+            if enum, ok := gen.ObjectNamed(prefix + "." + desc.GetName()).(*generator.EnumDescriptor); ok {
+                enums = append(enums, enum)
+            }
+        }
+    }
+    var walk func(prefix string, descs []*pb.DescriptorProto)
+    walk = func(prefix string, descs []*pb.DescriptorProto) {
+        for _, desc := range descs {
+            name := prefix + "." + desc.GetName()
+            add(name, desc.EnumType)
+            walk(name, desc.NestedType)
+        }
+    }
+    add(packagePrefix(file), file.EnumType)
+    walk(packagePrefix(file), file.MessageType)
+    return enums
+}
+
+// MapEntry returns the map entry message of field, or nil if it is not a
+// map field.
+func MapEntry(gen *generator.Generator, field *pb.FieldDescriptorProto) *generator.Descriptor {
+    if field.GetType() != pb.FieldDescriptorProto_TYPE_MESSAGE {
+        return nil
+    }
+    desc, ok := gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor)
+    if !ok || !desc.GetOptions().GetMapEntry() {
+        return nil
+    }
+    return desc
+}
+
+// IsProto3 reports whether msg is defined in a proto3 file, and so has no
+// XXX_unrecognized field.
+func IsProto3(msg *generator.Descriptor) bool {
+    return msg.File().GetSyntax() == "proto3"
+}
+
+// Type is a message or an enum of a file of the request, read from the
+// descriptor of the file. Unlike the objects returned by the ObjectNamed
+// method of the generator, which warns about the types of the files not
+// imported by the file being generated, the types of any file can be
+// looked up.
+type Type struct {
+    File    *pb.FileDescriptorProto
+    Name    []string                // its dotted name from the package, e.g. ["Foo", "Bar"] for Foo.Bar
+    Path    string                  // its SourceCodeInfo path, as a comma-separated list of integers
+    Message *pb.DescriptorProto     // nil for an enum
+    Enum    *pb.EnumDescriptorProto // nil for a message
+}
+
+// TypeSet holds the types of the files of a request by fully-qualified
+// name, e.g. ".greeting.Foo".
+type TypeSet map[string]*Type
+
+// NewTypeSet returns the set of the types of all the files of the request,
+// the ones of the files to generate and of their dependencies, the virtual
+// messages generated for map entries included.
+func NewTypeSet(gen *generator.Generator) TypeSet {
+    s := make(TypeSet)
+    for _, f := range gen.Request.ProtoFile {
+        prefix := ""
+        if pkg := f.GetPackage(); pkg != "" {
+            prefix = "." + pkg
+        }
+        msgs, enums := fileTypes(f)
+        for _, t := range append(msgs, enums...) {
+            s[prefix+"."+strings.Join(t.Name, ".")] = t
+        }
+    }
+    return s
+}
+
+// Message returns the message typ, or nil if typ is not a message.
+func (s TypeSet) Message(typ string) *Type {
+    if t := s[typ]; t != nil && t.Message != nil {
+        return t
+    }
+    return nil
+}
+
+// Enum returns the enum typ, or nil if typ is not an enum.
+func (s TypeSet) Enum(typ string) *Type {
+    if t := s[typ]; t != nil && t.Enum != nil {
+        return t
+    }
+    return nil
+}
+
+// FileMessages returns all the messages defined in f, nested ones included,
+// in declaration order, as Messages does. The virtual messages generated
+// for map entries are skipped.
+func FileMessages(f *pb.FileDescriptorProto) []*Type {
+    var msgs []*Type
+    all, _ := fileTypes(f)
+    for _, t := range all {
+        if !t.Message.GetOptions().GetMapEntry() {
+            msgs = append(msgs, t)
+        }
+    }
+    return msgs
+}
+
+// FileEnums returns all the enums defined in f, nested ones included, in
+// declaration order, as Enums does.
+func FileEnums(f *pb.FileDescriptorProto) []*Type {
+    _, enums := fileTypes(f)
+    return enums
+}
+
+// fileTypes returns the messages, map entries included, and the enums
+// defined in f, in declaration order.
+func fileTypes(f *pb.FileDescriptorProto) (msgs, enums []*Type) {
+    for i, enum := range f.EnumType {
+        enums = append(enums, &Type{File: f, Name: []string{enum.GetName()}, Path: fmt.Sprintf("5,%d", i), Enum: enum}) // 5 means enum_type in a file.
+    }
+    var walk func(outer []string, prefix string, descs []*pb.DescriptorProto)
+    walk = func(outer []string, prefix string, descs []*pb.DescriptorProto) {
+        for i, desc := range descs {
+            name := append(outer[:len(outer):len(outer)], desc.GetName())
+            p := fmt.Sprintf("%s,%d", prefix, i)
+            msgs = append(msgs, &Type{File: f, Name: name, Path: p, Message: desc})
+            for j, enum := range desc.EnumType {
+                enumName := append(name[:len(name):len(name)], enum.GetName())
+                enums = append(enums, &Type{File: f, Name: enumName, Path: fmt.Sprintf("%s,4,%d", p, j), Enum: enum}) // 4 means enum_type in a message.
+            }
+            walk(name, p+",3", desc.NestedType) // 3 means nested_type in a message.
+        }
+    }
+    walk(nil, "4", f.MessageType) // 4 means message_type in a file.
+    return msgs, enums
+}
+
+// MessagePath returns the SourceCodeInfo path of msg, as a comma-separated
+// list of integers.
+func MessagePath(msg *generator.Descriptor) string {
+    return typePath(msg.File(), msg.TypeName())
+}
+
+// EnumPath returns the SourceCodeInfo path of enum, as a comma-separated
+// list of integers.
+func EnumPath(enum *generator.EnumDescriptor) string {
+    return typePath(enum.File(), enum.TypeName())
+}
+
+// typePath returns the SourceCodeInfo path of the message or enum of f
+// whose dotted name, from the package, is names.
+func typePath(f *pb.FileDescriptorProto, names []string) string {
+    msgs, enums := f.MessageType, f.EnumType
+    msgTag, enumTag := "4", "5" // message_type and enum_type in a file
+    var p []string
+    for _, name := range names {
+        found := false
+        for i, msg := range msgs {
+            if msg.GetName() == name {
+                p = append(p, msgTag, strconv.Itoa(i))
+                msgs, enums = msg.NestedType, msg.EnumType
+                found = true
+                break
+            }
+        }
+        if !found {
+            for i, enum := range enums {
+                if enum.GetName() == name {
+                    p = append(p, enumTag, strconv.Itoa(i))
+                    break
+                }
+            }
+        }
+        msgTag, enumTag = "3", "4" // nested_type and enum_type in a message
+    }
+    return strings.Join(p, ",")
+}
+
+// packagePrefix returns the prefix of the fully-qualified names of the
+// types defined in file, e.g. ".greeting".
+func packagePrefix(file *generator.FileDescriptor) string {
+    if pkg := file.GetPackage(); pkg != "" {
+        return "." + pkg
+    }
+    return ""
+}
+
+// GoFileName returns the name of the Go file generated for the .proto file f.
+// By default it follows the import path given by the go_package option,
+// as protoc-gen-go does; with sourceRelative it sits next to the .proto file.
+func GoFileName(f *pb.FileDescriptorProto, sourceRelative bool) string {
+    name := f.GetName()
+    if ext := path.Ext(name); ext == ".proto" || ext == ".protodevel" {
+        name = name[:len(name)-len(ext)]
+    }
+    name += ".pb.go"
+    if sourceRelative {
+        return name
+    }
+    // The presence of a slash in go_package implies an import path,
+    // which replaces the directory of the .proto file.
+    impPath := f.GetOptions().GetGoPackage()
+    if sc := strings.IndexByte(impPath, ';'); sc >= 0 {
+        impPath = impPath[:sc]
+    }
+    if strings.LastIndex(impPath, "/") < 0 {
+        return name
+    }
+    return path.Join(impPath, path.Base(name))
+}
+
+// OutputName returns the name of a file generated alongside the Go file of
+// f, replacing its .pb.go extension with suffix. It honors the paths
+// parameter of the generator.
+func OutputName(gen *generator.Generator, f *pb.FileDescriptorProto, suffix string) string {
+    name := GoFileName(f, gen.Param["paths"] == "source_relative")
+    return strings.TrimSuffix(name, ".pb.go") + suffix
+}
+
+// IsGenerated reports whether the file named name is one of the files to
+// generate, as opposed to one of their dependencies.
+func IsGenerated(gen *generator.Generator, name string) bool {
+    for _, f := range gen.Request.FileToGenerate {
+        if f == name {
+            return true
+        }
+    }
+    return false
+}
+
+// DescriptorSetHash returns the hash of the descriptors of all the files of
+// the request, including the files imported by the generated ones.
+func DescriptorSetHash(gen *generator.Generator) string {
+    h := sha256.New()
+    for _, f := range gen.Request.ProtoFile {
+        b, err := proto.Marshal(f)
+        if err != nil {
+            gen.Error(err, "marshaling", f.GetName())
+        }
+        fmt.Fprintf(h, "%d:", len(b))
+        h.Write(b)
+    }
+    return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+// AddFile adds a file to the generator response, next to the generated Go files.
+func AddFile(gen *generator.Generator, name, content string) {
+    gen.Response.File = append(gen.Response.File, &plugin.CodeGeneratorResponse_File{
+        Name:    proto.String(name),
+        Content: proto.String(content),
+    })
+}
+
+// LeadingComments returns the comments attached before the element of f at
+// path, a comma-separated list of integers as described in descriptor.proto,
+// with the leading space of each line removed.
+func LeadingComments(f *pb.FileDescriptorProto, path string) string {
+    for _, loc := range f.GetSourceCodeInfo().GetLocation() {
+        if loc.LeadingComments == nil || !pathEqual(loc.Path, path) {
+            continue
+        }
+        lines := strings.Split(strings.TrimSuffix(loc.GetLeadingComments(), "\n"), "\n")
+        for i, line := range lines {
+            lines[i] = strings.TrimPrefix(line, " ")
+        }
+        return strings.Join(lines, "\n")
+    }
+    return ""
+}
+
+// pathEqual reports whether the location path p is the one written as s.
+func pathEqual(p []int32, s string) bool {
+    ps := make([]string, len(p))
+    for i, n := range p {
+        ps[i] = strconv.Itoa(int(n))
+    }
+    return strings.Join(ps, ",") == s
+}
+
+// JSONName returns the name of field in the JSON mapping.
+func JSONName(field *pb.FieldDescriptorProto) string {
+    if field.JsonName != nil {
+        return field.GetJsonName()
+    }
+    // Older compilers do not fill json_name in: compute it as they would.
+    var b []byte
+    upper := false
+    for _, c := range []byte(field.GetName()) {
+        switch {
+        case c == '_':
+            upper = true
+        case upper && 'a' <= c && c <= 'z':
+            b = append(b, c-'a'+'A')
+            upper = false
+        default:
+            b = append(b, c)
+            upper = false
+        }
+    }
+    return string(b)
+}
+
+// PluginEnabled reports whether the plugin name is enabled by the plugins
+// parameter, as the generator does: an empty plugins= enables them all.
+func PluginEnabled(gen *generator.Generator, name string) bool {
+    plugins, ok := gen.Param["plugins"]
+    if !ok {
+        return false
+    }
+    if plugins == "" {
+        return true
+    }
+    for _, p := range strings.Split(plugins, "+") {
+        if p == name {
+            return true
+        }
+    }
+    return false
+}
+
+// BoolParam reports whether the boolean parameter name is enabled, false if
+// unset. A parameter given without a value, e.g. "markers", counts as true.
+// It fails on the values strconv.ParseBool does not accept.
+func BoolParam(gen *generator.Generator, name string) bool {
+    v, ok := gen.Param[name]
+    if !ok {
+        return false
+    }
+    if v == "" {
+        return true
+    }
+    b, err := strconv.ParseBool(v)
+    if err != nil {
+        gen.Fail("invalid value " + strconv.Quote(v) + " for parameter " + name + ": want a boolean")
+    }
+    return b
+}
+
+// Int64JSONNumbers reports whether the 64-bit integers are encoded in JSON
+// as numbers, with the int64_json=number parameter, rather than as strings
+// as the proto3 JSON mapping specifies. It fails on unknown values.
+func Int64JSONNumbers(gen *generator.Generator) bool {
+    switch v := gen.Param["int64_json"]; v {
+    case "", "string":
+        return false
+    case "number":
+        return true
+    default:
+        gen.Fail("invalid value " + strconv.Quote(v) + ` for parameter int64_json: want "string" or "number"`)
+        return false
+    }
+}
+
+// RuntimeV2 reports whether the generated code targets the
+// google.golang.org/protobuf (API v2) runtime, with the runtime=v2
+// parameter, rather than github.com/golang/protobuf (runtime=v1, the
+// default). It fails on unknown values.
+func RuntimeV2(gen *generator.Generator) bool {
+    switch v := gen.Param["runtime"]; v {
+    case "", "v1":
+        return false
+    case "v2":
+        return true
+    default:
+        gen.Fail("invalid value " + strconv.Quote(v) + ` for parameter runtime: want "v1" or "v2"`)
+        return false
+    }
+}
+
+// EnumJSON reports whether the enums are encoded in JSON as numbers, with
+// the enum_json=number parameter, rather than as the names of their values
+// as the proto3 JSON mapping specifies, and whether the values unknown to
+// the enums are rejected on input, with enum_json_unknown=reject, rather
+// than kept as numbers, round-tripping through the JSON encodings. It fails
+// on unknown values of the parameters.
+func EnumJSON(gen *generator.Generator) (numbers, rejectUnknown bool) {
+    switch v := gen.Param["enum_json"]; v {
+    case "", "string":
+    case "number":
+        numbers = true
+    default:
+        gen.Fail("invalid value " + strconv.Quote(v) + ` for parameter enum_json: want "string" or "number"`)
+    }
+    switch v := gen.Param["enum_json_unknown"]; v {
+    case "", "keep":
+    case "reject":
+        rejectUnknown = true
+    default:
+        gen.Fail("invalid value " + strconv.Quote(v) + ` for parameter enum_json_unknown: want "keep" or "reject"`)
+    }
+    return numbers, rejectUnknown
+}
+
+// TimestampJSON returns the format, "rfc3339" or "unix_millis", as the
+// httprpc.TimestampRFC3339 and httprpc.TimestampUnixMillis constants of the
+// runtime, and the time zone of the timestamps encoded
+// in JSON, given by the timestamp_json and timestamp_zone parameters, or
+// empty strings for the RFC 3339 strings in UTC the proto3 JSON mapping
+// specifies. It fails on unknown formats and zones, and on a zone given
+// with timestamp_json=unix_millis.
+func TimestampJSON(gen *generator.Generator) (format, zone string) {
+    format, zone = gen.Param["timestamp_json"], gen.Param["timestamp_zone"]
+    switch format {
+    case "", "rfc3339":
+        if zone == "" {
+            return "", ""
+        }
+        format = "rfc3339"
+    case "unix_millis":
+        if zone != "" {
+            gen.Fail("parameter timestamp_zone cannot be combined with timestamp_json=" + format)
+        }
+    default:
+        gen.Fail("invalid value " + strconv.Quote(format) + ` for parameter timestamp_json: want "rfc3339" or "unix_millis"`)
+    }
+    if !fixedZone.MatchString(zone) {
+        if _, err := time.LoadLocation(zone); err != nil {
+            gen.Fail("invalid value " + strconv.Quote(zone) + " for parameter timestamp_zone: " + err.Error())
+        }
+    }
+    return format, zone
+}
+
+// fixedZone matches the time zones given as fixed offsets, e.g. "+02:00",
+// as accepted by httprpc.TimestampZone along with the IANA locations.
+var fixedZone = regexp.MustCompile(`^[+-]([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// MethodTimeout returns the timeout of the calls of method, given by its
+// custom string option (grpcserial.timeout) in the format of
+// time.ParseDuration, e.g. "2s", and whether it has one. It fails on
+// invalid and non-positive durations.
+func MethodTimeout(gen *generator.Generator, method *pb.MethodDescriptorProto) (time.Duration, bool) {
+    ext := Extension(gen, ".google.protobuf.MethodOptions", ".grpcserial.timeout")
+    if ext == nil {
+        return 0, false
+    }
+    values := OptionValues(gen, Options(method.Options), ext)
+    if len(values) == 0 {
+        return 0, false
+    }
+    v, _ := strconv.Unquote(values[0])
+    d, err := time.ParseDuration(v)
+    if err != nil || d <= 0 {
+        gen.Fail("invalid grpcserial.timeout option " + values[0] + " of method " + method.GetName() + ": want a positive duration, e.g. \"2s\"")
+    }
+    return d, true
+}
+
+// DurationLiteral returns the Go expression of d, with the time package
+// named timePkg, in its largest whole unit, e.g. "2*time.Second".
+func DurationLiteral(d time.Duration, timePkg string) string {
+    units := []struct {
+        d    time.Duration
+        name string
+    }{
+        {time.Hour, "Hour"},
+        {time.Minute, "Minute"},
+        {time.Second, "Second"},
+        {time.Millisecond, "Millisecond"},
+        {time.Microsecond, "Microsecond"},
+    }
+    for _, u := range units {
+        if d%u.d == 0 {
+            return strconv.FormatInt(int64(d/u.d), 10) + "*" + timePkg + "." + u.name
+        }
+    }
+    return strconv.FormatInt(int64(d), 10) + "*" + timePkg + ".Nanosecond"
+}
+
+// PrometheusNamespace returns the namespace of the Prometheus metrics of the
+// calls, given by the prometheus_namespace parameter, or "" for none. It
+// fails on namespaces which are not valid metric name prefixes.
+func PrometheusNamespace(gen *generator.Generator) string {
+    namespace := gen.Param["prometheus_namespace"]
+    for i, r := range namespace {
+        if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+            gen.Fail("invalid value " + strconv.Quote(namespace) + " for parameter prometheus_namespace: want letters, digits and underscores, not starting with a digit")
+        }
+    }
+    return namespace
+}
+
+// ExtensionField is an extension declared in the files of a request.
+type ExtensionField struct {
+    FullName string // fully-qualified, with a leading dot
+    *pb.FieldDescriptorProto
+}
+
+// Extensions returns the extensions of the options message extendee, e.g.
+// ".google.protobuf.FieldOptions", declared in the files of the request,
+// ordered by field number.
+func Extensions(gen *generator.Generator, extendee string) []ExtensionField {
+    var found []ExtensionField
+    match := func(prefix string, exts []*pb.FieldDescriptorProto) {
+        for _, ext := range exts {
+            if ext.GetExtendee() == extendee {
+                found = append(found, ExtensionField{prefix + "." + ext.GetName(), ext})
+            }
+        }
+    }
+    var walk func(prefix string, descs []*pb.DescriptorProto)
+    walk = func(prefix string, descs []*pb.DescriptorProto) {
+        for _, desc := range descs {
+            name := prefix + "." + desc.GetName()
+            match(name, desc.Extension)
+            walk(name, desc.NestedType)
+        }
+    }
+    for _, f := range gen.Request.ProtoFile {
+        prefix := ""
+        if pkg := f.GetPackage(); pkg != "" {
+            prefix = "." + pkg
+        }
+        match(prefix, f.Extension)
+        walk(prefix, f.MessageType)
+    }
+    sort.SliceStable(found, func(i, j int) bool { return found[i].GetNumber() < found[j].GetNumber() })
+    return found
+}
+
+// Extension returns the extension of the options message extendee, e.g.
+// ".google.protobuf.MethodOptions", named name, either fully qualified or
+// only by its last component, as declared in the files of the request.
+// It returns nil if there is no such extension.
+func Extension(gen *generator.Generator, extendee, name string) *pb.FieldDescriptorProto {
+    for _, ext := range Extensions(gen, extendee) {
+        if ext.GetName() == name || ext.FullName == name {
+            return ext.FieldDescriptorProto
+        }
+    }
+    return nil
+}
+
+// OptionValues returns the values of the custom option ext in the serialized
+// options opts, as written in the protobuf text format: a single value, or
+// one per element for repeated options. Message values are not decoded and
+// are returned as "{...}".
+func OptionValues(gen *generator.Generator, opts *wire.Message, ext *pb.FieldDescriptorProto) []string {
+    num := ext.GetNumber()
+    var values []string
+    switch ext.GetType() {
+    case pb.FieldDescriptorProto_TYPE_STRING, pb.FieldDescriptorProto_TYPE_BYTES:
+        for _, b := range opts.RepeatedLengthDelimited(num) {
+            values = append(values, strconv.Quote(string(b)))
+        }
+    case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+        for range opts.RepeatedLengthDelimited(num) {
+            values = append(values, "{...}")
+        }
+    case pb.FieldDescriptorProto_TYPE_FIXED32, pb.FieldDescriptorProto_TYPE_SFIXED32, pb.FieldDescriptorProto_TYPE_FLOAT:
+        for _, x := range opts.RepeatedFixed32(num) {
+            switch ext.GetType() {
+            case pb.FieldDescriptorProto_TYPE_FIXED32:
+                values = append(values, strconv.FormatUint(uint64(x), 10))
+            case pb.FieldDescriptorProto_TYPE_SFIXED32:
+                values = append(values, strconv.FormatInt(int64(int32(x)), 10))
+            default:
+                values = append(values, strconv.FormatFloat(float64(math.Float32frombits(x)), 'g', -1, 32))
+            }
+        }
+    case pb.FieldDescriptorProto_TYPE_FIXED64, pb.FieldDescriptorProto_TYPE_SFIXED64, pb.FieldDescriptorProto_TYPE_DOUBLE:
+        for _, x := range opts.RepeatedFixed64(num) {
+            switch ext.GetType() {
+            case pb.FieldDescriptorProto_TYPE_FIXED64:
+                values = append(values, strconv.FormatUint(x, 10))
+            case pb.FieldDescriptorProto_TYPE_SFIXED64:
+                values = append(values, strconv.FormatInt(int64(x), 10))
+            default:
+                values = append(values, strconv.FormatFloat(math.Float64frombits(x), 'g', -1, 64))
+            }
+        }
+    default:
+        for _, x := range opts.RepeatedVarint(num) {
+            switch ext.GetType() {
+            case pb.FieldDescriptorProto_TYPE_BOOL:
+                values = append(values, strconv.FormatBool(x != 0))
+            case pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_UINT64:
+                values = append(values, strconv.FormatUint(x, 10))
+            case pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SINT64:
+                values = append(values, strconv.FormatInt(wire.DecodeZigzag64(x), 10))
+            case pb.FieldDescriptorProto_TYPE_ENUM:
+                values = append(values, enumValueName(gen, ext.GetTypeName(), int32(x)))
+            default:
+                values = append(values, strconv.FormatInt(int64(x), 10))
+            }
+        }
+    }
+    if len(values) > 1 && ext.GetLabel() != pb.FieldDescriptorProto_LABEL_REPEATED {
+        // The last occurrence of a singular option is the one that counts.
+        values = values[len(values)-1:]
+    }
+    return values
+}
+
+// enumValueName returns the name of the value number of the enum typ, or
+// the number itself if it has no name.
+func enumValueName(gen *generator.Generator, typ string, number int32) string {
+    if enum, ok := gen.ObjectNamed(typ).(*generator.EnumDescriptor); ok {
+        for _, v := range enum.Value {
+            if v.GetNumber() == number {
+                return v.GetName()
+            }
+        }
+    }
+    return strconv.Itoa(int(number))
+}
+
+// Options returns the serialized options opts, e.g. the MethodOptions of a
+// method, from which to read the values of custom options: the generator
+// does not know their extensions, which are kept serialized. It returns nil,
+// which reads as an empty message, if opts is nil or fails to serialize.
+func Options(opts proto.Message) *wire.Message {
+    if opts == nil || reflect.ValueOf(opts).IsNil() {
+        return nil
+    }
+    b, err := proto.Marshal(opts)
+    if err != nil {
+        return nil
+    }
+    return wire.NewMessage(b)
+}
+
+// debugRedactOption is the field number of the debug_redact field option,
+// more recent than the descriptor.proto of the generator.
+const debugRedactOption = 16
+
+// IsSensitive reports whether field holds sensitive data, to be redacted
+// from logs and recordings: its debug_redact option, or its custom bool
+// option named sensitive, is set.
+func IsSensitive(gen *generator.Generator, field *pb.FieldDescriptorProto) bool {
+    opts := Options(field.Options)
+    if v, ok := opts.Varint(debugRedactOption); ok && v != 0 {
+        return true
+    }
+    if ext := Extension(gen, ".google.protobuf.FieldOptions", "sensitive"); ext != nil && ext.GetType() == pb.FieldDescriptorProto_TYPE_BOOL {
+        v, ok := opts.Varint(ext.GetNumber())
+        return ok && v != 0
+    }
+    return false
+}
+
+// QuotaCost returns the cost of the calls of method charged to the quota of
+// their caller, given by its custom integer option (quota.cost), and
+// whether it has one. It fails on negative costs.
+func QuotaCost(gen *generator.Generator, method *pb.MethodDescriptorProto) (int64, bool) {
+    ext := Extension(gen, ".google.protobuf.MethodOptions", ".quota.cost")
+    if ext == nil {
+        return 0, false
+    }
+    values := OptionValues(gen, Options(method.Options), ext)
+    if len(values) == 0 {
+        return 0, false
+    }
+    cost, err := strconv.ParseInt(values[0], 10, 64)
+    if err != nil || cost < 0 {
+        gen.Fail("invalid quota.cost option " + values[0] + " of method " + method.GetName() + ": want a non-negative integer")
+    }
+    return cost, true
+}
+
+// RetryOptions are the retry options of a method, as returned by
+// RetryPolicy, from which the generators build their httprpc.RetryPolicy.
+type RetryOptions struct {
+    MaxAttempts    int           // the attempts in total
+    Backoff        time.Duration // the delay before the first retry
+    MaxBackoff     time.Duration // the maximum delay, 0 if none
+    RetryableCodes []string      // the names of the codes of the errors retried, as written
+}
+
+// RetryPolicy returns the retry options of the calls of method, given by
+// its custom options in a retry package: the integer max_attempts, the
+// attempts in total, the strings backoff, the delay before the first retry,
+// 100ms by default, doubled after every retry, and max_backoff, its maximum,
+// in the format of time.ParseDuration, and the repeated string
+// retryable_codes, the codes of the errors retried, e.g. "unavailable" or
+// "UNAVAILABLE", which the generators check with httprpc.ParseCode. It
+// returns whether method has a max_attempts option. It fails on invalid
+// values, and on the other options set without max_attempts.
+func RetryPolicy(gen *generator.Generator, method *pb.MethodDescriptorProto) (RetryOptions, bool) {
+    opts := Options(method.Options)
+    values := func(name string) []string {
+        ext := Extension(gen, ".google.protobuf.MethodOptions", ".retry."+name)
+        if ext == nil {
+            return nil
+        }
+        return OptionValues(gen, opts, ext)
+    }
+    invalid := func(name, value, want string) {
+        gen.Fail("invalid retry." + name + " option " + value + " of method " + method.GetName() + ": want " + want)
+    }
+    duration := func(name string) time.Duration {
+        vs := values(name)
+        if len(vs) == 0 {
+            return 0
+        }
+        v, _ := strconv.Unquote(vs[0])
+        d, err := time.ParseDuration(v)
+        if err != nil || d <= 0 {
+            invalid(name, vs[0], "a positive duration, e.g. \"100ms\"")
+        }
+        return d
+    }
+
+    p := RetryOptions{Backoff: 100 * time.Millisecond}
+    if d := duration("backoff"); d > 0 {
+        p.Backoff = d
+    }
+    p.MaxBackoff = duration("max_backoff")
+    for _, v := range values("retryable_codes") {
+        name, _ := strconv.Unquote(v)
+        p.RetryableCodes = append(p.RetryableCodes, name)
+    }
+    attempts := values("max_attempts")
+    if len(attempts) == 0 {
+        if len(values("backoff"))+len(values("max_backoff"))+len(values("retryable_codes")) > 0 {
+            gen.Fail("the retry options of method " + method.GetName() + " need a retry.max_attempts option")
+        }
+        return p, false
+    }
+    n, err := strconv.Atoi(attempts[0])
+    if err != nil || n < 1 {
+        invalid("max_attempts", attempts[0], "a positive integer")
+    }
+    p.MaxAttempts = n
+    return p, true
+}
+
+// RateLimitOptions are the rate limit options of a method, as returned by
+// RateLimit, generated as an httprpc.RateLimit.
+type RateLimitOptions struct {
+    Rate  float64 // the calls per second
+    Burst int     // the calls allowed at once above the rate
+}
+
+// RateLimit returns the rate limit of the calls of method, given by its
+// custom options in a ratelimit package: the number rate, in calls per
+// second, and the integer burst, the calls allowed at once above it, by
+// default the rate rounded up, and whether it has a rate option. It fails
+// on non-positive values, and on a burst set without a rate.
+func RateLimit(gen *generator.Generator, method *pb.MethodDescriptorProto) (RateLimitOptions, bool) {
+    opts := Options(method.Options)
+    values := func(name string) []string {
+        ext := Extension(gen, ".google.protobuf.MethodOptions", ".ratelimit."+name)
+        if ext == nil {
+            return nil
+        }
+        return OptionValues(gen, opts, ext)
+    }
+    rates, bursts := values("rate"), values("burst")
+    if len(rates) == 0 {
+        if len(bursts) > 0 {
+            gen.Fail("the ratelimit.burst option of method " + method.GetName() + " needs a ratelimit.rate option")
+        }
+        return RateLimitOptions{}, false
+    }
+    rate, err := strconv.ParseFloat(rates[0], 64)
+    if err != nil || !(rate > 0) || math.IsInf(rate, 1) {
+        gen.Fail("invalid ratelimit.rate option " + rates[0] + " of method " + method.GetName() + ": want a positive number of calls per second")
+    }
+    limit := RateLimitOptions{Rate: rate, Burst: int(math.Ceil(rate))}
+    if len(bursts) > 0 {
+        burst, err := strconv.Atoi(bursts[0])
+        if err != nil || burst < 1 {
+            gen.Fail("invalid ratelimit.burst option " + bursts[0] + " of method " + method.GetName() + ": want a positive integer")
+        }
+        limit.Burst = burst
+    }
+    return limit, true
+}
+
+// RateLimitLiteral returns the Go expression of limit as an
+// httprpc.RateLimit, with the httprpc package named httprpcPkg.
+func RateLimitLiteral(limit RateLimitOptions, httprpcPkg string) string {
+    return httprpcPkg + ".RateLimit{Rate: " + strconv.FormatFloat(limit.Rate, 'g', -1, 64) + ", Burst: " + strconv.Itoa(limit.Burst) + "}"
+}
+
+// Scopes returns the scopes required of the callers of method, given by its
+// custom string option (auth.scopes), e.g. "orders.write", repeated for
+// several scopes, in order, or nil if it has none. It fails on empty
+// scopes and on scopes containing spaces.
+func Scopes(gen *generator.Generator, method *pb.MethodDescriptorProto) []string {
+    ext := Extension(gen, ".google.protobuf.MethodOptions", ".auth.scopes")
+    if ext == nil {
+        return nil
+    }
+    var scopes []string
+    for _, v := range OptionValues(gen, Options(method.Options), ext) {
+        scope, _ := strconv.Unquote(v)
+        if scope == "" || strings.ContainsAny(scope, " \t\n") {
+            gen.Fail("invalid auth.scopes option " + v + " of method " + method.GetName() + ": want a scope without spaces, e.g. \"orders.write\"")
+        }
+        scopes = append(scopes, scope)
+    }
+    return scopes
+}
+
+// QuotedScopes returns scopes as a list of Go string literals separated by
+// commas, the arguments of httprpc.CheckScopes.
+func QuotedScopes(scopes []string) string {
+    quoted := make([]string, len(scopes))
+    for i, scope := range scopes {
+        quoted[i] = strconv.Quote(scope)
+    }
+    return strings.Join(quoted, ", ")
+}
+
+// httpRuleExtension is the field number of the google.api.http method
+// option, read from the serialized options so that google/api/http.proto
+// need not be known to the generator.
+const httpRuleExtension = 72295728
+
+// HTTPRule is a route of a method, as mapped by google.api.http.
+type HTTPRule struct {
+    Method       string // HTTP method
+    Pattern      string // path template
+    Body         string // field set from the request body, "*" or ""
+    ResponseBody string // field written as the response body, or ""
+}
+
+// HTTPRules returns the routes of method given by its google.api.http
+// option, additional bindings included.
+func HTTPRules(method *pb.MethodDescriptorProto) []HTTPRule {
+    raw, ok := Options(method.Options).Message(httpRuleExtension)
+    if !ok {
+        return nil
+    }
+    rule := wire.NewMessage(raw)
+    rules := appendHTTPRule(nil, rule)
+    for _, b := range rule.RepeatedLengthDelimited(11) { // additional_bindings
+        rules = appendHTTPRule(rules, wire.NewMessage(b))
+    }
+    return rules
+}
+
+// appendHTTPRule appends the route of the HttpRule message m to rules.
+func appendHTTPRule(rules []HTTPRule, m *wire.Message) []HTTPRule {
+    var r HTTPRule
+    for i, method := range []string{"GET", "PUT", "POST", "DELETE", "PATCH"} {
+        if p, ok := m.LengthDelimited(int32(i + 2)); ok { // get = 2 to patch = 6
+            r.Method, r.Pattern = method, string(p)
+        }
+    }
+    if custom, ok := m.Message(8); ok {
+        c := wire.NewMessage(custom)
+        kind, _ := c.LengthDelimited(1)
+        p, _ := c.LengthDelimited(2)
+        r.Method, r.Pattern = string(kind), string(p)
+    }
+    if r.Method == "" {
+        return rules
+    }
+    body, _ := m.LengthDelimited(7)
+    responseBody, _ := m.LengthDelimited(12)
+    r.Body, r.ResponseBody = string(body), string(responseBody)
+    return append(rules, r)
+}
@@ -0,0 +1,6 @@
+// Package version identifies this protoc-gen-go in the generated code.
+package version
+
+// Version is the version of the generator. It is recorded in the generated
+// files that embed it, and must be updated whenever the output changes.
+const Version = "0.1.0"
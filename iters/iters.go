@@ -0,0 +1,133 @@
+// Package iters outputs the iterator accessors of the repeated and map
+// fields.
+//
+// For every repeated field foo of a message it generates an
+// AllFoo() iter.Seq[T] method returning an iterator over its elements, and
+// for every map field an AllFoo() iter.Seq2[K, V] method returning an
+// iterator over its entries, in the unspecified order of Go maps, so that
+// the fields can be ranged over with range-over-func, e.g. by the
+// functions of package slices and maps, rather than copied. No accessor is
+// generated whose name would be taken by a field. The generated code needs
+// Go 1.23.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package iters
+
+import (
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const iterPkgPath = "iter"
+
+// iterPkg is the name of the iter package in the generated code, which
+// may vary from "iter" if the name is used by other packages.
+var iterPkg string
+
+func init() {
+    generator.RegisterPlugin(new(iters))
+}
+
+// iters is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the iterator accessors of the repeated and map
+// fields.
+type iters struct {
+    gen *generator.Generator
+
+    usesIter bool // the file being generated uses the iter package
+}
+
+// Name returns the name of this plugin, "iters".
+func (i *iters) Name() string {
+    return "iters"
+}
+
+// Init initializes the plugin.
+func (i *iters) Init(gen *generator.Generator) {
+    i.gen = gen
+    iterPkg = generator.RegisterUniquePackageName("iter", nil)
+}
+
+// P forwards to i.gen.P.
+func (i *iters) P(args ...interface{}) { i.gen.P(args...) }
+
+// Generate generates the iterator accessors of the messages in the given
+// file.
+func (i *iters) Generate(file *generator.FileDescriptor) {
+    i.usesIter = false
+    if !descutil.IsGenerated(i.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(i.gen, file) {
+        i.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (i *iters) GenerateImports(file *generator.FileDescriptor) {
+    if !i.usesIter {
+        return
+    }
+    i.P("import ", iterPkg, " ", strconv.Quote(iterPkgPath))
+    i.P()
+}
+
+// generateMessage generates the iterator accessors of the repeated and map
+// fields of msg.
+func (i *iters) generateMessage(msg *generator.Descriptor) {
+    typeName := i.gen.TypeName(msg)
+    names := make(map[string]bool)
+    for _, field := range msg.Field {
+        names[generator.CamelCase(field.GetName())] = true
+    }
+    for _, oneof := range msg.OneofDecl {
+        names[generator.CamelCase(oneof.GetName())] = true
+    }
+    for _, field := range msg.Field {
+        if field.GetLabel() != pb.FieldDescriptorProto_LABEL_REPEATED {
+            continue
+        }
+        fieldName := generator.CamelCase(field.GetName())
+        method := "All" + fieldName
+        if names[method] {
+            continue
+        }
+
+        i.usesIter = true
+        if entry := descutil.MapEntry(i.gen, field); entry != nil {
+            keyType, _ := i.gen.GoType(entry, entry.Field[0])
+            valueType, _ := i.gen.GoType(entry, entry.Field[1])
+            i.P("// ", method, " returns an iterator over the entries of the ", field.GetName(), " field of m,")
+            i.P("// in no particular order.")
+            i.P("func (m *", typeName, ") ", method, "() ", iterPkg, ".Seq2[", keyType, ", ", valueType, "] {")
+            i.P("return func(yield func(", keyType, ", ", valueType, ") bool) {")
+            i.P("for k, v := range m.Get", fieldName, "() {")
+            i.P("if !yield(k, v) {")
+            i.P("return")
+            i.P("}")
+            i.P("}")
+            i.P("}")
+            i.P("}")
+            i.P()
+            continue
+        }
+        goType, _ := i.gen.GoType(msg, field)
+        elemType := goType[len("[]"):]
+        i.P("// ", method, " returns an iterator over the elements of the ", field.GetName(), " field of m,")
+        i.P("// in order.")
+        i.P("func (m *", typeName, ") ", method, "() ", iterPkg, ".Seq[", elemType, "] {")
+        i.P("return func(yield func(", elemType, ") bool) {")
+        i.P("for _, v := range m.Get", fieldName, "() {")
+        i.P("if !yield(v) {")
+        i.P("return")
+        i.P("}")
+        i.P("}")
+        i.P("}")
+        i.P("}")
+        i.P()
+    }
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "bytes"
+    "go/format"
+    "strconv"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// markInt64Numbers appends to the generated Go files a JSONInt64Numbers
+// method for each of their messages, by which the JSON encoders of the
+// httprpc package know to encode their 64-bit integers as numbers.
+func markInt64Numbers(g *generator.Generator) {
+    appendMethods(g, func(typeName string) string {
+        return "// JSONInt64Numbers marks " + typeName + " as having its 64-bit integers encoded\n" +
+            "// in JSON as numbers rather than strings, as generated with int64_json=number.\n" +
+            "func (*" + typeName + ") JSONInt64Numbers() {}\n"
+    })
+}
+
+// markEnumNumbers appends to the generated Go files a JSONEnumNumbers
+// method for each of their messages, by which the JSON encoders of the
+// httprpc package know to encode their enums as numbers.
+func markEnumNumbers(g *generator.Generator) {
+    appendMethods(g, func(typeName string) string {
+        return "// JSONEnumNumbers marks " + typeName + " as having its enums encoded in JSON as\n" +
+            "// numbers rather than names, as generated with enum_json=number.\n" +
+            "func (*" + typeName + ") JSONEnumNumbers() {}\n"
+    })
+}
+
+// markRejectUnknownEnums appends to the generated Go files a
+// JSONRejectUnknownEnums method for each of their messages, by which the
+// JSON decoders of the httprpc package know to reject their enum values
+// unknown to their enum.
+func markRejectUnknownEnums(g *generator.Generator) {
+    appendMethods(g, func(typeName string) string {
+        return "// JSONRejectUnknownEnums marks " + typeName + " as having its enum values unknown\n" +
+            "// to their enum rejected on JSON input, as generated with\n" +
+            "// enum_json_unknown=reject.\n" +
+            "func (*" + typeName + ") JSONRejectUnknownEnums() {}\n"
+    })
+}
+
+// markTimestamps appends to the generated Go files a JSONTimestampFormat
+// method for each of their messages, by which the JSON encoders and
+// decoders of the httprpc package know the format and zone of their
+// timestamps.
+func markTimestamps(g *generator.Generator, format, zone string) {
+    appendMethods(g, func(typeName string) string {
+        return "// JSONTimestampFormat returns the format and time zone of the timestamps of\n" +
+            "// " + typeName + " in JSON, as generated with the timestamp_json and timestamp_zone\n" +
+            "// parameters.\n" +
+            "func (*" + typeName + ") JSONTimestampFormat() (format, zone string) {\n" +
+            "return " + strconv.Quote(format) + ", " + strconv.Quote(zone) + "\n" +
+            "}\n"
+    })
+}
+
+// appendMethods appends to the generated Go files the source of a method
+// returned by method for each of their messages, given its type name.
+// It runs before the files are renamed, by paths= or module=.
+func appendMethods(g *generator.Generator, method func(typeName string) string) {
+    for _, name := range g.Request.FileToGenerate {
+        var fd *pb.FileDescriptorProto
+        for _, f := range g.Request.ProtoFile {
+            if f.GetName() == name {
+                fd = f
+            }
+        }
+        var b bytes.Buffer
+        for _, msg := range descutil.Messages(g, g.FileOf(fd)) {
+            b.WriteString("\n" + method(generator.CamelCaseSlice(msg.TypeName())))
+        }
+        goName := descutil.GoFileName(fd, false)
+        for _, f := range g.Response.File {
+            if f.GetName() == goName {
+                src, err := format.Source([]byte(f.GetContent() + b.String()))
+                if err != nil {
+                    g.Error(err, "failed to format the marked Go code")
+                }
+                f.Content = proto.String(string(src))
+            }
+        }
+    }
+}
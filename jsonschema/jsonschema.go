@@ -0,0 +1,268 @@
+// Package jsonschema outputs the JSON Schemas of the JSON mapping of the
+// messages.
+//
+// For every message of the files to generate it writes a JSON Schema, draft
+// 2020-12, named after the full name of the message, e.g.
+// greeting.Foo.schema.json, next to the Go file of its file, to validate
+// the JSON payloads of the serialized API, e.g. in the frontends. The
+// schemas follow the proto3 JSON mapping: the properties are named after
+// the JSON names of the fields, the 64-bit integers are strings, the enums
+// the names of their values, the bytes base64 strings and the well-known
+// types have their special encoding. The int64_json, enum_json and
+// timestamp_json parameters change them as they change the JSON encodings.
+// The comments of the messages, fields and enums are their descriptions,
+// and the fields of a oneof exclude one another. The messages and enums the
+// message refers to are defined in $defs, by full name.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package jsonschema
+
+import (
+    "encoding/json"
+    "fmt"
+    "path"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/httprpc"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// dialect is the URI of the JSON Schema dialect of the schemas.
+const dialect = "https://json-schema.org/draft/2020-12/schema"
+
+func init() {
+    generator.RegisterPlugin(new(jsonschema))
+}
+
+// jsonschema is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates JSON Schemas.
+type jsonschema struct {
+    gen          *generator.Generator
+    int64Numbers bool // int64_json=number: 64-bit integers are JSON numbers, not strings
+    enumNumbers  bool // enum_json=number: enums are JSON numbers, not names
+
+    unixMillis bool // timestamp_json=unix_millis: timestamps are JSON numbers of milliseconds
+
+    root string                 // fully-qualified name of the message of the schema being generated
+    defs map[string]interface{} // definitions of the schema being generated
+}
+
+// object is a JSON object of a schema. Its keys are sorted on output.
+type object map[string]interface{}
+
+// int64Pattern matches the decimal integers, as the 64-bit integers are
+// encoded in JSON strings.
+const int64Pattern = "^-?[0-9]+$"
+
+// wellKnownSchemas maps the well-known types having a special JSON mapping
+// to their schema.
+var wellKnownSchemas = map[string]object{
+    ".google.protobuf.Any":         {"type": "object", "properties": object{"@type": object{"type": "string"}}, "required": []interface{}{"@type"}},
+    ".google.protobuf.Duration":    {"type": "string", "pattern": `^-?[0-9]+(\.[0-9]{1,9})?s$`},
+    ".google.protobuf.Empty":       {"type": "object", "maxProperties": 0},
+    ".google.protobuf.FieldMask":   {"type": "string"},
+    ".google.protobuf.ListValue":   {"type": "array"},
+    ".google.protobuf.Struct":      {"type": "object"},
+    ".google.protobuf.Timestamp":   {"type": "string", "format": "date-time"},
+    ".google.protobuf.Value":       {},
+    ".google.protobuf.BoolValue":   {"type": []interface{}{"boolean", "null"}},
+    ".google.protobuf.BytesValue":  {"type": []interface{}{"string", "null"}, "contentEncoding": "base64"},
+    ".google.protobuf.DoubleValue": {"type": []interface{}{"number", "null"}},
+    ".google.protobuf.FloatValue":  {"type": []interface{}{"number", "null"}},
+    ".google.protobuf.Int32Value":  {"type": []interface{}{"integer", "null"}},
+    ".google.protobuf.Int64Value":  {"type": []interface{}{"string", "null"}, "pattern": int64Pattern},
+    ".google.protobuf.StringValue": {"type": []interface{}{"string", "null"}},
+    ".google.protobuf.UInt32Value": {"type": []interface{}{"integer", "null"}, "minimum": 0},
+    ".google.protobuf.UInt64Value": {"type": []interface{}{"string", "null"}, "pattern": "^[0-9]+$"},
+}
+
+// Name returns the name of this plugin, "jsonschema".
+func (j *jsonschema) Name() string {
+    return "jsonschema"
+}
+
+// Init initializes the plugin.
+func (j *jsonschema) Init(gen *generator.Generator) {
+    j.gen = gen
+    j.int64Numbers = descutil.Int64JSONNumbers(gen)
+    j.enumNumbers, _ = descutil.EnumJSON(gen)
+    format, _ := descutil.TimestampJSON(gen)
+    j.unixMillis = format == httprpc.TimestampUnixMillis
+}
+
+// Generate writes the JSON Schemas of the messages of the given file.
+func (j *jsonschema) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(j.gen, file.GetName()) {
+        return
+    }
+    dir := path.Dir(descutil.OutputName(j.gen, file.FileDescriptorProto, ".schema.json"))
+    for _, msg := range descutil.Messages(j.gen, file) {
+        name := strings.Join(msg.TypeName(), ".")
+        if pkg := msg.File().GetPackage(); pkg != "" {
+            name = pkg + "." + name
+        }
+        j.root, j.defs = "."+name, make(map[string]interface{})
+        schema := j.messageSchema(msg)
+        schema["$schema"] = dialect
+        schema["$id"] = name + ".schema.json"
+        schema["title"] = name
+        if len(j.defs) > 0 {
+            schema["$defs"] = object(j.defs)
+        }
+        data, err := json.MarshalIndent(schema, "", "  ")
+        if err != nil {
+            j.gen.Error(err, "failed to encode the JSON Schema")
+        }
+        descutil.AddFile(j.gen, path.Join(dir, name+".schema.json"), string(data)+"\n")
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (j *jsonschema) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// ref returns the schema of the message or enum typ: a reference to its
+// definition, added if needed, or to the root of the schema, or the schema
+// of a well-known type.
+func (j *jsonschema) ref(typ string) object {
+    if schema, ok := wellKnownSchemas[typ]; ok {
+        copied := make(object)
+        for k, v := range schema {
+            copied[k] = v
+        }
+        if j.int64Numbers && copied["pattern"] != nil && typ != ".google.protobuf.Duration" {
+            copied["type"] = []interface{}{"integer", "null"}
+            delete(copied, "pattern")
+            if typ == ".google.protobuf.UInt64Value" {
+                copied["minimum"] = 0
+            }
+        }
+        if j.unixMillis && typ == ".google.protobuf.Timestamp" {
+            copied = object{"type": "integer", "description": "Milliseconds since the Unix epoch."}
+        }
+        return copied
+    }
+    if typ == j.root {
+        return object{"$ref": "#"}
+    }
+    name := strings.TrimPrefix(typ, ".")
+    if _, ok := j.defs[name]; !ok {
+        j.defs[name] = object{} // before the fields, for recursive messages
+        switch obj := j.gen.ObjectNamed(typ).(type) {
+        case *generator.EnumDescriptor:
+            j.defs[name] = j.enumSchema(obj)
+        case *generator.Descriptor:
+            j.defs[name] = j.messageSchema(obj)
+        }
+    }
+    return object{"$ref": "#/$defs/" + name}
+}
+
+// messageSchema returns the schema of msg.
+func (j *jsonschema) messageSchema(msg *generator.Descriptor) object {
+    schema := object{"type": "object"}
+    msgPath := descutil.MessagePath(msg)
+    if comments := descutil.LeadingComments(msg.File(), msgPath); comments != "" {
+        schema["description"] = comments
+    }
+    properties := make(object)
+    oneofs := make([][]string, len(msg.OneofDecl))
+    for i, field := range msg.Field {
+        s := j.fieldSchema(field)
+        if comments := descutil.LeadingComments(msg.File(), fmt.Sprintf("%s,2,%d", msgPath, i)); comments != "" {
+            s["description"] = comments
+        }
+        properties[descutil.JSONName(field)] = s
+        if field.OneofIndex != nil {
+            oneofs[field.GetOneofIndex()] = append(oneofs[field.GetOneofIndex()], descutil.JSONName(field))
+        }
+    }
+    if len(properties) > 0 {
+        schema["properties"] = properties
+    }
+    // A field of a oneof excludes the others.
+    dependents := make(object)
+    for _, names := range oneofs {
+        for _, name := range names {
+            others := make(object)
+            for _, other := range names {
+                if other != name {
+                    others[other] = false
+                }
+            }
+            if len(others) > 0 {
+                dependents[name] = object{"properties": others}
+            }
+        }
+    }
+    if len(dependents) > 0 {
+        schema["dependentSchemas"] = dependents
+    }
+    return schema
+}
+
+// enumSchema returns the schema of enum.
+func (j *jsonschema) enumSchema(enum *generator.EnumDescriptor) object {
+    var values []interface{}
+    seen := make(map[int32]bool)
+    for _, v := range enum.Value {
+        if !j.enumNumbers {
+            values = append(values, v.GetName())
+        } else if !seen[v.GetNumber()] {
+            seen[v.GetNumber()] = true
+            values = append(values, v.GetNumber())
+        }
+    }
+    schema := object{"enum": values}
+    if comments := descutil.LeadingComments(enum.File(), descutil.EnumPath(enum)); comments != "" {
+        schema["description"] = comments
+    }
+    return schema
+}
+
+// fieldSchema returns the schema of the value of field: an array for
+// repeated fields, an object for maps.
+func (j *jsonschema) fieldSchema(field *pb.FieldDescriptorProto) object {
+    if field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE {
+        if entry, ok := j.gen.ObjectNamed(field.GetTypeName()).(*generator.Descriptor); ok && entry.GetOptions().GetMapEntry() {
+            return object{"type": "object", "additionalProperties": j.valueSchema(entry.Field[1])}
+        }
+    }
+    if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+        return object{"type": "array", "items": j.valueSchema(field)}
+    }
+    return j.valueSchema(field)
+}
+
+// valueSchema returns the schema of a single value of field.
+func (j *jsonschema) valueSchema(field *pb.FieldDescriptorProto) object {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        return object{"type": "boolean"}
+    case pb.FieldDescriptorProto_TYPE_STRING:
+        return object{"type": "string"}
+    case pb.FieldDescriptorProto_TYPE_BYTES:
+        return object{"type": "string", "contentEncoding": "base64"}
+    case pb.FieldDescriptorProto_TYPE_INT32, pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SFIXED32:
+        return object{"type": "integer", "minimum": -1 << 31, "maximum": 1<<31 - 1}
+    case pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_FIXED32:
+        return object{"type": "integer", "minimum": 0, "maximum": 1<<32 - 1}
+    case pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_SINT64, pb.FieldDescriptorProto_TYPE_SFIXED64:
+        if j.int64Numbers {
+            return object{"type": "integer"}
+        }
+        return object{"type": "string", "pattern": int64Pattern}
+    case pb.FieldDescriptorProto_TYPE_UINT64, pb.FieldDescriptorProto_TYPE_FIXED64:
+        if j.int64Numbers {
+            return object{"type": "integer", "minimum": 0}
+        }
+        return object{"type": "string", "pattern": "^[0-9]+$"}
+    case pb.FieldDescriptorProto_TYPE_FLOAT, pb.FieldDescriptorProto_TYPE_DOUBLE:
+        // The special values are strings.
+        return object{"anyOf": []interface{}{object{"type": "number"}, object{"enum": []interface{}{"NaN", "Infinity", "-Infinity"}}}}
+    }
+    return j.ref(field.GetTypeName())
+}
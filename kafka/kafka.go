@@ -0,0 +1,277 @@
+// Package kafka outputs the Kafka codecs of the messages, and consumer loops
+// dispatching the records of topics to the methods of the services.
+//
+// For every message Foo it generates MarshalFooKafka(m *Foo) ([]byte,
+// error), returning m serialized as the value of a Kafka record, and
+// UnmarshalFooKafka(value []byte) (*Foo, error), decoding a value so
+// serialized. With the kafka_confluent=true parameter, the values are in the
+// Confluent wire format of the schema registries: the serialized message
+// follows the ID of its schema, FooKafkaSchemaID, which the producers set
+// once the schema is registered, and the indexes of the message type in its
+// file, which UnmarshalFooKafka checks.
+//
+// For every service Foo it generates a FooKafkaHandler interface, with a
+// Bar(ctx context.Context, in *BarRequest) error method per unary method
+// Bar, and ConsumeFooKafka(ctx context.Context, c kafkacodec.Consumer, h
+// FooKafkaHandler) error, reading the records of c, decoding their values
+// as the input of the method of their topic in FooKafkaTopics, by default
+// the full name of the method, and calling h with it, so that the event
+// pipelines need no hand-written codecs.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package kafka
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const kafkacodecPkgPath = "github.com/lleveque/protoc-gen-go/kafkacodec"
+
+// importPaths are the packages the generated code may use.
+var importPaths = []string{"context", "fmt", kafkacodecPkgPath}
+
+func init() {
+    generator.RegisterPlugin(new(kafka))
+}
+
+// kafka is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the Kafka codecs of the messages and the
+// consumer loops of the services.
+type kafka struct {
+    gen *generator.Generator
+
+    confluent bool // kafka_confluent=true: the values are in the Confluent wire format
+
+    pkgNames map[string]string // names of the packages of importPaths
+    used     map[string]bool   // packages of importPaths used by the file being generated
+}
+
+// Name returns the name of this plugin, "kafka".
+func (k *kafka) Name() string {
+    return "kafka"
+}
+
+// Init initializes the plugin.
+func (k *kafka) Init(gen *generator.Generator) {
+    k.gen = gen
+    k.confluent = descutil.BoolParam(gen, "kafka_confluent")
+    k.pkgNames = make(map[string]string)
+    for _, path := range importPaths {
+        k.pkgNames[path] = generator.RegisterUniquePackageName(path[strings.LastIndex(path, "/")+1:], nil)
+    }
+}
+
+// P forwards to k.gen.P.
+func (k *kafka) P(args ...interface{}) { k.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (k *kafka) pkg(importPath string) string {
+    k.used[importPath] = true
+    return k.pkgNames[importPath]
+}
+
+// typeName returns the Go name of the type of fully-qualified name str.
+func (k *kafka) typeName(str string) string {
+    k.gen.RecordTypeUse(str)
+    return k.gen.TypeName(k.gen.ObjectNamed(str))
+}
+
+// Generate generates the Kafka codecs of the messages, and the consumer
+// loops of the services, in the given file.
+func (k *kafka) Generate(file *generator.FileDescriptor) {
+    k.used = make(map[string]bool)
+    if !descutil.IsGenerated(k.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(k.gen, file) {
+        k.generateMessage(msg)
+    }
+    for _, service := range file.FileDescriptorProto.Service {
+        k.generateService(file, service)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (k *kafka) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range k.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    k.P("import (")
+    for _, path := range paths {
+        k.P(k.pkgNames[path], " ", strconv.Quote(path))
+    }
+    k.P(")")
+    k.P()
+}
+
+// generateMessage generates the Kafka codec of msg.
+func (k *kafka) generateMessage(msg *generator.Descriptor) {
+    typeName := k.gen.TypeName(msg)
+    proto := k.gen.Pkg["proto"]
+    if !k.confluent {
+        k.P("// Marshal", typeName, "Kafka returns m serialized as the value of a Kafka record.")
+        k.P("func Marshal", typeName, "Kafka(m *", typeName, ") ([]byte, error) {")
+        k.P("return ", proto, ".Marshal(m)")
+        k.P("}")
+        k.P()
+        k.P("// Unmarshal", typeName, "Kafka decodes the value of a Kafka record as a ", typeName, ".")
+        k.P("func Unmarshal", typeName, "Kafka(value []byte) (*", typeName, ", error) {")
+        k.P("m := new(", typeName, ")")
+        k.P("if err := ", proto, ".Unmarshal(value, m); err != nil {")
+        k.P("return nil, err")
+        k.P("}")
+        k.P("return m, nil")
+        k.P("}")
+        k.P()
+        return
+    }
+    kafkacodec, fmtPkg := k.pkg(kafkacodecPkgPath), k.pkg("fmt")
+    indexes := messageIndexes(msg)
+    mismatch := "len(indexes) != " + strconv.Itoa(len(indexes))
+    for i, index := range indexes {
+        mismatch += " || indexes[" + strconv.Itoa(i) + "] != " + index
+    }
+    k.P("// ", typeName, "KafkaSchemaID is the ID of the schema of ", typeName, " in the schema")
+    k.P("// registry, written in the values of the records by Marshal", typeName, "Kafka. It")
+    k.P("// must be set once the schema is registered.")
+    k.P("var ", typeName, "KafkaSchemaID int32")
+    k.P()
+    k.P("// ", unexport(typeName), "KafkaIndexes are the indexes of ", typeName, " in its file.")
+    k.P("var ", unexport(typeName), "KafkaIndexes = []int{", strings.Join(indexes, ", "), "}")
+    k.P()
+    k.P("// Marshal", typeName, "Kafka returns m serialized as the value of a Kafka record,")
+    k.P("// in the Confluent wire format, of schema ID ", typeName, "KafkaSchemaID.")
+    k.P("func Marshal", typeName, "Kafka(m *", typeName, ") ([]byte, error) {")
+    k.P("b, err := ", proto, ".Marshal(m)")
+    k.P("if err != nil {")
+    k.P("return nil, err")
+    k.P("}")
+    k.P("return append(", kafkacodec, ".AppendConfluentHeader(nil, ", typeName, "KafkaSchemaID, ", unexport(typeName), "KafkaIndexes), b...), nil")
+    k.P("}")
+    k.P()
+    k.P("// Unmarshal", typeName, "Kafka decodes the value of a Kafka record, in the Confluent")
+    k.P("// wire format, as a ", typeName, ". Its schema may have any ID, but the indexes")
+    k.P("// of its message type must be the ones of ", typeName, ".")
+    k.P("func Unmarshal", typeName, "Kafka(value []byte) (*", typeName, ", error) {")
+    k.P("_, indexes, payload, err := ", kafkacodec, ".ParseConfluent(value)")
+    k.P("if err != nil {")
+    k.P("return nil, err")
+    k.P("}")
+    k.P("if ", mismatch, " {")
+    k.P("return nil, ", fmtPkg, `.Errorf("unmarshaling `, typeName, `: got the message indexes %v, want %v", indexes, `, unexport(typeName), "KafkaIndexes)")
+    k.P("}")
+    k.P("m := new(", typeName, ")")
+    k.P("if err := ", proto, ".Unmarshal(payload, m); err != nil {")
+    k.P("return nil, err")
+    k.P("}")
+    k.P("return m, nil")
+    k.P("}")
+    k.P()
+}
+
+// generateService generates the handler interface and the consumer loop of
+// service.
+func (k *kafka) generateService(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto) {
+    fullServName := service.GetName()
+    if pkg := file.GetPackage(); pkg != "" {
+        fullServName = pkg + "." + fullServName
+    }
+    servName := generator.CamelCase(service.GetName())
+    handlerName := servName + "KafkaHandler"
+    var methods []*pb.MethodDescriptorProto
+    for _, method := range service.Method {
+        if !method.GetClientStreaming() && !method.GetServerStreaming() {
+            methods = append(methods, method)
+        }
+    }
+    if len(methods) == 0 {
+        return
+    }
+    context, kafkacodec, fmtPkg := k.pkg("context"), k.pkg(kafkacodecPkgPath), k.pkg("fmt")
+
+    k.P("// ", servName, "KafkaTopics maps the Kafka topics consumed by Consume", servName, "Kafka to")
+    k.P("// the names of the ", servName, " methods handling their records, by default the")
+    k.P("// full names of the methods.")
+    k.P("var ", servName, "KafkaTopics = map[string]string{")
+    for _, method := range methods {
+        k.P(strconv.Quote(fullServName+"."+method.GetName()), ": ", strconv.Quote(method.GetName()), ",")
+    }
+    k.P("}")
+    k.P()
+    k.P("// ", handlerName, " handles the records of the topics of the unary ", servName)
+    k.P("// methods, decoded as their input. Their output, if any, is left to the")
+    k.P("// handlers to produce.")
+    k.P("type ", handlerName, " interface {")
+    for _, method := range methods {
+        k.P(generator.CamelCase(method.GetName()), "(ctx ", context, ".Context, in *", k.typeName(method.GetInputType()), ") error")
+    }
+    k.P("}")
+    k.P()
+    k.P("// Consume", servName, "Kafka reads the records of c, decodes the value of each as")
+    k.P("// the input of the method of its topic in ", servName, "KafkaTopics and calls h with")
+    k.P("// it, committing the record once handled, until ctx is done or c fails. It")
+    k.P("// returns the first error of a handler, or decoding a record, without")
+    k.P("// committing the record, so that it is consumed again on restart.")
+    k.P("func Consume", servName, "Kafka(ctx ", context, ".Context, c ", kafkacodec, ".Consumer, h ", handlerName, ") error {")
+    k.P("for {")
+    k.P("r, err := c.Fetch(ctx)")
+    k.P("if err != nil {")
+    k.P("return err")
+    k.P("}")
+    k.P("value := r.Value")
+    if k.confluent {
+        k.P("if _, _, value, err = ", kafkacodec, ".ParseConfluent(value); err != nil {")
+        k.P("return ", fmtPkg, `.Errorf("record %d of partition %d of topic %s: %v", r.Offset, r.Partition, r.Topic, err)`)
+        k.P("}")
+    }
+    k.P("switch method := ", servName, "KafkaTopics[r.Topic]; method {")
+    for _, method := range methods {
+        k.P("case ", strconv.Quote(method.GetName()), ":")
+        k.P("in := new(", k.typeName(method.GetInputType()), ")")
+        k.P("if err := ", k.gen.Pkg["proto"], ".Unmarshal(value, in); err != nil {")
+        k.P("return ", fmtPkg, `.Errorf("record %d of partition %d of topic %s: %v", r.Offset, r.Partition, r.Topic, err)`)
+        k.P("}")
+        k.P("err = h.", generator.CamelCase(method.GetName()), "(ctx, in)")
+    }
+    k.P("default:")
+    k.P("err = ", fmtPkg, `.Errorf("no `, servName, ` method handles the records of topic %s", r.Topic)`)
+    k.P("}")
+    k.P("if err != nil {")
+    k.P("return err")
+    k.P("}")
+    k.P("if err := c.Commit(ctx, r); err != nil {")
+    k.P("return err")
+    k.P("}")
+    k.P("}")
+    k.P("}")
+    k.P()
+}
+
+// messageIndexes returns the indexes of msg in its file, and in the
+// messages it is nested in, as written in the Confluent wire format.
+func messageIndexes(msg *generator.Descriptor) []string {
+    path := strings.Split(descutil.MessagePath(msg), ",")
+    var indexes []string
+    for i := 1; i < len(path); i += 2 {
+        indexes = append(indexes, path[i])
+    }
+    return indexes
+}
+
+// unexport returns s with its first letter lowered.
+func unexport(s string) string {
+    return strings.ToLower(s[:1]) + s[1:]
+}
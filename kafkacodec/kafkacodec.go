@@ -0,0 +1,92 @@
+// Package kafkacodec encodes messages in Kafka records.
+//
+// It backs the Kafka codecs and consumer loops generated by the kafka
+// plugin: the Confluent wire format, in which the serialized messages are
+// prefixed by the ID of their schema in a schema registry, and the Consumer
+// the loops read the records from.
+package kafkacodec
+
+import (
+    "context"
+    "encoding/binary"
+    "errors"
+)
+
+// confluentMagic is the first byte of the values in the Confluent wire
+// format.
+const confluentMagic = 0
+
+// ErrNotConfluent is returned for the values which do not start with a
+// valid Confluent header.
+var ErrNotConfluent = errors.New("kafkacodec: no Confluent wire format header")
+
+// AppendConfluentHeader appends to dst the Confluent wire format header of
+// a serialized protobuf message whose schema has the ID schemaID in the
+// schema registry: the magic byte 0, the schema ID, 4 bytes big-endian, and
+// the indexes of the message type in the schema, e.g. [0] for the first
+// message of the file or [1, 2] for the third message nested in the second,
+// which the serialized message follows.
+func AppendConfluentHeader(dst []byte, schemaID int32, indexes []int) []byte {
+    dst = append(dst, confluentMagic, 0, 0, 0, 0)
+    binary.BigEndian.PutUint32(dst[len(dst)-4:], uint32(schemaID))
+    if len(indexes) == 1 && indexes[0] == 0 {
+        // The first message, the most common, is written as a single 0.
+        return append(dst, 0)
+    }
+    var buf [binary.MaxVarintLen64]byte
+    dst = append(dst, buf[:binary.PutVarint(buf[:], int64(len(indexes)))]...)
+    for _, i := range indexes {
+        dst = append(dst, buf[:binary.PutVarint(buf[:], int64(i))]...)
+    }
+    return dst
+}
+
+// ParseConfluent splits a value in the Confluent wire format into the ID of
+// the schema of its message, the indexes of the message type in the schema
+// and the serialized message. It returns ErrNotConfluent if the value does
+// not start with a valid header.
+func ParseConfluent(value []byte) (schemaID int32, indexes []int, payload []byte, err error) {
+    if len(value) < 6 || value[0] != confluentMagic {
+        return 0, nil, nil, ErrNotConfluent
+    }
+    schemaID = int32(binary.BigEndian.Uint32(value[1:]))
+    rest := value[5:]
+    n, size := binary.Varint(rest)
+    if size <= 0 || n < 0 || n > int64(len(rest)) {
+        return 0, nil, nil, ErrNotConfluent
+    }
+    rest = rest[size:]
+    if n == 0 {
+        return schemaID, []int{0}, rest, nil
+    }
+    indexes = make([]int, n)
+    for i := range indexes {
+        index, size := binary.Varint(rest)
+        if size <= 0 || index < 0 {
+            return 0, nil, nil, ErrNotConfluent
+        }
+        indexes[i], rest = int(index), rest[size:]
+    }
+    return schemaID, indexes, rest, nil
+}
+
+// Record is a record of a Kafka topic.
+type Record struct {
+    Topic     string
+    Partition int32
+    Offset    int64
+    Key       []byte
+    Value     []byte
+}
+
+// Consumer is the part of a Kafka consumer the consumer loops use, e.g. an
+// adapter of a consumer group reader of github.com/segmentio/kafka-go or
+// github.com/twmb/franz-go.
+type Consumer interface {
+    // Fetch returns the next record of the topics consumed, waiting for one
+    // until ctx is done.
+    Fetch(ctx context.Context) (Record, error)
+
+    // Commit commits the offset of r, once handled.
+    Commit(ctx context.Context, r Record) error
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "go/ast"
+    "go/format"
+    "go/parser"
+    "go/token"
+    "sort"
+    "strings"
+    "unicode"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// fieldLayout is the place of a field in the memory of its struct.
+type fieldLayout struct {
+    name   string // name of the field
+    typ    string // Go type of the field
+    size   int64
+    align  int64
+    offset int64
+}
+
+// structLayout is the memory layout of the struct of a message, on 64-bit
+// platforms.
+type structLayout struct {
+    name   string // name of the struct
+    fields []fieldLayout
+    size   int64
+}
+
+// padding returns the number of bytes of s not holding fields.
+func (s structLayout) padding() int64 {
+    padding := s.size
+    for _, f := range s.fields {
+        padding -= f.size
+    }
+    return padding
+}
+
+// layoutStructs reports and optimizes the memory layout of the structs of
+// the messages of the generated files: with pack, their fields are
+// reordered by decreasing alignment, which leaves no padding between them,
+// and with report, a report of their size, field offsets and padding is
+// written next to each Go file, as foo.layout.txt. The proto encoding
+// does not depend on the order of the fields, unlike the text and JSON
+// formats, which follow it.
+// It runs before the files are renamed, by paths= or module=.
+func layoutStructs(g *generator.Generator, pack, report bool) {
+    for _, name := range g.Request.FileToGenerate {
+        var fd *pb.FileDescriptorProto
+        for _, f := range g.Request.ProtoFile {
+            if f.GetName() == name {
+                fd = f
+            }
+        }
+        messages := make(map[string]bool)
+        for _, msg := range descutil.Messages(g, g.FileOf(fd)) {
+            messages[generator.CamelCaseSlice(msg.TypeName())] = true
+        }
+        goName := descutil.GoFileName(fd, false)
+        for _, f := range g.Response.File {
+            if f.GetName() != goName {
+                continue
+            }
+            var packed map[string]structLayout
+            if pack {
+                f.Content = proto.String(packStructs(g, f.GetContent(), messages))
+            } else if report {
+                packed = structLayouts(g, packStructs(g, f.GetContent(), messages), messages)
+            }
+            if report {
+                content := layoutReport(fd, structLayouts(g, f.GetContent(), messages), packed)
+                descutil.AddFile(g, descutil.OutputName(g, fd, ".layout.txt"), content)
+            }
+            break
+        }
+    }
+}
+
+// parseGo parses the generated Go source content.
+func parseGo(g *generator.Generator, content string) (*token.FileSet, *ast.File) {
+    fset := token.NewFileSet()
+    file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+    if err != nil {
+        g.Error(err, "failed to parse the generated Go code")
+    }
+    return fset, file
+}
+
+// messageStructs returns the struct types of file named in messages, by
+// type declaration.
+func messageStructs(file *ast.File, messages map[string]bool) map[*ast.TypeSpec]*ast.StructType {
+    structs := make(map[*ast.TypeSpec]*ast.StructType)
+    ast.Inspect(file, func(n ast.Node) bool {
+        if spec, ok := n.(*ast.TypeSpec); ok && messages[spec.Name.Name] {
+            if st, ok := spec.Type.(*ast.StructType); ok {
+                structs[spec] = st
+            }
+        }
+        return true
+    })
+    return structs
+}
+
+// structLayouts returns the layouts of the structs of the Go source content
+// named in messages, by name.
+func structLayouts(g *generator.Generator, content string, messages map[string]bool) map[string]structLayout {
+    fset, file := parseGo(g, content)
+    layouts := make(map[string]structLayout)
+    for spec, st := range messageStructs(file, messages) {
+        layouts[spec.Name.Name] = layoutOf(fset, spec.Name.Name, st.Fields.List)
+    }
+    return layouts
+}
+
+// layoutOf returns the layout of the struct name with the given fields.
+func layoutOf(fset *token.FileSet, name string, fields []*ast.Field) structLayout {
+    s := structLayout{name: name}
+    maxAlign := int64(1)
+    for _, field := range fields {
+        size, align := typeSize(field.Type)
+        var typ bytes.Buffer
+        format.Node(&typ, fset, field.Type)
+        for _, ident := range field.Names {
+            s.size = (s.size + align - 1) / align * align
+            s.fields = append(s.fields, fieldLayout{ident.Name, typ.String(), size, align, s.size})
+            s.size += size
+        }
+        if align > maxAlign {
+            maxAlign = align
+        }
+    }
+    s.size = (s.size + maxAlign - 1) / maxAlign * maxAlign
+    return s
+}
+
+// typeSize returns the size and alignment on 64-bit platforms of the Go
+// type of a message field. The named types are the enums, held in an
+// int32, the oneof interfaces, unexported, XXX_InternalExtensions and,
+// with runtime=v2, the internal fields of protoimpl.
+func typeSize(typ ast.Expr) (size, align int64) {
+    switch typ := typ.(type) {
+    case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType:
+        return 8, 8
+    case *ast.ArrayType:
+        if typ.Len == nil {
+            return 24, 8
+        }
+    case *ast.InterfaceType:
+        return 16, 8
+    case *ast.SelectorExpr:
+        if isIdent(typ.X, "protoimpl") {
+            switch typ.Sel.Name {
+            case "SizeCache":
+                return 4, 4
+            case "UnknownFields":
+                return 24, 8
+            }
+            return 8, 8
+        }
+        if typ.Sel.Name == "XXX_InternalExtensions" {
+            return 8, 8
+        }
+        return 4, 4
+    case *ast.Ident:
+        switch typ.Name {
+        case "bool", "int8", "uint8", "byte":
+            return 1, 1
+        case "int16", "uint16":
+            return 2, 2
+        case "int32", "uint32", "float32", "rune":
+            return 4, 4
+        case "string":
+            return 16, 8
+        case "int", "uint", "int64", "uint64", "float64", "uintptr":
+            return 8, 8
+        }
+        if unicode.IsLower(rune(typ.Name[0])) {
+            return 16, 8
+        }
+        return 4, 4
+    }
+    return 8, 8
+}
+
+// isInternalField reports whether field is one of the internal fields of
+// the message structs generated with runtime=v2, of protoimpl types.
+func isInternalField(field *ast.Field) bool {
+    sel, ok := field.Type.(*ast.SelectorExpr)
+    return ok && isIdent(sel.X, "protoimpl")
+}
+
+// packStructs returns the Go source content with the fields of the structs
+// named in messages sorted by decreasing alignment, their comments along.
+func packStructs(g *generator.Generator, content string, messages map[string]bool) string {
+    fset, file := parseGo(g, content)
+    type edit struct {
+        start, end int
+        text       string
+    }
+    var edits []edit
+    for _, st := range messageStructs(file, messages) {
+        fields := append([]*ast.Field{}, st.Fields.List...)
+        // The internal fields of the messages of the API v2 runtime stay
+        // first, where protoimpl expects the message state.
+        sorted := fields
+        for len(sorted) > 0 && isInternalField(sorted[0]) {
+            sorted = sorted[1:]
+        }
+        sort.SliceStable(sorted, func(i, j int) bool {
+            _, ai := typeSize(sorted[i].Type)
+            _, aj := typeSize(sorted[j].Type)
+            return ai > aj
+        })
+        var text []string
+        for _, field := range fields {
+            start, end := field.Pos(), field.End()
+            if field.Doc != nil {
+                start = field.Doc.Pos()
+            }
+            if field.Comment != nil {
+                end = field.Comment.End()
+            }
+            text = append(text, content[fset.Position(start).Offset:fset.Position(end).Offset])
+        }
+        edits = append(edits, edit{
+            fset.Position(st.Fields.Opening).Offset + 1,
+            fset.Position(st.Fields.Closing).Offset,
+            "\n" + strings.Join(text, "\n") + "\n",
+        })
+    }
+    sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+    for _, e := range edits {
+        content = content[:e.start] + e.text + content[e.end:]
+    }
+    src, err := format.Source([]byte(content))
+    if err != nil {
+        g.Error(err, "failed to format the packed Go code")
+    }
+    return string(src)
+}
+
+// layoutReport returns the report of the layouts of the structs of the
+// messages of fd, with their packed size if packed is not nil.
+func layoutReport(fd *pb.FileDescriptorProto, layouts, packed map[string]structLayout) string {
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "Memory layout of the message structs of %s on 64-bit platforms.\n", fd.GetName())
+    var names []string
+    for name := range layouts {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        s := layouts[name]
+        fmt.Fprintf(&b, "\n%s: %d bytes, %d bytes of padding", s.name, s.size, s.padding())
+        if p, ok := packed[name]; ok && p.size < s.size {
+            fmt.Fprintf(&b, ", %d bytes with packed_layout=true", p.size)
+        }
+        fmt.Fprintf(&b, "\n%8s %6s  %s\n", "offset", "size", "field")
+        var end int64
+        for _, f := range s.fields {
+            if f.offset > end {
+                fmt.Fprintf(&b, "%8d %6d  (padding)\n", end, f.offset-end)
+            }
+            fmt.Fprintf(&b, "%8d %6d  %s %s\n", f.offset, f.size, f.name, f.typ)
+            end = f.offset + f.size
+        }
+        if s.size > end {
+            fmt.Fprintf(&b, "%8d %6d  (padding)\n", end, s.size-end)
+        }
+    }
+    return b.String()
+}
@@ -0,0 +1,160 @@
+// Package liveschema outputs the registration of the schema of the
+// generated package for its live schema endpoint.
+//
+// The first generated file of the package registers with the httprpc
+// package, when it is initialized, the gzipped FileDescriptorSet of the
+// files of the package and of the files they import, the OpenAPI document
+// of each file, as written by the openapi plugin in JSON, and the services
+// of the package with their methods, which httprpc.SchemaHandler serves at
+// /__schema for the runtime discovery of the APIs linked in to the binary
+// by gateways and developer tooling.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package liveschema
+
+import (
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "strconv"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/openapi"
+)
+
+const httprpcPkgPath = "github.com/lleveque/protoc-gen-go/httprpc"
+
+// httprpcPkg is the name of the httprpc package in the generated code,
+// which may vary from "httprpc" if the name is used by other packages.
+var httprpcPkg string
+
+func init() {
+    generator.RegisterPlugin(new(liveschema))
+}
+
+// liveschema is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the registration of the schema of the
+// generated package.
+type liveschema struct {
+    gen *generator.Generator
+}
+
+// Name returns the name of this plugin, "liveschema".
+func (l *liveschema) Name() string {
+    return "liveschema"
+}
+
+// Init initializes the plugin.
+func (l *liveschema) Init(gen *generator.Generator) {
+    l.gen = gen
+    httprpcPkg = generator.RegisterUniquePackageName("httprpc", nil)
+}
+
+// P forwards to l.gen.P.
+func (l *liveschema) P(args ...interface{}) { l.gen.P(args...) }
+
+// Generate generates the registration of the schema in the first file to
+// generate.
+func (l *liveschema) Generate(file *generator.FileDescriptor) {
+    if file.GetName() != l.gen.Request.FileToGenerate[0] {
+        return
+    }
+    l.P("func init() {")
+    l.P(httprpcPkg, ".RegisterAPISchema(&", httprpcPkg, ".APISchema{")
+    l.P("Package: ", strconv.Quote(file.GetPackage()), ",")
+    l.P("DescriptorSet: _schemaDescriptorSet,")
+    l.P("OpenAPI: map[string]string{")
+    for _, name := range l.gen.Request.FileToGenerate {
+        l.P(strconv.Quote(name), ": ", strconv.Quote(string(openapi.Document(l.gen, l.gen.FileOf(l.fileNamed(name))))), ",")
+    }
+    l.P("},")
+    l.P("Services: []", httprpcPkg, ".APIService{")
+    for _, name := range l.gen.Request.FileToGenerate {
+        f := l.fileNamed(name)
+        for _, service := range f.Service {
+            fullServName := service.GetName()
+            if pkg := f.GetPackage(); pkg != "" {
+                fullServName = pkg + "." + fullServName
+            }
+            l.P("{")
+            l.P("Name: ", strconv.Quote(fullServName), ",")
+            l.P("Methods: []", httprpcPkg, ".APIMethod{")
+            for _, method := range service.Method {
+                l.P("{")
+                l.P("Name: ", strconv.Quote(method.GetName()), ",")
+                l.P("Path: ", strconv.Quote("/"+fullServName+"/"+method.GetName()), ",")
+                l.P("InputType: ", strconv.Quote(method.GetInputType()[1:]), ",")
+                l.P("OutputType: ", strconv.Quote(method.GetOutputType()[1:]), ",")
+                if method.GetClientStreaming() {
+                    l.P("ClientStreaming: true,")
+                }
+                if method.GetServerStreaming() {
+                    l.P("ServerStreaming: true,")
+                }
+                l.P("},")
+            }
+            l.P("},")
+            l.P("},")
+        }
+    }
+    l.P("},")
+    l.P("})")
+    l.P("}")
+    l.P()
+    l.generateDescriptorSet()
+}
+
+// GenerateImports generates the import declaration for this file.
+func (l *liveschema) GenerateImports(file *generator.FileDescriptor) {
+    if file.GetName() != l.gen.Request.FileToGenerate[0] {
+        return
+    }
+    l.P("import ", httprpcPkg, " ", strconv.Quote(httprpcPkgPath))
+    l.P()
+}
+
+// fileNamed returns the file of the request named name.
+func (l *liveschema) fileNamed(name string) *pb.FileDescriptorProto {
+    for _, f := range l.gen.Request.ProtoFile {
+        if f.GetName() == name {
+            return f
+        }
+    }
+    l.gen.Fail("can't find file", name)
+    return nil
+}
+
+// generateDescriptorSet generates _schemaDescriptorSet, the gzipped
+// FileDescriptorSet of all the files of the request, as the generator
+// embeds the descriptors of the files.
+func (l *liveschema) generateDescriptorSet() {
+    data, err := proto.Marshal(&pb.FileDescriptorSet{File: l.gen.Request.ProtoFile})
+    if err != nil {
+        l.gen.Error(err, "marshaling the descriptor set")
+    }
+    var buf bytes.Buffer
+    w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+    w.Write(data)
+    w.Close()
+    b := buf.Bytes()
+
+    l.P("var _schemaDescriptorSet = []byte{")
+    l.P("// ", len(b), " bytes of a gzipped FileDescriptorSet")
+    for len(b) > 0 {
+        n := 16
+        if n > len(b) {
+            n = len(b)
+        }
+        s := ""
+        for _, c := range b[:n] {
+            s += fmt.Sprintf("0x%02x,", c)
+        }
+        l.P(s)
+        b = b[n:]
+    }
+    l.P("}")
+    l.P()
+}
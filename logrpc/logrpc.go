@@ -0,0 +1,112 @@
+// Package logrpc logs the calls of the serialized API and of the Connect
+// servers at their entry and exit.
+//
+// It backs the logging generated by the grpcserial and connect plugins with
+// the logging parameter. The calls are logged by a Logger, by default a
+// SlogLogger of the default slog logger, which the applications substitute
+// with SetDefault, or per server in the Dependencies of the connect plugin.
+package logrpc
+
+import (
+    "context"
+    "log/slog"
+    "sync"
+    "time"
+
+    "github.com/lleveque/protoc-gen-go/httprpc"
+)
+
+// Logger logs the calls of the methods.
+type Logger interface {
+    // LogEntry logs the entry of a call of method of service, e.g.
+    // "pkg.Service" and "Method".
+    LogEntry(ctx context.Context, service, method string)
+
+    // LogExit logs the exit of a call of method of service, which lasted
+    // duration, with requests and responses of requestSize and
+    // responseSize bytes in total, and failed with err if not nil.
+    LogExit(ctx context.Context, service, method string, duration time.Duration, requestSize, responseSize int, err error)
+}
+
+var (
+    mu            sync.Mutex
+    defaultLogger Logger = SlogLogger{}
+)
+
+// SetDefault sets the logger of the calls logged without a logger of their
+// own.
+func SetDefault(l Logger) {
+    mu.Lock()
+    defer mu.Unlock()
+    defaultLogger = l
+}
+
+// Default returns the logger of the calls logged without a logger of their
+// own, a SlogLogger of the default slog logger unless set by SetDefault.
+func Default() Logger {
+    mu.Lock()
+    defer mu.Unlock()
+    return defaultLogger
+}
+
+// SlogLogger is a Logger logging with Logger, or the default slog logger
+// if nil: the entries at the debug level, the exits at the info level, or
+// at the error level for the calls failed.
+type SlogLogger struct {
+    Logger *slog.Logger
+}
+
+func (l SlogLogger) logger() *slog.Logger {
+    if l.Logger == nil {
+        return slog.Default()
+    }
+    return l.Logger
+}
+
+// LogEntry logs "rpc entry" with the service and method.
+func (l SlogLogger) LogEntry(ctx context.Context, service, method string) {
+    l.logger().DebugContext(ctx, "rpc entry", slog.String("service", service), slog.String("method", method))
+}
+
+// LogExit logs "rpc exit" with the service, method, duration, request and
+// response sizes, and error.
+func (l SlogLogger) LogExit(ctx context.Context, service, method string, duration time.Duration, requestSize, responseSize int, err error) {
+    attrs := []slog.Attr{
+        slog.String("service", service),
+        slog.String("method", method),
+        slog.Duration("duration", duration),
+        slog.Int("request_size", requestSize),
+        slog.Int("response_size", responseSize),
+    }
+    level := slog.LevelInfo
+    if err != nil {
+        level = slog.LevelError
+        attrs = append(attrs, slog.String("error", err.Error()))
+    }
+    l.logger().LogAttrs(ctx, level, "rpc exit", attrs...)
+}
+
+// Start logs the entry of a call of method of service with l, or the
+// default logger if nil, and returns the function logging its exit.
+func Start(ctx context.Context, l Logger, service, method string) (exit func(requestSize, responseSize int, err error)) {
+    if l == nil {
+        l = Default()
+    }
+    start := time.Now()
+    l.LogEntry(ctx, service, method)
+    return func(requestSize, responseSize int, err error) {
+        l.LogExit(ctx, service, method, time.Since(start), requestSize, responseSize, err)
+    }
+}
+
+// Interceptor returns an interceptor logging the calls served by
+// httprpc.ServeConnect with l, or the default logger if nil.
+func Interceptor(l Logger) httprpc.ConnectInterceptor {
+    return func(ctx context.Context, c *httprpc.ServerCall, next func(ctx context.Context) error) error {
+        service, method := httprpc.SplitProcedure(c.Procedure())
+        exit := Start(ctx, l, service, method)
+        err := next(ctx)
+        exit(c.ReceivedBytes(), c.SentBytes(), err)
+        return err
+    }
+}
@@ -49,14 +49,59 @@
 package main
 
 import (
+    "bytes"
+    "fmt"
     "io/ioutil"
     "os"
+    "path/filepath"
+    "strings"
 
     "github.com/golang/protobuf/proto"
     "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
 
-    // This is to show how to register grpcserial plugin in protoc-gen-go : simply import it !
+    // This is to show how to register the plugins in protoc-gen-go : simply import them !
+    _ "github.com/lleveque/protoc-gen-go/anonymize"
+    _ "github.com/lleveque/protoc-gen-go/anypack"
+    _ "github.com/lleveque/protoc-gen-go/arrow"
+    _ "github.com/lleveque/protoc-gen-go/attest"
+    _ "github.com/lleveque/protoc-gen-go/avro"
+    _ "github.com/lleveque/protoc-gen-go/bigquery"
+    _ "github.com/lleveque/protoc-gen-go/builder"
+    _ "github.com/lleveque/protoc-gen-go/can"
+    _ "github.com/lleveque/protoc-gen-go/clone"
+    _ "github.com/lleveque/protoc-gen-go/cloudevents"
+    _ "github.com/lleveque/protoc-gen-go/cobs"
+    _ "github.com/lleveque/protoc-gen-go/connect"
+    _ "github.com/lleveque/protoc-gen-go/cue"
+    _ "github.com/lleveque/protoc-gen-go/delimited"
+    _ "github.com/lleveque/protoc-gen-go/depgraph"
+    _ "github.com/lleveque/protoc-gen-go/descset"
+    _ "github.com/lleveque/protoc-gen-go/diff"
+    _ "github.com/lleveque/protoc-gen-go/docs"
+    _ "github.com/lleveque/protoc-gen-go/enums"
+    _ "github.com/lleveque/protoc-gen-go/equal"
+    _ "github.com/lleveque/protoc-gen-go/explain"
+    _ "github.com/lleveque/protoc-gen-go/fieldmask"
     _ "github.com/lleveque/protoc-gen-go/grpcserial"
+    _ "github.com/lleveque/protoc-gen-go/iters"
+    _ "github.com/lleveque/protoc-gen-go/jsonschema"
+    _ "github.com/lleveque/protoc-gen-go/kafka"
+    _ "github.com/lleveque/protoc-gen-go/liveschema"
+    _ "github.com/lleveque/protoc-gen-go/mock"
+    _ "github.com/lleveque/protoc-gen-go/oneofs"
+    _ "github.com/lleveque/protoc-gen-go/openapi"
+    _ "github.com/lleveque/protoc-gen-go/options"
+    _ "github.com/lleveque/protoc-gen-go/pact"
+    _ "github.com/lleveque/protoc-gen-go/presence"
+    _ "github.com/lleveque/protoc-gen-go/saga"
+    _ "github.com/lleveque/protoc-gen-go/schemametrics"
+    _ "github.com/lleveque/protoc-gen-go/snapshot"
+    _ "github.com/lleveque/protoc-gen-go/sortedmaps"
+    _ "github.com/lleveque/protoc-gen-go/twirp"
+    _ "github.com/lleveque/protoc-gen-go/validate"
+    _ "github.com/lleveque/protoc-gen-go/view"
+    _ "github.com/lleveque/protoc-gen-go/wkt"
 )
 
 func main() {
@@ -89,6 +134,45 @@ func main() {
 
     g.GenerateAllFiles()
 
+    if descutil.RuntimeV2(g) {
+        migrateRuntimeV2(g)
+    }
+    if descutil.Int64JSONNumbers(g) {
+        markInt64Numbers(g)
+    }
+    enumNumbers, rejectUnknownEnums := descutil.EnumJSON(g)
+    if enumNumbers {
+        markEnumNumbers(g)
+    }
+    if rejectUnknownEnums {
+        markRejectUnknownEnums(g)
+    }
+    if format, zone := descutil.TimestampJSON(g); format != "" {
+        markTimestamps(g, format, zone)
+    }
+    if pack, report := descutil.BoolParam(g, "packed_layout"), descutil.BoolParam(g, "layout_report"); pack || report {
+        layoutStructs(g, pack, report)
+    }
+    if descutil.BoolParam(g, "markers") {
+        addMarkers(g)
+    }
+    switch paths := g.Param["paths"]; paths {
+    case "", "import":
+    case "source_relative":
+        if g.Param["module"] != "" {
+            g.Fail("cannot use module= with paths=source_relative")
+        }
+        sourceRelativePaths(g)
+    default:
+        g.Fail(fmt.Sprintf(`unknown path type %q: want "import" or "source_relative"`, paths))
+    }
+    if module := g.Param["module"]; module != "" {
+        trimModule(g, module)
+    }
+    if dir := g.Param["verify"]; dir != "" {
+        verifyOutputs(g, dir)
+    }
+
     // Send back the results.
     data, err = proto.Marshal(g.Response)
     if err != nil {
@@ -99,3 +183,54 @@ func main() {
         g.Error(err, "failed to write output proto")
     }
 }
+
+// sourceRelativePaths renames the generated files so that they are written
+// next to the .proto files they come from, rather than in the directory
+// given by their go_package import path.
+func sourceRelativePaths(g *generator.Generator) {
+    generated := make(map[string]bool)
+    for _, name := range g.Request.FileToGenerate {
+        generated[name] = true
+    }
+    renames := make(map[string]string)
+    for _, f := range g.Request.ProtoFile {
+        if generated[f.GetName()] {
+            renames[descutil.GoFileName(f, false)] = descutil.GoFileName(f, true)
+        }
+    }
+    for _, f := range g.Response.File {
+        if name, ok := renames[f.GetName()]; ok {
+            f.Name = proto.String(name)
+        }
+    }
+}
+
+// trimModule strips the module path prefix from the names of the generated
+// files, so that generating into the root of that module does not create
+// nested directories named after its import path.
+func trimModule(g *generator.Generator, module string) {
+    prefix := strings.TrimSuffix(module, "/") + "/"
+    for _, f := range g.Response.File {
+        if !strings.HasPrefix(f.GetName(), prefix) {
+            g.Fail(fmt.Sprintf("%s: generated file does not match module prefix %q", f.GetName(), module))
+        }
+        f.Name = proto.String(strings.TrimPrefix(f.GetName(), prefix))
+    }
+}
+
+// verifyOutputs checks that the files under dir, typically committed ones,
+// are identical to the generated files, and fails listing those which are
+// not. Nothing is generated in this mode.
+func verifyOutputs(g *generator.Generator, dir string) {
+    var stale []string
+    for _, f := range g.Response.File {
+        content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.GetName())))
+        if err != nil || !bytes.Equal(content, []byte(f.GetContent())) {
+            stale = append(stale, f.GetName())
+        }
+    }
+    if len(stale) > 0 {
+        g.Fail("generated files differ from the ones in", dir+":", strings.Join(stale, ", "))
+    }
+    g.Response.File = nil
+}
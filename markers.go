@@ -0,0 +1,146 @@
+package main
+
+import (
+    "fmt"
+    "go/format"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+var (
+    structLine = regexp.MustCompile(`^type (\w+) struct {$`)
+    fieldLine  = regexp.MustCompile("^(\\s+)\\w+ .*`protobuf:\"\\w+,(\\d+),")
+)
+
+// markedMessage is a message whose struct gets marker comments.
+type markedMessage struct {
+    fullName string // fully-qualified, without leading dot
+    fields   map[int32]*pb.FieldDescriptorProto
+}
+
+// addMarkers inserts machine-readable marker comments in the generated Go
+// files, so that analyzers can map the code back to the schema without
+// the descriptors: the structs of the messages are marked with
+//
+//    //proto:message=pkg.Message
+//
+// and their fields, those of the oneof wrapper structs included, with
+//
+//    //proto:field=user_id num=3 opts=deprecated:true,(pkg.sensitive):true
+//
+// opts listing the field options set, custom ones included, in the
+// protobuf text format with the spaces and commas of strings escaped.
+// It runs before the files are renamed, by paths= or module=.
+func addMarkers(g *generator.Generator) {
+    for _, name := range g.Request.FileToGenerate {
+        var fd *pb.FileDescriptorProto
+        for _, f := range g.Request.ProtoFile {
+            if f.GetName() == name {
+                fd = f
+            }
+        }
+        messages := make(map[string]markedMessage)
+        for _, msg := range descutil.Messages(g, g.FileOf(fd)) {
+            m := markedMessage{strings.Join(msg.TypeName(), "."), make(map[int32]*pb.FieldDescriptorProto)}
+            if pkg := fd.GetPackage(); pkg != "" {
+                m.fullName = pkg + "." + m.fullName
+            }
+            for _, field := range msg.Field {
+                m.fields[field.GetNumber()] = field
+            }
+            messages[generator.CamelCaseSlice(msg.TypeName())] = m
+        }
+        goName := descutil.GoFileName(fd, false)
+        for _, f := range g.Response.File {
+            if f.GetName() == goName {
+                f.Content = proto.String(markFile(g, f.GetContent(), messages))
+            }
+        }
+    }
+}
+
+// markFile returns the Go source content with the markers of messages, by
+// struct name, inserted.
+func markFile(g *generator.Generator, content string, messages map[string]markedMessage) string {
+    lines := strings.Split(content, "\n")
+    out := make([]string, 0, len(lines))
+    var candidates []markedMessage
+    for _, line := range lines {
+        if m := structLine.FindStringSubmatch(line); m != nil {
+            candidates = structMessages(messages, m[1])
+            if msg, ok := messages[m[1]]; ok {
+                out = append(out, "//proto:message="+msg.fullName)
+            }
+        } else if line == "}" {
+            candidates = nil
+        } else if m := fieldLine.FindStringSubmatch(line); m != nil {
+            num, _ := strconv.Atoi(m[2])
+            for _, msg := range candidates {
+                if field, ok := msg.fields[int32(num)]; ok {
+                    out = append(out, m[1]+fieldMarker(g, field))
+                    break
+                }
+            }
+        }
+        out = append(out, line)
+    }
+    // The comments inserted split the alignment of the struct fields.
+    src, err := format.Source([]byte(strings.Join(out, "\n")))
+    if err != nil {
+        g.Error(err, "failed to format the marked Go code")
+    }
+    return string(src)
+}
+
+// structMessages returns the messages the fields of the struct named name
+// may belong to, most likely first: the message itself, or the one of a
+// oneof wrapper struct, named <Message>_<Field> with as many trailing
+// underscores as needed to avoid collisions.
+func structMessages(messages map[string]markedMessage, name string) []markedMessage {
+    var msgs []markedMessage
+    for name != "" {
+        if msg, ok := messages[name]; ok {
+            msgs = append(msgs, msg)
+        }
+        i := strings.LastIndex(name, "_")
+        if i < 0 {
+            break
+        }
+        name = name[:i]
+    }
+    return msgs
+}
+
+// fieldMarker returns the marker comment of field.
+func fieldMarker(g *generator.Generator, field *pb.FieldDescriptorProto) string {
+    marker := fmt.Sprintf("//proto:field=%s num=%d", field.GetName(), field.GetNumber())
+    if opts := fieldOptions(g, field); len(opts) > 0 {
+        marker += " opts=" + strings.Join(opts, ",")
+    }
+    return marker
+}
+
+// fieldOptions returns the options of field set, as name:value pairs.
+func fieldOptions(g *generator.Generator, field *pb.FieldDescriptorProto) []string {
+    o := field.Options
+    if o == nil {
+        return nil
+    }
+    // The standard options, without the extensions the generator does not know.
+    std := &pb.FieldOptions{Ctype: o.Ctype, Packed: o.Packed, Jstype: o.Jstype, Lazy: o.Lazy, Deprecated: o.Deprecated, Weak: o.Weak}
+    opts := strings.Fields(proto.CompactTextString(std))
+    raw := descutil.Options(o)
+    for _, ext := range descutil.Extensions(g, ".google.protobuf.FieldOptions") {
+        for _, v := range descutil.OptionValues(g, raw, ext.FieldDescriptorProto) {
+            v = strings.NewReplacer(" ", `\x20`, ",", `\x2c`).Replace(v)
+            opts = append(opts, fmt.Sprintf("(%s):%s", strings.TrimPrefix(ext.FullName, "."), v))
+        }
+    }
+    return opts
+}
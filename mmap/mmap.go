@@ -0,0 +1,27 @@
+// Package mmap maps files read-only in memory.
+//
+// It backs the snapshot helpers generated by the snapshot plugin. On
+// platforms without mmap support the file is read in memory instead.
+package mmap
+
+// Mapping is a read-only view of a file's contents.
+type Mapping struct {
+    data  []byte
+    unmap func([]byte) error
+}
+
+// Bytes returns the mapped contents.
+// The slice must not be written to, nor used after Close.
+func (m *Mapping) Bytes() []byte {
+    return m.data
+}
+
+// Close releases the mapping. It is safe to call Close more than once.
+func (m *Mapping) Close() error {
+    data := m.data
+    m.data = nil
+    if data == nil || m.unmap == nil {
+        return nil
+    }
+    return m.unmap(data)
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package mmap
+
+import "io/ioutil"
+
+// Open reads the file at path in memory, as mmap is not available.
+func Open(path string) (*Mapping, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return &Mapping{data: data}, nil
+}
@@ -0,0 +1,37 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package mmap
+
+import (
+    "errors"
+    "os"
+    "syscall"
+)
+
+// Open maps the file at path in memory.
+func Open(path string) (*Mapping, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    fi, err := f.Stat()
+    if err != nil {
+        return nil, err
+    }
+    size := fi.Size()
+    if size == 0 {
+        // mmap refuses empty mappings, and there is nothing to map anyway.
+        return &Mapping{}, nil
+    }
+    if int64(int(size)) != size {
+        return nil, errors.New("mmap: file too large: " + path)
+    }
+    data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+    if err != nil {
+        return nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+    }
+    return &Mapping{data: data, unmap: syscall.Munmap}, nil
+}
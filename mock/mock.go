@@ -0,0 +1,225 @@
+// Package mock outputs gomock mocks of the interfaces of the services.
+//
+// For every service Foo it writes a foomock package, in the foomock
+// directory next to the generated Go file, holding mocks compatible with
+// github.com/golang/mock/gomock of the interfaces generated for the service
+// by the other plugins enabled: MockFooConnect for connect and MockFoo for
+// twirp. They are the ones mockgen would write, without running it on the
+// generated code.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package mock
+
+import (
+    "bytes"
+    "fmt"
+    "go/format"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// gomockPkgPath is the import path of the gomock package used by the mocks.
+const gomockPkgPath = "github.com/golang/mock/gomock"
+
+func init() {
+    generator.RegisterPlugin(new(mock))
+}
+
+// mock is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates mocks of the service interfaces.
+type mock struct {
+    gen     *generator.Generator
+    connect bool // the connect plugin, generating the FooConnect interfaces, is enabled
+    twirp   bool // the twirp plugin, generating the Foo interfaces, is enabled
+
+    imports map[string]string // import path by name, of the mock package being generated
+}
+
+// method is a method of a mocked interface: its parameters and results,
+// as name and type pairs, results being unnamed.
+type method struct {
+    name    string
+    params  [][2]string
+    results []string
+}
+
+// Name returns the name of this plugin, "mock".
+func (m *mock) Name() string {
+    return "mock"
+}
+
+// Init initializes the plugin.
+func (m *mock) Init(gen *generator.Generator) {
+    m.gen = gen
+    m.connect = descutil.PluginEnabled(gen, "connect")
+    m.twirp = descutil.PluginEnabled(gen, "twirp")
+}
+
+// Generate writes the mock packages of the services of the given file.
+func (m *mock) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(m.gen, file.GetName()) || len(file.Service) == 0 {
+        return
+    }
+    if !m.connect && !m.twirp {
+        m.gen.Fail("the mock plugin needs the connect or twirp plugin, whose interfaces it mocks")
+    }
+    for _, service := range file.Service {
+        m.generateService(file, service)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (m *mock) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// generateService writes the mock package of service.
+func (m *mock) generateService(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto) {
+    servName := generator.CamelCase(service.GetName())
+    pkgName := strings.ToLower(servName) + "mock"
+    m.imports = map[string]string{"gomock": gomockPkgPath, "reflect": "reflect", "context": "context"}
+    pbPkg := m.importFile(file)
+
+    var body bytes.Buffer
+    if m.connect {
+        var methods []method
+        for _, meth := range service.Method {
+            methods = append(methods, m.connectMethod(meth))
+        }
+        writeMock(&body, pbPkg+"."+servName+"Connect", "Mock"+servName+"Connect", methods)
+    }
+    if m.twirp {
+        var methods []method
+        for _, meth := range service.Method {
+            methods = append(methods, method{
+                name:    generator.CamelCase(meth.GetName()),
+                params:  [][2]string{{"ctx", "context.Context"}, {"in", "*" + m.typeName(meth.GetInputType())}},
+                results: []string{"*" + m.typeName(meth.GetOutputType()), "error"},
+            })
+        }
+        writeMock(&body, pbPkg+"."+servName, "Mock"+servName, methods)
+    }
+
+    var b bytes.Buffer
+    b.WriteString("// Code generated by protoc-gen-go. DO NOT EDIT.\n")
+    b.WriteString("// source: " + file.GetName() + "\n\n")
+    fmt.Fprintf(&b, "// Package %s holds mocks of the interfaces of the %s service.\n", pkgName, servName)
+    fmt.Fprintf(&b, "package %s\n\n", pkgName)
+    b.WriteString("import (\n")
+    var names []string
+    for name := range m.imports {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        fmt.Fprintf(&b, "%s %s\n", name, strconv.Quote(m.imports[name]))
+    }
+    b.WriteString(")\n\n")
+    b.Write(body.Bytes())
+
+    src, err := format.Source(b.Bytes())
+    if err != nil {
+        m.gen.Error(err, "failed to format the mocks of", servName)
+    }
+    dir := path.Join(path.Dir(descutil.OutputName(m.gen, file.FileDescriptorProto, ".pb.go")), pkgName)
+    descutil.AddFile(m.gen, path.Join(dir, pkgName+".go"), string(src))
+}
+
+// connectMethod returns the method of the Connect interface of a service
+// for meth.
+func (m *mock) connectMethod(meth *pb.MethodDescriptorProto) method {
+    in, out := "*"+m.typeName(meth.GetInputType()), "*"+m.typeName(meth.GetOutputType())
+    recv := [2]string{"recv", "func() (" + in + ", error)"}
+    send := [2]string{"send", "func(" + out + ") error"}
+    mt := method{name: generator.CamelCase(meth.GetName()), params: [][2]string{{"ctx", "context.Context"}}}
+    switch {
+    case meth.GetClientStreaming() && meth.GetServerStreaming():
+        mt.params = append(mt.params, recv, send)
+        mt.results = []string{"error"}
+    case meth.GetClientStreaming():
+        mt.params = append(mt.params, recv)
+        mt.results = []string{out, "error"}
+    case meth.GetServerStreaming():
+        mt.params = append(mt.params, [2]string{"in", in}, send)
+        mt.results = []string{"error"}
+    default:
+        mt.params = append(mt.params, [2]string{"in", in})
+        mt.results = []string{out, "error"}
+    }
+    return mt
+}
+
+// typeName returns the name of the message typ in the mock package being
+// generated, importing its package.
+func (m *mock) typeName(typ string) string {
+    obj := m.gen.ObjectNamed(typ)
+    return m.importFile(m.gen.FileOf(obj.File())) + "." + generator.CamelCaseSlice(obj.TypeName())
+}
+
+// importFile imports the Go package of file in the mock package being
+// generated, and returns its name there.
+func (m *mock) importFile(file *generator.FileDescriptor) string {
+    impPath := path.Dir(descutil.GoFileName(file.FileDescriptorProto, false))
+    if opt := file.GetOptions().GetGoPackage(); strings.Contains(opt, "/") {
+        impPath = strings.SplitN(opt, ";", 2)[0]
+    }
+    if impPath == "." {
+        m.gen.Fail("the mocks need the import path of the Go package of", file.GetName()+", given by its go_package option")
+    }
+    name := file.PackageName()
+    for i := 1; m.imports[name] != "" && m.imports[name] != impPath; i++ {
+        name = fmt.Sprintf("%s%d", file.PackageName(), i)
+    }
+    m.imports[name] = impPath
+    return name
+}
+
+// writeMock writes the gomock mock named mockName of the interface iface,
+// and its recorder, as mockgen does.
+func writeMock(b *bytes.Buffer, iface, mockName string, methods []method) {
+    recorder := mockName + "MockRecorder"
+    fmt.Fprintf(b, "// %s is a mock of the %s interface.\n", mockName, iface)
+    fmt.Fprintf(b, "type %s struct {\nctrl *gomock.Controller\nrecorder *%s\n}\n\n", mockName, recorder)
+    fmt.Fprintf(b, "// %s is the mock recorder for %s.\n", recorder, mockName)
+    fmt.Fprintf(b, "type %s struct {\nmock *%s\n}\n\n", recorder, mockName)
+    fmt.Fprintf(b, "// New%s creates a new mock instance.\n", mockName)
+    fmt.Fprintf(b, "func New%s(ctrl *gomock.Controller) *%s {\n", mockName, mockName)
+    fmt.Fprintf(b, "mock := &%s{ctrl: ctrl}\nmock.recorder = &%s{mock}\nreturn mock\n}\n\n", mockName, recorder)
+    b.WriteString("// EXPECT returns an object that allows the caller to indicate expected use.\n")
+    fmt.Fprintf(b, "func (m *%s) EXPECT() *%s {\nreturn m.recorder\n}\n\n", mockName, recorder)
+
+    for _, mt := range methods {
+        var params, names []string
+        for _, p := range mt.params {
+            params = append(params, p[0]+" "+p[1])
+            names = append(names, p[0])
+        }
+        results := strings.Join(mt.results, ", ")
+        if len(mt.results) > 1 {
+            results = "(" + results + ")"
+        }
+        fmt.Fprintf(b, "// %s mocks base method.\n", mt.name)
+        fmt.Fprintf(b, "func (m *%s) %s(%s) %s {\n", mockName, mt.name, strings.Join(params, ", "), results)
+        b.WriteString("m.ctrl.T.Helper()\n")
+        fmt.Fprintf(b, "ret := m.ctrl.Call(m, %q, %s)\n", mt.name, strings.Join(names, ", "))
+        var rets []string
+        for i, r := range mt.results {
+            fmt.Fprintf(b, "ret%d, _ := ret[%d].(%s)\n", i, i, r)
+            rets = append(rets, fmt.Sprintf("ret%d", i))
+        }
+        fmt.Fprintf(b, "return %s\n}\n\n", strings.Join(rets, ", "))
+
+        fmt.Fprintf(b, "// %s indicates an expected call of %s.\n", mt.name, mt.name)
+        fmt.Fprintf(b, "func (mr *%s) %s(%s interface{}) *gomock.Call {\n", recorder, mt.name, strings.Join(names, ", "))
+        b.WriteString("mr.mock.ctrl.T.Helper()\n")
+        fmt.Fprintf(b, "return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, %q, reflect.TypeOf((*%s)(nil).%s), %s)\n}\n\n",
+            mt.name, mockName, mt.name, strings.Join(names, ", "))
+    }
+    fmt.Fprintf(b, "var _ %s = (*%s)(nil)\n\n", iface, mockName)
+}
@@ -0,0 +1,37 @@
+// Package mqttrpc carries the calls of the serialized API over MQTT.
+//
+// It backs the MQTT bindings generated by the grpcserial plugin with the
+// mqtt parameter: the requests of a method are published on its request
+// topic, named after the full name of the method, and the outputs of the
+// calls on its response topic, or their error messages on its error topic.
+package mqttrpc
+
+// The suffixes of the response and error topics of a method, following its
+// request topic.
+const (
+    ResponseSuffix = "/response"
+    ErrorSuffix    = "/error"
+)
+
+// Client is the part of an MQTT client the bindings use, e.g. an adapter of
+// github.com/eclipse/paho.mqtt.golang, which chooses the quality of service
+// of the subscriptions and messages.
+type Client interface {
+    // Subscribe subscribes to topic, calling handle with the payload of
+    // every message published on it. The errors of handle, failing to
+    // publish a response, are reported by the client.
+    Subscribe(topic string, handle func(payload []byte) error) error
+
+    // Publish publishes payload on topic.
+    Publish(topic string, payload []byte) error
+}
+
+// Topic returns the request topic of the method of full name fullMethod,
+// e.g. "greeting.Greet/Hello", under root: "root/greeting.Greet/Hello", or
+// the full name itself if root is empty.
+func Topic(root, fullMethod string) string {
+    if root == "" {
+        return fullMethod
+    }
+    return root + "/" + fullMethod
+}
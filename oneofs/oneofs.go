@@ -0,0 +1,137 @@
+// Package oneofs outputs the constructors and visitors of the oneofs.
+//
+// For every field bar of a oneof kind of a message Foo it generates a
+// NewFooFromBar(v T) *Foo constructor, returning a Foo with only that
+// case of the oneof set, and for the oneof a FooKindVisitor interface, of a
+// VisitBar(v T) method per case and a VisitKindUnset() method, with
+// VisitFooKind(m *Foo, visitor FooKindVisitor) calling the method of the
+// case set. As the visitors must implement every method, adding a case to
+// the oneof fails the compilation of the code which does not handle it.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package oneofs
+
+import (
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+func init() {
+    generator.RegisterPlugin(new(oneofs))
+}
+
+// oneofs is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the constructors and visitors of the oneofs of
+// the messages of each file.
+type oneofs struct {
+    gen *generator.Generator
+}
+
+// Name returns the name of this plugin, "oneofs".
+func (o *oneofs) Name() string {
+    return "oneofs"
+}
+
+// Init initializes the plugin.
+func (o *oneofs) Init(gen *generator.Generator) {
+    o.gen = gen
+}
+
+// P forwards to o.gen.P.
+func (o *oneofs) P(args ...interface{}) { o.gen.P(args...) }
+
+// Generate generates the constructors and visitors of the oneofs of the
+// messages in the given file.
+func (o *oneofs) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(o.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(o.gen, file) {
+        for i := range msg.OneofDecl {
+            o.generateOneof(msg, int32(i))
+        }
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+// The generated code imports no package.
+func (o *oneofs) GenerateImports(file *generator.FileDescriptor) {}
+
+// generateOneof generates the constructors and visitor of the oneof of msg
+// at index.
+func (o *oneofs) generateOneof(msg *generator.Descriptor, index int32) {
+    typeName := o.gen.TypeName(msg)
+    oneof := msg.OneofDecl[index]
+    oneofName := generator.CamelCase(oneof.GetName())
+    visitorName := typeName + oneofName + "Visitor"
+    unsetName := "Visit" + oneofName + "Unset"
+
+    var fields []*pb.FieldDescriptorProto
+    for _, field := range msg.Field {
+        if field.OneofIndex != nil && field.GetOneofIndex() == index {
+            fields = append(fields, field)
+        }
+    }
+    for _, field := range fields {
+        if "Visit"+generator.CamelCase(field.GetName()) == unsetName {
+            o.gen.Fail("the visitor method of field", field.GetName(), "of", typeName, "collides with", unsetName)
+        }
+    }
+
+    for _, field := range fields {
+        fieldName := generator.CamelCase(field.GetName())
+        goType, _ := o.gen.GoType(msg, field)
+        o.P("// New", typeName, "From", fieldName, " returns a ", typeName, " whose ", oneof.GetName(), " is its ", field.GetName(), " field,")
+        o.P("// set to v.")
+        o.P("func New", typeName, "From", fieldName, "(v ", goType, ") *", typeName, " {")
+        o.P("return &", typeName, "{", oneofName, ": &", wrapperName(msg, field), "{", fieldName, ": v}}")
+        o.P("}")
+        o.P()
+    }
+
+    o.P("// ", visitorName, " handles every case of the ", oneof.GetName(), " oneof of ", typeName, ", as called by")
+    o.P("// Visit", typeName, oneofName, ".")
+    o.P("type ", visitorName, " interface {")
+    for _, field := range fields {
+        goType, _ := o.gen.GoType(msg, field)
+        o.P("Visit", generator.CamelCase(field.GetName()), "(v ", goType, ")")
+    }
+    o.P(unsetName, "()")
+    o.P("}")
+    o.P()
+    o.P("// Visit", typeName, oneofName, " calls the method of visitor handling the case of the ", oneof.GetName())
+    o.P("// oneof set in m, or ", unsetName, " if none is, m being nil included.")
+    o.P("func Visit", typeName, oneofName, "(m *", typeName, ", visitor ", visitorName, ") {")
+    o.P("switch x := m.Get", oneofName, "().(type) {")
+    for _, field := range fields {
+        fieldName := generator.CamelCase(field.GetName())
+        o.P("case *", wrapperName(msg, field), ":")
+        o.P("visitor.Visit", fieldName, "(x.", fieldName, ")")
+    }
+    o.P("default:")
+    o.P("visitor.", unsetName, "()")
+    o.P("}")
+    o.P("}")
+    o.P()
+}
+
+// wrapperName returns the name of the type wrapping the value of field, of
+// a oneof of msg, suffixed by underscores as the generator does if it
+// collides with a message or enum nested in msg.
+func wrapperName(msg *generator.Descriptor, field *pb.FieldDescriptorProto) string {
+    typeName := generator.CamelCaseSlice(msg.TypeName())
+    nested := make(map[string]bool)
+    for _, desc := range msg.NestedType {
+        nested[typeName+"_"+generator.CamelCase(desc.GetName())] = true
+    }
+    for _, enum := range msg.EnumType {
+        nested[typeName+"_"+generator.CamelCase(enum.GetName())] = true
+    }
+    name := typeName + "_" + generator.CamelCase(field.GetName())
+    for nested[name] {
+        name += "_"
+    }
+    return name
+}
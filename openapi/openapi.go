@@ -0,0 +1,557 @@
+// Package openapi outputs OpenAPI v3 documents of the HTTP APIs.
+//
+// For every generated file it writes, next to its Go file, an OpenAPI 3.0
+// document in JSON, or in YAML with the parameter openapi=yaml, describing
+// the POST /<package>.<Service>/<Method> endpoints of the serialized API,
+// as served by the http.Handler of grpcserial and by the Connect handlers,
+// and the REST routes mapped by the google.api.http options of the methods.
+// The schemas are those of the JSON mapping of the messages.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package openapi
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/httprpc"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// version is the version of the OpenAPI specification of the documents.
+const version = "3.0.3"
+
+func init() {
+    generator.RegisterPlugin(new(openapi))
+}
+
+// openapi is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates OpenAPI documents.
+type openapi struct {
+    gen          *generator.Generator
+    yaml         bool // openapi=yaml: write YAML rather than JSON documents
+    int64Numbers bool // int64_json=number: 64-bit integers are JSON numbers, not strings
+    enumNumbers  bool // enum_json=number: enums are JSON numbers, not names
+
+    unixMillis bool // timestamp_json=unix_millis: timestamps are JSON numbers of milliseconds
+
+    types   descutil.TypeSet       // types of the request, looked up by the schemas
+    schemas map[string]interface{} // components of the document being generated
+}
+
+// object is a JSON object of a document. Its keys are sorted on output.
+type object map[string]interface{}
+
+// wellKnownSchemas maps the well-known types having a special JSON mapping
+// to their schema.
+var wellKnownSchemas = map[string]object{
+    ".google.protobuf.Any":         {"type": "object", "properties": object{"@type": object{"type": "string"}}, "additionalProperties": true},
+    ".google.protobuf.Duration":    {"type": "string", "example": "1.5s"},
+    ".google.protobuf.Empty":       {"type": "object"},
+    ".google.protobuf.FieldMask":   {"type": "string", "example": "a.b,c"},
+    ".google.protobuf.ListValue":   {"type": "array", "items": object{}},
+    ".google.protobuf.Struct":      {"type": "object", "additionalProperties": true},
+    ".google.protobuf.Timestamp":   {"type": "string", "format": "date-time"},
+    ".google.protobuf.Value":       {},
+    ".google.protobuf.BoolValue":   {"type": "boolean", "nullable": true},
+    ".google.protobuf.BytesValue":  {"type": "string", "format": "byte", "nullable": true},
+    ".google.protobuf.DoubleValue": {"type": "number", "format": "double", "nullable": true},
+    ".google.protobuf.FloatValue":  {"type": "number", "format": "float", "nullable": true},
+    ".google.protobuf.Int32Value":  {"type": "integer", "format": "int32", "nullable": true},
+    ".google.protobuf.Int64Value":  {"type": "string", "format": "int64", "nullable": true},
+    ".google.protobuf.StringValue": {"type": "string", "nullable": true},
+    ".google.protobuf.UInt32Value": {"type": "integer", "format": "int64", "minimum": 0, "nullable": true},
+    ".google.protobuf.UInt64Value": {"type": "string", "format": "uint64", "nullable": true},
+}
+
+// Name returns the name of this plugin, "openapi".
+func (o *openapi) Name() string {
+    return "openapi"
+}
+
+// Init initializes the plugin.
+func (o *openapi) Init(gen *generator.Generator) {
+    o.init(gen)
+    switch format := gen.Param["openapi"]; format {
+    case "", "json":
+    case "yaml":
+        o.yaml = true
+    default:
+        gen.Fail(fmt.Sprintf(`unknown OpenAPI format %q: want "json" or "yaml"`, format))
+    }
+}
+
+// init sets the generator and the JSON mapping of the documents.
+func (o *openapi) init(gen *generator.Generator) {
+    o.gen = gen
+    o.int64Numbers = descutil.Int64JSONNumbers(gen)
+    o.enumNumbers, _ = descutil.EnumJSON(gen)
+    format, _ := descutil.TimestampJSON(gen)
+    o.unixMillis = format == httprpc.TimestampUnixMillis
+    o.types = descutil.NewTypeSet(gen)
+}
+
+// Document returns the OpenAPI document of file in JSON, as written by the
+// plugin, for the plugins embedding it in the generated code.
+func Document(gen *generator.Generator, file *generator.FileDescriptor) []byte {
+    o := new(openapi)
+    o.init(gen)
+    data, err := json.Marshal(o.document(file))
+    if err != nil {
+        gen.Error(err, "failed to encode the OpenAPI document")
+    }
+    return data
+}
+
+// Generate writes the OpenAPI document of the given file.
+func (o *openapi) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(o.gen, file.GetName()) {
+        return
+    }
+    doc := o.document(file)
+
+    var b bytes.Buffer
+    name := descutil.OutputName(o.gen, file.FileDescriptorProto, ".openapi.json")
+    if o.yaml {
+        name = descutil.OutputName(o.gen, file.FileDescriptorProto, ".openapi.yaml")
+        b.WriteString("# Code generated by protoc-gen-go. DO NOT EDIT.\n")
+        b.WriteString("# source: " + file.GetName() + "\n")
+        writeYAML(&b, doc, "")
+    } else {
+        data, err := json.MarshalIndent(doc, "", "  ")
+        if err != nil {
+            o.gen.Error(err, "failed to encode the OpenAPI document")
+        }
+        b.Write(data)
+        b.WriteString("\n")
+    }
+    descutil.AddFile(o.gen, name, b.String())
+}
+
+// document returns the OpenAPI document of file.
+func (o *openapi) document(file *generator.FileDescriptor) object {
+    o.schemas = make(map[string]interface{})
+    doc := object{
+        "openapi": version,
+        "info":    o.info(file),
+        "paths":   o.paths(file),
+    }
+    if tags := o.tags(file); len(tags) > 0 {
+        doc["tags"] = tags
+    }
+    prefix := "."
+    if pkg := file.GetPackage(); pkg != "" {
+        prefix += pkg + "."
+    }
+    for _, msg := range descutil.FileMessages(file.FileDescriptorProto) {
+        o.addMessage(prefix + strings.Join(msg.Name, "."))
+    }
+    for _, enum := range descutil.FileEnums(file.FileDescriptorProto) {
+        o.addEnum(prefix + strings.Join(enum.Name, "."))
+    }
+    if len(o.schemas) > 0 {
+        doc["components"] = object{"schemas": object(o.schemas)}
+    }
+    return doc
+}
+
+// GenerateImports generates the import declaration for this file.
+func (o *openapi) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// info returns the info object of the document of file.
+func (o *openapi) info(file *generator.FileDescriptor) object {
+    info := object{"title": file.GetName(), "version": "0.0.0"}
+    // A package ending with a version, e.g. library.v1, gives its version.
+    if parts := strings.Split(file.GetPackage(), "."); len(parts) > 1 && versionPart.MatchString(parts[len(parts)-1]) {
+        info["version"] = parts[len(parts)-1]
+    }
+    if comments := descutil.LeadingComments(file.FileDescriptorProto, "2"); comments != "" { // 2 means package.
+        info["description"] = comments
+    }
+    return info
+}
+
+// tags returns the tags of the document of file: one per service, tagging
+// the operations of its methods.
+func (o *openapi) tags(file *generator.FileDescriptor) []interface{} {
+    var tags []interface{}
+    for i, service := range file.FileDescriptorProto.Service {
+        tag := object{"name": service.GetName()}
+        if pkg := file.GetPackage(); pkg != "" {
+            tag["name"] = pkg + "." + service.GetName()
+        }
+        if comments := descutil.LeadingComments(file.FileDescriptorProto, fmt.Sprintf("6,%d", i)); comments != "" { // 6 means service.
+            tag["description"] = comments
+        }
+        tags = append(tags, tag)
+    }
+    return tags
+}
+
+// operationMethods are the HTTP methods which OpenAPI describes operations of.
+var operationMethods = map[string]bool{
+    "GET": true, "PUT": true, "POST": true, "DELETE": true, "OPTIONS": true, "HEAD": true, "PATCH": true, "TRACE": true,
+}
+
+// paths returns the paths object of the document of file.
+func (o *openapi) paths(file *generator.FileDescriptor) object {
+    paths := make(object)
+    addOperation := func(path, method string, op object) {
+        item, ok := paths[path].(object)
+        if !ok {
+            item = make(object)
+            paths[path] = item
+        }
+        item[strings.ToLower(method)] = op
+    }
+    for i, service := range file.FileDescriptorProto.Service {
+        fullServName := service.GetName()
+        if pkg := file.GetPackage(); pkg != "" {
+            fullServName = pkg + "." + fullServName
+        }
+        for j, method := range service.Method {
+            op := object{
+                "operationId": service.GetName() + "_" + method.GetName(),
+                "tags":        []interface{}{fullServName},
+                "requestBody": object{
+                    "required": true,
+                    "content":  object{"application/json": object{"schema": o.ref(method.GetInputType())}},
+                },
+                "responses": o.responses(o.ref(method.GetOutputType())),
+            }
+            description := descutil.LeadingComments(file.FileDescriptorProto, fmt.Sprintf("6,%d,2,%d", i, j))
+            if method.GetClientStreaming() || method.GetServerStreaming() {
+                description = strings.TrimSpace(description + "\n\nStreaming method, served by the Connect handlers only.")
+            }
+            if description != "" {
+                op["description"] = description
+            }
+            addOperation("/"+fullServName+"/"+method.GetName(), "POST", op)
+
+            for k, rule := range descutil.HTTPRules(method) {
+                if !operationMethods[rule.Method] {
+                    continue // custom methods cannot be described
+                }
+                restOp := o.restOperation(method, rule)
+                restOp["operationId"] = service.GetName() + "_" + method.GetName() + "_REST"
+                if k > 0 {
+                    restOp["operationId"] = fmt.Sprintf("%s_%s_REST%d", service.GetName(), method.GetName(), k+1)
+                }
+                restOp["tags"] = []interface{}{fullServName}
+                if d, ok := op["description"]; ok {
+                    restOp["description"] = d
+                }
+                addOperation(templatePath(rule.Pattern), rule.Method, restOp)
+            }
+        }
+    }
+    return paths
+}
+
+// versionPart matches the last component of the packages ending with a
+// version, e.g. library.v1.
+var versionPart = regexp.MustCompile(`^v\d+`)
+
+// templateVariable matches the variables of a google.api.http path template.
+var templateVariable = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+// templatePath returns the OpenAPI path of the google.api.http path template
+// pattern, in which variables are written as {name}.
+func templatePath(pattern string) string {
+    return templateVariable.ReplaceAllString(pattern, "{$1}")
+}
+
+// restOperation returns the operation of the REST route of method mapped by
+// rule: the path variables and the query parameters set fields of the input,
+// as does the body.
+func (o *openapi) restOperation(method *pb.MethodDescriptorProto, rule descutil.HTTPRule) object {
+    op := make(object)
+    var params []interface{}
+    inPath := make(map[string]bool)
+    for _, m := range templateVariable.FindAllStringSubmatch(rule.Pattern, -1) {
+        inPath[m[1]] = true
+        schema := object{"type": "string"}
+        if field := o.fieldAt(method.GetInputType(), m[1]); field != nil {
+            schema = o.valueSchema(field)
+        }
+        params = append(params, object{"name": m[1], "in": "path", "required": true, "schema": schema})
+    }
+    if rule.Body != "*" {
+        if msg := o.types.Message(method.GetInputType()); msg != nil {
+            for _, field := range msg.Message.Field {
+                if inPath[field.GetName()] || field.GetName() == rule.Body || !isQueryField(field) {
+                    continue
+                }
+                params = append(params, object{"name": field.GetName(), "in": "query", "schema": o.fieldSchema(field)})
+            }
+        }
+    }
+    if len(params) > 0 {
+        op["parameters"] = params
+    }
+    switch rule.Body {
+    case "":
+    case "*":
+        op["requestBody"] = object{"required": true, "content": object{"application/json": object{"schema": o.ref(method.GetInputType())}}}
+    default:
+        if field := o.fieldAt(method.GetInputType(), rule.Body); field != nil {
+            op["requestBody"] = object{"required": true, "content": object{"application/json": object{"schema": o.fieldSchema(field)}}}
+        }
+    }
+    response := o.ref(method.GetOutputType())
+    if rule.ResponseBody != "" {
+        if field := o.fieldAt(method.GetOutputType(), rule.ResponseBody); field != nil {
+            response = o.fieldSchema(field)
+        }
+    }
+    op["responses"] = o.responses(response)
+    return op
+}
+
+// isQueryField reports whether field can be set by a query parameter: it
+// is a scalar, possibly repeated, or a well-known type with a scalar value.
+func isQueryField(field *pb.FieldDescriptorProto) bool {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE:
+        schema, ok := wellKnownSchemas[field.GetTypeName()]
+        return ok && schema["type"] != "object" && schema["type"] != "array" && len(schema) > 0
+    case pb.FieldDescriptorProto_TYPE_GROUP:
+        return false
+    }
+    return true
+}
+
+// fieldAt returns the field of the message typ at the dotted field path, or nil.
+func (o *openapi) fieldAt(typ, path string) *pb.FieldDescriptorProto {
+    var field *pb.FieldDescriptorProto
+    for _, name := range strings.Split(path, ".") {
+        msg := o.types.Message(typ)
+        if msg == nil {
+            return nil
+        }
+        field = nil
+        for _, f := range msg.Message.Field {
+            if f.GetName() == name {
+                field = f
+            }
+        }
+        if field == nil {
+            return nil
+        }
+        typ = field.GetTypeName()
+    }
+    return field
+}
+
+// responses returns the responses of an operation whose successful
+// response has the given schema.
+func (o *openapi) responses(schema object) object {
+    return object{
+        "200": object{
+            "description": "OK",
+            "content":     object{"application/json": object{"schema": schema}},
+        },
+        "default": object{
+            "description": "Error",
+            "content":     object{"text/plain": object{"schema": object{"type": "string"}}},
+        },
+    }
+}
+
+// ref returns the schema of the message or enum typ: a reference to its
+// component, added if needed, or the schema of a well-known type.
+func (o *openapi) ref(typ string) object {
+    if schema, ok := wellKnownSchemas[typ]; ok {
+        copied := make(object)
+        for k, v := range schema {
+            copied[k] = v
+        }
+        if o.int64Numbers && copied["type"] == "string" && (copied["format"] == "int64" || copied["format"] == "uint64") {
+            copied["type"] = "integer"
+        }
+        if o.unixMillis && typ == ".google.protobuf.Timestamp" {
+            copied = object{"type": "integer", "format": "int64", "description": "Milliseconds since the Unix epoch."}
+        }
+        return copied
+    }
+    if o.types.Enum(typ) != nil {
+        o.addEnum(typ)
+    } else {
+        o.addMessage(typ)
+    }
+    return object{"$ref": "#/components/schemas/" + strings.TrimPrefix(typ, ".")}
+}
+
+// addMessage adds the schema of the message typ to the components, along
+// with the schemas of the messages and enums it refers to.
+func (o *openapi) addMessage(typ string) {
+    name := strings.TrimPrefix(typ, ".")
+    if _, ok := o.schemas[name]; ok {
+        return
+    }
+    msg := o.types.Message(typ)
+    if msg == nil {
+        return
+    }
+    schema := object{"type": "object"}
+    o.schemas[name] = schema // before the fields, for recursive messages
+    if comments := descutil.LeadingComments(msg.File, msg.Path); comments != "" {
+        schema["description"] = comments
+    }
+    properties := make(object)
+    for i, field := range msg.Message.Field {
+        s := o.fieldSchema(field)
+        if comments := descutil.LeadingComments(msg.File, fmt.Sprintf("%s,2,%d", msg.Path, i)); comments != "" {
+            if _, isRef := s["$ref"]; isRef {
+                // Siblings of $ref are ignored: wrap it.
+                s = object{"allOf": []interface{}{s}}
+            }
+            s["description"] = comments
+        }
+        properties[descutil.JSONName(field)] = s
+    }
+    if len(properties) > 0 {
+        schema["properties"] = properties
+    }
+}
+
+// addEnum adds the schema of the enum typ to the components.
+func (o *openapi) addEnum(typ string) {
+    name := strings.TrimPrefix(typ, ".")
+    if _, ok := o.schemas[name]; ok {
+        return
+    }
+    enum := o.types.Enum(typ)
+    if enum == nil {
+        return
+    }
+    var values []interface{}
+    seen := make(map[int32]bool)
+    for _, v := range enum.Enum.Value {
+        if !o.enumNumbers {
+            values = append(values, v.GetName())
+        } else if !seen[v.GetNumber()] {
+            seen[v.GetNumber()] = true
+            values = append(values, v.GetNumber())
+        }
+    }
+    schema := object{"type": "string", "enum": values}
+    if o.enumNumbers {
+        schema = object{"type": "integer", "format": "int32", "enum": values}
+    }
+    if comments := descutil.LeadingComments(enum.File, enum.Path); comments != "" {
+        schema["description"] = comments
+    }
+    o.schemas[name] = schema
+}
+
+// fieldSchema returns the schema of the value of field: an array for
+// repeated fields, an object for maps.
+func (o *openapi) fieldSchema(field *pb.FieldDescriptorProto) object {
+    if field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE {
+        if entry := o.types.Message(field.GetTypeName()); entry != nil && entry.Message.GetOptions().GetMapEntry() {
+            return object{"type": "object", "additionalProperties": o.valueSchema(entry.Message.Field[1])}
+        }
+    }
+    if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+        return object{"type": "array", "items": o.valueSchema(field)}
+    }
+    return o.valueSchema(field)
+}
+
+// valueSchema returns the schema of a single value of field.
+func (o *openapi) valueSchema(field *pb.FieldDescriptorProto) object {
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        return object{"type": "boolean"}
+    case pb.FieldDescriptorProto_TYPE_STRING:
+        return object{"type": "string"}
+    case pb.FieldDescriptorProto_TYPE_BYTES:
+        return object{"type": "string", "format": "byte"}
+    case pb.FieldDescriptorProto_TYPE_INT32, pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SFIXED32:
+        return object{"type": "integer", "format": "int32"}
+    case pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_FIXED32:
+        return object{"type": "integer", "format": "int64", "minimum": 0}
+    case pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_SINT64, pb.FieldDescriptorProto_TYPE_SFIXED64:
+        if o.int64Numbers {
+            return object{"type": "integer", "format": "int64"}
+        }
+        return object{"type": "string", "format": "int64"}
+    case pb.FieldDescriptorProto_TYPE_UINT64, pb.FieldDescriptorProto_TYPE_FIXED64:
+        if o.int64Numbers {
+            return object{"type": "integer", "format": "uint64", "minimum": 0}
+        }
+        return object{"type": "string", "format": "uint64"}
+    case pb.FieldDescriptorProto_TYPE_FLOAT:
+        return object{"type": "number", "format": "float"}
+    case pb.FieldDescriptorProto_TYPE_DOUBLE:
+        return object{"type": "number", "format": "double"}
+    }
+    return o.ref(field.GetTypeName())
+}
+
+// writeYAML writes v, a value of a document, to b in YAML, the lines of
+// nested values being indented by indent. Strings are written in double
+// quotes, as JSON strings, which YAML reads the same.
+func writeYAML(b *bytes.Buffer, v interface{}, indent string) {
+    switch v := v.(type) {
+    case object:
+        if len(v) == 0 {
+            b.WriteString(" {}\n")
+            return
+        }
+        if indent != "" || b.Len() > 0 && b.Bytes()[b.Len()-1] != '\n' {
+            b.WriteString("\n")
+        }
+        keys := make([]string, 0, len(v))
+        for k := range v {
+            keys = append(keys, k)
+        }
+        sort.Strings(keys)
+        for _, k := range keys {
+            fmt.Fprintf(b, "%s%s:", indent, yamlKey(k))
+            writeYAML(b, v[k], indent+"  ")
+        }
+    case []interface{}:
+        if len(v) == 0 {
+            b.WriteString(" []\n")
+            return
+        }
+        b.WriteString("\n")
+        for _, e := range v {
+            fmt.Fprintf(b, "%s-", indent)
+            if o, ok := e.(object); ok && len(o) > 0 {
+                // The first key of an object goes on the line of the dash.
+                var item bytes.Buffer
+                writeYAML(&item, o, indent+"  ")
+                b.WriteString(" " + strings.TrimPrefix(item.String(), "\n"+indent+"  "))
+                continue
+            }
+            writeYAML(b, e, indent+"  ")
+        }
+    case string:
+        b.WriteString(" " + strconv.Quote(v) + "\n")
+    default:
+        fmt.Fprintf(b, " %v\n", v)
+    }
+}
+
+// plainKey matches the mapping keys written without quotes.
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// yamlKey returns the mapping key k, quoted if it is not a plain word.
+func yamlKey(k string) string {
+    if plainKey.MatchString(k) {
+        return k
+    }
+    return strconv.Quote(k)
+}
@@ -0,0 +1,102 @@
+// Package openmetrics exposes, in the OpenMetrics text format, gauges
+// describing the schemas linked in to the running binary, so that fleet
+// dashboards can detect the deployments running different schema versions.
+//
+// The packages generated with the schemametrics plugin register their
+// schema when they are initialized.
+package openmetrics
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// ContentType is the content type of the OpenMetrics text format.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Schema describes the schema of a generated package.
+type Schema struct {
+    Package          string         // the protobuf package
+    Hash             string         // the hash of the descriptor set it was generated from
+    GeneratorVersion string         // the version of the protoc-gen-go which generated it
+    ServiceMethods   map[string]int // the number of methods of its services, by full name
+}
+
+var (
+    mu      sync.Mutex
+    schemas []Schema
+)
+
+// RegisterSchema registers schema, exposed by WriteSchemas and Handler.
+func RegisterSchema(schema Schema) {
+    mu.Lock()
+    defer mu.Unlock()
+    schemas = append(schemas, schema)
+}
+
+// Schemas returns the schemas registered, sorted by package.
+func Schemas() []Schema {
+    mu.Lock()
+    defer mu.Unlock()
+    sorted := append([]Schema(nil), schemas...)
+    sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Package < sorted[j].Package })
+    return sorted
+}
+
+// WriteSchemas writes to w the exposition of the schemas registered, ended
+// by the # EOF line:
+//
+//    # TYPE protobuf_schema_info gauge
+//    # HELP protobuf_schema_info The schemas linked in to the binary, always 1.
+//    protobuf_schema_info{package="shop",schema_hash="sha256:...",generator_version="0.1.0"} 1
+//    # TYPE protobuf_schema_service_methods gauge
+//    # HELP protobuf_schema_service_methods The number of methods of the services of the schemas.
+//    protobuf_schema_service_methods{package="shop",service="shop.Orders"} 4
+//    # EOF
+func WriteSchemas(w io.Writer) error {
+    schemas := Schemas()
+    b := bufio.NewWriter(w)
+    b.WriteString("# TYPE protobuf_schema_info gauge\n")
+    b.WriteString("# HELP protobuf_schema_info The schemas linked in to the binary, always 1.\n")
+    for _, s := range schemas {
+        fmt.Fprintf(b, "protobuf_schema_info{package=%s,schema_hash=%s,generator_version=%s} 1\n",
+            labelValue(s.Package), labelValue(s.Hash), labelValue(s.GeneratorVersion))
+    }
+    b.WriteString("# TYPE protobuf_schema_service_methods gauge\n")
+    b.WriteString("# HELP protobuf_schema_service_methods The number of methods of the services of the schemas.\n")
+    for _, s := range schemas {
+        var services []string
+        for service := range s.ServiceMethods {
+            services = append(services, service)
+        }
+        sort.Strings(services)
+        for _, service := range services {
+            fmt.Fprintf(b, "protobuf_schema_service_methods{package=%s,service=%s} %d\n",
+                labelValue(s.Package), labelValue(service), s.ServiceMethods[service])
+        }
+    }
+    b.WriteString("# EOF\n")
+    return b.Flush()
+}
+
+// Handler returns an http.Handler serving the exposition of the schemas
+// registered, e.g. to be scraped by Prometheus from /metrics/schema.
+func Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", ContentType)
+        WriteSchemas(w)
+    })
+}
+
+// labelReplacer escapes the label values.
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue returns s as a quoted label value.
+func labelValue(s string) string {
+    return `"` + labelReplacer.Replace(s) + `"`
+}
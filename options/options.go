@@ -0,0 +1,314 @@
+// Package options outputs typed accessors of the custom options.
+//
+// For every custom option set in the files to generate, e.g. a string
+// auth_role method option, it generates a table of its values by element
+// and an accessor, e.g. MethodAuthRole(method string) (string, bool), so
+// that the options can be read at run time without parsing descriptors.
+// The accessors of all the files to generate are written in the Go file of
+// the first one. Options of a message type are not supported.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package options
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+    "github.com/lleveque/protoc-gen-go/wire"
+)
+
+func init() {
+    generator.RegisterPlugin(new(options))
+}
+
+// options is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates accessors of the custom options.
+type options struct {
+    gen *generator.Generator
+}
+
+// kinds are the kinds of elements having options, with the name of their
+// options message.
+var kinds = []struct {
+    name     string
+    extendee string
+}{
+    {"File", ".google.protobuf.FileOptions"},
+    {"Message", ".google.protobuf.MessageOptions"},
+    {"Field", ".google.protobuf.FieldOptions"},
+    {"Enum", ".google.protobuf.EnumOptions"},
+    {"EnumValue", ".google.protobuf.EnumValueOptions"},
+    {"Service", ".google.protobuf.ServiceOptions"},
+    {"Method", ".google.protobuf.MethodOptions"},
+}
+
+// element is an element having options: its name, fully-qualified without
+// leading dot, or the name of the file for files, and its serialized options.
+type element struct {
+    name string
+    opts *wire.Message
+}
+
+// Name returns the name of this plugin, "options".
+func (o *options) Name() string {
+    return "options"
+}
+
+// Init initializes the plugin.
+func (o *options) Init(gen *generator.Generator) {
+    o.gen = gen
+}
+
+// P forwards to o.gen.P.
+func (o *options) P(args ...interface{}) { o.gen.P(args...) }
+
+// Generate generates the accessors of the custom options of the files to
+// generate when generating the first one.
+func (o *options) Generate(file *generator.FileDescriptor) {
+    if file.GetName() != o.gen.Request.FileToGenerate[0] {
+        return
+    }
+    elements := o.elements()
+    for _, kind := range kinds {
+        for _, ext := range descutil.Extensions(o.gen, kind.extendee) {
+            o.generateAccessor(kind.name, ext, elements[kind.name])
+        }
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (o *options) GenerateImports(file *generator.FileDescriptor) {
+}
+
+// elements returns the elements of the files to generate, by kind.
+func (o *options) elements() map[string][]element {
+    elements := make(map[string][]element)
+    add := func(kind, name string, opts proto.Message) {
+        if raw := descutil.Options(opts); raw != nil {
+            elements[kind] = append(elements[kind], element{name, raw})
+        }
+    }
+    addEnums := func(prefix string, enums []*pb.EnumDescriptorProto) {
+        for _, enum := range enums {
+            name := prefix + enum.GetName()
+            add("Enum", name, enum.Options)
+            for _, v := range enum.Value {
+                add("EnumValue", name+"."+v.GetName(), v.Options)
+            }
+        }
+    }
+    var addMessages func(prefix string, msgs []*pb.DescriptorProto)
+    addMessages = func(prefix string, msgs []*pb.DescriptorProto) {
+        for _, msg := range msgs {
+            if msg.GetOptions().GetMapEntry() {
+                continue
+            }
+            name := prefix + msg.GetName()
+            add("Message", name, msg.Options)
+            for _, field := range msg.Field {
+                add("Field", name+"."+field.GetName(), field.Options)
+            }
+            addEnums(name+".", msg.EnumType)
+            addMessages(name+".", msg.NestedType)
+        }
+    }
+    for _, f := range o.gen.Request.ProtoFile {
+        if !descutil.IsGenerated(o.gen, f.GetName()) {
+            continue
+        }
+        prefix := ""
+        if pkg := f.GetPackage(); pkg != "" {
+            prefix = pkg + "."
+        }
+        add("File", f.GetName(), f.Options)
+        addMessages(prefix, f.MessageType)
+        addEnums(prefix, f.EnumType)
+        for _, s := range f.Service {
+            name := prefix + s.GetName()
+            add("Service", name, s.Options)
+            for _, m := range s.Method {
+                add("Method", name+"."+m.GetName(), m.Options)
+            }
+        }
+    }
+    return elements
+}
+
+// generateAccessor generates the table of the values of the custom option
+// ext of the elements of kind, and its accessor, if the option is set.
+func (o *options) generateAccessor(kind string, ext descutil.ExtensionField, elements []element) {
+    typ := o.goType(ext.FieldDescriptorProto)
+    if typ == "" {
+        return
+    }
+    var entries []string
+    for _, e := range elements {
+        values := o.literals(ext.FieldDescriptorProto, e.opts)
+        if len(values) == 0 {
+            continue
+        }
+        value := values[len(values)-1]
+        if ext.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+            value = typ + "{" + strings.Join(values, ", ") + "}"
+        }
+        entries = append(entries, fmt.Sprintf("%s: %s,", strconv.Quote(e.name), value))
+    }
+    if len(entries) == 0 {
+        return
+    }
+
+    optName := "(" + strings.TrimPrefix(ext.FullName, ".") + ")"
+    funcName := kind + generator.CamelCase(ext.GetName())
+    tableName := strings.ToLower(kind[:1]) + funcName[1:]
+    param := strings.ToLower(kind[:1]) + kind[1:]
+    what := map[string]string{
+        "File":      "file named " + param,
+        "Message":   "message named " + param + ", fully-qualified",
+        "Field":     "field named " + param + ", e.g. pkg.Message.field",
+        "Enum":      "enum named " + param + ", fully-qualified",
+        "EnumValue": "enum value named " + param + ", e.g. pkg.Enum.VALUE",
+        "Service":   "service named " + param + ", fully-qualified",
+        "Method":    "method named " + param + ", e.g. pkg.Service.Method",
+    }[kind]
+
+    o.P("// ", tableName, " holds the values of the ", optName, " option, by element.")
+    o.P("var ", tableName, " = map[string]", typ, "{")
+    for _, entry := range entries {
+        o.P(entry)
+    }
+    o.P("}")
+    o.P()
+    o.P("// ", funcName, " returns the value of the ", optName, " option of the")
+    o.P("// ", what, ", and whether it is set.")
+    o.P("func ", funcName, "(", param, " string) (", typ, ", bool) {")
+    o.P("v, ok := ", tableName, "[", param, "]")
+    o.P("return v, ok")
+    o.P("}")
+    o.P()
+}
+
+// goType returns the Go type of the values of the option ext, or "" if
+// the option is of a message type.
+func (o *options) goType(ext *pb.FieldDescriptorProto) string {
+    var typ string
+    switch ext.GetType() {
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        typ = "bool"
+    case pb.FieldDescriptorProto_TYPE_STRING:
+        typ = "string"
+    case pb.FieldDescriptorProto_TYPE_BYTES:
+        typ = "[]byte"
+    case pb.FieldDescriptorProto_TYPE_INT32, pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SFIXED32:
+        typ = "int32"
+    case pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_SINT64, pb.FieldDescriptorProto_TYPE_SFIXED64:
+        typ = "int64"
+    case pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_FIXED32:
+        typ = "uint32"
+    case pb.FieldDescriptorProto_TYPE_UINT64, pb.FieldDescriptorProto_TYPE_FIXED64:
+        typ = "uint64"
+    case pb.FieldDescriptorProto_TYPE_FLOAT:
+        typ = "float32"
+    case pb.FieldDescriptorProto_TYPE_DOUBLE:
+        typ = "float64"
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        o.gen.RecordTypeUse(ext.GetTypeName())
+        typ = o.gen.TypeName(o.gen.ObjectNamed(ext.GetTypeName()))
+    default:
+        return ""
+    }
+    if ext.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+        typ = "[]" + typ
+    }
+    return typ
+}
+
+// literals returns the values of the option ext in opts as Go expressions,
+// in the order they occur.
+func (o *options) literals(ext *pb.FieldDescriptorProto, opts *wire.Message) []string {
+    num := ext.GetNumber()
+    var values []string
+    switch ext.GetType() {
+    case pb.FieldDescriptorProto_TYPE_STRING:
+        for _, b := range opts.RepeatedLengthDelimited(num) {
+            values = append(values, strconv.Quote(string(b)))
+        }
+    case pb.FieldDescriptorProto_TYPE_BYTES:
+        for _, b := range opts.RepeatedLengthDelimited(num) {
+            values = append(values, "[]byte("+strconv.Quote(string(b))+")")
+        }
+    case pb.FieldDescriptorProto_TYPE_FIXED32, pb.FieldDescriptorProto_TYPE_SFIXED32:
+        for _, x := range opts.RepeatedFixed32(num) {
+            if ext.GetType() == pb.FieldDescriptorProto_TYPE_SFIXED32 {
+                values = append(values, strconv.FormatInt(int64(int32(x)), 10))
+            } else {
+                values = append(values, strconv.FormatUint(uint64(x), 10))
+            }
+        }
+    case pb.FieldDescriptorProto_TYPE_FIXED64, pb.FieldDescriptorProto_TYPE_SFIXED64:
+        for _, x := range opts.RepeatedFixed64(num) {
+            if ext.GetType() == pb.FieldDescriptorProto_TYPE_SFIXED64 {
+                values = append(values, strconv.FormatInt(int64(x), 10))
+            } else {
+                values = append(values, strconv.FormatUint(x, 10))
+            }
+        }
+    case pb.FieldDescriptorProto_TYPE_FLOAT:
+        for _, x := range opts.RepeatedFixed32(num) {
+            values = append(values, floatLiteral(float64(math.Float32frombits(x)), "float32"))
+        }
+    case pb.FieldDescriptorProto_TYPE_DOUBLE:
+        for _, x := range opts.RepeatedFixed64(num) {
+            values = append(values, floatLiteral(math.Float64frombits(x), "float64"))
+        }
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        for _, x := range opts.RepeatedVarint(num) {
+            values = append(values, strconv.FormatBool(x != 0))
+        }
+    case pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_UINT64:
+        for _, x := range opts.RepeatedVarint(num) {
+            values = append(values, strconv.FormatUint(x, 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SINT64:
+        for _, x := range opts.RepeatedVarint(num) {
+            values = append(values, strconv.FormatInt(wire.DecodeZigzag64(x), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        typ := o.gen.TypeName(o.gen.ObjectNamed(ext.GetTypeName()))
+        for _, x := range opts.RepeatedVarint(num) {
+            values = append(values, fmt.Sprintf("%s(%d)", typ, int32(x)))
+        }
+    case pb.FieldDescriptorProto_TYPE_INT32:
+        for _, x := range opts.RepeatedVarint(num) {
+            values = append(values, strconv.FormatInt(int64(int32(x)), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_INT64:
+        for _, x := range opts.RepeatedVarint(num) {
+            values = append(values, strconv.FormatInt(int64(x), 10))
+        }
+    }
+    return values
+}
+
+// floatLiteral returns the Go expression of f, of the type typ.
+func floatLiteral(f float64, typ string) string {
+    switch {
+    case math.IsNaN(f):
+        return typ + "(math.NaN())"
+    case math.IsInf(f, 1):
+        return typ + "(math.Inf(1))"
+    case math.IsInf(f, -1):
+        return typ + "(math.Inf(-1))"
+    }
+    bits := 64
+    if typ == "float32" {
+        bits = 32
+    }
+    return strconv.FormatFloat(f, 'g', -1, bits)
+}
@@ -0,0 +1,231 @@
+// Package pact outputs consumer-driven contracts of the services.
+//
+// The methods give examples of their calls with a custom method option
+// named example, which may be repeated, whose value is a JSON object with
+// the description of the call, its request, and its response or the code
+// of its error, e.g.
+//
+//    option (example) = '{"description": "greets Bob", "request": {"name": "Bob"}, "response": {"greeting": "Hello Bob"}}';
+//
+// For every service with examples, a contract in the Pact format is written
+// next to the generated Go file, as <consumer>-<package>.<Service>.json,
+// the consumer being named by the pact_consumer parameter, and
+// VerifyFooContract is generated, sending the requests of the contract to
+// an http.Handler serving the service and checking its responses.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package pact
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "path"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/httprpc"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// Paths for packages used by code generated in this file.
+const (
+    httpPkgPath    = "net/http"
+    httprpcPkgPath = "github.com/lleveque/protoc-gen-go/httprpc"
+)
+
+// optionName is the name of the method option giving examples of calls.
+const optionName = "example"
+
+func init() {
+    generator.RegisterPlugin(new(pact))
+}
+
+// pact is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates contracts and their verification.
+type pact struct {
+    gen      *generator.Generator
+    consumer string
+}
+
+// The names for packages imported in the generated code.
+// They may vary from the final path component of the import path
+// if the name is used by other packages.
+var (
+    httpPkg    string
+    httprpcPkg string
+)
+
+// example is the value of an example option.
+type example struct {
+    Description string          `json:"description"`
+    Request     json.RawMessage `json:"request"`
+    Response    json.RawMessage `json:"response"`
+    Error       httprpc.Code    `json:"error"`
+}
+
+// Name returns the name of this plugin, "pact".
+func (p *pact) Name() string {
+    return "pact"
+}
+
+// Init initializes the plugin.
+func (p *pact) Init(gen *generator.Generator) {
+    p.gen = gen
+    p.consumer = gen.Param["pact_consumer"]
+    if p.consumer == "" {
+        p.consumer = "consumer"
+    }
+    httpPkg = generator.RegisterUniquePackageName("http", nil)
+    httprpcPkg = generator.RegisterUniquePackageName("httprpc", nil)
+}
+
+// P forwards to p.gen.P.
+func (p *pact) P(args ...interface{}) { p.gen.P(args...) }
+
+// Generate writes the contracts of the services of the given file, and
+// generates their verification.
+func (p *pact) Generate(file *generator.FileDescriptor) {
+    if !p.hasExamples(file) {
+        return
+    }
+    for _, service := range file.Service {
+        fullServName := service.GetName()
+        if pkg := file.GetPackage(); pkg != "" {
+            fullServName = pkg + "." + fullServName
+        }
+        c := p.contract(service, fullServName)
+        if len(c.Interactions) == 0 {
+            continue
+        }
+        data, err := json.MarshalIndent(c, "", "  ")
+        if err != nil {
+            p.gen.Error(err, "failed to encode the contract of", fullServName)
+        }
+        compacted := compact(data)
+        dir := path.Dir(descutil.OutputName(p.gen, file.FileDescriptorProto, ".pb.go"))
+        name := path.Join(dir, p.consumer+"-"+fullServName+".json")
+        descutil.AddFile(p.gen, name, string(data)+"\n")
+
+        servName := generator.CamelCase(service.GetName())
+        contractName := unexport(servName) + "Contract"
+        p.P("// ", contractName, " is the contract of the ", servName, " service with ", p.consumer, ",")
+        p.P("// as written to ", path.Base(name), ".")
+        p.P("const ", contractName, " = ", strconv.Quote(string(compacted)))
+        p.P()
+        p.P("// Verify", servName, "Contract sends the requests of the examples of the ", servName, " methods")
+        p.P("// to h, serving them as POST /", fullServName, "/<Method> with JSON bodies as the")
+        p.P("// Connect handler or the http handler of grpcserial do, and reports to t the")
+        p.P("// responses not matching the expected ones.")
+        p.P("func Verify", servName, "Contract(t ", httprpcPkg, ".TB, h ", httpPkg, ".Handler) {")
+        p.P("t.Helper()")
+        p.P(httprpcPkg, ".VerifyContract(t, h, ", contractName, ")")
+        p.P("}")
+        p.P()
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (p *pact) GenerateImports(file *generator.FileDescriptor) {
+    if !p.hasExamples(file) {
+        return
+    }
+    p.P("import (")
+    p.P(httpPkg, " ", strconv.Quote(httpPkgPath))
+    p.P(httprpcPkg, " ", strconv.Quote(httprpcPkgPath))
+    p.P(")")
+    p.P()
+}
+
+// hasExamples reports whether a method of a service of file has examples.
+func (p *pact) hasExamples(file *generator.FileDescriptor) bool {
+    if !descutil.IsGenerated(p.gen, file.GetName()) {
+        return false
+    }
+    for _, service := range file.Service {
+        for _, method := range service.Method {
+            if len(p.examples(method)) > 0 {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// examples returns the values of the example options of method.
+func (p *pact) examples(method *pb.MethodDescriptorProto) [][]byte {
+    ext := descutil.Extension(p.gen, ".google.protobuf.MethodOptions", optionName)
+    if ext == nil || ext.GetType() != pb.FieldDescriptorProto_TYPE_STRING {
+        return nil
+    }
+    return descutil.Options(method.Options).RepeatedLengthDelimited(ext.GetNumber())
+}
+
+// contract returns the contract of service, named fullServName, with an
+// interaction per example of its unary methods.
+func (p *pact) contract(service *pb.ServiceDescriptorProto, fullServName string) httprpc.Contract {
+    c := httprpc.Contract{
+        Consumer:     httprpc.Pacticipant{Name: p.consumer},
+        Provider:     httprpc.Pacticipant{Name: fullServName},
+        Interactions: []httprpc.Interaction{},
+    }
+    c.Metadata.PactSpecification.Version = "2.0.0"
+    jsonHeaders := map[string]string{"Content-Type": "application/json"}
+    for _, method := range service.Method {
+        name := fullServName + "." + method.GetName()
+        for i, value := range p.examples(method) {
+            if method.GetClientStreaming() || method.GetServerStreaming() {
+                p.gen.Fail("invalid", optionName, "option of", name+": streaming methods have no examples")
+            }
+            var ex example
+            if err := json.Unmarshal(value, &ex); err != nil {
+                p.gen.Fail(fmt.Sprintf("invalid %s option of %s: %v", optionName, name, err))
+            }
+            if ex.Description == "" {
+                ex.Description = fmt.Sprintf("%s example %d", method.GetName(), i+1)
+            }
+            if len(ex.Request) == 0 {
+                ex.Request = json.RawMessage("{}")
+            }
+            it := httprpc.Interaction{
+                Description: ex.Description,
+                Request: httprpc.InteractionRequest{
+                    Method:  "POST",
+                    Path:    "/" + fullServName + "/" + method.GetName(),
+                    Headers: jsonHeaders,
+                    Body:    compact(ex.Request),
+                },
+                Response: httprpc.InteractionResponse{
+                    Status:  200,
+                    Headers: jsonHeaders,
+                    Body:    compact(ex.Response),
+                },
+            }
+            if ex.Error != "" {
+                if len(ex.Response) > 0 {
+                    p.gen.Fail("invalid", optionName, "option of", name+": both a response and an error")
+                }
+                it.Response.Status = ex.Error.ConnectStatus()
+                it.Response.Body, _ = json.Marshal(map[string]httprpc.Code{"code": ex.Error})
+            }
+            c.Interactions = append(c.Interactions, it)
+        }
+    }
+    return c
+}
+
+// compact returns the JSON value data without insignificant space.
+func compact(data json.RawMessage) json.RawMessage {
+    if len(data) == 0 {
+        return nil
+    }
+    var b bytes.Buffer
+    json.Compact(&b, data)
+    return b.Bytes()
+}
+
+// unexport returns s with its first letter in lower case.
+func unexport(s string) string { return strings.ToLower(s[:1]) + s[1:] }
@@ -0,0 +1,100 @@
+// Package presence outputs the presence methods of the fields of the
+// messages.
+//
+// For every field foo of a message which tracks its presence, namely its
+// singular message fields, its optional and required proto2 scalar fields,
+// and the fields of its oneofs, it generates a HasFoo() bool method
+// reporting whether the field is set, so that the implementations can tell
+// an unset field from a zero one without comparing pointers. The proto3
+// scalar fields do not track their presence and get none, nor do the fields
+// whose method would take the name of another field.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package presence
+
+import (
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+func init() {
+    generator.RegisterPlugin(new(presence))
+}
+
+// presence is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the presence methods of the fields of
+// the messages of each file.
+type presence struct {
+    gen *generator.Generator
+}
+
+// Name returns the name of this plugin, "presence".
+func (p *presence) Name() string {
+    return "presence"
+}
+
+// Init initializes the plugin.
+func (p *presence) Init(gen *generator.Generator) {
+    p.gen = gen
+}
+
+// P forwards to p.gen.P.
+func (p *presence) P(args ...interface{}) { p.gen.P(args...) }
+
+// Generate generates the presence methods of the messages in the given
+// file.
+func (p *presence) Generate(file *generator.FileDescriptor) {
+    if !descutil.IsGenerated(p.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(p.gen, file) {
+        p.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+// The generated code imports no package.
+func (p *presence) GenerateImports(file *generator.FileDescriptor) {}
+
+// generateMessage generates the presence methods of the fields of msg.
+func (p *presence) generateMessage(msg *generator.Descriptor) {
+    typeName := p.gen.TypeName(msg)
+    names := make(map[string]bool)
+    for _, field := range msg.Field {
+        names[generator.CamelCase(field.GetName())] = true
+    }
+    for _, oneof := range msg.OneofDecl {
+        names[generator.CamelCase(oneof.GetName())] = true
+    }
+    for _, field := range msg.Field {
+        fieldName := generator.CamelCase(field.GetName())
+        if !hasPresence(msg, field) || names["Has"+fieldName] {
+            continue
+        }
+        p.P("// Has", fieldName, " reports whether the ", field.GetName(), " field of m is set.")
+        p.P("func (m *", typeName, ") Has", fieldName, "() bool {")
+        if field.OneofIndex != nil {
+            p.P("_, ok := m.Get", generator.CamelCase(msg.OneofDecl[field.GetOneofIndex()].GetName()), "().(*", typeName, "_", fieldName, ")")
+            p.P("return ok")
+        } else {
+            p.P("return m != nil && m.", fieldName, " != nil")
+        }
+        p.P("}")
+        p.P()
+    }
+}
+
+// hasPresence reports whether field of msg tracks its presence.
+func hasPresence(msg *generator.Descriptor, field *pb.FieldDescriptorProto) bool {
+    switch {
+    case field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        return false
+    case field.OneofIndex != nil:
+        return true
+    case field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE, field.GetType() == pb.FieldDescriptorProto_TYPE_GROUP:
+        return true
+    }
+    return msg.File().GetSyntax() != "proto3"
+}
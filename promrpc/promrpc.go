@@ -0,0 +1,100 @@
+// Package promrpc records the calls of the serialized API and of the
+// Connect servers as Prometheus metrics.
+//
+// It backs the metrics generated by the grpcserial and connect plugins with
+// the prometheus parameter, so that every service built from them exports
+// the same metrics, by service and method, under the namespace given by the
+// prometheus_namespace parameter:
+//
+//   - <namespace>_rpc_requests_total, the number of calls,
+//   - <namespace>_rpc_errors_total, the number of calls failed,
+//   - <namespace>_rpc_request_bytes_total, the size of the requests received,
+//   - <namespace>_rpc_response_bytes_total, the size of the responses sent,
+//   - <namespace>_rpc_duration_seconds, the histogram of the call latency.
+package promrpc
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/lleveque/protoc-gen-go/httprpc"
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the metrics of the calls of a namespace.
+type Metrics struct {
+    requests      *prometheus.CounterVec
+    errors        *prometheus.CounterVec
+    requestBytes  *prometheus.CounterVec
+    responseBytes *prometheus.CounterVec
+    duration      *prometheus.HistogramVec
+}
+
+var (
+    mu          sync.Mutex
+    byNamespace = make(map[string]*Metrics)
+)
+
+// labels are the labels of the metrics.
+var labels = []string{"service", "method"}
+
+// New returns the metrics of namespace, registered with the default
+// Prometheus registerer when first asked for, so that the packages sharing
+// a namespace share its metrics.
+func New(namespace string) *Metrics {
+    mu.Lock()
+    defer mu.Unlock()
+    if m, ok := byNamespace[namespace]; ok {
+        return m
+    }
+    counter := func(name, help string) *prometheus.CounterVec {
+        return prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Subsystem: "rpc",
+            Name:      name,
+            Help:      help,
+        }, labels)
+    }
+    m := &Metrics{
+        requests:      counter("requests_total", "Number of calls."),
+        errors:        counter("errors_total", "Number of calls failed."),
+        requestBytes:  counter("request_bytes_total", "Size in bytes of the requests received, serialized."),
+        responseBytes: counter("response_bytes_total", "Size in bytes of the responses sent, serialized."),
+        duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: namespace,
+            Subsystem: "rpc",
+            Name:      "duration_seconds",
+            Help:      "Latency of the calls, in seconds.",
+            Buckets:   prometheus.DefBuckets,
+        }, labels),
+    }
+    prometheus.MustRegister(m.requests, m.errors, m.requestBytes, m.responseBytes, m.duration)
+    byNamespace[namespace] = m
+    return m
+}
+
+// Observe records a call of method of service, e.g. "pkg.Service" and
+// "Method", started at start, with requests and responses of requestSize
+// and responseSize bytes in total, and failed with err if not nil.
+func (m *Metrics) Observe(service, method string, start time.Time, requestSize, responseSize int, err error) {
+    m.requests.WithLabelValues(service, method).Inc()
+    if err != nil {
+        m.errors.WithLabelValues(service, method).Inc()
+    }
+    m.requestBytes.WithLabelValues(service, method).Add(float64(requestSize))
+    m.responseBytes.WithLabelValues(service, method).Add(float64(responseSize))
+    m.duration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+}
+
+// Interceptor returns an interceptor recording the calls served by
+// httprpc.ServeConnect in m.
+func (m *Metrics) Interceptor() httprpc.ConnectInterceptor {
+    return func(ctx context.Context, c *httprpc.ServerCall, next func(ctx context.Context) error) error {
+        start := time.Now()
+        err := next(ctx)
+        service, method := httprpc.SplitProcedure(c.Procedure())
+        m.Observe(service, method, start, c.ReceivedBytes(), c.SentBytes(), err)
+        return err
+    }
+}
@@ -0,0 +1,61 @@
+// Package pubsubrpc carries the calls of the serialized API over Google
+// Cloud Pub/Sub.
+//
+// It backs the Pub/Sub bindings generated by the grpcserial plugin with the
+// pubsub parameter: the data of the messages of a subscription is the
+// serialized input of a method, delivered either to a push endpoint, in the
+// JSON envelopes decoded by DecodePush, or to a pull Subscriber.
+package pubsubrpc
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+)
+
+// Message is a Pub/Sub message.
+type Message struct {
+    ID         string
+    Data       []byte
+    Attributes map[string]string
+}
+
+// pushEnvelope is the JSON body of the requests of a push subscription.
+type pushEnvelope struct {
+    Message *struct {
+        Data       []byte            `json:"data"`
+        Attributes map[string]string `json:"attributes"`
+        MessageID  string            `json:"messageId"`
+    } `json:"message"`
+    Subscription string `json:"subscription"`
+}
+
+// ErrNoMessage is returned by DecodePush for the envelopes without a
+// message.
+var ErrNoMessage = errors.New("pubsubrpc: no message in the push envelope")
+
+// DecodePush decodes the JSON envelope, read from r, of a message pushed by
+// a push subscription, and returns the message and the full name of the
+// subscription, e.g. "projects/myproject/subscriptions/mysubscription".
+func DecodePush(r io.Reader) (m *Message, subscription string, err error) {
+    var env pushEnvelope
+    if err := json.NewDecoder(r).Decode(&env); err != nil {
+        return nil, "", err
+    }
+    if env.Message == nil {
+        return nil, "", ErrNoMessage
+    }
+    m = &Message{ID: env.Message.MessageID, Data: env.Message.Data, Attributes: env.Message.Attributes}
+    return m, env.Subscription, nil
+}
+
+// Subscriber is the part of a pull subscription the subscriber loops use,
+// e.g. an adapter of the Subscription of cloud.google.com/go/pubsub.
+type Subscriber interface {
+    // Receive calls handle with every message of the subscription, until
+    // ctx is done or the subscription fails, acknowledging the messages it
+    // handles, and not acknowledging the others, whose handling failed,
+    // so that they are delivered again.
+    Receive(ctx context.Context, handle func(ctx context.Context, m *Message) error) error
+}
@@ -0,0 +1,950 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "go/ast"
+    "go/format"
+    "go/token"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// genVersion is the version of the generated code of the
+// google.golang.org/protobuf runtime the message code is generated for
+// with runtime=v2, checked by protoimpl.EnforceVersion.
+const genVersion = 20
+
+// runtimeV2Imports are the packages the message code generated with
+// runtime=v2 imports, by name.
+var runtimeV2Imports = []struct{ name, path string }{
+    {"protoreflect", "google.golang.org/protobuf/reflect/protoreflect"},
+    {"protoimpl", "google.golang.org/protobuf/runtime/protoimpl"},
+    {"reflect", "reflect"},
+    {"sync", "sync"},
+}
+
+// migrateRuntimeV2 rewrites the message code of the generated Go files for
+// the google.golang.org/protobuf (API v2) runtime, with runtime=v2, as the
+// modern protoc-gen-go generates it: the message structs hold a
+// protoimpl.MessageState, and get a ProtoReflect method, and the file
+// descriptor is built by protoimpl.TypeBuilder from the raw descriptor of
+// the file, rather than registered with github.com/golang/protobuf/proto.
+// The getters, oneof wrappers, default values, enum maps and extension
+// variables keep their names. The code of the plugins is kept, their uses
+// of XXX_unrecognized referring to the unknown fields of the messages.
+// It runs before the other passes rewriting the generated files, and
+// before the files are renamed, by paths= or module=.
+func migrateRuntimeV2(g *generator.Generator) {
+    types := descutil.NewTypeSet(g)
+    for _, name := range g.Request.FileToGenerate {
+        var fd *pb.FileDescriptorProto
+        for _, f := range g.Request.ProtoFile {
+            if f.GetName() == name {
+                fd = f
+            }
+        }
+        if len(fd.PublicDependency) > 0 {
+            g.Fail(name + ": public imports are not supported with runtime=v2")
+        }
+        goName := descutil.GoFileName(fd, false)
+        for _, f := range g.Response.File {
+            if f.GetName() == goName {
+                f.Content = proto.String(newV2File(g, types, fd).rewrite(f.GetContent()))
+            }
+        }
+    }
+}
+
+// v2File is a generated Go file being rewritten for the API v2 runtime.
+// The enums, messages and extensions of its .proto file are listed in the
+// flattened ordering of protoimpl.TypeBuilder: those of the file, then
+// those of every message, depth first, the map entries included.
+type v2File struct {
+    g      *generator.Generator
+    types  descutil.TypeSet
+    fd     *pb.FileDescriptorProto
+    pkg    string // name of the Go package of the file
+    prefix string // prefix of its unexported variables, e.g. file_foo_proto
+
+    enums      []string // fully-qualified names, e.g. ".greeting.Foo"
+    messages   []string
+    extensions []*pb.FieldDescriptorProto
+    extNames   []string // fully-qualified names of the extensions, without the leading dot
+
+    imports map[string]string // names of the dependencies referenced by the Go types, by import path
+}
+
+// newV2File returns the v2File of fd, whose types are looked up in types.
+func newV2File(g *generator.Generator, types descutil.TypeSet, fd *pb.FileDescriptorProto) *v2File {
+    f := &v2File{
+        g:       g,
+        types:   types,
+        fd:      fd,
+        pkg:     g.FileOf(fd).PackageName(),
+        prefix:  fileVarPrefix(fd.GetName()),
+        imports: make(map[string]string),
+    }
+    scope := ""
+    if pkg := fd.GetPackage(); pkg != "" {
+        scope = "." + pkg
+    }
+    f.add(scope, fd.EnumType, fd.MessageType, fd.Extension)
+    var walk func(scope string, msgs []*pb.DescriptorProto)
+    walk = func(scope string, msgs []*pb.DescriptorProto) {
+        for _, msg := range msgs {
+            name := scope + "." + msg.GetName()
+            f.add(name, msg.EnumType, msg.NestedType, msg.Extension)
+            walk(name, msg.NestedType)
+        }
+    }
+    walk(scope, fd.MessageType)
+    return f
+}
+
+// add appends the enums, messages and extensions declared in scope to f.
+func (f *v2File) add(scope string, enums []*pb.EnumDescriptorProto, msgs []*pb.DescriptorProto, exts []*pb.FieldDescriptorProto) {
+    for _, enum := range enums {
+        f.enums = append(f.enums, scope+"."+enum.GetName())
+    }
+    for _, msg := range msgs {
+        f.messages = append(f.messages, scope+"."+msg.GetName())
+    }
+    for _, ext := range exts {
+        f.extensions = append(f.extensions, ext)
+        f.extNames = append(f.extNames, strings.TrimPrefix(scope+"."+ext.GetName(), "."))
+    }
+}
+
+// fileVarPrefix returns the prefix of the unexported variables of the code
+// generated for the .proto file name, e.g. file_foo_proto for foo.proto, as
+// the modern protoc-gen-go names them.
+func fileVarPrefix(name string) string {
+    ident := fileDescriptorIdent(name)
+    _, n := utf8.DecodeRuneInString(ident)
+    return strings.ToLower(ident[:n]) + ident[n:]
+}
+
+// fileDescriptorIdent returns the name of the exported variable holding
+// the protoreflect.FileDescriptor of the .proto file name, e.g.
+// File_foo_proto for foo.proto.
+func fileDescriptorIdent(name string) string {
+    name = strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return r
+        }
+        return '_'
+    }, name)
+    if r, _ := utf8.DecodeRuneInString(name); !unicode.IsLetter(r) {
+        name = "_" + name
+    }
+    return "File_" + name
+}
+
+// goIdent returns the Go identifier of the message or enum typ, qualified
+// by the name of the package of its file if it is not the package of f.
+func (f *v2File) goIdent(typ string) string {
+    t := f.types[typ]
+    if t == nil {
+        f.g.Fail(f.fd.GetName() + ": unknown type " + typ)
+    }
+    ident := generator.CamelCaseSlice(t.Name)
+    file := f.g.FileOf(t.File)
+    if file.PackageName() == f.pkg {
+        return ident
+    }
+    imported := false
+    for _, dep := range f.fd.Dependency {
+        imported = imported || dep == t.File.GetName()
+    }
+    if !imported {
+        f.g.Fail(f.fd.GetName() + ": " + typ[1:] + " is not defined in a file it imports, which runtime=v2 does not support")
+    }
+    f.imports[f.importPath(t.File)] = file.PackageName()
+    return file.PackageName() + "." + ident
+}
+
+// importPath returns the import path of the Go package of the dependency
+// dep, as protoc-gen-go imports it.
+func (f *v2File) importPath(dep *pb.FileDescriptorProto) string {
+    importPath := path.Dir(descutil.GoFileName(dep, false))
+    if substitution, ok := f.g.ImportMap[dep.GetName()]; ok {
+        importPath = substitution
+    }
+    return f.g.ImportPrefix + importPath
+}
+
+// isMapEntry reports whether the message typ is the virtual message of the
+// entries of a map field, which has no Go type.
+func (f *v2File) isMapEntry(typ string) bool {
+    return f.types[typ].Message.GetOptions().GetMapEntry()
+}
+
+// dependencies returns the Go types of the enums and messages of f,
+// followed by the ones they depend on, and the indexes of the dependencies
+// of the fields, extensions and methods of f in that list, followed by the
+// start of each kind of dependencies, as protoimpl.TypeBuilder expects
+// them, as lines of Go source commented with the names of the types.
+func (f *v2File) dependencies() (goTypes, depIdxs []string) {
+    seen := make(map[string]int)
+    dep := func(typ, goType, source string) {
+        if _, ok := seen[typ]; !ok {
+            seen[typ] = len(goTypes)
+            goTypes = append(goTypes, fmt.Sprintf("%s, // %d: %s", goType, len(goTypes), typ[1:]))
+        }
+        if source != "" {
+            depIdxs = append(depIdxs, fmt.Sprintf("%d, // %d: %s -> %s", seen[typ], len(depIdxs), source, typ[1:]))
+        }
+    }
+    enum := func(typ, source string) {
+        dep(typ, "("+f.goIdent(typ)+")(0)", source)
+    }
+    message := func(typ, source string) {
+        if f.types.Message(typ) != nil && f.isMapEntry(typ) {
+            dep(typ, "nil", source)
+        } else {
+            dep(typ, "(*"+f.goIdent(typ)+")(nil)", source)
+        }
+    }
+    field := func(field *pb.FieldDescriptorProto, source string) {
+        switch field.GetType() {
+        case pb.FieldDescriptorProto_TYPE_ENUM:
+            enum(field.GetTypeName(), source+":type_name")
+        case pb.FieldDescriptorProto_TYPE_MESSAGE, pb.FieldDescriptorProto_TYPE_GROUP:
+            message(field.GetTypeName(), source+":type_name")
+        }
+    }
+
+    for _, typ := range f.enums {
+        enum(typ, "")
+    }
+    for _, typ := range f.messages {
+        message(typ, "")
+    }
+    type offset struct {
+        start int
+        name  string
+    }
+    offsets := []offset{{len(depIdxs), "field type_name"}}
+    for _, typ := range f.messages {
+        for _, fld := range f.types[typ].Message.Field {
+            if !fld.GetOptions().GetWeak() {
+                field(fld, typ[1:]+"."+fld.GetName())
+            }
+        }
+    }
+    offsets = append(offsets, offset{len(depIdxs), "extension extendee"})
+    for i, ext := range f.extensions {
+        message(ext.GetExtendee(), f.extNames[i]+":extendee")
+    }
+    offsets = append(offsets, offset{len(depIdxs), "extension type_name"})
+    for i, ext := range f.extensions {
+        field(ext, f.extNames[i])
+    }
+    offsets = append(offsets, offset{len(depIdxs), "method input_type"})
+    for _, svc := range f.fd.Service {
+        for _, method := range svc.Method {
+            message(method.GetInputType(), f.methodName(svc, method)+":input_type")
+        }
+    }
+    offsets = append(offsets, offset{len(depIdxs), "method output_type"})
+    for _, svc := range f.fd.Service {
+        for _, method := range svc.Method {
+            message(method.GetOutputType(), f.methodName(svc, method)+":output_type")
+        }
+    }
+    offsets = append(offsets, offset{len(depIdxs), ""})
+    for i := len(offsets) - 2; i >= 0; i-- {
+        curr, next := offsets[i], offsets[i+1]
+        depIdxs = append(depIdxs, fmt.Sprintf("%d, // [%d:%d] is the sub-list for %s", curr.start, curr.start, next.start, curr.name))
+    }
+    return goTypes, depIdxs
+}
+
+// methodName returns the fully-qualified name of method of svc, without a
+// leading dot.
+func (f *v2File) methodName(svc *pb.ServiceDescriptorProto, method *pb.MethodDescriptorProto) string {
+    name := svc.GetName() + "." + method.GetName()
+    if pkg := f.fd.GetPackage(); pkg != "" {
+        name = pkg + "." + name
+    }
+    return name
+}
+
+// sourceEdit replaces the bytes from start to end of a Go source with text.
+type sourceEdit struct {
+    start, end int
+    text       string
+}
+
+// applyEdits returns content with edits applied. The edits do not overlap,
+// but an insertion may start where a removal starts.
+func applyEdits(content string, edits []sourceEdit) string {
+    sort.SliceStable(edits, func(i, j int) bool {
+        if edits[i].start != edits[j].start {
+            return edits[i].start > edits[j].start
+        }
+        return edits[i].end > edits[j].end
+    })
+    for _, e := range edits {
+        content = content[:e.start] + e.text + content[e.end:]
+    }
+    return content
+}
+
+// wholeLines extends the range from start to end of content to the lines
+// it spans, their newline included, when nothing else is on them.
+func wholeLines(content string, start, end int) (int, int) {
+    if s := strings.LastIndexByte(content[:start], '\n') + 1; strings.TrimSpace(content[s:start]) == "" {
+        start = s
+    }
+    if i := strings.IndexByte(content[end:], '\n'); i >= 0 && strings.TrimSpace(content[end:end+i]) == "" {
+        end += i + 1
+    }
+    return start, end
+}
+
+// rewrite returns the Go source content generated for the file of f
+// rewritten for the API v2 runtime.
+func (f *v2File) rewrite(content string) string {
+    goTypes, depIdxs := f.dependencies()
+    fset, file := parseGo(f.g, content)
+    offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+    var edits []sourceEdit
+    insert := func(pos token.Pos, text string) {
+        edits = append(edits, sourceEdit{offset(pos), offset(pos), text})
+    }
+    replace := func(from, to token.Pos, text string) {
+        edits = append(edits, sourceEdit{offset(from), offset(to), text})
+    }
+    remove := func(from, to token.Pos) {
+        start, end := wholeLines(content, offset(from), offset(to))
+        edits = append(edits, sourceEdit{start, end, ""})
+    }
+    removeDecl := func(decl ast.Decl, doc *ast.CommentGroup) {
+        if doc != nil {
+            remove(doc.Pos(), decl.End())
+        } else {
+            remove(decl.Pos(), decl.End())
+        }
+    }
+    // The unknown fields are renamed, and the descriptor of the file is
+    // compressed from the raw descriptor, in the code kept as is.
+    descVar := f.g.FileOf(f.fd).VarName()
+    rename := func(node ast.Node) {
+        ast.Inspect(node, func(n ast.Node) bool {
+            switch n := n.(type) {
+            case *ast.SelectorExpr:
+                if n.Sel.Name == "XXX_unrecognized" {
+                    replace(n.Sel.Pos(), n.Sel.End(), "unknownFields")
+                }
+            case *ast.Ident:
+                if n.Name == descVar {
+                    replace(n.Pos(), n.End(), f.prefix+"_rawDescGZIP()")
+                }
+            }
+            return true
+        })
+    }
+
+    messages := make(map[string]int) // indexes of the message structs, by name
+    for i, typ := range f.messages {
+        if !f.isMapEntry(typ) {
+            messages[f.goIdent(typ)] = i
+        }
+    }
+    enums := make(map[string]int)
+    for i, typ := range f.enums {
+        enums[f.goIdent(typ)] = i
+    }
+    extIndexes := make(map[string]int)
+    for i, name := range f.extNames {
+        extIndexes[name] = i
+    }
+    extensions := make([]string, len(f.extensions)) // the fields of their protoimpl.ExtensionInfo
+    wrappers := make(map[string]string)             // the oneof wrapper types of the messages, by name
+    protoPkg := f.g.Pkg["proto"]
+    var lastImport ast.Decl
+    for _, decl := range file.Decls {
+        switch decl := decl.(type) {
+        case *ast.GenDecl:
+            switch {
+            case decl.Tok == token.IMPORT:
+                lastImport = decl
+            case isVersionConst(decl, protoPkg):
+                start := decl.Pos()
+                if decl.Doc != nil {
+                    start = decl.Doc.Pos()
+                }
+                // The comment following the assertion goes along.
+                end := offset(decl.End())
+                if i := strings.IndexByte(content[end:], '\n'); i >= 0 {
+                    end += i
+                }
+                edits = append(edits, sourceEdit{offset(start), end, "const (\n" +
+                    "// Verify that this generated code is sufficiently up-to-date.\n" +
+                    fmt.Sprintf("_ = protoimpl.EnforceVersion(%d - protoimpl.MinVersion)\n", genVersion) +
+                    "// Verify that runtime/protoimpl is sufficiently up-to-date.\n" +
+                    fmt.Sprintf("_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - %d)\n", genVersion) +
+                    ")"})
+            case isReferenceVar(decl, f.g.Pkg["proto"], f.g.Pkg["fmt"], f.g.Pkg["math"]):
+                removeDecl(decl, decl.Doc)
+            case declares(decl, func(name string) bool { return name == descVar || strings.HasPrefix(name, "extRange_") }):
+                removeDecl(decl, decl.Doc)
+            default:
+                for _, spec := range decl.Specs {
+                    switch spec := spec.(type) {
+                    case *ast.ValueSpec:
+                        if len(spec.Values) == 1 {
+                            if lit := extensionDesc(spec.Values[0]); lit != nil {
+                                name := stringField(lit, "Name")
+                                i, ok := extIndexes[name]
+                                if !ok {
+                                    f.g.Fail(f.fd.GetName() + ": unknown extension " + strconv.Quote(name))
+                                }
+                                extensions[i] = content[offset(lit.Lbrace)+1 : offset(lit.Rbrace)]
+                                replace(spec.Values[0].Pos(), spec.Values[0].End(), fmt.Sprintf("&%s_extTypes[%d]", f.prefix, i))
+                                continue
+                            }
+                        }
+                    case *ast.TypeSpec:
+                        if _, ok := messages[spec.Name.Name]; ok {
+                            if st, ok := spec.Type.(*ast.StructType); ok {
+                                f.rewriteStruct(st, spec.Name.Name, insert, remove)
+                                continue
+                            }
+                        }
+                    }
+                    rename(spec)
+                }
+            }
+        case *ast.FuncDecl:
+            recv := receiverName(decl)
+            name := decl.Name.Name
+            if i, ok := messages[recv]; ok {
+                switch {
+                case name == "Reset":
+                    replace(decl.Pos(), decl.End(), f.messageReset(recv, i))
+                case name == "String":
+                    replace(decl.Pos(), decl.End(), "func (x *"+recv+") String() string {\nreturn protoimpl.X.MessageStringOf(x)\n}")
+                case name == "ProtoMessage":
+                    insert(decl.End(), "\n\n"+f.messageProtoReflect(recv, i))
+                case name == "Descriptor":
+                    if decl.Doc == nil {
+                        insert(decl.Pos(), "// Deprecated: Use "+recv+".ProtoReflect.Descriptor instead.\n")
+                    }
+                    rename(decl)
+                case name == "XXX_OneofFuncs":
+                    if lit := lastResult(decl); lit != nil {
+                        wrappers[recv] = content[offset(lit.Lbrace)+1 : offset(lit.Rbrace)]
+                    }
+                    removeDecl(decl, decl.Doc)
+                case name == "ExtensionRangeArray" || strings.HasPrefix(name, "XXX_"):
+                    removeDecl(decl, decl.Doc)
+                default:
+                    rename(decl)
+                }
+                continue
+            }
+            if i, ok := enums[recv]; ok {
+                switch name {
+                case "String":
+                    replace(decl.Pos(), decl.End(), f.enumMethods(recv, i))
+                case "UnmarshalJSON":
+                    replace(decl.Pos(), decl.End(), "// Deprecated: Do not use.\n"+
+                        "func (x *"+recv+") UnmarshalJSON(b []byte) error {\n"+
+                        "num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)\n"+
+                        "if err != nil {\nreturn err\n}\n"+
+                        "*x = "+recv+"(num)\nreturn nil\n}")
+                case "EnumDescriptor":
+                    if decl.Doc == nil {
+                        insert(decl.Pos(), "// Deprecated: Use "+recv+".Descriptor instead.\n")
+                    }
+                    rename(decl)
+                default:
+                    rename(decl)
+                }
+                continue
+            }
+            switch {
+            case recv == "" && isRegistration(decl, protoPkg):
+                removeDecl(decl, decl.Doc)
+            case recv == "" && strings.HasPrefix(name, "_") && (strings.HasSuffix(name, "_OneofMarshaler") ||
+                strings.HasSuffix(name, "_OneofUnmarshaler") || strings.HasSuffix(name, "_OneofSizer")):
+                removeDecl(decl, decl.Doc)
+            default:
+                rename(decl)
+            }
+        }
+    }
+
+    // The dependencies imported for their side effects only by
+    // protoc-gen-go are named when their types are referenced, and the
+    // packages of the runtime imported.
+    imported := make(map[string]string) // paths of the imports, by name
+    for _, spec := range file.Imports {
+        importPath, _ := strconv.Unquote(spec.Path.Value)
+        if spec.Name != nil && spec.Name.Name == "_" && f.imports[importPath] != "" {
+            replace(spec.Name.Pos(), spec.Name.End(), f.imports[importPath])
+            imported[f.imports[importPath]] = importPath
+        } else if spec.Name != nil {
+            imported[spec.Name.Name] = importPath
+        } else {
+            imported[path.Base(importPath)] = importPath
+        }
+    }
+    var imports bytes.Buffer
+    for _, imp := range runtimeV2Imports {
+        if p, ok := imported[imp.name]; ok {
+            if p != imp.path {
+                f.g.Fail(f.fd.GetName() + ": runtime=v2 cannot import " + imp.path + " as " + imp.name + ", already the name of " + p)
+            }
+            continue
+        }
+        fmt.Fprintf(&imports, "import %s %q\n", imp.name, imp.path)
+    }
+    if lastImport == nil {
+        f.g.Fail(f.fd.GetName() + ": no imports in the generated Go code")
+    }
+    insert(lastImport.End(), "\n"+imports.String())
+
+    for i, ext := range extensions {
+        if ext == "" {
+            f.g.Fail(f.fd.GetName() + ": no Go code generated for the extension " + f.extNames[i])
+        }
+    }
+    content = applyEdits(content, edits) + "\n" + f.reflection(goTypes, depIdxs, extensions, wrappers)
+    src, err := format.Source([]byte(content))
+    if err != nil {
+        f.g.Error(err, "failed to format the Go code generated for runtime=v2")
+    }
+    return f.pruneImports(string(src))
+}
+
+// rewriteStruct rewrites the struct st of the message name: the XXX_
+// fields of the original runtime are replaced by the internal fields of
+// protoimpl, which come first.
+func (f *v2File) rewriteStruct(st *ast.StructType, name string, insert func(token.Pos, string), remove func(token.Pos, token.Pos)) {
+    for _, field := range st.Fields.List {
+        if isXXXField(field) {
+            remove(field.Pos(), field.End())
+        }
+    }
+    fields := "state protoimpl.MessageState\nsizeCache protoimpl.SizeCache\nunknownFields protoimpl.UnknownFields\n"
+    if f.hasExtensions(name) {
+        fields += "extensionFields protoimpl.ExtensionFields\n"
+    }
+    insert(st.Fields.Opening+1, "\n"+fields)
+}
+
+// hasExtensions reports whether the message struct name has extension
+// ranges, whose fields the struct holds.
+func (f *v2File) hasExtensions(name string) bool {
+    for _, typ := range f.messages {
+        if !f.isMapEntry(typ) && f.goIdent(typ) == name {
+            return len(f.types[typ].Message.ExtensionRange) > 0
+        }
+    }
+    return false
+}
+
+// messageReset returns the Reset method of the message struct name, the
+// message i of the file.
+func (f *v2File) messageReset(name string, i int) string {
+    return "func (x *" + name + ") Reset() {\n" +
+        "*x = " + name + "{}\n" +
+        "if protoimpl.UnsafeEnabled {\n" +
+        fmt.Sprintf("mi := &%s_msgTypes[%d]\n", f.prefix, i) +
+        "ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))\n" +
+        "ms.StoreMessageInfo(mi)\n" +
+        "}\n" +
+        "}"
+}
+
+// messageProtoReflect returns the ProtoReflect method of the message struct
+// name, the message i of the file.
+func (f *v2File) messageProtoReflect(name string, i int) string {
+    return "func (x *" + name + ") ProtoReflect() protoreflect.Message {\n" +
+        fmt.Sprintf("mi := &%s_msgTypes[%d]\n", f.prefix, i) +
+        "if protoimpl.UnsafeEnabled && x != nil {\n" +
+        "ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))\n" +
+        "if ms.LoadMessageInfo() == nil {\n" +
+        "ms.StoreMessageInfo(mi)\n" +
+        "}\n" +
+        "return ms\n" +
+        "}\n" +
+        "return mi.MessageOf(x)\n" +
+        "}"
+}
+
+// enumMethods returns the String, Descriptor, Type and Number methods of the
+// enum name, the enum i of the file.
+func (f *v2File) enumMethods(name string, i int) string {
+    return "func (x " + name + ") String() string {\n" +
+        "return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))\n" +
+        "}\n\n" +
+        "func (" + name + ") Descriptor() protoreflect.EnumDescriptor {\n" +
+        fmt.Sprintf("return %s_enumTypes[%d].Descriptor()\n", f.prefix, i) +
+        "}\n\n" +
+        "func (" + name + ") Type() protoreflect.EnumType {\n" +
+        fmt.Sprintf("return &%s_enumTypes[%d]\n", f.prefix, i) +
+        "}\n\n" +
+        "func (x " + name + ") Number() protoreflect.EnumNumber {\n" +
+        "return protoreflect.EnumNumber(x)\n" +
+        "}"
+}
+
+// reflection returns the declarations building the descriptor and the
+// types of the file with protoimpl.TypeBuilder, given the lines of its Go
+// types and dependency indexes, the fields of the protoimpl.ExtensionInfo
+// of its extensions and the oneof wrapper types of its messages.
+func (f *v2File) reflection(goTypes, depIdxs, extensions []string, wrappers map[string]string) string {
+    var b bytes.Buffer
+    p := func(args ...interface{}) {
+        fmt.Fprint(&b, args...)
+        b.WriteString("\n")
+    }
+    descIdent := fileDescriptorIdent(f.fd.GetName())
+    p("var ", descIdent, " protoreflect.FileDescriptor")
+    p()
+
+    desc := proto.Clone(f.fd).(*pb.FileDescriptorProto)
+    desc.SourceCodeInfo = nil // drop source code information
+    raw, err := proto.Marshal(desc)
+    if err != nil {
+        f.g.Error(err, "failed to marshal the descriptor of "+f.fd.GetName())
+    }
+    p("var ", f.prefix, "_rawDesc = []byte{")
+    for len(raw) > 0 {
+        n := 16
+        if n > len(raw) {
+            n = len(raw)
+        }
+        for _, c := range raw[:n] {
+            fmt.Fprintf(&b, "0x%02x, ", c)
+        }
+        p()
+        raw = raw[n:]
+    }
+    p("}")
+    p()
+    p("var (")
+    p(f.prefix, "_rawDescOnce sync.Once")
+    p(f.prefix, "_rawDescData = ", f.prefix, "_rawDesc")
+    p(")")
+    p()
+    p("func ", f.prefix, "_rawDescGZIP() []byte {")
+    p(f.prefix, "_rawDescOnce.Do(func() {")
+    p(f.prefix, "_rawDescData = protoimpl.X.CompressGZIP(", f.prefix, "_rawDescData)")
+    p("})")
+    p("return ", f.prefix, "_rawDescData")
+    p("}")
+    p()
+
+    if len(f.enums) > 0 {
+        p("var ", f.prefix, "_enumTypes = make([]protoimpl.EnumInfo, ", len(f.enums), ")")
+    }
+    if len(f.messages) > 0 {
+        p("var ", f.prefix, "_msgTypes = make([]protoimpl.MessageInfo, ", len(f.messages), ")")
+    }
+    p("var ", f.prefix, "_goTypes = []interface{}{")
+    for _, line := range goTypes {
+        p(line)
+    }
+    p("}")
+    p("var ", f.prefix, "_depIdxs = []int32{")
+    for _, line := range depIdxs {
+        p(line)
+    }
+    p("}")
+    if len(extensions) > 0 {
+        p("var ", f.prefix, "_extTypes = []protoimpl.ExtensionInfo{")
+        for _, ext := range extensions {
+            p("{", ext, "},")
+        }
+        p("}")
+    }
+    p()
+
+    p("func init() { ", f.prefix, "_init() }")
+    p("func ", f.prefix, "_init() {")
+    p("if ", descIdent, " != nil {")
+    p("return")
+    p("}")
+    // The files of the same Go package are initialized first.
+    for _, dep := range f.fd.Dependency {
+        for _, fd := range f.g.Request.ProtoFile {
+            if fd.GetName() == dep && f.g.FileOf(fd).PackageName() == f.pkg {
+                p(fileVarPrefix(dep), "_init()")
+            }
+        }
+    }
+    if len(f.messages) > 0 {
+        p("if !protoimpl.UnsafeEnabled {")
+        for i, typ := range f.messages {
+            if f.isMapEntry(typ) {
+                continue
+            }
+            name := f.goIdent(typ)
+            p(f.prefix, "_msgTypes[", i, "].Exporter = func(v interface{}, i int) interface{} {")
+            p("switch v := v.(*", name, "); i {")
+            p("case 0:\nreturn &v.state")
+            p("case 1:\nreturn &v.sizeCache")
+            p("case 2:\nreturn &v.unknownFields")
+            if f.hasExtensions(name) {
+                p("case 3:\nreturn &v.extensionFields")
+            }
+            p("default:\nreturn nil")
+            p("}")
+            p("}")
+        }
+        p("}")
+        for i, typ := range f.messages {
+            if f.isMapEntry(typ) {
+                continue
+            }
+            if types, ok := wrappers[f.goIdent(typ)]; ok {
+                p(f.prefix, "_msgTypes[", i, "].OneofWrappers = []interface{}{", types, "}")
+            }
+        }
+    }
+    p("type x struct{}")
+    p("out := protoimpl.TypeBuilder{")
+    p("File: protoimpl.DescBuilder{")
+    p("GoPackagePath: reflect.TypeOf(x{}).PkgPath(),")
+    p("RawDescriptor: ", f.prefix, "_rawDesc,")
+    p("NumEnums: ", len(f.enums), ",")
+    p("NumMessages: ", len(f.messages), ",")
+    p("NumExtensions: ", len(f.extensions), ",")
+    p("NumServices: ", len(f.fd.Service), ",")
+    p("},")
+    p("GoTypes: ", f.prefix, "_goTypes,")
+    p("DependencyIndexes: ", f.prefix, "_depIdxs,")
+    if len(f.enums) > 0 {
+        p("EnumInfos: ", f.prefix, "_enumTypes,")
+    }
+    if len(f.messages) > 0 {
+        p("MessageInfos: ", f.prefix, "_msgTypes,")
+    }
+    if len(f.extensions) > 0 {
+        p("ExtensionInfos: ", f.prefix, "_extTypes,")
+    }
+    p("}.Build()")
+    p(descIdent, " = out.File")
+    p(f.prefix, "_rawDesc = nil")
+    p(f.prefix, "_goTypes = nil")
+    p(f.prefix, "_depIdxs = nil")
+    p("}")
+    return b.String()
+}
+
+// pruneImports returns the Go source content without the named imports it
+// no longer references: the dependencies are kept for their side effects,
+// as protoc-gen-go imports them, the other packages removed.
+func (f *v2File) pruneImports(content string) string {
+    fset, file := parseGo(f.g, content)
+    used := make(map[string]bool)
+    ast.Inspect(file, func(n ast.Node) bool {
+        if sel, ok := n.(*ast.SelectorExpr); ok {
+            if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+                used[x.Name] = true
+            }
+        }
+        return true
+    })
+    deps := make(map[string]bool)
+    for _, dep := range f.fd.Dependency {
+        for _, fd := range f.g.Request.ProtoFile {
+            if fd.GetName() == dep {
+                deps[f.importPath(fd)] = true
+            }
+        }
+    }
+    var edits []sourceEdit
+    for _, decl := range file.Decls {
+        decl, ok := decl.(*ast.GenDecl)
+        if !ok || decl.Tok != token.IMPORT {
+            continue
+        }
+        for _, spec := range decl.Specs {
+            spec := spec.(*ast.ImportSpec)
+            if spec.Name == nil || spec.Name.Name == "_" || spec.Name.Name == "." || used[spec.Name.Name] {
+                continue
+            }
+            importPath, _ := strconv.Unquote(spec.Path.Value)
+            switch {
+            case deps[importPath]:
+                start, end := fset.Position(spec.Name.Pos()).Offset, fset.Position(spec.Name.End()).Offset
+                edits = append(edits, sourceEdit{start, end, "_"})
+            case !decl.Lparen.IsValid():
+                start, end := wholeLines(content, fset.Position(decl.Pos()).Offset, fset.Position(decl.End()).Offset)
+                edits = append(edits, sourceEdit{start, end, ""})
+            default:
+                start, end := wholeLines(content, fset.Position(spec.Pos()).Offset, fset.Position(spec.End()).Offset)
+                edits = append(edits, sourceEdit{start, end, ""})
+            }
+        }
+    }
+    src, err := format.Source([]byte(applyEdits(content, edits)))
+    if err != nil {
+        f.g.Error(err, "failed to format the Go code generated for runtime=v2")
+    }
+    return string(src)
+}
+
+// receiverName returns the name of the type of the receiver of decl, empty
+// for a function.
+func receiverName(decl *ast.FuncDecl) string {
+    if decl.Recv == nil || len(decl.Recv.List) == 0 {
+        return ""
+    }
+    typ := decl.Recv.List[0].Type
+    if star, ok := typ.(*ast.StarExpr); ok {
+        typ = star.X
+    }
+    if ident, ok := typ.(*ast.Ident); ok {
+        return ident.Name
+    }
+    return ""
+}
+
+// isIdent reports whether expr is the identifier name.
+func isIdent(expr ast.Expr, name string) bool {
+    ident, ok := expr.(*ast.Ident)
+    return ok && ident.Name == name
+}
+
+// isVersionConst reports whether decl is the assertion of the version of
+// the proto package protoc-gen-go generates, proto.ProtoPackageIsVersionN.
+func isVersionConst(decl *ast.GenDecl, protoPkg string) bool {
+    if decl.Tok != token.CONST || len(decl.Specs) != 1 {
+        return false
+    }
+    spec, ok := decl.Specs[0].(*ast.ValueSpec)
+    if !ok || len(spec.Values) != 1 {
+        return false
+    }
+    sel, ok := spec.Values[0].(*ast.SelectorExpr)
+    return ok && isIdent(sel.X, protoPkg) && strings.HasPrefix(sel.Sel.Name, "ProtoPackageIsVersion")
+}
+
+// isReferenceVar reports whether decl is one of the references protoc-gen-go
+// generates to the packages it imports, e.g. var _ = proto.Marshal.
+func isReferenceVar(decl *ast.GenDecl, pkgs ...string) bool {
+    if decl.Tok != token.VAR || len(decl.Specs) != 1 {
+        return false
+    }
+    spec, ok := decl.Specs[0].(*ast.ValueSpec)
+    if !ok || len(spec.Names) != 1 || spec.Names[0].Name != "_" || len(spec.Values) != 1 {
+        return false
+    }
+    sel, ok := spec.Values[0].(*ast.SelectorExpr)
+    if !ok {
+        return false
+    }
+    for _, pkg := range pkgs {
+        if isIdent(sel.X, pkg) {
+            return true
+        }
+    }
+    return false
+}
+
+// declares reports whether decl declares a single name, matched by match.
+func declares(decl *ast.GenDecl, match func(name string) bool) bool {
+    if len(decl.Specs) != 1 {
+        return false
+    }
+    spec, ok := decl.Specs[0].(*ast.ValueSpec)
+    return ok && len(spec.Names) == 1 && match(spec.Names[0].Name)
+}
+
+// isRegistration reports whether decl is an init function registering the
+// types, extensions or descriptor of the file with the proto package.
+func isRegistration(decl *ast.FuncDecl, protoPkg string) bool {
+    if decl.Name.Name != "init" || decl.Body == nil || len(decl.Body.List) == 0 {
+        return false
+    }
+    for _, stmt := range decl.Body.List {
+        expr, ok := stmt.(*ast.ExprStmt)
+        if !ok {
+            return false
+        }
+        call, ok := expr.X.(*ast.CallExpr)
+        if !ok {
+            return false
+        }
+        sel, ok := call.Fun.(*ast.SelectorExpr)
+        if !ok || !isIdent(sel.X, protoPkg) || !strings.HasPrefix(sel.Sel.Name, "Register") {
+            return false
+        }
+    }
+    return true
+}
+
+// isXXXField reports whether field is one of the XXX_ fields of the message
+// structs of the original runtime, the embedded XXX_InternalExtensions
+// included.
+func isXXXField(field *ast.Field) bool {
+    if len(field.Names) == 0 {
+        sel, ok := field.Type.(*ast.SelectorExpr)
+        return ok && sel.Sel.Name == "XXX_InternalExtensions"
+    }
+    return strings.HasPrefix(field.Names[0].Name, "XXX_")
+}
+
+// extensionDesc returns the composite literal of expr if it is an extension
+// descriptor of the original runtime, &proto.ExtensionDesc{...}.
+func extensionDesc(expr ast.Expr) *ast.CompositeLit {
+    unary, ok := expr.(*ast.UnaryExpr)
+    if !ok || unary.Op != token.AND {
+        return nil
+    }
+    lit, ok := unary.X.(*ast.CompositeLit)
+    if !ok {
+        return nil
+    }
+    if sel, ok := lit.Type.(*ast.SelectorExpr); ok && sel.Sel.Name == "ExtensionDesc" {
+        return lit
+    }
+    return nil
+}
+
+// stringField returns the value of the string field key of the composite
+// literal lit, empty if unset.
+func stringField(lit *ast.CompositeLit, key string) string {
+    for _, elt := range lit.Elts {
+        kv, ok := elt.(*ast.KeyValueExpr)
+        if !ok || !isIdent(kv.Key, key) {
+            continue
+        }
+        if value, ok := kv.Value.(*ast.BasicLit); ok && value.Kind == token.STRING {
+            s, _ := strconv.Unquote(value.Value)
+            return s
+        }
+    }
+    return ""
+}
+
+// lastResult returns the composite literal returned last by the function
+// decl, e.g. the oneof wrapper types returned by XXX_OneofFuncs.
+func lastResult(decl *ast.FuncDecl) *ast.CompositeLit {
+    if decl.Body == nil || len(decl.Body.List) == 0 {
+        return nil
+    }
+    ret, ok := decl.Body.List[len(decl.Body.List)-1].(*ast.ReturnStmt)
+    if !ok || len(ret.Results) == 0 {
+        return nil
+    }
+    lit, _ := ret.Results[len(ret.Results)-1].(*ast.CompositeLit)
+    return lit
+}
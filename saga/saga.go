@@ -0,0 +1,308 @@
+// Package saga outputs saga steps of the methods undone by a compensating
+// method.
+//
+// The compensating method of a method is given by a custom string method
+// option named compensated_by, naming a unary method of the same service,
+// e.g.
+//
+//    extend google.protobuf.MethodOptions {
+//        string compensated_by = 50500;
+//    }
+//    rpc CreateOrder(CreateOrderRequest) returns (Order) {
+//        option (compensated_by) = "CancelOrder";
+//    }
+//
+// For every service Foo with such methods it generates the FooCompensations
+// registry of the pairs of methods, a FooSagaClient interface of the
+// methods called, satisfied by the clients and implementations of Foo, and
+// a FooBarStep saga step per compensated method Bar. The first file of the
+// package with saga steps also gets the SagaStep interface and RunSaga,
+// running steps in turn and compensating the ones done, in reverse order,
+// when one fails.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package saga
+
+import (
+    "fmt"
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// optionName is the name of the method option giving the compensating
+// method of a method.
+const optionName = "compensated_by"
+
+const contextPkgPath = "context"
+
+// contextPkg is the name of the context package in the generated code,
+// which may vary from "context" if the name is used by other packages.
+var contextPkg string
+
+func init() {
+    generator.RegisterPlugin(new(saga))
+}
+
+// saga is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the saga steps of the compensated methods.
+type saga struct {
+    gen *generator.Generator
+}
+
+// Name returns the name of this plugin, "saga".
+func (s *saga) Name() string {
+    return "saga"
+}
+
+// Init initializes the plugin.
+func (s *saga) Init(gen *generator.Generator) {
+    s.gen = gen
+    contextPkg = generator.RegisterUniquePackageName("context", nil)
+}
+
+// typeName returns the name of the type named str in the .proto, as we
+// will print it, and records that we use it.
+func (s *saga) typeName(str string) string {
+    s.gen.RecordTypeUse(str)
+    return s.gen.TypeName(s.gen.ObjectNamed(str))
+}
+
+// P forwards to s.gen.P.
+func (s *saga) P(args ...interface{}) { s.gen.P(args...) }
+
+// Generate generates the saga steps of the services in the given file.
+func (s *saga) Generate(file *generator.FileDescriptor) {
+    if !s.hasSagas(file.FileDescriptorProto) {
+        return
+    }
+    if s.firstFile() == file.FileDescriptorProto {
+        s.generateHelpers()
+    }
+    for _, service := range file.FileDescriptorProto.Service {
+        if len(s.compensations(file.FileDescriptorProto, service)) > 0 {
+            s.generateService(file, service)
+        }
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (s *saga) GenerateImports(file *generator.FileDescriptor) {
+    if !s.hasSagas(file.FileDescriptorProto) {
+        return
+    }
+    s.P("import ", contextPkg, " ", strconv.Quote(contextPkgPath))
+    s.P()
+}
+
+// compensation is a method of a service and its compensating method.
+type compensation struct {
+    method, compensatingMethod *pb.MethodDescriptorProto
+}
+
+// compensations returns the methods of service with a compensating method,
+// and their compensating method. It fails on options not naming a unary
+// method of service, or set on streaming methods.
+func (s *saga) compensations(f *pb.FileDescriptorProto, service *pb.ServiceDescriptorProto) []compensation {
+    ext := descutil.Extension(s.gen, ".google.protobuf.MethodOptions", optionName)
+    if ext == nil {
+        return nil
+    }
+    if ext.GetType() != pb.FieldDescriptorProto_TYPE_STRING {
+        s.gen.Fail("the", optionName, "option must be a string")
+    }
+    var found []compensation
+    for _, method := range service.Method {
+        names := descutil.Options(method.Options).RepeatedLengthDelimited(ext.GetNumber())
+        if len(names) == 0 {
+            continue
+        }
+        name := string(names[len(names)-1])
+        fullName := service.GetName() + "." + method.GetName()
+        if pkg := f.GetPackage(); pkg != "" {
+            fullName = pkg + "." + fullName
+        }
+        if isStreaming(method) {
+            s.gen.Fail(fmt.Sprintf("invalid %s option of %s: streaming methods cannot be compensated", optionName, fullName))
+        }
+        var compensating *pb.MethodDescriptorProto
+        for _, m := range service.Method {
+            if m.GetName() == name {
+                compensating = m
+            }
+        }
+        if compensating == nil || isStreaming(compensating) || compensating == method {
+            s.gen.Fail(fmt.Sprintf("invalid %s option of %s: %q is not another unary method of %s", optionName, fullName, name, service.GetName()))
+        }
+        found = append(found, compensation{method, compensating})
+    }
+    return found
+}
+
+// hasSagas reports whether a service of f has compensated methods.
+func (s *saga) hasSagas(f *pb.FileDescriptorProto) bool {
+    for _, service := range f.Service {
+        if len(s.compensations(f, service)) > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// firstFile returns the first file to generate with compensated methods,
+// which gets the helpers of the package, or nil.
+func (s *saga) firstFile() *pb.FileDescriptorProto {
+    for _, name := range s.gen.Request.FileToGenerate {
+        for _, f := range s.gen.Request.ProtoFile {
+            if f.GetName() == name && s.hasSagas(f) {
+                return f
+            }
+        }
+    }
+    return nil
+}
+
+// generateHelpers generates, once per package, the SagaStep interface,
+// SagaError and RunSaga.
+func (s *saga) generateHelpers() {
+    s.P("// SagaStep is a step of a saga: a call which, once done, is undone by a")
+    s.P("// compensating call if a later step of the saga fails.")
+    s.P("type SagaStep interface {")
+    s.P("// Method returns the full name of the method called by the step.")
+    s.P("Method() string")
+    s.P("// Run runs the step.")
+    s.P("Run(ctx ", contextPkg, ".Context) error")
+    s.P("// Compensate undoes the step, once run.")
+    s.P("Compensate(ctx ", contextPkg, ".Context) error")
+    s.P("}")
+    s.P()
+    s.P("// SagaError is the error of a saga one step of which failed, returned by")
+    s.P("// RunSaga once the steps done before it are compensated.")
+    s.P("type SagaError struct {")
+    s.P("Method string // the method of the step which failed")
+    s.P("Err    error  // the error of the step")
+    s.P()
+    s.P("// CompensationErrors are the errors of the compensations which failed,")
+    s.P("// leaving their step done, in the order of the compensations.")
+    s.P("CompensationErrors []error")
+    s.P("}")
+    s.P()
+    s.P("func (e *SagaError) Error() string {")
+    s.P("if len(e.CompensationErrors) > 0 {")
+    s.P("return ", s.gen.Pkg["fmt"], `.Sprintf("saga step %s failed: %v; %d compensations failed, first: %v", e.Method, e.Err, len(e.CompensationErrors), e.CompensationErrors[0])`)
+    s.P("}")
+    s.P("return ", s.gen.Pkg["fmt"], `.Sprintf("saga step %s failed: %v", e.Method, e.Err)`)
+    s.P("}")
+    s.P()
+    s.P("// RunSaga runs steps in turn. If one fails, the steps done before it are")
+    s.P("// compensated, in reverse order, and a *SagaError is returned. The")
+    s.P("// compensations run even if ctx is done, which the steps may check.")
+    s.P("func RunSaga(ctx ", contextPkg, ".Context, steps ...SagaStep) error {")
+    s.P("for i, step := range steps {")
+    s.P("err := step.Run(ctx)")
+    s.P("if err == nil {")
+    s.P("continue")
+    s.P("}")
+    s.P("e := &SagaError{Method: step.Method(), Err: err}")
+    s.P("for j := i - 1; j >= 0; j-- {")
+    s.P("if err := steps[j].Compensate(ctx); err != nil {")
+    s.P("e.CompensationErrors = append(e.CompensationErrors, ", s.gen.Pkg["fmt"], `.Errorf("compensating %s: %v", steps[j].Method(), err))`)
+    s.P("}")
+    s.P("}")
+    s.P("return e")
+    s.P("}")
+    s.P("return nil")
+    s.P("}")
+    s.P()
+}
+
+// generateService generates the registry, client interface and saga steps
+// of service.
+func (s *saga) generateService(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto) {
+    fullServName := service.GetName()
+    if pkg := file.GetPackage(); pkg != "" {
+        fullServName = pkg + "." + fullServName
+    }
+    servName := generator.CamelCase(service.GetName())
+    clientName := servName + "SagaClient"
+    compensations := s.compensations(file.FileDescriptorProto, service)
+
+    s.P("// ", servName, "Compensations maps the full names of the methods of ", servName, " undone")
+    s.P("// by a compensating method, as given by their ", optionName, " option, to the")
+    s.P("// full name of the latter.")
+    s.P("var ", servName, "Compensations = map[string]string{")
+    for _, c := range compensations {
+        s.P(strconv.Quote(fullServName+"."+c.method.GetName()), ": ", strconv.Quote(fullServName+"."+c.compensatingMethod.GetName()), ",")
+    }
+    s.P("}")
+    s.P()
+
+    s.P("// ", clientName, " is the part of ", servName, " called by its saga steps, satisfied by")
+    s.P("// its clients and implementations.")
+    s.P("type ", clientName, " interface {")
+    seen := make(map[*pb.MethodDescriptorProto]bool)
+    for _, c := range compensations {
+        for _, method := range []*pb.MethodDescriptorProto{c.method, c.compensatingMethod} {
+            if seen[method] {
+                continue
+            }
+            seen[method] = true
+            s.P(generator.CamelCase(method.GetName()), "(ctx ", contextPkg, ".Context, in *", s.typeName(method.GetInputType()), ") (*", s.typeName(method.GetOutputType()), ", error)")
+        }
+    }
+    s.P("}")
+    s.P()
+
+    for _, c := range compensations {
+        methName := generator.CamelCase(c.method.GetName())
+        compName := generator.CamelCase(c.compensatingMethod.GetName())
+        stepName := servName + methName + "Step"
+        inType := s.typeName(c.method.GetInputType())
+        outType := s.typeName(c.method.GetOutputType())
+        compInType := s.typeName(c.compensatingMethod.GetInputType())
+
+        s.P("// ", stepName, " is the saga step calling ", methName, ", compensated by ", compName, ".")
+        s.P("type ", stepName, " struct {")
+        s.P("Client ", clientName)
+        s.P()
+        s.P("// In returns the input of the ", methName, " call, when the step runs, so that")
+        s.P("// it can depend on the outputs of the previous steps.")
+        s.P("In func() *", inType)
+        s.P()
+        s.P("// Compensation returns the input of the ", compName, " call undoing the")
+        s.P("// ", methName, " call, given its output.")
+        s.P("Compensation func(out *", outType, ") *", compInType)
+        s.P()
+        s.P("// Out is the output of the ", methName, " call, once the step has run.")
+        s.P("Out *", outType)
+        s.P("}")
+        s.P()
+        s.P("// Method returns ", strconv.Quote(fullServName+"."+c.method.GetName()), ".")
+        s.P("func (s *", stepName, ") Method() string { return ", strconv.Quote(fullServName+"."+c.method.GetName()), " }")
+        s.P()
+        s.P("// Run calls ", methName, " with the input returned by s.In, and keeps its output.")
+        s.P("func (s *", stepName, ") Run(ctx ", contextPkg, ".Context) error {")
+        s.P("out, err := s.Client.", methName, "(ctx, s.In())")
+        s.P("if err != nil {")
+        s.P("return err")
+        s.P("}")
+        s.P("s.Out = out")
+        s.P("return nil")
+        s.P("}")
+        s.P()
+        s.P("// Compensate calls ", compName, " with the input returned by s.Compensation.")
+        s.P("func (s *", stepName, ") Compensate(ctx ", contextPkg, ".Context) error {")
+        s.P("_, err := s.Client.", compName, "(ctx, s.Compensation(s.Out))")
+        s.P("return err")
+        s.P("}")
+        s.P()
+    }
+}
+
+// isStreaming reports whether method streams its input or output.
+func isStreaming(method *pb.MethodDescriptorProto) bool {
+    return method.GetClientStreaming() || method.GetServerStreaming()
+}
@@ -0,0 +1,93 @@
+// Package schemametrics outputs the registration of the schema of the
+// generated package for its OpenMetrics exposition.
+//
+// The first generated file of the package registers with the openmetrics
+// package, when it is initialized, the hash of the descriptor set the
+// package was generated from, the generator version and the number of
+// methods of each service of the package, which openmetrics.Handler
+// exposes as gauges.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package schemametrics
+
+import (
+    "strconv"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+    "github.com/lleveque/protoc-gen-go/internal/version"
+)
+
+const openmetricsPkgPath = "github.com/lleveque/protoc-gen-go/openmetrics"
+
+// openmetricsPkg is the name of the openmetrics package in the generated
+// code, which may vary from "openmetrics" if the name is used by other
+// packages.
+var openmetricsPkg string
+
+func init() {
+    generator.RegisterPlugin(new(schemametrics))
+}
+
+// schemametrics is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the registration of the schema of the
+// generated package.
+type schemametrics struct {
+    gen *generator.Generator
+}
+
+// Name returns the name of this plugin, "schemametrics".
+func (s *schemametrics) Name() string {
+    return "schemametrics"
+}
+
+// Init initializes the plugin.
+func (s *schemametrics) Init(gen *generator.Generator) {
+    s.gen = gen
+    openmetricsPkg = generator.RegisterUniquePackageName("openmetrics", nil)
+}
+
+// P forwards to s.gen.P.
+func (s *schemametrics) P(args ...interface{}) { s.gen.P(args...) }
+
+// Generate generates the registration of the schema in the first file to
+// generate.
+func (s *schemametrics) Generate(file *generator.FileDescriptor) {
+    if file.GetName() != s.gen.Request.FileToGenerate[0] {
+        return
+    }
+    s.P("func init() {")
+    s.P(openmetricsPkg, ".RegisterSchema(", openmetricsPkg, ".Schema{")
+    s.P("Package: ", strconv.Quote(file.GetPackage()), ",")
+    s.P("Hash: ", strconv.Quote(descutil.DescriptorSetHash(s.gen)), ",")
+    s.P("GeneratorVersion: ", strconv.Quote(version.Version), ",")
+    s.P("ServiceMethods: map[string]int{")
+    for _, name := range s.gen.Request.FileToGenerate {
+        for _, f := range s.gen.Request.ProtoFile {
+            if f.GetName() != name {
+                continue
+            }
+            for _, service := range f.Service {
+                fullName := service.GetName()
+                if pkg := f.GetPackage(); pkg != "" {
+                    fullName = pkg + "." + fullName
+                }
+                s.P(strconv.Quote(fullName), ": ", len(service.Method), ",")
+            }
+        }
+    }
+    s.P("},")
+    s.P("})")
+    s.P("}")
+    s.P()
+}
+
+// GenerateImports generates the import declaration for this file.
+func (s *schemametrics) GenerateImports(file *generator.FileDescriptor) {
+    if file.GetName() != s.gen.Request.FileToGenerate[0] {
+        return
+    }
+    s.P("import ", openmetricsPkg, " ", strconv.Quote(openmetricsPkgPath))
+    s.P()
+}
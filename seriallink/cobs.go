@@ -0,0 +1,117 @@
+// Package seriallink frames serialized messages for serial links, e.g. UART
+// or RS-232, which carry a stream of bytes where frames must be delimited
+// and the receiver must recover from the bytes corrupted or lost.
+//
+// It backs the COBS frame helpers generated by the cobs plugin, and the
+// packets of the serial link transport generated by the grpcserial plugin.
+package seriallink
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "io"
+)
+
+// ErrCorruptFrame is returned for the frames which are no valid COBS
+// encoding.
+var ErrCorruptFrame = errors.New("seriallink: corrupt COBS frame")
+
+// ErrFrameTooLarge is returned for the frames longer than the limit of
+// their FrameReader.
+var ErrFrameTooLarge = errors.New("seriallink: frame too large")
+
+// AppendCOBS appends to dst the frame of src encoded with Consistent
+// Overhead Byte Stuffing, which holds no zero byte, and the zero byte
+// delimiting it. The frame is at most len(src)/254+1 bytes longer than src.
+func AppendCOBS(dst, src []byte) []byte {
+    code := len(dst)
+    dst = append(dst, 0)
+    n := byte(1)
+    for _, b := range src {
+        if b != 0 {
+            dst = append(dst, b)
+            n++
+        }
+        if b == 0 || n == 0xff {
+            dst[code] = n
+            code = len(dst)
+            dst = append(dst, 0)
+            n = 1
+        }
+    }
+    dst[code] = n
+    return append(dst, 0)
+}
+
+// DecodeCOBS returns the data encoded in the COBS frame, given without its
+// delimiter, or ErrCorruptFrame if it is no valid encoding.
+func DecodeCOBS(frame []byte) ([]byte, error) {
+    if len(frame) == 0 {
+        return nil, ErrCorruptFrame
+    }
+    data := make([]byte, 0, len(frame))
+    for i := 0; i < len(frame); {
+        code := int(frame[i])
+        if code == 0 || i+code > len(frame) || bytes.IndexByte(frame[i+1:i+code], 0) >= 0 {
+            return nil, ErrCorruptFrame
+        }
+        data = append(data, frame[i+1:i+code]...)
+        i += code
+        if code < 0xff && i < len(frame) {
+            data = append(data, 0)
+        }
+    }
+    return data, nil
+}
+
+// FrameReader reads the COBS frames of a stream. It resynchronizes on the
+// delimiters: after a corrupt or too large frame, the next read returns the
+// frame following it. The empty frames, such as the delimiters sent to flush
+// the line before the first frame, are skipped.
+type FrameReader struct {
+    r       *bufio.Reader
+    maxSize int
+    buf     []byte
+}
+
+// NewFrameReader returns a FrameReader reading the frames of r, rejecting
+// those longer than maxSize bytes, delimiter excluded, with
+// ErrFrameTooLarge.
+func NewFrameReader(r io.Reader, maxSize int) *FrameReader {
+    return &FrameReader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+// ReadFrame returns the data of the next frame. It returns ErrCorruptFrame
+// or ErrFrameTooLarge for an invalid frame, after which ReadFrame can be
+// called again, io.EOF at the end of the stream, and io.ErrUnexpectedEOF if
+// the stream ends within a frame.
+func (f *FrameReader) ReadFrame() ([]byte, error) {
+    for {
+        f.buf = f.buf[:0]
+        tooLarge := false
+        for {
+            chunk, err := f.r.ReadSlice(0)
+            if !tooLarge {
+                f.buf = append(f.buf, chunk...)
+                tooLarge = len(f.buf) > f.maxSize+1
+            }
+            if err == bufio.ErrBufferFull {
+                continue
+            }
+            if err == io.EOF && (len(f.buf) > 0 || tooLarge) {
+                return nil, io.ErrUnexpectedEOF
+            }
+            if err != nil {
+                return nil, err
+            }
+            break
+        }
+        if tooLarge {
+            return nil, ErrFrameTooLarge
+        }
+        if len(f.buf) > 1 {
+            return DecodeCOBS(f.buf[:len(f.buf)-1])
+        }
+    }
+}
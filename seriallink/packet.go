@@ -0,0 +1,151 @@
+package seriallink
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "io"
+)
+
+// The statuses of the packets.
+const (
+    StatusOK    = 0 // a request, or a response holding the output of the call
+    StatusError = 1 // a response holding the error message of the call
+)
+
+// MaxPacketPayload is the size of the largest payload of a packet.
+const MaxPacketPayload = 0xffff
+
+// packetSync is the first byte of every packet, on which the receivers
+// resynchronize.
+const packetSync = 0xa5
+
+// packetHeader is the size of the header of a packet following its sync
+// byte: method ID, status, payload length and header check.
+const packetHeader = 6
+
+// ErrPayloadTooLarge is returned when writing a packet whose payload is
+// longer than MaxPacketPayload.
+var ErrPayloadTooLarge = errors.New("seriallink: packet payload too large")
+
+// Packet is a request or response of a call over a serial link. It is
+// written as the sync byte 0xa5, the method ID, the status and the length
+// of the payload, the low byte of the CRC16 of these, checking the header,
+// and the payload, followed by the CRC16 of the bytes from the method ID
+// to the end of the payload, the integers being big-endian, 2 bytes long
+// but the 1-byte status.
+type Packet struct {
+    Method  uint16 // ID of the method called
+    Status  byte   // StatusOK or StatusError
+    Payload []byte
+}
+
+// WritePacket writes p to w with a single Write.
+func WritePacket(w io.Writer, p Packet) error {
+    if len(p.Payload) > MaxPacketPayload {
+        return ErrPayloadTooLarge
+    }
+    b := make([]byte, 1+packetHeader, 1+packetHeader+len(p.Payload)+2)
+    b[0] = packetSync
+    binary.BigEndian.PutUint16(b[1:], p.Method)
+    b[3] = p.Status
+    binary.BigEndian.PutUint16(b[4:], uint16(len(p.Payload)))
+    b[6] = byte(CRC16(b[1:6]))
+    b = append(b, p.Payload...)
+    var crc [2]byte
+    binary.BigEndian.PutUint16(crc[:], CRC16(b[1:]))
+    _, err := w.Write(append(b, crc[:]...))
+    return err
+}
+
+// PacketReader reads the packets of a serial link. It skips the bytes not
+// starting a packet whose CRC16 matches, so that it resynchronizes on the
+// next packet after a corrupt or truncated one. As a corrupt length passing
+// the header check makes it wait for as many bytes before resynchronizing,
+// the payloads are limited, and the links should time out their reads.
+type PacketReader struct {
+    r          *bufio.Reader
+    maxPayload int
+}
+
+// NewPacketReader returns a PacketReader reading the packets of r whose
+// payload is at most maxPayload bytes long, up to MaxPacketPayload.
+func NewPacketReader(r io.Reader, maxPayload int) *PacketReader {
+    if maxPayload > MaxPacketPayload {
+        maxPayload = MaxPacketPayload
+    }
+    return &PacketReader{r: bufio.NewReaderSize(r, 1+packetHeader+maxPayload+2), maxPayload: maxPayload}
+}
+
+// ReadPacket returns the next valid packet, whose payload is only valid
+// until the next call. It returns io.EOF at the end of the stream, and
+// io.ErrUnexpectedEOF if the stream ends within a packet.
+func (p *PacketReader) ReadPacket() (Packet, error) {
+    for {
+        b, err := p.r.ReadByte()
+        if err != nil {
+            return Packet{}, err
+        }
+        if b != packetSync {
+            continue
+        }
+        header, err := p.r.Peek(packetHeader)
+        if err != nil {
+            return Packet{}, unexpectedEOF(err)
+        }
+        length := int(binary.BigEndian.Uint16(header[3:]))
+        if header[5] != byte(CRC16(header[:5])) || length > p.maxPayload {
+            continue
+        }
+        size := packetHeader + length + 2
+        data, err := p.r.Peek(size)
+        if err != nil {
+            return Packet{}, unexpectedEOF(err)
+        }
+        if CRC16(data[:size-2]) != binary.BigEndian.Uint16(data[size-2:]) {
+            continue
+        }
+        p.r.Discard(size)
+        return Packet{
+            Method:  binary.BigEndian.Uint16(data),
+            Status:  data[2],
+            Payload: data[packetHeader : size-2],
+        }, nil
+    }
+}
+
+// unexpectedEOF returns err, io.ErrUnexpectedEOF if it is io.EOF.
+func unexpectedEOF(err error) error {
+    if err == io.EOF {
+        return io.ErrUnexpectedEOF
+    }
+    return err
+}
+
+// crc16Table is the lookup table of CRC16.
+var crc16Table [256]uint16
+
+func init() {
+    for i := range crc16Table {
+        crc := uint16(i) << 8
+        for j := 0; j < 8; j++ {
+            if crc&0x8000 != 0 {
+                crc = crc<<1 ^ 0x1021
+            } else {
+                crc <<= 1
+            }
+        }
+        crc16Table[i] = crc
+    }
+}
+
+// CRC16 returns the CRC-16/CCITT-FALSE checksum of data: polynomial 0x1021,
+// initial value 0xffff, no reflection nor final XOR, as computed by the
+// peers of the links.
+func CRC16(data []byte) uint16 {
+    crc := uint16(0xffff)
+    for _, b := range data {
+        crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+    }
+    return crc
+}
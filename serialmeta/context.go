@@ -0,0 +1,75 @@
+package serialmeta
+
+import (
+    "context"
+    "errors"
+    "sync"
+)
+
+// ErrNoEnvelope is returned by SetOutput for the calls whose input has no
+// envelope: their caller does not expect one around their outputs.
+var ErrNoEnvelope = errors.New("serialmeta: input without envelope")
+
+// contextKey is the key of the metadata of a call in its context.
+type contextKey struct{}
+
+// callMD is the metadata of a call: the metadata of its input, and the
+// metadata of its outputs set since the last one.
+type callMD struct {
+    input MD
+
+    mu     sync.Mutex
+    output MD
+}
+
+// NewContext returns ctx carrying md, the metadata of the input of a call,
+// as unwrapped by Unwrap, and the metadata of its outputs, set with
+// SetOutput. md is nil for the inputs without envelope, in which case ctx
+// is returned as is.
+func NewContext(ctx context.Context, md MD) context.Context {
+    if md == nil {
+        return ctx
+    }
+    return context.WithValue(ctx, contextKey{}, &callMD{input: md})
+}
+
+// FromContext returns the metadata of the input of the call of ctx, or nil.
+func FromContext(ctx context.Context) MD {
+    if c, ok := ctx.Value(contextKey{}).(*callMD); ok {
+        return c.input
+    }
+    return nil
+}
+
+// SetOutput sets the value of key in the metadata of the next output of
+// the call of ctx, the output of a unary method or the next one emitted by
+// a server-streaming method. It returns ErrNoEnvelope if the input of the
+// call has no envelope.
+func SetOutput(ctx context.Context, key, value string) error {
+    c, ok := ctx.Value(contextKey{}).(*callMD)
+    if !ok {
+        return ErrNoEnvelope
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.output == nil {
+        c.output = make(MD)
+    }
+    c.output.Set(key, value)
+    return nil
+}
+
+// WrapOutput returns output in an envelope with the metadata set with
+// SetOutput since the last output of the call of ctx, or output itself if
+// there is none.
+func WrapOutput(ctx context.Context, output []byte) []byte {
+    c, ok := ctx.Value(contextKey{}).(*callMD)
+    if !ok {
+        return output
+    }
+    c.mu.Lock()
+    md := c.output
+    c.output = nil
+    c.mu.Unlock()
+    return Wrap(md, output)
+}
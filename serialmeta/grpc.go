@@ -0,0 +1,30 @@
+package serialmeta
+
+import "strings"
+
+// FromGRPC returns the metadata of the gRPC metadata md, e.g. the
+// metadata.MD of an incoming call, which converts to a map[string][]string,
+// for the call of a serialized function made to serve it. The pseudo-headers,
+// such as ":authority", are dropped, and the values of a key are joined with
+// commas, as HTTP joins the values of a header.
+func FromGRPC(md map[string][]string) MD {
+    out := make(MD, len(md))
+    for key, values := range md {
+        if strings.HasPrefix(key, ":") || len(values) == 0 {
+            continue
+        }
+        out.Set(key, strings.Join(values, ","))
+    }
+    return out
+}
+
+// ToGRPC returns md as gRPC metadata, e.g. the metadata of the output of a
+// serialized function, to be passed as the metadata.MD of grpc.SetHeader or
+// metadata.NewOutgoingContext.
+func ToGRPC(md MD) map[string][]string {
+    out := make(map[string][]string, len(md))
+    for key, value := range md {
+        out[key] = []string{value}
+    }
+    return out
+}
@@ -0,0 +1,166 @@
+// Package serialmeta carries string key/value metadata, such as the W3C
+// trace context, across the serial boundary of the serialized API, in an
+// envelope around the serialized messages.
+//
+// An enveloped message starts with a zero byte, which no serialized
+// protobuf message starts with, 0 not being a valid field number, followed
+// by the varint size of the metadata, the metadata, serialized as the
+// protobuf message { map<string, string> entries = 1; }, and the message.
+// The messages not starting with a zero byte have no metadata, so that the
+// callers unaware of the envelope are still served.
+//
+// The outputs of the calls are enveloped the same way, with the metadata
+// set by the implementations with SetOutput, such as the headers of gRPC,
+// but only for the calls whose input is enveloped, whose callers expect it.
+package serialmeta
+
+import (
+    "encoding/binary"
+    "errors"
+    "sort"
+    "strings"
+)
+
+// ErrCorruptEnvelope is returned by Unwrap for a truncated or malformed
+// envelope.
+var ErrCorruptEnvelope = errors.New("serialmeta: corrupt envelope")
+
+// The keys of the metadata identifying the caller of a method with an
+// (auth.scopes) option, as set by the host of the serialized API: its
+// principal, and the scopes granted to it, separated by spaces as in the
+// scope claims of OAuth 2.0.
+const (
+    PrincipalKey = "principal"
+    ScopesKey    = "scopes"
+)
+
+// MD is the metadata of a message, by lower-case key. It implements the
+// TextMapCarrier interface of the OpenTelemetry propagators.
+type MD map[string]string
+
+// Get returns the value of key, or "".
+func (md MD) Get(key string) string {
+    return md[strings.ToLower(key)]
+}
+
+// Set sets the value of key.
+func (md MD) Set(key, value string) {
+    md[strings.ToLower(key)] = value
+}
+
+// Keys returns the keys of md, sorted.
+func (md MD) Keys() []string {
+    keys := make([]string, 0, len(md))
+    for key := range md {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// Wrap returns message in an envelope with md, or message itself if md is
+// empty.
+func Wrap(md MD, message []byte) []byte {
+    if len(md) == 0 {
+        return message
+    }
+    var meta []byte
+    for _, key := range md.Keys() {
+        var entry []byte
+        entry = appendField(entry, 1, key)
+        entry = appendField(entry, 2, md[key])
+        meta = appendField(meta, 1, string(entry))
+    }
+    data := make([]byte, 0, 1+binary.MaxVarintLen64+len(meta)+len(message))
+    data = append(data, 0)
+    data = appendUvarint(data, uint64(len(meta)))
+    data = append(data, meta...)
+    return append(data, message...)
+}
+
+// appendField appends the length-delimited field number n of value to b.
+func appendField(b []byte, n int, value string) []byte {
+    b = appendUvarint(b, uint64(n)<<3|2)
+    b = appendUvarint(b, uint64(len(value)))
+    return append(b, value...)
+}
+
+// appendUvarint appends the varint encoding of v to b.
+func appendUvarint(b []byte, v uint64) []byte {
+    var buf [binary.MaxVarintLen64]byte
+    return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// Unwrap returns the metadata and the message of data, or nil metadata and
+// data itself if data is not enveloped.
+func Unwrap(data []byte) (MD, []byte, error) {
+    if len(data) == 0 || data[0] != 0 {
+        return nil, data, nil
+    }
+    size, n := binary.Uvarint(data[1:])
+    if n <= 0 || size > uint64(len(data)-1-n) {
+        return nil, nil, ErrCorruptEnvelope
+    }
+    meta, message := data[1+n:1+n+int(size)], data[1+n+int(size):]
+    md := make(MD)
+    for len(meta) > 0 {
+        num, entry, rest, err := nextField(meta)
+        if err != nil {
+            return nil, nil, err
+        }
+        meta = rest
+        if num != 1 || entry == nil {
+            continue
+        }
+        var key, value string
+        for len(entry) > 0 {
+            num, v, rest, err := nextField(entry)
+            if err != nil {
+                return nil, nil, err
+            }
+            entry = rest
+            switch {
+            case num == 1 && v != nil:
+                key = string(v)
+            case num == 2 && v != nil:
+                value = string(v)
+            }
+        }
+        md.Set(key, value)
+    }
+    return md, message, nil
+}
+
+// nextField parses the first field of the serialized message b, returning
+// its number, its value if it is length-delimited, and the rest of b. The
+// fields of other wire types are skipped.
+func nextField(b []byte) (num uint64, value, rest []byte, err error) {
+    tag, n := binary.Uvarint(b)
+    if n <= 0 {
+        return 0, nil, nil, ErrCorruptEnvelope
+    }
+    b = b[n:]
+    switch tag & 7 {
+    case 0:
+        if _, n = binary.Uvarint(b); n <= 0 {
+            return 0, nil, nil, ErrCorruptEnvelope
+        }
+        return tag >> 3, nil, b[n:], nil
+    case 1, 5:
+        size := 8
+        if tag&7 == 5 {
+            size = 4
+        }
+        if len(b) < size {
+            return 0, nil, nil, ErrCorruptEnvelope
+        }
+        return tag >> 3, nil, b[size:], nil
+    case 2:
+        size, n := binary.Uvarint(b)
+        if n <= 0 || size > uint64(len(b)-n) {
+            return 0, nil, nil, ErrCorruptEnvelope
+        }
+        return tag >> 3, b[n : n+int(size) : n+int(size)], b[n+int(size):], nil
+    }
+    return 0, nil, nil, ErrCorruptEnvelope
+}
@@ -0,0 +1,104 @@
+// Package snapshot outputs helpers decoding messages from memory-mapped files.
+//
+// For every message Foo it generates a FooSnapshot type, opened with
+// OpenFooSnapshot, a FooView of the view plugin over the mapping of the file
+// it was read from: its getters decode the fields on demand from the
+// mapping, without copying the file onto the heap. Closing the snapshot
+// releases the mapping, after which the values aliasing it are invalid.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package snapshot
+
+import (
+    "fmt"
+
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const mmapPkgPath = "github.com/lleveque/protoc-gen-go/mmap"
+
+func init() {
+    generator.RegisterPlugin(new(snapshot))
+}
+
+// snapshot is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates memory-mapped snapshot helpers for
+// the messages of each file.
+type snapshot struct {
+    gen  *generator.Generator
+    view bool // the view plugin, generating the views of the snapshots, is enabled
+}
+
+// Name returns the name of this plugin, "snapshot".
+func (s *snapshot) Name() string {
+    return "snapshot"
+}
+
+// Init initializes the plugin.
+func (s *snapshot) Init(gen *generator.Generator) {
+    s.gen = gen
+    s.view = descutil.PluginEnabled(gen, "view")
+}
+
+// P forwards to s.gen.P.
+func (s *snapshot) P(args ...interface{}) { s.gen.P(args...) }
+
+// Generate generates the snapshot helpers for the messages in the given file.
+func (s *snapshot) Generate(file *generator.FileDescriptor) {
+    if len(file.MessageType) > 0 && !s.view {
+        s.gen.Fail("the snapshot plugin needs the view plugin, whose views read the snapshots")
+    }
+    for _, msg := range descutil.Messages(s.gen, file) {
+        s.generateSnapshot(s.gen.TypeName(msg))
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (s *snapshot) GenerateImports(file *generator.FileDescriptor) {
+    if len(file.MessageType) == 0 {
+        return
+    }
+    s.P("import mmap ", fmt.Sprintf("%q", mmapPkgPath))
+}
+
+// generateSnapshot generates the snapshot type of the message typeName and
+// its constructor.
+func (s *snapshot) generateSnapshot(typeName string) {
+    snapName := typeName + "Snapshot"
+    viewName := typeName + "View"
+
+    s.P("// ", snapName, " is a ", viewName, " of a ", typeName, " in a memory-mapped file: its")
+    s.P("// getters decode the fields on demand from the mapping, without copying it.")
+    s.P("// The values they return aliasing the mapping, the bytes fields and the")
+    s.P("// views of the message fields, and Bytes, are only valid until Close")
+    s.P("// releases the mapping: copy them, or Unmarshal the ", typeName, ", to keep them.")
+    s.P("type ", snapName, " struct {")
+    s.P(viewName)
+    s.P("mapping *mmap.Mapping")
+    s.P("}")
+    s.P()
+    s.P("// Open", snapName, " maps the file at path as a ", typeName, ", whose top level it")
+    s.P("// checks without decoding it.")
+    s.P("func Open", snapName, "(path string) (*", snapName, ", error) {")
+    s.P("m, err := mmap.Open(path)")
+    s.P("if err != nil {")
+    s.P("return nil, err")
+    s.P("}")
+    s.P("v := New", viewName, "(m.Bytes())")
+    s.P("if err := v.Err(); err != nil {")
+    s.P("m.Close()")
+    s.P("return nil, err")
+    s.P("}")
+    s.P("return &", snapName, "{", viewName, ": v, mapping: m}, nil")
+    s.P("}")
+    s.P()
+    s.P("// Close releases the mapping of the snapshot file. The snapshot reads as an")
+    s.P("// empty ", typeName, " afterwards, and the values aliasing the mapping are invalid.")
+    s.P("func (s *", snapName, ") Close() error {")
+    s.P("s.", viewName, " = ", viewName, "{}")
+    s.P("return s.mapping.Close()")
+    s.P("}")
+    s.P()
+}
@@ -0,0 +1,121 @@
+// Package sortedmaps outputs helpers iterating over the map fields in the
+// order of their keys.
+//
+// For every map field foo of a message it generates a
+// RangeSortedFoo(f func(k K, v V)) method calling f with the entries of the
+// map in the increasing order of their keys, false before true for bool
+// keys, so that the output built from them, e.g. hashed, is reproducible,
+// where ranging over a Go map is not. No helper is generated whose name
+// would be taken by a field.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package sortedmaps
+
+import (
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const sortPkgPath = "sort"
+
+// sortPkg is the name of the sort package in the generated code, which
+// may vary from "sort" if the name is used by other packages.
+var sortPkg string
+
+func init() {
+    generator.RegisterPlugin(new(sortedmaps))
+}
+
+// sortedmaps is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the sorted iteration helpers of the map
+// fields.
+type sortedmaps struct {
+    gen *generator.Generator
+
+    usesSort bool // the file being generated uses the sort package
+}
+
+// Name returns the name of this plugin, "sortedmaps".
+func (s *sortedmaps) Name() string {
+    return "sortedmaps"
+}
+
+// Init initializes the plugin.
+func (s *sortedmaps) Init(gen *generator.Generator) {
+    s.gen = gen
+    sortPkg = generator.RegisterUniquePackageName("sort", nil)
+}
+
+// P forwards to s.gen.P.
+func (s *sortedmaps) P(args ...interface{}) { s.gen.P(args...) }
+
+// Generate generates the sorted iteration helpers of the messages in the
+// given file.
+func (s *sortedmaps) Generate(file *generator.FileDescriptor) {
+    s.usesSort = false
+    if !descutil.IsGenerated(s.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(s.gen, file) {
+        s.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (s *sortedmaps) GenerateImports(file *generator.FileDescriptor) {
+    if !s.usesSort {
+        return
+    }
+    s.P("import ", sortPkg, " ", strconv.Quote(sortPkgPath))
+    s.P()
+}
+
+// generateMessage generates the sorted iteration helpers of the map fields
+// of msg.
+func (s *sortedmaps) generateMessage(msg *generator.Descriptor) {
+    typeName := s.gen.TypeName(msg)
+    names := make(map[string]bool)
+    for _, field := range msg.Field {
+        names[generator.CamelCase(field.GetName())] = true
+    }
+    for _, oneof := range msg.OneofDecl {
+        names[generator.CamelCase(oneof.GetName())] = true
+    }
+    for _, field := range msg.Field {
+        entry := descutil.MapEntry(s.gen, field)
+        if entry == nil {
+            continue
+        }
+        fieldName := generator.CamelCase(field.GetName())
+        method := "RangeSorted" + fieldName
+        if names[method] {
+            continue
+        }
+        keyType, _ := s.gen.GoType(entry, entry.Field[0])
+        valueType, _ := s.gen.GoType(entry, entry.Field[1])
+        less := "keys[i] < keys[j]"
+        if entry.Field[0].GetType() == pb.FieldDescriptorProto_TYPE_BOOL {
+            less = "!keys[i] && keys[j]"
+        }
+
+        s.usesSort = true
+        s.P("// ", method, " calls f with the entries of the ", field.GetName(), " field of m, in the")
+        s.P("// increasing order of their keys.")
+        s.P("func (m *", typeName, ") ", method, "(f func(k ", keyType, ", v ", valueType, ")) {")
+        s.P("entries := m.Get", fieldName, "()")
+        s.P("keys := make([]", keyType, ", 0, len(entries))")
+        s.P("for k := range entries {")
+        s.P("keys = append(keys, k)")
+        s.P("}")
+        s.P(sortPkg, ".Slice(keys, func(i, j int) bool { return ", less, " })")
+        s.P("for _, k := range keys {")
+        s.P("f(k, entries[k])")
+        s.P("}")
+        s.P("}")
+        s.P()
+    }
+}
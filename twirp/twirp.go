@@ -0,0 +1,292 @@
+// Package twirp outputs Twirp servers and clients of the services.
+//
+// For every service Foo it generates a Foo interface, NewFooServer serving
+// an implementation of it over HTTP 1.1 with the Twirp protocol, and the
+// NewFooProtobufClient and NewFooJSONClient clients calling such a server,
+// so that the services can be deployed where gRPC cannot.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package twirp
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// Paths for packages used by code generated in this file.
+const (
+    contextPkgPath = "context"
+    httpPkgPath    = "net/http"
+    httprpcPkgPath = "github.com/lleveque/protoc-gen-go/httprpc"
+)
+
+func init() {
+    generator.RegisterPlugin(new(twirp))
+}
+
+// twirp is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates Twirp servers and clients.
+type twirp struct {
+    gen *generator.Generator
+}
+
+// The names for packages imported in the generated code.
+// They may vary from the final path component of the import path
+// if the name is used by other packages.
+var (
+    contextPkg string
+    httpPkg    string
+    httprpcPkg string
+)
+
+// Name returns the name of this plugin, "twirp".
+func (t *twirp) Name() string {
+    return "twirp"
+}
+
+// Init initializes the plugin.
+func (t *twirp) Init(gen *generator.Generator) {
+    t.gen = gen
+    contextPkg = generator.RegisterUniquePackageName("context", nil)
+    httpPkg = generator.RegisterUniquePackageName("http", nil)
+    httprpcPkg = generator.RegisterUniquePackageName("httprpc", nil)
+}
+
+// typeName returns the name of the type named str in the .proto, as we
+// will print it, and records that we use it.
+func (t *twirp) typeName(str string) string {
+    t.gen.RecordTypeUse(str)
+    return t.gen.TypeName(t.gen.ObjectNamed(str))
+}
+
+// P forwards to t.gen.P.
+func (t *twirp) P(args ...interface{}) { t.gen.P(args...) }
+
+// Generate generates the Twirp servers and clients of the services in the
+// given file.
+func (t *twirp) Generate(file *generator.FileDescriptor) {
+    if len(file.FileDescriptorProto.Service) == 0 {
+        return
+    }
+
+    t.P("// Reference imports to suppress errors if they are not otherwise used.")
+    t.P("var _ ", contextPkg, ".Context")
+    t.P("var _ ", httpPkg, ".Handler")
+    t.P("var _ ", httprpcPkg, ".TwirpServer")
+    t.P()
+
+    for i, service := range file.FileDescriptorProto.Service {
+        t.generateService(file, service, i)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (t *twirp) GenerateImports(file *generator.FileDescriptor) {
+    if len(file.FileDescriptorProto.Service) == 0 {
+        return
+    }
+    t.P("import (")
+    t.P(contextPkg, " ", strconv.Quote(contextPkgPath))
+    t.P(httpPkg, " ", strconv.Quote(httpPkgPath))
+    t.P(httprpcPkg, " ", strconv.Quote(httprpcPkgPath))
+    t.P(")")
+    t.P()
+}
+
+// generateService generates the interface, server and clients of service.
+func (t *twirp) generateService(file *generator.FileDescriptor, service *pb.ServiceDescriptorProto, index int) {
+    path := fmt.Sprintf("6,%d", index) // 6 means service.
+
+    fullServName := service.GetName()
+    if pkg := file.GetPackage(); pkg != "" {
+        fullServName = pkg + "." + fullServName
+    }
+    servName := generator.CamelCase(service.GetName())
+    prefixName := servName + "PathPrefix"
+
+    t.P("// ", prefixName, " is the prefix of the paths of the ", servName, " methods,")
+    t.P("// under which the server returned by New", servName, "Server must be mounted.")
+    t.P("const ", prefixName, " = ", strconv.Quote("/twirp/"+fullServName+"/"))
+    t.P()
+
+    t.gen.PrintComments(path)
+    t.P("type ", servName, " interface {")
+    for i, method := range service.Method {
+        t.gen.PrintComments(fmt.Sprintf("%s,2,%d", path, i)) // 2 means method in a service.
+        t.P(t.methodSignature(method))
+    }
+    t.P("}")
+    t.P()
+
+    t.generateServer(service, servName, prefixName)
+    t.generateClient(service, servName, prefixName)
+}
+
+// methodSignature returns the signature of method in the service interface.
+func (t *twirp) methodSignature(method *pb.MethodDescriptorProto) string {
+    return fmt.Sprintf("%s(ctx %s.Context, in *%s) (*%s, error)", generator.CamelCase(method.GetName()),
+        contextPkg, t.typeName(method.GetInputType()), t.typeName(method.GetOutputType()))
+}
+
+// generateServer generates the Twirp server of service.
+func (t *twirp) generateServer(service *pb.ServiceDescriptorProto, servName, prefixName string) {
+    serverType := unexport(servName) + "TwirpServer"
+
+    t.P("type ", serverType, " struct {")
+    t.P("impl ", servName)
+    t.P("}")
+    t.P()
+    t.P("// New", servName, "Server returns a Twirp server of impl, accepting requests")
+    t.P("// encoded as protobuf or as JSON.")
+    if hasQuotaCosts(t.gen, service) {
+        t.P("// The methods with a (quota.cost) option charge their cost to the")
+        t.P("// httprpc.QuotaManager of the requests, as set by httprpc.QuotaHandler,")
+        t.P("// before they run.")
+    }
+    if hasRateLimits(t.gen, service) {
+        t.P("// The methods with a (ratelimit.rate) option are limited by the")
+        t.P("// httprpc.RateLimiter of the requests, as set by httprpc.RateLimiterHandler,")
+        t.P("// or else by in-process token buckets, before the requests are read.")
+    }
+    if hasScopes(t.gen, service) {
+        t.P("// The methods with an (auth.scopes) option refuse the requests whose")
+        t.P("// context, as set by httprpc.WithScopes, lacks the scopes, before they are")
+        t.P("// read.")
+    }
+    t.P("func New", servName, "Server(impl ", servName, ") ", httprpcPkg, ".TwirpServer {")
+    t.P("return &", serverType, "{impl}")
+    t.P("}")
+    t.P()
+    t.P("// PathPrefix returns ", prefixName, ".")
+    t.P("func (s *", serverType, ") PathPrefix() string { return ", prefixName, " }")
+    t.P()
+    t.P("func (s *", serverType, ") ServeHTTP(w ", httpPkg, ".ResponseWriter, r *", httpPkg, ".Request) {")
+    t.P("switch r.URL.Path {")
+    for _, method := range service.Method {
+        methName := generator.CamelCase(method.GetName())
+        t.P("case ", prefixName, " + ", strconv.Quote(method.GetName()), ":")
+        t.P("s.serve", methName, "(w, r)")
+    }
+    t.P("default:")
+    t.P(httprpcPkg, ".WriteTwirpError(w, ", httprpcPkg, `.Errorf(`, httprpcPkg, `.BadRoute, "no handler for path %q", r.URL.Path))`)
+    t.P("}")
+    t.P("}")
+    t.P()
+    for _, method := range service.Method {
+        methName := generator.CamelCase(method.GetName())
+        outType := t.typeName(method.GetOutputType())
+        t.P("func (s *", serverType, ") serve", methName, "(w ", httpPkg, ".ResponseWriter, r *", httpPkg, ".Request) {")
+        if limit, ok := descutil.RateLimit(t.gen, method); ok {
+            t.P("if err := ", httprpcPkg, ".CheckRateLimit(r.Context(), ", prefixName, " + ", strconv.Quote(method.GetName()), ", ", descutil.RateLimitLiteral(limit, httprpcPkg), "); err != nil {")
+            t.P(httprpcPkg, ".WriteTwirpError(w, err)")
+            t.P("return")
+            t.P("}")
+        }
+        if scopes := descutil.Scopes(t.gen, method); len(scopes) > 0 {
+            t.P("if err := ", httprpcPkg, ".CheckScopes(r.Context(), ", prefixName, " + ", strconv.Quote(method.GetName()), ", ", descutil.QuotedScopes(scopes), "); err != nil {")
+            t.P(httprpcPkg, ".WriteTwirpError(w, err)")
+            t.P("return")
+            t.P("}")
+        }
+        t.P("in := new(", t.typeName(method.GetInputType()), ")")
+        t.P("isJSON, err := ", httprpcPkg, ".ReadTwirpRequest(r, in)")
+        t.P("if err != nil {")
+        t.P(httprpcPkg, ".WriteTwirpError(w, err)")
+        t.P("return")
+        t.P("}")
+        if cost, ok := descutil.QuotaCost(t.gen, method); ok {
+            t.P("if err := ", httprpcPkg, ".ChargeQuota(r.Context(), ", strconv.FormatInt(cost, 10), "); err != nil {")
+            t.P(httprpcPkg, ".WriteTwirpError(w, err)")
+            t.P("return")
+            t.P("}")
+        }
+        t.P("out, err := s.impl.", methName, "(r.Context(), in)")
+        t.P("if err == nil && out == nil {")
+        t.P("err = ", httprpcPkg, ".Errorf(", httprpcPkg, `.Internal, "nil *`, outType, " returned by ", methName, `")`)
+        t.P("}")
+        t.P("if err != nil {")
+        t.P(httprpcPkg, ".WriteTwirpError(w, err)")
+        t.P("return")
+        t.P("}")
+        t.P(httprpcPkg, ".WriteTwirpResponse(w, out, isJSON)")
+        t.P("}")
+        t.P()
+    }
+}
+
+// generateClient generates the Twirp clients of service.
+func (t *twirp) generateClient(service *pb.ServiceDescriptorProto, servName, prefixName string) {
+    clientType := unexport(servName) + "TwirpClient"
+
+    t.P("type ", clientType, " struct {")
+    t.P("client ", httprpcPkg, ".HTTPClient")
+    t.P("baseURL string")
+    t.P("isJSON bool")
+    t.P("}")
+    t.P()
+    t.P("var _ ", servName, " = (*", clientType, ")(nil)")
+    t.P()
+    t.P("// New", servName, "ProtobufClient returns a client of the Twirp server at")
+    t.P("// baseURL, e.g. \"http://localhost:8080\", sending protobuf requests.")
+    t.P("func New", servName, "ProtobufClient(baseURL string, client ", httprpcPkg, ".HTTPClient) ", servName, " {")
+    t.P("return &", clientType, "{client, baseURL, false}")
+    t.P("}")
+    t.P()
+    t.P("// New", servName, "JSONClient returns a client of the Twirp server at")
+    t.P("// baseURL, e.g. \"http://localhost:8080\", sending JSON requests.")
+    t.P("func New", servName, "JSONClient(baseURL string, client ", httprpcPkg, ".HTTPClient) ", servName, " {")
+    t.P("return &", clientType, "{client, baseURL, true}")
+    t.P("}")
+    t.P()
+    for _, method := range service.Method {
+        t.P("func (c *", clientType, ") ", t.methodSignature(method), " {")
+        t.P("out := new(", t.typeName(method.GetOutputType()), ")")
+        t.P("err := ", httprpcPkg, ".CallTwirp(ctx, c.client, c.baseURL, ", prefixName, " + ", strconv.Quote(method.GetName()), ", in, out, c.isJSON)")
+        t.P("if err != nil {")
+        t.P("return nil, err")
+        t.P("}")
+        t.P("return out, nil")
+        t.P("}")
+        t.P()
+    }
+}
+
+// hasQuotaCosts reports whether a method of service has a quota cost.
+func hasQuotaCosts(gen *generator.Generator, service *pb.ServiceDescriptorProto) bool {
+    for _, method := range service.Method {
+        if _, ok := descutil.QuotaCost(gen, method); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// hasRateLimits reports whether a method of service has a rate limit.
+func hasRateLimits(gen *generator.Generator, service *pb.ServiceDescriptorProto) bool {
+    for _, method := range service.Method {
+        if _, ok := descutil.RateLimit(gen, method); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// hasScopes reports whether a method of service has an (auth.scopes)
+// option.
+func hasScopes(gen *generator.Generator, service *pb.ServiceDescriptorProto) bool {
+    for _, method := range service.Method {
+        if len(descutil.Scopes(gen, method)) > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// unexport returns s with its first letter in lower case.
+func unexport(s string) string { return strings.ToLower(s[:1]) + s[1:] }
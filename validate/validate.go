@@ -0,0 +1,823 @@
+// Package validate outputs Validate methods checking the field constraints
+// of the messages.
+//
+// The constraints are given by field options in the manner of
+// protoc-gen-validate, (validate.rules), or protovalidate,
+// (buf.validate.field), which share their rules, e.g.
+//
+//    string name = 1 [(validate.rules).string = {min_len: 1, max_len: 64}];
+//
+// For every message Foo it generates a Validate() error method returning
+// an error describing the first constraint violated by a Foo, its message
+// fields being validated in turn. The rules not supported fail the
+// generation rather than being ignored. With the validate_all parameter,
+// a ValidateAll() error method returns the ValidationErrors of all the
+// constraints violated instead.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package validate
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/golang/protobuf/proto"
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+    "github.com/lleveque/protoc-gen-go/wire"
+)
+
+// Field numbers of the field options holding the rules, as registered for
+// protoc-gen-validate and protovalidate, and of the rules in their FieldRules.
+const (
+    pgvRulesOption = 1071 // (validate.rules)
+    bufFieldOption = 1159 // (buf.validate.field)
+
+    messageRules  = 17
+    repeatedRules = 18
+    mapRules      = 19
+    requiredRule  = 25 // protovalidate only
+)
+
+// typeRules maps the field types to the number of their rules in FieldRules.
+var typeRules = map[pb.FieldDescriptorProto_Type]int32{
+    pb.FieldDescriptorProto_TYPE_FLOAT:    1,
+    pb.FieldDescriptorProto_TYPE_DOUBLE:   2,
+    pb.FieldDescriptorProto_TYPE_INT32:    3,
+    pb.FieldDescriptorProto_TYPE_INT64:    4,
+    pb.FieldDescriptorProto_TYPE_UINT32:   5,
+    pb.FieldDescriptorProto_TYPE_UINT64:   6,
+    pb.FieldDescriptorProto_TYPE_SINT32:   7,
+    pb.FieldDescriptorProto_TYPE_SINT64:   8,
+    pb.FieldDescriptorProto_TYPE_FIXED32:  9,
+    pb.FieldDescriptorProto_TYPE_FIXED64:  10,
+    pb.FieldDescriptorProto_TYPE_SFIXED32: 11,
+    pb.FieldDescriptorProto_TYPE_SFIXED64: 12,
+    pb.FieldDescriptorProto_TYPE_BOOL:     13,
+    pb.FieldDescriptorProto_TYPE_STRING:   14,
+    pb.FieldDescriptorProto_TYPE_BYTES:    15,
+    pb.FieldDescriptorProto_TYPE_ENUM:     16,
+    pb.FieldDescriptorProto_TYPE_MESSAGE:  messageRules,
+}
+
+// uuidPattern is the pattern of the values of the string fields with the
+// uuid rule.
+const uuidPattern = "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"
+
+// importPaths are the packages the checks may use.
+var importPaths = []string{"bytes", "net", "net/mail", "net/url", "regexp", "strings", "unicode/utf8"}
+
+func init() {
+    generator.RegisterPlugin(new(validate))
+}
+
+// validate is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates the Validate methods of the messages.
+type validate struct {
+    gen *generator.Generator
+
+    pkgNames map[string]string // names of the packages of importPaths
+
+    all bool // the validate_all parameter is enabled: generate ValidateAll methods
+
+    used     map[string]bool // packages of importPaths used by the file being generated
+    patterns [][2]string     // regexp variables of the file being generated, and their pattern
+}
+
+// target is a value checked by rules: a field, an element of a repeated
+// field, or a key or value of a map field.
+type target struct {
+    field *pb.FieldDescriptorProto // field, or map entry field, of the value
+    value string                   // Go expression of the value
+    name  string                   // Go expression of the name of the value in errors
+    ident string                   // prefix of the variables generated for the value
+}
+
+// Name returns the name of this plugin, "validate".
+func (v *validate) Name() string {
+    return "validate"
+}
+
+// Init initializes the plugin.
+func (v *validate) Init(gen *generator.Generator) {
+    v.gen = gen
+    v.all = descutil.BoolParam(gen, "validate_all")
+    v.pkgNames = make(map[string]string)
+    for _, path := range importPaths {
+        v.pkgNames[path] = generator.RegisterUniquePackageName(path[strings.LastIndex(path, "/")+1:], nil)
+    }
+}
+
+// P forwards to v.gen.P.
+func (v *validate) P(args ...interface{}) { v.gen.P(args...) }
+
+// pkg returns the name of the package of importPath, imported by the file
+// being generated.
+func (v *validate) pkg(importPath string) string {
+    v.used[importPath] = true
+    return v.pkgNames[importPath]
+}
+
+// Generate generates the Validate methods of the messages in the given file.
+func (v *validate) Generate(file *generator.FileDescriptor) {
+    v.used = make(map[string]bool)
+    v.patterns = nil
+    if !descutil.IsGenerated(v.gen, file.GetName()) {
+        return
+    }
+    if v.all && file.GetName() == v.gen.Request.FileToGenerate[0] {
+        v.generateValidationErrors()
+    }
+    for _, msg := range descutil.Messages(v.gen, file) {
+        v.generateMessage(msg)
+    }
+    if len(v.patterns) > 0 {
+        v.P("var (")
+        for _, p := range v.patterns {
+            v.P(p[0], " = ", v.pkg("regexp"), ".MustCompile(", strconv.Quote(p[1]), ")")
+        }
+        v.P(")")
+        v.P()
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (v *validate) GenerateImports(file *generator.FileDescriptor) {
+    var paths []string
+    for path := range v.used {
+        paths = append(paths, path)
+    }
+    if len(paths) == 0 {
+        return
+    }
+    sort.Strings(paths)
+    v.P("import (")
+    for _, path := range paths {
+        v.P(v.pkgNames[path], " ", strconv.Quote(path))
+    }
+    v.P(")")
+    v.P()
+}
+
+// generateValidationErrors generates, once per package, the error type
+// returned by the ValidateAll methods and the validation of message fields
+// in both modes.
+func (v *validate) generateValidationErrors() {
+    v.P("// ValidationErrors are the constraint violations of a message, as returned")
+    v.P("// by its ValidateAll method.")
+    v.P("type ValidationErrors []error")
+    v.P()
+    v.P("// Error returns the descriptions of the violations, separated by semicolons.")
+    v.P("func (e ValidationErrors) Error() string {")
+    v.P("msgs := make([]string, len(e))")
+    v.P("for i, err := range e {")
+    v.P("msgs[i] = err.Error()")
+    v.P("}")
+    v.P("return ", v.pkg("strings"), `.Join(msgs, "; ")`)
+    v.P("}")
+    v.P()
+    v.P("// _validateMessage validates the message m with its ValidateAll method if")
+    v.P("// all is set, and else with its Validate method, if it has them.")
+    v.P("func _validateMessage(m interface{}, all bool) error {")
+    v.P("if v, ok := m.(interface{ ValidateAll() error }); ok && all {")
+    v.P("return v.ValidateAll()")
+    v.P("}")
+    v.P("if v, ok := m.(interface{ Validate() error }); ok {")
+    v.P("return v.Validate()")
+    v.P("}")
+    v.P("return nil")
+    v.P("}")
+    v.P()
+}
+
+// generateMessage generates the Validate method of msg, and its ValidateAll
+// method with the validate_all parameter.
+func (v *validate) generateMessage(msg *generator.Descriptor) {
+    typeName := v.gen.TypeName(msg)
+    v.P("// Validate checks the field constraints of m, returning an error")
+    v.P("// describing the first one violated, or nil. The message fields are")
+    v.P("// validated in turn, if they have a Validate method.")
+    v.P("func (m *", typeName, ") Validate() error {")
+    if v.all {
+        v.P("return m.validate(false)")
+        v.P("}")
+        v.P()
+        v.P("// ValidateAll checks the field constraints of m, returning the")
+        v.P("// ValidationErrors of all the ones violated, or nil. The message fields")
+        v.P("// are validated in turn, with their ValidateAll method if they have one.")
+        v.P("func (m *", typeName, ") ValidateAll() error {")
+        v.P("return m.validate(true)")
+        v.P("}")
+        v.P()
+        v.P("// validate checks the field constraints of m, stopping at the first one")
+        v.P("// violated unless all is set.")
+        v.P("func (m *", typeName, ") validate(all bool) error {")
+    }
+    v.P("if m == nil {")
+    v.P("return nil")
+    v.P("}")
+    if v.all {
+        v.P("var errs ValidationErrors")
+    }
+    for _, field := range msg.Field {
+        if field.GetType() == pb.FieldDescriptorProto_TYPE_GROUP {
+            continue
+        }
+        fieldName := generator.CamelCase(field.GetName())
+        t := target{
+            field: field,
+            value: "m.Get" + fieldName + "()",
+            name:  strconv.Quote(strings.Join(msg.TypeName(), ".") + "." + field.GetName()),
+            ident: "_" + typeName + "_" + fieldName,
+        }
+        if field.OneofIndex != nil {
+            if len(fieldRules(field).Bytes()) == 0 && field.GetType() != pb.FieldDescriptorProto_TYPE_MESSAGE {
+                continue
+            }
+            oneof := generator.CamelCase(msg.OneofDecl[field.GetOneofIndex()].GetName())
+            v.P("if _, ok := m.Get", oneof, "().(*", typeName, "_", fieldName, "); ok {")
+            v.generateField(t)
+            v.P("}")
+            continue
+        }
+        v.generateField(t)
+    }
+    if v.all {
+        v.P("if len(errs) > 0 {")
+        v.P("return errs")
+        v.P("}")
+    }
+    v.P("return nil")
+    v.P("}")
+    v.P()
+}
+
+// generateField generates the checks of the field of t.
+func (v *validate) generateField(t target) {
+    rules := fieldRules(t.field)
+    if rules.Bytes() != nil {
+        if b, ok := rules.Varint(requiredRule); ok && b != 0 {
+            v.generateRequired(t)
+        }
+        if b, ok := rules.Message(messageRules); ok {
+            if req, ok := wire.NewMessage(b).Varint(2); ok && req != 0 {
+                v.generateRequired(t)
+            }
+        }
+    }
+    switch {
+    case descutil.MapEntry(v.gen, t.field) != nil:
+        v.checkRules(t, rules, mapRules, requiredRule)
+        v.generateMap(t, rules)
+    case t.field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        v.checkRules(t, rules, repeatedRules, requiredRule)
+        v.generateRepeated(t, rules)
+    default:
+        v.checkRules(t, rules, typeRules[t.field.GetType()], requiredRule)
+        v.generateValue(t, rules)
+    }
+}
+
+// generateRequired generates the check that the value of t is set, or not
+// empty.
+func (v *validate) generateRequired(t target) {
+    switch {
+    case t.field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED:
+        v.P("if len(", t.value, ") == 0 {")
+    case t.field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE:
+        v.P("if ", t.value, " == nil {")
+    case t.field.GetType() == pb.FieldDescriptorProto_TYPE_STRING, t.field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES:
+        v.P("if len(", t.value, ") == 0 {")
+    case t.field.GetType() == pb.FieldDescriptorProto_TYPE_BOOL:
+        v.P("if !", t.value, " {")
+    default:
+        v.P("if ", t.value, " == 0 {")
+    }
+    v.fail(t, "value is required")
+}
+
+// generateRepeated generates the checks of the repeated field of t, and of
+// its elements.
+func (v *validate) generateRepeated(t target, rules *wire.Message) {
+    b, _ := rules.Message(repeatedRules)
+    sub := wire.NewMessage(b)
+    v.checkRules(t, sub, 1, 2, 3, 4)
+    if n, ok := sub.Varint(1); ok {
+        v.P("if len(", t.value, ") < ", fmt.Sprint(n), " {")
+        v.fail(t, fmt.Sprintf("value must contain at least %d item(s)", n))
+    }
+    if n, ok := sub.Varint(2); ok {
+        v.P("if len(", t.value, ") > ", fmt.Sprint(n), " {")
+        v.fail(t, fmt.Sprintf("value must contain no more than %d item(s)", n))
+    }
+    unique, _ := sub.Varint(3)
+    items, _ := sub.Message(4)
+    isMessage := t.field.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE
+    if unique == 0 && items == nil && !isMessage {
+        return
+    }
+
+    elem := target{
+        field: t.field,
+        value: "item",
+        name:  v.gen.Pkg["fmt"] + ".Sprintf(" + strconv.Quote(unquote(t.name)+"[%d]") + ", i)",
+        ident: t.ident + "_items",
+    }
+    seen := "seen" + strings.TrimPrefix(t.ident[strings.LastIndex(t.ident, "_"):], "_")
+    if unique != 0 {
+        if isMessage {
+            v.gen.Fail("unsupported unique rule of", unquote(t.name)+": the items are messages")
+        }
+        v.P(seen, " := make(map[interface{}]bool, len(", t.value, "))")
+    }
+    v.P("for i, item := range ", t.value, " {")
+    if unique != 0 {
+        key := "item"
+        if t.field.GetType() == pb.FieldDescriptorProto_TYPE_BYTES {
+            key = "string(item)"
+        }
+        v.P("if ", seen, "[", key, "] {")
+        v.fail(elem, "value must be unique")
+        v.P(seen, "[", key, "] = true")
+    }
+    itemRules := wire.NewMessage(items)
+    v.checkRules(elem, itemRules, typeRules[t.field.GetType()])
+    v.generateValue(elem, itemRules)
+    v.P("}")
+}
+
+// generateMap generates the checks of the map field of t, and of its keys
+// and values.
+func (v *validate) generateMap(t target, rules *wire.Message) {
+    entry := descutil.MapEntry(v.gen, t.field)
+    b, _ := rules.Message(mapRules)
+    sub := wire.NewMessage(b)
+    v.checkRules(t, sub, 1, 2, 4, 5)
+    if n, ok := sub.Varint(1); ok {
+        v.P("if len(", t.value, ") < ", fmt.Sprint(n), " {")
+        v.fail(t, fmt.Sprintf("value must contain at least %d pair(s)", n))
+    }
+    if n, ok := sub.Varint(2); ok {
+        v.P("if len(", t.value, ") > ", fmt.Sprint(n), " {")
+        v.fail(t, fmt.Sprintf("value must contain no more than %d pair(s)", n))
+    }
+    keys, _ := sub.Message(4)
+    values, _ := sub.Message(5)
+    keyField, valueField := entry.Field[0], entry.Field[1]
+    checkValues := values != nil || valueField.GetType() == pb.FieldDescriptorProto_TYPE_MESSAGE
+    if keys == nil && !checkValues {
+        return
+    }
+
+    name := v.gen.Pkg["fmt"] + ".Sprintf(" + strconv.Quote(unquote(t.name)+"[%v]") + ", key)"
+    if checkValues {
+        v.P("for key, value := range ", t.value, " {")
+    } else {
+        v.P("for key := range ", t.value, " {")
+    }
+    key := target{field: keyField, value: "key", name: name, ident: t.ident + "_keys"}
+    keyRules := wire.NewMessage(keys)
+    v.checkRules(key, keyRules, typeRules[keyField.GetType()])
+    v.generateValue(key, keyRules)
+    if checkValues {
+        value := target{field: valueField, value: "value", name: name, ident: t.ident + "_values"}
+        valueRules := wire.NewMessage(values)
+        v.checkRules(value, valueRules, typeRules[valueField.GetType()])
+        v.generateValue(value, valueRules)
+    }
+    v.P("}")
+}
+
+// generateValue generates the checks of the single value of t, given the
+// FieldRules rules.
+func (v *validate) generateValue(t target, rules *wire.Message) {
+    typ := t.field.GetType()
+    b, ok := rules.Message(typeRules[typ])
+    sub := wire.NewMessage(b)
+    switch typ {
+    case pb.FieldDescriptorProto_TYPE_MESSAGE:
+        v.checkRules(t, sub, 1, 2)
+        if skip, _ := sub.Varint(1); skip != 0 {
+            return
+        }
+        fieldErr := v.gen.Pkg["fmt"] + ".Errorf(\"invalid %s: %v\", " + t.name + ", err)"
+        if v.all {
+            v.P("if err := _validateMessage(", t.value, ", all); err != nil {")
+            v.violate(fieldErr)
+            v.P("}")
+            return
+        }
+        v.P("if v, ok := interface{}(", t.value, ").(interface{ Validate() error }); ok {")
+        v.P("if err := v.Validate(); err != nil {")
+        v.violate(fieldErr)
+        v.P("}")
+        v.P("}")
+        return
+    }
+    if !ok {
+        return
+    }
+    switch typ {
+    case pb.FieldDescriptorProto_TYPE_STRING:
+        v.generateString(t, sub)
+    case pb.FieldDescriptorProto_TYPE_BYTES:
+        v.generateBytes(t, sub)
+    case pb.FieldDescriptorProto_TYPE_BOOL:
+        v.checkRules(t, sub, 1)
+        if c, ok := sub.Varint(1); ok {
+            v.P("if ", t.value, " != ", c != 0, " {")
+            v.fail(t, fmt.Sprintf("value must equal %t", c != 0))
+        }
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        v.checkRules(t, sub, 1, 2, 3, 4)
+        if c := literals(typ, sub, 1); c != nil {
+            v.P("if ", t.value, " != ", c[len(c)-1], " {")
+            v.fail(t, "value must equal "+c[len(c)-1])
+        }
+        if defined, _ := sub.Varint(2); defined != 0 {
+            v.gen.RecordTypeUse(t.field.GetTypeName())
+            enumName := v.gen.TypeName(v.gen.ObjectNamed(t.field.GetTypeName()))
+            v.P("if _, ok := ", enumName, "_name[int32(", t.value, ")]; !ok {")
+            v.fail(t, "value must be one of the defined enum values")
+        }
+        v.generateIn(t, literals(typ, sub, 3), literals(typ, sub, 4))
+    default:
+        v.generateNumber(t, sub)
+    }
+}
+
+// generateNumber generates the checks of the numeric value of t, given its
+// rules.
+func (v *validate) generateNumber(t target, rules *wire.Message) {
+    typ := t.field.GetType()
+    // 8 is the example value of protovalidate, which does not constrain it.
+    v.checkRules(t, rules, 1, 2, 3, 4, 5, 6, 7, 8)
+    last := func(num int32) (string, bool) {
+        if xs := literals(typ, rules, num); xs != nil {
+            return xs[len(xs)-1], true
+        }
+        return "", false
+    }
+    if c, ok := last(1); ok {
+        v.P("if ", t.value, " != ", c, " {")
+        v.fail(t, "value must equal "+c)
+    }
+
+    type bound struct {
+        op, value string
+    }
+    var lower, upper *bound
+    if x, ok := last(4); ok {
+        lower = &bound{">", x}
+    } else if x, ok := last(5); ok {
+        lower = &bound{">=", x}
+    }
+    if x, ok := last(2); ok {
+        upper = &bound{"<", x}
+    } else if x, ok := last(3); ok {
+        upper = &bound{"<=", x}
+    }
+    words := map[string]string{">": "greater than", ">=": "greater than or equal to", "<": "less than", "<=": "less than or equal to"}
+    negations := map[string]string{">": "<=", ">=": "<", "<": ">=", "<=": ">"}
+    switch {
+    case lower != nil && upper != nil:
+        // As in protoc-gen-validate, an upper bound lower than the lower
+        // bound requires the value to be outside of the range.
+        lo, _ := strconv.ParseFloat(lower.value, 64)
+        up, _ := strconv.ParseFloat(upper.value, 64)
+        join, violated := "and", "||"
+        if up < lo {
+            join, violated = "or", "&&"
+        }
+        v.P("if ", t.value, " ", negations[lower.op], " ", lower.value, " ", violated, " ", t.value, " ", negations[upper.op], " ", upper.value, " {")
+        v.fail(t, fmt.Sprintf("value must be %s %s %s %s %s", words[lower.op], lower.value, join, words[upper.op], upper.value))
+    case lower != nil || upper != nil:
+        b := lower
+        if b == nil {
+            b = upper
+        }
+        v.P("if ", t.value, " ", negations[b.op], " ", b.value, " {")
+        v.fail(t, fmt.Sprintf("value must be %s %s", words[b.op], b.value))
+    }
+    v.generateIn(t, literals(typ, rules, 6), literals(typ, rules, 7))
+}
+
+// generateString generates the checks of the string value of t, given its
+// rules.
+func (v *validate) generateString(t target, rules *wire.Message) {
+    v.checkRules(t, rules, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 14, 15, 16, 17, 18, 19, 20, 22, 23)
+    if c, ok := rules.LengthDelimited(1); ok {
+        v.P("if ", t.value, " != ", strconv.Quote(string(c)), " {")
+        v.fail(t, "value must equal "+strconv.Quote(string(c)))
+    }
+    runeCount := func() string { return v.pkg("unicode/utf8") + ".RuneCountInString(" + t.value + ")" }
+    byteCount := func() string { return "len(" + t.value + ")" }
+    lengths := []struct {
+        num        int32
+        length     func() string
+        op         string
+        must, unit string
+    }{
+        {19, runeCount, "!=", "exactly", "runes"},
+        {2, runeCount, "<", "at least", "runes"},
+        {3, runeCount, ">", "at most", "runes"},
+        {20, byteCount, "!=", "exactly", "bytes"},
+        {4, byteCount, "<", "at least", "bytes"},
+        {5, byteCount, ">", "at most", "bytes"},
+    }
+    for _, l := range lengths {
+        if n, ok := rules.Varint(l.num); ok {
+            v.P("if ", l.length(), " ", l.op, " ", fmt.Sprint(n), " {")
+            v.fail(t, fmt.Sprintf("value length must be %s %d %s", l.must, n, l.unit))
+        }
+    }
+    if p, ok := rules.LengthDelimited(6); ok {
+        re := v.pattern(t, "_pattern", string(p))
+        v.P("if !", re, ".MatchString(", t.value, ") {")
+        v.fail(t, "value does not match regex pattern "+strconv.Quote(string(p)))
+    }
+    affixes := []struct {
+        num         int32
+        fn, not     string
+        description string
+    }{
+        {7, "HasPrefix", "!", "value does not have prefix"},
+        {8, "HasSuffix", "!", "value does not have suffix"},
+        {9, "Contains", "!", "value does not contain substring"},
+        {23, "Contains", "", "value contains substring"},
+    }
+    for _, a := range affixes {
+        if s, ok := rules.LengthDelimited(a.num); ok {
+            v.P("if ", a.not, v.pkg("strings"), ".", a.fn, "(", t.value, ", ", strconv.Quote(string(s)), ") {")
+            v.fail(t, a.description+" "+strconv.Quote(string(s)))
+        }
+    }
+    v.generateIn(t, quoted(rules.RepeatedLengthDelimited(10)), quoted(rules.RepeatedLengthDelimited(11)))
+
+    isSet := func(num int32) bool {
+        b, _ := rules.Varint(num)
+        return b != 0
+    }
+    if isSet(12) {
+        v.P("if a, err := ", v.pkg("net/mail"), ".ParseAddress(", t.value, "); err != nil || a.Address != ", t.value, " {")
+        v.fail(t, "value must be a valid email address")
+    }
+    if isSet(14) {
+        v.P("if ", v.pkg("net"), ".ParseIP(", t.value, ") == nil {")
+        v.fail(t, "value must be a valid IP address")
+    }
+    if isSet(15) {
+        v.P("if ip := ", v.pkg("net"), ".ParseIP(", t.value, "); ip == nil || ip.To4() == nil {")
+        v.fail(t, "value must be a valid IPv4 address")
+    }
+    if isSet(16) {
+        v.P("if ip := ", v.pkg("net"), ".ParseIP(", t.value, "); ip == nil || ip.To4() != nil {")
+        v.fail(t, "value must be a valid IPv6 address")
+    }
+    if isSet(17) {
+        v.P("if u, err := ", v.pkg("net/url"), ".Parse(", t.value, "); err != nil || !u.IsAbs() {")
+        v.fail(t, "value must be a valid absolute URI")
+    }
+    if isSet(18) {
+        v.P("if _, err := ", v.pkg("net/url"), ".Parse(", t.value, "); err != nil {")
+        v.fail(t, "value must be a valid URI")
+    }
+    if isSet(22) {
+        re := v.pattern(t, "_uuid", uuidPattern)
+        v.P("if !", re, ".MatchString(", t.value, ") {")
+        v.fail(t, "value must be a valid UUID")
+    }
+}
+
+// generateBytes generates the checks of the bytes value of t, given its
+// rules.
+func (v *validate) generateBytes(t target, rules *wire.Message) {
+    v.checkRules(t, rules, 1, 2, 3, 4, 5, 6, 7, 8, 9, 13)
+    if c, ok := rules.LengthDelimited(1); ok {
+        v.P("if !", v.pkg("bytes"), ".Equal(", t.value, ", []byte(", strconv.Quote(string(c)), ")) {")
+        v.fail(t, "value must equal "+strconv.Quote(string(c)))
+    }
+    lengths := []struct {
+        num      int32
+        op, must string
+    }{
+        {13, "!=", "exactly"},
+        {2, "<", "at least"},
+        {3, ">", "at most"},
+    }
+    for _, l := range lengths {
+        if n, ok := rules.Varint(l.num); ok {
+            v.P("if len(", t.value, ") ", l.op, " ", fmt.Sprint(n), " {")
+            v.fail(t, fmt.Sprintf("value length must be %s %d bytes", l.must, n))
+        }
+    }
+    if p, ok := rules.LengthDelimited(4); ok {
+        re := v.pattern(t, "_pattern", string(p))
+        v.P("if !", re, ".Match(", t.value, ") {")
+        v.fail(t, "value does not match regex pattern "+strconv.Quote(string(p)))
+    }
+    affixes := []struct {
+        num         int32
+        fn          string
+        description string
+    }{
+        {5, "HasPrefix", "value does not have prefix"},
+        {6, "HasSuffix", "value does not have suffix"},
+        {7, "Contains", "value does not contain"},
+    }
+    for _, a := range affixes {
+        if s, ok := rules.LengthDelimited(a.num); ok {
+            v.P("if !", v.pkg("bytes"), ".", a.fn, "(", t.value, ", []byte(", strconv.Quote(string(s)), ")) {")
+            v.fail(t, a.description+" "+strconv.Quote(string(s)))
+        }
+    }
+    in, notIn := quoted(rules.RepeatedLengthDelimited(8)), quoted(rules.RepeatedLengthDelimited(9))
+    if in != nil || notIn != nil {
+        t.value = "string(" + t.value + ")"
+        v.generateIn(t, in, notIn)
+    }
+}
+
+// generateIn generates the checks that the value of t is one of the Go
+// literals in, if any, and none of notIn.
+func (v *validate) generateIn(t target, in, notIn []string) {
+    if len(in) > 0 {
+        v.P("switch ", t.value, " {")
+        v.P("case ", strings.Join(in, ", "), ":")
+        v.P("default:")
+        v.violate(v.errorf(t, "value must be in list ["+strings.Join(in, ", ")+"]"))
+        v.P("}")
+    }
+    if len(notIn) > 0 {
+        v.P("switch ", t.value, " {")
+        v.P("case ", strings.Join(notIn, ", "), ":")
+        v.violate(v.errorf(t, "value must not be in list ["+strings.Join(notIn, ", ")+"]"))
+        v.P("}")
+    }
+}
+
+// fail generates the return of the violation of the check opened by the
+// caller, described by msg, and closes the check.
+func (v *validate) fail(t target, msg string) {
+    v.violate(v.errorf(t, msg))
+    v.P("}")
+}
+
+// violate generates the return of the error err, the Go expression of a
+// violation, or with the validate_all parameter its collection, returning
+// only if all is not set.
+func (v *validate) violate(err string) {
+    if !v.all {
+        v.P("return ", err)
+        return
+    }
+    v.P("errs = append(errs, ", err, ")")
+    v.P("if !all {")
+    v.P("return errs[0]")
+    v.P("}")
+}
+
+// errorf returns the Go expression of the error of the value of t violating
+// a constraint, described by msg.
+func (v *validate) errorf(t target, msg string) string {
+    format := "invalid %s: " + strings.Replace(msg, "%", "%%", -1)
+    return v.gen.Pkg["fmt"] + ".Errorf(" + strconv.Quote(format) + ", " + t.name + ")"
+}
+
+// pattern returns the name of the variable holding the regexp of pattern,
+// suffixed with suffix, for the value of t.
+func (v *validate) pattern(t target, suffix, pattern string) string {
+    if _, err := regexp.Compile(pattern); err != nil {
+        v.gen.Fail(fmt.Sprintf("invalid pattern rule of %s: %v", unquote(t.name), err))
+    }
+    name := t.ident + suffix
+    v.patterns = append(v.patterns, [2]string{name, pattern})
+    return name
+}
+
+// checkRules fails the generation if rules has fields other than the
+// supported ones, given by number.
+func (v *validate) checkRules(t target, rules *wire.Message, supported ...int32) {
+    for _, num := range fieldNumbers(rules.Bytes()) {
+        ok := false
+        for _, s := range supported {
+            ok = ok || num == s
+        }
+        if !ok {
+            v.gen.Fail(fmt.Sprintf("unsupported validation rule %d of %s", num, unquote(t.name)))
+        }
+    }
+    if err := rules.Err(); err != nil {
+        v.gen.Fail(fmt.Sprintf("invalid validation rules of %s: %v", unquote(t.name), err))
+    }
+}
+
+// fieldRules returns the serialized FieldRules of field, given by either
+// option, or an empty message.
+func fieldRules(field *pb.FieldDescriptorProto) *wire.Message {
+    opts := descutil.Options(field.Options)
+    for _, num := range []int32{pgvRulesOption, bufFieldOption} {
+        if b, ok := opts.Message(num); ok {
+            return wire.NewMessage(b)
+        }
+    }
+    return wire.NewMessage(nil)
+}
+
+// fieldNumbers returns the numbers of the fields of the serialized message
+// data, in order, as long as it parses.
+func fieldNumbers(data []byte) []int32 {
+    var nums []int32
+    b := proto.NewBuffer(data)
+    for {
+        key, err := b.DecodeVarint()
+        if err != nil {
+            return nums
+        }
+        switch key & 7 {
+        case proto.WireVarint:
+            _, err = b.DecodeVarint()
+        case proto.WireFixed64:
+            _, err = b.DecodeFixed64()
+        case proto.WireBytes:
+            _, err = b.DecodeRawBytes(false)
+        case proto.WireFixed32:
+            _, err = b.DecodeFixed32()
+        default:
+            return nums
+        }
+        if err != nil {
+            return nums
+        }
+        nums = append(nums, int32(key>>3))
+    }
+}
+
+// literals returns the values of the field num of rules, of the field type
+// typ, as Go literals.
+func literals(typ pb.FieldDescriptorProto_Type, rules *wire.Message, num int32) []string {
+    var lits []string
+    switch typ {
+    case pb.FieldDescriptorProto_TYPE_FLOAT:
+        for _, x := range rules.RepeatedFixed32(num) {
+            lits = append(lits, strconv.FormatFloat(float64(math.Float32frombits(x)), 'g', -1, 32))
+        }
+    case pb.FieldDescriptorProto_TYPE_DOUBLE:
+        for _, x := range rules.RepeatedFixed64(num) {
+            lits = append(lits, strconv.FormatFloat(math.Float64frombits(x), 'g', -1, 64))
+        }
+    case pb.FieldDescriptorProto_TYPE_INT32, pb.FieldDescriptorProto_TYPE_INT64, pb.FieldDescriptorProto_TYPE_ENUM:
+        for _, x := range rules.RepeatedVarint(num) {
+            lits = append(lits, strconv.FormatInt(int64(x), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_UINT32, pb.FieldDescriptorProto_TYPE_UINT64:
+        for _, x := range rules.RepeatedVarint(num) {
+            lits = append(lits, strconv.FormatUint(x, 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_SINT32, pb.FieldDescriptorProto_TYPE_SINT64:
+        for _, x := range rules.RepeatedVarint(num) {
+            lits = append(lits, strconv.FormatInt(wire.DecodeZigzag64(x), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_FIXED32:
+        for _, x := range rules.RepeatedFixed32(num) {
+            lits = append(lits, strconv.FormatUint(uint64(x), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_SFIXED32:
+        for _, x := range rules.RepeatedFixed32(num) {
+            lits = append(lits, strconv.FormatInt(int64(int32(x)), 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_FIXED64:
+        for _, x := range rules.RepeatedFixed64(num) {
+            lits = append(lits, strconv.FormatUint(x, 10))
+        }
+    case pb.FieldDescriptorProto_TYPE_SFIXED64:
+        for _, x := range rules.RepeatedFixed64(num) {
+            lits = append(lits, strconv.FormatInt(int64(x), 10))
+        }
+    }
+    return lits
+}
+
+// quoted returns the values as Go string literals.
+func quoted(values [][]byte) []string {
+    var lits []string
+    for _, b := range values {
+        lits = append(lits, strconv.Quote(string(b)))
+    }
+    return lits
+}
+
+// unquote returns the Go string literal s unquoted.
+func unquote(s string) string {
+    u, err := strconv.Unquote(s)
+    if err != nil {
+        return s
+    }
+    return u
+}
@@ -0,0 +1,209 @@
+// Package view outputs read-only views over serialized messages.
+//
+// For every message Foo it generates a FooView type whose getters decode
+// the fields they return on demand from the serialized Foo, so that
+// reading a few fields of a large message does not materialize all of it.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package view
+
+import (
+    "fmt"
+    "strings"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+const wirePkgPath = "github.com/lleveque/protoc-gen-go/wire"
+
+// wirePkg is the name of the wire package in the generated code, which
+// may vary from "wire" if the name is used by other packages.
+var wirePkg string
+
+func init() {
+    generator.RegisterPlugin(new(view))
+}
+
+// view is an implementation of the Go protocol buffer compiler's
+// plugin architecture. It generates views over the serialized messages
+// of each file.
+type view struct {
+    gen *generator.Generator
+}
+
+// scalar describes how a scalar field is read from a wire.Message.
+type scalar struct {
+    goType   string // Go type of the value
+    accessor string // wire.Message method reading the singular field
+    conv     string // conversion of the accessor result x, as a format string
+}
+
+// scalars maps the scalar field types to their accessor. The accessors of
+// repeated fields are the same, with a Repeated prefix.
+var scalars = map[pb.FieldDescriptorProto_Type]scalar{
+    pb.FieldDescriptorProto_TYPE_DOUBLE:   {"float64", "Fixed64", "%s.Float64frombits(x)"},
+    pb.FieldDescriptorProto_TYPE_FLOAT:    {"float32", "Fixed32", "%s.Float32frombits(x)"},
+    pb.FieldDescriptorProto_TYPE_INT64:    {"int64", "Varint", "int64(x)"},
+    pb.FieldDescriptorProto_TYPE_UINT64:   {"uint64", "Varint", "x"},
+    pb.FieldDescriptorProto_TYPE_INT32:    {"int32", "Varint", "int32(x)"},
+    pb.FieldDescriptorProto_TYPE_FIXED64:  {"uint64", "Fixed64", "x"},
+    pb.FieldDescriptorProto_TYPE_FIXED32:  {"uint32", "Fixed32", "x"},
+    pb.FieldDescriptorProto_TYPE_BOOL:     {"bool", "Varint", "x != 0"},
+    pb.FieldDescriptorProto_TYPE_STRING:   {"string", "LengthDelimited", "string(x)"},
+    pb.FieldDescriptorProto_TYPE_BYTES:    {"[]byte", "LengthDelimited", "x"},
+    pb.FieldDescriptorProto_TYPE_UINT32:   {"uint32", "Varint", "uint32(x)"},
+    pb.FieldDescriptorProto_TYPE_SFIXED32: {"int32", "Fixed32", "int32(x)"},
+    pb.FieldDescriptorProto_TYPE_SFIXED64: {"int64", "Fixed64", "int64(x)"},
+    pb.FieldDescriptorProto_TYPE_SINT32:   {"int32", "Varint", "int32(x>>1) ^ -int32(x&1)"},
+    pb.FieldDescriptorProto_TYPE_SINT64:   {"int64", "Varint", "int64(x>>1) ^ -int64(x&1)"},
+}
+
+// Name returns the name of this plugin, "view".
+func (v *view) Name() string {
+    return "view"
+}
+
+// Init initializes the plugin.
+func (v *view) Init(gen *generator.Generator) {
+    v.gen = gen
+    wirePkg = generator.RegisterUniquePackageName("wire", nil)
+}
+
+// P forwards to v.gen.P.
+func (v *view) P(args ...interface{}) { v.gen.P(args...) }
+
+// Generate generates the views of the messages in the given file.
+func (v *view) Generate(file *generator.FileDescriptor) {
+    for _, msg := range descutil.Messages(v.gen, file) {
+        v.generateView(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (v *view) GenerateImports(file *generator.FileDescriptor) {
+    if len(file.MessageType) == 0 {
+        return
+    }
+    v.P("import ", wirePkg, " ", fmt.Sprintf("%q", wirePkgPath))
+}
+
+// generateView generates the view type of msg, its constructor and getters.
+func (v *view) generateView(msg *generator.Descriptor) {
+    typeName := v.gen.TypeName(msg)
+    viewName := typeName + "View"
+
+    v.P("// ", viewName, " is a read-only view of a serialized ", typeName, ".")
+    v.P("// Its getters decode the fields on demand, returning the zero value")
+    v.P("// (or the default value) of unset fields as the ", typeName, " getters do.")
+    v.P("type ", viewName, " struct {")
+    v.P("m *", wirePkg, ".Message")
+    v.P("}")
+    v.P()
+    v.P("// New", viewName, " returns a view of the serialized ", typeName, " in data.")
+    v.P("// data is not copied and must not be modified while the view is in use.")
+    v.P("func New", viewName, "(data []byte) ", viewName, " { return ", viewName, "{", wirePkg, ".NewMessage(data)} }")
+    v.P()
+    v.P("// Bytes returns the serialized ", typeName, ".")
+    v.P("func (v ", viewName, ") Bytes() []byte { return v.m.Bytes() }")
+    v.P()
+    v.P("// Err returns the error met while parsing the serialized ", typeName, ", if any.")
+    v.P("func (v ", viewName, ") Err() error { return v.m.Err() }")
+    v.P()
+    v.P("// Unmarshal decodes the whole ", typeName, ".")
+    v.P("func (v ", viewName, ") Unmarshal() (*", typeName, ", error) {")
+    v.P("m := new(", typeName, ")")
+    v.P("if err := ", v.gen.Pkg["proto"], ".Unmarshal(v.Bytes(), m); err != nil {")
+    v.P("return nil, err")
+    v.P("}")
+    v.P("return m, nil")
+    v.P("}")
+    v.P()
+
+    for _, field := range msg.Field {
+        v.generateGetter(msg, viewName, field)
+    }
+}
+
+// generateGetter generates the getter of field in the view of msg.
+// Map and group fields are not supported and get no getter.
+func (v *view) generateGetter(msg *generator.Descriptor, viewName string, field *pb.FieldDescriptorProto) {
+    fieldName := generator.CamelCase(field.GetName())
+    repeated := field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED
+    num := fmt.Sprint(field.GetNumber())
+
+    var goType, accessor, conv string
+    switch field.GetType() {
+    case pb.FieldDescriptorProto_TYPE_GROUP:
+        return
+    case pb.FieldDescriptorProto_TYPE_MESSAGE:
+        obj := v.gen.ObjectNamed(field.GetTypeName())
+        if desc, ok := obj.(*generator.Descriptor); ok && desc.GetOptions().GetMapEntry() {
+            return
+        }
+        if v.generated(obj) {
+            goType = v.gen.TypeName(obj) + "View"
+            conv = "New" + goType + "(x)"
+        } else {
+            // Views are only generated along with this file: other messages
+            // are returned serialized.
+            goType, conv = "[]byte", "x"
+        }
+        accessor = "Message"
+        if repeated {
+            accessor = "LengthDelimited"
+        }
+    case pb.FieldDescriptorProto_TYPE_ENUM:
+        v.gen.RecordTypeUse(field.GetTypeName())
+        goType = v.gen.TypeName(v.gen.ObjectNamed(field.GetTypeName()))
+        accessor, conv = "Varint", goType+"(x)"
+    default:
+        s := scalars[field.GetType()]
+        goType, accessor, conv = s.goType, s.accessor, s.conv
+        if strings.Contains(conv, "%s") {
+            conv = fmt.Sprintf(conv, v.gen.Pkg["math"])
+        }
+    }
+
+    v.P("// Get", fieldName, " decodes the ", field.GetName(), " field.")
+    if repeated {
+        v.P("func (v ", viewName, ") Get", fieldName, "() []", goType, " {")
+        v.P("xs := v.m.Repeated", accessor, "(", num, ")")
+        v.P("if xs == nil {")
+        v.P("return nil")
+        v.P("}")
+        v.P("vals := make([]", goType, ", len(xs))")
+        v.P("for i, x := range xs {")
+        v.P("vals[i] = ", conv)
+        v.P("}")
+        v.P("return vals")
+        v.P("}")
+        v.P()
+        return
+    }
+    v.P("func (v ", viewName, ") Get", fieldName, "() ", goType, " {")
+    if field.DefaultValue != nil {
+        v.P("x, ok := v.m.", accessor, "(", num, ")")
+        v.P("if !ok {")
+        v.P("return Default_", v.gen.TypeName(msg), "_", fieldName)
+        v.P("}")
+    } else {
+        v.P("x, _ := v.m.", accessor, "(", num, ")")
+    }
+    v.P("return ", conv)
+    v.P("}")
+    v.P()
+}
+
+// generated reports whether obj is defined in one of the files being
+// generated, and therefore has a view.
+func (v *view) generated(obj generator.Object) bool {
+    for _, name := range v.gen.Request.FileToGenerate {
+        if obj.File().GetName() == name {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,221 @@
+package wire
+
+import (
+    "bytes"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+
+    "github.com/golang/protobuf/proto"
+)
+
+// FieldInfo describes a field of a message to Explain.
+type FieldInfo struct {
+    Name   string        // name of the field
+    Type   string        // type of the field as written in .proto files, "message" for messages and maps, "enum" for enums
+    Fields func() Fields // fields of the message type of a message field, nil if unknown
+}
+
+// Fields describes the fields of a message to Explain, by number.
+type Fields map[int32]FieldInfo
+
+// wireTypeNames are the names of the wire types in the dumps.
+var wireTypeNames = []string{"VARINT", "I64", "LEN", "SGROUP", "EGROUP", "I32"}
+
+// maxDumpedBytes is the number of bytes of a field dumped in hexadecimal,
+// beyond which the bytes are elided.
+const maxDumpedBytes = 12
+
+// Explain returns an annotated dump of the serialized message in data, of
+// the given fields, for debugging corrupt payloads. Each field gets a line
+// with its offsets in data, its bytes, its tag (number and wire type), its
+// name and type, and its decoded value; message fields are followed by
+// their own fields, indented. Unknown fields are dumped by wire type, and
+// the dump of a message stops at its first malformed field, with the error.
+func Explain(data []byte, fields Fields) string {
+    var b bytes.Buffer
+    explain(&b, data, 0, 0, fields)
+    return b.String()
+}
+
+// explain writes to b the dump of the fields in data, found at offset base
+// of the whole data, indented by depth.
+func explain(b *bytes.Buffer, data []byte, base, depth int, fields Fields) {
+    line := func(start, end int, desc string) {
+        fmt.Fprintf(b, "%06d-%06d  %-*s  %s%s\n", base+start, base+end, 3*maxDumpedBytes+2, hexDump(data[start:end]), strings.Repeat("  ", depth), desc)
+    }
+    for off := 0; off < len(data); {
+        start := off
+        key, n := proto.DecodeVarint(data[off:])
+        if n == 0 {
+            line(start, len(data), "error: truncated tag")
+            return
+        }
+        off += n
+        num, wireType := int32(key>>3), int(key&7)
+        if wireType >= len(wireTypeNames) {
+            line(start, off, fmt.Sprintf("error: invalid wire type %d of field %d", wireType, num))
+            return
+        }
+        desc := fmt.Sprintf("%d:%s", num, wireTypeNames[wireType])
+        f, known := fields[num]
+        if known {
+            desc += " " + f.Name + " (" + f.Type + ")"
+            if !wireTypeMatches(f.Type, wireType) {
+                desc += " wire type mismatch"
+                f = FieldInfo{}
+            }
+        } else {
+            desc += " (unknown)"
+        }
+
+        var value string
+        switch wireType {
+        case proto.WireVarint:
+            x, n := proto.DecodeVarint(data[off:])
+            if n == 0 {
+                line(start, len(data), desc+" error: truncated varint")
+                return
+            }
+            off += n
+            value = varintValue(f.Type, x)
+        case proto.WireFixed64:
+            if len(data)-off < 8 {
+                line(start, len(data), desc+" error: truncated 64-bit value")
+                return
+            }
+            value = fixed64Value(f.Type, decodeFixed64(data[off:]))
+            off += 8
+        case proto.WireFixed32:
+            if len(data)-off < 4 {
+                line(start, len(data), desc+" error: truncated 32-bit value")
+                return
+            }
+            value = fixed32Value(f.Type, decodeFixed32(data[off:]))
+            off += 4
+        case proto.WireBytes:
+            l, n := proto.DecodeVarint(data[off:])
+            if n == 0 || l > uint64(len(data)-off-n) {
+                line(start, len(data), desc+" error: truncated length-delimited value")
+                return
+            }
+            payload := data[off+n : off+n+int(l)]
+            payloadStart := off + n
+            off = payloadStart + len(payload)
+            desc += fmt.Sprintf(" len=%d", len(payload))
+            switch f.Type {
+            case "string":
+                value = strconv.Quote(string(payload))
+            case "message":
+                line(start, off, desc+" {")
+                var nested Fields
+                if f.Fields != nil {
+                    nested = f.Fields()
+                }
+                explain(b, payload, base+payloadStart, depth+1, nested)
+                fmt.Fprintf(b, "%*s  %s}\n", 15+3*maxDumpedBytes+2, "", strings.Repeat("  ", depth))
+                continue
+            default:
+                value = packedValues(f.Type, payload)
+            }
+        }
+        if value != "" {
+            desc += " = " + value
+        }
+        line(start, off, desc)
+    }
+}
+
+// wireTypeMatches reports whether a field of type typ may be encoded with
+// wireType, packed repeated fields included.
+func wireTypeMatches(typ string, wireType int) bool {
+    switch typ {
+    case "string", "bytes", "message":
+        return wireType == proto.WireBytes
+    case "group":
+        return wireType == proto.WireStartGroup || wireType == proto.WireEndGroup
+    case "fixed64", "sfixed64", "double":
+        return wireType == proto.WireFixed64 || wireType == proto.WireBytes
+    case "fixed32", "sfixed32", "float":
+        return wireType == proto.WireFixed32 || wireType == proto.WireBytes
+    }
+    return wireType == proto.WireVarint || wireType == proto.WireBytes
+}
+
+// varintValue returns the varint x decoded as a field of type typ.
+func varintValue(typ string, x uint64) string {
+    switch typ {
+    case "int32", "int64", "enum":
+        return strconv.FormatInt(int64(x), 10)
+    case "sint32", "sint64":
+        return strconv.FormatInt(DecodeZigzag64(x), 10)
+    case "bool":
+        return strconv.FormatBool(x != 0)
+    }
+    return strconv.FormatUint(x, 10)
+}
+
+// fixed64Value returns the 64-bit value x decoded as a field of type typ.
+func fixed64Value(typ string, x uint64) string {
+    switch typ {
+    case "double":
+        return strconv.FormatFloat(math.Float64frombits(x), 'g', -1, 64)
+    case "sfixed64":
+        return strconv.FormatInt(int64(x), 10)
+    }
+    return strconv.FormatUint(x, 10)
+}
+
+// fixed32Value returns the 32-bit value x decoded as a field of type typ.
+func fixed32Value(typ string, x uint32) string {
+    switch typ {
+    case "float":
+        return strconv.FormatFloat(float64(math.Float32frombits(x)), 'g', -1, 32)
+    case "sfixed32":
+        return strconv.FormatInt(int64(int32(x)), 10)
+    }
+    return strconv.FormatUint(uint64(x), 10)
+}
+
+// packedValues returns the values of the packed repeated field of type typ
+// in payload, or payload in hexadecimal if typ is not a scalar type.
+func packedValues(typ string, payload []byte) string {
+    var values []string
+    switch typ {
+    case "int32", "int64", "uint32", "uint64", "sint32", "sint64", "bool", "enum":
+        for b := payload; len(b) > 0; {
+            x, n := proto.DecodeVarint(b)
+            if n == 0 {
+                return "[" + strings.Join(values, " ") + " error: truncated varint]"
+            }
+            values = append(values, varintValue(typ, x))
+            b = b[n:]
+        }
+    case "fixed64", "sfixed64", "double":
+        if len(payload)%8 != 0 {
+            return "error: packed 64-bit values of " + strconv.Itoa(len(payload)) + " bytes"
+        }
+        for b := payload; len(b) > 0; b = b[8:] {
+            values = append(values, fixed64Value(typ, decodeFixed64(b)))
+        }
+    case "fixed32", "sfixed32", "float":
+        if len(payload)%4 != 0 {
+            return "error: packed 32-bit values of " + strconv.Itoa(len(payload)) + " bytes"
+        }
+        for b := payload; len(b) > 0; b = b[4:] {
+            values = append(values, fixed32Value(typ, decodeFixed32(b)))
+        }
+    default:
+        return fmt.Sprintf("% x", payload)
+    }
+    return "[" + strings.Join(values, " ") + "]"
+}
+
+// hexDump returns the bytes b in hexadecimal, elided beyond maxDumpedBytes.
+func hexDump(b []byte) string {
+    if len(b) > maxDumpedBytes {
+        return fmt.Sprintf("% x ..", b[:maxDumpedBytes])
+    }
+    return fmt.Sprintf("% x", b)
+}
@@ -0,0 +1,273 @@
+// Package wire reads fields of serialized protocol buffer messages on demand.
+//
+// It backs the XxxView types generated by the view plugin: a Message only
+// scans the top level of its data, the first time a field is looked up, and
+// values are decoded as they are requested. Explain backs the ExplainWire
+// methods generated by the explain plugin, dumping serialized messages for
+// debugging.
+package wire
+
+import (
+    "errors"
+    "io"
+    "sync"
+
+    "github.com/golang/protobuf/proto"
+)
+
+// errGroup is reported for messages using the deprecated group encoding,
+// which views do not support.
+var errGroup = errors.New("wire: groups are not supported")
+
+// field is an occurrence of a field in the data of a message.
+type field struct {
+    wireType int
+    val      []byte // varint bytes, fixed bytes, or length-delimited payload
+}
+
+// Message is a serialized message indexed lazily by field number.
+// A nil *Message behaves as an empty message. It is safe for concurrent
+// use: the index is built once, by the first lookup.
+type Message struct {
+    data   []byte
+    once   sync.Once
+    fields map[int32][]field
+    err    error
+}
+
+// NewMessage returns a Message reading data, which is not copied.
+func NewMessage(data []byte) *Message {
+    return &Message{data: data}
+}
+
+// Bytes returns the serialized message.
+func (m *Message) Bytes() []byte {
+    if m == nil {
+        return nil
+    }
+    return m.data
+}
+
+// Err returns the error met while indexing the message, if any.
+func (m *Message) Err() error {
+    if m == nil {
+        return nil
+    }
+    m.index()
+    return m.err
+}
+
+// index scans the top level of the data once, recording where each field is.
+// On malformed data, fields seen before the error stay accessible.
+func (m *Message) index() {
+    m.once.Do(m.scan)
+}
+
+// scan builds the index of the message, as index does.
+func (m *Message) scan() {
+    m.fields = make(map[int32][]field)
+    data := m.data
+    for len(data) > 0 {
+        key, n := proto.DecodeVarint(data)
+        if n == 0 {
+            m.err = io.ErrUnexpectedEOF
+            return
+        }
+        data = data[n:]
+        f := field{wireType: int(key & 7)}
+        switch f.wireType {
+        case proto.WireVarint:
+            if _, n = proto.DecodeVarint(data); n == 0 {
+                m.err = io.ErrUnexpectedEOF
+                return
+            }
+        case proto.WireFixed64:
+            n = 8
+        case proto.WireFixed32:
+            n = 4
+        case proto.WireBytes:
+            l, ln := proto.DecodeVarint(data)
+            if ln == 0 || l > uint64(len(data)-ln) {
+                m.err = io.ErrUnexpectedEOF
+                return
+            }
+            data = data[ln:]
+            n = int(l)
+        default:
+            m.err = errGroup
+            return
+        }
+        if n > len(data) {
+            m.err = io.ErrUnexpectedEOF
+            return
+        }
+        f.val, data = data[:n], data[n:]
+        num := int32(key >> 3)
+        m.fields[num] = append(m.fields[num], f)
+    }
+}
+
+// lookup returns the occurrences of field num.
+func (m *Message) lookup(num int32) []field {
+    if m == nil {
+        return nil
+    }
+    m.index()
+    return m.fields[num]
+}
+
+// last returns the last occurrence of field num with the given wire type,
+// which is the one that counts for singular fields.
+func (m *Message) last(num int32, wireType int) ([]byte, bool) {
+    fields := m.lookup(num)
+    for i := len(fields) - 1; i >= 0; i-- {
+        if fields[i].wireType == wireType {
+            return fields[i].val, true
+        }
+    }
+    return nil, false
+}
+
+// Varint returns the value of the singular varint field num.
+func (m *Message) Varint(num int32) (uint64, bool) {
+    b, ok := m.last(num, proto.WireVarint)
+    if !ok {
+        return 0, false
+    }
+    x, _ := proto.DecodeVarint(b)
+    return x, true
+}
+
+// Fixed32 returns the value of the singular fixed32 field num.
+func (m *Message) Fixed32(num int32) (uint32, bool) {
+    b, ok := m.last(num, proto.WireFixed32)
+    if !ok {
+        return 0, false
+    }
+    return decodeFixed32(b), true
+}
+
+// Fixed64 returns the value of the singular fixed64 field num.
+func (m *Message) Fixed64(num int32) (uint64, bool) {
+    b, ok := m.last(num, proto.WireFixed64)
+    if !ok {
+        return 0, false
+    }
+    return decodeFixed64(b), true
+}
+
+// LengthDelimited returns the payload of the singular length-delimited field num,
+// without copying it.
+func (m *Message) LengthDelimited(num int32) ([]byte, bool) {
+    return m.last(num, proto.WireBytes)
+}
+
+// Message returns the serialized singular message field num. When the
+// field occurs more than once its occurrences are concatenated, which
+// merges them as proto.Unmarshal would.
+func (m *Message) Message(num int32) ([]byte, bool) {
+    var parts [][]byte
+    for _, f := range m.lookup(num) {
+        if f.wireType == proto.WireBytes {
+            parts = append(parts, f.val)
+        }
+    }
+    switch len(parts) {
+    case 0:
+        return nil, false
+    case 1:
+        return parts[0], true
+    }
+    var merged []byte
+    for _, p := range parts {
+        merged = append(merged, p...)
+    }
+    return merged, true
+}
+
+// RepeatedVarint returns the values of the repeated varint field num,
+// whether they are packed or not.
+func (m *Message) RepeatedVarint(num int32) []uint64 {
+    var xs []uint64
+    for _, f := range m.lookup(num) {
+        switch f.wireType {
+        case proto.WireVarint:
+            x, _ := proto.DecodeVarint(f.val)
+            xs = append(xs, x)
+        case proto.WireBytes:
+            for b := f.val; len(b) > 0; {
+                x, n := proto.DecodeVarint(b)
+                if n == 0 {
+                    break
+                }
+                xs = append(xs, x)
+                b = b[n:]
+            }
+        }
+    }
+    return xs
+}
+
+// RepeatedFixed32 returns the values of the repeated fixed32 field num,
+// whether they are packed or not.
+func (m *Message) RepeatedFixed32(num int32) []uint32 {
+    var xs []uint32
+    for _, f := range m.lookup(num) {
+        switch f.wireType {
+        case proto.WireFixed32:
+            xs = append(xs, decodeFixed32(f.val))
+        case proto.WireBytes:
+            for b := f.val; len(b) >= 4; b = b[4:] {
+                xs = append(xs, decodeFixed32(b))
+            }
+        }
+    }
+    return xs
+}
+
+// RepeatedFixed64 returns the values of the repeated fixed64 field num,
+// whether they are packed or not.
+func (m *Message) RepeatedFixed64(num int32) []uint64 {
+    var xs []uint64
+    for _, f := range m.lookup(num) {
+        switch f.wireType {
+        case proto.WireFixed64:
+            xs = append(xs, decodeFixed64(f.val))
+        case proto.WireBytes:
+            for b := f.val; len(b) >= 8; b = b[8:] {
+                xs = append(xs, decodeFixed64(b))
+            }
+        }
+    }
+    return xs
+}
+
+// RepeatedLengthDelimited returns the payloads of the repeated
+// length-delimited field num, without copying them.
+func (m *Message) RepeatedLengthDelimited(num int32) [][]byte {
+    var bs [][]byte
+    for _, f := range m.lookup(num) {
+        if f.wireType == proto.WireBytes {
+            bs = append(bs, f.val)
+        }
+    }
+    return bs
+}
+
+// DecodeZigzag32 decodes a sint32 value.
+func DecodeZigzag32(x uint64) int32 {
+    return int32(uint32(x>>1) ^ uint32(-(int32(x) & 1)))
+}
+
+// DecodeZigzag64 decodes a sint64 value.
+func DecodeZigzag64(x uint64) int64 {
+    return int64(x>>1) ^ -(int64(x) & 1)
+}
+
+func decodeFixed32(b []byte) uint32 {
+    return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func decodeFixed64(b []byte) uint64 {
+    return uint64(decodeFixed32(b)) | uint64(decodeFixed32(b[4:]))<<32
+}
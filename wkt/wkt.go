@@ -0,0 +1,190 @@
+// Package wkt outputs helpers converting the fields of well-known types to
+// and from their Go counterparts.
+//
+// For every singular field foo of a message typed google.protobuf.Timestamp
+// it generates a GetFooTime() time.Time method, returning the zero time if
+// the field is unset, and a SetFoo(t time.Time) method, unsetting it for the
+// zero time, and for every google.protobuf.Duration field GetFooDuration()
+// time.Duration and SetFoo(d time.Duration) methods, so that the
+// implementations need not convert them by hand. The fields of oneofs are
+// set by their setter whatever the value. No helper is generated whose name
+// would be taken by a field.
+// It runs as a plugin for the Go protocol buffer compiler plugin.
+// It is linked in to protoc-gen-go.
+
+package wkt
+
+import (
+    "strconv"
+
+    pb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+    "github.com/golang/protobuf/protoc-gen-go/generator"
+    "github.com/lleveque/protoc-gen-go/internal/descutil"
+)
+
+// The full names of the well-known types converted.
+const (
+    timestampType = ".google.protobuf.Timestamp"
+    durationType  = ".google.protobuf.Duration"
+)
+
+const timePkgPath = "time"
+
+// timePkg is the name of the time package in the generated code, which
+// may vary from "time" if the name is used by other packages.
+var timePkg string
+
+func init() {
+    generator.RegisterPlugin(new(wkt))
+}
+
+// wkt is an implementation of the Go protocol buffer compiler's plugin
+// architecture. It generates the conversion helpers of the fields of
+// well-known types.
+type wkt struct {
+    gen *generator.Generator
+
+    usesTime bool // the file being generated uses the time package
+}
+
+// Name returns the name of this plugin, "wkt".
+func (w *wkt) Name() string {
+    return "wkt"
+}
+
+// Init initializes the plugin.
+func (w *wkt) Init(gen *generator.Generator) {
+    w.gen = gen
+    timePkg = generator.RegisterUniquePackageName("time", nil)
+}
+
+// typeName returns the name of the type named str in the .proto, as we
+// will print it, and records that we use it.
+func (w *wkt) typeName(str string) string {
+    w.gen.RecordTypeUse(str)
+    return w.gen.TypeName(w.gen.ObjectNamed(str))
+}
+
+// P forwards to w.gen.P.
+func (w *wkt) P(args ...interface{}) { w.gen.P(args...) }
+
+// Generate generates the conversion helpers of the messages in the given
+// file.
+func (w *wkt) Generate(file *generator.FileDescriptor) {
+    w.usesTime = false
+    if !descutil.IsGenerated(w.gen, file.GetName()) {
+        return
+    }
+    for _, msg := range descutil.Messages(w.gen, file) {
+        w.generateMessage(msg)
+    }
+}
+
+// GenerateImports generates the import declaration for this file.
+func (w *wkt) GenerateImports(file *generator.FileDescriptor) {
+    if !w.usesTime {
+        return
+    }
+    w.P("import ", timePkg, " ", strconv.Quote(timePkgPath))
+    w.P()
+}
+
+// timeFields returns the singular fields of msg typed Timestamp or
+// Duration.
+func timeFields(msg *generator.Descriptor) []*pb.FieldDescriptorProto {
+    var fields []*pb.FieldDescriptorProto
+    for _, field := range msg.Field {
+        if field.GetLabel() == pb.FieldDescriptorProto_LABEL_REPEATED {
+            continue
+        }
+        if typ := field.GetTypeName(); typ == timestampType || typ == durationType {
+            fields = append(fields, field)
+        }
+    }
+    return fields
+}
+
+// generateMessage generates the conversion helpers of the fields of msg.
+func (w *wkt) generateMessage(msg *generator.Descriptor) {
+    typeName := w.gen.TypeName(msg)
+    names := make(map[string]bool)
+    for _, field := range msg.Field {
+        names[generator.CamelCase(field.GetName())] = true
+        names["Get"+generator.CamelCase(field.GetName())] = true
+    }
+    for _, oneof := range msg.OneofDecl {
+        names[generator.CamelCase(oneof.GetName())] = true
+        names["Get"+generator.CamelCase(oneof.GetName())] = true
+    }
+    for _, field := range timeFields(msg) {
+        fieldName := generator.CamelCase(field.GetName())
+        wktType := w.typeName(field.GetTypeName())
+
+        // value assigns to the field the wrapper v.
+        value := func(v string) string {
+            if field.OneofIndex != nil {
+                oneofName := generator.CamelCase(msg.OneofDecl[field.GetOneofIndex()].GetName())
+                return "m." + oneofName + " = &" + typeName + "_" + fieldName + "{" + fieldName + ": " + v + "}"
+            }
+            return "m." + fieldName + " = " + v
+        }
+
+        if field.GetTypeName() == timestampType {
+            if getter := "Get" + fieldName + "Time"; !names[getter] {
+                w.usesTime = true
+                w.P("// ", getter, " returns the ", field.GetName(), " field of m as a time.Time in UTC, the")
+                w.P("// zero time if it is unset.")
+                w.P("func (m *", typeName, ") ", getter, "() ", timePkg, ".Time {")
+                w.P("ts := m.Get", fieldName, "()")
+                w.P("if ts == nil {")
+                w.P("return ", timePkg, ".Time{}")
+                w.P("}")
+                w.P("return ", timePkg, ".Unix(ts.Seconds, int64(ts.Nanos)).UTC()")
+                w.P("}")
+                w.P()
+            }
+            if setter := "Set" + fieldName; !names[setter] {
+                w.usesTime = true
+                if field.OneofIndex != nil {
+                    w.P("// ", setter, " sets the ", field.GetName(), " field of m to t.")
+                } else {
+                    w.P("// ", setter, " sets the ", field.GetName(), " field of m to t, or unsets it if t is the")
+                    w.P("// zero time.")
+                }
+                w.P("func (m *", typeName, ") ", setter, "(t ", timePkg, ".Time) {")
+                if field.OneofIndex == nil {
+                    w.P("if t.IsZero() {")
+                    w.P(value("nil"))
+                    w.P("return")
+                    w.P("}")
+                }
+                w.P(value("&" + wktType + "{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}"))
+                w.P("}")
+                w.P()
+            }
+            continue
+        }
+
+        if getter := "Get" + fieldName + "Duration"; !names[getter] {
+            w.usesTime = true
+            w.P("// ", getter, " returns the ", field.GetName(), " field of m as a time.Duration, 0 if")
+            w.P("// it is unset.")
+            w.P("func (m *", typeName, ") ", getter, "() ", timePkg, ".Duration {")
+            w.P("d := m.Get", fieldName, "()")
+            w.P("if d == nil {")
+            w.P("return 0")
+            w.P("}")
+            w.P("return ", timePkg, ".Duration(d.Seconds)*", timePkg, ".Second + ", timePkg, ".Duration(d.Nanos)")
+            w.P("}")
+            w.P()
+        }
+        if setter := "Set" + fieldName; !names[setter] {
+            w.usesTime = true
+            w.P("// ", setter, " sets the ", field.GetName(), " field of m to d.")
+            w.P("func (m *", typeName, ") ", setter, "(d ", timePkg, ".Duration) {")
+            w.P(value("&" + wktType + "{Seconds: int64(d / " + timePkg + ".Second), Nanos: int32(d % " + timePkg + ".Second)}"))
+            w.P("}")
+            w.P()
+        }
+    }
+}